@@ -0,0 +1,176 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"math"
+)
+
+// AdmissionControlInfo describes the DB's capacity to accept writes without
+// stalling. Writes stall when the mutable memtable must be rotated while
+// either the memtables have reached Options.MemTableStopWritesThreshold, or
+// L0's read amplification has reached Options.L0StopWritesThreshold. Unlike
+// EventListener.WriteStallBegin, which reports stalls once they've begun,
+// AdmissionControlInfo allows callers to throttle writes ahead of a stall.
+type AdmissionControlInfo struct {
+	// L0Sublevels is the number of L0 sublevels, which is the read
+	// amplification of L0.
+	L0Sublevels int
+	// L0NumFiles is the number of files in L0.
+	L0NumFiles int64
+	// MemTableFill is the fraction of the memtable budget
+	// (MemTableStopWritesThreshold * MemTableSize) in use by the mutable
+	// memtable and the queued immutable memtables. Writes stall when the
+	// fill approaches 1.
+	MemTableFill float64
+	// FlushDebt is the number of bytes in immutable memtables awaiting flush.
+	FlushDebt uint64
+	// CompactionDebt is an estimate of the number of bytes that need to be
+	// compacted for the LSM to reach a stable state.
+	CompactionDebt uint64
+	// WriteStallImminent is true if writes will stall when the mutable
+	// memtable is next rotated.
+	WriteStallImminent bool
+	// WriteTokenRate is the recommended rate, in bytes per second, at which to
+	// admit writes. It's derived from the peak flush throughput, reduced as
+	// L0 and the memtables approach their stall thresholds. It's
+	// math.MaxUint64 if writes need not be limited, and zero if writes will
+	// stall.
+	WriteTokenRate uint64
+}
+
+// AdmissionControlInfo returns the DB's current capacity to accept writes.
+func (d *DB) AdmissionControlInfo() AdmissionControlInfo {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	vers := d.mu.versions.currentVersion()
+	info := AdmissionControlInfo{
+		L0Sublevels:    vers.L0Sublevels.ReadAmplification(),
+		L0NumFiles:     int64(vers.Levels[0].Len()),
+		CompactionDebt: d.mu.versions.picker.estimatedCompactionDebt(0),
+	}
+	var used uint64
+	queue := d.mu.mem.queue
+	for i := 0; i < len(queue)-1; i++ {
+		info.FlushDebt += queue[i].inuseBytes()
+		used += queue[i].totalBytes()
+	}
+	used += d.mu.mem.mutable.inuseBytes()
+	limit := uint64(d.opts.MemTableStopWritesThreshold) * uint64(d.opts.MemTableSize)
+	info.MemTableFill = float64(used) / float64(limit)
+	info.WriteStallImminent = d.writeStallImminentLocked()
+
+	// Compute the pressure on L0 and the memtables, scaling from 0 when no
+	// action is required to 1 when writes will stall.
+	var l0Pressure float64
+	if info.L0Sublevels >= d.opts.L0StopWritesThreshold {
+		l0Pressure = 1
+	} else if d.opts.L0StopWritesThreshold > d.opts.L0CompactionThreshold {
+		l0Pressure = float64(info.L0Sublevels-d.opts.L0CompactionThreshold) /
+			float64(d.opts.L0StopWritesThreshold-d.opts.L0CompactionThreshold)
+	}
+	var memPressure float64
+	if info.MemTableFill >= 1 {
+		memPressure = 1
+	} else if size := uint64(d.opts.MemTableSize); limit > size && used > size {
+		// A single full memtable exerts no pressure.
+		memPressure = float64(used-size) / float64(limit-size)
+	}
+	pressure := math.Min(1, math.Max(l0Pressure, memPressure))
+	if info.WriteStallImminent {
+		pressure = 1
+	}
+	switch peakRate := d.mu.compact.flushWriteThroughput.PeakRate(); {
+	case pressure <= 0:
+		info.WriteTokenRate = math.MaxUint64
+	case pressure >= 1:
+		info.WriteTokenRate = 0
+	case peakRate <= 0:
+		// Without any flush history there's no basis for a recommendation.
+		info.WriteTokenRate = math.MaxUint64
+	default:
+		info.WriteTokenRate = uint64(float64(peakRate) * (1 - pressure))
+	}
+	return info
+}
+
+// WaitForCapacity blocks until a batch of approximately the provided size
+// can likely be applied without stalling, the context is canceled or the DB
+// is closed. It's intended to be called before applying large batches. The
+// capacity is not reserved, so concurrent writers may still encounter a
+// stall.
+func (d *DB) WaitForCapacity(ctx context.Context, bytes uint64) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.writeWouldStallLocked(bytes) {
+		return nil
+	}
+
+	// Waiters on d.mu.compact.cond are woken whenever a flush or compaction
+	// completes. Additionally wake this waiter if the context is canceled or
+	// the DB is closed.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-d.closedCh:
+		case <-done:
+			return
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.mu.compact.cond.Broadcast()
+	}()
+	for d.writeWouldStallLocked(bytes) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := d.closed.Load(); err != nil {
+			return err.(error)
+		}
+		d.mu.compact.cond.Wait()
+	}
+	return nil
+}
+
+// writeStallImminentLocked returns true if writes will stall when the mutable
+// memtable is next rotated. See DB.makeRoomForWrite.
+//
+// d.mu must be held.
+func (d *DB) writeStallImminentLocked() bool {
+	var size uint64
+	for i := range d.mu.mem.queue {
+		size += d.mu.mem.queue[i].totalBytes()
+	}
+	if size >= uint64(d.opts.MemTableStopWritesThreshold)*uint64(d.opts.MemTableSize) {
+		return true
+	}
+	return d.mu.versions.currentVersion().L0Sublevels.ReadAmplification() >= d.opts.L0StopWritesThreshold
+}
+
+// writeWouldStallLocked returns true if writing a batch of the provided size
+// would likely stall. A write stalls if it requires rotating the mutable
+// memtable while a stall is imminent.
+//
+// d.mu must be held.
+func (d *DB) writeWouldStallLocked(bytes uint64) bool {
+	if !d.writeStallImminentLocked() {
+		return false
+	}
+	return bytes >= uint64(d.largeBatchThreshold) ||
+		bytes > uint64(d.mu.mem.mutable.availBytes())
+}
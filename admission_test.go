@@ -0,0 +1,78 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmissionControl(t *testing.T) {
+	opts := &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		L0CompactionThreshold:       2,
+		L0StopWritesThreshold:       4,
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	info := d.AdmissionControlInfo()
+	require.Equal(t, 0, info.L0Sublevels)
+	require.False(t, info.WriteStallImminent)
+	require.Equal(t, uint64(math.MaxUint64), info.WriteTokenRate)
+	require.NoError(t, d.WaitForCapacity(context.Background(), 1<<30))
+
+	// Write overlapping flushes to grow the number of L0 sublevels.
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, d.Set([]byte("a"), []byte(fmt.Sprint(i)), nil))
+		require.NoError(t, d.Set([]byte("b"), []byte(fmt.Sprint(i)), nil))
+		info = d.AdmissionControlInfo()
+		require.Greater(t, info.MemTableFill, 0.0)
+		require.NoError(t, d.Flush())
+
+		info = d.AdmissionControlInfo()
+		require.Equal(t, i, info.L0Sublevels)
+		require.Equal(t, int64(i), info.L0NumFiles)
+		require.Equal(t, uint64(0), info.FlushDebt)
+		switch {
+		case i <= 2:
+			require.False(t, info.WriteStallImminent)
+			require.Equal(t, uint64(math.MaxUint64), info.WriteTokenRate)
+		case i == 3:
+			require.False(t, info.WriteStallImminent)
+			require.Greater(t, info.WriteTokenRate, uint64(0))
+			require.Less(t, info.WriteTokenRate, uint64(math.MaxUint64))
+		default:
+			require.True(t, info.WriteStallImminent)
+			require.Equal(t, uint64(0), info.WriteTokenRate)
+		}
+	}
+
+	// Small writes fit within the mutable memtable and don't wait. Large
+	// writes wait until the stall clears or the context is canceled.
+	require.NoError(t, d.WaitForCapacity(context.Background(), 1))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, d.WaitForCapacity(ctx, 1<<30), context.DeadlineExceeded)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- d.WaitForCapacity(context.Background(), 1<<30)
+	}()
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false))
+	require.NoError(t, <-errCh)
+
+	info = d.AdmissionControlInfo()
+	require.Equal(t, 0, info.L0Sublevels)
+	require.False(t, info.WriteStallImminent)
+}
@@ -0,0 +1,496 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/rangekey"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// AggregateValueFunc returns the numeric quantity aggregated by DB.Aggregate
+// for a visible key-value pair. If ok is false, the key-value pair is still
+// counted, but does not contribute to the sum, minimum or maximum.
+type AggregateValueFunc func(key, value []byte) (v int64, ok bool)
+
+// Aggregator configures an aggregation computed by DB.Aggregate.
+type Aggregator struct {
+	// Value optionally extracts a numeric quantity from each visible key-value
+	// pair, which is summed and whose minimum and maximum are computed. If nil,
+	// only counts and sizes are computed.
+	Value AggregateValueFunc
+	// PropertyName optionally names a block property collector constructed by
+	// NewAggregatePropertyCollector with the same Value function. sstables
+	// written with the collector may be summarized, in whole or per data block,
+	// without reading their data blocks.
+	PropertyName string
+}
+
+// AggregateResult holds the result of DB.Aggregate. All fields are exact.
+type AggregateResult struct {
+	// Count is the number of visible point keys.
+	Count uint64
+	// KeyBytes and ValueBytes are the sums of the lengths of the user keys and
+	// values of the visible point keys.
+	KeyBytes   uint64
+	ValueBytes uint64
+	// ValueCount is the number of visible point keys for which the Aggregator's
+	// Value function returned ok. Sum, Min and Max are only meaningful if
+	// ValueCount is non-zero.
+	ValueCount uint64
+	Sum        int64
+	Min        int64
+	Max        int64
+	// Stats describe how the result was computed.
+	Stats AggregateStats
+}
+
+// AggregateStats describe the work performed by DB.Aggregate.
+type AggregateStats struct {
+	// TablesSummarized is the number of sstables whose contribution was
+	// computed from table properties alone.
+	TablesSummarized int
+	// BlocksSummarized is the number of data blocks whose contribution was
+	// computed from block properties alone.
+	BlocksSummarized int
+	// TablesScanned is the number of sstables that were read directly, without
+	// merging their contents with other tables or memtables.
+	TablesScanned int
+	// KeysScanned is the number of point keys read from data blocks and
+	// memtables.
+	KeysScanned uint64
+}
+
+// aggregateSummary is the summary of a set of point keys, as encoded by the
+// aggregate block property collector.
+type aggregateSummary struct {
+	count      uint64
+	keyBytes   uint64
+	valueBytes uint64
+	valueCount uint64
+	sum        int64
+	min        int64
+	max        int64
+	// merges is set if the newest version of some key is a MERGE, in which case
+	// the summary is not usable.
+	merges bool
+}
+
+func (s *aggregateSummary) addKV(fn AggregateValueFunc, key, value []byte) {
+	s.count++
+	s.keyBytes += uint64(len(key))
+	s.valueBytes += uint64(len(value))
+	if fn == nil {
+		return
+	}
+	if v, ok := fn(key, value); ok {
+		s.addValue(v, v, v, 1)
+	}
+}
+
+func (s *aggregateSummary) addValue(sum, min, max int64, n uint64) {
+	if s.valueCount == 0 || min < s.min {
+		s.min = min
+	}
+	if s.valueCount == 0 || max > s.max {
+		s.max = max
+	}
+	s.sum += sum
+	s.valueCount += n
+}
+
+func (s *aggregateSummary) merge(o aggregateSummary) {
+	s.count += o.count
+	s.keyBytes += o.keyBytes
+	s.valueBytes += o.valueBytes
+	if o.valueCount > 0 {
+		s.addValue(o.sum, o.min, o.max, o.valueCount)
+	}
+	s.merges = s.merges || o.merges
+}
+
+const aggregateSummaryMerges = 1
+
+// encode appends the encoded summary to buf. The encoding is never empty.
+func (s *aggregateSummary) encode(buf []byte) []byte {
+	var flags uint64
+	if s.merges {
+		flags |= aggregateSummaryMerges
+	}
+	buf = binary.AppendUvarint(buf, flags)
+	buf = binary.AppendUvarint(buf, s.count)
+	buf = binary.AppendUvarint(buf, s.keyBytes)
+	buf = binary.AppendUvarint(buf, s.valueBytes)
+	buf = binary.AppendUvarint(buf, s.valueCount)
+	if s.valueCount > 0 {
+		buf = binary.AppendVarint(buf, s.sum)
+		buf = binary.AppendVarint(buf, s.min)
+		buf = binary.AppendVarint(buf, s.max)
+	}
+	return buf
+}
+
+func (s *aggregateSummary) decode(buf []byte) error {
+	*s = aggregateSummary{}
+	var vals [5]uint64
+	for i := range vals {
+		v, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return base.CorruptionErrorf("pebble: corrupt aggregate property")
+		}
+		vals[i], buf = v, buf[n:]
+	}
+	s.merges = vals[0]&aggregateSummaryMerges != 0
+	s.count, s.keyBytes, s.valueBytes, s.valueCount = vals[1], vals[2], vals[3], vals[4]
+	if s.valueCount > 0 {
+		for _, p := range []*int64{&s.sum, &s.min, &s.max} {
+			v, n := binary.Varint(buf)
+			if n <= 0 {
+				return base.CorruptionErrorf("pebble: corrupt aggregate property")
+			}
+			*p, buf = v, buf[n:]
+		}
+	}
+	return nil
+}
+
+// NewAggregatePropertyCollector returns a constructor for a block property
+// collector that summarizes the newest version of each point key in a data
+// block, index block and table, for use by DB.Aggregate. The collector must be
+// configured in Options.BlockPropertyCollectors, and the Aggregator passed to
+// DB.Aggregate must use the same name and value function.
+//
+// Versions of a user key are identified by comparing user keys with the
+// comparer's Equal function, which should be the DB's Comparer; if it's nil,
+// DefaultComparer is used. The collector requires values, and so is not
+// compatible with configurations in which compactions do not read values.
+func NewAggregatePropertyCollector(
+	name string, comparer *Comparer, fn AggregateValueFunc,
+) func() BlockPropertyCollector {
+	if comparer == nil {
+		comparer = DefaultComparer
+	}
+	equal := comparer.Equal
+	return func() BlockPropertyCollector {
+		return &aggregateCollector{name: name, equal: equal, fn: fn}
+	}
+}
+
+// aggregateCollector implements sstable.ValueBlockPropertyCollector.
+type aggregateCollector struct {
+	name    string
+	equal   Equal
+	fn      AggregateValueFunc
+	prevKey []byte
+	hasPrev bool
+
+	block aggregateSummary
+	index aggregateSummary
+	table aggregateSummary
+}
+
+var _ sstable.ValueBlockPropertyCollector = (*aggregateCollector)(nil)
+
+// Name implements the BlockPropertyCollector interface.
+func (c *aggregateCollector) Name() string {
+	return c.name
+}
+
+// RequiresValues implements the ValueBlockPropertyCollector interface.
+func (c *aggregateCollector) RequiresValues() bool {
+	return true
+}
+
+// Add implements the BlockPropertyCollector interface.
+func (c *aggregateCollector) Add(key InternalKey, value []byte) error {
+	if rangekey.IsRangeKey(key.Kind()) {
+		return nil
+	}
+	// Only the newest version of a user key contributes to the summary. The
+	// previous key is tracked across data blocks, so that a user key whose
+	// versions straddle blocks is only summarized by the first block.
+	if c.hasPrev && c.equal(c.prevKey, key.UserKey) {
+		return nil
+	}
+	c.prevKey = append(c.prevKey[:0], key.UserKey...)
+	c.hasPrev = true
+	switch key.Kind() {
+	case InternalKeyKindSet, InternalKeyKindSetWithDelete:
+		c.block.addKV(c.fn, key.UserKey, value)
+	case InternalKeyKindMerge:
+		c.block.merges = true
+	}
+	return nil
+}
+
+// FinishDataBlock implements the BlockPropertyCollector interface.
+func (c *aggregateCollector) FinishDataBlock(buf []byte) ([]byte, error) {
+	c.table.merge(c.block)
+	return c.block.encode(buf), nil
+}
+
+// AddPrevDataBlockToIndexBlock implements the BlockPropertyCollector
+// interface.
+func (c *aggregateCollector) AddPrevDataBlockToIndexBlock() {
+	c.index.merge(c.block)
+	c.block = aggregateSummary{}
+}
+
+// FinishIndexBlock implements the BlockPropertyCollector interface.
+func (c *aggregateCollector) FinishIndexBlock(buf []byte) ([]byte, error) {
+	buf = c.index.encode(buf)
+	c.index = aggregateSummary{}
+	return buf, nil
+}
+
+// FinishTable implements the BlockPropertyCollector interface.
+func (c *aggregateCollector) FinishTable(buf []byte) ([]byte, error) {
+	return c.table.encode(buf), nil
+}
+
+// Aggregate computes the count and total size of the visible point keys within
+// [lower, upper), and the sum, minimum and maximum of the quantities returned
+// by agg.Value for them. A nil bound is unbounded. Range keys are ignored.
+//
+// An sstable whose point keys do not overlap any other sstable or memtable
+// within the LSM contains the only version of each of its user keys, and is
+// aggregated without merging it with the rest of the LSM. Such an sstable is
+// summarized from its properties if it is wholly within the bounds, and
+// otherwise its data blocks that are wholly within the bounds are summarized
+// from their block properties. All other keys are read through an Iterator.
+func (d *DB) Aggregate(lower, upper []byte, agg *Aggregator) (AggregateResult, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if lower != nil && upper != nil && d.cmp(lower, upper) > 0 {
+		return AggregateResult{}, errors.New("invalid key-range specified (lower > upper)")
+	}
+	if agg == nil {
+		agg = &Aggregator{}
+	}
+
+	// The snapshot is taken before loading the readState, so that every key
+	// visible to the snapshot is present in the readState.
+	snap := d.NewSnapshot()
+	defer snap.Close()
+	readState := d.loadReadState()
+	defer readState.unref()
+
+	var files []*fileMetadata
+	for level := range readState.current.Levels {
+		iter := readState.current.Levels[level].Iter()
+		if level > 0 && lower != nil && upper != nil {
+			// See the comment in EstimateDiskUsage.
+			overlaps := readState.current.Overlaps(level, d.cmp, lower, upper, true /* exclusiveEnd */)
+			iter = overlaps.Iter()
+		}
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if !f.HasPointKeys ||
+				(upper != nil && d.cmp(f.SmallestPointKey.UserKey, upper) >= 0) ||
+				(lower != nil && d.cmp(f.LargestPointKey.UserKey, lower) < 0) {
+				continue
+			}
+			ok, err := d.aggregateIsolated(readState, f, snap.seqNum)
+			if err != nil {
+				return AggregateResult{}, err
+			}
+			if ok {
+				files = append(files, f)
+			}
+		}
+	}
+
+	var res AggregateResult
+	var sum aggregateSummary
+	for _, f := range files {
+		if err := d.aggregateTable(f, lower, upper, agg, &sum, &res.Stats); err != nil {
+			return AggregateResult{}, err
+		}
+	}
+
+	// Read the remaining keys through an iterator, skipping the key ranges of
+	// the isolated tables. Since no other sstable or memtable contains keys
+	// within those ranges, any key the iterator surfaces within them is from
+	// the isolated table.
+	sort.Slice(files, func(i, j int) bool {
+		return d.cmp(files[i].SmallestPointKey.UserKey, files[j].SmallestPointKey.UserKey) < 0
+	})
+	iter := snap.NewIter(&IterOptions{LowerBound: lower, UpperBound: upper})
+	j := 0
+	for valid := iter.First(); valid; {
+		key := iter.Key()
+		for j < len(files) && d.cmp(files[j].LargestPointKey.UserKey, key) < 0 {
+			j++
+		}
+		if j < len(files) && d.cmp(files[j].SmallestPointKey.UserKey, key) <= 0 {
+			largest := files[j].LargestPointKey.UserKey
+			if valid = iter.SeekGE(largest); valid && d.equal(iter.Key(), largest) {
+				valid = iter.Next()
+			}
+			j++
+			continue
+		}
+		value, err := iter.ValueAndErr()
+		if err != nil {
+			return AggregateResult{}, firstError(err, iter.Close())
+		}
+		res.Stats.KeysScanned++
+		sum.addKV(agg.Value, key, value)
+		valid = iter.Next()
+	}
+	if err := iter.Close(); err != nil {
+		return AggregateResult{}, err
+	}
+
+	res.Count, res.KeyBytes, res.ValueBytes = sum.count, sum.keyBytes, sum.valueBytes
+	res.ValueCount, res.Sum, res.Min, res.Max = sum.valueCount, sum.sum, sum.min, sum.max
+	return res, nil
+}
+
+// aggregateIsolated returns true if the point keys of the provided file may be
+// aggregated in isolation: the file contains no range deletions or merge
+// operands, all its keys are visible at seqNum, and its point keys' bounds do
+// not overlap any other file's point keys or any memtable.
+func (d *DB) aggregateIsolated(readState *readState, f *fileMetadata, seqNum uint64) (bool, error) {
+	if f.Virtual || f.LargestSeqNum >= seqNum || f.LargestPointKey.IsExclusiveSentinel() {
+		return false, nil
+	}
+	props, err := d.tableCache.getTableProperties(f)
+	if err != nil {
+		return false, err
+	}
+	if props.NumRangeDeletions > 0 || props.NumMergeOperands > 0 {
+		return false, nil
+	}
+	smallest, largest := f.SmallestPointKey.UserKey, f.LargestPointKey.UserKey
+	for level := range readState.current.Levels {
+		overlaps := readState.current.Overlaps(level, d.cmp, smallest, largest, false /* exclusiveEnd */)
+		iter := overlaps.Iter()
+		for o := iter.First(); o != nil; o = iter.Next() {
+			if o == f || !o.HasPointKeys {
+				continue
+			}
+			if d.cmp(o.SmallestPointKey.UserKey, largest) <= 0 &&
+				sstableKeyCompare(d.cmp, o.LargestPointKey, f.SmallestPointKey) >= 0 {
+				return false, nil
+			}
+		}
+	}
+	for _, mem := range readState.memtables {
+		if ingestMemtableOverlaps(d.cmp, mem, []*fileMetadata{f}) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// recordsSnapshotPinnedKeys returns true if the table's format guarantees that
+// its SnapshotPinnedKeys property is recorded.
+func recordsSnapshotPinnedKeys(r *sstable.Reader) bool {
+	f, err := r.TableFormat()
+	return err == nil && f >= sstable.TableFormatPebblev8
+}
+
+// aggregateTable adds the point keys of the isolated file f within
+// [lower, upper) to sum.
+func (d *DB) aggregateTable(
+	f *fileMetadata, lower, upper []byte, agg *Aggregator, sum *aggregateSummary, stats *AggregateStats,
+) error {
+	// Only bounds that truncate the file are relevant.
+	if lower != nil && d.cmp(lower, f.SmallestPointKey.UserKey) <= 0 {
+		lower = nil
+	}
+	if upper != nil && d.cmp(f.LargestPointKey.UserKey, upper) < 0 {
+		upper = nil
+	}
+	return d.tableCache.withReader(f.PhysicalMeta(), func(r *sstable.Reader) error {
+		if lower == nil && upper == nil {
+			if prop, ok := r.Properties.UserProperties[agg.PropertyName]; ok && agg.PropertyName != "" && len(prop) > 0 {
+				var s aggregateSummary
+				if err := s.decode([]byte(prop[1:])); err == nil && !s.merges {
+					sum.merge(s)
+					stats.TablesSummarized++
+					return nil
+				}
+			}
+			// Without a value function, the table properties suffice if every
+			// entry is the sole version of a live user key. Only tables whose
+			// format guarantees that SnapshotPinnedKeys is recorded can be
+			// trusted not to hold older versions; older tables report zero
+			// whether or not they do.
+			if p := &r.Properties; agg.Value == nil && p.NumDeletions == 0 &&
+				p.NumMergeOperands == 0 && p.SnapshotPinnedKeys == 0 &&
+				recordsSnapshotPinnedKeys(r) {
+				sum.count += p.NumEntries
+				sum.keyBytes += p.RawKeySize - p.NumEntries*base.InternalTrailerLen
+				sum.valueBytes += p.RawValueSize
+				stats.TablesSummarized++
+				return nil
+			}
+		}
+
+		spans, err := r.SummarizeBlocks(lower, upper, agg.PropertyName, func(prop []byte) bool {
+			var s aggregateSummary
+			if prop == nil || s.decode(prop) != nil || s.merges {
+				return false
+			}
+			sum.merge(s)
+			stats.BlocksSummarized++
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if len(spans) == 0 {
+			return nil
+		}
+		stats.TablesScanned++
+		iter, err := r.NewIter(nil /* lower */, nil /* upper */)
+		if err != nil {
+			return err
+		}
+		var prevKey []byte
+		var hasPrev bool
+		for _, span := range spans {
+			var key *InternalKey
+			var lv LazyValue
+			if span.Start != nil {
+				key, lv = iter.SeekGE(span.Start, base.SeekGEFlagsNone)
+			} else {
+				key, lv = iter.First()
+			}
+			for ; key != nil; key, lv = iter.Next() {
+				if span.StartExclusive && d.equal(key.UserKey, span.Start) {
+					continue
+				}
+				if span.End != nil {
+					if c := d.cmp(key.UserKey, span.End); c > 0 || (c == 0 && !span.EndInclusive) {
+						break
+					}
+				}
+				// The first version of each user key is the newest.
+				if hasPrev && d.equal(prevKey, key.UserKey) {
+					continue
+				}
+				prevKey = append(prevKey[:0], key.UserKey...)
+				hasPrev = true
+				stats.KeysScanned++
+				switch key.Kind() {
+				case InternalKeyKindSet, InternalKeyKindSetWithDelete:
+					value, _, err := lv.Value(nil)
+					if err != nil {
+						return firstError(err, iter.Close())
+					}
+					sum.addKV(agg.Value, key.UserKey, value)
+				}
+			}
+		}
+		return iter.Close()
+	})
+}
@@ -0,0 +1,236 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// parseIntValue is the AggregateValueFunc used by tests, interpreting values as
+// base-10 integers.
+func parseIntValue(key, value []byte) (int64, bool) {
+	v, err := strconv.ParseInt(string(value), 10, 64)
+	return v, err == nil
+}
+
+func newAggregateTestOptions() *Options {
+	opts := &Options{
+		FS: vfs.NewMem(),
+		BlockPropertyCollectors: []func() BlockPropertyCollector{
+			NewAggregatePropertyCollector("agg", nil /* comparer */, parseIntValue),
+		},
+		DisableAutomaticCompactions: true,
+		FormatMajorVersion:          FormatNewest,
+	}
+	// Enable value blocks, which requires the aggregate collector to be passed
+	// values explicitly.
+	opts.Experimental.EnableValueBlocks = func() bool { return true }
+	opts.EnsureDefaults()
+	for i := range opts.Levels {
+		opts.Levels[i].BlockSize = 1
+		opts.Levels[i].IndexBlockSize = 1
+	}
+	return opts
+}
+
+func TestAggregate(t *testing.T) {
+	var d *DB
+	defer func() {
+		if d != nil {
+			require.NoError(t, d.Close())
+		}
+	}()
+
+	datadriven.RunTest(t, "testdata/aggregate", func(t *testing.T, td *datadriven.TestData) string {
+		switch td.Cmd {
+		case "define":
+			if d != nil {
+				require.NoError(t, d.Close())
+			}
+			opts := newAggregateTestOptions()
+			if td.HasArg("no-collector") {
+				opts.BlockPropertyCollectors = nil
+			}
+			if td.HasArg("format-kv-checksums") {
+				opts.FormatMajorVersion = ExperimentalFormatKVChecksums
+			}
+			var err error
+			if d, err = runDBDefineCmd(td, opts); err != nil {
+				return err.Error()
+			}
+			d.mu.Lock()
+			s := d.mu.versions.currentVersion().String()
+			d.mu.Unlock()
+			return s
+
+		case "batch":
+			b := d.NewBatch()
+			if err := runBatchDefineCmd(td, b); err != nil {
+				return err.Error()
+			}
+			if err := b.Commit(nil); err != nil {
+				return err.Error()
+			}
+			return ""
+
+		case "aggregate":
+			var lower, upper []byte
+			agg := &Aggregator{}
+			for _, arg := range td.CmdArgs {
+				switch arg.Key {
+				case "lower":
+					lower = []byte(arg.Vals[0])
+				case "upper":
+					upper = []byte(arg.Vals[0])
+				case "values":
+					agg.Value = parseIntValue
+				case "property":
+					agg.PropertyName = arg.Vals[0]
+				default:
+					return fmt.Sprintf("unknown argument %q", arg.Key)
+				}
+			}
+			res, err := d.Aggregate(lower, upper, agg)
+			if err != nil {
+				return err.Error()
+			}
+			s := fmt.Sprintf("count=%d key-bytes=%d value-bytes=%d", res.Count, res.KeyBytes, res.ValueBytes)
+			if agg.Value != nil {
+				s += fmt.Sprintf("\nvalues=%d sum=%d min=%d max=%d", res.ValueCount, res.Sum, res.Min, res.Max)
+			}
+			return s + fmt.Sprintf("\nstats: %+v", res.Stats)
+
+		default:
+			return fmt.Sprintf("unknown command: %s", td.Cmd)
+		}
+	})
+}
+
+// TestAggregateCollectorEqual tests that the collector identifies versions of
+// a user key with the comparer's Equal function.
+func TestAggregateCollectorEqual(t *testing.T) {
+	comparer := *DefaultComparer
+	comparer.Equal = bytes.EqualFold
+	c := NewAggregatePropertyCollector("agg", &comparer, parseIntValue)().(*aggregateCollector)
+	for _, k := range []InternalKey{
+		base.MakeInternalKey([]byte("a"), 3, InternalKeyKindSet),
+		base.MakeInternalKey([]byte("A"), 2, InternalKeyKindSet),
+		base.MakeInternalKey([]byte("b"), 1, InternalKeyKindSet),
+	} {
+		require.NoError(t, c.Add(k, []byte("1")))
+	}
+	require.Equal(t, uint64(2), c.block.count)
+}
+
+// TestAggregateRandomized compares the result of DB.Aggregate against a scan of
+// the DB through an Iterator.
+func TestAggregateRandomized(t *testing.T) {
+	seed := time.Now().UnixNano()
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	opts := newAggregateTestOptions()
+	for i := range opts.Levels {
+		opts.Levels[i].BlockSize = 1 + rng.Intn(256)
+		opts.Levels[i].IndexBlockSize = 1 + rng.Intn(512)
+		opts.Levels[i].TargetFileSize = 1 + rng.Int63n(4096)
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	randKey := func() []byte {
+		return []byte(fmt.Sprintf("%04d", rng.Intn(500)))
+	}
+	var snaps []*Snapshot
+	defer func() {
+		for _, s := range snaps {
+			require.NoError(t, s.Close())
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if rng.Intn(5) == 0 {
+			snaps = append(snaps, d.NewSnapshot())
+		}
+		b := d.NewBatch()
+		for j := 0; j < 50; j++ {
+			switch rng.Intn(10) {
+			case 0:
+				require.NoError(t, b.Delete(randKey(), nil))
+			case 1:
+				require.NoError(t, b.SingleDelete(randKey(), nil))
+			case 2:
+				require.NoError(t, b.Set(randKey(), []byte("x"), nil))
+			default:
+				require.NoError(t, b.Set(randKey(), []byte(strconv.Itoa(rng.Intn(2000)-1000)), nil))
+			}
+		}
+		require.NoError(t, b.Commit(nil))
+		switch rng.Intn(3) {
+		case 0:
+			require.NoError(t, d.Flush())
+		case 1:
+			start, end := randKey(), randKey()
+			if d.cmp(start, end) > 0 {
+				start, end = end, start
+			}
+			require.NoError(t, d.Compact(start, append(end, 0x00), false))
+		}
+	}
+
+	var stats AggregateStats
+	check := func() {
+		for i := 0; i < 50; i++ {
+			lower, upper := randKey(), randKey()
+			if d.cmp(lower, upper) > 0 {
+				lower, upper = upper, lower
+			}
+			var expected aggregateSummary
+			iter := d.NewIter(&IterOptions{LowerBound: lower, UpperBound: upper})
+			for valid := iter.First(); valid; valid = iter.Next() {
+				expected.addKV(parseIntValue, iter.Key(), iter.Value())
+			}
+			require.NoError(t, iter.Close())
+
+			for _, name := range []string{"", "agg"} {
+				res, err := d.Aggregate(lower, upper, &Aggregator{Value: parseIntValue, PropertyName: name})
+				require.NoError(t, err)
+				require.Equal(t, expected.count, res.Count)
+				require.Equal(t, expected.keyBytes, res.KeyBytes)
+				require.Equal(t, expected.valueBytes, res.ValueBytes)
+				require.Equal(t, expected.valueCount, res.ValueCount)
+				require.Equal(t, expected.sum, res.Sum)
+				require.Equal(t, expected.min, res.Min)
+				require.Equal(t, expected.max, res.Max)
+				stats.TablesSummarized += res.Stats.TablesSummarized
+				stats.BlocksSummarized += res.Stats.BlocksSummarized
+
+				res, err = d.Aggregate(lower, upper, &Aggregator{PropertyName: name})
+				require.NoError(t, err)
+				require.Equal(t, expected.count, res.Count)
+				require.Equal(t, expected.keyBytes, res.KeyBytes)
+				require.Equal(t, expected.valueBytes, res.ValueBytes)
+				stats.TablesSummarized += res.Stats.TablesSummarized
+				stats.BlocksSummarized += res.Stats.BlocksSummarized
+			}
+		}
+	}
+	check()
+	// Compacting the entire keyspace leaves isolated tables, except for
+	// versions pinned by snapshots.
+	require.NoError(t, d.Compact([]byte("0000"), []byte("9999"), false))
+	check()
+	t.Logf("tables summarized: %d, blocks summarized: %d", stats.TablesSummarized, stats.BlocksSummarized)
+}
@@ -53,6 +53,9 @@ var ErrBatchTooLarge = errors.Newf("pebble: batch too large: >= %s", humanize.Ui
 // copying into an intermediary buffer then having pebble.Batch copy off of it.
 type DeferredBatchOp struct {
 	index *batchskl.Skiplist
+	// batch is set if the batch computes key-value checksums, which Finish
+	// computes for the operation.
+	batch *Batch
 
 	// Key and Value point to parts of the binary batch representation where
 	// keys and values should be encoded/copied into. len(Key) and len(Value)
@@ -68,6 +71,9 @@ type DeferredBatchOp struct {
 // copying/encoding keys will result in an incomplete index, and calling Finish
 // twice may result in a panic.
 func (d DeferredBatchOp) Finish() error {
+	if d.batch != nil {
+		d.batch.checksumRecords()
+	}
 	if d.index != nil {
 		if err := d.index.Add(d.offset); err != nil {
 			return err
@@ -233,6 +239,17 @@ type Batch struct {
 	// from the *Deferred() methods rather than a value.
 	deferredOp DeferredBatchOp
 
+	// computeKVChecksums is set if the batch computes the key-value checksums
+	// of its records (see Options.KVChecksums), which are verified when the
+	// batch is committed and stored in the memtable.
+	computeKVChecksums bool
+	// kvChecksums holds the key-value checksums of the records in
+	// data[batchHeaderLen:kvChecksummedLen], in order. A record is checksummed
+	// once it's complete, when the method adding it returns or its deferred
+	// operation is finished.
+	kvChecksums      []base.KVChecksum
+	kvChecksummedLen int
+
 	// An optional skiplist keyed by offset into data of the entry.
 	index         *batchskl.Skiplist
 	rangeDelIndex *batchskl.Skiplist
@@ -331,6 +348,13 @@ type BatchCommitStats struct {
 	// WALRotationDuration is the wait time for WAL rotation, which includes
 	// syncing and closing the old WAL and creating (or reusing) a new one.
 	WALRotationDuration time.Duration
+	// WALWriteDuration is the time spent writing the batch to the WAL,
+	// including the WALQueueWaitDuration, MemTableWriteStallDuration,
+	// L0ReadAmpWriteStallDuration and WALRotationDuration above.
+	WALWriteDuration time.Duration
+	// MemTableApplyDuration is the time spent applying the batch to the
+	// memtable.
+	MemTableApplyDuration time.Duration
 	// CommitWaitDuration is the wait for publishing the seqnum plus the
 	// duration for the WAL sync (if requested). The former should be tiny and
 	// one can assume that this is all due to the WAL sync.
@@ -360,6 +384,7 @@ var indexedBatchPool = sync.Pool{
 func newBatch(db *DB) *Batch {
 	b := batchPool.Get().(*Batch)
 	b.db = db
+	b.computeKVChecksums = db != nil && db.kvChecksums.Load()
 	return b
 }
 
@@ -369,6 +394,7 @@ func newIndexedBatch(db *DB, comparer *Comparer) *Batch {
 	i.batch.formatKey = comparer.FormatKey
 	i.batch.abbreviatedKey = comparer.AbbreviatedKey
 	i.batch.db = db
+	i.batch.computeKVChecksums = db != nil && db.kvChecksums.Load()
 	i.batch.index = &i.index
 	i.batch.index.Init(&i.batch.data, i.batch.cmp, i.batch.abbreviatedKey)
 	return &i.batch
@@ -400,6 +426,7 @@ func (b *Batch) release() {
 	// field. Without using an atomic to clear that field the Go race detector
 	// complains.
 	b.Reset()
+	b.computeKVChecksums = false
 	b.cmp = nil
 	b.formatKey = nil
 	b.abbreviatedKey = nil
@@ -463,12 +490,25 @@ func (b *Batch) Apply(batch *Batch, _ *WriteOptions) error {
 		return base.CorruptionErrorf("pebble: invalid batch")
 	}
 
+	if b.computeKVChecksums {
+		b.checksumRecords()
+	}
 	offset := len(b.data)
 	if offset == 0 {
 		b.init(offset)
 		offset = batchHeaderLen
 	}
 	b.data = append(b.data, batch.data[batchHeaderLen:]...)
+	if b.computeKVChecksums {
+		// Carry over the checksums of the applied batch's records, so that
+		// corruption of them since they were computed is detected.
+		if checksums := batch.allKVChecksums(); checksums != nil {
+			b.kvChecksums = append(b.kvChecksums, checksums...)
+			b.kvChecksummedLen = len(b.data)
+		} else {
+			b.checksumRecords()
+		}
+	}
 
 	b.setCount(b.Count() + batch.Count())
 
@@ -542,6 +582,9 @@ func (b *Batch) prepareDeferredKeyValueRecord(keyLen, valueLen int, kind Interna
 
 	pos := len(b.data)
 	b.deferredOp.offset = uint32(pos)
+	if b.computeKVChecksums {
+		b.deferredOp.batch = b
+	}
 	b.grow(1 + 2*maxVarintLen32 + keyLen + valueLen)
 	b.data[pos] = byte(kind)
 	pos++
@@ -591,6 +634,9 @@ func (b *Batch) prepareDeferredKeyRecord(keyLen int, kind InternalKeyKind) {
 
 	pos := len(b.data)
 	b.deferredOp.offset = uint32(pos)
+	if b.computeKVChecksums {
+		b.deferredOp.batch = b
+	}
 	b.grow(1 + maxVarintLen32 + keyLen)
 	b.data[pos] = byte(kind)
 	pos++
@@ -623,6 +669,9 @@ func (b *Batch) Set(key, value []byte, _ *WriteOptions) error {
 	deferredOp := b.SetDeferred(len(key), len(value))
 	copy(deferredOp.Key, key)
 	copy(deferredOp.Value, value)
+	if b.computeKVChecksums {
+		b.checksumRecords()
+	}
 	// TODO(peter): Manually inline DeferredBatchOp.Finish(). Mid-stack inlining
 	// in go1.13 will remove the need for this.
 	if b.index != nil {
@@ -652,6 +701,9 @@ func (b *Batch) Merge(key, value []byte, _ *WriteOptions) error {
 	deferredOp := b.MergeDeferred(len(key), len(value))
 	copy(deferredOp.Key, key)
 	copy(deferredOp.Value, value)
+	if b.computeKVChecksums {
+		b.checksumRecords()
+	}
 	// TODO(peter): Manually inline DeferredBatchOp.Finish(). Mid-stack inlining
 	// in go1.13 will remove the need for this.
 	if b.index != nil {
@@ -678,6 +730,9 @@ func (b *Batch) MergeDeferred(keyLen, valueLen int) *DeferredBatchOp {
 func (b *Batch) Delete(key []byte, _ *WriteOptions) error {
 	deferredOp := b.DeleteDeferred(len(key))
 	copy(deferredOp.Key, key)
+	if b.computeKVChecksums {
+		b.checksumRecords()
+	}
 	// TODO(peter): Manually inline DeferredBatchOp.Finish(). Mid-stack inlining
 	// in go1.13 will remove the need for this.
 	if b.index != nil {
@@ -714,6 +769,9 @@ func (b *Batch) DeleteDeferred(keyLen int) *DeferredBatchOp {
 func (b *Batch) DeleteSized(key []byte, deletedValueSize uint32, _ *WriteOptions) error {
 	deferredOp := b.DeleteSizedDeferred(len(key), deletedValueSize)
 	copy(b.deferredOp.Key, key)
+	if b.computeKVChecksums {
+		b.checksumRecords()
+	}
 	// TODO(peter): Manually inline DeferredBatchOp.Finish(). Check if in a
 	// later Go release this is unnecessary.
 	if b.index != nil {
@@ -771,6 +829,9 @@ func (b *Batch) DeleteSizedDeferred(keyLen int, deletedValueSize uint32) *Deferr
 func (b *Batch) SingleDelete(key []byte, _ *WriteOptions) error {
 	deferredOp := b.SingleDeleteDeferred(len(key))
 	copy(deferredOp.Key, key)
+	if b.computeKVChecksums {
+		b.checksumRecords()
+	}
 	// TODO(peter): Manually inline DeferredBatchOp.Finish(). Mid-stack inlining
 	// in go1.13 will remove the need for this.
 	if b.index != nil {
@@ -801,6 +862,9 @@ func (b *Batch) DeleteRange(start, end []byte, _ *WriteOptions) error {
 	deferredOp := b.DeleteRangeDeferred(len(start), len(end))
 	copy(deferredOp.Key, start)
 	copy(deferredOp.Value, end)
+	if b.computeKVChecksums {
+		b.checksumRecords()
+	}
 	// TODO(peter): Manually inline DeferredBatchOp.Finish(). Mid-stack inlining
 	// in go1.13 will remove the need for this.
 	if deferredOp.index != nil {
@@ -849,6 +913,9 @@ func (b *Batch) RangeKeySet(start, end, suffix, value []byte, _ *WriteOptions) e
 		panic("unexpected internal value length mismatch")
 	}
 
+	if b.computeKVChecksums {
+		b.checksumRecords()
+	}
 	// Manually inline DeferredBatchOp.Finish().
 	if deferredOp.index != nil {
 		if err := deferredOp.index.Add(deferredOp.offset); err != nil {
@@ -899,6 +966,9 @@ func (b *Batch) RangeKeyUnset(start, end, suffix []byte, _ *WriteOptions) error
 		panic("unexpected internal value length mismatch")
 	}
 
+	if b.computeKVChecksums {
+		b.checksumRecords()
+	}
 	// Manually inline DeferredBatchOp.Finish()
 	if deferredOp.index != nil {
 		if err := deferredOp.index.Add(deferredOp.offset); err != nil {
@@ -925,6 +995,9 @@ func (b *Batch) RangeKeyDelete(start, end []byte, _ *WriteOptions) error {
 	deferredOp := b.RangeKeyDeleteDeferred(len(start), len(end))
 	copy(deferredOp.Key, start)
 	copy(deferredOp.Value, end)
+	if b.computeKVChecksums {
+		b.checksumRecords()
+	}
 	// Manually inline DeferredBatchOp.Finish().
 	if deferredOp.index != nil {
 		if err := deferredOp.index.Add(deferredOp.offset); err != nil {
@@ -955,6 +1028,9 @@ func (b *Batch) LogData(data []byte, _ *WriteOptions) error {
 	origCount, origMemTableSize := b.count, b.memTableSize
 	b.prepareDeferredKeyRecord(len(data), InternalKeyKindLogData)
 	copy(b.deferredOp.Key, data)
+	if b.computeKVChecksums {
+		b.checksumRecords()
+	}
 	// Since LogData only writes to the WAL and does not affect the memtable, we
 	// restore b.count and b.memTableSize to their origin values. Note that
 	// Batch.count only refers to records that are added to the memtable.
@@ -977,6 +1053,9 @@ func (b *Batch) ingestSST(fileNum base.FileNum) {
 	length := binary.PutUvarint(buf[:], uint64(fileNum))
 	b.prepareDeferredKeyRecord(length, InternalKeyKindIngestSST)
 	copy(b.deferredOp.Key, buf[:length])
+	if b.computeKVChecksums {
+		b.checksumRecords()
+	}
 	// Since IngestSST writes only to the WAL and does not affect the memtable,
 	// we restore b.memTableSize to its original value. Note that Batch.count
 	// is not reset because for the InternalKeyKindIngestSST the count is the
@@ -1022,9 +1101,63 @@ func (b *Batch) SetRepr(data []byte) error {
 		// Only track memTableSize for batches that will be committed to the DB.
 		b.refreshMemTableSize()
 	}
+	b.kvChecksums = b.kvChecksums[:0]
+	b.kvChecksummedLen = 0
+	if b.computeKVChecksums {
+		b.checksumRecords()
+	}
 	return nil
 }
 
+// checksumRecords computes the key-value checksums of the records added since
+// it was last called, which must be complete.
+func (b *Batch) checksumRecords() {
+	if b.kvChecksummedLen < batchHeaderLen {
+		b.kvChecksummedLen = batchHeaderLen
+	}
+	if len(b.data) <= b.kvChecksummedLen {
+		return
+	}
+	for r := BatchReader(b.data[b.kvChecksummedLen:]); ; {
+		kind, key, value, ok := r.Next()
+		if !ok {
+			break
+		}
+		b.kvChecksums = append(b.kvChecksums, base.MakeKVChecksum(kind, key, value))
+	}
+	b.kvChecksummedLen = len(b.data)
+}
+
+// allKVChecksums returns the key-value checksums of all of the batch's
+// records, in order, or nil if the batch doesn't have checksums of them all.
+func (b *Batch) allKVChecksums() []base.KVChecksum {
+	if !b.computeKVChecksums || b.kvChecksummedLen != len(b.data) {
+		return nil
+	}
+	return b.kvChecksums
+}
+
+// verifyKVChecksums verifies that the batch's records match their key-value
+// checksums, if the batch computes them. The checksums of records whose
+// deferred operations weren't finished are computed first.
+func (b *Batch) verifyKVChecksums() error {
+	if !b.computeKVChecksums {
+		return nil
+	}
+	b.checksumRecords()
+	r := b.Reader()
+	for i := 0; ; i++ {
+		kind, key, value, ok := r.Next()
+		if !ok {
+			return nil
+		}
+		if i >= len(b.kvChecksums) || base.MakeKVChecksum(kind, key, value) != b.kvChecksums[i] {
+			return base.KVChecksumMismatchError(
+				base.MakeInternalKey(key, 0, kind), fmt.Sprintf("batch record %d", i))
+		}
+	}
+}
+
 // NewIter returns an iterator that is unpositioned (Iterator.Valid() will
 // return false). The iterator can be positioned via a call to SeekGE,
 // SeekPrefixGE, SeekLT, First or Last. Only indexed batches support iterators.
@@ -1277,6 +1410,8 @@ func (b *Batch) Reset() {
 	b.countRangeKeys = 0
 	b.memTableSize = 0
 	b.deferredOp = DeferredBatchOp{}
+	b.kvChecksums = b.kvChecksums[:0]
+	b.kvChecksummedLen = 0
 	b.tombstones = nil
 	b.tombstonesSeqNum = 0
 	b.rangeKeys = nil
@@ -1414,6 +1549,9 @@ func (b *Batch) SyncWait() error {
 	waitDuration := time.Since(now)
 	b.commitStats.CommitWaitDuration += waitDuration
 	b.commitStats.TotalDuration += waitDuration
+	if b.db != nil {
+		b.db.recordCommitLatency(b, true /* sync */)
+	}
 	return b.commitErr
 }
 
@@ -1521,6 +1659,12 @@ func (i *batchIter) SeekLT(key []byte, flags base.SeekLTFlags) (*InternalKey, ba
 	return ikey, base.MakeInPlaceValue(i.value())
 }
 
+func (i *batchIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	return i.SeekLT(key, flags)
+}
+
 func (i *batchIter) First() (*InternalKey, base.LazyValue) {
 	i.err = nil // clear cached iteration error
 	ikey := i.iter.First()
@@ -1655,6 +1799,11 @@ type flushableBatch struct {
 
 	// Fragmented range keys.
 	rangeKeys []keyspan.Span
+
+	// kvChecksums holds the key-value checksums of the batch's records, in
+	// the order of the records, if the batch computed them. They're indexed
+	// by flushableBatchEntry.index.
+	kvChecksums []base.KVChecksum
 }
 
 var _ flushable = (*flushableBatch)(nil)
@@ -1670,6 +1819,10 @@ func newFlushableBatch(batch *Batch, comparer *Comparer) *flushableBatch {
 		formatKey: comparer.FormatKey,
 		offsets:   make([]flushableBatchEntry, 0, batch.Count()),
 	}
+	if checksums := batch.allKVChecksums(); checksums != nil {
+		// The batch's checksums are reused when it's reset.
+		b.kvChecksums = append([]base.KVChecksum(nil), checksums...)
+	}
 	if b.data != nil {
 		// Note that this sequence number is not correct when this batch has not
 		// been applied since the sequence number has not been assigned yet. The
@@ -1826,6 +1979,8 @@ func (b *flushableBatch) newFlushIter(o *IterOptions, bytesFlushed *uint64) inte
 			offsets: b.offsets,
 			cmp:     b.cmp,
 			index:   -1,
+			lower:   o.GetLowerBound(),
+			upper:   o.GetUpperBound(),
 		},
 		bytesIterated: bytesFlushed,
 	}
@@ -1882,8 +2037,10 @@ type flushableBatchIter struct {
 	upper []byte
 }
 
-// flushableBatchIter implements the base.InternalIterator interface.
+// flushableBatchIter implements the base.InternalIterator and
+// base.KVChecksumIterator interfaces.
 var _ base.InternalIterator = (*flushableBatchIter)(nil)
+var _ base.KVChecksumIterator = (*flushableBatchIter)(nil)
 
 func (i *flushableBatchIter) String() string {
 	return "flushable-batch"
@@ -1941,6 +2098,14 @@ func (i *flushableBatchIter) SeekLT(
 	return &i.key, i.value()
 }
 
+// SeekPrefixLT implements internalIterator.SeekPrefixLT, as documented in the
+// pebble package.
+func (i *flushableBatchIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	return i.SeekLT(key, flags)
+}
+
 // First implements internalIterator.First, as documented in the pebble
 // package.
 func (i *flushableBatchIter) First() (*InternalKey, base.LazyValue) {
@@ -2055,6 +2220,15 @@ func (i *flushableBatchIter) Error() error {
 	return i.err
 }
 
+// KVChecksum implements base.KVChecksumIterator. The checksum is known if the
+// batch computed the checksums of its records.
+func (i *flushableBatchIter) KVChecksum() (base.KVChecksum, bool) {
+	if i.batch.kvChecksums == nil || i.index < 0 || i.index >= len(i.offsets) {
+		return 0, false
+	}
+	return i.batch.kvChecksums[i.offsets[i.index].index], true
+}
+
 func (i *flushableBatchIter) Close() error {
 	return i.err
 }
@@ -2096,9 +2270,21 @@ func (i *flushFlushableBatchIter) SeekLT(
 	panic("pebble: SeekLT unimplemented")
 }
 
+func (i *flushFlushableBatchIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	panic("pebble: SeekPrefixLT unimplemented")
+}
+
 func (i *flushFlushableBatchIter) First() (*InternalKey, base.LazyValue) {
 	i.err = nil // clear cached iteration error
-	key, val := i.flushableBatchIter.First()
+	var key *InternalKey
+	var val base.LazyValue
+	if i.lower != nil {
+		key, val = i.flushableBatchIter.SeekGE(i.lower, base.SeekGEFlagsNone)
+	} else {
+		key, val = i.flushableBatchIter.First()
+	}
 	if key == nil {
 		return nil, base.LazyValue{}
 	}
@@ -2122,6 +2308,10 @@ func (i *flushFlushableBatchIter) Next() (*InternalKey, base.LazyValue) {
 		return nil, base.LazyValue{}
 	}
 	i.key = i.getKey(i.index)
+	if i.upper != nil && i.cmp(i.key.UserKey, i.upper) >= 0 {
+		i.index = len(i.offsets)
+		return nil, base.LazyValue{}
+	}
 	entryBytes := i.offsets[i.index].keyEnd - i.offsets[i.index].offset
 	*i.bytesIterated += uint64(entryBytes) + i.valueSize()
 	return &i.key, i.value()
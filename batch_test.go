@@ -1553,3 +1553,45 @@ func TestBatchSpanCaching(t *testing.T) {
 		}
 	}
 }
+
+func TestBatchKVChecksums(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: ExperimentalFormatKVChecksums,
+		KVChecksums:        true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Well-formed batches are committed, including those with deferred
+	// operations that were never finished and those whose records were
+	// copied from other batches.
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, b.Merge([]byte("b"), []byte("2"), nil))
+	op := b.SetDeferred(1, 1)
+	copy(op.Key, "c")
+	copy(op.Value, "3")
+	require.NoError(t, b.DeleteRange([]byte("d"), []byte("e"), nil))
+	b2 := d.NewIndexedBatch()
+	require.NoError(t, b2.Apply(b, nil))
+	require.NoError(t, b2.Delete([]byte("a"), nil))
+	b3 := d.NewBatch()
+	require.NoError(t, b3.SetRepr(append([]byte(nil), b2.Repr()...)))
+	for _, b := range []*Batch{b, b2, b3} {
+		require.NoError(t, d.Apply(b, nil))
+	}
+	v, closer, err := d.Get([]byte("c"))
+	require.NoError(t, err)
+	require.Equal(t, "3", string(v))
+	require.NoError(t, closer.Close())
+
+	// Corruption of a record after it was written is detected on commit.
+	b = d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, b.Set([]byte("b"), []byte("2"), nil))
+	b.data[len(b.data)-1] ^= 1
+	err = d.Apply(b, nil)
+	require.True(t, errors.Is(err, base.ErrCorruption))
+	require.Contains(t, err.Error(), "batch record 1")
+}
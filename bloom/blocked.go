@@ -0,0 +1,161 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package bloom
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// Blocked Bloom filters
+//
+// A BlockedFilterPolicy filter is a split block Bloom filter. The filter is a
+// sequence of 32-byte blocks, each of eight 32-bit words. A key's 64-bit hash
+// selects a single block, and sets one bit in each of the block's words, so a
+// lookup touches a single block within a single cache line, and is free of
+// data-dependent branches and loops. Its false positive rate is slightly
+// higher than a standard Bloom filter with the same number of bits per key.
+//
+// The filter format is:
+//
+//	block 0 ... block n-1 | n (4 bytes, little-endian) | blockedFilterVersion
+
+const (
+	blockedFilterBlockWords = 8
+	blockedFilterBlockSize  = 4 * blockedFilterBlockWords
+	blockedFilterTrailerLen = 5
+	blockedFilterVersion    = 1
+)
+
+// blockedFilterSalts are the odd multipliers that select the bit set in each
+// of a block's words.
+var blockedFilterSalts = [blockedFilterBlockWords]uint32{
+	0x47b6137b, 0x44974d91, 0x8824ad5b, 0xa2b7289d,
+	0x705495c7, 0x2df1424b, 0x9efc4947, 0x5c6bfb31,
+}
+
+type blockedFilter []byte
+
+func (f blockedFilter) MayContain(key []byte) bool {
+	if len(f) <= blockedFilterTrailerLen || f[len(f)-1] != blockedFilterVersion {
+		return false
+	}
+	n := len(f) - blockedFilterTrailerLen
+	numBlocks := binary.LittleEndian.Uint32(f[n:])
+	if numBlocks == 0 || int(numBlocks)*blockedFilterBlockSize != n {
+		return false
+	}
+	h := xxhash.Sum64(key)
+	block := f[blockedFilterBlockOffset(h, numBlocks):]
+	for i, salt := range blockedFilterSalts {
+		mask := uint32(1) << ((uint32(h) * salt) >> 27)
+		if binary.LittleEndian.Uint32(block[4*i:])&mask == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// blockedFilterBlockOffset returns the offset of the block the hash h maps
+// to, in a filter of numBlocks blocks.
+func blockedFilterBlockOffset(h uint64, numBlocks uint32) int {
+	return int(((h >> 32) * uint64(numBlocks)) >> 32 * blockedFilterBlockSize)
+}
+
+type blockedFilterWriter struct {
+	bitsPerKey int
+	hashes     []uint64
+}
+
+// AddKey implements the base.FilterWriter interface.
+func (w *blockedFilterWriter) AddKey(key []byte) {
+	h := xxhash.Sum64(key)
+	if n := len(w.hashes); n > 0 && w.hashes[n-1] == h {
+		return
+	}
+	w.hashes = append(w.hashes, h)
+}
+
+// Finish implements the base.FilterWriter interface.
+func (w *blockedFilterWriter) Finish(buf []byte) []byte {
+	numBlocks := (len(w.hashes)*w.bitsPerKey + 8*blockedFilterBlockSize - 1) / (8 * blockedFilterBlockSize)
+	if numBlocks == 0 {
+		numBlocks = 1
+	}
+	n := numBlocks * blockedFilterBlockSize
+	buf, filter := extend(buf, n+blockedFilterTrailerLen)
+	for _, h := range w.hashes {
+		block := filter[blockedFilterBlockOffset(h, uint32(numBlocks)):]
+		for i, salt := range blockedFilterSalts {
+			mask := uint32(1) << ((uint32(h) * salt) >> 27)
+			binary.LittleEndian.PutUint32(block[4*i:], binary.LittleEndian.Uint32(block[4*i:])|mask)
+		}
+	}
+	binary.LittleEndian.PutUint32(filter[n:], uint32(numBlocks))
+	filter[n+4] = blockedFilterVersion
+	w.hashes = w.hashes[:0]
+	return buf
+}
+
+// BlockedFilterPolicy implements the FilterPolicy interface from the pebble
+// package with cache-local, split block Bloom filters.
+//
+// The integer value is the approximate number of bits used per key. A value of
+// 10 yields a filter with a ~1.5% false positive rate, and a value of 16 a ~0.2%
+// false positive rate. Lookups in blocked Bloom filters are faster than in
+// FilterPolicy's filters.
+type BlockedFilterPolicy int
+
+var _ base.TunableFilterPolicy = BlockedFilterPolicy(0)
+
+// Name implements the pebble.FilterPolicy interface.
+func (p BlockedFilterPolicy) Name() string {
+	return "pebble.BlockedBloomFilter"
+}
+
+// MayContain implements the pebble.FilterPolicy interface.
+func (p BlockedFilterPolicy) MayContain(ftype base.FilterType, f, key []byte) bool {
+	switch ftype {
+	case base.TableFilter:
+		return blockedFilter(f).MayContain(key)
+	default:
+		panic(fmt.Sprintf("unknown filter type: %v", ftype))
+	}
+}
+
+// NewWriter implements the pebble.FilterPolicy interface.
+func (p BlockedFilterPolicy) NewWriter(ftype base.FilterType) base.FilterWriter {
+	switch ftype {
+	case base.TableFilter:
+		bitsPerKey := int(p)
+		if bitsPerKey < 1 {
+			bitsPerKey = 1
+		}
+		return &blockedFilterWriter{bitsPerKey: bitsPerKey}
+	default:
+		panic(fmt.Sprintf("unknown filter type: %v", ftype))
+	}
+}
+
+// WithFalsePositiveRate implements the pebble.TunableFilterPolicy interface.
+func (p BlockedFilterPolicy) WithFalsePositiveRate(rate float64) base.FilterPolicy {
+	// Split block Bloom filters require ~25% more bits per key than standard
+	// Bloom filters for the same false positive rate.
+	return BlockedFilterPolicy(math.Ceil(1.25 * bitsPerKeyForFalsePositiveRate(rate)))
+}
+
+// bitsPerKeyForFalsePositiveRate returns the number of bits per key a standard
+// Bloom filter requires for the provided false positive rate.
+func bitsPerKeyForFalsePositiveRate(rate float64) float64 {
+	if rate <= 0 || rate >= 1 {
+		return 10
+	}
+	bits := -math.Log(rate) / (math.Ln2 * math.Ln2)
+	return math.Min(math.Max(bits, 1), 64)
+}
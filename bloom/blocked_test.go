@@ -0,0 +1,87 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package bloom
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockedFilter(t *testing.T) {
+	key := func(i int) []byte {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], uint32(i))
+		return b[:]
+	}
+	for _, bitsPerKey := range []int{10, 16} {
+		for _, n := range []int{0, 1, 10, 100, 1000, 10000} {
+			t.Run(fmt.Sprintf("bits=%d/n=%d", bitsPerKey, n), func(t *testing.T) {
+				p := BlockedFilterPolicy(bitsPerKey)
+				w := p.NewWriter(base.TableFilter)
+				for i := 0; i < n; i++ {
+					w.AddKey(key(i))
+				}
+				f := w.Finish(nil)
+				numBlocks := (n*bitsPerKey + 255) / 256
+				if numBlocks == 0 {
+					numBlocks = 1
+				}
+				require.Equal(t, numBlocks*blockedFilterBlockSize+blockedFilterTrailerLen, len(f))
+
+				// All added keys must match.
+				for i := 0; i < n; i++ {
+					require.True(t, p.MayContain(base.TableFilter, f, key(i)), "key %d", i)
+				}
+				if n < 1000 {
+					return
+				}
+				// Check the false positive rate.
+				const probes = 100000
+				nFalsePositive := 0
+				for i := 0; i < probes; i++ {
+					if p.MayContain(base.TableFilter, f, key(1e9+i)) {
+						nFalsePositive++
+					}
+				}
+				maxRate := map[int]float64{10: 0.025, 16: 0.004}[bitsPerKey]
+				require.Less(t, float64(nFalsePositive)/probes, maxRate)
+			})
+		}
+	}
+
+	// Malformed filters never match.
+	p := BlockedFilterPolicy(10)
+	require.False(t, p.MayContain(base.TableFilter, nil, key(0)))
+	require.False(t, p.MayContain(base.TableFilter, make([]byte, 37), key(0)))
+}
+
+func TestWithFalsePositiveRate(t *testing.T) {
+	require.Equal(t, FilterPolicy(11), FilterPolicy(10).WithFalsePositiveRate(0.01))
+	require.Equal(t, BlockedFilterPolicy(12), BlockedFilterPolicy(10).WithFalsePositiveRate(0.01))
+	require.Equal(t, FilterPolicy(11), FilterPolicy(5).WithFalsePositiveRate(0))
+}
+
+func BenchmarkBlockedFilter(b *testing.B) {
+	const keyLen = 128
+	const numKeys = 1024
+	keys := make([][]byte, numKeys)
+	for i := range keys {
+		keys[i] = make([]byte, keyLen)
+		binary.LittleEndian.PutUint32(keys[i], uint32(i))
+	}
+	b.ResetTimer()
+	policy := BlockedFilterPolicy(10)
+	w := policy.NewWriter(base.TableFilter)
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			w.AddKey(key)
+		}
+		w.Finish(nil)
+	}
+}
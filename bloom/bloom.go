@@ -8,6 +8,7 @@ package bloom // import "github.com/cockroachdb/pebble/bloom"
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
 	"sync"
 
 	"github.com/cockroachdb/pebble/internal/base"
@@ -219,7 +220,7 @@ func (w *tableFilterWriter) Finish(buf []byte) []byte {
 // value is 10, which yields a filter with ~ 1% false positive rate.
 type FilterPolicy int
 
-var _ base.FilterPolicy = FilterPolicy(0)
+var _ base.TunableFilterPolicy = FilterPolicy(0)
 
 // Name implements the pebble.FilterPolicy interface.
 func (p FilterPolicy) Name() string {
@@ -248,3 +249,10 @@ func (p FilterPolicy) NewWriter(ftype base.FilterType) base.FilterWriter {
 		panic(fmt.Sprintf("unknown filter type: %v", ftype))
 	}
 }
+
+// WithFalsePositiveRate implements the pebble.TunableFilterPolicy interface.
+func (p FilterPolicy) WithFalsePositiveRate(rate float64) base.FilterPolicy {
+	// The filter's bits are confined to cache lines, which requires slightly
+	// more bits per key than a standard Bloom filter.
+	return FilterPolicy(math.Ceil(1.1 * bitsPerKeyForFalsePositiveRate(rate)))
+}
@@ -21,3 +21,32 @@ type Cache = cache.Cache
 func NewCache(size int64) *cache.Cache {
 	return cache.New(size)
 }
+
+// CacheOptions exports the cache.Options type.
+type CacheOptions = cache.Options
+
+// NewCacheWithOptions creates a new cache with the specified options. See
+// NewCache.
+func NewCacheWithOptions(opts CacheOptions) *cache.Cache {
+	return cache.NewWithOptions(opts)
+}
+
+// SecondaryCache exports the cache.SecondaryCache type.
+type SecondaryCache = cache.SecondaryCache
+
+// SecondaryCacheOptions exports the cache.SecondaryCacheOptions type.
+type SecondaryCacheOptions = cache.SecondaryCacheOptions
+
+// SecondaryCacheMetrics exports the cache.SecondaryMetrics type.
+type SecondaryCacheMetrics = cache.SecondaryMetrics
+
+// OpenSecondaryCache opens a persistent secondary block cache in the
+// specified directory, creating it if it doesn't exist. The caller should
+// close it after closing the DBs it's used by.
+//
+//	sc, err := pebble.OpenSecondaryCache(pebble.SecondaryCacheOptions{...})
+//	defer sc.Close()
+//	d, err := pebble.Open(dirname, &pebble.Options{SecondaryCache: sc})
+func OpenSecondaryCache(opts SecondaryCacheOptions) (*SecondaryCache, error) {
+	return cache.OpenSecondaryCache(opts)
+}
@@ -0,0 +1,339 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/crc"
+	"github.com/cockroachdb/pebble/internal/rate"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+const (
+	// cacheWarmingFilename is the name of the file in the DB directory the
+	// keys of the DB's resident blocks are dumped to.
+	cacheWarmingFilename = "CACHE-WARMING"
+	cacheWarmingMagic    = "PBLWARM2"
+)
+
+// cacheWarmingBlock identifies a block to prefetch by its cache key. The
+// block's length and kind are found in its table's layout when it's
+// prefetched.
+type cacheWarmingBlock struct {
+	fileNum base.DiskFileNum
+	offset  uint64
+}
+
+type cacheWarming struct {
+	// cancel stops the goroutines, and cancelPrefetch stops the prefetching
+	// goroutine only.
+	cancel         context.CancelFunc
+	cancelPrefetch context.CancelFunc
+	wg             sync.WaitGroup
+	// dumpMu serializes dumps.
+	dumpMu sync.Mutex
+
+	blocksTotal   atomic.Int64
+	blocksWarmed  atomic.Int64
+	bytesWarmed   atomic.Int64
+	blocksSkipped atomic.Int64
+	inProgress    atomic.Bool
+	dumps         atomic.Int64
+}
+
+func (w *cacheWarming) metrics(m *Metrics) {
+	m.CacheWarming.BlocksTotal = w.blocksTotal.Load()
+	m.CacheWarming.BlocksWarmed = w.blocksWarmed.Load()
+	m.CacheWarming.BytesWarmed = w.bytesWarmed.Load()
+	m.CacheWarming.BlocksSkipped = w.blocksSkipped.Load()
+	m.CacheWarming.InProgress = w.inProgress.Load()
+	m.CacheWarming.Dumps = w.dumps.Load()
+}
+
+// encodeCacheWarming encodes the blocks as:
+//
+//	magic    [8]byte
+//	count    uvarint
+//	blocks   [count]{fileNum uvarint, offset uvarint}
+//	checksum uint32 (of the preceding bytes)
+func encodeCacheWarming(blocks []cacheWarmingBlock) []byte {
+	buf := make([]byte, 0, len(cacheWarmingMagic)+binary.MaxVarintLen64+len(blocks)*12+4)
+	buf = append(buf, cacheWarmingMagic...)
+	buf = binary.AppendUvarint(buf, uint64(len(blocks)))
+	for _, b := range blocks {
+		buf = binary.AppendUvarint(buf, uint64(b.fileNum.FileNum()))
+		buf = binary.AppendUvarint(buf, b.offset)
+	}
+	return binary.LittleEndian.AppendUint32(buf, crc.New(buf).Value())
+}
+
+func decodeCacheWarming(buf []byte) ([]cacheWarmingBlock, error) {
+	if len(buf) < len(cacheWarmingMagic)+4 || string(buf[:len(cacheWarmingMagic)]) != cacheWarmingMagic {
+		return nil, base.CorruptionErrorf("pebble: invalid cache warming file")
+	}
+	n := len(buf) - 4
+	if crc.New(buf[:n]).Value() != binary.LittleEndian.Uint32(buf[n:]) {
+		return nil, base.CorruptionErrorf("pebble: cache warming file checksum mismatch")
+	}
+	buf = buf[len(cacheWarmingMagic):n]
+	truncated := false
+	uvarint := func() uint64 {
+		v, n := binary.Uvarint(buf)
+		if n <= 0 {
+			truncated = true
+			buf = nil
+			return 0
+		}
+		buf = buf[n:]
+		return v
+	}
+	count := uvarint()
+	var blocks []cacheWarmingBlock
+	for i := uint64(0); i < count; i++ {
+		var b cacheWarmingBlock
+		b.fileNum = base.FileNum(uvarint()).DiskFileNum()
+		b.offset = uvarint()
+		if truncated {
+			return nil, base.CorruptionErrorf("pebble: truncated cache warming file")
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// backingFiles returns a table of each file backing the tables of the
+// version, keyed by the backing file's number.
+func backingFiles(v *version) map[base.DiskFileNum]*fileMetadata {
+	m := make(map[base.DiskFileNum]*fileMetadata)
+	for _, files := range v.Levels {
+		iter := files.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			m[f.FileBacking.DiskFileNum] = f
+		}
+	}
+	return m
+}
+
+// dumpCacheWarming writes the keys of the DB's resident blocks to the cache
+// warming file. Only the keys are written, so that dumping doesn't read the
+// tables; the blocks' lengths and kinds are found when they're prefetched.
+func (d *DB) dumpCacheWarming() error {
+	d.cacheWarming.dumpMu.Lock()
+	defer d.cacheWarming.dumpMu.Unlock()
+
+	keys := d.opts.Cache.ResidentBlocks(d.cacheID, d.opts.CacheWarming.MaxBlocks)
+	// Group the keys by file, in the order of each file's first block, so that
+	// the hottest files are prefetched first.
+	var fileNums []base.DiskFileNum
+	offsets := make(map[base.DiskFileNum][]uint64)
+	for _, k := range keys {
+		if _, ok := offsets[k.FileNum]; !ok {
+			fileNums = append(fileNums, k.FileNum)
+		}
+		offsets[k.FileNum] = append(offsets[k.FileNum], k.Offset)
+	}
+
+	rs := d.loadReadState()
+	defer rs.unref()
+	files := backingFiles(rs.current)
+	var blocks []cacheWarmingBlock
+	for _, fileNum := range fileNums {
+		if _, ok := files[fileNum]; !ok {
+			continue
+		}
+		for _, offset := range offsets[fileNum] {
+			blocks = append(blocks, cacheWarmingBlock{fileNum: fileNum, offset: offset})
+		}
+	}
+
+	fs := d.opts.FS
+	path := fs.PathJoin(d.dirname, cacheWarmingFilename)
+	tmpPath := path + ".tmp"
+	f, err := fs.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(encodeCacheWarming(blocks)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := fs.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	if err := d.dataDir.Sync(); err != nil {
+		return err
+	}
+	d.cacheWarming.dumps.Add(1)
+	return nil
+}
+
+// loadCacheWarming reads the cache warming file, if it exists.
+func (d *DB) loadCacheWarming() ([]cacheWarmingBlock, error) {
+	f, err := d.opts.FS.Open(d.opts.FS.PathJoin(d.dirname, cacheWarmingFilename))
+	if oserror.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return decodeCacheWarming(buf)
+}
+
+// startCacheWarming starts prefetching the blocks of the cache warming file,
+// and the goroutine that periodically dumps the resident blocks, if
+// configured.
+func (d *DB) startCacheWarming() {
+	w := &d.cacheWarming
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+
+	blocks, err := d.loadCacheWarming()
+	if err != nil {
+		d.opts.Logger.Infof("pebble: cache warming: %v", err)
+	}
+	if len(blocks) > 0 {
+		var prefetchCtx context.Context
+		prefetchCtx, w.cancelPrefetch = context.WithCancel(ctx)
+		w.blocksTotal.Store(int64(len(blocks)))
+		w.inProgress.Store(true)
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			defer w.inProgress.Store(false)
+			d.warmCache(prefetchCtx, blocks)
+		}()
+	}
+
+	if interval := d.opts.CacheWarming.DumpInterval; interval > 0 && !d.opts.ReadOnly {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := d.dumpCacheWarming(); err != nil {
+						d.opts.Logger.Infof("pebble: failed to dump cache warming blocks: %v", err)
+					}
+				}
+			}
+		}()
+	}
+}
+
+// warmCache reads the blocks into the cache, paced by
+// Options.CacheWarming.BytesPerSecond, until it's done or the context is
+// canceled. The blocks of each file are expected to be contiguous.
+func (d *DB) warmCache(ctx context.Context, blocks []cacheWarmingBlock) {
+	w := &d.cacheWarming
+	burst := d.opts.CacheWarming.BytesPerSecond
+	limiter := rate.NewLimiter(rate.Limit(burst), burst)
+
+	var current *version
+	var files map[base.DiskFileNum]*fileMetadata
+	for len(blocks) > 0 {
+		n := 1
+		for n < len(blocks) && blocks[n].fileNum == blocks[0].fileNum {
+			n++
+		}
+		fileBlocks := blocks[:n]
+		blocks = blocks[n:]
+		if ctx.Err() != nil {
+			w.blocksSkipped.Add(int64(len(fileBlocks)))
+			continue
+		}
+
+		// A read state is held while the file's blocks are read, so that the
+		// file isn't deleted in the meantime.
+		rs := d.loadReadState()
+		if rs.current != current {
+			current = rs.current
+			files = backingFiles(current)
+		}
+		meta, ok := files[fileBlocks[0].fileNum]
+		if !ok {
+			rs.unref()
+			w.blocksSkipped.Add(int64(len(fileBlocks)))
+			continue
+		}
+		var warmed int
+		err := d.tableCache.withBackingReader(meta, func(r *sstable.Reader) error {
+			// The lengths and kinds of the blocks are found in the table's
+			// layout. Offsets that aren't the start of a block are skipped.
+			layout, err := r.Layout()
+			if err != nil {
+				return err
+			}
+			handles := make(map[uint64]sstable.KindedBlockHandle)
+			for _, bh := range layout.Blocks() {
+				handles[bh.Offset] = bh
+			}
+			for _, b := range fileBlocks {
+				bh, ok := handles[b.offset]
+				if !ok {
+					continue
+				}
+				n := int(bh.Length)
+				if n > burst {
+					n = burst
+				}
+				if err := limiter.WaitN(ctx, n); err != nil {
+					return err
+				}
+				if err := r.WarmBlock(ctx, bh); err != nil {
+					return err
+				}
+				warmed++
+				w.blocksWarmed.Add(1)
+				w.bytesWarmed.Add(int64(bh.Length))
+			}
+			return nil
+		})
+		rs.unref()
+		w.blocksSkipped.Add(int64(len(fileBlocks) - warmed))
+		if err != nil && ctx.Err() == nil {
+			d.opts.Logger.Infof("pebble: cache warming: reading %s: %v", meta.FileBacking.DiskFileNum, err)
+		}
+	}
+}
+
+// CancelCacheWarming stops prefetching the blocks dumped when the DB was last
+// closed. See Options.CacheWarming.
+func (d *DB) CancelCacheWarming() {
+	if d.cacheWarming.cancelPrefetch != nil {
+		d.cacheWarming.cancelPrefetch()
+	}
+}
+
+// stopCacheWarming stops the cache warming goroutines and waits for them to
+// exit.
+func (d *DB) stopCacheWarming() {
+	if d.cacheWarming.cancel != nil {
+		d.cacheWarming.cancel()
+	}
+	d.cacheWarming.wg.Wait()
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheWarmingEncoding(t *testing.T) {
+	blocks := []cacheWarmingBlock{
+		{base.FileNum(5).DiskFileNum(), 0},
+		{base.FileNum(5).DiskFileNum(), 8192},
+		{base.FileNum(1 << 40).DiskFileNum(), 1 << 33},
+	}
+	buf := encodeCacheWarming(blocks)
+	decoded, err := decodeCacheWarming(buf)
+	require.NoError(t, err)
+	require.Equal(t, blocks, decoded)
+
+	decoded, err = decodeCacheWarming(encodeCacheWarming(nil))
+	require.NoError(t, err)
+	require.Empty(t, decoded)
+
+	// Corruption of any byte is detected.
+	for i := range buf {
+		corrupt := append([]byte(nil), buf...)
+		corrupt[i] ^= 0x10
+		_, err := decodeCacheWarming(corrupt)
+		require.Error(t, err, "byte %d", i)
+	}
+	_, err = decodeCacheWarming(buf[:len(buf)-1])
+	require.Error(t, err)
+}
+
+func TestCacheWarming(t *testing.T) {
+	fs := vfs.NewMem()
+	openDB := func(enabled bool, bytesPerSecond int) *DB {
+		c := cache.New(1 << 20)
+		defer c.Unref()
+		opts := &Options{Cache: c, FS: fs}
+		opts.CacheWarming.Enabled = enabled
+		opts.CacheWarming.BytesPerSecond = bytesPerSecond
+		opts.private.disableTableStats = true
+		d, err := Open("", opts)
+		require.NoError(t, err)
+		return d
+	}
+	expectedKeys := 1000
+	scan := func(d *DB) {
+		iter := d.NewIter(nil)
+		n := 0
+		for valid := iter.First(); valid; valid = iter.Next() {
+			n++
+		}
+		require.NoError(t, iter.Close())
+		require.Equal(t, expectedKeys, n)
+	}
+	waitForWarming := func(d *DB) {
+		for d.Metrics().CacheWarming.InProgress {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	d := openDB(true, 0)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%04d", i)), make([]byte, 100), nil))
+	}
+	require.NoError(t, d.Flush())
+	scan(d)
+	require.NoError(t, d.Close())
+	_, err := fs.Stat(cacheWarmingFilename)
+	require.NoError(t, err)
+
+	// The blocks read before the DB was closed are prefetched when it's
+	// reopened, after which the scan doesn't miss in the cache.
+	d = openDB(true, 0)
+	waitForWarming(d)
+	m := d.Metrics()
+	require.Greater(t, m.CacheWarming.BlocksTotal, int64(1))
+	require.Equal(t, m.CacheWarming.BlocksTotal, m.CacheWarming.BlocksWarmed)
+	require.Equal(t, int64(0), m.CacheWarming.BlocksSkipped)
+	misses := m.BlockCache.Misses
+	scan(d)
+	require.Equal(t, misses, d.Metrics().BlockCache.Misses)
+	require.Equal(t, int64(0), d.Metrics().CacheWarming.Dumps)
+	require.NoError(t, d.Close())
+
+	// Canceled prefetching skips the remaining blocks.
+	d = openDB(true, 1)
+	d.CancelCacheWarming()
+	waitForWarming(d)
+	m = d.Metrics()
+	require.Greater(t, m.CacheWarming.BlocksSkipped, int64(0))
+	require.Equal(t, m.CacheWarming.BlocksTotal, m.CacheWarming.BlocksWarmed+m.CacheWarming.BlocksSkipped)
+	scan(d)
+	require.NoError(t, d.Close())
+
+	// The blocks of tables that were deleted while the DB was closed are
+	// skipped. The table is rewritten by compacting it with a tombstone.
+	d = openDB(false, 0)
+	require.NoError(t, d.Delete([]byte("key0000"), nil))
+	require.NoError(t, d.Compact([]byte("key"), []byte("key9999"), false))
+	require.NoError(t, d.Close())
+	expectedKeys--
+	d = openDB(true, 0)
+	waitForWarming(d)
+	m = d.Metrics()
+	require.Greater(t, m.CacheWarming.BlocksTotal, int64(0))
+	require.Equal(t, m.CacheWarming.BlocksTotal, m.CacheWarming.BlocksSkipped)
+	require.NoError(t, d.Close())
+}
@@ -86,6 +86,7 @@ func newPebbleDB(dir string) DB {
 	}
 	opts.Levels[6].FilterPolicy = nil
 	opts.FlushSplitBytes = opts.Levels[0].TargetFileSize
+	opts.Experimental.MemTableInsertConcurrency = memTableInsertConcurrency
 
 	opts.EnsureDefaults()
 
@@ -15,15 +15,16 @@ import (
 )
 
 var (
-	cacheSize       int64
-	concurrency     int
-	disableWAL      bool
-	duration        time.Duration
-	maxSize         uint64
-	maxOpsPerSec    = newRateFlag("")
-	verbose         bool
-	waitCompactions bool
-	wipe            bool
+	cacheSize                 int64
+	concurrency               int
+	disableWAL                bool
+	duration                  time.Duration
+	maxSize                   uint64
+	maxOpsPerSec              = newRateFlag("")
+	memTableInsertConcurrency int
+	verbose                   bool
+	waitCompactions           bool
+	wipe                      bool
 )
 
 func main() {
@@ -68,6 +69,11 @@ func main() {
 		cmd.Flags().DurationVarP(
 			&duration, "duration", "d", 10*time.Second, "the duration to run (0, run forever)")
 	}
+	for _, cmd := range []*cobra.Command{ycsbCmd, writeBenchCmd} {
+		cmd.Flags().IntVar(
+			&memTableInsertConcurrency, "memtable-insert-concurrency", 1,
+			"maximum number of goroutines inserting a single batch into the memtable")
+	}
 	for _, cmd := range []*cobra.Command{scanCmd, syncCmd, tombstoneCmd, ycsbCmd} {
 		cmd.Flags().IntVarP(
 			&concurrency, "concurrency", "c", 1, "number of concurrent workers")
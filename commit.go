@@ -307,7 +307,9 @@ func (p *commitPipeline) Commit(b *Batch, syncWAL bool, noSyncWait bool) error {
 	//
 	// NB: We set Batch.commitErr on error so that the batch won't be a candidate
 	// for reuse. See Batch.release().
+	prepareStartTime := time.Now()
 	mem, err := p.prepare(b, syncWAL, noSyncWait)
+	b.commitStats.WALWriteDuration = time.Since(prepareStartTime)
 	if err != nil {
 		b.db = nil // prevent batch reuse on error
 		// NB: we are not doing <-p.commitQueueSem since the batch is still
@@ -317,7 +319,10 @@ func (p *commitPipeline) Commit(b *Batch, syncWAL bool, noSyncWait bool) error {
 	}
 
 	// Apply the batch to the memtable.
-	if err := p.env.apply(b, mem); err != nil {
+	applyStartTime := time.Now()
+	err = p.env.apply(b, mem)
+	b.commitStats.MemTableApplyDuration = time.Since(applyStartTime)
+	if err != nil {
 		b.db = nil // prevent batch reuse on error
 		// NB: we are not doing <-p.commitQueueSem since the batch is still
 		// sitting in the pending queue. We should consider fixing this by also
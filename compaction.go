@@ -13,6 +13,7 @@ import (
 	"runtime/pprof"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cockroachdb/errors"
@@ -593,10 +594,16 @@ type compaction struct {
 
 	// flushing contains the flushables (aka memtables) that are being flushed.
 	flushing flushableList
+	// flushLower and flushUpper, if set, bound the keys of the flushables
+	// written by a sub-flush of a parallel flush. See DB.runParallelFlush.
+	flushLower, flushUpper []byte
 	// bytesIterated contains the number of bytes that have been flushed/compacted.
 	bytesIterated uint64
 	// bytesWritten contains the number of bytes that have been written to outputs.
 	bytesWritten int64
+	// diskBandwidthTokens is the number of disk bandwidth tokens granted to
+	// the compaction by the CPUWorkPermissionGranter.
+	diskBandwidthTokens int64
 
 	// The boundaries of the input data.
 	smallest InternalKey
@@ -826,6 +833,20 @@ func adjustGrandparentOverlapBytesForFlush(c *compaction, flushingBytes uint64)
 
 func newFlush(
 	opts *Options, cur *version, baseLevel int, flushing flushableList, beganAt time.Time,
+) *compaction {
+	return newSubFlush(opts, cur, baseLevel, flushing, beganAt, nil /* lower */, nil /* upper */)
+}
+
+// newSubFlush returns a flush of the keys of the flushables within the
+// [lower, upper) key range. A nil bound leaves that side of the range
+// unbounded.
+func newSubFlush(
+	opts *Options,
+	cur *version,
+	baseLevel int,
+	flushing flushableList,
+	beganAt time.Time,
+	lower, upper []byte,
 ) *compaction {
 	c := &compaction{
 		kind:              compactionKindFlush,
@@ -840,6 +861,8 @@ func newFlush(
 		maxOutputFileSize: math.MaxUint64,
 		maxOverlapBytes:   math.MaxUint64,
 		flushing:          flushing,
+		flushLower:        lower,
+		flushUpper:        upper,
 	}
 	c.startLevel = &c.inputs[0]
 	c.outputLevel = &c.inputs[1]
@@ -868,14 +891,25 @@ func newFlush(
 
 	smallestSet, largestSet := false, false
 	updatePointBounds := func(iter internalIterator) {
-		if key, _ := iter.First(); key != nil {
+		var key *InternalKey
+		if lower != nil {
+			key, _ = iter.SeekGE(lower, base.SeekGEFlagsNone)
+		} else {
+			key, _ = iter.First()
+		}
+		if key != nil {
 			if !smallestSet ||
 				base.InternalCompare(c.cmp, c.smallest, *key) > 0 {
 				smallestSet = true
 				c.smallest = key.Clone()
 			}
 		}
-		if key, _ := iter.Last(); key != nil {
+		if upper != nil {
+			key, _ = iter.SeekLT(upper, base.SeekLTFlagsNone)
+		} else {
+			key, _ = iter.Last()
+		}
+		if key != nil {
 			if !largestSet ||
 				base.InternalCompare(c.cmp, c.largest, *key) < 0 {
 				largestSet = true
@@ -907,12 +941,12 @@ func newFlush(
 	var flushingBytes uint64
 	for i := range flushing {
 		f := flushing[i]
-		updatePointBounds(f.newIter(nil))
+		updatePointBounds(f.newIter(c.flushIterOptions()))
 		if rangeDelIter := f.newRangeDelIter(nil); rangeDelIter != nil {
-			updateRangeBounds(rangeDelIter)
+			updateRangeBounds(c.truncateFlushSpans(rangeDelIter))
 		}
 		if rangeKeyIter := f.newRangeKeyIter(nil); rangeKeyIter != nil {
-			updateRangeBounds(rangeKeyIter)
+			updateRangeBounds(c.truncateFlushSpans(rangeKeyIter))
 		}
 		flushingBytes += f.inuseBytes()
 	}
@@ -929,6 +963,35 @@ func newFlush(
 	return c
 }
 
+// flushIterOptions returns the options of the iterators over the points keys
+// of the flushables, which bound sub-flushes to their key ranges.
+func (c *compaction) flushIterOptions() *IterOptions {
+	if c.flushLower == nil && c.flushUpper == nil {
+		return nil
+	}
+	return &IterOptions{LowerBound: c.flushLower, UpperBound: c.flushUpper}
+}
+
+// truncateFlushSpans truncates the spans of a flushable to the key range of a
+// sub-flush, if any.
+func (c *compaction) truncateFlushSpans(iter keyspan.FragmentIterator) keyspan.FragmentIterator {
+	if c.flushLower == nil && c.flushUpper == nil {
+		return iter
+	}
+	lower, upper, cmp := c.flushLower, c.flushUpper, c.cmp
+	return keyspan.Filter(iter, func(in *keyspan.Span, out *keyspan.Span) (keep bool) {
+		out.Start, out.End = in.Start, in.End
+		out.Keys = append(out.Keys[:0], in.Keys...)
+		if lower != nil && cmp(out.Start, lower) < 0 {
+			out.Start = lower
+		}
+		if upper != nil && cmp(out.End, upper) > 0 {
+			out.End = upper
+		}
+		return cmp(out.Start, out.End) < 0
+	})
+}
+
 func (c *compaction) hasExtraLevelData() bool {
 	if len(c.extraLevels) == 0 {
 		// not a multi level compaction
@@ -1226,14 +1289,16 @@ func (c *compaction) newInputIter(
 	var rangeKeyIters []keyspan.FragmentIterator
 
 	if len(c.flushing) != 0 {
+		iterOpts := c.flushIterOptions()
 		if len(c.flushing) == 1 {
 			f := c.flushing[0]
-			iter := f.newFlushIter(nil, &c.bytesIterated)
+			iter := f.newFlushIter(iterOpts, &c.bytesIterated)
 			if rangeDelIter := f.newRangeDelIter(nil); rangeDelIter != nil {
-				c.rangeDelIter.Init(c.cmp, rangeDelIter)
+				c.rangeDelIter.Init(c.cmp, c.truncateFlushSpans(rangeDelIter))
 				iter = newMergingIter(c.logger, &c.stats, c.cmp, nil, iter, &c.rangeDelIter)
 			}
 			if rangeKeyIter := f.newRangeKeyIter(nil); rangeKeyIter != nil {
+				rangeKeyIter = c.truncateFlushSpans(rangeKeyIter)
 				mi := &keyspan.MergingIter{}
 				mi.Init(c.cmp, rangeKeyCompactionTransform(c.equal, snapshots, c.elideRangeKey), new(keyspan.MergingBuffers), rangeKeyIter)
 				c.rangeKeyInterleaving.Init(c.comparer, iter, mi, nil /* hooks */, nil /* lowerBound */, nil /* upperBound */)
@@ -1246,13 +1311,13 @@ func (c *compaction) newInputIter(
 		rangeKeyIters = make([]keyspan.FragmentIterator, 0, len(c.flushing))
 		for i := range c.flushing {
 			f := c.flushing[i]
-			iters = append(iters, f.newFlushIter(nil, &c.bytesIterated))
+			iters = append(iters, f.newFlushIter(iterOpts, &c.bytesIterated))
 			rangeDelIter := f.newRangeDelIter(nil)
 			if rangeDelIter != nil {
-				rangeDelIters = append(rangeDelIters, rangeDelIter)
+				rangeDelIters = append(rangeDelIters, c.truncateFlushSpans(rangeDelIter))
 			}
 			if rangeKeyIter := f.newRangeKeyIter(nil); rangeKeyIter != nil {
-				rangeKeyIters = append(rangeKeyIters, rangeKeyIter)
+				rangeKeyIters = append(rangeKeyIters, c.truncateFlushSpans(rangeKeyIter))
 			}
 		}
 		if len(rangeDelIters) > 0 {
@@ -1825,6 +1890,9 @@ func (d *DB) flush() {
 		d.mu.compact.flushWriteThroughput.Bytes += int64(bytesFlushed)
 		d.mu.compact.flushWriteThroughput.WorkDuration += workDuration
 		d.mu.compact.flushWriteThroughput.IdleDuration += idleDuration
+		if d.diskBandwidthGranter != nil {
+			d.diskBandwidthGranter.DiskBandwidthTokensUsed(0, int64(bytesFlushed))
+		}
 		// More flush work may have arrived while we were flushing, so schedule
 		// another flush if needed.
 		d.maybeScheduleFlush()
@@ -1877,6 +1945,176 @@ func (d *DB) runIngestFlush(c *compaction) (*manifest.VersionEdit, error) {
 	return ve, nil
 }
 
+// flushSplitKeys returns the user keys at which the flush c is split into
+// sub-flushes that are written concurrently, or nil if the flush shouldn't be
+// split. There are at most Options.Experimental.MaxFlushConcurrency
+// sub-flushes, each of which holds at least Options.FlushSplitBytes of keys
+// and values.
+func (d *DB) flushSplitKeys(c *compaction) (_ [][]byte, retErr error) {
+	maxConcurrency := d.opts.Experimental.MaxFlushConcurrency
+	if maxConcurrency <= 1 || c.kind != compactionKindFlush || d.opts.FlushSplitBytes <= 0 {
+		return nil, nil
+	}
+	// The memory used by the flushables is an upper bound on the size of
+	// their keys and values, which avoids iterating over small flushes.
+	var inuseBytes uint64
+	for i := range c.flushing {
+		inuseBytes += c.flushing[i].inuseBytes()
+	}
+	if inuseBytes < 2*uint64(d.opts.FlushSplitBytes) {
+		return nil, nil
+	}
+
+	iters := make([]internalIterator, len(c.flushing))
+	for i := range c.flushing {
+		iters[i] = c.flushing[i].newIter(nil)
+	}
+	var stats base.InternalIteratorStats
+	// The merging iterator closes the flushables' iterators.
+	iter := newMergingIter(d.opts.Logger, &stats, d.cmp, nil, iters...)
+	defer func() {
+		retErr = firstError(retErr, iter.Close())
+	}()
+
+	// The keys and values are iterated over once. The first user key after
+	// every granule of bytes is a candidate split key, and the split keys are
+	// chosen from the candidates once the total size is known. The granule is
+	// a sixteenth of the largest the sub-flushes' target size can be, which
+	// bounds both the number of candidates and how far a sub-flush can overshoot
+	// its target.
+	maxTargetBytes := inuseBytes / uint64(maxConcurrency)
+	if maxTargetBytes < uint64(d.opts.FlushSplitBytes) {
+		maxTargetBytes = uint64(d.opts.FlushSplitBytes)
+	}
+	granule := maxTargetBytes / 16
+	type splitCandidate struct {
+		userKey []byte
+		// offset is the size of the keys and values preceding userKey.
+		offset uint64
+	}
+	var candidates []splitCandidate
+	var totalBytes, nextCandidate uint64 = 0, granule
+	var prevUserKey []byte
+	for key, val := iter.First(); key != nil; key, val = iter.Next() {
+		if totalBytes >= nextCandidate && d.cmp(prevUserKey, key.UserKey) != 0 {
+			candidates = append(candidates, splitCandidate{
+				userKey: append([]byte(nil), key.UserKey...),
+				offset:  totalBytes,
+			})
+			nextCandidate = totalBytes + granule
+		}
+		totalBytes += uint64(len(key.UserKey) + val.Len())
+		prevUserKey = key.UserKey
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	targetBytes := totalBytes / uint64(maxConcurrency)
+	if targetBytes < uint64(d.opts.FlushSplitBytes) {
+		targetBytes = uint64(d.opts.FlushSplitBytes)
+	}
+
+	// Split at the first candidate after every multiple of targetBytes, so
+	// that the candidates' overshoot doesn't accumulate, as long as each
+	// sub-flush holds at least FlushSplitBytes.
+	minBytes := uint64(d.opts.FlushSplitBytes)
+	var splitKeys [][]byte
+	var prevOffset uint64
+	for _, c := range candidates {
+		if len(splitKeys) == maxConcurrency-1 {
+			break
+		}
+		if c.offset >= uint64(len(splitKeys)+1)*targetBytes &&
+			c.offset-prevOffset >= minBytes && totalBytes-c.offset >= minBytes {
+			splitKeys = append(splitKeys, c.userKey)
+			prevOffset = c.offset
+		}
+	}
+	return splitKeys, nil
+}
+
+// runParallelFlush runs the flush c as sub-flushes of the disjoint key ranges
+// delimited by splitKeys, which are written concurrently, and merges their
+// outputs into a single version edit.
+//
+// d.mu must be held when calling this, but the mutex may be dropped and
+// re-acquired during the course of this method.
+func (d *DB) runParallelFlush(
+	jobID int, c *compaction, baseLevel int, splitKeys [][]byte,
+) (ve *versionEdit, pendingOutputs []physicalMeta, stats compactStats, retErr error) {
+	// The sub-flushes use the current version rather than c.version, since
+	// d.mu was dropped while computing the split keys and c.version may no
+	// longer be the current version, in which case its L0Sublevels has been
+	// released.
+	cur := d.mu.versions.currentVersion()
+	subs := make([]*compaction, len(splitKeys)+1)
+	for i := range subs {
+		var lower, upper []byte
+		if i > 0 {
+			lower = splitKeys[i-1]
+		}
+		if i < len(splitKeys) {
+			upper = splitKeys[i]
+		}
+		subs[i] = newSubFlush(d.opts, cur, baseLevel, c.flushing, c.beganAt, lower, upper)
+	}
+
+	type subFlushResult struct {
+		ve             *versionEdit
+		pendingOutputs []physicalMeta
+		stats          compactStats
+		err            error
+	}
+	results := make([]subFlushResult, len(subs))
+	var wg sync.WaitGroup
+	wg.Add(len(subs))
+	for i := range subs {
+		go func(i int) {
+			defer wg.Done()
+			// runCompaction drops d.mu while writing, so the sub-flushes only
+			// hold it while they set up and allocate file numbers.
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			r := &results[i]
+			r.ve, r.pendingOutputs, r.stats, r.err = d.runCompaction(jobID, subs[i])
+		}(i)
+	}
+	d.mu.Unlock()
+	defer d.mu.Lock()
+	wg.Wait()
+
+	ve = &versionEdit{
+		DeletedFiles: map[deletedFileEntry]*fileMetadata{},
+	}
+	outputMetrics := &LevelMetrics{}
+	c.metrics = map[int]*LevelMetrics{
+		c.outputLevel.level: outputMetrics,
+	}
+	for i := range results {
+		r := &results[i]
+		c.bytesIterated += subs[i].bytesIterated
+		if r.err != nil {
+			retErr = firstError(retErr, r.err)
+			continue
+		}
+		ve.NewFiles = append(ve.NewFiles, r.ve.NewFiles...)
+		pendingOutputs = append(pendingOutputs, r.pendingOutputs...)
+		outputMetrics.Add(subs[i].metrics[c.outputLevel.level])
+		stats.cumulativePinnedKeys += r.stats.cumulativePinnedKeys
+		stats.cumulativePinnedSize += r.stats.cumulativePinnedSize
+		stats.gcDroppedBytes += r.stats.gcDroppedBytes
+	}
+	if retErr != nil {
+		// The outputs of the failed sub-flushes were removed by runCompaction,
+		// but those of the successful ones must be removed here.
+		for _, m := range pendingOutputs {
+			_ = d.objProvider.Remove(fileTypeTable, m.FileNum.DiskFileNum())
+		}
+		return nil, nil, stats, retErr
+	}
+	return ve, pendingOutputs, stats, nil
+}
+
 // flush runs a compaction that copies the immutable memtables from memory to
 // disk.
 //
@@ -1965,8 +2203,9 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 		}
 	}
 
+	baseLevel := d.mu.versions.picker.getBaseLevel()
 	c := newFlush(d.opts, d.mu.versions.currentVersion(),
-		d.mu.versions.picker.getBaseLevel(), d.mu.mem.queue[:n], d.timeNow())
+		baseLevel, d.mu.mem.queue[:n], d.timeNow())
 	d.addInProgressCompaction(c)
 
 	jobID := d.mu.nextJobID
@@ -1987,8 +2226,25 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 	// anyway, we create the VersionEdit for ingestedFlushable outside of
 	// runCompaction. For all other flush cases, we construct the VersionEdit
 	// inside runCompaction.
+	var subFlushes int
 	if c.kind != compactionKindIngestedFlushable {
-		ve, pendingOutputs, stats, err = d.runCompaction(jobID, c)
+		// Split the flush into sub-flushes if it's large enough. Computing the
+		// split keys requires iterating over the flushables, so it's done
+		// without holding d.mu.
+		d.mu.Unlock()
+		var splitKeys [][]byte
+		splitKeys, err = d.flushSplitKeys(c)
+		d.mu.Lock()
+		// An error reading the flushables fails the flush, as it would had it
+		// been encountered while writing them.
+		if err == nil {
+			if len(splitKeys) > 0 {
+				subFlushes = len(splitKeys) + 1
+				ve, pendingOutputs, stats, err = d.runParallelFlush(jobID, c, baseLevel, splitKeys)
+			} else {
+				ve, pendingOutputs, stats, err = d.runCompaction(jobID, c)
+			}
+		}
 	}
 
 	// Acquire logLock. This will be released either on an error, by way of
@@ -2068,6 +2324,9 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 	bytesFlushed = c.bytesIterated
 	d.mu.snapshots.cumulativePinnedCount += stats.cumulativePinnedKeys
 	d.mu.snapshots.cumulativePinnedSize += stats.cumulativePinnedSize
+	if err == nil {
+		d.mu.compact.gcDroppedBytes += stats.gcDroppedBytes
+	}
 
 	d.maybeUpdateDeleteCompactionHints(c)
 	d.clearCompactingState(c, err != nil)
@@ -2080,6 +2339,10 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 		d.mu.mem.queue = d.mu.mem.queue[n:]
 		d.updateReadStateLocked(d.opts.DebugCheck)
 		d.updateTableStatsLocked(ve.NewFiles)
+		if subFlushes > 0 {
+			d.mu.versions.metrics.Flush.ParallelCount++
+			d.mu.versions.metrics.Flush.SubFlushCount += int64(subFlushes)
+		}
 		if ingest {
 			d.mu.versions.metrics.Flush.AsIngestCount++
 			for _, l := range c.metrics {
@@ -2093,6 +2356,9 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 	// IterOptions.OnlyReadGuaranteedDurable.
 	info.TotalDuration = d.timeNow().Sub(startTime)
 	d.opts.EventListener.FlushEnd(info)
+	if d.opts.Tracer != nil {
+		d.traceFlush(startTime, &info, bytesFlushed)
+	}
 
 	// The order of these operations matters here for ease of testing.
 	// Removing the reader reference first allows tests to be guaranteed that
@@ -2234,13 +2500,57 @@ func (d *DB) maybeScheduleCompactionPicker(
 		if pc == nil {
 			break
 		}
+		// Compactions that would run concurrently with other compactions must
+		// acquire disk bandwidth tokens. The number of bytes written is
+		// bounded by the size of the compaction's inputs.
+		var tokens int64
+		if d.diskBandwidthGranter != nil && d.mu.compact.compactingCount > 0 {
+			for i := range pc.inputs {
+				tokens += int64(pc.inputs[i].files.SizeSum())
+			}
+			if !d.diskBandwidthGranter.GetDiskBandwidthTokens(tokens) {
+				d.maybeScheduleDiskBandwidthRetry()
+				break
+			}
+		}
 		c := newCompaction(pc, d.opts, d.timeNow())
+		c.diskBandwidthTokens = tokens
 		d.mu.compact.compactingCount++
 		d.addInProgressCompaction(c)
 		go d.compact(c, nil)
 	}
 }
 
+// diskBandwidthRetryInterval is the delay after which compactions are
+// reconsidered when the DiskBandwidthGranter denied tokens.
+const diskBandwidthRetryInterval = 250 * time.Millisecond
+
+// maybeScheduleDiskBandwidthRetry schedules compactions to be reconsidered
+// after the DiskBandwidthGranter denied tokens, so that they don't stall if no
+// flush or compaction completes in the meantime.
+//
+// d.mu must be held when calling this.
+func (d *DB) maybeScheduleDiskBandwidthRetry() {
+	if d.mu.compact.diskBandwidthRetryScheduled {
+		return
+	}
+	d.mu.compact.diskBandwidthRetryScheduled = true
+	go func() {
+		timer := time.NewTimer(diskBandwidthRetryInterval)
+		defer timer.Stop()
+
+		select {
+		case <-d.closedCh:
+			return
+		case <-timer.C:
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.mu.compact.diskBandwidthRetryScheduled = false
+			d.maybeScheduleCompaction()
+		}
+	}()
+}
+
 // deleteCompactionHintType indicates whether the deleteCompactionHint was
 // generated from a span containing a range del (point key only), a range key
 // delete (range key only), or both a point and range key.
@@ -2530,6 +2840,9 @@ func (d *DB) compact(c *compaction, errChannel chan error) {
 		// d.mu.compact.InProgress to ensure Metrics.Compact.Duration does not
 		// miss or double count a completing compaction's duration.
 		d.mu.compact.duration += d.timeNow().Sub(c.beganAt)
+		if d.diskBandwidthGranter != nil {
+			d.diskBandwidthGranter.DiskBandwidthTokensUsed(c.diskBandwidthTokens, c.bytesWritten)
+		}
 
 		// The previous compaction may have produced too many files in a
 		// level, so reschedule another compaction if needed.
@@ -2592,6 +2905,9 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 
 	d.mu.snapshots.cumulativePinnedCount += stats.cumulativePinnedKeys
 	d.mu.snapshots.cumulativePinnedSize += stats.cumulativePinnedSize
+	if err == nil {
+		d.mu.compact.gcDroppedBytes += stats.gcDroppedBytes
+	}
 	d.maybeUpdateDeleteCompactionHints(c)
 	// NB: clearing compacting state must occur before updating the read state;
 	// L0Sublevels initialization depends on it.
@@ -2601,6 +2917,9 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 
 	info.TotalDuration = d.timeNow().Sub(c.beganAt)
 	d.opts.EventListener.CompactionEnd(info)
+	if d.opts.Tracer != nil {
+		d.traceCompaction(c.beganAt, &info)
+	}
 
 	// Update the read state before deleting obsolete files because the
 	// read-state update will cause the previous version to be unref'd and if
@@ -2618,6 +2937,7 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 type compactStats struct {
 	cumulativePinnedKeys uint64
 	cumulativePinnedSize uint64
+	gcDroppedBytes       uint64
 }
 
 // runCompactions runs a compaction that produces new on-disk tables from
@@ -2708,6 +3028,7 @@ func (d *DB) runCompaction(
 
 	snapshots := d.mu.snapshots.toSlice()
 	formatVers := d.mu.formatVers.vers
+	gcThresholds := d.gcThresholdsForCompaction(c)
 
 	// Release the d.mu lock while doing I/O.
 	// Note the unusual order: Unlock and then Lock.
@@ -2722,6 +3043,9 @@ func (d *DB) runCompaction(
 	iter := newCompactionIter(c.cmp, c.equal, c.formatKey, d.merge, iiter, snapshots,
 		&c.rangeDelFrag, &c.rangeKeyFrag, c.allowedZeroSeqNum, c.elideTombstone,
 		c.elideRangeTombstone, d.FormatMajorVersion())
+	if len(gcThresholds) > 0 {
+		iter.gc = newCompactionGC(c.comparer, gcThresholds, snapshots, c.rangeKeyInterleaving.Span)
+	}
 
 	var (
 		createdFiles    []base.DiskFileNum
@@ -2788,6 +3112,14 @@ func (d *DB) runCompaction(
 		// Cannot yet write block properties.
 		writerOpts.BlockPropertyCollectors = nil
 	}
+	if formatVers < ExperimentalFormatTableEncryption {
+		// Cannot yet write encrypted tables. Open doesn't permit a
+		// TableEncryptionKey at earlier versions.
+		writerOpts.Encryption = nil
+	}
+	if formatVers < ExperimentalFormatKVChecksums {
+		writerOpts.KVChecksums = false
+	}
 
 	// prevPointKey is a sstable.WriterOption that provides access to
 	// the last point key written to a writer's sstable. When a new
@@ -3235,7 +3567,16 @@ func (d *DB) runCompaction(
 					return nil, pendingOutputs, stats, err
 				}
 			}
-			if err := tw.Add(*key, val); err != nil {
+			// Pass the key-value checksum of the key read from the input, if
+			// it's known, so that the writer verifies the key and value
+			// against it.
+			var err error
+			if checksum, ok := iter.KVChecksum(); ok {
+				err = tw.AddWithKVChecksum(*key, val, checksum)
+			} else {
+				err = tw.Add(*key, val)
+			}
+			if err != nil {
 				return nil, pendingOutputs, stats, err
 			}
 			if iter.snapshotPinned {
@@ -3296,6 +3637,9 @@ func (d *DB) runCompaction(
 	// completes, before re-acquiring the mutex.
 	_ = d.calculateDiskAvailableBytes()
 
+	if iter.gc != nil {
+		stats.gcDroppedBytes = iter.gc.droppedBytes
+	}
 	return ve, pendingOutputs, stats, nil
 }
 
@@ -167,6 +167,12 @@ type compactionIter struct {
 	keyTrailer  uint64
 	value       []byte
 	valueCloser io.Closer
+	// kvChecksum is the key-value checksum of `key` and `value`, as returned
+	// by the input iterator when the key was saved, if hasKVChecksum is set.
+	// It's dropped if the key's kind or value is changed, since it no longer
+	// applies (see dropKVChecksum).
+	kvChecksum    base.KVChecksum
+	hasKVChecksum bool
 	// Temporary buffer used for storing the previous user key in order to
 	// determine when iteration has advanced to a new user key and thus a new
 	// snapshot stripe.
@@ -241,6 +247,9 @@ type compactionIter struct {
 	// The on-disk format major version. This informs the types of keys that
 	// may be written to disk during a compaction.
 	formatVersion FormatMajorVersion
+	// gc, if non-nil, drops MVCC versions below a GC threshold. See
+	// DB.SetGCThreshold.
+	gc *compactionGC
 }
 
 func newCompactionIter(
@@ -386,6 +395,15 @@ func (i *compactionIter) Next() (*InternalKey, []byte) {
 			i.snapshotPinned = true
 		}
 
+		if i.gc != nil && i.gc.drop(i.iterKey, i.iterValue, i.curSnapshotIdx, i.snapshotPinned, i.elideTombstone) {
+			// The key is an MVCC version shadowed by a newer version at or
+			// below the GC threshold. Skip it along with any older entries
+			// for the same key in the stripe, which are dropped too.
+			i.saveKey()
+			i.gcSkipInStripe()
+			continue
+		}
+
 		switch i.iterKey.Kind() {
 		case InternalKeyKindDelete, InternalKeyKindSingleDelete, InternalKeyKindDeleteSized:
 			if i.elideTombstone(i.iterKey.UserKey) {
@@ -419,6 +437,9 @@ func (i *compactionIter) Next() (*InternalKey, []byte) {
 
 			case InternalKeyKindSingleDelete:
 				if i.singleDeleteNext() {
+					if i.err != nil {
+						return nil, nil
+					}
 					return &i.key, i.value
 				}
 				continue
@@ -431,6 +452,9 @@ func (i *compactionIter) Next() (*InternalKey, []byte) {
 			// preserving the original value, and potentially mutating the key
 			// kind.
 			i.setNext()
+			if i.err != nil {
+				return nil, nil
+			}
 			return &i.key, i.value
 
 		case InternalKeyKindMerge:
@@ -529,6 +553,18 @@ func (i *compactionIter) skipInStripe() {
 	}
 }
 
+// gcSkipInStripe is like skipInStripe, but accounts for the skipped keys as
+// dropped by MVCC garbage collection.
+func (i *compactionIter) gcSkipInStripe() {
+	i.skip = true
+	for i.nextInStripe() == sameStripeSkippable {
+		i.gc.addDropped(i.iterKey, i.iterValue)
+	}
+	if i.iterStripeChange == newStripeNewKey || i.iterStripeChange == newStripeSameKey {
+		i.skip = false
+	}
+}
+
 func (i *compactionIter) iterNext() bool {
 	var iterValue LazyValue
 	i.iterKey, iterValue = i.iter.Next()
@@ -684,6 +720,7 @@ func (i *compactionIter) setNext() {
 			// encounters a RANGEDEL.
 			// TODO(travers): optimize to handle the RANGEDEL case if it
 			// turns out to be a performance problem.
+			i.dropKVChecksum(i.value)
 			i.key.SetKind(InternalKeyKindSetWithDelete)
 
 			// By setting i.skip=true, we are saying that after the
@@ -699,6 +736,7 @@ func (i *compactionIter) setNext() {
 			if i.iterKey.Kind() == InternalKeyKindDelete ||
 				i.iterKey.Kind() == InternalKeyKindSingleDelete ||
 				i.iterKey.Kind() == InternalKeyKindDeleteSized {
+				i.dropKVChecksum(i.value)
 				i.key.SetKind(InternalKeyKindSetWithDelete)
 				i.skip = true
 				return
@@ -710,9 +748,12 @@ func (i *compactionIter) setNext() {
 }
 
 func (i *compactionIter) mergeNext(valueMerger ValueMerger) stripeChangeType {
-	// Save the current key.
+	// Save the current key. Its value is merged with older operands.
 	i.saveKey()
 	i.valid = true
+	if i.dropKVChecksum(i.iterValue); i.err != nil {
+		return sameStripeSkippable
+	}
 
 	// Loop looking for older values in the current snapshot stripe and merge
 	// them.
@@ -759,7 +800,9 @@ func (i *compactionIter) mergeNext(valueMerger ValueMerger) stripeChangeType {
 			// value and return. We change the kind of the resulting key to a
 			// Set so that it shadows keys in lower levels. That is:
 			// MERGE + (SET*) -> SET.
-			i.err = valueMerger.MergeOlder(i.iterValue)
+			if i.err = i.verifyIterKVChecksum(); i.err == nil {
+				i.err = valueMerger.MergeOlder(i.iterValue)
+			}
 			if i.err != nil {
 				i.valid = false
 				return sameStripeSkippable
@@ -781,7 +824,9 @@ func (i *compactionIter) mergeNext(valueMerger ValueMerger) stripeChangeType {
 
 			// We've hit another Merge value. Merge with the existing value and
 			// continue looping.
-			i.err = valueMerger.MergeOlder(i.iterValue)
+			if i.err = i.verifyIterKVChecksum(); i.err == nil {
+				i.err = valueMerger.MergeOlder(i.iterValue)
+			}
 			if i.err != nil {
 				i.valid = false
 				return sameStripeSkippable
@@ -813,6 +858,7 @@ func (i *compactionIter) singleDeleteNext() bool {
 		case InternalKeyKindDelete, InternalKeyKindMerge, InternalKeyKindSetWithDelete, InternalKeyKindDeleteSized:
 			// We've hit a Delete, DeleteSized, Merge, SetWithDelete, transform
 			// the SingleDelete into a full Delete.
+			i.dropKVChecksum(i.value)
 			i.key.SetKind(InternalKeyKindDelete)
 			i.skip = true
 			return true
@@ -873,6 +919,13 @@ func (i *compactionIter) deleteSizedNext() (*base.InternalKey, []byte) {
 			// been zeroed out. In this case, we want to adopt the value of the
 			// DELSIZED with the lower sequence number, in case the a.SET.4 key
 			// has not yet been elided.
+			i.dropKVChecksum(i.value)
+			if i.err == nil {
+				i.err = i.verifyIterKVChecksum()
+			}
+			if i.err != nil {
+				return nil, nil
+			}
 			i.valueBuf = append(i.valueBuf[:0], i.iterValue...)
 			i.value = i.valueBuf
 			// Reset the elided total.
@@ -929,6 +982,9 @@ func (i *compactionIter) deleteSizedNext() (*base.InternalKey, []byte) {
 	//
 	// We opt for (4) under the rationale that we can't rely on the
 	// user-provided size for accuracy, so ordinary DEL heuristics are safer.
+	if i.dropKVChecksum(i.value); i.err != nil {
+		return nil, nil
+	}
 	i.value = i.valueBuf[:0]
 	if elidedSize != v {
 		i.key.SetKind(InternalKeyKindDelete)
@@ -941,9 +997,40 @@ func (i *compactionIter) saveKey() {
 	i.key.UserKey = i.keyBuf
 	i.key.Trailer = i.iterKey.Trailer
 	i.keyTrailer = i.iterKey.Trailer
+	i.kvChecksum, i.hasKVChecksum = base.IterKVChecksum(i.iter)
 	i.frontiers.Advance(i.key.UserKey)
 }
 
+// dropKVChecksum is called before the kind or value of the saved key is
+// changed, given the key's current value. It verifies the key-value checksum
+// of the key, if it's known, so that corruption of the key or value since
+// they were read isn't masked by the change, and then drops it.
+func (i *compactionIter) dropKVChecksum(value []byte) {
+	if i.hasKVChecksum && i.kvChecksum != base.MakeKVChecksum(i.key.Kind(), i.key.UserKey, value) {
+		i.err = base.KVChecksumMismatchError(i.key, "compaction")
+		i.valid = false
+	}
+	i.hasKVChecksum = false
+}
+
+// verifyIterKVChecksum verifies the key-value checksum of the input
+// iterator's current entry, if it's known. It's used for entries whose
+// values are folded into the saved key's value.
+func (i *compactionIter) verifyIterKVChecksum() error {
+	checksum, ok := base.IterKVChecksum(i.iter)
+	if ok && checksum != base.MakeKVChecksum(i.iterKey.Kind(), i.iterKey.UserKey, i.iterValue) {
+		return base.KVChecksumMismatchError(*i.iterKey, "compaction")
+	}
+	return nil
+}
+
+// KVChecksum returns the key-value checksum of the key and value returned by
+// the last call to First or Next, as read from the input, and whether it's
+// known. It isn't known if the compaction changed the key's kind or value.
+func (i *compactionIter) KVChecksum() (base.KVChecksum, bool) {
+	return i.kvChecksum, i.hasKVChecksum
+}
+
 func (i *compactionIter) cloneKey(key []byte) []byte {
 	i.alloc, key = i.alloc.Copy(key)
 	return key
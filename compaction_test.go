@@ -30,6 +30,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/errorfs"
 	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/sstable"
@@ -945,6 +946,100 @@ func TestCompactionCPUGranterDefault(t *testing.T) {
 	}
 }
 
+type diskBandwidthGranter struct {
+	defaultCPUWorkGranter
+	used    int64
+	written int64
+}
+
+var _ DiskBandwidthGranter = (*diskBandwidthGranter)(nil)
+
+func (g *diskBandwidthGranter) GetDiskBandwidthTokens(bytes int64) bool {
+	return false
+}
+
+func (g *diskBandwidthGranter) DiskBandwidthTokensUsed(granted, written int64) {
+	g.used += granted
+	g.written += written
+}
+
+// Tests that compactions beyond the first are not started when the granter
+// withholds disk bandwidth tokens, and that disk writes are reported.
+func TestCompactionDiskBandwidthGranter(t *testing.T) {
+	var mu sync.Mutex
+	var running, maxRunning int
+	opts := (&Options{
+		FS:                        vfs.NewMem(),
+		MemTableSize:              64 << 10,
+		L0CompactionThreshold:     1,
+		MaxConcurrentCompactions:  func() int { return 4 },
+		LBaseMaxBytes:             64 << 10,
+		L0CompactionFileThreshold: 1,
+		EventListener: &EventListener{
+			CompactionBegin: func(CompactionInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+			},
+			CompactionEnd: func(CompactionInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				running--
+			},
+			// Slow down compactions so that additional compactions would be
+			// scheduled concurrently if the tokens were granted.
+			TableCreated: func(info TableCreateInfo) {
+				if info.Reason == "compacting" {
+					time.Sleep(5 * time.Millisecond)
+				}
+			},
+		},
+	}).WithFSDefaults()
+	opts.Experimental.L0CompactionConcurrency = 1
+	opts.Experimental.CompactionDebtConcurrency = 1
+	g := &diskBandwidthGranter{}
+	opts.Experimental.CPUWorkPermissionGranter = g
+	d, err := Open("", opts)
+	require.NoError(t, err)
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	value := make([]byte, 1024)
+	for i := 0; i < 2000; i++ {
+		key := []byte(fmt.Sprintf("%08d", rng.Intn(100000)))
+		require.NoError(t, d.Set(key, value, nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+
+	require.Equal(t, 1, maxRunning)
+	require.Zero(t, g.used)
+	require.Greater(t, g.written, int64(0))
+}
+
+// Tests that compactions are reconsidered after the granter denies disk
+// bandwidth tokens, even if no flush or compaction completes.
+func TestCompactionDiskBandwidthRetry(t *testing.T) {
+	opts := (&Options{FS: vfs.NewMem()}).WithFSDefaults()
+	opts.Experimental.CPUWorkPermissionGranter = &diskBandwidthGranter{}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	d.mu.Lock()
+	d.maybeScheduleDiskBandwidthRetry()
+	require.True(t, d.mu.compact.diskBandwidthRetryScheduled)
+	d.mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return !d.mu.compact.diskBandwidthRetryScheduled
+	}, 10*time.Second, time.Millisecond)
+}
+
 func TestCompaction(t *testing.T) {
 	const memTableSize = 10000
 	// Tuned so that 2 values can reside in the memtable before a flush, but a
@@ -3332,6 +3427,162 @@ func TestCompactFlushQueuedLargeBatch(t *testing.T) {
 	require.NoError(t, d.Close())
 }
 
+func TestParallelFlush(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{
+		FS:                          mem,
+		Comparer:                    testkeys.Comparer,
+		FlushSplitBytes:             16 << 10,
+		MemTableSize:                4 << 20,
+		DisableAutomaticCompactions: true,
+		FormatMajorVersion:          FormatNewest,
+	}
+	opts.Experimental.MaxFlushConcurrency = 4
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write the keys to a large batch as well as to the memtable, so that the
+	// flush merges several flushables.
+	value := bytes.Repeat([]byte("v"), 100)
+	b := d.NewBatch()
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, b.Set([]byte(fmt.Sprintf("key%05d", i)), value, nil))
+	}
+	require.NoError(t, d.Apply(b, nil))
+	for i := 0; i < 2000; i += 2 {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%05d", i)), []byte("updated"), nil))
+	}
+	// The range deletion and range key span the boundaries of the sub-flushes.
+	require.NoError(t, d.DeleteRange([]byte("key00100"), []byte("key01900"), nil))
+	require.NoError(t, d.RangeKeySet([]byte("key00000"), []byte("key99999"), nil, []byte("rk"), nil))
+	require.NoError(t, d.Flush())
+
+	m := d.Metrics()
+	require.Equal(t, int64(1), m.Flush.ParallelCount)
+	require.Equal(t, int64(4), m.Flush.SubFlushCount)
+	require.Equal(t, int64(1), m.Flush.Count)
+
+	// The tables of the sub-flushes don't overlap, and were installed in one
+	// version edit.
+	d.mu.Lock()
+	files := d.mu.versions.currentVersion().Levels[0].Slice()
+	d.mu.Unlock()
+	require.GreaterOrEqual(t, files.Len(), 4)
+	var metas []*fileMetadata
+	iter := files.Iter()
+	for f := iter.First(); f != nil; f = iter.Next() {
+		metas = append(metas, f)
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		return d.cmp(metas[i].Smallest.UserKey, metas[j].Smallest.UserKey) < 0
+	})
+	for i := 1; i < len(metas); i++ {
+		require.LessOrEqual(t, d.cmp(metas[i-1].Largest.UserKey, metas[i].Smallest.UserKey), 0,
+			"%s overlaps %s", metas[i-1], metas[i])
+	}
+	require.Equal(t, 1, d.mu.versions.currentVersion().L0Sublevels.ReadAmplification())
+
+	it := d.NewIter(&IterOptions{KeyTypes: IterKeyTypePointsAndRanges})
+	var points int
+	for valid := it.First(); valid; valid = it.Next() {
+		if hasPoint, _ := it.HasPointAndRange(); !hasPoint {
+			continue
+		}
+		points++
+		i, err := strconv.Atoi(string(it.Key()[len("key"):]))
+		require.NoError(t, err)
+		require.False(t, i >= 100 && i < 1900, "key %s should be deleted", it.Key())
+		if i%2 == 0 {
+			require.Equal(t, "updated", string(it.Value()))
+		} else {
+			require.Equal(t, value, it.Value())
+		}
+		start, end := it.RangeBounds()
+		require.Equal(t, "key00000", string(start))
+		require.Equal(t, "key99999", string(end))
+	}
+	require.NoError(t, it.Close())
+	require.Equal(t, 200, points)
+}
+
+// errorFlushable is a flushable whose point iterator fails.
+type errorFlushable struct {
+	flushable
+	err error
+}
+
+func (f errorFlushable) newIter(o *IterOptions) internalIterator {
+	return newErrorIter(f.err)
+}
+
+// firstCountingFlushable is a flushable that counts the calls to First on its
+// point iterators.
+type firstCountingFlushable struct {
+	flushable
+	firsts *int
+}
+
+func (f firstCountingFlushable) newIter(o *IterOptions) internalIterator {
+	return firstCountingIter{internalIterator: f.flushable.newIter(o), firsts: f.firsts}
+}
+
+type firstCountingIter struct {
+	internalIterator
+	firsts *int
+}
+
+func (i firstCountingIter) First() (*InternalKey, base.LazyValue) {
+	*i.firsts++
+	return i.internalIterator.First()
+}
+
+// Tests that errors reading the flushables while computing the split keys of
+// a flush are returned, and that the flushables are iterated over once.
+func TestParallelFlushSplitKeysError(t *testing.T) {
+	opts := &Options{
+		FS:                          vfs.NewMem(),
+		FlushSplitBytes:             16 << 10,
+		MemTableSize:                4 << 20,
+		DisableAutomaticCompactions: true,
+	}
+	opts.Experimental.MaxFlushConcurrency = 4
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	value := bytes.Repeat([]byte("v"), 100)
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%05d", i)), value, nil))
+	}
+	d.mu.Lock()
+	queue := append(flushableList(nil), d.mu.mem.queue...)
+	d.mu.Unlock()
+
+	var firsts int
+	counted := make(flushableList, len(queue))
+	for i := range queue {
+		counted[i] = &flushableEntry{
+			flushable: firstCountingFlushable{flushable: queue[i].flushable, firsts: &firsts},
+		}
+	}
+	c := &compaction{kind: compactionKindFlush, flushing: counted}
+	splitKeys, err := d.flushSplitKeys(c)
+	require.NoError(t, err)
+	require.Len(t, splitKeys, 3)
+	require.Equal(t, len(queue), firsts)
+
+	c = &compaction{kind: compactionKindFlush, flushing: queue}
+
+	injected := errors.New("injected error")
+	c.flushing = append(c.flushing, &flushableEntry{
+		flushable: errorFlushable{flushable: queue[0].flushable, err: injected},
+	})
+	splitKeys, err = d.flushSplitKeys(c)
+	require.ErrorIs(t, err, injected)
+	require.Nil(t, splitKeys)
+}
+
 // Regression test for #747. Test a problematic series of "cleaner" operations
 // that could previously lead to DB.disableFileDeletions blocking forever even
 // though no cleaning was in progress.
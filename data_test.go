@@ -93,6 +93,11 @@ func runIterCmd(d *datadriven.TestData, iter *Iterator, closeIter bool) string {
 				return "seek-prefix-ge <key>\n"
 			}
 			valid = iter.SeekPrefixGE([]byte(parts[1]))
+		case "seek-prefix-lt":
+			if len(parts) != 2 {
+				return "seek-prefix-lt <key>\n"
+			}
+			valid = iter.SeekPrefixLT([]byte(parts[1]))
 		case "seek-lt":
 			if len(parts) != 2 {
 				return "seek-lt <key>\n"
@@ -253,7 +258,7 @@ func runIterCmd(d *datadriven.TestData, iter *Iterator, closeIter bool) string {
 func parseIterOptions(
 	opts *IterOptions, ref *IterOptions, parts []string,
 ) (foundAny bool, err error) {
-	const usageString = "[lower=<lower>] [upper=<upper>] [key-types=point|range|both] [mask-suffix=<suffix>] [mask-filter=<bool>] [only-durable=<bool>] [table-filter=reuse|none] [point-filters=reuse|none]\n"
+	const usageString = "[lower=<lower>] [upper=<upper>] [key-types=point|range|both] [mask-suffix=<suffix>] [mask-filter=<bool>] [only-durable=<bool>] [table-filter=reuse|none] [point-filters=reuse|none] [mvcc-read=<ts>|none]\n"
 	for _, part := range parts {
 		arg := strings.SplitN(part, "=", 2)
 		if len(arg) != 2 {
@@ -305,6 +310,16 @@ func parseIterOptions(
 			if err != nil {
 				return false, errors.Newf("cannot parse only-durable=%q: %s", arg[1], err)
 			}
+		case "mvcc-read":
+			if arg[1] == "none" {
+				opts.MVCC = nil
+				break
+			}
+			ts, err := strconv.ParseUint(arg[1], 10, 64)
+			if err != nil {
+				return false, errors.Newf("cannot parse mvcc-read=%q: %s", arg[1], err)
+			}
+			opts.MVCC = testkeysMVCCReadOptions(ts)
 		default:
 			continue
 		}
@@ -313,6 +328,28 @@ func parseIterOptions(
 	return foundAny, nil
 }
 
+// testkeysMVCCBlockPropertyName is the name of the MVCC block-property
+// collector configured by tests reading testkeys with MVCC reads.
+const testkeysMVCCBlockPropertyName = "test.mvcc"
+
+// decodeTestkeysTimestamp implements MVCCReadOptions.DecodeTimestamp for
+// testkeys suffixes.
+func decodeTestkeysTimestamp(suffix []byte) (uint64, bool) {
+	if len(suffix) == 0 {
+		return 0, false
+	}
+	ts, err := testkeys.ParseSuffix(suffix)
+	return uint64(ts), err == nil
+}
+
+func testkeysMVCCReadOptions(ts uint64) *MVCCReadOptions {
+	return &MVCCReadOptions{
+		ReadTimestamp:     ts,
+		DecodeTimestamp:   decodeTestkeysTimestamp,
+		BlockPropertyName: testkeysMVCCBlockPropertyName,
+	}
+}
+
 func printIterState(
 	b io.Writer, iter *Iterator, validity IterValidityState, printValidityState bool,
 ) {
@@ -441,6 +478,12 @@ func runInternalIterCmd(
 				}
 			}
 			key, value = getKV(iter.SeekPrefixGE(prefix, prefix /* key */, flags))
+		case "seek-prefix-lt":
+			if len(parts) != 3 {
+				return "seek-prefix-lt <prefix> <key>\n"
+			}
+			prefix = []byte(strings.TrimSpace(parts[1]))
+			key, value = getKV(iter.SeekPrefixLT(prefix, []byte(strings.TrimSpace(parts[2])), base.SeekLTFlagsNone))
 		case "seek-lt":
 			if len(parts) != 2 {
 				return "seek-lt <key>\n"
@@ -205,6 +205,28 @@ type CPUWorkPermissionGranter interface {
 	CPUWorkDone(CPUWorkHandle)
 }
 
+// DiskBandwidthGranter may optionally be implemented by a
+// CPUWorkPermissionGranter to also limit the disk bandwidth used by
+// concurrent compactions.
+type DiskBandwidthGranter interface {
+	// GetDiskBandwidthTokens requests tokens for writing approximately the
+	// provided number of bytes to disk. Tokens are requested before starting
+	// an automatic compaction that would run concurrently with other
+	// compactions. If the tokens are not granted, the compaction is not
+	// started, and compactions are reconsidered when the next flush or
+	// compaction completes, or after a short delay, whichever comes first.
+	// Flushes, manual compactions and the first automatic compaction never
+	// request tokens. GetDiskBandwidthTokens is called while holding the DB's
+	// internal mutex and must not block.
+	GetDiskBandwidthTokens(bytes int64) bool
+	// DiskBandwidthTokensUsed is called when a flush or compaction completes,
+	// with the number of tokens granted to it through GetDiskBandwidthTokens
+	// (zero if it did not request tokens) and the number of bytes it wrote to
+	// disk. It is called while holding the DB's internal mutex and must not
+	// block.
+	DiskBandwidthTokensUsed(granted, written int64)
+}
+
 // Use a default implementation for the CPU work granter to avoid excessive nil
 // checks in the code.
 type defaultCPUWorkHandle struct{}
@@ -260,6 +282,11 @@ type DB struct {
 	// The number of bytes available on disk.
 	diskAvailBytes atomic.Uint64
 
+	// kvChecksums is set if new batches and memtables compute and verify
+	// key-value checksums: if Options.KVChecksums is set and the format major
+	// version is at least ExperimentalFormatKVChecksums.
+	kvChecksums atomic.Bool
+
 	cacheID        uint64
 	dirname        string
 	walDirname     string
@@ -269,6 +296,9 @@ type DB struct {
 	merge          Merge
 	split          Split
 	abbreviatedKey AbbreviatedKey
+	// diskBandwidthGranter is Options.Experimental.CPUWorkPermissionGranter if
+	// it implements DiskBandwidthGranter, and nil otherwise.
+	diskBandwidthGranter DiskBandwidthGranter
 	// The threshold for determining when a batch is "large" and will skip being
 	// inserted into a memtable.
 	largeBatchThreshold int
@@ -290,6 +320,10 @@ type DB struct {
 
 	commit *commitPipeline
 
+	// latency records the latencies of foreground operations. See
+	// Metrics.Latency.
+	latency latencyRecorders
+
 	// readState provides access to the state needed for reading without needing
 	// to acquire DB.mu.
 	readState struct {
@@ -319,6 +353,10 @@ type DB struct {
 	// compactionShedulers.Wait() should not be called while the DB.mu is held.
 	compactionSchedulers sync.WaitGroup
 
+	// cacheWarming holds the state of the goroutines that prefetch and dump
+	// the DB's resident blocks. See Options.CacheWarming.
+	cacheWarming cacheWarming
+
 	// The main mutex protecting internal DB state. This mutex encompasses many
 	// fields because those fields need to be accessed and updated atomically. In
 	// particular, the current version, log.*, mem.*, and snapshot list need to
@@ -433,6 +471,15 @@ type DB struct {
 			// The cumulative duration of all completed compactions since Open.
 			// Does not include flushes.
 			duration time.Duration
+			// gcThresholds holds the MVCC GC thresholds set through
+			// SetGCThreshold. It's replaced, never mutated, when updated.
+			gcThresholds gcThresholds
+			// The cumulative size of the keys and values dropped by compactions
+			// because they fell below a GC threshold.
+			gcDroppedBytes uint64
+			// diskBandwidthRetryScheduled is true if compactions are scheduled
+			// to be reconsidered after the DiskBandwidthGranter denied tokens.
+			diskBandwidthRetryScheduled bool
 			// Flush throughput metric.
 			flushWriteThroughput ThroughputMetric
 			// The idle start time for the flush "loop", i.e., when the flushing
@@ -542,6 +589,11 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
+	var startTime time.Time
+	timed := d.timeOperations()
+	if timed {
+		startTime = time.Now()
+	}
 
 	// Grab and reference the current readState. This prevents the underlying
 	// files in the associated version from being deleted if there is a current
@@ -564,6 +616,7 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 		logger:   d.opts.Logger,
 		cmp:      d.cmp,
 		equal:    d.equal,
+		split:    d.split,
 		newIters: d.newIters,
 		snapshot: seqNum,
 		key:      key,
@@ -596,7 +649,22 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 		keyBuf:       buf.keyBuf,
 	}
 
-	if !i.First() {
+	found := i.First()
+	if timed {
+		duration := time.Since(startTime)
+		if d.opts.RecordLatencies {
+			d.latency.get.record(duration)
+		}
+		if d.isSlowOperation(duration) {
+			d.opts.EventListener.SlowOperation(SlowOperationInfo{
+				Op:            "get",
+				Duration:      duration,
+				LevelsVisited: get.levelsVisited,
+				Stats:         get.stats,
+			})
+		}
+	}
+	if !found {
 		err := i.Close()
 		if err != nil {
 			return nil, nil, err
@@ -845,6 +913,9 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 	if batch.db == nil {
 		batch.refreshMemTableSize()
 	}
+	if err := batch.verifyKVChecksums(); err != nil {
+		return err
+	}
 	if int(batch.memTableSize) >= d.largeBatchThreshold {
 		batch.flushable = newFlushableBatch(batch, d.opts.Comparer)
 	}
@@ -853,6 +924,9 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 		// horked at this point.
 		d.opts.Logger.Fatalf("pebble: fatal commit error: %v", err)
 	}
+	if !noSyncWait {
+		d.recordCommitLatency(batch, sync)
+	}
 	// If this is a large batch, we need to clear the batch contents as the
 	// flushable batch may still be present in the flushables queue.
 	//
@@ -1051,7 +1125,10 @@ func (d *DB) newIter(ctx context.Context, batch *Batch, s *Snapshot, o *IterOpti
 	if batch != nil {
 		dbi.batchSeqNum = dbi.batch.nextSeqNum()
 	}
-	return finishInitializingIter(ctx, buf)
+	if d.opts.Tracer != nil {
+		dbi.startIteratorSpan(d.opts.Tracer)
+	}
+	return finishInitializingIter(dbi.ctx, buf)
 }
 
 // finishInitializingIter is a helper for doing the non-trivial initialization
@@ -1061,6 +1138,7 @@ func (d *DB) newIter(ctx context.Context, batch *Batch, s *Snapshot, o *IterOpti
 func finishInitializingIter(ctx context.Context, buf *iterAlloc) *Iterator {
 	// Short-hand.
 	dbi := &buf.dbi
+	dbi.mvcc.init(dbi.opts.MVCC)
 	memtables := dbi.readState.memtables
 	if dbi.opts.OnlyReadGuaranteedDurable {
 		memtables = nil
@@ -1287,6 +1365,10 @@ func (i *Iterator) constructPointIter(
 	if i.opts.RangeKeyMasking.Filter != nil {
 		internalOpts.boundLimitedFilter = &i.rangeKeyMasking
 	}
+	// Sstables are read with the MVCC read timestamp's block-property filter,
+	// if any, in addition to the user-configured filters.
+	levelOpts := i.opts
+	levelOpts.PointKeyFilters = i.mvcc.pointKeyFilters(i.opts.PointKeyFilters)
 
 	// Merging levels and levels from iterAlloc.
 	mlevels := buf.mlevels[:0]
@@ -1366,7 +1448,7 @@ func (i *Iterator) constructPointIter(
 		li := &levels[levelsIndex]
 
 		li.init(
-			ctx, i.opts, i.comparer.Compare, i.comparer.Split, i.newIters, files, level, internalOpts)
+			ctx, levelOpts, i.comparer.Compare, i.comparer.Split, i.newIters, files, level, internalOpts)
 		li.initRangeDel(&mlevels[mlevelsIndex].rangeDelIter)
 		li.initBoundaryContext(&mlevels[mlevelsIndex].levelIterBoundaryContext)
 		li.initCombinedIterState(&i.lazyCombinedIter.combinedIterState)
@@ -1462,6 +1544,17 @@ func (d *DB) NewSnapshot() *Snapshot {
 // or to call Close concurrently with any other DB method. It is not valid
 // to call any of a DB's methods after the DB has been closed.
 func (d *DB) Close() error {
+	if d.closed.Load() == nil {
+		// Stop the cache warming goroutines, which use the table cache, and dump
+		// the resident blocks before the table cache is closed.
+		d.stopCacheWarming()
+		if d.opts.CacheWarming.Enabled && !d.opts.ReadOnly {
+			if err := d.dumpCacheWarming(); err != nil {
+				d.opts.Logger.Infof("pebble: failed to dump cache warming blocks: %v", err)
+			}
+		}
+	}
+
 	// Lock the commit pipeline for the duration of Close. This prevents a race
 	// with makeRoomForWrite. Rotating the WAL in makeRoomForWrite requires
 	// dropping d.mu several times for I/O. If Close only holds d.mu, an
@@ -1507,6 +1600,10 @@ func (d *DB) Close() error {
 		err = errors.Errorf("pebble: %d unexpected in-progress compactions", errors.Safe(n))
 	}
 	err = firstError(err, d.mu.formatVers.marker.Close())
+	// Detach the secondary cache before closing the table cache, which evicts
+	// the DB's tables from the block cache, so that they remain in the
+	// secondary cache.
+	_ = d.opts.Cache.SetSecondary(d.cacheID, nil)
 	err = firstError(err, d.tableCache.close())
 	if !d.opts.ReadOnly {
 		err = firstError(err, d.mu.log.Close())
@@ -1791,6 +1888,7 @@ func (d *DB) Metrics() *Metrics {
 	metrics.Compact.NumInProgress = int64(d.mu.compact.compactingCount)
 	metrics.Compact.MarkedFiles = vers.Stats.MarkedForCompaction
 	metrics.Compact.Duration = d.mu.compact.duration
+	metrics.Compact.GCDroppedBytes = d.mu.compact.gcDroppedBytes
 	for c := range d.mu.compact.inProgress {
 		if c.kind != compactionKindFlush {
 			metrics.Compact.Duration += d.timeNow().Sub(c.beganAt)
@@ -1865,8 +1963,13 @@ func (d *DB) Metrics() *Metrics {
 	d.mu.Unlock()
 
 	metrics.BlockCache = d.opts.Cache.Metrics()
-	metrics.TableCache, metrics.Filter = d.tableCache.metrics()
+	if d.opts.SecondaryCache != nil {
+		metrics.SecondaryCache = d.opts.SecondaryCache.Metrics()
+	}
+	d.cacheWarming.metrics(metrics)
+	metrics.TableCache, metrics.Filter, metrics.LevelFilter = d.tableCache.metrics()
 	metrics.TableIters = int64(d.tableCache.iterCount())
+	metrics.Latency = d.latency.metrics()
 	metrics.Uptime = d.timeNow().Sub(d.openedAt)
 	return metrics
 }
@@ -2057,9 +2160,10 @@ func (d *DB) newMemTable(logNum FileNum, logSeqNum uint64) (*memTable, *flushabl
 	releaseAccountingReservation := d.opts.Cache.Reserve(size)
 
 	mem := newMemTable(memTableOptions{
-		Options:   d.opts,
-		arenaBuf:  manual.New(int(size)),
-		logSeqNum: logSeqNum,
+		Options:     d.opts,
+		arenaBuf:    manual.New(int(size)),
+		logSeqNum:   logSeqNum,
+		kvChecksums: d.kvChecksums.Load(),
 	})
 
 	// Note: this is a no-op if invariants are disabled or race is enabled.
@@ -2358,11 +2462,7 @@ func (d *DB) recycleWAL() (newLogNum FileNum, prevLogSize uint64) {
 	}
 
 	d.mu.log.queue = append(d.mu.log.queue, fileInfo{fileNum: newLogNum.DiskFileNum(), fileSize: newLogSize})
-	d.mu.log.LogWriter = record.NewLogWriter(newLogFile, newLogNum, record.LogWriterConfig{
-		WALFsyncLatency:    d.mu.log.metrics.fsyncLatency,
-		WALMinSyncInterval: d.opts.WALMinSyncInterval,
-		QueueSemChan:       d.commit.logSyncQSem,
-	})
+	d.mu.log.LogWriter = record.NewLogWriter(newLogFile, newLogNum, d.logWriterConfig(d.mu.formatVers.vers))
 	if d.mu.log.registerLogWriterForTesting != nil {
 		d.mu.log.registerLogWriterForTesting(d.mu.log.LogWriter)
 	}
@@ -2370,6 +2470,22 @@ func (d *DB) recycleWAL() (newLogNum FileNum, prevLogSize uint64) {
 	return
 }
 
+// logWriterConfig returns the configuration of the LogWriter of a new WAL
+// written by a DB at the format major version vers. WAL records are only
+// compressed or transformed at versions that can read them.
+func (d *DB) logWriterConfig(vers FormatMajorVersion) record.LogWriterConfig {
+	c := record.LogWriterConfig{
+		WALFsyncLatency:    d.mu.log.metrics.fsyncLatency,
+		WALMinSyncInterval: d.opts.WALMinSyncInterval,
+		QueueSemChan:       d.commit.logSyncQSem,
+	}
+	if vers >= ExperimentalFormatWALTransforms {
+		c.Compression = d.opts.WALCompression
+		c.Transform = d.opts.WALTransform
+	}
+	return c
+}
+
 func (d *DB) getEarliestUnflushedSeqNumLocked() uint64 {
 	seqNum := InternalKeySeqNumMax
 	for i := range d.mu.mem.queue {
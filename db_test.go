@@ -21,6 +21,7 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/invariants"
+	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
@@ -1290,6 +1291,70 @@ func TestSSTables(t *testing.T) {
 	}
 }
 
+func TestKVChecksums(t *testing.T) {
+	for _, fmv := range []FormatMajorVersion{ExperimentalFormatKVChecksums - 1, ExperimentalFormatKVChecksums} {
+		t.Run(fmv.String(), func(t *testing.T) {
+			d, err := Open("", &Options{
+				FS:                 vfs.NewMem(),
+				Comparer:           testkeys.Comparer,
+				FormatMajorVersion: fmv,
+				KVChecksums:        true,
+			})
+			require.NoError(t, err)
+			defer func() { require.NoError(t, d.Close()) }()
+
+			for i := 0; i < 2; i++ {
+				b := d.NewBatch()
+				for j := 0; j < 100; j++ {
+					key := []byte(fmt.Sprintf("key-%03d", j))
+					switch j % 5 {
+					case 0:
+						require.NoError(t, b.Set(key, []byte(fmt.Sprintf("value-%d", i)), nil))
+					case 1:
+						require.NoError(t, b.Merge(key, []byte(fmt.Sprintf("value-%d", i)), nil))
+					case 2:
+						require.NoError(t, b.Delete(key, nil))
+					case 3:
+						require.NoError(t, b.DeleteSized(key, 10, nil))
+					case 4:
+						require.NoError(t, b.SingleDelete(key, nil))
+					}
+				}
+				require.NoError(t, b.DeleteRange([]byte("key-010"), []byte("key-020"), nil))
+				require.NoError(t, b.RangeKeySet([]byte("key-030"), []byte("key-040"), nil, []byte("v"), nil))
+				require.NoError(t, d.Apply(b, nil))
+				require.NoError(t, d.Flush())
+			}
+			require.NoError(t, d.Compact([]byte("a"), []byte("z"), false /* parallelize */))
+
+			iter := d.NewIter(nil)
+			var n int
+			for iter.First(); iter.Valid(); iter.Next() {
+				n++
+			}
+			require.NoError(t, iter.Close())
+			require.NotZero(t, n)
+			v, closer, err := d.Get([]byte("key-000"))
+			require.NoError(t, err)
+			require.Equal(t, "value-1", string(v))
+			require.NoError(t, closer.Close())
+
+			// Tables only store the checksums of their keys at a format major
+			// version that supports it.
+			tableInfos, err := d.SSTables(WithProperties())
+			require.NoError(t, err)
+			var tables int
+			for _, levelTables := range tableInfos {
+				for _, info := range levelTables {
+					tables++
+					require.Equal(t, fmv >= ExperimentalFormatKVChecksums, info.Properties.KVChecksums)
+				}
+			}
+			require.NotZero(t, tables)
+		})
+	}
+}
+
 type testTracer struct {
 	enabledOnlyForNonBackgroundContext bool
 	buf                                strings.Builder
@@ -34,6 +34,12 @@ func (c *errorIter) SeekLT(key []byte, flags base.SeekLTFlags) (*InternalKey, ba
 	return nil, base.LazyValue{}
 }
 
+func (c *errorIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	return nil, base.LazyValue{}
+}
+
 func (c *errorIter) First() (*InternalKey, base.LazyValue) {
 	return nil, base.LazyValue{}
 }
@@ -506,6 +506,11 @@ type EventListener struct {
 	// TableValidated is invoked after validation runs on an sstable.
 	TableValidated func(TableValidatedInfo)
 
+	// SlowOperation is invoked after a foreground operation took at least
+	// Options.SlowOperationThreshold. It's invoked synchronously by the
+	// operation.
+	SlowOperation func(SlowOperationInfo)
+
 	// WALCreated is invoked after a WAL has been created.
 	WALCreated func(WALCreateInfo)
 
@@ -572,6 +577,9 @@ func (l *EventListener) EnsureDefaults(logger Logger) {
 	if l.TableValidated == nil {
 		l.TableValidated = func(validated TableValidatedInfo) {}
 	}
+	if l.SlowOperation == nil {
+		l.SlowOperation = func(info SlowOperationInfo) {}
+	}
 	if l.WALCreated == nil {
 		l.WALCreated = func(info WALCreateInfo) {}
 	}
@@ -636,6 +644,9 @@ func MakeLoggingEventListener(logger Logger) EventListener {
 		TableValidated: func(info TableValidatedInfo) {
 			logger.Infof("%s", info)
 		},
+		SlowOperation: func(info SlowOperationInfo) {
+			logger.Infof("%s", info)
+		},
 		WALCreated: func(info WALCreateInfo) {
 			logger.Infof("%s", info)
 		},
@@ -712,6 +723,10 @@ func TeeEventListener(a, b EventListener) EventListener {
 			a.TableValidated(info)
 			b.TableValidated(info)
 		},
+		SlowOperation: func(info SlowOperationInfo) {
+			a.SlowOperation(info)
+			b.SlowOperation(info)
+		},
 		WALCreated: func(info WALCreateInfo) {
 			a.WALCreated(info)
 			b.WALCreated(info)
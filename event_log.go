@@ -0,0 +1,614 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// EventLogVersion is the version of the schema of the records written by
+// MakeJSONEventListener. Fields may be added to EventRecord without changing
+// the version; the version changes only if the meaning of an existing field
+// changes or a field is removed.
+const EventLogVersion = 1
+
+// The names of the events written by MakeJSONEventListener, one for every
+// EventListener callback.
+const (
+	EventBackgroundError  = "background_error"
+	EventCompactionBegin  = "compaction_begin"
+	EventCompactionEnd    = "compaction_end"
+	EventDiskSlow         = "disk_slow"
+	EventFlushBegin       = "flush_begin"
+	EventFlushEnd         = "flush_end"
+	EventFormatUpgrade    = "format_upgrade"
+	EventManifestCreated  = "manifest_created"
+	EventManifestDeleted  = "manifest_deleted"
+	EventTableCreated     = "table_created"
+	EventTableDeleted     = "table_deleted"
+	EventTableIngested    = "table_ingested"
+	EventTableStatsLoaded = "table_stats_loaded"
+	EventTableValidated   = "table_validated"
+	EventSlowOperation    = "slow_operation"
+	EventWALCreated       = "wal_created"
+	EventWALDeleted       = "wal_deleted"
+	EventWriteStallBegin  = "write_stall_begin"
+	EventWriteStallEnd    = "write_stall_end"
+)
+
+// EventTable describes an sstable in an EventRecord.
+type EventTable struct {
+	Level   int    `json:"level"`
+	FileNum uint64 `json:"file_num"`
+	Size    uint64 `json:"size"`
+}
+
+// EventCommitStats holds the durations of the phases of a slow commit in an
+// EventRecord. See BatchCommitStats.
+type EventCommitStats struct {
+	SemaphoreWaitNanos       int64 `json:"semaphore_wait_ns"`
+	WALQueueWaitNanos        int64 `json:"wal_queue_wait_ns"`
+	MemTableWriteStallNanos  int64 `json:"memtable_write_stall_ns"`
+	L0ReadAmpWriteStallNanos int64 `json:"l0_read_amp_write_stall_ns"`
+	WALRotationNanos         int64 `json:"wal_rotation_ns"`
+	WALWriteNanos            int64 `json:"wal_write_ns"`
+	MemTableApplyNanos       int64 `json:"memtable_apply_ns"`
+	CommitWaitNanos          int64 `json:"commit_wait_ns"`
+}
+
+// EventRecord is a line of the JSON event log written by
+// MakeJSONEventListener. Every record has a version, time and event; the other
+// fields are set by the events to which they apply, and omitted otherwise.
+type EventRecord struct {
+	Version int       `json:"v"`
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+
+	// JobID is the ID of the job of a flush, compaction, ingestion or file
+	// creation or deletion.
+	JobID int `json:"job_id,omitempty"`
+	// Reason is the reason for a flush, compaction, table creation or write
+	// stall.
+	Reason string `json:"reason,omitempty"`
+	// Input is the input tables of a compaction, or the tables of an
+	// ingestion.
+	Input []EventTable `json:"input,omitempty"`
+	// InputMemtables is the number of memtables, or ingested tables, flushed
+	// by a flush.
+	InputMemtables int `json:"input_memtables,omitempty"`
+	// OutputLevel is the output level of a compaction.
+	OutputLevel *int `json:"output_level,omitempty"`
+	// Output is the output tables of a flush or compaction.
+	Output []EventTable `json:"output,omitempty"`
+	// Ingest is set for flushes of ingested tables.
+	Ingest bool `json:"ingest,omitempty"`
+	// DurationNanos is the duration of a flush or compaction, excluding its
+	// installation, of a slow operation, or of a slow disk operation so far.
+	DurationNanos int64 `json:"duration_ns,omitempty"`
+	// TotalDurationNanos is the duration of a flush or compaction including
+	// its installation.
+	TotalDurationNanos int64 `json:"total_duration_ns,omitempty"`
+	// Path is the path of the file of a file creation or deletion, or of a
+	// slow disk operation.
+	Path string `json:"path,omitempty"`
+	// FileNum is the file number of the file of a file creation, deletion or
+	// validation.
+	FileNum uint64 `json:"file_num,omitempty"`
+	// RecycledFileNum is the file number of the WAL recycled by a WAL
+	// creation.
+	RecycledFileNum uint64 `json:"recycled_file_num,omitempty"`
+	// GlobalSeqNum is the sequence number assigned to the tables of an
+	// ingestion.
+	GlobalSeqNum uint64 `json:"global_seq_num,omitempty"`
+	// FormatVersion is the new format major version of a format upgrade.
+	FormatVersion uint64 `json:"format_version,omitempty"`
+	// Op is the operation of a slow operation or slow disk operation.
+	Op string `json:"op,omitempty"`
+	// WriteSize is the size of the write of a slow disk operation.
+	WriteSize int `json:"write_size,omitempty"`
+	// LevelsVisited is the number of levels searched by a slow read.
+	LevelsVisited int `json:"levels_visited,omitempty"`
+	// BlockCount is the number of blocks loaded by a slow read, and
+	// BlockCacheMisses the number of those that missed the block cache.
+	BlockCount       uint64 `json:"block_count,omitempty"`
+	BlockCacheMisses uint64 `json:"block_cache_misses,omitempty"`
+	// BlockBytes is the size of the blocks loaded by a slow read, and
+	// BlockBytesInCache the size of those found in the block cache.
+	BlockBytes        uint64 `json:"block_bytes,omitempty"`
+	BlockBytesInCache uint64 `json:"block_bytes_in_cache,omitempty"`
+	// BlockReadDurationNanos is the time a slow read spent reading blocks
+	// that missed the block cache.
+	BlockReadDurationNanos int64 `json:"block_read_duration_ns,omitempty"`
+	// PointCount is the number of point keys returned by the internal
+	// iterators of a slow read.
+	PointCount uint64 `json:"point_count,omitempty"`
+	// Commit is the breakdown of the duration of a slow commit.
+	Commit *EventCommitStats `json:"commit,omitempty"`
+	// Error is the error of a failed operation, or of a background error.
+	Error string `json:"error,omitempty"`
+}
+
+// BytesIn returns the total size of the record's input tables.
+func (r *EventRecord) BytesIn() uint64 {
+	return eventTablesSize(r.Input)
+}
+
+// BytesOut returns the total size of the record's output tables.
+func (r *EventRecord) BytesOut() uint64 {
+	return eventTablesSize(r.Output)
+}
+
+func eventTablesSize(tables []EventTable) uint64 {
+	var size uint64
+	for i := range tables {
+		size += tables[i].Size
+	}
+	return size
+}
+
+func makeEventTables(level int, tables []TableInfo) []EventTable {
+	t := make([]EventTable, len(tables))
+	for i := range tables {
+		t[i] = EventTable{Level: level, FileNum: uint64(tables[i].FileNum), Size: tables[i].Size}
+	}
+	return t
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// MakeJSONEventListener creates an EventListener that writes every event to w
+// as a line of JSON holding an EventRecord. Writes to w are serialized, and
+// errors writing to w are ignored. As with MakeLoggingEventListener, the
+// events are written synchronously by the DB, sometimes while holding DB.mu,
+// so w should not block; see RotatingFileWriter, which writes the events to a
+// set of files in the background.
+func MakeJSONEventListener(w io.Writer) EventListener {
+	return makeJSONEventListener(w, time.Now)
+}
+
+func makeJSONEventListener(w io.Writer, now func() time.Time) EventListener {
+	var mu sync.Mutex
+	write := func(r EventRecord) {
+		r.Version = EventLogVersion
+		r.Time = now().UTC()
+		b, err := json.Marshal(&r)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = w.Write(append(b, '\n'))
+	}
+	compaction := func(event string, info CompactionInfo) {
+		r := EventRecord{
+			Event:              event,
+			JobID:              info.JobID,
+			Reason:             info.Reason,
+			OutputLevel:        &info.Output.Level,
+			Output:             makeEventTables(info.Output.Level, info.Output.Tables),
+			DurationNanos:      int64(info.Duration),
+			TotalDurationNanos: int64(info.TotalDuration),
+			Error:              errorString(info.Err),
+		}
+		for _, l := range info.Input {
+			r.Input = append(r.Input, makeEventTables(l.Level, l.Tables)...)
+		}
+		write(r)
+	}
+	flush := func(event string, info FlushInfo) {
+		r := EventRecord{
+			Event:              event,
+			JobID:              info.JobID,
+			Reason:             info.Reason,
+			InputMemtables:     info.Input,
+			Ingest:             info.Ingest,
+			DurationNanos:      int64(info.Duration),
+			TotalDurationNanos: int64(info.TotalDuration),
+			Error:              errorString(info.Err),
+		}
+		r.Output = makeEventTables(0, info.Output)
+		for i := range info.IngestLevels {
+			if i < len(r.Output) {
+				r.Output[i].Level = info.IngestLevels[i]
+			}
+		}
+		write(r)
+	}
+
+	return EventListener{
+		BackgroundError: func(err error) {
+			write(EventRecord{Event: EventBackgroundError, Error: err.Error()})
+		},
+		CompactionBegin: func(info CompactionInfo) {
+			compaction(EventCompactionBegin, info)
+		},
+		CompactionEnd: func(info CompactionInfo) {
+			compaction(EventCompactionEnd, info)
+		},
+		DiskSlow: func(info DiskSlowInfo) {
+			write(EventRecord{
+				Event:         EventDiskSlow,
+				Path:          info.Path,
+				Op:            info.OpType.String(),
+				WriteSize:     info.WriteSize,
+				DurationNanos: int64(info.Duration),
+			})
+		},
+		FlushBegin: func(info FlushInfo) {
+			flush(EventFlushBegin, info)
+		},
+		FlushEnd: func(info FlushInfo) {
+			flush(EventFlushEnd, info)
+		},
+		FormatUpgrade: func(v FormatMajorVersion) {
+			write(EventRecord{Event: EventFormatUpgrade, FormatVersion: uint64(v)})
+		},
+		ManifestCreated: func(info ManifestCreateInfo) {
+			write(EventRecord{
+				Event:   EventManifestCreated,
+				JobID:   info.JobID,
+				Path:    info.Path,
+				FileNum: uint64(info.FileNum),
+				Error:   errorString(info.Err),
+			})
+		},
+		ManifestDeleted: func(info ManifestDeleteInfo) {
+			write(EventRecord{
+				Event:   EventManifestDeleted,
+				JobID:   info.JobID,
+				Path:    info.Path,
+				FileNum: uint64(info.FileNum),
+				Error:   errorString(info.Err),
+			})
+		},
+		TableCreated: func(info TableCreateInfo) {
+			write(EventRecord{
+				Event:   EventTableCreated,
+				JobID:   info.JobID,
+				Reason:  info.Reason,
+				Path:    info.Path,
+				FileNum: uint64(info.FileNum),
+			})
+		},
+		TableDeleted: func(info TableDeleteInfo) {
+			write(EventRecord{
+				Event:   EventTableDeleted,
+				JobID:   info.JobID,
+				Path:    info.Path,
+				FileNum: uint64(info.FileNum),
+				Error:   errorString(info.Err),
+			})
+		},
+		TableIngested: func(info TableIngestInfo) {
+			r := EventRecord{
+				Event:        EventTableIngested,
+				JobID:        info.JobID,
+				Ingest:       info.flushable,
+				GlobalSeqNum: info.GlobalSeqNum,
+				Error:        errorString(info.Err),
+			}
+			for i := range info.Tables {
+				t := &info.Tables[i]
+				r.Input = append(r.Input, EventTable{
+					Level: t.Level, FileNum: uint64(t.FileNum), Size: t.Size,
+				})
+			}
+			write(r)
+		},
+		TableStatsLoaded: func(info TableStatsInfo) {
+			write(EventRecord{Event: EventTableStatsLoaded, JobID: info.JobID})
+		},
+		TableValidated: func(info TableValidatedInfo) {
+			write(EventRecord{
+				Event:   EventTableValidated,
+				JobID:   info.JobID,
+				FileNum: uint64(info.Meta.FileNum),
+			})
+		},
+		SlowOperation: func(info SlowOperationInfo) {
+			r := EventRecord{
+				Event:         EventSlowOperation,
+				Op:            info.Op,
+				DurationNanos: int64(info.Duration),
+			}
+			if info.Op == "commit" {
+				c := &info.Commit
+				r.Commit = &EventCommitStats{
+					SemaphoreWaitNanos:       int64(c.SemaphoreWaitDuration),
+					WALQueueWaitNanos:        int64(c.WALQueueWaitDuration),
+					MemTableWriteStallNanos:  int64(c.MemTableWriteStallDuration),
+					L0ReadAmpWriteStallNanos: int64(c.L0ReadAmpWriteStallDuration),
+					WALRotationNanos:         int64(c.WALRotationDuration),
+					WALWriteNanos:            int64(c.WALWriteDuration),
+					MemTableApplyNanos:       int64(c.MemTableApplyDuration),
+					CommitWaitNanos:          int64(c.CommitWaitDuration),
+				}
+			} else {
+				r.LevelsVisited = info.LevelsVisited
+				r.BlockCount = info.Stats.BlockCount
+				r.BlockCacheMisses = info.Stats.BlockCacheMisses
+				r.BlockBytes = info.Stats.BlockBytes
+				r.BlockBytesInCache = info.Stats.BlockBytesInCache
+				r.BlockReadDurationNanos = int64(info.Stats.BlockReadDuration)
+				r.PointCount = info.Stats.PointCount
+			}
+			write(r)
+		},
+		WALCreated: func(info WALCreateInfo) {
+			write(EventRecord{
+				Event:           EventWALCreated,
+				JobID:           info.JobID,
+				Path:            info.Path,
+				FileNum:         uint64(info.FileNum),
+				RecycledFileNum: uint64(info.RecycledFileNum),
+				Error:           errorString(info.Err),
+			})
+		},
+		WALDeleted: func(info WALDeleteInfo) {
+			write(EventRecord{
+				Event:   EventWALDeleted,
+				JobID:   info.JobID,
+				Path:    info.Path,
+				FileNum: uint64(info.FileNum),
+				Error:   errorString(info.Err),
+			})
+		},
+		WriteStallBegin: func(info WriteStallBeginInfo) {
+			write(EventRecord{Event: EventWriteStallBegin, Reason: info.Reason})
+		},
+		WriteStallEnd: func() {
+			write(EventRecord{Event: EventWriteStallEnd})
+		},
+	}
+}
+
+// RotatingFileWriterOptions holds the parameters of a RotatingFileWriter.
+type RotatingFileWriterOptions struct {
+	// Prefix is the prefix of the names of the files. The default is
+	// "events".
+	Prefix string
+	// MaxFileSize is the size after which the writer switches to a new file.
+	// The default is 64 MB.
+	MaxFileSize int64
+	// MaxFiles is the number of files retained, including the current file.
+	// When the writer switches to a new file, the oldest files are removed.
+	// The default is 10.
+	MaxFiles int
+	// MaxPendingBytes bounds the size of the writes buffered while they wait
+	// to be written to the files. Writes beyond it are dropped. The default is
+	// 4 MB.
+	MaxPendingBytes int64
+}
+
+// RotatingFileWriter is an io.WriteCloser which writes to a sequence of files
+// in a directory, named <prefix>-<sequence number>.jsonl, switching to a new
+// file once the current one exceeds a size and removing the oldest files. A
+// write is never split across files, so a RotatingFileWriter may be passed to
+// MakeJSONEventListener. It's safe for concurrent use.
+//
+// Writes are buffered and written to the files by a background goroutine,
+// which also creates, syncs and removes the files, so that Write doesn't block
+// on the filesystem; event listener callbacks may be called with DB.mu held.
+// Errors writing to the files are returned by Close.
+type RotatingFileWriter struct {
+	fs   vfs.FS
+	dir  string
+	opts RotatingFileWriterOptions
+	done chan struct{}
+
+	mu struct {
+		sync.Mutex
+		cond sync.Cond
+		// pending holds the writes waiting to be written to the files, and
+		// pendingBytes their size.
+		pending      [][]byte
+		pendingBytes int64
+		closing      bool
+		// err is the first error writing to the files.
+		err error
+	}
+
+	// The current file and the sequence numbers of the existing files, in
+	// increasing order, the last of which is the current file's. They're only
+	// used by the background goroutine, once it's started.
+	f     vfs.File
+	size  int64
+	files []uint64
+}
+
+// NewRotatingFileWriter returns a RotatingFileWriter writing to files in dir,
+// which is created if it doesn't exist. Existing files are retained, subject
+// to MaxFiles, and the writer starts a new file after them.
+func NewRotatingFileWriter(
+	fs vfs.FS, dir string, opts RotatingFileWriterOptions,
+) (*RotatingFileWriter, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = "events"
+	}
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = 64 << 20
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = 10
+	}
+	if opts.MaxPendingBytes <= 0 {
+		opts.MaxPendingBytes = 4 << 20
+	}
+	if err := fs.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	ls, err := fs.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	w := &RotatingFileWriter{fs: fs, dir: dir, opts: opts, done: make(chan struct{})}
+	w.mu.cond.L = &w.mu.Mutex
+	for _, name := range ls {
+		if seq, ok := w.parseFilename(name); ok {
+			w.files = append(w.files, seq)
+		}
+	}
+	sort.Slice(w.files, func(i, j int) bool { return w.files[i] < w.files[j] })
+	if err := w.rotate(); err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *RotatingFileWriter) filename(seq uint64) string {
+	return w.fs.PathJoin(w.dir, fmt.Sprintf("%s-%06d.jsonl", w.opts.Prefix, seq))
+}
+
+func (w *RotatingFileWriter) parseFilename(name string) (uint64, bool) {
+	if !strings.HasPrefix(name, w.opts.Prefix+"-") || !strings.HasSuffix(name, ".jsonl") {
+		return 0, false
+	}
+	s := strings.TrimSuffix(strings.TrimPrefix(name, w.opts.Prefix+"-"), ".jsonl")
+	seq, err := strconv.ParseUint(s, 10, 64)
+	return seq, err == nil
+}
+
+// run writes the pending writes to the files until the writer is closed.
+func (w *RotatingFileWriter) run() {
+	defer close(w.done)
+	for {
+		w.mu.Lock()
+		for len(w.mu.pending) == 0 && !w.mu.closing {
+			w.mu.cond.Wait()
+		}
+		pending, closing := w.mu.pending, w.mu.closing
+		w.mu.pending, w.mu.pendingBytes = nil, 0
+		w.mu.Unlock()
+
+		var err error
+		for _, p := range pending {
+			if err = w.write(p); err != nil {
+				break
+			}
+		}
+		if closing {
+			err = errors.CombineErrors(err, w.closeFile())
+		}
+		if err != nil {
+			w.mu.Lock()
+			if w.mu.err == nil {
+				w.mu.err = err
+			}
+			w.mu.Unlock()
+		}
+		if closing {
+			return
+		}
+	}
+}
+
+// write writes p to the current file, or to a new file if p would take the
+// current file beyond MaxFileSize.
+func (w *RotatingFileWriter) write(p []byte) error {
+	if w.f == nil {
+		// A previous rotation failed.
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	if w.size > 0 && w.size+int64(len(p)) > w.opts.MaxFileSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return err
+}
+
+// closeFile syncs and closes the current file, if any.
+func (w *RotatingFileWriter) closeFile() error {
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Sync()
+	err = errors.CombineErrors(err, w.f.Close())
+	w.f = nil
+	return err
+}
+
+// rotate closes the current file, if any, creates the next one and removes
+// the oldest files beyond MaxFiles.
+func (w *RotatingFileWriter) rotate() error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	var seq uint64 = 1
+	if n := len(w.files); n > 0 {
+		seq = w.files[n-1] + 1
+	}
+	f, err := w.fs.Create(w.filename(seq))
+	if err != nil {
+		return err
+	}
+	w.f = f
+	w.size = 0
+	w.files = append(w.files, seq)
+	for len(w.files) > w.opts.MaxFiles {
+		if err := w.fs.Remove(w.filename(w.files[0])); err != nil && !oserror.IsNotExist(err) {
+			return err
+		}
+		w.files = w.files[1:]
+	}
+	return nil
+}
+
+// Write implements io.Writer. It copies p to be written to the files in the
+// background, and returns an error if the writer is closed or if the pending
+// writes exceed MaxPendingBytes, in which case p is dropped.
+func (w *RotatingFileWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.mu.closing {
+		return 0, errors.New("pebble: rotating file writer is closed")
+	}
+	if w.mu.pendingBytes+int64(len(p)) > w.opts.MaxPendingBytes {
+		return 0, errors.New("pebble: rotating file writer is falling behind")
+	}
+	w.mu.pending = append(w.mu.pending, append([]byte(nil), p...))
+	w.mu.pendingBytes += int64(len(p))
+	w.mu.cond.Signal()
+	return len(p), nil
+}
+
+// Close writes the pending writes, syncs and closes the current file, and
+// returns the first error writing to the files, if any.
+func (w *RotatingFileWriter) Close() error {
+	w.mu.Lock()
+	if w.mu.closing {
+		w.mu.Unlock()
+		<-w.done
+		return nil
+	}
+	w.mu.closing = true
+	w.mu.cond.Signal()
+	w.mu.Unlock()
+	<-w.done
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.mu.err
+}
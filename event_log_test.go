@@ -0,0 +1,207 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONEventListener(t *testing.T) {
+	// Every callback is set.
+	l := MakeJSONEventListener(&bytes.Buffer{})
+	v := reflect.ValueOf(l)
+	for i := 0; i < v.NumField(); i++ {
+		require.False(t, v.Field(i).IsNil(), "%s", v.Type().Field(i).Name)
+	}
+
+	var buf bytes.Buffer
+	now := time.Unix(1680000000, 0)
+	l = makeJSONEventListener(&buf, func() time.Time { return now })
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem, EventListener: &l})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("c"), false /* parallelize */))
+
+	f, err := mem.Create("ext")
+	require.NoError(t, err)
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{
+		TableFormat: d.FormatMajorVersion().MaxTableFormat(),
+	})
+	require.NoError(t, w.Set([]byte("d"), []byte("3")))
+	require.NoError(t, w.Close())
+	require.NoError(t, d.Ingest([]string{"ext"}))
+	l.BackgroundError(errors.New("boom"))
+	l.WriteStallBegin(WriteStallBeginInfo{Reason: "memtable count limit reached"})
+	l.WriteStallEnd()
+	l.SlowOperation(SlowOperationInfo{
+		Op:            "get",
+		Duration:      time.Second,
+		LevelsVisited: 3,
+		Stats: InternalIteratorStats{
+			BlockCount:        4,
+			BlockCacheMisses:  2,
+			BlockBytes:        4096,
+			BlockBytesInCache: 2048,
+			BlockReadDuration: time.Millisecond,
+			PointCount:        5,
+		},
+	})
+	l.SlowOperation(SlowOperationInfo{
+		Op:       "commit",
+		Duration: time.Second,
+		Commit:   BatchCommitStats{WALWriteDuration: time.Millisecond, CommitWaitDuration: 2 * time.Millisecond},
+	})
+	require.NoError(t, d.Close())
+
+	byEvent := make(map[string][]EventRecord)
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var r EventRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r), "%s", scanner.Text())
+		require.Equal(t, EventLogVersion, r.Version)
+		require.True(t, r.Time.Equal(now))
+		byEvent[r.Event] = append(byEvent[r.Event], r)
+	}
+	require.NoError(t, scanner.Err())
+
+	var events []string
+	for e := range byEvent {
+		events = append(events, e)
+	}
+	sort.Strings(events)
+	require.Equal(t, []string{
+		EventBackgroundError, EventCompactionBegin, EventCompactionEnd,
+		EventFlushBegin, EventFlushEnd,
+		EventManifestCreated, EventSlowOperation, EventTableCreated, EventTableDeleted,
+		EventTableIngested, EventTableStatsLoaded, EventWALCreated,
+		EventWriteStallBegin, EventWriteStallEnd,
+	}, events)
+
+	flushes := byEvent[EventFlushEnd]
+	require.Len(t, flushes, 2)
+	for _, r := range flushes {
+		require.Equal(t, 1, r.InputMemtables)
+		require.Len(t, r.Output, 1)
+		require.Equal(t, 0, r.Output[0].Level)
+		require.NotZero(t, r.BytesOut())
+	}
+
+	c := byEvent[EventCompactionEnd][0]
+	require.Len(t, c.Input, 2)
+	require.Equal(t, []uint64{flushes[0].Output[0].FileNum, flushes[1].Output[0].FileNum},
+		[]uint64{c.Input[0].FileNum, c.Input[1].FileNum})
+	require.Equal(t, 6, *c.OutputLevel)
+	require.Len(t, c.Output, 1)
+	require.Equal(t, 6, c.Output[0].Level)
+	require.Equal(t, flushes[0].BytesOut()+flushes[1].BytesOut(), c.BytesIn())
+
+	ingest := byEvent[EventTableIngested][0]
+	require.Len(t, ingest.Input, 1)
+	require.Equal(t, 6, ingest.Input[0].Level)
+	require.NotZero(t, ingest.GlobalSeqNum)
+
+	require.Equal(t, "boom", byEvent[EventBackgroundError][0].Error)
+	require.Equal(t, "memtable count limit reached", byEvent[EventWriteStallBegin][0].Reason)
+
+	slow := byEvent[EventSlowOperation]
+	require.Len(t, slow, 2)
+	require.Equal(t, EventRecord{
+		Version:                EventLogVersion,
+		Time:                   now.UTC(),
+		Event:                  EventSlowOperation,
+		Op:                     "get",
+		DurationNanos:          int64(time.Second),
+		LevelsVisited:          3,
+		BlockCount:             4,
+		BlockCacheMisses:       2,
+		BlockBytes:             4096,
+		BlockBytesInCache:      2048,
+		BlockReadDurationNanos: int64(time.Millisecond),
+		PointCount:             5,
+	}, slow[0])
+	require.Nil(t, slow[0].Commit)
+	require.Equal(t, &EventCommitStats{
+		WALWriteNanos:   int64(time.Millisecond),
+		CommitWaitNanos: int64(2 * time.Millisecond),
+	}, slow[1].Commit)
+	require.Zero(t, slow[1].BlockCount)
+}
+
+func TestRotatingFileWriter(t *testing.T) {
+	mem := vfs.NewMem()
+	list := func() []string {
+		ls, err := mem.List("events")
+		require.NoError(t, err)
+		sort.Strings(ls)
+		return ls
+	}
+	read := func(name string) string {
+		f, err := mem.Open(mem.PathJoin("events", name))
+		require.NoError(t, err)
+		defer f.Close()
+		var buf bytes.Buffer
+		_, err = buf.ReadFrom(f)
+		require.NoError(t, err)
+		return buf.String()
+	}
+
+	opts := RotatingFileWriterOptions{MaxFileSize: 10, MaxFiles: 3}
+	w, err := NewRotatingFileWriter(mem, "events", opts)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		// A line is never split across files, even when larger than
+		// MaxFileSize.
+		_, err := fmt.Fprintf(w, "line %d\n", i)
+		require.NoError(t, err)
+	}
+	_, err = w.Write([]byte("a line longer than the maximum size\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	_, err = w.Write([]byte("x"))
+	require.Error(t, err)
+	require.NoError(t, w.Close())
+
+	require.Equal(t, []string{"events-000004.jsonl", "events-000005.jsonl", "events-000006.jsonl"}, list())
+	require.Equal(t, "line 3\n", read("events-000004.jsonl"))
+	require.Equal(t, "line 4\n", read("events-000005.jsonl"))
+	require.Equal(t, "a line longer than the maximum size\n", read("events-000006.jsonl"))
+
+	// A new writer continues the sequence, retaining the existing files
+	// subject to MaxFiles.
+	require.NoError(t, mem.MkdirAll("events/other", 0755))
+	w, err = NewRotatingFileWriter(mem, "events", opts)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("line 6\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, []string{"events-000005.jsonl", "events-000006.jsonl", "events-000007.jsonl", "other"}, list())
+	require.Equal(t, "line 6\n", read("events-000007.jsonl"))
+
+	// Writes beyond MaxPendingBytes are dropped rather than blocking the
+	// caller.
+	opts.MaxPendingBytes = 1
+	w, err = NewRotatingFileWriter(mem, "events", opts)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("too long\n"))
+	require.Error(t, err)
+	require.NoError(t, w.Close())
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/manifest"
 	"github.com/cockroachdb/pebble/sstable"
@@ -180,6 +181,8 @@ func validateExternalIterOpts(iterOpts *IterOptions) error {
 		return errors.Errorf("pebble: external iterator: OnlyReadGuaranteedDurable unsupported")
 	case iterOpts.UseL6Filters:
 		return errors.Errorf("pebble: external iterator: UseL6Filters unsupported")
+	case iterOpts.MVCC != nil:
+		return errors.Errorf("pebble: external iterator: MVCC unsupported")
 	}
 	return nil
 }
@@ -196,6 +199,9 @@ func createExternalPointIter(ctx context.Context, it *Iterator) (internalIterato
 	} else if it.pointIter != nil {
 		return it.pointIter, nil
 	}
+	if it.opts.DisableCacheFill {
+		ctx = sstable.WithDataBlockCachePriority(ctx, cache.NoFillPriority)
+	}
 	mlevels := it.alloc.mlevels[:0]
 
 	if len(it.externalReaders) > cap(mlevels) {
@@ -473,6 +479,12 @@ func (s *simpleLevelIter) SeekLT(
 	panic("unimplemented")
 }
 
+func (s *simpleLevelIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	panic("unimplemented")
+}
+
 func (s *simpleLevelIter) First() (*base.InternalKey, base.LazyValue) {
 	if s.err != nil {
 		return nil, base.LazyValue{}
@@ -157,6 +157,36 @@ const (
 	// kind may be committed through batch applications or ingests.
 	ExperimentalFormatDeleteSized
 
+	// ExperimentalFormatZstdDictionaries is a format major version that adds
+	// support for sstables with trained zstd dictionaries, used when
+	// configured with ZstdDictionaryCompression. Sstables are written with
+	// TableFormatPebblev5.
+	ExperimentalFormatZstdDictionaries
+
+	// ExperimentalFormatLZ4Compression is a format major version that adds
+	// support for sstables with LZ4 compressed blocks, used when configured
+	// with LZ4Compression. Sstables are written with TableFormatPebblev6.
+	ExperimentalFormatLZ4Compression
+
+	// ExperimentalFormatWALTransforms is a format major version that adds
+	// support for WAL records that are compressed, when configured with
+	// Options.WALCompression, or encoded by Options.WALTransform. Such records
+	// are written in chunk types unknown to earlier versions.
+	ExperimentalFormatWALTransforms
+
+	// ExperimentalFormatTableEncryption is a format major version that adds
+	// support for sstables whose blocks are encrypted, when configured with
+	// Options.TableEncryptionKey. Earlier versions would read the encrypted
+	// blocks as corrupt. Sstables are written with TableFormatPebblev7.
+	ExperimentalFormatTableEncryption
+
+	// ExperimentalFormatKVChecksums is a format major version that adds
+	// support for key-value checksums, when configured with
+	// Options.KVChecksums. Batches, memtables and sstables store a checksum of
+	// each point key and value, which reads verify. Sstables are written with
+	// TableFormatPebblev8.
+	ExperimentalFormatKVChecksums
+
 	// internalFormatNewest holds the newest format major version, including
 	// experimental ones excluded from the exported FormatNewest constant until
 	// they've stabilized. Used in tests.
@@ -184,6 +214,14 @@ func (v FormatMajorVersion) MaxTableFormat() sstable.TableFormat {
 		return sstable.TableFormatPebblev3
 	case ExperimentalFormatDeleteSized:
 		return sstable.TableFormatPebblev4
+	case ExperimentalFormatZstdDictionaries:
+		return sstable.TableFormatPebblev5
+	case ExperimentalFormatLZ4Compression, ExperimentalFormatWALTransforms:
+		return sstable.TableFormatPebblev6
+	case ExperimentalFormatTableEncryption:
+		return sstable.TableFormatPebblev7
+	case ExperimentalFormatKVChecksums:
+		return sstable.TableFormatPebblev8
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
 	}
@@ -201,7 +239,9 @@ func (v FormatMajorVersion) MinTableFormat() sstable.TableFormat {
 	case FormatMinTableFormatPebblev1, FormatPrePebblev1Marked,
 		FormatUnusedPrePebblev1MarkedCompacted, FormatSSTableValueBlocks,
 		FormatFlushableIngest, FormatPrePebblev1MarkedCompacted,
-		ExperimentalFormatDeleteSized:
+		ExperimentalFormatDeleteSized, ExperimentalFormatZstdDictionaries,
+		ExperimentalFormatLZ4Compression, ExperimentalFormatWALTransforms, ExperimentalFormatTableEncryption,
+		ExperimentalFormatKVChecksums:
 		return sstable.TableFormatPebblev1
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
@@ -337,6 +377,21 @@ var formatMajorVersionMigrations = map[FormatMajorVersion]func(*DB) error{
 	ExperimentalFormatDeleteSized: func(d *DB) error {
 		return d.finalizeFormatVersUpgrade(ExperimentalFormatDeleteSized)
 	},
+	ExperimentalFormatZstdDictionaries: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(ExperimentalFormatZstdDictionaries)
+	},
+	ExperimentalFormatLZ4Compression: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(ExperimentalFormatLZ4Compression)
+	},
+	ExperimentalFormatWALTransforms: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(ExperimentalFormatWALTransforms)
+	},
+	ExperimentalFormatTableEncryption: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(ExperimentalFormatTableEncryption)
+	},
+	ExperimentalFormatKVChecksums: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(ExperimentalFormatKVChecksums)
+	},
 }
 
 const formatVersionMarkerName = `format-version`
@@ -440,6 +495,7 @@ func (d *DB) finalizeFormatVersUpgrade(formatVers FormatMajorVersion) error {
 		return err
 	}
 	d.mu.formatVers.vers = formatVers
+	d.kvChecksums.Store(d.opts.KVChecksums && formatVers >= ExperimentalFormatKVChecksums)
 	d.opts.EventListener.FormatUpgrade(formatVers)
 	return nil
 }
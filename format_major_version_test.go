@@ -64,6 +64,14 @@ func TestRatchetFormat(t *testing.T) {
 	require.Equal(t, FormatPrePebblev1MarkedCompacted, d.FormatMajorVersion())
 	require.NoError(t, d.RatchetFormatMajorVersion(ExperimentalFormatDeleteSized))
 	require.Equal(t, ExperimentalFormatDeleteSized, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(ExperimentalFormatZstdDictionaries))
+	require.Equal(t, ExperimentalFormatZstdDictionaries, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(ExperimentalFormatWALTransforms))
+	require.Equal(t, ExperimentalFormatWALTransforms, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(ExperimentalFormatTableEncryption))
+	require.Equal(t, ExperimentalFormatTableEncryption, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(ExperimentalFormatKVChecksums))
+	require.Equal(t, ExperimentalFormatKVChecksums, d.FormatMajorVersion())
 
 	require.NoError(t, d.Close())
 
@@ -228,6 +236,11 @@ func TestFormatMajorVersions_TableFormat(t *testing.T) {
 		FormatFlushableIngest:                  {sstable.TableFormatPebblev1, sstable.TableFormatPebblev3},
 		FormatPrePebblev1MarkedCompacted:       {sstable.TableFormatPebblev1, sstable.TableFormatPebblev3},
 		ExperimentalFormatDeleteSized:          {sstable.TableFormatPebblev1, sstable.TableFormatPebblev4},
+		ExperimentalFormatZstdDictionaries:     {sstable.TableFormatPebblev1, sstable.TableFormatPebblev5},
+		ExperimentalFormatLZ4Compression:       {sstable.TableFormatPebblev1, sstable.TableFormatPebblev6},
+		ExperimentalFormatWALTransforms:        {sstable.TableFormatPebblev1, sstable.TableFormatPebblev6},
+		ExperimentalFormatTableEncryption:      {sstable.TableFormatPebblev1, sstable.TableFormatPebblev7},
+		ExperimentalFormatKVChecksums:          {sstable.TableFormatPebblev1, sstable.TableFormatPebblev8},
 	}
 
 	// Valid versions.
@@ -21,6 +21,7 @@ type getIter struct {
 	logger       Logger
 	cmp          Compare
 	equal        Equal
+	split        Split
 	newIters     tableNewIters
 	snapshot     uint64
 	key          []byte
@@ -36,6 +37,10 @@ type getIter struct {
 	iterKey      *InternalKey
 	iterValue    base.LazyValue
 	err          error
+	// stats accumulates the stats of the iterators over the levels, and
+	// levelsVisited counts the memtables, L0 sublevels and levels searched.
+	stats         base.InternalIteratorStats
+	levelsVisited int
 }
 
 // TODO(sumeer): CockroachDB code doesn't use getIter, but, for completeness,
@@ -62,6 +67,12 @@ func (g *getIter) SeekLT(key []byte, flags base.SeekLTFlags) (*InternalKey, base
 	panic("pebble: SeekLT unimplemented")
 }
 
+func (g *getIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	panic("pebble: SeekPrefixLT unimplemented")
+}
+
 func (g *getIter) First() (*InternalKey, base.LazyValue) {
 	return g.Next()
 }
@@ -149,7 +160,15 @@ func (g *getIter) Next() (*InternalKey, base.LazyValue) {
 			g.iter = m.newIter(nil)
 			g.rangeDelIter = m.newRangeDelIter(nil)
 			g.mem = g.mem[:n-1]
-			g.iterKey, g.iterValue = g.iter.SeekGE(g.key, base.SeekGEFlagsNone)
+			g.levelsVisited++
+			// A prefix seek allows memtables partitioned by prefix (see
+			// HashSkiplistMemTable) to only search the key's partition.
+			if g.split != nil {
+				prefix := g.key[:g.split(g.key)]
+				g.iterKey, g.iterValue = g.iter.SeekPrefixGE(prefix, g.key, base.SeekGEFlagsNone)
+			} else {
+				g.iterKey, g.iterValue = g.iter.SeekGE(g.key, base.SeekGEFlagsNone)
+			}
 			continue
 		}
 
@@ -160,7 +179,8 @@ func (g *getIter) Next() (*InternalKey, base.LazyValue) {
 				g.l0 = g.l0[:n-1]
 				iterOpts := IterOptions{logger: g.logger}
 				g.levelIter.init(context.Background(), iterOpts, g.cmp, nil /* split */, g.newIters,
-					files, manifest.L0Sublevel(n), internalIterOpts{})
+					files, manifest.L0Sublevel(n), internalIterOpts{stats: &g.stats})
+				g.levelsVisited++
 				g.levelIter.initRangeDel(&g.rangeDelIter)
 				g.iter = &g.levelIter
 				g.iterKey, g.iterValue = g.iter.SeekGE(g.key, base.SeekGEFlagsNone)
@@ -179,9 +199,10 @@ func (g *getIter) Next() (*InternalKey, base.LazyValue) {
 
 		iterOpts := IterOptions{logger: g.logger}
 		g.levelIter.init(context.Background(), iterOpts, g.cmp, nil /* split */, g.newIters,
-			g.version.Levels[g.level].Iter(), manifest.Level(g.level), internalIterOpts{})
+			g.version.Levels[g.level].Iter(), manifest.Level(g.level), internalIterOpts{stats: &g.stats})
 		g.levelIter.initRangeDel(&g.rangeDelIter)
 		g.level++
+		g.levelsVisited++
 		g.iter = &g.levelIter
 		g.iterKey, g.iterValue = g.iter.SeekGE(g.key, base.SeekGEFlagsNone)
 	}
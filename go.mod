@@ -12,6 +12,7 @@ require (
 	github.com/guptarohit/asciigraph v0.5.5
 	github.com/klauspost/compress v1.15.15
 	github.com/kr/pretty v0.2.1
+	github.com/pierrec/lz4/v4 v4.1.17
 	github.com/pmezard/go-difflib v1.0.0
 	github.com/prometheus/client_golang v1.12.0
 	github.com/prometheus/client_model v0.2.1-0.20210607210712-147c58e9608a
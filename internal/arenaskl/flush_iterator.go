@@ -52,12 +52,23 @@ func (it *flushIterator) SeekLT(
 	panic("pebble: SeekLT unimplemented")
 }
 
-// First seeks position at the first entry in list. Returns the key and value
-// if the iterator is pointing at a valid entry, and (nil, nil) otherwise. Note
-// that First only checks the upper bound. It is up to the caller to ensure
-// that key is greater than or equal to the lower bound.
+func (it *flushIterator) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	panic("pebble: SeekPrefixLT unimplemented")
+}
+
+// First seeks position at the first entry in list that is greater than or
+// equal to the lower bound, if any. Returns the key and value if the iterator
+// is pointing at a valid entry, and (nil, nil) otherwise.
 func (it *flushIterator) First() (*base.InternalKey, base.LazyValue) {
-	key, val := it.Iterator.First()
+	var key *base.InternalKey
+	var val base.LazyValue
+	if it.lower != nil {
+		key, val = it.Iterator.SeekGE(it.lower, base.SeekGEFlagsNone)
+	} else {
+		key, val = it.Iterator.First()
+	}
 	if key == nil {
 		return nil, base.LazyValue{}
 	}
@@ -75,8 +86,12 @@ func (it *flushIterator) Next() (*base.InternalKey, base.LazyValue) {
 		return nil, base.LazyValue{}
 	}
 	it.decodeKey()
+	if it.upper != nil && it.list.cmp(it.upper, it.key.UserKey) <= 0 {
+		it.nd = it.list.tail
+		return nil, base.LazyValue{}
+	}
 	*it.bytesIterated += uint64(it.nd.allocSize)
-	return &it.key, base.MakeInPlaceValue(it.value())
+	return it.current()
 }
 
 func (it *flushIterator) NextPrefix(succKey []byte) (*base.InternalKey, base.LazyValue) {
@@ -43,10 +43,14 @@ type Iterator struct {
 	key   base.InternalKey
 	lower []byte
 	upper []byte
+	// err is set if the key-value checksum of an entry didn't match.
+	err error
 }
 
-// Iterator implements the base.InternalIterator interface.
+// Iterator implements the base.InternalIterator and base.KVChecksumIterator
+// interfaces.
 var _ base.InternalIterator = (*Iterator)(nil)
+var _ base.KVChecksumIterator = (*Iterator)(nil)
 
 var iterPool = sync.Pool{
 	New: func() interface{} {
@@ -60,6 +64,7 @@ func (it *Iterator) Close() error {
 	it.nd = nil
 	it.lower = nil
 	it.upper = nil
+	it.err = nil
 	iterPool.Put(it)
 	return nil
 }
@@ -70,7 +75,16 @@ func (it *Iterator) String() string {
 
 // Error returns any accumulated error.
 func (it *Iterator) Error() error {
-	return nil
+	return it.err
+}
+
+// KVChecksum implements base.KVChecksumIterator. The checksum is known if the
+// skiplist stores key-value checksums.
+func (it *Iterator) KVChecksum() (base.KVChecksum, bool) {
+	if !it.list.kvChecksums {
+		return 0, false
+	}
+	return it.nd.getKVChecksum(it.list.arena), true
 }
 
 // SeekGE moves the iterator to the first entry whose key is greater than or
@@ -99,7 +113,7 @@ func (it *Iterator) SeekGE(key []byte, flags base.SeekGEFlags) (*base.InternalKe
 			less = it.list.cmp(it.key.UserKey, key) < 0
 		}
 		if !less {
-			return &it.key, base.MakeInPlaceValue(it.value())
+			return it.current()
 		}
 	}
 	_, it.nd, _ = it.seekForBaseSplice(key)
@@ -111,7 +125,7 @@ func (it *Iterator) SeekGE(key []byte, flags base.SeekGEFlags) (*base.InternalKe
 		it.nd = it.list.tail
 		return nil, base.LazyValue{}
 	}
-	return &it.key, base.MakeInPlaceValue(it.value())
+	return it.current()
 }
 
 // SeekPrefixGE moves the iterator to the first entry whose key is greater than
@@ -140,7 +154,16 @@ func (it *Iterator) SeekLT(key []byte, flags base.SeekLTFlags) (*base.InternalKe
 		it.nd = it.list.head
 		return nil, base.LazyValue{}
 	}
-	return &it.key, base.MakeInPlaceValue(it.value())
+	return it.current()
+}
+
+// SeekPrefixLT moves the iterator to the last entry whose key is less than the
+// given key. This method is equivalent to SeekLT and is provided so that an
+// arenaskl.Iterator implements the internal/base.InternalIterator interface.
+func (it *Iterator) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	return it.SeekLT(key, flags)
 }
 
 // First seeks position at the first entry in list. Returns the key and value
@@ -157,7 +180,7 @@ func (it *Iterator) First() (*base.InternalKey, base.LazyValue) {
 		it.nd = it.list.tail
 		return nil, base.LazyValue{}
 	}
-	return &it.key, base.MakeInPlaceValue(it.value())
+	return it.current()
 }
 
 // Last seeks position at the last entry in list. Returns the key and value if
@@ -174,7 +197,7 @@ func (it *Iterator) Last() (*base.InternalKey, base.LazyValue) {
 		it.nd = it.list.head
 		return nil, base.LazyValue{}
 	}
-	return &it.key, base.MakeInPlaceValue(it.value())
+	return it.current()
 }
 
 // Next advances to the next position. Returns the key and value if the
@@ -191,7 +214,7 @@ func (it *Iterator) Next() (*base.InternalKey, base.LazyValue) {
 		it.nd = it.list.tail
 		return nil, base.LazyValue{}
 	}
-	return &it.key, base.MakeInPlaceValue(it.value())
+	return it.current()
 }
 
 // NextPrefix advances to the next position with a new prefix. Returns the key
@@ -213,7 +236,21 @@ func (it *Iterator) Prev() (*base.InternalKey, base.LazyValue) {
 		it.nd = it.list.head
 		return nil, base.LazyValue{}
 	}
-	return &it.key, base.MakeInPlaceValue(it.value())
+	return it.current()
+}
+
+// current returns the key and value at the current position. If the skiplist
+// stores key-value checksums, it verifies the entry's checksum, and if it
+// doesn't match, sets it.err and returns nil.
+func (it *Iterator) current() (*base.InternalKey, base.LazyValue) {
+	value := it.value()
+	if it.list.kvChecksums {
+		if err := it.nd.verifyKVChecksum(it.list.arena, it.key, value); err != nil {
+			it.err = err
+			return nil, base.LazyValue{}
+		}
+	}
+	return &it.key, base.MakeInPlaceValue(value)
 }
 
 // value returns the value at the current position.
@@ -18,6 +18,7 @@
 package arenaskl
 
 import (
+	"encoding/binary"
 	"math"
 	"sync/atomic"
 
@@ -59,8 +60,15 @@ type node struct {
 	tower [maxHeight]links
 }
 
+// KVChecksumSize is the size of the key-value checksum stored after the value
+// of each node of a Skiplist or Vector with key-value checksums enabled. It
+// isn't included in MaxNodeSize.
+const KVChecksumSize = 8
+
+// newNode allocates a node holding the key and value. If checksum is non-nil,
+// it's stored after the value (see KVChecksumSize).
 func newNode(
-	arena *Arena, height uint32, key base.InternalKey, value []byte,
+	arena *Arena, height uint32, key base.InternalKey, value []byte, checksum *base.KVChecksum,
 ) (nd *node, err error) {
 	if height < 1 || height > maxHeight {
 		panic("height cannot be less than one or greater than the max height")
@@ -77,13 +85,21 @@ func newNode(
 		panic("combined key and value size is too large")
 	}
 
-	nd, err = newRawNode(arena, height, uint32(keySize), uint32(valueSize))
+	allocValueSize := uint32(valueSize)
+	if checksum != nil {
+		allocValueSize += KVChecksumSize
+	}
+	nd, err = newRawNode(arena, height, uint32(keySize), allocValueSize)
 	if err != nil {
 		return
 	}
+	nd.valueSize = uint32(valueSize)
 
 	key.Encode(nd.getKeyBytes(arena))
 	copy(nd.getValue(arena), value)
+	if checksum != nil {
+		binary.LittleEndian.PutUint64(nd.getKVChecksumBytes(arena), uint64(*checksum))
+	}
 	return
 }
 
@@ -114,6 +130,28 @@ func (n *node) getValue(arena *Arena) []byte {
 	return arena.getBytes(n.keyOffset+n.keySize, uint32(n.valueSize))
 }
 
+// getKVChecksumBytes returns the bytes holding the key-value checksum of a
+// node of a Skiplist or Vector with key-value checksums enabled.
+func (n *node) getKVChecksumBytes(arena *Arena) []byte {
+	return arena.getBytes(n.keyOffset+n.keySize+n.valueSize, KVChecksumSize)
+}
+
+// getKVChecksum returns the key-value checksum of a node of a Skiplist or
+// Vector with key-value checksums enabled.
+func (n *node) getKVChecksum(arena *Arena) base.KVChecksum {
+	return base.KVChecksum(binary.LittleEndian.Uint64(n.getKVChecksumBytes(arena)))
+}
+
+// verifyKVChecksum verifies the key-value checksum of a node of a Skiplist or
+// Vector with key-value checksums enabled, whose decoded key and value are
+// given.
+func (n *node) verifyKVChecksum(arena *Arena, key base.InternalKey, value []byte) error {
+	if n.getKVChecksum(arena) != base.MakeKVChecksum(key.Kind(), key.UserKey, value) {
+		return base.KVChecksumMismatchError(key, "memtable")
+	}
+	return nil
+}
+
 func (n *node) nextOffset(h int) uint32 {
 	return atomic.LoadUint32(&n.tower[h].nextOffset)
 }
@@ -82,6 +82,10 @@ type Skiplist struct {
 	tail   *node
 	height uint32 // Current height. 1 <= height <= maxHeight. CAS.
 
+	// kvChecksums is set if each node stores the key-value checksum of its
+	// entry, which iterators verify. See EnableKVChecksums.
+	kvChecksums bool
+
 	// If set to true by tests, then extra delays are added to make it easier to
 	// detect unusual race conditions.
 	testing bool
@@ -95,7 +99,17 @@ type Inserter struct {
 
 // Add TODO(peter)
 func (ins *Inserter) Add(list *Skiplist, key base.InternalKey, value []byte) error {
-	return list.addInternal(key, value, ins)
+	return list.addInternal(key, value, nil /* checksum */, ins)
+}
+
+// AddWithKVChecksum is like Add, but if the skiplist stores key-value
+// checksums, it stores the given checksum of the key and value, rather than
+// computing it, so that corruption of the key or value since the checksum
+// was computed is detected when the entry is read.
+func (ins *Inserter) AddWithKVChecksum(
+	list *Skiplist, key base.InternalKey, value []byte, checksum base.KVChecksum,
+) error {
+	return list.addInternal(key, value, &checksum, ins)
 }
 
 var (
@@ -153,6 +167,15 @@ func (s *Skiplist) Reset(arena *Arena, cmp base.Compare) {
 	}
 }
 
+// EnableKVChecksums configures the skiplist to store the key-value checksum
+// (see base.KVChecksum) of each entry along with it, and its iterators to
+// verify the checksums of the entries they return, surfacing mismatches as
+// corruption errors through their Error methods. It must be called before any
+// entries are added, and is undone by Reset.
+func (s *Skiplist) EnableKVChecksums() {
+	s.kvChecksums = true
+}
+
 // Height returns the height of the highest tower within any of the nodes that
 // have ever been allocated as part of this skiplist.
 func (s *Skiplist) Height() uint32 { return atomic.LoadUint32(&s.height) }
@@ -168,10 +191,12 @@ func (s *Skiplist) Size() uint32 { return s.arena.Size() }
 // Add returns ErrArenaFull.
 func (s *Skiplist) Add(key base.InternalKey, value []byte) error {
 	var ins Inserter
-	return s.addInternal(key, value, &ins)
+	return s.addInternal(key, value, nil /* checksum */, &ins)
 }
 
-func (s *Skiplist) addInternal(key base.InternalKey, value []byte, ins *Inserter) error {
+func (s *Skiplist) addInternal(
+	key base.InternalKey, value []byte, checksum *base.KVChecksum, ins *Inserter,
+) error {
 	if s.findSplice(key, ins) {
 		// Found a matching node, but handle case where it's been deleted.
 		return ErrRecordExists
@@ -184,7 +209,7 @@ func (s *Skiplist) addInternal(key base.InternalKey, value []byte, ins *Inserter
 		runtime.Gosched()
 	}
 
-	nd, height, err := s.newNode(key, value)
+	nd, height, err := s.newNode(key, value, checksum)
 	if err != nil {
 		return err
 	}
@@ -316,10 +341,16 @@ func (s *Skiplist) NewFlushIter(bytesFlushed *uint64) base.InternalIterator {
 }
 
 func (s *Skiplist) newNode(
-	key base.InternalKey, value []byte,
+	key base.InternalKey, value []byte, checksum *base.KVChecksum,
 ) (nd *node, height uint32, err error) {
+	if !s.kvChecksums {
+		checksum = nil
+	} else if checksum == nil {
+		c := base.MakeKVChecksum(key.Kind(), key.UserKey, value)
+		checksum = &c
+	}
 	height = s.randomHeight()
-	nd, err = newNode(s.arena, height, key, value)
+	nd, err = newNode(s.arena, height, key, value, checksum)
 	if err != nil {
 		return
 	}
@@ -27,6 +27,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/rand"
@@ -988,3 +989,77 @@ func TestInvalidInternalKeyDecoding(t *testing.T) {
 	require.Nil(t, it.key.UserKey)
 	require.Equal(t, uint64(base.InternalKeyKindInvalid), it.key.Trailer)
 }
+
+func TestKVChecksums(t *testing.T) {
+	a := newArena(arenaSize)
+	l := NewSkiplist(a, bytes.Compare)
+	l.EnableKVChecksums()
+	var ins Inserter
+	for i := 0; i < 10; i++ {
+		key := makeIntKey(i)
+		// Entries added with a checksum store it, while those added without
+		// one have it computed.
+		if i%2 == 0 {
+			checksum := base.MakeKVChecksum(key.Kind(), key.UserKey, makeValue(i))
+			require.NoError(t, ins.AddWithKVChecksum(l, key, makeValue(i), checksum))
+		} else {
+			require.NoError(t, l.Add(key, makeValue(i)))
+		}
+	}
+	// A checksum that doesn't match the entry it was added with is detected.
+	require.NoError(t, ins.AddWithKVChecksum(l, makeIntKey(10), makeValue(10), 0))
+
+	it := l.NewIter(nil, nil)
+	var n int
+	for key, val := it.First(); key != nil; key, val = it.Next() {
+		// The iterator returns the stored checksum of each entry.
+		checksum, ok := it.KVChecksum()
+		require.True(t, ok)
+		require.Equal(t, base.MakeKVChecksum(key.Kind(), key.UserKey, val.InPlaceValue()), checksum)
+		n++
+	}
+	require.Equal(t, 10, n)
+	require.True(t, errors.Is(it.Error(), base.ErrCorruption))
+	require.NoError(t, it.Close())
+
+	// Corrupt the value of an entry in the arena.
+	it = l.NewIter(nil, nil)
+	key, _ := it.SeekGE(makeIntKey(3).UserKey, base.SeekGEFlagsNone)
+	require.NotNil(t, key)
+	require.NoError(t, it.Error())
+	it.value()[0] ^= 1
+	require.NoError(t, it.Close())
+
+	for _, pos := range []func(it *Iterator) (*base.InternalKey, base.LazyValue){
+		func(it *Iterator) (*base.InternalKey, base.LazyValue) {
+			return it.SeekGE(makeIntKey(3).UserKey, base.SeekGEFlagsNone)
+		},
+		func(it *Iterator) (*base.InternalKey, base.LazyValue) {
+			return it.SeekLT(makeIntKey(4).UserKey, base.SeekLTFlagsNone)
+		},
+	} {
+		it = l.NewIter(nil, nil)
+		key, _ = pos(it)
+		require.Nil(t, key)
+		require.True(t, errors.Is(it.Error(), base.ErrCorruption))
+		require.Contains(t, it.Error().Error(), "key-value checksum mismatch")
+		require.NoError(t, it.Close())
+	}
+
+	// Flushes detect the corruption too.
+	var bytesFlushed uint64
+	fit := l.NewFlushIter(&bytesFlushed)
+	for key, _ := fit.First(); key != nil; key, _ = fit.Next() {
+	}
+	require.True(t, errors.Is(fit.Error(), base.ErrCorruption))
+
+	// Entries in skiplists without checksums don't use additional space.
+	l = NewSkiplist(newArena(arenaSize), bytes.Compare)
+	ins = Inserter{}
+	require.NoError(t, ins.AddWithKVChecksum(l, makeIntKey(0), nil, 0))
+	it = l.NewIter(nil, nil)
+	key, _ = it.First()
+	require.NotNil(t, key)
+	require.Equal(t, uint32(0), it.nd.valueSize)
+	require.NoError(t, it.Error())
+}
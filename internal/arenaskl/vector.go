@@ -0,0 +1,365 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package arenaskl
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+	"unsafe"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// Vector is an append-only vector of entries allocated from an arena. Unlike
+// a Skiplist, adding an entry to a Vector doesn't require finding its
+// position: the entries are only sorted, into an array, when the Vector is
+// iterated over. This makes a Vector well suited to bulk loads which aren't
+// read until they're flushed, and poorly suited to workloads that interleave
+// writes and reads, since every read after a write sorts the new entries.
+//
+// Add may be called concurrently with itself and with iteration. The entries
+// are stored in the same node format as a Skiplist's, so MaxNodeSize bounds
+// the space an entry uses in the arena.
+type Vector struct {
+	arena *Arena
+	cmp   base.Compare
+	// kvChecksums is set if each node stores the key-value checksum of its
+	// entry, which iterators verify. See EnableKVChecksums.
+	kvChecksums bool
+
+	// sortMu serializes calls to sort, which sorts and merges without holding
+	// mu so that it doesn't block Add.
+	sortMu sync.Mutex
+
+	mu struct {
+		sync.Mutex
+		// unsorted holds the offsets of the nodes added since the vector was
+		// last sorted, in the order they were added.
+		unsorted []uint32
+		// sorted holds the offsets of the nodes sorted by key. It is replaced
+		// rather than modified when more nodes are sorted, so that iterators
+		// can keep using it.
+		sorted []uint32
+		// merging is the number of offsets held by an in-progress sort, in the
+		// nodes it took from unsorted and in the array it's merging them into.
+		merging int
+	}
+}
+
+// VectorIndexEntrySize bounds the number of bytes per entry used by the index
+// of a Vector, which is allocated outside the arena: an offset in the unsorted
+// slice, which may have twice the capacity it needs, and in the sorted array,
+// which is copied when more entries are sorted into it.
+const VectorIndexEntrySize = 16
+
+// NewVector constructs a new, empty vector. All nodes, keys, and values in the
+// vector will be allocated from the given arena.
+func NewVector(arena *Arena, cmp base.Compare) *Vector {
+	return &Vector{arena: arena, cmp: cmp}
+}
+
+// Arena returns the arena backing this vector.
+func (v *Vector) Arena() *Arena { return v.arena }
+
+// EnableKVChecksums configures the vector to store and verify key-value
+// checksums, as Skiplist.EnableKVChecksums does. It must be called before any
+// entries are added.
+func (v *Vector) EnableKVChecksums() {
+	v.kvChecksums = true
+}
+
+// Add appends a new entry. If there isn't enough room in the arena, then Add
+// returns ErrArenaFull. Unlike Skiplist.Add, Add doesn't detect entries with
+// the same key: the first entry added with a key shadows the others.
+func (v *Vector) Add(key base.InternalKey, value []byte) error {
+	return v.add(key, value, nil /* checksum */)
+}
+
+// AddWithKVChecksum is like Add, but stores the given checksum of the key and
+// value if the vector stores key-value checksums, as
+// Inserter.AddWithKVChecksum does.
+func (v *Vector) AddWithKVChecksum(
+	key base.InternalKey, value []byte, checksum base.KVChecksum,
+) error {
+	return v.add(key, value, &checksum)
+}
+
+func (v *Vector) add(key base.InternalKey, value []byte, checksum *base.KVChecksum) error {
+	if !v.kvChecksums {
+		checksum = nil
+	} else if checksum == nil {
+		c := base.MakeKVChecksum(key.Kind(), key.UserKey, value)
+		checksum = &c
+	}
+	nd, err := newNode(v.arena, 1, key, value, checksum)
+	if err != nil {
+		return err
+	}
+	offset := v.arena.getPointerOffset(unsafe.Pointer(nd))
+	v.mu.Lock()
+	v.mu.unsorted = append(v.mu.unsorted, offset)
+	v.mu.Unlock()
+	return nil
+}
+
+// NewIter returns a new VectorIterator over the entries added before the
+// call. The lower and upper bounds are checked as by Skiplist.NewIter.
+func (v *Vector) NewIter(lower, upper []byte) *VectorIterator {
+	return &VectorIterator{
+		vec:   v,
+		nodes: v.sort(),
+		index: -1,
+		lower: lower,
+		upper: upper,
+	}
+}
+
+// NewFlushIter returns a new VectorIterator which, like Skiplist.NewFlushIter,
+// adds the allocated size of each node it visits to *bytesFlushed.
+func (v *Vector) NewFlushIter(bytesFlushed *uint64) base.InternalIterator {
+	it := v.NewIter(nil, nil)
+	it.bytesIterated = bytesFlushed
+	return it
+}
+
+// IndexSize returns the number of bytes used by the index of the vector,
+// which unlike its entries is allocated outside the arena.
+func (v *Vector) IndexSize() uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return 4 * uint64(cap(v.mu.unsorted)+cap(v.mu.sorted)+v.mu.merging)
+}
+
+// sort sorts the nodes added since the last call into the sorted array, and
+// returns the array. Only taking the new nodes holds v.mu, so that concurrent
+// calls to Add aren't blocked by the sort.
+func (v *Vector) sort() []uint32 {
+	v.sortMu.Lock()
+	defer v.sortMu.Unlock()
+
+	v.mu.Lock()
+	added := v.mu.unsorted
+	prev := v.mu.sorted
+	if len(added) == 0 {
+		v.mu.Unlock()
+		return prev
+	}
+	v.mu.unsorted = nil
+	v.mu.merging = cap(added) + len(prev) + len(added)
+	v.mu.Unlock()
+
+	// A stable sort keeps the first entry added with a key first.
+	sort.SliceStable(added, func(i, j int) bool {
+		return v.compare(added[i], added[j]) < 0
+	})
+	sorted := make([]uint32, 0, len(prev)+len(added))
+	for len(prev) > 0 || len(added) > 0 {
+		var offset uint32
+		if len(added) == 0 || (len(prev) > 0 && v.compare(prev[0], added[0]) <= 0) {
+			offset, prev = prev[0], prev[1:]
+		} else {
+			offset, added = added[0], added[1:]
+		}
+		if n := len(sorted); n > 0 && v.compare(sorted[n-1], offset) == 0 {
+			continue
+		}
+		sorted = append(sorted, offset)
+	}
+
+	v.mu.Lock()
+	v.mu.sorted = sorted
+	v.mu.merging = 0
+	v.mu.Unlock()
+	return sorted
+}
+
+func (v *Vector) compare(a, b uint32) int {
+	return base.InternalCompare(v.cmp, v.key(a), v.key(b))
+}
+
+func (v *Vector) node(offset uint32) *node {
+	return (*node)(v.arena.getPointer(offset))
+}
+
+func (v *Vector) key(offset uint32) base.InternalKey {
+	nd := v.node(offset)
+	b := v.arena.getBytes(nd.keyOffset, nd.keySize)
+	l := len(b) - 8
+	if l < 0 {
+		return base.InternalKey{Trailer: uint64(base.InternalKeyKindInvalid)}
+	}
+	return base.InternalKey{UserKey: b[:l:l], Trailer: binary.LittleEndian.Uint64(b[l:])}
+}
+
+// VectorIterator is an iterator over the entries of a Vector that were added
+// before the iterator was created.
+type VectorIterator struct {
+	vec   *Vector
+	nodes []uint32
+	index int
+	key   base.InternalKey
+	lower []byte
+	upper []byte
+	// bytesIterated, if set, is incremented by the allocated size of each node
+	// visited by First and Next.
+	bytesIterated *uint64
+	// err is set if the key-value checksum of an entry didn't match.
+	err error
+}
+
+// VectorIterator implements the base.InternalIterator and
+// base.KVChecksumIterator interfaces.
+var _ base.InternalIterator = (*VectorIterator)(nil)
+var _ base.KVChecksumIterator = (*VectorIterator)(nil)
+
+func (it *VectorIterator) String() string {
+	return "memtable"
+}
+
+// SeekGE moves the iterator to the first entry whose key is greater than or
+// equal to the given key. Note that SeekGE only checks the upper bound.
+func (it *VectorIterator) SeekGE(
+	key []byte, flags base.SeekGEFlags,
+) (*base.InternalKey, base.LazyValue) {
+	ikey := base.MakeSearchKey(key)
+	it.index = sort.Search(len(it.nodes), func(i int) bool {
+		return base.InternalCompare(it.vec.cmp, it.vec.key(it.nodes[i]), ikey) >= 0
+	})
+	return it.forward()
+}
+
+// SeekPrefixGE is equivalent to SeekGE.
+func (it *VectorIterator) SeekPrefixGE(
+	prefix, key []byte, flags base.SeekGEFlags,
+) (*base.InternalKey, base.LazyValue) {
+	return it.SeekGE(key, flags)
+}
+
+// SeekLT moves the iterator to the last entry whose key is less than the given
+// key. Note that SeekLT only checks the lower bound.
+func (it *VectorIterator) SeekLT(
+	key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	ikey := base.MakeSearchKey(key)
+	it.index = sort.Search(len(it.nodes), func(i int) bool {
+		return base.InternalCompare(it.vec.cmp, it.vec.key(it.nodes[i]), ikey) >= 0
+	}) - 1
+	return it.backward()
+}
+
+// SeekPrefixLT is equivalent to SeekLT.
+func (it *VectorIterator) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	return it.SeekLT(key, flags)
+}
+
+// First moves the iterator to the first entry that is greater than or equal
+// to the lower bound, if any.
+func (it *VectorIterator) First() (*base.InternalKey, base.LazyValue) {
+	if it.lower != nil {
+		return it.SeekGE(it.lower, base.SeekGEFlagsNone)
+	}
+	it.index = 0
+	return it.forward()
+}
+
+// Last moves the iterator to the last entry. Note that Last only checks the
+// lower bound.
+func (it *VectorIterator) Last() (*base.InternalKey, base.LazyValue) {
+	it.index = len(it.nodes) - 1
+	return it.backward()
+}
+
+// Next advances to the next entry.
+func (it *VectorIterator) Next() (*base.InternalKey, base.LazyValue) {
+	if it.index < len(it.nodes) {
+		it.index++
+	}
+	return it.forward()
+}
+
+// NextPrefix advances to the next entry with a new prefix.
+func (it *VectorIterator) NextPrefix(succKey []byte) (*base.InternalKey, base.LazyValue) {
+	return it.SeekGE(succKey, base.SeekGEFlagsNone.EnableTrySeekUsingNext())
+}
+
+// Prev moves to the previous entry.
+func (it *VectorIterator) Prev() (*base.InternalKey, base.LazyValue) {
+	if it.index >= 0 {
+		it.index--
+	}
+	return it.backward()
+}
+
+// Error returns any accumulated error.
+func (it *VectorIterator) Error() error {
+	return it.err
+}
+
+// KVChecksum implements base.KVChecksumIterator, as Iterator.KVChecksum does.
+func (it *VectorIterator) KVChecksum() (base.KVChecksum, bool) {
+	if !it.vec.kvChecksums {
+		return 0, false
+	}
+	return it.vec.node(it.nodes[it.index]).getKVChecksum(it.vec.arena), true
+}
+
+// Close resets the iterator.
+func (it *VectorIterator) Close() error {
+	it.vec = nil
+	it.nodes = nil
+	return nil
+}
+
+// SetBounds sets the lower and upper bounds for the iterator.
+func (it *VectorIterator) SetBounds(lower, upper []byte) {
+	it.lower = lower
+	it.upper = upper
+}
+
+func (it *VectorIterator) forward() (*base.InternalKey, base.LazyValue) {
+	if it.index >= len(it.nodes) {
+		it.index = len(it.nodes)
+		return nil, base.LazyValue{}
+	}
+	it.key = it.vec.key(it.nodes[it.index])
+	if it.upper != nil && it.vec.cmp(it.upper, it.key.UserKey) <= 0 {
+		it.index = len(it.nodes)
+		return nil, base.LazyValue{}
+	}
+	nd := it.vec.node(it.nodes[it.index])
+	if it.bytesIterated != nil {
+		*it.bytesIterated += uint64(nd.allocSize)
+	}
+	return it.current(nd)
+}
+
+func (it *VectorIterator) backward() (*base.InternalKey, base.LazyValue) {
+	if it.index < 0 {
+		it.index = -1
+		return nil, base.LazyValue{}
+	}
+	it.key = it.vec.key(it.nodes[it.index])
+	if it.lower != nil && it.vec.cmp(it.lower, it.key.UserKey) > 0 {
+		it.index = -1
+		return nil, base.LazyValue{}
+	}
+	return it.current(it.vec.node(it.nodes[it.index]))
+}
+
+// current returns the key and value of the node at the current position,
+// verifying its key-value checksum as Iterator.current does.
+func (it *VectorIterator) current(nd *node) (*base.InternalKey, base.LazyValue) {
+	value := nd.getValue(it.vec.arena)
+	if it.vec.kvChecksums {
+		if err := nd.verifyKVChecksum(it.vec.arena, it.key, value); err != nil {
+			it.err = err
+			return nil, base.LazyValue{}
+		}
+	}
+	return &it.key, base.MakeInPlaceValue(value)
+}
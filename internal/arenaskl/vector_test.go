@@ -0,0 +1,160 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package arenaskl
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectorBasic(t *testing.T) {
+	v := NewVector(NewArena(make([]byte, arenaSize)), bytes.Compare)
+	for _, k := range []string{"c", "a", "e", "b", "a"} {
+		require.NoError(t, v.Add(makeIkey(k), []byte(k)))
+	}
+
+	collect := func(it *VectorIterator) string {
+		var buf bytes.Buffer
+		for key, _ := it.First(); key != nil; key, _ = it.Next() {
+			fmt.Fprintf(&buf, "%s ", key.UserKey)
+		}
+		return buf.String()
+	}
+	// Duplicate keys are only returned once.
+	require.Equal(t, "a b c e ", collect(v.NewIter(nil, nil)))
+	require.Equal(t, "b c ", collect(v.NewIter([]byte("b"), []byte("d"))))
+
+	it := v.NewIter(nil, nil)
+	key, _ := it.SeekGE([]byte("d"), base.SeekGEFlagsNone)
+	require.Equal(t, "e", string(key.UserKey))
+	key, _ = it.SeekLT([]byte("b"), base.SeekLTFlagsNone)
+	require.Equal(t, "a", string(key.UserKey))
+	key, _ = it.Prev()
+	require.Nil(t, key)
+	key, _ = it.Last()
+	require.Equal(t, "e", string(key.UserKey))
+
+	// An iterator only sees the entries added before it was created.
+	require.NoError(t, v.Add(makeIkey("d"), nil))
+	require.Equal(t, "a b c e ", collect(it))
+	require.Equal(t, "a b c d e ", collect(v.NewIter(nil, nil)))
+}
+
+func TestVectorConcurrentAdd(t *testing.T) {
+	const n = 1000
+	v := NewVector(NewArena(make([]byte, arenaSize)), bytes.Compare)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			require.NoError(t, v.Add(makeIntKey(i), nil))
+			// Iterate concurrently with the other additions.
+			it := v.NewIter(nil, nil)
+			key, _ := it.SeekGE(makeIntKey(i).UserKey, base.SeekGEFlagsNone)
+			require.NotNil(t, key)
+			require.Equal(t, makeIntKey(i).UserKey, key.UserKey)
+		}(i)
+	}
+	wg.Wait()
+
+	var count int
+	it := v.NewIter(nil, nil)
+	for key, _ := it.First(); key != nil; key, _ = it.Next() {
+		require.Equal(t, makeIntKey(count).UserKey, key.UserKey)
+		count++
+	}
+	require.Equal(t, n, count)
+}
+
+func TestVectorIndexSize(t *testing.T) {
+	const n = 1000
+	v := NewVector(NewArena(make([]byte, arenaSize)), bytes.Compare)
+	require.Equal(t, uint64(0), v.IndexSize())
+	for i := 0; i < n; i++ {
+		require.NoError(t, v.Add(makeIntKey(i), nil))
+	}
+	require.LessOrEqual(t, uint64(4*n), v.IndexSize())
+	require.GreaterOrEqual(t, uint64(VectorIndexEntrySize*n), v.IndexSize())
+
+	// Sorting moves the offsets from the unsorted slice to the sorted array.
+	_ = v.NewIter(nil, nil)
+	require.Equal(t, uint64(4*n), v.IndexSize())
+}
+
+func TestVectorConcurrentSort(t *testing.T) {
+	const n = 1000
+	v := NewVector(NewArena(make([]byte, arenaSize)), bytes.Compare)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			require.NoError(t, v.Add(makeIntKey(i), nil))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		// Each iterator sees a sorted prefix of the entries added so far.
+		for i := 0; i < n/10; i++ {
+			var count int
+			it := v.NewIter(nil, nil)
+			for key, _ := it.First(); key != nil; key, _ = it.Next() {
+				require.Equal(t, makeIntKey(count).UserKey, key.UserKey)
+				count++
+			}
+		}
+	}()
+	wg.Wait()
+
+	var count int
+	it := v.NewIter(nil, nil)
+	for key, _ := it.First(); key != nil; key, _ = it.Next() {
+		count++
+	}
+	require.Equal(t, n, count)
+}
+
+func TestVectorKVChecksums(t *testing.T) {
+	v := NewVector(NewArena(make([]byte, arenaSize)), bytes.Compare)
+	v.EnableKVChecksums()
+	for _, k := range []string{"c", "a", "b"} {
+		require.NoError(t, v.Add(makeIkey(k), []byte(k)))
+	}
+	key := makeIkey("d")
+	require.NoError(t, v.AddWithKVChecksum(key, []byte("d"),
+		base.MakeKVChecksum(key.Kind(), key.UserKey, []byte("d"))))
+
+	it := v.NewIter(nil, nil)
+	k, val := it.SeekGE([]byte("b"), base.SeekGEFlagsNone)
+	require.Equal(t, "b", string(k.UserKey))
+	require.NoError(t, it.Error())
+	checksum, ok := it.KVChecksum()
+	require.True(t, ok)
+	require.Equal(t, base.MakeKVChecksum(k.Kind(), k.UserKey, []byte("b")), checksum)
+	// Corrupt the value in the arena.
+	val.InPlaceValue()[0] = 'x'
+
+	for k, _ := it.First(); k != nil; k, _ = it.Next() {
+		require.Equal(t, "a", string(k.UserKey))
+	}
+	require.True(t, errors.Is(it.Error(), base.ErrCorruption))
+	it = v.NewIter(nil, nil)
+	k, _ = it.Last()
+	require.Equal(t, "d", string(k.UserKey))
+	k, _ = it.Prev()
+	require.Equal(t, "c", string(k.UserKey))
+	k, _ = it.Prev()
+	require.Nil(t, k)
+	require.True(t, errors.Is(it.Error(), base.ErrCorruption))
+}
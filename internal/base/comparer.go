@@ -130,6 +130,14 @@ type Comparer struct {
 	Successor          Successor
 	ImmediateSuccessor ImmediateSuccessor
 
+	// BytewisePrefixOrdering declares that the comparer orders the prefixes
+	// of keys (see Split, or the entire keys if Split is nil) bytewise, as
+	// bytes.Compare does: if Compare(a, b) < 0, the prefix of a is bytewise
+	// less than or equal to the prefix of b. Features that rely on this
+	// ordering, such as range filters, are refused or ignored for comparers
+	// that don't declare it.
+	BytewisePrefixOrdering bool
+
 	// Name is the name of the comparer.
 	//
 	// The Level-DB on-disk format stores the comparer name, and opening a
@@ -150,6 +158,8 @@ var DefaultComparer = &Comparer{
 	Compare: bytes.Compare,
 	Equal:   bytes.Equal,
 
+	BytewisePrefixOrdering: true,
+
 	AbbreviatedKey: func(key []byte) uint64 {
 		if len(key) >= 8 {
 			return binary.BigEndian.Uint64(key)
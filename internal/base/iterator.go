@@ -16,12 +16,13 @@ import (
 // reverse iteration, key/value pairs for identical user-keys are returned in
 // ascending sequence order.
 //
-// InternalIterators provide 5 absolute positioning methods and 2 relative
+// InternalIterators provide 6 absolute positioning methods and 2 relative
 // positioning methods. The absolute positioning methods are:
 //
 // - SeekGE
 // - SeekPrefixGE
 // - SeekLT
+// - SeekPrefixLT
 // - First
 // - Last
 //
@@ -31,21 +32,24 @@ import (
 // - Prev
 //
 // The relative positioning methods can be used in conjunction with any of the
-// absolute positioning methods with one exception: SeekPrefixGE does not
-// support reverse iteration via Prev. It is undefined to call relative
-// positioning methods without ever calling an absolute positioning method.
+// absolute positioning methods with two exceptions: SeekPrefixGE does not
+// support reverse iteration via Prev, and SeekPrefixLT does not support
+// forward iteration via Next. It is undefined to call relative positioning
+// methods without ever calling an absolute positioning method.
 //
 // InternalIterators can optionally implement a prefix iteration mode. This
-// mode is entered by calling SeekPrefixGE and exited by any other absolute
-// positioning method (SeekGE, SeekLT, First, Last). When in prefix iteration
-// mode, a call to Next will advance to the next key which has the same
-// "prefix" as the one supplied to SeekPrefixGE. Note that "prefix" in this
-// context is not a strict byte prefix, but defined by byte equality for the
-// result of the Comparer.Split method. An InternalIterator is not required to
-// support prefix iteration mode, and can implement SeekPrefixGE by forwarding
-// to SeekGE. When the iteration prefix is exhausted, it is not valid to call
-// Next on an internal iterator that's already returned (nil,nilv) or a key
-// beyond the prefix.
+// mode is entered by calling SeekPrefixGE or SeekPrefixLT and exited by any
+// other absolute positioning method (SeekGE, SeekLT, First, Last). When in
+// prefix iteration mode, a call to Next (after SeekPrefixGE) or Prev (after
+// SeekPrefixLT) will advance to the next key which has the same "prefix" as
+// the one supplied to the seek. Note that "prefix" in this context is not a
+// strict byte prefix, but defined by byte equality for the result of the
+// Comparer.Split method. An InternalIterator is not required to support
+// prefix iteration mode, and can implement SeekPrefixGE by forwarding to
+// SeekGE and SeekPrefixLT by forwarding to SeekLT. When the iteration prefix
+// is exhausted, it is not valid to call Next (or Prev, respectively) on an
+// internal iterator that's already returned (nil,nilv) or a key beyond the
+// prefix.
 //
 // Bounds, [lower, upper), can be set on iterators, either using the SetBounds()
 // function in the interface, or in implementation specific ways during iterator
@@ -132,6 +136,28 @@ type InternalIterator interface {
 	// the upper bound.
 	SeekLT(key []byte, flags SeekLTFlags) (*InternalKey, LazyValue)
 
+	// SeekPrefixLT moves the iterator to the last key/value pair whose key is
+	// less than the given key. Returns the key and value if the iterator is
+	// pointing at a valid entry, and (nil, nilv) otherwise. Note that
+	// SeekPrefixLT only checks the lower bound. It is up to the caller to
+	// ensure that key is less than or equal to the upper bound.
+	//
+	// The prefix argument is the prefix of the given key as returned by the
+	// Comparer's Split function, and is used by some InternalIterator
+	// implementations (e.g. sstable.Reader) to consult filters. If the
+	// iterator is able to determine that no key with the prefix exists, it can
+	// return (nil,nilv). Unlike SeekLT, this is not an indication that
+	// iteration is exhausted.
+	//
+	// Note that the iterator may return keys not matching the prefix. It is up
+	// to the caller to check if the prefix matches.
+	//
+	// Calling SeekPrefixLT places the receiver into prefix iteration mode, in
+	// which forward iteration via Next may not be supported. Once in this
+	// mode, Prev will only be called while the iterator is positioned at a key
+	// with the prefix.
+	SeekPrefixLT(prefix, key []byte, flags SeekLTFlags) (*InternalKey, LazyValue)
+
 	// First moves the iterator the the first key/value pair. Returns the key and
 	// value if the iterator is pointing at a valid entry, and (nil, nilv)
 	// otherwise. Note that First only checks the upper bound. It is up to the
@@ -351,6 +377,10 @@ type InternalIteratorStats struct {
 	BlockBytes uint64
 	// Subset of BlockBytes that were in the block cache.
 	BlockBytesInCache uint64
+	// The number of loaded blocks, counting the same blocks as BlockBytes, and
+	// the subset of those that were not in the block cache.
+	BlockCount       uint64
+	BlockCacheMisses uint64
 	// BlockReadDuration accumulates the duration spent fetching blocks
 	// due to block cache misses.
 	// TODO(sumeer): this currently excludes the time spent in Reader creation,
@@ -398,6 +428,8 @@ type InternalIteratorStats struct {
 func (s *InternalIteratorStats) Merge(from InternalIteratorStats) {
 	s.BlockBytes += from.BlockBytes
 	s.BlockBytesInCache += from.BlockBytesInCache
+	s.BlockCount += from.BlockCount
+	s.BlockCacheMisses += from.BlockCacheMisses
 	s.BlockReadDuration += from.BlockReadDuration
 	s.KeyBytes += from.KeyBytes
 	s.ValueBytes += from.ValueBytes
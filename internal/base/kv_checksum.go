@@ -0,0 +1,63 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package base
+
+import (
+	"encoding/binary"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/cockroachdb/errors"
+)
+
+// KVChecksum is a checksum of a key-value pair: of its kind, user key and
+// value. It doesn't cover the sequence number, which is assigned when a batch
+// is committed and may be rewritten by compactions or ingestion. Key-value
+// checksums are computed when a key is written and verified as it moves
+// through the DB, in order to detect corruption of decoded keys and values in
+// memory, which block checksums can't detect.
+type KVChecksum uint64
+
+// MakeKVChecksum returns the checksum of the key-value pair with the given
+// kind, user key and value.
+func MakeKVChecksum(kind InternalKeyKind, userKey, value []byte) KVChecksum {
+	var buf [1 + binary.MaxVarintLen64]byte
+	buf[0] = byte(kind)
+	n := 1 + binary.PutUvarint(buf[1:], uint64(len(userKey)))
+	var d xxhash.Digest
+	d.Reset()
+	_, _ = d.Write(buf[:n])
+	_, _ = d.Write(userKey)
+	_, _ = d.Write(value)
+	return KVChecksum(d.Sum64())
+}
+
+// KVChecksumIterator is implemented by internal iterators that can return
+// the key-value checksum of their current entry, as computed when the entry
+// was first written, so that it can be carried along with the entry and
+// verified where the entry is written out again, such as by the sstable
+// writer of a flush or compaction.
+type KVChecksumIterator interface {
+	// KVChecksum returns the key-value checksum of the current entry, and
+	// whether it's known. It may only be called when the iterator is
+	// positioned at an entry.
+	KVChecksum() (KVChecksum, bool)
+}
+
+// IterKVChecksum returns the key-value checksum of the current entry of iter,
+// if iter implements KVChecksumIterator and knows the checksum.
+func IterKVChecksum(iter InternalIterator) (KVChecksum, bool) {
+	if c, ok := iter.(KVChecksumIterator); ok {
+		return c.KVChecksum()
+	}
+	return 0, false
+}
+
+// KVChecksumMismatchError returns the error reporting that the key-value pair
+// with the given key, found at location, doesn't match its checksum. The
+// error is a corruption error (see ErrCorruption).
+func KVChecksumMismatchError(key InternalKey, location string) error {
+	return CorruptionErrorf("pebble: key-value checksum mismatch for key %s in %s",
+		key, errors.Safe(location))
+}
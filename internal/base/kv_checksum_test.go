@@ -0,0 +1,31 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package base
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVChecksum(t *testing.T) {
+	c := MakeKVChecksum(InternalKeyKindSet, []byte("foo"), []byte("bar"))
+	require.Equal(t, c, MakeKVChecksum(InternalKeyKindSet, []byte("foo"), []byte("bar")))
+	for _, other := range []KVChecksum{
+		MakeKVChecksum(InternalKeyKindMerge, []byte("foo"), []byte("bar")),
+		MakeKVChecksum(InternalKeyKindSet, []byte("fop"), []byte("bar")),
+		MakeKVChecksum(InternalKeyKindSet, []byte("foo"), []byte("baz")),
+		// The boundary between the key and the value is covered.
+		MakeKVChecksum(InternalKeyKindSet, []byte("foob"), []byte("ar")),
+		MakeKVChecksum(InternalKeyKindSet, []byte("fo"), []byte("obar")),
+	} {
+		require.NotEqual(t, c, other)
+	}
+
+	err := KVChecksumMismatchError(MakeInternalKey([]byte("foo"), 1, InternalKeyKindSet), "memtable")
+	require.True(t, errors.Is(err, ErrCorruption))
+	require.Equal(t, "pebble: key-value checksum mismatch for key foo#1,1 in memtable", err.Error())
+}
@@ -64,6 +64,16 @@ type FilterPolicy interface {
 	NewWriter(ftype FilterType) FilterWriter
 }
 
+// TunableFilterPolicy is implemented by filter policies whose filters may be
+// tuned to a target false positive rate.
+type TunableFilterPolicy interface {
+	FilterPolicy
+
+	// WithFalsePositiveRate returns a filter policy with the same name, whose
+	// filters have approximately the provided false positive rate.
+	WithFalsePositiveRate(rate float64) FilterPolicy
+}
+
 // BlockPropertyFilter is used in an Iterator to filter sstables and blocks
 // within the sstable. It should not maintain any per-sstable state, and must
 // be thread-safe.
@@ -0,0 +1,112 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package base
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Tracer creates spans recording the duration and attributes of operations.
+// It mirrors a subset of the OpenTelemetry tracing API, so that it may be
+// implemented by an adapter over an OpenTelemetry tracer. Its methods may be
+// called concurrently.
+//
+// Spans are created with explicit start and end times, so that a span may be
+// created after the fact for an operation which turned out to be of interest,
+// such as a seek which missed the block cache.
+type Tracer interface {
+	// Start starts a span with the given name and start time. If ctx holds a
+	// span started by the same tracer, the new span is its child. Start
+	// returns a context holding the new span, for starting child spans.
+	Start(ctx context.Context, name string, start time.Time) (context.Context, Span)
+}
+
+// tracedContextKey is the key of the value marking a context as holding a span
+// started by a Tracer. See ContextWithTracedSpan.
+type tracedContextKey struct{}
+
+// ContextWithTracedSpan returns a context marking ctx, which holds a span
+// returned by Tracer.Start, as traced. Spans of block reads are only emitted
+// under traced contexts, as children of their spans, so that untraced
+// operations such as compactions and table opens don't emit a root span for
+// every block they read.
+func ContextWithTracedSpan(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tracedContextKey{}, true)
+}
+
+// IsTraced returns true if ctx was marked by ContextWithTracedSpan.
+func IsTraced(ctx context.Context) bool {
+	traced, _ := ctx.Value(tracedContextKey{}).(bool)
+	return traced
+}
+
+// Span is an operation traced by a Tracer.
+type Span interface {
+	// SetAttributes sets attributes of the span, replacing any previous
+	// attributes with the same keys.
+	SetAttributes(attrs ...Attribute)
+	// RecordError records that the operation failed with the error.
+	RecordError(err error)
+	// End ends the span at the given time. The span must not be used after it
+	// has ended.
+	End(end time.Time)
+}
+
+// AttributeType is the type of the value of an Attribute.
+type AttributeType uint8
+
+// The types of the values of attributes.
+const (
+	AttributeInt64 AttributeType = iota
+	AttributeString
+	AttributeBool
+)
+
+// Attribute is a key-value pair describing a span, such as the file number of
+// an sstable read by the operation.
+type Attribute struct {
+	Key  string
+	Type AttributeType
+	// Int holds the value of an AttributeInt64 attribute, and the value of an
+	// AttributeBool attribute as 0 or 1.
+	Int int64
+	// String holds the value of an AttributeString attribute.
+	String string
+}
+
+// Int64Attribute returns an attribute with an integer value.
+func Int64Attribute(key string, value int64) Attribute {
+	return Attribute{Key: key, Type: AttributeInt64, Int: value}
+}
+
+// StringAttribute returns an attribute with a string value.
+func StringAttribute(key string, value string) Attribute {
+	return Attribute{Key: key, Type: AttributeString, String: value}
+}
+
+// BoolAttribute returns an attribute with a boolean value.
+func BoolAttribute(key string, value bool) Attribute {
+	a := Attribute{Key: key, Type: AttributeBool}
+	if value {
+		a.Int = 1
+	}
+	return a
+}
+
+// Value returns the value of the attribute, as an int64, string or bool.
+func (a Attribute) Value() interface{} {
+	switch a.Type {
+	case AttributeInt64:
+		return a.Int
+	case AttributeString:
+		return a.String
+	case AttributeBool:
+		return a.Int != 0
+	default:
+		panic(fmt.Sprintf("pebble: unknown attribute type %d", a.Type))
+	}
+}
@@ -76,9 +76,21 @@ func (h Handle) Release() {
 	}
 }
 
+// Acquire acquires an additional reference to the handle's value, returning
+// a Handle which must be released separately.
+func (h Handle) Acquire() Handle {
+	if h.value != nil {
+		h.value.acquire()
+	}
+	return h
+}
+
 type shard struct {
 	hits   int64
 	misses int64
+	// The hits and misses of lookups at each priority, indexed by Priority.
+	classHits   [NumPriorities]int64
+	classMisses [NumPriorities]int64
 
 	mu sync.RWMutex
 
@@ -102,6 +114,12 @@ type shard struct {
 	sizeHot  int64
 	sizeCold int64
 	sizeTest int64
+	// sizeHotHigh is the size of the hot entries inserted with HighPriority.
+	// See highPriorityTarget.
+	sizeHotHigh int64
+	// highPriorityRatio is the fraction of the shard's target size reserved for
+	// hot HighPriority entries. See Options.HighPriorityRatio.
+	highPriorityRatio float64
 
 	// The count fields are used exclusively for asserting expectations.
 	// We've seen infinite looping (cockroachdb/cockroach#70154) that
@@ -113,28 +131,38 @@ type shard struct {
 	countTest int64
 }
 
-func (c *shard) Get(id uint64, fileNum base.DiskFileNum, offset uint64) Handle {
+func (c *shard) Get(id uint64, fileNum base.DiskFileNum, offset uint64, p Priority) Handle {
 	c.mu.RLock()
 	var value *Value
 	if e := c.blocks.Get(key{fileKey{id, fileNum}, offset}); e != nil {
 		value = e.acquireValue()
-		if value != nil {
+		if value != nil && p >= NormalPriority {
+			// Lookups by scans don't count as references, so that scanned
+			// blocks aren't retained at the expense of other blocks.
 			atomic.StoreInt32(&e.referenced, 1)
 		}
 	}
 	c.mu.RUnlock()
 	if value == nil {
 		atomic.AddInt64(&c.misses, 1)
+		atomic.AddInt64(&c.classMisses[p], 1)
 		return Handle{}
 	}
 	atomic.AddInt64(&c.hits, 1)
+	atomic.AddInt64(&c.classHits[p], 1)
 	return Handle{value: value}
 }
 
-func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *Value) Handle {
+func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *Value, p Priority) Handle {
 	if n := value.refs(); n != 1 {
 		panic(fmt.Sprintf("pebble: Value has already been added to the cache: refs=%d", n))
 	}
+	if p == NoFillPriority {
+		// The value isn't added to the cache, and is freed when the returned
+		// handle is released.
+		value.ref.trace("no-fill")
+		return Handle{value: value}
+	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -143,9 +171,28 @@ func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *V
 	e := c.blocks.Get(k)
 
 	switch {
+	case e == nil && p == HighPriority:
+		// High priority entries are added as hot pages, which the hot hand
+		// doesn't demote while the high priority pool is within its target.
+		e = newEntry(c, k, int64(len(value.buf)))
+		e.priority = p
+		e.ptype = etHot
+		e.setValue(value)
+		if c.metaAdd(k, e) {
+			value.ref.trace("add-hot")
+			c.sizeHot += e.size
+			c.sizeHotHigh += e.size
+			c.countHot++
+		} else {
+			value.ref.trace("skip-hot")
+			e.free()
+			e = nil
+		}
+
 	case e == nil:
 		// no cache entry? add it
 		e = newEntry(c, k, int64(len(value.buf)))
+		e.priority = p
 		e.setValue(value)
 		if c.metaAdd(k, e) {
 			value.ref.trace("add-cold")
@@ -166,6 +213,9 @@ func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *V
 		if e.ptype == etHot {
 			value.ref.trace("add-hot")
 			c.sizeHot += delta
+			if e.priority == HighPriority {
+				c.sizeHotHigh += delta
+			}
 		} else {
 			value.ref.trace("add-cold")
 			c.sizeCold += delta
@@ -188,9 +238,13 @@ func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *V
 		atomic.StoreInt32(&e.referenced, 0)
 		e.setValue(value)
 		e.ptype = etHot
+		e.priority = p
 		if c.metaAdd(k, e) {
 			value.ref.trace("add-hot")
 			c.sizeHot += e.size
+			if e.priority == HighPriority {
+				c.sizeHotHigh += e.size
+			}
 			c.countHot++
 		} else {
 			value.ref.trace("skip-hot")
@@ -419,13 +473,16 @@ func (c *shard) metaCheck(e *entry) {
 		// NB: c.hand{Hot,Cold,Test} are pointers into a single linked list. We
 		// only have to traverse one of them to check all of them.
 		var countHot, countCold, countTest int64
-		var sizeHot, sizeCold, sizeTest int64
+		var sizeHot, sizeCold, sizeTest, sizeHotHigh int64
 		for t := c.handHot.next(); t != nil; t = t.next() {
 			// Recompute count{Hot,Cold,Test} and size{Hot,Cold,Test}.
 			switch t.ptype {
 			case etHot:
 				countHot++
 				sizeHot += t.size
+				if t.priority == HighPriority {
+					sizeHotHigh += t.size
+				}
 			case etCold:
 				countCold++
 				sizeCold += t.size
@@ -443,12 +500,13 @@ func (c *shard) metaCheck(e *entry) {
 			}
 		}
 		if countHot != c.countHot || countCold != c.countCold || countTest != c.countTest ||
-			sizeHot != c.sizeHot || sizeCold != c.sizeCold || sizeTest != c.sizeTest {
+			sizeHot != c.sizeHot || sizeCold != c.sizeCold || sizeTest != c.sizeTest ||
+			sizeHotHigh != c.sizeHotHigh {
 			fmt.Fprintf(os.Stderr, `divergence of Hot,Cold,Test statistics
-				cache's statistics: hot %d, %d, cold %d, %d, test %d, %d
-				recalculated statistics: hot %d, %d, cold %d, %d, test %d, %d\n%s`,
-				c.countHot, c.sizeHot, c.countCold, c.sizeCold, c.countTest, c.sizeTest,
-				countHot, sizeHot, countCold, sizeCold, countTest, sizeTest,
+				cache's statistics: hot %d, %d (%d high), cold %d, %d, test %d, %d
+				recalculated statistics: hot %d, %d (%d high), cold %d, %d, test %d, %d\n%s`,
+				c.countHot, c.sizeHot, c.sizeHotHigh, c.countCold, c.sizeCold, c.countTest, c.sizeTest,
+				countHot, sizeHot, sizeHotHigh, countCold, sizeCold, countTest, sizeTest,
 				debug.Stack())
 			os.Exit(1)
 		}
@@ -459,6 +517,9 @@ func (c *shard) metaEvict(e *entry) {
 	switch e.ptype {
 	case etHot:
 		c.sizeHot -= e.size
+		if e.priority == HighPriority {
+			c.sizeHotHigh -= e.size
+		}
 		c.countHot--
 	case etCold:
 		c.sizeCold -= e.size
@@ -472,6 +533,22 @@ func (c *shard) metaEvict(e *entry) {
 	e.free()
 }
 
+// highPriorityTarget returns the size of the pool of hot HighPriority
+// entries. While the pool is within its target, the hot hand doesn't demote
+// its unreferenced entries, so that index and filter blocks aren't evicted by
+// scans of data blocks.
+func (c *shard) highPriorityTarget() int64 {
+	return int64(float64(c.targetSize()) * c.highPriorityRatio)
+}
+
+// hotPagesProtected returns true if all hot entries are in the high priority
+// pool and the pool is within its target, in which case the hot hand can't
+// demote any of them.
+func (c *shard) hotPagesProtected() bool {
+	return c.sizeHotHigh > 0 && c.sizeHotHigh == c.sizeHot &&
+		c.sizeHotHigh <= c.highPriorityTarget()
+}
+
 func (c *shard) evict() {
 	for c.targetSize() <= c.sizeHot+c.sizeCold && c.handCold != nil {
 		c.runHandCold(c.countCold, c.sizeCold)
@@ -497,7 +574,19 @@ func (c *shard) runHandCold(countColdDebug, sizeColdDebug int64) {
 			c.sizeCold -= e.size
 			c.countCold--
 			c.sizeHot += e.size
+			if e.priority == HighPriority {
+				c.sizeHotHigh += e.size
+			}
 			c.countHot++
+		} else if e.priority == LowPriority {
+			// Unreferenced low priority entries are evicted without becoming
+			// test pages, so that scans don't grow the cold target at the
+			// expense of hot pages.
+			c.sizeCold -= e.size
+			c.countCold--
+			c.metaDel(e)
+			c.metaCheck(e)
+			e.free()
 		} else {
 			e.setValue(nil)
 			e.ptype = etTest
@@ -513,7 +602,7 @@ func (c *shard) runHandCold(countColdDebug, sizeColdDebug int64) {
 
 	c.handCold = c.handCold.next()
 
-	for c.targetSize()-c.coldTarget <= c.sizeHot && c.handHot != nil {
+	for c.targetSize()-c.coldTarget <= c.sizeHot && c.handHot != nil && !c.hotPagesProtected() {
 		c.runHandHot()
 	}
 }
@@ -530,9 +619,14 @@ func (c *shard) runHandHot() {
 	if e.ptype == etHot {
 		if atomic.LoadInt32(&e.referenced) == 1 {
 			atomic.StoreInt32(&e.referenced, 0)
+		} else if e.priority == HighPriority && c.sizeHotHigh <= c.highPriorityTarget() {
+			// The entry is retained in the high priority pool.
 		} else {
 			e.ptype = etCold
 			c.sizeHot -= e.size
+			if e.priority == HighPriority {
+				c.sizeHotHigh -= e.size
+			}
 			c.countHot--
 			c.sizeCold += e.size
 			c.countCold++
@@ -572,16 +666,73 @@ func (c *shard) runHandTest() {
 	c.handTest = c.handTest.next()
 }
 
+// Priority is the priority class of a cache lookup or insertion.
+type Priority int8
+
+const (
+	// NoFillPriority is used by bulk scans, which read blocks without adding
+	// them to the cache.
+	NoFillPriority Priority = iota
+	// LowPriority is used for blocks read by scans, such as compactions,
+	// which are unlikely to be read again soon. Low priority entries are
+	// evicted first, and low priority lookups don't protect the entries they
+	// hit from eviction.
+	LowPriority
+	// NormalPriority is used for data blocks.
+	NormalPriority
+	// HighPriority is used for index, filter and metaindex blocks, which are
+	// read by every lookup in a table and are added to the cache as hot
+	// entries.
+	HighPriority
+	// NumPriorities is the number of priority classes.
+	NumPriorities
+)
+
+func (p Priority) String() string {
+	switch p {
+	case NoFillPriority:
+		return "no-fill"
+	case LowPriority:
+		return "low"
+	case NormalPriority:
+		return "normal"
+	case HighPriority:
+		return "high"
+	}
+	return "unknown"
+}
+
+// ClassMetrics holds the hit and miss counts of the lookups of a priority
+// class.
+type ClassMetrics struct {
+	Hits   int64
+	Misses int64
+}
+
+// HitRate returns the fraction of the class's lookups that hit the cache, or
+// 0 if there were none.
+func (m ClassMetrics) HitRate() float64 {
+	if n := m.Hits + m.Misses; n > 0 {
+		return float64(m.Hits) / float64(n)
+	}
+	return 0
+}
+
 // Metrics holds metrics for the cache.
 type Metrics struct {
 	// The number of bytes inuse by the cache.
 	Size int64
 	// The count of objects (blocks or tables) in the cache.
 	Count int64
+	// The number of bytes reserved in the cache. See Cache.Reserve.
+	Reserved int64
 	// The number of cache hits.
 	Hits int64
 	// The number of cache misses.
 	Misses int64
+	// The hits and misses of lookups of each priority class, indexed by
+	// Priority. Lookups via Get are of NormalPriority.
+	Classes [NumPriorities]ClassMetrics
 }
 
 // Cache implements Pebble's sharded block cache. The Clock-PRO algorithm is
@@ -626,6 +777,8 @@ type Cache struct {
 	idAlloc uint64
 	shards  []shard
 
+	secondaries secondaryRegistry
+
 	// Traces recorded by Cache.trace. Used for debugging.
 	tr struct {
 		sync.Mutex
@@ -643,10 +796,42 @@ type Cache struct {
 //	defer c.Unref()
 //	d, err := pebble.Open(pebble.Options{Cache: c})
 func New(size int64) *Cache {
-	return newShards(size, 2*runtime.GOMAXPROCS(0))
+	return NewWithOptions(Options{Size: size})
+}
+
+// DefaultHighPriorityRatio is the default value of Options.HighPriorityRatio.
+const DefaultHighPriorityRatio = 0.5
+
+// Options holds the parameters of a Cache created by NewWithOptions.
+type Options struct {
+	// Size is the size of the cache in bytes.
+	Size int64
+	// HighPriorityRatio is the fraction of the cache's size reserved for hot
+	// HighPriority entries, such as index and filter blocks. While the hot
+	// HighPriority entries fit within it, they aren't demoted by the hot hand,
+	// so that scans of data blocks don't evict them. It must be in (0, 1], and
+	// if zero, DefaultHighPriorityRatio is used.
+	HighPriorityRatio float64
+}
+
+// NewWithOptions creates a new cache with the specified options. See New.
+func NewWithOptions(opts Options) *Cache {
+	return newShardsWithOptions(opts, 2*runtime.GOMAXPROCS(0))
 }
 
 func newShards(size int64, shards int) *Cache {
+	return newShardsWithOptions(Options{Size: size}, shards)
+}
+
+func newShardsWithOptions(opts Options, shards int) *Cache {
+	size := opts.Size
+	highPriorityRatio := opts.HighPriorityRatio
+	if highPriorityRatio == 0 {
+		highPriorityRatio = DefaultHighPriorityRatio
+	}
+	if highPriorityRatio < 0 || highPriorityRatio > 1 {
+		panic(fmt.Sprintf("pebble: invalid cache HighPriorityRatio: %v", highPriorityRatio))
+	}
 	c := &Cache{
 		refs:    1,
 		maxSize: size,
@@ -656,8 +841,9 @@ func newShards(size int64, shards int) *Cache {
 	c.trace("alloc", c.refs)
 	for i := range c.shards {
 		c.shards[i] = shard{
-			maxSize:    size / int64(len(c.shards)),
-			coldTarget: size / int64(len(c.shards)),
+			maxSize:           size / int64(len(c.shards)),
+			coldTarget:        size / int64(len(c.shards)),
+			highPriorityRatio: highPriorityRatio,
 		}
 		if entriesGoAllocated {
 			c.shards[i].entries = make(map[*entry]struct{})
@@ -740,7 +926,38 @@ func (c *Cache) Unref() {
 // Get retrieves the cache value for the specified file and offset, returning
 // nil if no value is present.
 func (c *Cache) Get(id uint64, fileNum base.DiskFileNum, offset uint64) Handle {
-	return c.getShard(id, fileNum, offset).Get(id, fileNum, offset)
+	return c.GetWithPriority(id, fileNum, offset, NormalPriority)
+}
+
+// GetWithPriority is like Get, but records the lookup in the metrics of the
+// specified priority class. Lookups below NormalPriority don't mark the entry
+// as referenced.
+func (c *Cache) GetWithPriority(
+	id uint64, fileNum base.DiskFileNum, offset uint64, p Priority,
+) Handle {
+	return c.getShard(id, fileNum, offset).Get(id, fileNum, offset, p)
+}
+
+// SetSecondary attaches a secondary cache to the specified ID, or detaches the
+// attached one if s is nil. Readers of the ID's blocks look up the blocks that
+// miss in the cache in the secondary cache, and offer it the blocks they read
+// from storage (see Secondary). The secondary cache must be detached before
+// it's closed. It's an error to attach a secondary cache that's already
+// attached to another ID, or to another Cache.
+func (c *Cache) SetSecondary(id uint64, s *SecondaryCache) error {
+	if id == 0 {
+		panic("pebble: 0 cache ID is invalid")
+	}
+	return c.secondaries.set(id, s)
+}
+
+// Secondary returns the secondary cache attached to the specified ID, or nil
+// if there's none.
+func (c *Cache) Secondary(id uint64) *SecondaryCache {
+	if c == nil {
+		return nil
+	}
+	return c.secondaries.get(id)
 }
 
 // Set sets the cache value for the specified file and offset, overwriting an
@@ -748,7 +965,16 @@ func (c *Cache) Get(id uint64, fileNum base.DiskFileNum, offset uint64) Handle {
 // retrieval of the cached value than Get (lock-free and avoidance of the map
 // lookup). The value must have been allocated by Cache.Alloc.
 func (c *Cache) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *Value) Handle {
-	return c.getShard(id, fileNum, offset).Set(id, fileNum, offset, value)
+	return c.getShard(id, fileNum, offset).Set(id, fileNum, offset, value, NormalPriority)
+}
+
+// SetWithPriority is like Set, but inserts the value with the specified
+// priority. A value set with NoFillPriority isn't added to the cache; the
+// returned Handle holds the only reference to it.
+func (c *Cache) SetWithPriority(
+	id uint64, fileNum base.DiskFileNum, offset uint64, value *Value, p Priority,
+) Handle {
+	return c.getShard(id, fileNum, offset).Set(id, fileNum, offset, value, p)
 }
 
 // Delete deletes the cached value for the specified file and offset.
@@ -756,7 +982,8 @@ func (c *Cache) Delete(id uint64, fileNum base.DiskFileNum, offset uint64) {
 	c.getShard(id, fileNum, offset).Delete(id, fileNum, offset)
 }
 
-// EvictFile evicts all of the cache values for the specified file.
+// EvictFile evicts all of the cache values for the specified file, including
+// those in the secondary cache attached to the ID.
 func (c *Cache) EvictFile(id uint64, fileNum base.DiskFileNum) {
 	if id == 0 {
 		panic("pebble: 0 cache ID is invalid")
@@ -764,6 +991,48 @@ func (c *Cache) EvictFile(id uint64, fileNum base.DiskFileNum) {
 	for i := range c.shards {
 		c.shards[i].EvictFile(id, fileNum)
 	}
+	if s := c.secondaries.get(id); s != nil {
+		s.EvictFile(fileNum)
+	}
+}
+
+// BlockKey identifies a block of a file.
+type BlockKey struct {
+	FileNum base.DiskFileNum
+	Offset  uint64
+}
+
+// ResidentBlocks returns the keys of up to max blocks of the specified ID
+// that are resident in the cache, or of all of them if max is 0. The keys of
+// hot blocks are returned before those of cold blocks.
+func (c *Cache) ResidentBlocks(id uint64, max int) []BlockKey {
+	var hot, cold []BlockKey
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.RLock()
+		if start := s.handHot; start != nil {
+			e := start
+			for {
+				if e.key.id == id && e.ptype != etTest {
+					k := BlockKey{FileNum: e.key.fileNum, Offset: e.key.offset}
+					if e.ptype == etHot {
+						hot = append(hot, k)
+					} else {
+						cold = append(cold, k)
+					}
+				}
+				if e = e.next(); e == start {
+					break
+				}
+			}
+		}
+		s.mu.RUnlock()
+	}
+	keys := append(hot, cold...)
+	if max > 0 && len(keys) > max {
+		keys = keys[:max]
+	}
+	return keys
 }
 
 // MaxSize returns the max size of the cache.
@@ -828,9 +1097,14 @@ func (c *Cache) Metrics() Metrics {
 		s.mu.RLock()
 		m.Count += int64(s.blocks.Count())
 		m.Size += s.sizeHot + s.sizeCold
+		m.Reserved += s.reservedSize
 		s.mu.RUnlock()
 		m.Hits += atomic.LoadInt64(&s.hits)
 		m.Misses += atomic.LoadInt64(&s.misses)
+		for p := range m.Classes {
+			m.Classes[p].Hits += atomic.LoadInt64(&s.classHits[p])
+			m.Classes[p].Misses += atomic.LoadInt64(&s.classMisses[p])
+		}
 	}
 	return m
 }
@@ -11,6 +11,7 @@ import (
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -277,3 +278,128 @@ func TestReserveColdTarget(t *testing.T) {
 		t.Fatalf("expected positive cache size %d, but found %d", 48, cache.Size())
 	}
 }
+
+func TestCachePriorities(t *testing.T) {
+	cache := newShards(100, 1)
+	defer cache.Unref()
+
+	// A value set with NoFillPriority isn't added to the cache, but remains
+	// readable through the returned handle.
+	h := cache.SetWithPriority(1, base.FileNum(0).DiskFileNum(), 0, testValue(cache, "a", 5), NoFillPriority)
+	require.Equal(t, []byte("aaaaa"), h.Get())
+	h.Release()
+	require.EqualValues(t, 0, cache.Size())
+	h = cache.GetWithPriority(1, base.FileNum(0).DiskFileNum(), 0, NoFillPriority)
+	require.Nil(t, h.Get())
+
+	// High priority entries survive a scan of low priority entries that is
+	// several times larger than the cache.
+	for i := 0; i < 10; i++ {
+		cache.SetWithPriority(1, base.FileNum(1).DiskFileNum(), uint64(i), testValue(cache, "i", 5), HighPriority).Release()
+	}
+	for i := 0; i < 100; i++ {
+		offset := uint64(i)
+		h := cache.GetWithPriority(1, base.FileNum(2).DiskFileNum(), offset, LowPriority)
+		require.Nil(t, h.Get())
+		cache.SetWithPriority(1, base.FileNum(2).DiskFileNum(), offset, testValue(cache, "d", 5), LowPriority).Release()
+	}
+	for i := 0; i < 10; i++ {
+		h := cache.GetWithPriority(1, base.FileNum(1).DiskFileNum(), uint64(i), HighPriority)
+		require.NotNil(t, h.Get(), "high priority block %d was evicted", i)
+		h.Release()
+	}
+
+	// Evicted low priority entries don't become test pages.
+	s := &cache.shards[0]
+	s.mu.RLock()
+	require.EqualValues(t, 0, s.countTest)
+	s.mu.RUnlock()
+
+	m := cache.Metrics()
+	require.Equal(t, ClassMetrics{Hits: 0, Misses: 1}, m.Classes[NoFillPriority])
+	require.Equal(t, ClassMetrics{Hits: 0, Misses: 100}, m.Classes[LowPriority])
+	require.Equal(t, ClassMetrics{Hits: 10, Misses: 0}, m.Classes[HighPriority])
+	require.Equal(t, ClassMetrics{}, m.Classes[NormalPriority])
+	require.Equal(t, int64(10), m.Hits)
+	require.Equal(t, int64(101), m.Misses)
+	require.Equal(t, 1.0, m.Classes[HighPriority].HitRate())
+	require.Equal(t, 0.0, m.Classes[NormalPriority].HitRate())
+}
+
+func TestCacheHighPriorityRatio(t *testing.T) {
+	// scan inserts 10 high priority entries, scans low priority entries
+	// several times larger than the cache, and returns the number of high
+	// priority entries that remain cached.
+	scan := func(ratio float64) int {
+		cache := newShardsWithOptions(Options{Size: 100, HighPriorityRatio: ratio}, 1)
+		defer cache.Unref()
+		for i := 0; i < 10; i++ {
+			cache.SetWithPriority(1, base.FileNum(1).DiskFileNum(), uint64(i), testValue(cache, "i", 5), HighPriority).Release()
+		}
+		for i := 0; i < 100; i++ {
+			cache.SetWithPriority(1, base.FileNum(2).DiskFileNum(), uint64(i), testValue(cache, "d", 5), LowPriority).Release()
+		}
+		var n int
+		for i := 0; i < 10; i++ {
+			if h := cache.Get(1, base.FileNum(1).DiskFileNum(), uint64(i)); h.Get() != nil {
+				n++
+				h.Release()
+			}
+		}
+		return n
+	}
+	// The 50 bytes of high priority entries fit within the default target,
+	// but not within a quarter of the cache.
+	require.Equal(t, 10, scan(0))
+	require.Equal(t, 10, scan(DefaultHighPriorityRatio))
+	require.Less(t, scan(0.25), 10)
+
+	require.Panics(t, func() { NewWithOptions(Options{Size: 100, HighPriorityRatio: 1.5}) })
+}
+
+func TestCacheLowPriorityLookups(t *testing.T) {
+	cache := newShards(100, 1)
+	defer cache.Unref()
+
+	// Lookups below NormalPriority don't mark entries as referenced, so a
+	// block that is only read by scans isn't protected from eviction.
+	cache.Set(1, base.FileNum(0).DiskFileNum(), 0, testValue(cache, "a", 10)).Release()
+	cache.Set(1, base.FileNum(0).DiskFileNum(), 1, testValue(cache, "b", 10)).Release()
+	s := &cache.shards[0]
+	for _, offset := range []uint64{0, 1} {
+		e := s.blocks.Get(key{fileKey{1, base.FileNum(0).DiskFileNum()}, offset})
+		atomic.StoreInt32(&e.referenced, 0)
+	}
+	cache.GetWithPriority(1, base.FileNum(0).DiskFileNum(), 0, LowPriority).Release()
+	cache.Get(1, base.FileNum(0).DiskFileNum(), 1).Release()
+	for offset, want := range []int32{0, 1} {
+		e := s.blocks.Get(key{fileKey{1, base.FileNum(0).DiskFileNum()}, uint64(offset)})
+		require.Equal(t, want, atomic.LoadInt32(&e.referenced), "offset %d", offset)
+	}
+}
+
+func TestCachePrioritiesRandomized(t *testing.T) {
+	// Interleave lookups and insertions of all priorities, relying on
+	// checkConsistency (and metaCheck in invariants builds) to verify the
+	// cache's accounting.
+	cache := newShards(1000, 1)
+	defer cache.Unref()
+
+	rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	for i := 0; i < 100000; i++ {
+		p := Priority(rng.Intn(int(NumPriorities)))
+		fileNum := base.FileNum(rng.Intn(4)).DiskFileNum()
+		offset := uint64(rng.Intn(200))
+		h := cache.GetWithPriority(1, fileNum, offset, p)
+		if h.Get() == nil {
+			h = cache.SetWithPriority(1, fileNum, offset, testValue(cache, "a", 1+rng.Intn(20)), p)
+		}
+		h.Release()
+		if rng.Intn(1000) == 0 {
+			cache.EvictFile(1, fileNum)
+		}
+	}
+	// Eviction happens before an entry is added, so the cache may exceed its
+	// capacity by up to the size of one entry.
+	require.LessOrEqual(t, cache.Size(), int64(1000+20))
+}
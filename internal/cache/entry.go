@@ -54,6 +54,8 @@ type entry struct {
 	}
 	size  int64
 	ptype entryType
+	// priority is the priority the entry was inserted with.
+	priority Priority
 	// referenced is atomically set to indicate that this entry has been accessed
 	// since the last time one of the clock hands swept it.
 	referenced int32
@@ -0,0 +1,936 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/crc"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// OfferedBlock describes a block that was read from storage after missing in
+// the block cache, and is offered to a SecondaryCache.
+type OfferedBlock struct {
+	FileNum base.DiskFileNum
+	Offset  uint64
+	// Size is the size of the block as stored, including its trailer.
+	Size int
+	// Priority is the priority the block is inserted into the cache with.
+	Priority Priority
+}
+
+// AdmissionPolicy decides which of the blocks offered to a SecondaryCache are
+// written to it. Admit is called by readers on their miss path and must be
+// cheap.
+type AdmissionPolicy interface {
+	Admit(b OfferedBlock) bool
+}
+
+// AdmitFunc adapts a function to the AdmissionPolicy interface.
+type AdmitFunc func(b OfferedBlock) bool
+
+// Admit implements AdmissionPolicy.
+func (f AdmitFunc) Admit(b OfferedBlock) bool {
+	return f(b)
+}
+
+// AdmitAll is an AdmissionPolicy that admits every offered block.
+var AdmitAll AdmissionPolicy = AdmitFunc(func(OfferedBlock) bool { return true })
+
+// AdmitMinPriority returns an AdmissionPolicy that admits the offered blocks
+// that are inserted into the cache with at least the specified priority.
+func AdmitMinPriority(p Priority) AdmissionPolicy {
+	return AdmitFunc(func(b OfferedBlock) bool { return b.Priority >= p })
+}
+
+// SecondaryCacheOptions holds the parameters of a SecondaryCache.
+type SecondaryCacheOptions struct {
+	// FS and Dir are the filesystem and directory the cache's files are stored
+	// in. The directory is created if it doesn't exist, and must not be used
+	// for anything else.
+	FS  vfs.FS
+	Dir string
+	// Capacity is the maximum total size of the cache's files.
+	Capacity int64
+	// SegmentSize is the size the cache's files are grown to before a new one
+	// is started. Space is reclaimed a file at a time, oldest first. The
+	// default is Capacity/8.
+	SegmentSize int64
+	// Admission decides which offered blocks are written to the cache. The
+	// default admits the blocks inserted with at least NormalPriority, so that
+	// blocks read by compactions aren't written.
+	Admission AdmissionPolicy
+	// MaxPendingBytes bounds the size of the offered blocks waiting to be
+	// written. Blocks evicted while the bound is reached are dropped. The
+	// default is 8 MB.
+	MaxPendingBytes int64
+	// Logger is used to log errors reading or writing the cache's files. The
+	// default is base.DefaultLogger.
+	Logger base.Logger
+}
+
+func (o *SecondaryCacheOptions) ensureDefaults() {
+	if o.SegmentSize <= 0 {
+		o.SegmentSize = o.Capacity / 8
+		if o.SegmentSize < 64<<10 {
+			o.SegmentSize = 64 << 10
+		}
+	}
+	if o.Admission == nil {
+		o.Admission = AdmitMinPriority(NormalPriority)
+	}
+	if o.MaxPendingBytes <= 0 {
+		o.MaxPendingBytes = 8 << 20
+	}
+	if o.Logger == nil {
+		o.Logger = base.DefaultLogger
+	}
+}
+
+// SecondaryMetrics holds metrics for a SecondaryCache.
+type SecondaryMetrics struct {
+	// The total size of the cache's files.
+	Size int64
+	// The number of blocks in the cache.
+	Count int64
+	// The number of lookups that found the block in the secondary cache after
+	// missing in the block cache.
+	Hits int64
+	// The number of lookups that missed in both caches.
+	Misses int64
+	// The number and size, as stored in their tables, of the blocks written.
+	Writes     int64
+	WriteBytes int64
+	// The number of offered blocks not admitted by the admission policy.
+	Rejected int64
+	// The number of admitted blocks dropped because too many were waiting to
+	// be written.
+	Dropped int64
+	// The number of blocks removed to stay within the capacity.
+	Evictions int64
+	// The number of blocks that failed their record's checks or the block's
+	// checksum when read back, and were removed.
+	CorruptReads int64
+}
+
+// SecondaryCache is a persistent second tier of the block cache, stored in
+// local files. When attached to a Cache (see Cache.SetSecondary), the readers
+// of the blocks that miss in the Cache look them up in the secondary cache
+// before reading them from storage, and offer it the blocks they read from
+// storage.
+//
+// Blocks are stored as they're stored in their tables, compressed and, for
+// encrypted tables, encrypted, along with their trailer, so that readers
+// verify the block's checksum when it's read back and then decode it as they
+// would a block read from its table. Since a block's stored form is only at
+// hand when it's read, blocks are offered when they're read into the Cache
+// rather than when they're evicted from it, so the blocks in the Cache are
+// also in the secondary cache once written.
+//
+// Blocks are keyed by (file number, offset), so a SecondaryCache holds the
+// blocks of a single store. The store's identity is recorded in the cache's
+// directory by Bind, which removes the blocks of any other store, and the
+// cache can only be attached to one cache ID at a time. Blocks are appended to
+// segment files along with their key, which is checksummed and verified when a
+// block is read back. The segments are scanned when the cache is opened, so
+// the cache survives restarts; blocks of files that were deleted while the
+// cache was closed are removed by RetainFiles.
+//
+// Offered blocks are queued in one of several queues, chosen by the block's
+// key, so that concurrent readers don't contend on a single lock, and are
+// written by a background goroutine.
+type SecondaryCache struct {
+	opts   SecondaryCacheOptions
+	dir    vfs.File
+	closed chan struct{}
+
+	queues [secondaryQueues]secondaryQueue
+	// queued is the number of blocks queued or being written, and
+	// pendingBytes their size.
+	queued       atomic.Int64
+	pendingBytes atomic.Int64
+	// notify is signaled when blocks are queued.
+	notify chan struct{}
+	// closing is closed when the cache is closed, and refuse is set when
+	// offers are no longer accepted, after an error writing a segment or once
+	// the cache is closing.
+	closing chan struct{}
+	refuse  atomic.Bool
+
+	mu struct {
+		sync.Mutex
+		// cond is signaled when the writer finishes a batch.
+		cond  sync.Cond
+		index map[base.DiskFileNum]map[uint64]secondaryLoc
+		// segments are ordered oldest first. The last segment is the one being
+		// written.
+		segments   []*secondarySegment
+		nextSegNum uint64
+		size       int64
+		count      int64
+		// inflight holds the blocks being written by the writer.
+		inflight []*secondaryWrite
+		// disabled is set after an error writing a segment, after which no more
+		// blocks are written.
+		disabled bool
+		closing  bool
+		// attached is the registry of the Cache the cache is attached to, and
+		// attachedID the cache ID, if any.
+		attached   *secondaryRegistry
+		attachedID uint64
+	}
+
+	hits         atomic.Int64
+	misses       atomic.Int64
+	writes       atomic.Int64
+	writeBytes   atomic.Int64
+	rejected     atomic.Int64
+	dropped      atomic.Int64
+	evictions    atomic.Int64
+	corruptReads atomic.Int64
+}
+
+type secondarySegment struct {
+	num  uint64
+	file vfs.File
+	size int64
+	// keys lists the blocks written to the segment. Some of them may since
+	// have been removed from the index, or replaced by a later write.
+	keys []secondaryKey
+	// refs counts the reads of the segment in progress. An obsolete segment's
+	// file is removed once they complete.
+	refs     int32
+	obsolete bool
+}
+
+type secondaryKey struct {
+	fileNum base.DiskFileNum
+	offset  uint64
+}
+
+type secondaryLoc struct {
+	seg *secondarySegment
+	off int64
+	len int64
+}
+
+type secondaryWrite struct {
+	key  secondaryKey
+	data []byte
+	// canceled is set, with the cache's mutex held, if the block's file was
+	// evicted before the block was written.
+	canceled bool
+}
+
+// secondaryQueue holds the offered blocks waiting to be written whose keys map
+// to it.
+type secondaryQueue struct {
+	mu      sync.Mutex
+	pending []*secondaryWrite
+}
+
+const (
+	secondarySegmentPrefix = "SECONDARY-CACHE-"
+	// secondaryIdentityFile holds the identity of the store whose blocks the
+	// cache holds, as recorded by Bind.
+	secondaryIdentityFile = "IDENTITY"
+	secondaryMagic        = "PBLSCv02"
+	secondaryQueues       = 16
+
+	// A record is laid out as:
+	//
+	//	crc     uint32 (checksum of the remainder of the header)
+	//	fileNum uint64
+	//	offset  uint64
+	//	len     uint32 (length of the block, including its trailer)
+	//	block   [len]byte
+	//
+	// The block is verified by its own checksum, in its trailer.
+	secondaryHeaderLen = 24
+)
+
+func secondarySegmentName(num uint64) string {
+	return fmt.Sprintf("%s%06d", secondarySegmentPrefix, num)
+}
+
+// OpenSecondaryCache opens the secondary cache in the specified directory,
+// creating it if it doesn't exist. The blocks stored by a previous instance
+// are retained, up to the capacity.
+func OpenSecondaryCache(opts SecondaryCacheOptions) (*SecondaryCache, error) {
+	if opts.FS == nil {
+		return nil, errors.New("pebble: secondary cache requires a filesystem")
+	}
+	if opts.Capacity <= 0 {
+		return nil, errors.Errorf("pebble: invalid secondary cache capacity %d", errors.Safe(opts.Capacity))
+	}
+	opts.ensureDefaults()
+	if err := opts.FS.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	dir, err := opts.FS.OpenDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &SecondaryCache{
+		opts:    opts,
+		dir:     dir,
+		closed:  make(chan struct{}),
+		notify:  make(chan struct{}, 1),
+		closing: make(chan struct{}),
+	}
+	s.mu.cond.L = &s.mu.Mutex
+	s.mu.index = make(map[base.DiskFileNum]map[uint64]secondaryLoc)
+	if err := s.load(); err != nil {
+		_ = s.closeFiles()
+		return nil, err
+	}
+	if err := s.newSegment(); err != nil {
+		_ = s.closeFiles()
+		return nil, err
+	}
+	s.mu.Lock()
+	s.evictLocked()
+	s.mu.Unlock()
+	go s.writeLoop()
+	return s, nil
+}
+
+// load scans the existing segments and rebuilds the index. Only the records'
+// headers are read; their checksums are verified when they are read back.
+func (s *SecondaryCache) load() error {
+	ls, err := s.opts.FS.List(s.opts.Dir)
+	if err != nil {
+		return err
+	}
+	var nums []uint64
+	for _, name := range ls {
+		if !strings.HasPrefix(name, secondarySegmentPrefix) {
+			continue
+		}
+		num, err := strconv.ParseUint(name[len(secondarySegmentPrefix):], 10, 64)
+		if err != nil {
+			continue
+		}
+		nums = append(nums, num)
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	for _, num := range nums {
+		path := s.opts.FS.PathJoin(s.opts.Dir, secondarySegmentName(num))
+		f, err := s.opts.FS.Open(path)
+		if err != nil {
+			return err
+		}
+		seg := &secondarySegment{num: num, file: f}
+		if err := s.loadSegment(seg); err != nil {
+			// The segment is unusable, most likely because its creation wasn't
+			// completed.
+			s.opts.Logger.Infof("pebble: removing secondary cache segment %s: %v", path, err)
+			_ = f.Close()
+			if err := s.opts.FS.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+		s.mu.segments = append(s.mu.segments, seg)
+		s.mu.size += seg.size
+		s.mu.nextSegNum = num
+	}
+	return nil
+}
+
+func (s *SecondaryCache) loadSegment(seg *secondarySegment) error {
+	info, err := seg.file.Stat()
+	if err != nil {
+		return err
+	}
+	seg.size = info.Size()
+	var magic [len(secondaryMagic)]byte
+	if _, err := seg.file.ReadAt(magic[:], 0); err != nil {
+		return err
+	}
+	if string(magic[:]) != secondaryMagic {
+		return errors.New("invalid magic")
+	}
+	var hdr [secondaryHeaderLen]byte
+	off := int64(len(secondaryMagic))
+	for off+secondaryHeaderLen <= seg.size {
+		if _, err := seg.file.ReadAt(hdr[:], off); err != nil {
+			return err
+		}
+		if crc.New(hdr[4:]).Value() != binary.LittleEndian.Uint32(hdr[0:4]) {
+			// The tail of the segment was torn by a crash, or is corrupt.
+			break
+		}
+		n := secondaryHeaderLen + int64(binary.LittleEndian.Uint32(hdr[20:24]))
+		if off+n > seg.size {
+			// The tail of the segment was torn by a crash.
+			break
+		}
+		k := secondaryKey{
+			fileNum: base.FileNum(binary.LittleEndian.Uint64(hdr[4:12])).DiskFileNum(),
+			offset:  binary.LittleEndian.Uint64(hdr[12:20]),
+		}
+		s.indexLocked(k, secondaryLoc{seg: seg, off: off, len: n})
+		off += n
+	}
+	return nil
+}
+
+// Bind records the identity of the store whose blocks the cache holds. If the
+// cache's directory records a different identity, or none, the cache's blocks
+// may belong to another store, and are removed. Bind is called when a store is
+// opened, before the cache is attached to it, and returns an error if the
+// cache is attached.
+func (s *SecondaryCache) Bind(identity string) error {
+	path := s.opts.FS.PathJoin(s.opts.Dir, secondaryIdentityFile)
+	if f, err := s.opts.FS.Open(path); err == nil {
+		b, err := io.ReadAll(f)
+		_ = f.Close()
+		if err == nil && string(b) == identity {
+			return nil
+		}
+	} else if !oserror.IsNotExist(err) {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.mu.attached != nil {
+		s.mu.Unlock()
+		return errors.Errorf("pebble: secondary cache is attached to cache ID %d", errors.Safe(s.mu.attachedID))
+	}
+	for s.queued.Load() > 0 {
+		s.mu.cond.Wait()
+	}
+	s.mu.Unlock()
+
+	// Start a new segment, and remove the others along with their blocks. The
+	// cache isn't attached, so nothing is written to the old segments while
+	// they're removed.
+	if err := s.newSegment(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	n := len(s.mu.segments) - 1
+	for _, seg := range s.mu.segments[:n] {
+		s.mu.size -= seg.size
+		seg.keys = nil
+		seg.obsolete = true
+		if seg.refs == 0 {
+			s.removeSegment(seg)
+		}
+	}
+	s.mu.segments = s.mu.segments[n:]
+	s.mu.index = make(map[base.DiskFileNum]map[uint64]secondaryLoc)
+	s.mu.count = 0
+	s.mu.Unlock()
+
+	tmpPath := path + ".tmp"
+	f, err := s.opts.FS.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte(identity)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := s.opts.FS.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	return s.dir.Sync()
+}
+
+// newSegment starts a new segment for writes. Called during open and by the
+// writer.
+func (s *SecondaryCache) newSegment() error {
+	s.mu.Lock()
+	s.mu.nextSegNum++
+	num := s.mu.nextSegNum
+	var prev *secondarySegment
+	if n := len(s.mu.segments); n > 0 {
+		prev = s.mu.segments[n-1]
+	}
+	s.mu.Unlock()
+
+	if prev != nil {
+		if err := prev.file.Sync(); err != nil {
+			return err
+		}
+	}
+	f, err := s.opts.FS.Create(s.opts.FS.PathJoin(s.opts.Dir, secondarySegmentName(num)))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte(secondaryMagic)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := s.dir.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seg := &secondarySegment{num: num, file: f, size: int64(len(secondaryMagic))}
+	s.mu.segments = append(s.mu.segments, seg)
+	s.mu.size += seg.size
+	return nil
+}
+
+// indexLocked adds the block at the specified location to the index,
+// replacing an earlier write of the block.
+func (s *SecondaryCache) indexLocked(k secondaryKey, loc secondaryLoc) {
+	m := s.mu.index[k.fileNum]
+	if m == nil {
+		m = make(map[uint64]secondaryLoc)
+		s.mu.index[k.fileNum] = m
+	}
+	if _, ok := m[k.offset]; !ok {
+		s.mu.count++
+	}
+	m[k.offset] = loc
+	loc.seg.keys = append(loc.seg.keys, k)
+}
+
+func (s *SecondaryCache) unindexLocked(k secondaryKey) {
+	m := s.mu.index[k.fileNum]
+	if _, ok := m[k.offset]; !ok {
+		return
+	}
+	delete(m, k.offset)
+	if len(m) == 0 {
+		delete(s.mu.index, k.fileNum)
+	}
+	s.mu.count--
+}
+
+// evictLocked removes the oldest segments until the cache is within its
+// capacity. The segment being written is never removed.
+func (s *SecondaryCache) evictLocked() {
+	for s.mu.size > s.opts.Capacity && len(s.mu.segments) > 1 {
+		seg := s.mu.segments[0]
+		s.mu.segments = s.mu.segments[1:]
+		s.mu.size -= seg.size
+		for _, k := range seg.keys {
+			if loc, ok := s.mu.index[k.fileNum][k.offset]; ok && loc.seg == seg {
+				s.unindexLocked(k)
+				s.evictions.Add(1)
+			}
+		}
+		seg.keys = nil
+		seg.obsolete = true
+		if seg.refs == 0 {
+			s.removeSegment(seg)
+		}
+	}
+}
+
+func (s *SecondaryCache) removeSegment(seg *secondarySegment) {
+	path := s.opts.FS.PathJoin(s.opts.Dir, secondarySegmentName(seg.num))
+	if err := seg.file.Close(); err != nil {
+		s.opts.Logger.Infof("pebble: closing secondary cache segment %s: %v", path, err)
+	}
+	if err := s.opts.FS.Remove(path); err != nil {
+		s.opts.Logger.Infof("pebble: removing secondary cache segment %s: %v", path, err)
+	}
+}
+
+// Offer queues a block that was read from storage to be written, if the
+// admission policy admits it. data is the block as stored in its table,
+// including its trailer, and is copied. Blocks offered while too many are
+// waiting to be written are dropped.
+func (s *SecondaryCache) Offer(b OfferedBlock, data []byte) {
+	if s.refuse.Load() {
+		return
+	}
+	if !s.opts.Admission.Admit(b) {
+		s.rejected.Add(1)
+		return
+	}
+	n := int64(len(data))
+	if s.pendingBytes.Add(n) > s.opts.MaxPendingBytes {
+		s.pendingBytes.Add(-n)
+		s.dropped.Add(1)
+		return
+	}
+	k := secondaryKey{fileNum: b.FileNum, offset: b.Offset}
+	w := &secondaryWrite{key: k, data: append([]byte(nil), data...)}
+	s.queued.Add(1)
+	q := &s.queues[(uint64(k.fileNum.FileNum())*31+k.offset)%secondaryQueues]
+	q.mu.Lock()
+	q.pending = append(q.pending, w)
+	q.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// takeQueuedLocked removes the queued blocks from their queues, and returns them
+// as the writer's inflight blocks. Called with the mutex held.
+func (s *SecondaryCache) takeQueuedLocked() []*secondaryWrite {
+	var batch []*secondaryWrite
+	for i := range s.queues {
+		q := &s.queues[i]
+		q.mu.Lock()
+		batch = append(batch, q.pending...)
+		q.pending = nil
+		q.mu.Unlock()
+	}
+	s.mu.inflight = batch
+	return batch
+}
+
+// writeLoop writes the queued blocks until the cache is closed.
+func (s *SecondaryCache) writeLoop() {
+	defer close(s.closed)
+	for {
+		s.mu.Lock()
+		batch := s.takeQueuedLocked()
+		s.mu.Unlock()
+		if len(batch) == 0 {
+			select {
+			case <-s.notify:
+				continue
+			case <-s.closing:
+			}
+			// Offers are refused once the cache is closing, so the blocks
+			// queued now are the last.
+			s.mu.Lock()
+			batch = s.takeQueuedLocked()
+			s.mu.Unlock()
+			if len(batch) == 0 {
+				return
+			}
+		}
+
+		for _, w := range batch {
+			s.mu.Lock()
+			skip := w.canceled || s.mu.disabled
+			s.mu.Unlock()
+			if !skip {
+				if err := s.write(w); err != nil {
+					s.opts.Logger.Infof("pebble: disabling writes to secondary cache: %v", err)
+					s.mu.Lock()
+					s.mu.disabled = true
+					s.mu.Unlock()
+					s.refuse.Store(true)
+				}
+			}
+			s.pendingBytes.Add(-int64(len(w.data)))
+			w.data = nil
+		}
+		s.mu.Lock()
+		s.mu.inflight = nil
+		s.queued.Add(-int64(len(batch)))
+		s.mu.cond.Broadcast()
+		s.mu.Unlock()
+	}
+}
+
+// write appends a block to the segment being written, starting a new segment
+// if it's full. Called by the writer without the mutex held.
+func (s *SecondaryCache) write(w *secondaryWrite) error {
+	rec := make([]byte, secondaryHeaderLen+len(w.data))
+	binary.LittleEndian.PutUint64(rec[4:12], uint64(w.key.fileNum.FileNum()))
+	binary.LittleEndian.PutUint64(rec[12:20], w.key.offset)
+	binary.LittleEndian.PutUint32(rec[20:24], uint32(len(w.data)))
+	binary.LittleEndian.PutUint32(rec[0:4], crc.New(rec[4:secondaryHeaderLen]).Value())
+	copy(rec[secondaryHeaderLen:], w.data)
+
+	s.mu.Lock()
+	seg := s.mu.segments[len(s.mu.segments)-1]
+	full := seg.size+int64(len(rec)) > s.opts.SegmentSize && seg.size > int64(len(secondaryMagic))
+	s.mu.Unlock()
+	if full {
+		if err := s.newSegment(); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		seg = s.mu.segments[len(s.mu.segments)-1]
+		s.mu.Unlock()
+	}
+
+	// Only the writer appends to the segment, so its size can be read without
+	// the mutex.
+	off := seg.size
+	n := int64(len(rec))
+	if _, err := seg.file.Write(rec); err != nil {
+		return err
+	}
+	s.writes.Add(1)
+	s.writeBytes.Add(int64(len(w.data)))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seg.size += n
+	s.mu.size += n
+	if !w.canceled {
+		// A canceled block remains in the segment until it's removed, but isn't
+		// indexed. If the cache is reopened before then, RetainFiles removes it.
+		s.indexLocked(w.key, secondaryLoc{seg: seg, off: off, len: n})
+	}
+	s.evictLocked()
+	return nil
+}
+
+// ReadBlock reads the block stored for the specified file and offset into
+// buf, which must be the size of the block as stored in its table, including
+// its trailer, and verifies it with verify, which checks the block's
+// checksum. It returns false if the block isn't present, or if it fails its
+// checks, in which case it's removed from the cache.
+func (s *SecondaryCache) ReadBlock(
+	fileNum base.DiskFileNum, offset uint64, buf []byte, verify func([]byte) error,
+) bool {
+	s.mu.Lock()
+	loc, ok := s.mu.index[fileNum][offset]
+	if !ok || s.mu.closing {
+		s.mu.Unlock()
+		s.misses.Add(1)
+		return false
+	}
+	loc.seg.refs++
+	s.mu.Unlock()
+
+	err := s.read(loc, fileNum, offset, buf)
+	if err == nil {
+		err = verify(buf)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loc.seg.refs--
+	if loc.seg.refs == 0 && loc.seg.obsolete {
+		s.removeSegment(loc.seg)
+	}
+	if err != nil {
+		s.opts.Logger.Infof("pebble: secondary cache block %s@%d: %v", fileNum, offset, err)
+		s.corruptReads.Add(1)
+		s.misses.Add(1)
+		if cur, ok := s.mu.index[fileNum][offset]; ok && cur == loc {
+			s.unindexLocked(secondaryKey{fileNum: fileNum, offset: offset})
+		}
+		return false
+	}
+	s.hits.Add(1)
+	return true
+}
+
+func (s *SecondaryCache) read(
+	loc secondaryLoc, fileNum base.DiskFileNum, offset uint64, buf []byte,
+) error {
+	if loc.len != secondaryHeaderLen+int64(len(buf)) {
+		return base.CorruptionErrorf("length mismatch")
+	}
+	var hdr [secondaryHeaderLen]byte
+	for _, r := range [2]struct {
+		b   []byte
+		off int64
+	}{{hdr[:], loc.off}, {buf, loc.off + secondaryHeaderLen}} {
+		if n, err := loc.seg.file.ReadAt(r.b, r.off); n < len(r.b) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	if crc.New(hdr[4:]).Value() != binary.LittleEndian.Uint32(hdr[0:4]) {
+		return base.CorruptionErrorf("checksum mismatch")
+	}
+	if base.FileNum(binary.LittleEndian.Uint64(hdr[4:12])).DiskFileNum() != fileNum ||
+		binary.LittleEndian.Uint64(hdr[12:20]) != offset ||
+		int(binary.LittleEndian.Uint32(hdr[20:24])) != len(buf) {
+		return base.CorruptionErrorf("key mismatch")
+	}
+	return nil
+}
+
+// EvictFile removes the blocks of the specified file from the cache, and
+// cancels their pending writes.
+func (s *SecondaryCache) EvictFile(fileNum base.DiskFileNum) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evictFilesLocked(func(f base.DiskFileNum) bool { return f == fileNum })
+}
+
+// RetainFiles removes the blocks of the files for which live returns false.
+// It's called when a store is opened, so that the blocks of files deleted
+// while the cache wasn't attached to it are removed.
+func (s *SecondaryCache) RetainFiles(live func(base.DiskFileNum) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evictFilesLocked(func(f base.DiskFileNum) bool { return !live(f) })
+}
+
+func (s *SecondaryCache) evictFilesLocked(evict func(base.DiskFileNum) bool) {
+	for fileNum, m := range s.mu.index {
+		if evict(fileNum) {
+			s.mu.count -= int64(len(m))
+			delete(s.mu.index, fileNum)
+		}
+	}
+	cancel := func(ws []*secondaryWrite) {
+		for _, w := range ws {
+			if evict(w.key.fileNum) {
+				w.canceled = true
+			}
+		}
+	}
+	cancel(s.mu.inflight)
+	for i := range s.queues {
+		q := &s.queues[i]
+		q.mu.Lock()
+		cancel(q.pending)
+		q.mu.Unlock()
+	}
+}
+
+// Flush waits for the blocks queued for writing to be written, and syncs them.
+func (s *SecondaryCache) Flush() error {
+	s.mu.Lock()
+	for s.queued.Load() > 0 {
+		s.mu.cond.Wait()
+	}
+	if len(s.mu.segments) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	seg := s.mu.segments[len(s.mu.segments)-1]
+	s.mu.Unlock()
+	return seg.file.Sync()
+}
+
+// Close writes the queued blocks and closes the cache's files. The cache must
+// be detached from any Cache it was attached to before it's closed.
+func (s *SecondaryCache) Close() error {
+	s.mu.Lock()
+	if s.mu.closing {
+		s.mu.Unlock()
+		return errors.New("pebble: secondary cache already closed")
+	}
+	s.mu.closing = true
+	s.mu.Unlock()
+	s.refuse.Store(true)
+	close(s.closing)
+	<-s.closed
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if n := len(s.mu.segments); n > 0 {
+		err = s.mu.segments[n-1].file.Sync()
+	}
+	return firstError(err, s.closeFiles())
+}
+
+func (s *SecondaryCache) closeFiles() error {
+	var err error
+	for _, seg := range s.mu.segments {
+		err = firstError(err, seg.file.Close())
+	}
+	s.mu.segments = nil
+	return firstError(err, s.dir.Close())
+}
+
+func firstError(err0, err1 error) error {
+	if err0 != nil {
+		return err0
+	}
+	return err1
+}
+
+// Metrics returns the metrics for the cache.
+func (s *SecondaryCache) Metrics() SecondaryMetrics {
+	s.mu.Lock()
+	m := SecondaryMetrics{
+		Size:  s.mu.size,
+		Count: s.mu.count,
+	}
+	s.mu.Unlock()
+	m.Hits = s.hits.Load()
+	m.Misses = s.misses.Load()
+	m.Writes = s.writes.Load()
+	m.WriteBytes = s.writeBytes.Load()
+	m.Rejected = s.rejected.Load()
+	m.Dropped = s.dropped.Load()
+	m.Evictions = s.evictions.Load()
+	m.CorruptReads = s.corruptReads.Load()
+	return m
+}
+
+// secondaryRegistry maps cache IDs to the secondary caches attached to them.
+// It's read on every miss and eviction, and updated rarely, so it's copied on
+// write.
+type secondaryRegistry struct {
+	mu sync.Mutex
+	m  atomic.Pointer[map[uint64]*SecondaryCache]
+}
+
+func (r *secondaryRegistry) get(id uint64) *SecondaryCache {
+	if m := r.m.Load(); m != nil {
+		return (*m)[id]
+	}
+	return nil
+}
+
+// set attaches s to the ID, replacing the secondary cache attached to it, or
+// detaches the attached one if s is nil. It returns an error if s is attached
+// to another ID, or to another Cache.
+func (r *secondaryRegistry) set(id uint64, s *SecondaryCache) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev := r.get(id)
+	if s == prev {
+		return nil
+	}
+	if s != nil {
+		s.mu.Lock()
+		attached, attachedID := s.mu.attached, s.mu.attachedID
+		if attached == nil {
+			s.mu.attached, s.mu.attachedID = r, id
+		}
+		s.mu.Unlock()
+		if attached != nil {
+			return errors.Errorf("pebble: secondary cache is already attached to cache ID %d", errors.Safe(attachedID))
+		}
+	}
+	if prev != nil {
+		prev.mu.Lock()
+		prev.mu.attached, prev.mu.attachedID = nil, 0
+		prev.mu.Unlock()
+	}
+	m := make(map[uint64]*SecondaryCache)
+	if old := r.m.Load(); old != nil {
+		for k, v := range *old {
+			m[k] = v
+		}
+	}
+	if s == nil {
+		delete(m, id)
+	} else {
+		m[id] = s
+	}
+	r.m.Store(&m)
+	return nil
+}
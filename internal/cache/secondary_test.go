@@ -0,0 +1,314 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func secondaryTestValue(fileNum, offset uint64) []byte {
+	return bytes.Repeat([]byte(fmt.Sprintf("%06d@%06d;", fileNum, offset)), 10)
+}
+
+// secondaryTestFill offers blocks 0..n-1 of the file to the secondary cache
+// attached to the cache's ID 1, as a reader does after reading them from
+// storage.
+func secondaryTestFill(c *Cache, fileNum uint64, n int, p Priority) {
+	s := c.Secondary(1)
+	for i := 0; i < n; i++ {
+		offset := uint64(i) * 1000
+		b := secondaryTestValue(fileNum, offset)
+		s.Offer(OfferedBlock{
+			FileNum:  base.FileNum(fileNum).DiskFileNum(),
+			Offset:   offset,
+			Size:     len(b),
+			Priority: p,
+		}, b)
+	}
+}
+
+// secondaryTestCheck reads blocks 0..n-1 of the file from the secondary cache
+// attached to the cache's ID 1, and returns the number found. The contents of
+// the blocks found are verified, as a reader verifies their checksums.
+func secondaryTestCheck(t *testing.T, c *Cache, fileNum uint64, n int) int {
+	s := c.Secondary(1)
+	var found int
+	for i := 0; i < n; i++ {
+		offset := uint64(i) * 1000
+		want := secondaryTestValue(fileNum, offset)
+		buf := make([]byte, len(want))
+		verify := func(b []byte) error {
+			if !bytes.Equal(want, b) {
+				return base.CorruptionErrorf("checksum mismatch")
+			}
+			return nil
+		}
+		if s.ReadBlock(base.FileNum(fileNum).DiskFileNum(), offset, buf, verify) {
+			found++
+		}
+	}
+	return found
+}
+
+func openSecondaryTest(t *testing.T, fs vfs.FS, opts SecondaryCacheOptions) *SecondaryCache {
+	opts.FS = fs
+	opts.Dir = "secondary"
+	if opts.Capacity == 0 {
+		opts.Capacity = 1 << 20
+	}
+	if opts.Admission == nil {
+		opts.Admission = AdmitAll
+	}
+	s, err := OpenSecondaryCache(opts)
+	require.NoError(t, err)
+	return s
+}
+
+func TestSecondaryCache(t *testing.T) {
+	const n = 100
+	fs := vfs.NewMem()
+	s := openSecondaryTest(t, fs, SecondaryCacheOptions{})
+
+	c := newShards(2000, 1)
+	require.NoError(t, c.SetSecondary(1, s))
+	require.Equal(t, s, c.Secondary(1))
+	require.Nil(t, c.Secondary(2))
+	secondaryTestFill(c, 1, n, NormalPriority)
+	require.NoError(t, s.Flush())
+	m := s.Metrics()
+	require.Equal(t, int64(n), m.Writes)
+	require.Equal(t, int64(n), m.Count)
+
+	// Every block is read back, and blocks of other files aren't found.
+	require.Equal(t, n, secondaryTestCheck(t, c, 1, n))
+	require.Equal(t, 0, secondaryTestCheck(t, c, 2, n))
+	require.NoError(t, c.SetSecondary(1, nil))
+	require.Nil(t, c.Secondary(1))
+	c.Unref()
+	require.NoError(t, s.Close())
+	m = s.Metrics()
+	require.Equal(t, int64(n), m.Hits)
+	require.Equal(t, int64(n), m.Misses)
+
+	// The blocks written survive reopening the secondary cache, and are found
+	// by a new cache.
+	s = openSecondaryTest(t, fs, SecondaryCacheOptions{})
+	require.Equal(t, m.Count, s.Metrics().Count)
+	c = newShards(1<<20, 1)
+	require.NoError(t, c.SetSecondary(1, s))
+	require.Equal(t, int(m.Count), secondaryTestCheck(t, c, 1, n))
+	require.Equal(t, m.Count, s.Metrics().Hits)
+
+	// Evicting the file from the cache evicts it from the secondary cache.
+	c.EvictFile(1, base.FileNum(1).DiskFileNum())
+	require.Equal(t, int64(0), s.Metrics().Count)
+	require.Equal(t, 0, secondaryTestCheck(t, c, 1, n))
+	require.NoError(t, c.SetSecondary(1, nil))
+	c.Unref()
+	require.NoError(t, s.Close())
+}
+
+func TestSecondaryCacheCorruption(t *testing.T) {
+	const n = 50
+	fs := vfs.NewMem()
+	s := openSecondaryTest(t, fs, SecondaryCacheOptions{})
+	c := newShards(1000, 1)
+	require.NoError(t, c.SetSecondary(1, s))
+	secondaryTestFill(c, 1, n, NormalPriority)
+	require.NoError(t, c.SetSecondary(1, nil))
+	c.Unref()
+	require.NoError(t, s.Close())
+	count := s.Metrics().Count
+	require.Equal(t, int64(n), count)
+
+	// Flip a byte in the block of the first record of the segment, which the
+	// block's checksum catches, and truncate the segment in the middle of its
+	// last record.
+	ls, err := fs.List("secondary")
+	require.NoError(t, err)
+	require.Len(t, ls, 1)
+	path := fs.PathJoin("secondary", ls[0])
+	f, err := fs.Open(path)
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	data[len(secondaryMagic)+secondaryHeaderLen] ^= 0xff
+	data = data[:len(data)-1]
+	f, err = fs.Create(path)
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s = openSecondaryTest(t, fs, SecondaryCacheOptions{})
+	require.Equal(t, count-1, s.Metrics().Count)
+	c = newShards(1<<20, 1)
+	require.NoError(t, c.SetSecondary(1, s))
+	require.Equal(t, int(count-2), secondaryTestCheck(t, c, 1, n))
+	m := s.Metrics()
+	require.Equal(t, int64(1), m.CorruptReads)
+	require.Equal(t, count-2, m.Count)
+	require.NoError(t, c.SetSecondary(1, nil))
+	c.Unref()
+	require.NoError(t, s.Close())
+}
+
+func TestSecondaryCacheCapacity(t *testing.T) {
+	const n = 2000
+	fs := vfs.NewMem()
+	opts := SecondaryCacheOptions{
+		Capacity:    16 << 10,
+		SegmentSize: 4 << 10,
+	}
+	s := openSecondaryTest(t, fs, opts)
+	c := newShards(1000, 1)
+	require.NoError(t, c.SetSecondary(1, s))
+	secondaryTestFill(c, 1, n, NormalPriority)
+	require.NoError(t, s.Flush())
+
+	m := s.Metrics()
+	require.LessOrEqual(t, m.Size, opts.Capacity+opts.SegmentSize)
+	require.Less(t, int64(0), m.Evictions)
+	require.Equal(t, m.Writes, m.Count+m.Evictions)
+	ls, err := fs.List("secondary")
+	require.NoError(t, err)
+	require.LessOrEqual(t, len(ls), 5)
+
+	// The oldest blocks were evicted first.
+	s.mu.Lock()
+	_, ok := s.mu.index[base.FileNum(1).DiskFileNum()][1000]
+	s.mu.Unlock()
+	require.False(t, ok)
+	require.NoError(t, c.SetSecondary(1, nil))
+	c.Unref()
+	require.NoError(t, s.Close())
+}
+
+func TestSecondaryCacheAdmission(t *testing.T) {
+	const n = 100
+	fs := vfs.NewMem()
+	s := openSecondaryTest(t, fs, SecondaryCacheOptions{
+		Admission: AdmitMinPriority(NormalPriority),
+	})
+	c := newShards(2000, 1)
+	require.NoError(t, c.SetSecondary(1, s))
+	secondaryTestFill(c, 1, n, LowPriority)
+	secondaryTestFill(c, 2, n, NormalPriority)
+	require.NoError(t, s.Flush())
+
+	m := s.Metrics()
+	require.Less(t, int64(0), m.Rejected)
+	require.Less(t, int64(0), m.Count)
+	s.mu.Lock()
+	_, ok := s.mu.index[base.FileNum(1).DiskFileNum()]
+	s.mu.Unlock()
+	require.False(t, ok)
+
+	// RetainFiles removes the blocks of the files that aren't live.
+	s.RetainFiles(func(fileNum base.DiskFileNum) bool { return fileNum.FileNum() == 1 })
+	require.Equal(t, int64(0), s.Metrics().Count)
+	require.NoError(t, c.SetSecondary(1, nil))
+	c.Unref()
+	require.NoError(t, s.Close())
+}
+
+func TestSecondaryCacheBind(t *testing.T) {
+	const n = 100
+	fs := vfs.NewMem()
+	s := openSecondaryTest(t, fs, SecondaryCacheOptions{})
+	require.NoError(t, s.Bind("a"))
+	c := newShards(2000, 1)
+	require.NoError(t, c.SetSecondary(1, s))
+
+	// The secondary cache can't be attached to another ID or Cache, or bound
+	// while it's attached.
+	require.Error(t, c.SetSecondary(2, s))
+	c2 := newShards(2000, 1)
+	require.Error(t, c2.SetSecondary(1, s))
+	require.Error(t, s.Bind("b"))
+
+	secondaryTestFill(c, 1, n, NormalPriority)
+	require.NoError(t, s.Flush())
+	count := s.Metrics().Count
+	require.Less(t, int64(0), count)
+	require.NoError(t, c.SetSecondary(1, nil))
+	c.Unref()
+
+	// Once detached, it can be attached elsewhere.
+	require.NoError(t, c2.SetSecondary(1, s))
+	require.NoError(t, c2.SetSecondary(1, nil))
+	c2.Unref()
+	require.NoError(t, s.Close())
+
+	// Binding the same identity retains the blocks, and binding another
+	// removes them, along with the segments holding them.
+	s = openSecondaryTest(t, fs, SecondaryCacheOptions{})
+	require.NoError(t, s.Bind("a"))
+	require.Equal(t, count, s.Metrics().Count)
+	require.NoError(t, s.Bind("b"))
+	require.Equal(t, int64(0), s.Metrics().Count)
+	require.NoError(t, s.Close())
+	ls, err := fs.List("secondary")
+	require.NoError(t, err)
+	sort.Strings(ls)
+	require.Equal(t, []string{secondaryIdentityFile, secondarySegmentName(s.mu.nextSegNum)}, ls)
+
+	s = openSecondaryTest(t, fs, SecondaryCacheOptions{})
+	require.Equal(t, int64(0), s.Metrics().Count)
+	c = newShards(1<<20, 1)
+	require.NoError(t, c.SetSecondary(1, s))
+	require.Equal(t, 0, secondaryTestCheck(t, c, 1, n))
+	require.NoError(t, c.SetSecondary(1, nil))
+	c.Unref()
+	require.NoError(t, s.Close())
+}
+
+// Tests that blocks offered concurrently are all written, and that blocks
+// offered while too many are waiting to be written are dropped.
+func TestSecondaryCacheConcurrentOffers(t *testing.T) {
+	const n = 100
+	fs := vfs.NewMem()
+	s := openSecondaryTest(t, fs, SecondaryCacheOptions{})
+	c := newShards(2000, 1)
+	require.NoError(t, c.SetSecondary(1, s))
+	var wg sync.WaitGroup
+	for f := uint64(1); f <= 8; f++ {
+		wg.Add(1)
+		go func(f uint64) {
+			defer wg.Done()
+			secondaryTestFill(c, f, n, NormalPriority)
+		}(f)
+	}
+	wg.Wait()
+	require.NoError(t, s.Flush())
+	for f := uint64(1); f <= 8; f++ {
+		require.Equal(t, n, secondaryTestCheck(t, c, f, n))
+	}
+	require.NoError(t, c.SetSecondary(1, nil))
+	c.Unref()
+	require.NoError(t, s.Close())
+
+	s = openSecondaryTest(t, vfs.NewMem(), SecondaryCacheOptions{MaxPendingBytes: 1})
+	c = newShards(2000, 1)
+	require.NoError(t, c.SetSecondary(1, s))
+	secondaryTestFill(c, 1, n, NormalPriority)
+	require.NoError(t, s.Flush())
+	m := s.Metrics()
+	require.Equal(t, int64(n), m.Dropped)
+	require.Equal(t, int64(0), m.Writes)
+	require.NoError(t, c.SetSecondary(1, nil))
+	c.Unref()
+	require.NoError(t, s.Close())
+}
@@ -43,11 +43,13 @@ const (
 //
 // When the hasPrefix parameter indicates that the iterator is in prefix
 // iteration mode, BoundedIter elides any spans that do not overlap with the
-// prefix's keyspace. In prefix iteration mode, reverse iteration is disallowed,
-// except for an initial SeekLT with a seek key greater than or equal to the
-// prefix. In prefix iteration mode, the first seek must position the iterator
-// at or immediately before the first fragment covering a key greater than or
-// equal to the prefix.
+// prefix's keyspace. In forward prefix iteration mode, reverse iteration is
+// disallowed, except for an initial SeekLT with a seek key greater than or
+// equal to the prefix. In forward prefix iteration mode, the first seek must
+// position the iterator at or immediately before the first fragment covering a
+// key greater than or equal to the prefix. In reverse prefix iteration mode
+// (see SeekPrefixLT), the iterator is only moved backwards after the initial
+// SeekLT.
 type BoundedIter struct {
 	iter      FragmentIterator
 	iterSpan  *Span
@@ -105,9 +105,10 @@ type InterleavingIter struct {
 	// keys can come directly from the end user, so they're copied into keyBuf
 	// to ensure key stability.
 	keyBuf []byte
-	// nextPrefixBuf is used during SeekPrefixGE calls to store the truncated
-	// upper bound of the returned spans. SeekPrefixGE truncates the returned
-	// spans to an upper bound of the seeked prefix's immediate successor.
+	// nextPrefixBuf is used during SeekPrefixGE and SeekPrefixLT calls to store
+	// the truncated upper bound of the returned spans. Prefix seeks truncate
+	// the returned spans to an upper bound of the seeked prefix's immediate
+	// successor.
 	nextPrefixBuf []byte
 	pointKey      *base.InternalKey
 	pointVal      base.LazyValue
@@ -158,6 +159,9 @@ type InterleavingIter struct {
 	// maskSpanChangedCalled records whether or not the last call to
 	// SpanMask.SpanChanged provided the current span (i.span) or not.
 	maskSpanChangedCalled bool
+	// atPointKey indicates whether the last-returned key is a point key from
+	// pointIter, rather than a span marker.
+	atPointKey bool
 	// prefix records whether the iteator is in prefix mode. During prefix mode,
 	// Pebble will truncate spans to the next prefix. If the iterator
 	// subsequently leaves prefix mode, the existing span cached in i.span must
@@ -168,8 +172,10 @@ type InterleavingIter struct {
 	dir int8
 }
 
-// Assert that *InterleavingIter implements the InternalIterator interface.
+// Assert that *InterleavingIter implements the InternalIterator and
+// KVChecksumIterator interfaces.
 var _ base.InternalIterator = &InterleavingIter{}
+var _ base.KVChecksumIterator = &InterleavingIter{}
 
 // Init initializes the InterleavingIter to interleave point keys from pointIter
 // with key spans from keyspanIter.
@@ -230,13 +236,14 @@ func (i *InterleavingIter) InitSeekGE(
 // It allows for seeding the iterator with the current position of the point
 // iterator.
 func (i *InterleavingIter) InitSeekLT(
-	key []byte, pointKey *base.InternalKey, pointValue base.LazyValue,
+	prefix, key []byte, pointKey *base.InternalKey, pointValue base.LazyValue,
 ) (*base.InternalKey, base.LazyValue) {
 	i.dir = -1
 	i.clearMask()
+	i.prefix = prefix != nil
 	i.pointKey, i.pointVal = pointKey, pointValue
 	i.pointKeyInterleaved = false
-	i.keyspanSeekLT(key)
+	i.keyspanSeekLT(key, prefix)
 	return i.interleaveBackward()
 }
 
@@ -349,7 +356,7 @@ func (i *InterleavingIter) SeekLT(
 	if i.span != nil && i.cmp(key, i.span.Start) > 0 && i.cmp(key, i.span.End) < 0 {
 		// We're seeking within the existing span's bounds. We still might need
 		// truncate the span to the iterator's bounds.
-		i.checkBackwardBound()
+		i.checkBackwardBound(nil /* prefix */)
 		// The span's start key is still not guaranteed to be less than key,
 		// because of the bounds enforcement. Consider the following example:
 		//
@@ -367,13 +374,38 @@ func (i *InterleavingIter) SeekLT(
 		}
 		i.savedKeyspan()
 	} else {
-		i.keyspanSeekLT(key)
+		i.keyspanSeekLT(key, nil /* prefix */)
 	}
 
 	i.dir = -1
 	return i.interleaveBackward()
 }
 
+// SeekPrefixLT implements (base.InternalIterator).SeekPrefixLT.
+//
+// Spans are truncated to the bounds of the seek prefix, analogous to
+// SeekPrefixGE. For example, a SeekPrefixLT('c', 'c@3') truncates a span
+// [a,z) to [c,c\00) and will return a synthetic span marker for the
+// truncated span's start key, c.
+//
+// NB: In accordance with the base.InternalIterator contract:
+//
+//	key ≤ i.upper
+func (i *InterleavingIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	i.clearMask()
+	i.pointKey, i.pointVal = i.pointIter.SeekPrefixLT(prefix, key, flags)
+	i.pointKeyInterleaved = false
+	i.prefix = true
+	// NB: Unlike SeekPrefixGE, we always reposition the keyspan iterator. An
+	// existing span may have been truncated to the bounds of a different
+	// prefix.
+	i.keyspanSeekLT(key, prefix)
+	i.dir = -1
+	return i.interleaveBackward()
+}
+
 // First implements (base.InternalIterator).First.
 func (i *InterleavingIter) First() (*base.InternalKey, base.LazyValue) {
 	i.clearMask()
@@ -394,7 +426,7 @@ func (i *InterleavingIter) Last() (*base.InternalKey, base.LazyValue) {
 	i.pointKey, i.pointVal = i.pointIter.Last()
 	i.pointKeyInterleaved = false
 	i.span = i.keyspanIter.Last()
-	i.checkBackwardBound()
+	i.checkBackwardBound(nil /* prefix */)
 	i.savedKeyspan()
 	i.dir = -1
 	return i.interleaveBackward()
@@ -549,7 +581,7 @@ func (i *InterleavingIter) Prev() (*base.InternalKey, base.LazyValue) {
 				// The last returned key is this key's start boundary, so Prev
 				// past it so we don't return it again.
 				i.span = i.keyspanIter.Prev()
-				i.checkBackwardBound()
+				i.checkBackwardBound(nil /* prefix */)
 				i.savedKeyspan()
 			}
 		} else {
@@ -561,7 +593,7 @@ func (i *InterleavingIter) Prev() (*base.InternalKey, base.LazyValue) {
 			//  points:    (x*)
 			//    span:          [y-z)*
 			i.span = i.keyspanIter.Prev()
-			i.checkBackwardBound()
+			i.checkBackwardBound(nil /* prefix */)
 			i.savedKeyspan()
 		}
 
@@ -592,7 +624,7 @@ func (i *InterleavingIter) Prev() (*base.InternalKey, base.LazyValue) {
 	// Refresh the span if we just returned the span's start boundary key.
 	if i.keyspanInterleaved {
 		i.span = i.keyspanIter.Prev()
-		i.checkBackwardBound()
+		i.checkBackwardBound(nil /* prefix */)
 		i.savedKeyspan()
 	}
 	return i.interleaveBackward()
@@ -770,7 +802,7 @@ func (i *InterleavingIter) interleaveBackward() (*base.InternalKey, base.LazyVal
 			// If we're out of point keys, we need to return a span marker.
 			if i.span.Empty() {
 				i.span = i.keyspanIter.Prev()
-				i.checkBackwardBound()
+				i.checkBackwardBound(nil /* prefix */)
 				i.savedKeyspan()
 				continue
 			}
@@ -781,7 +813,7 @@ func (i *InterleavingIter) interleaveBackward() (*base.InternalKey, base.LazyVal
 			if i.cmp(i.startKey(), i.pointKey.UserKey) > 0 {
 				if i.span.Empty() {
 					i.span = i.keyspanIter.Prev()
-					i.checkBackwardBound()
+					i.checkBackwardBound(nil /* prefix */)
 					i.savedKeyspan()
 					continue
 				}
@@ -832,9 +864,9 @@ func (i *InterleavingIter) keyspanSeekGE(k []byte, prefix []byte) {
 }
 
 // keyspanSeekLT seeks the keyspan iterator to the last span covering a key < k.
-func (i *InterleavingIter) keyspanSeekLT(k []byte) {
+func (i *InterleavingIter) keyspanSeekLT(k []byte, prefix []byte) {
 	i.span = i.keyspanIter.SeekLT(k)
-	i.checkBackwardBound()
+	i.checkBackwardBound(prefix)
 	// The current span's start key is not guaranteed to be less than key,
 	// because of the bounds enforcement. Consider the following example:
 	//
@@ -905,7 +937,7 @@ func (i *InterleavingIter) checkForwardBound(prefix []byte) {
 	}
 }
 
-func (i *InterleavingIter) checkBackwardBound() {
+func (i *InterleavingIter) checkBackwardBound(prefix []byte) {
 	i.truncated = false
 	i.truncatedSpan = Span{}
 	if i.span == nil {
@@ -937,6 +969,28 @@ func (i *InterleavingIter) checkBackwardBound() {
 		}
 		i.truncatedSpan.End = i.upper
 	}
+	// If this is a part of a SeekPrefixLT call, we may also need to truncate to
+	// the prefix's bounds.
+	if prefix != nil {
+		if !i.truncated {
+			i.truncated = true
+			i.truncatedSpan = *i.span
+		}
+		if i.cmp(i.truncatedSpan.End, prefix) <= 0 {
+			// The span lies wholly before the prefix.
+			i.span = nil
+			i.truncated = false
+			i.truncatedSpan = Span{}
+			return
+		}
+		if i.cmp(prefix, i.truncatedSpan.Start) > 0 {
+			i.truncatedSpan.Start = prefix
+		}
+		i.nextPrefixBuf = i.comparer.ImmediateSuccessor(i.nextPrefixBuf[:0], prefix)
+		if i.cmp(i.nextPrefixBuf, i.truncatedSpan.End) < 0 {
+			i.truncatedSpan.End = i.nextPrefixBuf
+		}
+	}
 	if i.truncated && i.comparer.Equal(i.truncatedSpan.Start, i.truncatedSpan.End) {
 		i.span = nil
 	}
@@ -944,6 +998,7 @@ func (i *InterleavingIter) checkBackwardBound() {
 
 func (i *InterleavingIter) yieldNil() (*base.InternalKey, base.LazyValue) {
 	i.spanCoversKey = false
+	i.atPointKey = false
 	i.clearMask()
 	return i.verify(nil, base.LazyValue{})
 }
@@ -951,6 +1006,7 @@ func (i *InterleavingIter) yieldNil() (*base.InternalKey, base.LazyValue) {
 func (i *InterleavingIter) yieldPointKey(covered bool) (*base.InternalKey, base.LazyValue) {
 	i.pointKeyInterleaved = true
 	i.spanCoversKey = covered
+	i.atPointKey = true
 	i.maybeUpdateMask(covered)
 	return i.verify(i.pointKey, i.pointVal)
 }
@@ -962,6 +1018,7 @@ func (i *InterleavingIter) yieldSyntheticSpanMarker(
 	i.spanMarker.Trailer = base.MakeTrailer(base.InternalKeySeqNumMax, i.span.Keys[0].Kind())
 	i.keyspanInterleaved = true
 	i.spanCoversKey = true
+	i.atPointKey = false
 
 	// Truncate the key we return to our lower bound if we have one. Note that
 	// we use the lowerBound function parameter, not i.lower. The lowerBound
@@ -1109,6 +1166,16 @@ func (i *InterleavingIter) Invalidate() {
 	i.pointVal = base.LazyValue{}
 }
 
+// KVChecksum implements base.KVChecksumIterator, returning the checksum of
+// the current point key from the point iterator. Span markers don't have
+// checksums.
+func (i *InterleavingIter) KVChecksum() (base.KVChecksum, bool) {
+	if !i.atPointKey {
+		return 0, false
+	}
+	return base.IterKVChecksum(i.pointIter)
+}
+
 // Error implements (base.InternalIterator).Error.
 func (i *InterleavingIter) Error() error {
 	return firstError(i.pointIter.Error(), i.keyspanIter.Error())
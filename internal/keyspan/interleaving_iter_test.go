@@ -147,6 +147,10 @@ func runInterleavingIterTest(t *testing.T, filename string) {
 					key := []byte(strings.TrimSpace(line[i:]))
 					prefix := key[:testkeys.Comparer.Split(key)]
 					formatKey(iter.SeekPrefixGE(prefix, key, base.SeekGEFlagsNone))
+				case "seek-prefix-lt":
+					key := []byte(strings.TrimSpace(line[i:]))
+					prefix := key[:testkeys.Comparer.Split(key)]
+					formatKey(iter.SeekPrefixLT(prefix, key, base.SeekLTFlagsNone))
 				case "seek-lt":
 					formatKey(iter.SeekLT([]byte(strings.TrimSpace(line[i:])), base.SeekLTFlagsNone))
 				case "set-bounds":
@@ -224,6 +228,12 @@ func (i *pointIterator) SeekLT(
 	return &i.keys[i.index], base.LazyValue{}
 }
 
+func (i *pointIterator) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	return i.SeekLT(key, flags)
+}
+
 func (i *pointIterator) First() (*base.InternalKey, base.LazyValue) {
 	i.index = 0
 	if i.index < 0 || i.index >= len(i.keys) {
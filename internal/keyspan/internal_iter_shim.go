@@ -57,6 +57,13 @@ func (i *InternalIteratorShim) SeekLT(
 	panic("unimplemented")
 }
 
+// SeekPrefixLT implements (base.InternalIterator).SeekPrefixLT.
+func (i *InternalIteratorShim) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	panic("unimplemented")
+}
+
 // First implements (base.InternalIterator).First.
 func (i *InternalIteratorShim) First() (*base.InternalKey, base.LazyValue) {
 	i.span = i.miter.First()
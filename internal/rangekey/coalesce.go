@@ -61,6 +61,9 @@ type UserIteratorConfig struct {
 	litersUsed int
 	onlySets   bool
 	bufs       *Buffers
+	// suffixFilter, if non-nil, is consulted for each RangeKeySet surviving
+	// coalescing. RangeKeySets for which it returns false are removed.
+	suffixFilter func(suffix []byte) bool
 }
 
 // Buffers holds various buffers used for range key iteration. They're exposed
@@ -98,6 +101,7 @@ func (ui *UserIteratorConfig) Init(
 	ui.snapshot = snapshot
 	ui.comparer = comparer
 	ui.onlySets = onlySets
+	ui.suffixFilter = nil
 	ui.miter.Init(comparer.Compare, ui, &bufs.merging, iters...)
 	ui.biter.Init(comparer.Compare, comparer.Split, &ui.miter, lower, upper, hasPrefix, prefix)
 	ui.diter.Init(comparer, &ui.biter, ui, keyspan.StaticDefragmentReducer, &bufs.defragmenting)
@@ -106,6 +110,16 @@ func (ui *UserIteratorConfig) Init(
 	return &ui.diter
 }
 
+// SetSuffixFilter configures a filter over the suffixes of RangeKeySets. After
+// range keys are resolved at the snapshot sequence number, RangeKeySets whose
+// suffix the filter rejects are removed from the transformed spans. Spans left
+// without any keys are elided by the interleaving iterator like any other empty
+// span. SetSuffixFilter must be called after Init and before any other method
+// on the iterator.
+func (ui *UserIteratorConfig) SetSuffixFilter(filter func(suffix []byte) bool) {
+	ui.suffixFilter = filter
+}
+
 // AddLevel adds a new level to the bottom of the iterator stack. AddLevel
 // must be called after Init and before any other method on the iterator.
 func (ui *UserIteratorConfig) AddLevel(iter keyspan.FragmentIterator) {
@@ -159,6 +173,9 @@ func (ui *UserIteratorConfig) Transform(cmp base.Compare, s keyspan.Span, dst *k
 			if invariants.Enabled && len(dst.Keys) > 0 && cmp(dst.Keys[len(dst.Keys)-1].Suffix, keys[i].Suffix) > 0 {
 				panic("pebble: keys unexpectedly not in ascending suffix order")
 			}
+			if ui.suffixFilter != nil && !ui.suffixFilter(keys[i].Suffix) {
+				continue
+			}
 			dst.Keys = append(dst.Keys, keys[i])
 		case base.InternalKeyKindRangeKeyUnset:
 			if invariants.Enabled && len(dst.Keys) > 0 && cmp(dst.Keys[len(dst.Keys)-1].Suffix, keys[i].Suffix) > 0 {
@@ -33,6 +33,8 @@ var MaxSuffixLen = 1 + len(fmt.Sprintf("%d", math.MaxInt64))
 var Comparer *base.Comparer = &base.Comparer{
 	Compare: compare,
 	Equal:   func(a, b []byte) bool { return compare(a, b) == 0 },
+	// Prefixes are compared with bytes.Compare.
+	BytewisePrefixOrdering: true,
 	AbbreviatedKey: func(k []byte) uint64 {
 		return base.DefaultComparer.AbbreviatedKey(k[:split(k)])
 	},
@@ -9,6 +9,7 @@ import (
 	"context"
 	"io"
 	"sync"
+	"time"
 	"unsafe"
 
 	"github.com/cockroachdb/errors"
@@ -85,6 +86,7 @@ const (
 const readBytesPeriod uint64 = 1 << 16
 
 var errReversePrefixIteration = errors.New("pebble: unsupported reverse prefix iteration")
+var errForwardPrefixIteration = errors.New("pebble: unsupported forward prefix iteration")
 
 // IteratorMetrics holds per-iterator metrics. These do not change over the
 // lifetime of the iterator.
@@ -181,7 +183,9 @@ type Iterator struct {
 	// short-lived (since they pin memtables and sstables), (b) plumbing a
 	// context into every method is very painful, (c) they do not (yet) respect
 	// context cancellation and are only used for tracing.
-	ctx       context.Context
+	ctx context.Context
+	// span is the iterator's span, if Options.Tracer is set. ctx holds it.
+	span      Span
 	opts      IterOptions
 	merge     Merge
 	comparer  base.Comparer
@@ -197,7 +201,9 @@ type Iterator struct {
 	rangeKey *iteratorRangeKeyState
 	// rangeKeyMasking holds state for range-key masking of point keys.
 	rangeKeyMasking rangeKeyMasking
-	err             error
+	// mvcc holds state for MVCC reads configured through IterOptions.MVCC.
+	mvcc mvccIterState
+	err  error
 	// When iterValidityState=IterValid, key represents the current key, which
 	// is backed by keyBuf.
 	key    []byte
@@ -274,6 +280,10 @@ type Iterator struct {
 	pos iterPos
 	// Relates to the prefixOrFullSeekKey field above.
 	hasPrefix bool
+	// prefixReverse is only meaningful when hasPrefix is true. It is true if
+	// the iterator entered prefix iteration mode through SeekPrefixLT, and
+	// false if through SeekPrefixGE.
+	prefixReverse bool
 	// Used for deriving the value of SeekPrefixGE(..., trySeekUsingNext),
 	// and SeekGE/SeekLT optimizations
 	lastPositioningOp lastPositioningOpKind
@@ -900,6 +910,13 @@ func (i *Iterator) findPrevEntry(limit []byte) {
 				return
 			}
 		}
+		// NB: If the iterator is valid, key has the same user key as i.key and
+		// necessarily the same prefix.
+		if i.hasPrefix && i.iterValidityState != IterValid {
+			if n := i.split(key.UserKey); !i.equal(i.prefixOrFullSeekKey, key.UserKey[:n]) {
+				return
+			}
+		}
 
 		switch key.Kind() {
 		case InternalKeyKindRangeKeySet:
@@ -1152,6 +1169,47 @@ func (i *Iterator) SeekGE(key []byte) bool {
 // guarantees it will surface any range keys with bounds overlapping the
 // keyspace [key, limit).
 func (i *Iterator) SeekGEWithLimit(key []byte, limit []byte) IterValidityState {
+	if i.readState == nil || (!i.readState.db.timeOperations() && i.span == nil) {
+		// The iterator isn't reading from a DB, so there's nowhere to record
+		// the latency, or the latency isn't needed.
+		return i.seekGEWithLimitOrMVCC(key, limit)
+	}
+	d := i.readState.db
+	startTime := time.Now()
+	var statsBefore InternalIteratorStats
+	if d.opts.SlowOperationThreshold > 0 || i.span != nil {
+		statsBefore = i.stats.InternalStats
+	}
+	v := i.seekGEWithLimitOrMVCC(key, limit)
+	duration := time.Since(startTime)
+	if d.opts.RecordLatencies {
+		d.latency.iterSeekGE.record(duration)
+	}
+	if i.span != nil {
+		i.maybeTraceSeek("seek-ge", startTime, &statsBefore)
+	}
+	if d.isSlowOperation(duration) {
+		info := SlowOperationInfo{
+			Op:       "iter-seek-ge",
+			Duration: duration,
+			Stats:    subInternalIteratorStats(&i.stats.InternalStats, &statsBefore),
+		}
+		if i.merging != nil {
+			info.LevelsVisited = len(i.merging.levels)
+		}
+		d.opts.EventListener.SlowOperation(info)
+	}
+	return v
+}
+
+func (i *Iterator) seekGEWithLimitOrMVCC(key []byte, limit []byte) IterValidityState {
+	if i.mvcc.enabled {
+		return i.mvccSeekGE(key, limit)
+	}
+	return i.seekGEWithLimit(key, limit)
+}
+
+func (i *Iterator) seekGEWithLimit(key []byte, limit []byte) IterValidityState {
 	if i.rangeKey != nil {
 		// NB: Check Valid() before clearing requiresReposition.
 		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
@@ -1316,6 +1374,24 @@ func (i *Iterator) SeekGEWithLimit(key []byte, limit []byte) IterValidityState {
 // ImmediateSuccessor method. For example, a SeekPrefixGE("a@9") call with the
 // prefix "a" will truncate range key bounds to [a,ImmediateSuccessor(a)].
 func (i *Iterator) SeekPrefixGE(key []byte) bool {
+	if i.span == nil {
+		return i.seekPrefixGEOrMVCC(key)
+	}
+	startTime := time.Now()
+	statsBefore := i.stats.InternalStats
+	v := i.seekPrefixGEOrMVCC(key)
+	i.maybeTraceSeek("seek-prefix-ge", startTime, &statsBefore)
+	return v
+}
+
+func (i *Iterator) seekPrefixGEOrMVCC(key []byte) bool {
+	if i.mvcc.enabled {
+		return i.mvccSeekPrefixGE(key)
+	}
+	return i.seekPrefixGE(key)
+}
+
+func (i *Iterator) seekPrefixGE(key []byte) bool {
 	if i.rangeKey != nil {
 		// NB: Check Valid() before clearing requiresReposition.
 		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
@@ -1391,6 +1467,7 @@ func (i *Iterator) SeekPrefixGE(key []byte) bool {
 		i.prefixOrFullSeekKey = i.prefixOrFullSeekKey[:prefixLen]
 	}
 	i.hasPrefix = true
+	i.prefixReverse = false
 	copy(i.prefixOrFullSeekKey, keyPrefix)
 
 	if lowerBound := i.opts.GetLowerBound(); lowerBound != nil && i.cmp(key, lowerBound) < 0 {
@@ -1446,6 +1523,24 @@ func (i *Iterator) SeekLT(key []byte) bool {
 // guarantees it will surface any range keys with bounds overlapping the
 // keyspace up to limit.
 func (i *Iterator) SeekLTWithLimit(key []byte, limit []byte) IterValidityState {
+	if i.span == nil {
+		return i.seekLTWithLimitOrMVCC(key, limit)
+	}
+	startTime := time.Now()
+	statsBefore := i.stats.InternalStats
+	v := i.seekLTWithLimitOrMVCC(key, limit)
+	i.maybeTraceSeek("seek-lt", startTime, &statsBefore)
+	return v
+}
+
+func (i *Iterator) seekLTWithLimitOrMVCC(key []byte, limit []byte) IterValidityState {
+	if i.mvcc.enabled {
+		return i.mvccSeekLT(key, limit)
+	}
+	return i.seekLTWithLimit(key, limit)
+}
+
+func (i *Iterator) seekLTWithLimit(key []byte, limit []byte) IterValidityState {
 	if i.rangeKey != nil {
 		// NB: Check Valid() before clearing requiresReposition.
 		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
@@ -1520,9 +1615,103 @@ func (i *Iterator) SeekLTWithLimit(key []byte, limit []byte) IterValidityState {
 	return i.iterValidityState
 }
 
+// SeekPrefixLT moves the iterator to the last key/value pair whose key is less
+// than the given key and which has the same "prefix" as the given key. The
+// prefix for a key is determined by the user-defined Comparer.Split function.
+// The iterator will not observe keys not matching the "prefix" of the search
+// key. Calling SeekPrefixLT puts the iterator in prefix iteration mode. The
+// iterator remains in prefix iteration until a subsequent call to another
+// absolute positioning method (SeekGE, SeekLT, First, Last). Forward iteration
+// (Next) is not supported when an iterator is in reverse prefix iteration
+// mode, but Prev steps to earlier keys within the prefix. Returns true if the
+// iterator is pointing at a valid entry and false otherwise.
+//
+// SeekPrefixLT is the reverse counterpart of SeekPrefixGE, and similarly
+// takes advantage of bloom filters created on the "prefix" to avoid reading
+// sstables that cannot contain the prefix. Using the Split function from the
+// SeekPrefixGE example, with a Comparer that sorts the versions of a prefix
+// in decreasing order (as MVCC comparers such as testkeys.Comparer do), the
+// keys "a@1", "a@2", "aa@3", "aa@4" sort as "a@2", "a@1", "aa@4", "aa@3":
+//
+//	SeekPrefixLT("aa@2") -> "aa@3"
+//	Prev()               -> "aa@4"
+//	Prev()               -> EOF
+//
+// With such a Comparer, a common use is to find the oldest version of a key
+// that is newer than some version, and to step to successively newer versions
+// with Prev.
+//
+// When iterating with range keys enabled, all range keys encountered are
+// truncated to the seek key's prefix's bounds. As with SeekPrefixGE, this
+// requires that the database's Comparer is configured with an
+// ImmediateSuccessor method.
+func (i *Iterator) SeekPrefixLT(key []byte) bool {
+	if i.mvcc.enabled {
+		i.err = errors.New("pebble: SeekPrefixLT unsupported with MVCC reads")
+		i.iterValidityState = IterExhausted
+		return false
+	}
+	if i.rangeKey != nil {
+		// NB: Check Valid() before clearing requiresReposition.
+		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
+		// If we have a range key but did not expose it at the previous iterator
+		// position (because the iterator was not at a valid position), updated
+		// must be true. See the comment in SeekPrefixGE.
+		i.rangeKey.updated = i.rangeKey.hasRangeKey && !i.Valid() && i.opts.rangeKeys()
+	}
+	i.lastPositioningOp = unknownLastPositionOp
+	i.batchJustRefreshed = false
+	i.requiresReposition = false
+	i.err = nil // clear cached iteration error
+	i.stats.ReverseSeekCount[InterfaceCall]++
+	if i.comparer.Split == nil {
+		panic("pebble: split must be provided for SeekPrefixLT")
+	}
+	if i.comparer.ImmediateSuccessor == nil && i.opts.KeyTypes != IterKeyTypePointsOnly {
+		panic("pebble: ImmediateSuccessor must be provided for SeekPrefixLT with range keys")
+	}
+	prefixLen := i.split(key)
+	keyPrefix := key[:prefixLen]
+	// Make a copy of the prefix so that modifications to the key after
+	// SeekPrefixLT returns does not affect the stored prefix.
+	if cap(i.prefixOrFullSeekKey) < prefixLen {
+		i.prefixOrFullSeekKey = make([]byte, prefixLen)
+	} else {
+		i.prefixOrFullSeekKey = i.prefixOrFullSeekKey[:prefixLen]
+	}
+	i.hasPrefix = true
+	i.prefixReverse = true
+	copy(i.prefixOrFullSeekKey, keyPrefix)
+
+	if upperBound := i.opts.GetUpperBound(); upperBound != nil && i.cmp(key, upperBound) > 0 {
+		if n := i.split(upperBound); !bytes.Equal(i.prefixOrFullSeekKey, upperBound[:n]) {
+			i.err = errors.New("pebble: SeekPrefixLT supplied with key outside of upper bound")
+			i.iterValidityState = IterExhausted
+			return false
+		}
+		key = upperBound
+	} else if lowerBound := i.opts.GetLowerBound(); lowerBound != nil && i.cmp(key, lowerBound) < 0 {
+		// No key less than the lower bound may be returned, so the iterator
+		// will be exhausted.
+		key = lowerBound
+	}
+	i.iterKey, i.iterValue = i.iter.SeekPrefixLT(i.prefixOrFullSeekKey, key, base.SeekLTFlagsNone)
+	i.stats.ReverseSeekCount[InternalIterCall]++
+	i.findPrevEntry(nil)
+	i.maybeSampleRead()
+	return i.iterValidityState == IterValid
+}
+
 // First moves the iterator the the first key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
 func (i *Iterator) First() bool {
+	if i.mvcc.enabled {
+		return i.mvccFirst()
+	}
+	return i.first()
+}
+
+func (i *Iterator) first() bool {
 	if i.rangeKey != nil {
 		// NB: Check Valid() before clearing requiresReposition.
 		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
@@ -1555,6 +1744,13 @@ func (i *Iterator) First() bool {
 // Last moves the iterator the the last key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
 func (i *Iterator) Last() bool {
+	if i.mvcc.enabled {
+		return i.mvccLast()
+	}
+	return i.last()
+}
+
+func (i *Iterator) last() bool {
 	if i.rangeKey != nil {
 		// NB: Check Valid() before clearing requiresReposition.
 		i.rangeKey.prevPosHadRangeKey = i.rangeKey.hasRangeKey && i.Valid()
@@ -1587,6 +1783,9 @@ func (i *Iterator) Last() bool {
 // Next moves the iterator to the next key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
 func (i *Iterator) Next() bool {
+	if i.mvcc.enabled {
+		return i.mvccNext(nil) == IterValid
+	}
 	return i.nextWithLimit(nil) == IterValid
 }
 
@@ -1601,6 +1800,9 @@ func (i *Iterator) Next() bool {
 // guarantees it will surface any range keys with bounds overlapping the
 // keyspace up to limit.
 func (i *Iterator) NextWithLimit(limit []byte) IterValidityState {
+	if i.mvcc.enabled {
+		return i.mvccNext(limit)
+	}
 	return i.nextWithLimit(limit)
 }
 
@@ -1616,6 +1818,11 @@ func (i *Iterator) NextWithLimit(limit []byte) IterValidityState {
 // upper-bound that is a versioned MVCC key (see the comment for
 // Comparer.Split). It returns an error in this case.
 func (i *Iterator) NextPrefix() bool {
+	if i.mvcc.enabled {
+		// MVCC iteration already skips the remaining versions of the current
+		// prefix when stepping forward.
+		return i.mvccNext(nil) == IterValid
+	}
 	if i.nextPrefixNotPermittedByUpperBound {
 		i.lastPositioningOp = unknownLastPositionOp
 		i.requiresReposition = false
@@ -1625,6 +1832,9 @@ func (i *Iterator) NextPrefix() bool {
 		return false
 	}
 	if i.hasPrefix {
+		if i.prefixReverse {
+			i.err = errForwardPrefixIteration
+		}
 		i.iterValidityState = IterExhausted
 		return false
 	}
@@ -1758,6 +1968,11 @@ func (i *Iterator) internalNextPrefix(currKeyPrefixLen int) {
 func (i *Iterator) nextWithLimit(limit []byte) IterValidityState {
 	i.stats.ForwardStepCount[InterfaceCall]++
 	if i.hasPrefix {
+		if i.prefixReverse {
+			i.err = errForwardPrefixIteration
+			i.iterValidityState = IterExhausted
+			return i.iterValidityState
+		}
 		if limit != nil {
 			i.err = errors.New("cannot use limit with prefix iteration")
 			i.iterValidityState = IterExhausted
@@ -1859,7 +2074,26 @@ func (i *Iterator) Prev() bool {
 // guarantees it will surface any range keys with bounds overlapping the
 // keyspace up to limit.
 func (i *Iterator) PrevWithLimit(limit []byte) IterValidityState {
+	if i.mvcc.enabled {
+		return i.mvccPrev(limit)
+	}
+	return i.prevWithLimit(limit)
+}
+
+func (i *Iterator) prevWithLimit(limit []byte) IterValidityState {
 	i.stats.ReverseStepCount[InterfaceCall]++
+	if i.hasPrefix && i.prefixReverse {
+		if limit != nil {
+			i.err = errors.New("cannot use limit with prefix iteration")
+			i.iterValidityState = IterExhausted
+			return i.iterValidityState
+		} else if i.iterValidityState == IterExhausted {
+			// No-op, already exhausted. The internal iterator may be positioned
+			// before the iteration prefix, and it is not permitted to Prev it
+			// further.
+			return i.iterValidityState
+		}
+	}
 	if i.err != nil {
 		return i.iterValidityState
 	}
@@ -1881,7 +2115,7 @@ func (i *Iterator) PrevWithLimit(limit []byte) IterValidityState {
 	}
 	i.lastPositioningOp = unknownLastPositionOp
 	i.requiresReposition = false
-	if i.hasPrefix {
+	if i.hasPrefix && !i.prefixReverse {
 		i.err = errReversePrefixIteration
 		i.iterValidityState = IterExhausted
 		return i.iterValidityState
@@ -2191,6 +2425,9 @@ func (i *Iterator) Close() error {
 		}
 	}
 	err := i.err
+	if i.span != nil {
+		i.endIteratorSpan()
+	}
 
 	if i.readState != nil {
 		if i.readSampling.pendingCompactions.size > 0 {
@@ -2399,9 +2636,14 @@ func (i *Iterator) SetOptions(o *IterOptions) {
 	// we need to reconstruct the iterator stacks. If they both supply a table
 	// filter, we can't be certain that it's the same filter since we have no
 	// mechanism to compare the filter closures.
+	//
+	// Similarly, if either the original options or the new options configure
+	// MVCC reads, the iterator stacks may hold the wrong block-property filter
+	// and range-key filter, so reconstruct them.
 	closeBoth := i.err != nil ||
 		o.OnlyReadGuaranteedDurable != i.opts.OnlyReadGuaranteedDurable ||
-		o.TableFilter != nil || i.opts.TableFilter != nil
+		o.TableFilter != nil || i.opts.TableFilter != nil ||
+		o.MVCC != nil || i.opts.MVCC != nil
 
 	// If either options specify block property filters for an iterator stack,
 	// reconstruct it.
@@ -2506,7 +2748,7 @@ func (i *Iterator) SetOptions(o *IterOptions) {
 		(i.pointIter != nil || !i.opts.pointKeys()) &&
 		(i.rangeKey != nil || !i.opts.rangeKeys() || i.opts.KeyTypes == IterKeyTypePointsAndRanges) &&
 		i.equal(o.RangeKeyMasking.Suffix, i.opts.RangeKeyMasking.Suffix) &&
-		o.UseL6Filters == i.opts.UseL6Filters {
+		o.UseL6Filters == i.opts.UseL6Filters && o.DisableCacheFill == i.opts.DisableCacheFill {
 		// The options are identical, so we can likely use the fast path. In
 		// addition to all the above constraints, we cannot use the fast path if
 		// configured to perform lazy combined iteration but an indexed batch
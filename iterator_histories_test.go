@@ -97,6 +97,10 @@ func TestIterHistories(t *testing.T) {
 					for i := range opts.Levels {
 						opts.Levels[i].FilterPolicy = fp
 					}
+				case "mvcc-collector":
+					opts.BlockPropertyCollectors = append(opts.BlockPropertyCollectors,
+						NewMVCCBlockPropertyCollector(testkeysMVCCBlockPropertyName,
+							testkeys.Comparer.Split, decodeTestkeysTimestamp))
 				case "merger":
 					switch cmdArg.Vals[0] {
 					case "appender":
@@ -232,7 +236,19 @@ func TestIterHistories(t *testing.T) {
 				d.waitTableStats()
 				d.mu.Unlock()
 				m := d.Metrics()
+				if td.HasArg("gc") {
+					return fmt.Sprintf("Metrics.Compact.GCDroppedBytes = %d\n", m.Compact.GCDroppedBytes)
+				}
 				return fmt.Sprintf("Metrics.Keys.RangeKeySetsCount = %d\n", m.Keys.RangeKeySetsCount)
+			case "set-gc-threshold":
+				var start, end, threshold string
+				td.ScanArgs(t, "start", &start)
+				td.ScanArgs(t, "end", &end)
+				td.MaybeScanArgs(t, "threshold", &threshold)
+				if err := d.SetGCThreshold([]byte(start), []byte(end), []byte(threshold)); err != nil {
+					return err.Error()
+				}
+				return ""
 			case "mutate":
 				var batchName string
 				td.ScanArgs(t, "batch", &batchName)
@@ -327,6 +343,16 @@ func TestIterHistories(t *testing.T) {
 						}()
 					case "use-l6-filter":
 						o.UseL6Filters = true
+					case "mvcc-read":
+						ts, err := strconv.ParseUint(arg.Vals[0], 10, 64)
+						if err != nil {
+							return err.Error()
+						}
+						o.MVCC = testkeysMVCCReadOptions(ts)
+					case "key-types":
+						if _, err := parseIterOptions(o, o, []string{"key-types=" + arg.Vals[0]}); err != nil {
+							return err.Error()
+						}
 					}
 				}
 				var iter *Iterator
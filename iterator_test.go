@@ -19,6 +19,7 @@ import (
 
 	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/bytealloc"
 	"github.com/cockroachdb/pebble/internal/keyspan"
@@ -117,6 +118,12 @@ func (f *fakeIter) SeekLT(key []byte, flags base.SeekLTFlags) (*InternalKey, bas
 	return nil, base.LazyValue{}
 }
 
+func (f *fakeIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	return f.SeekLT(key, flags)
+}
+
 func (f *fakeIter) First() (*InternalKey, base.LazyValue) {
 	f.valid = false
 	f.index = -1
@@ -302,6 +309,12 @@ func (i *invalidatingIter) SeekLT(
 	return i.update(i.iter.SeekLT(key, flags))
 }
 
+func (i *invalidatingIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	return i.update(i.iter.SeekPrefixLT(prefix, key, flags))
+}
+
 func (i *invalidatingIter) First() (*InternalKey, base.LazyValue) {
 	return i.update(i.iter.First())
 }
@@ -1450,6 +1463,129 @@ func TestIteratorRandomizedBlockIntervalFilter(t *testing.T) {
 	require.Equal(t, 0, len(matchingKeyValues))
 }
 
+// TestIteratorMVCCRandomized compares MVCC reads against the newest visible
+// versions computed from an ordinary scan of the same keys.
+func TestIteratorMVCCRandomized(t *testing.T) {
+	seed := *seed
+	if seed == 0 {
+		seed = uint64(time.Now().UnixNano())
+		t.Logf("seed: %d", seed)
+	}
+	rng := rand.New(rand.NewSource(seed))
+	opts := &Options{
+		FS:                 vfs.NewMem(),
+		Comparer:           testkeys.Comparer,
+		FormatMajorVersion: FormatNewest,
+		BlockPropertyCollectors: []func() BlockPropertyCollector{
+			NewMVCCBlockPropertyCollector(testkeysMVCCBlockPropertyName,
+				testkeys.Comparer.Split, decodeTestkeysTimestamp),
+		},
+	}
+	opts.EnsureDefaults()
+	for i := range opts.Levels {
+		opts.Levels[i].BlockSize = 1 << rng.Intn(8)
+		opts.Levels[i].IndexBlockSize = 1 << rng.Intn(8)
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	const maxTimestamp = 20
+	randPrefix := func() []byte {
+		return []byte{byte('a' + rng.Intn(26))}
+	}
+	for i := 0; i < 10; i++ {
+		b := d.NewBatch()
+		for j := 0; j < 50; j++ {
+			key := randPrefix()
+			if ts := rng.Intn(maxTimestamp + 1); ts > 0 {
+				key = append(key, []byte(fmt.Sprintf("@%d", ts))...)
+			}
+			if rng.Intn(5) == 0 {
+				require.NoError(t, b.Delete(key, nil))
+			} else {
+				require.NoError(t, b.Set(key, []byte(fmt.Sprint(i, j)), nil))
+			}
+		}
+		require.NoError(t, b.Commit(nil))
+		if rng.Intn(2) == 0 {
+			require.NoError(t, d.Flush())
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		readTS := uint64(rng.Intn(maxTimestamp + 2))
+		lower, upper := randPrefix(), randPrefix()
+		if bytes.Compare(lower, upper) > 0 {
+			lower, upper = upper, lower
+		}
+
+		// Compute the newest visible version of each prefix within the bounds.
+		var expected []string
+		var lastPrefix []byte
+		iter := d.NewIter(&IterOptions{LowerBound: lower, UpperBound: upper})
+		for valid := iter.First(); valid; valid = iter.Next() {
+			k := iter.Key()
+			n := testkeys.Comparer.Split(k)
+			if lastPrefix != nil && bytes.Equal(k[:n], lastPrefix) {
+				continue
+			}
+			if ts, ok := decodeTestkeysTimestamp(k[n:]); ok && ts > readTS {
+				continue
+			}
+			lastPrefix = append(lastPrefix[:0], k[:n]...)
+			expected = append(expected, string(k))
+		}
+		require.NoError(t, iter.Close())
+
+		iter = d.NewIter(&IterOptions{
+			LowerBound: lower,
+			UpperBound: upper,
+			MVCC:       testkeysMVCCReadOptions(readTS),
+		})
+		var forward, reverse []string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			forward = append(forward, string(iter.Key()))
+		}
+		for valid := iter.Last(); valid; valid = iter.Prev() {
+			reverse = append(reverse, string(iter.Key()))
+		}
+		require.Equal(t, expected, forward, "read timestamp %d, bounds [%s,%s)", readTS, lower, upper)
+		for j := range reverse {
+			require.Equal(t, expected[len(expected)-1-j], reverse[j])
+		}
+		require.Equal(t, len(expected), len(reverse))
+
+		// Seeking to a prefix should surface the newest visible version of the
+		// first prefix at or after (for SeekGE) or before (for SeekLT) it.
+		for j := 0; j < 10; j++ {
+			seekKey := randPrefix()
+			ge := sort.Search(len(expected), func(k int) bool {
+				return testkeys.Comparer.Compare([]byte(expected[k]), seekKey) >= 0
+			})
+			if bytes.Compare(seekKey, lower) < 0 {
+				ge = 0
+			}
+			if ge < len(expected) && bytes.Compare(seekKey, upper) < 0 {
+				require.True(t, iter.SeekGE(seekKey))
+				require.Equal(t, expected[ge], string(iter.Key()))
+			} else {
+				require.False(t, iter.SeekGE(seekKey))
+			}
+			if bytes.Compare(seekKey, upper) > 0 {
+				ge = len(expected)
+			}
+			if ge > 0 && bytes.Compare(seekKey, lower) > 0 {
+				require.True(t, iter.SeekLT(seekKey))
+				require.Equal(t, expected[ge-1], string(iter.Key()))
+			} else {
+				require.False(t, iter.SeekLT(seekKey))
+			}
+		}
+		require.NoError(t, iter.Close())
+	}
+}
+
 func TestIteratorGuaranteedDurable(t *testing.T) {
 	mem := vfs.NewMem()
 	opts := &Options{FS: mem}
@@ -1704,6 +1840,51 @@ func TestIteratorStatsMerge(t *testing.T) {
 	require.Equal(t, expected, s)
 }
 
+func TestIteratorRangeFilter(t *testing.T) {
+	opts := &Options{
+		FS: vfs.NewMem(),
+		Levels: []LevelOptions{{
+			FilterPolicy:         bloom.FilterPolicy(10),
+			RangeFilterPrefixLen: 3,
+		}},
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("0015"), nil, nil))
+	require.NoError(t, d.Set([]byte("0020"), nil, nil))
+	require.NoError(t, d.Compact([]byte("0"), []byte("1"), false /* parallelize */))
+	// The L0 table's range filter contains only the truncated prefix 050, but
+	// its range deletion must still delete the keys in L6.
+	require.NoError(t, d.DeleteRange([]byte("0010"), []byte("0030"), nil))
+	require.NoError(t, d.Set([]byte("0500"), nil, nil))
+	require.NoError(t, d.Flush())
+
+	scan := func(iter *Iterator) string {
+		var keys []string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		return strings.Join(keys, ",")
+	}
+	iter := d.NewIter(&IterOptions{LowerBound: []byte("0010"), UpperBound: []byte("0030")})
+	require.Equal(t, "", scan(iter))
+	m := d.Metrics()
+	require.Equal(t, int64(1), m.Filter.RangeHits)
+	require.Equal(t, int64(1), m.LevelFilter[0].RangeHits)
+	// The L6 table lies within the bounds, and so its range filter isn't
+	// checked.
+	require.Equal(t, sstable.FilterMetrics{}, m.LevelFilter[6])
+
+	// Widening the bounds must reconsider the L0 table.
+	iter.SetBounds([]byte("0000"), []byte("1000"))
+	require.Equal(t, "0500", scan(iter))
+	iter.SetBounds([]byte("0500"), []byte("0501"))
+	require.Equal(t, "0500", scan(iter))
+	require.NoError(t, iter.Close())
+}
+
 // TestSetOptionsEquivalence tests equivalence between SetOptions to mutate an
 // iterator and constructing a new iterator with NewIter. The long-lived
 // iterator and the new iterator should surface identical iterator states.
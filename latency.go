@@ -0,0 +1,337 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/humanize"
+	"github.com/cockroachdb/redact"
+)
+
+// Latencies are recorded in nanoseconds into log-linear buckets, in the style
+// of an HDR histogram: each power of two is divided into
+// latencySubBuckets/2 linear buckets, bounding the relative error of a
+// recorded value by 1/16th. Values below latencySubBuckets are recorded
+// exactly.
+const (
+	latencySubBucketBits = 5
+	latencySubBuckets    = 1 << latencySubBucketBits
+	latencyBuckets       = (64-latencySubBucketBits)*(latencySubBuckets/2) + latencySubBuckets
+)
+
+// latencyBucket returns the index of the bucket of the value.
+func latencyBucket(v uint64) int {
+	if v < latencySubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(v) - latencySubBucketBits
+	return shift*(latencySubBuckets/2) + int(v>>shift)
+}
+
+// latencyBucketUpperBound returns the largest value recorded in the bucket.
+func latencyBucketUpperBound(i int) uint64 {
+	if i < latencySubBuckets {
+		return uint64(i)
+	}
+	shift := i/(latencySubBuckets/2) - 1
+	sub := uint64(i%(latencySubBuckets/2) + latencySubBuckets/2)
+	return (sub+1)<<shift - 1
+}
+
+// latencyRecorder records the latencies of an operation. It may be used
+// concurrently without locking.
+type latencyRecorder struct {
+	count   atomic.Uint64
+	sum     atomic.Uint64
+	buckets [latencyBuckets]atomic.Uint64
+}
+
+func (r *latencyRecorder) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	r.count.Add(1)
+	r.sum.Add(uint64(d))
+	r.buckets[latencyBucket(uint64(d))].Add(1)
+}
+
+// snapshot returns the latencies recorded so far. The snapshot isn't atomic:
+// latencies recorded concurrently may be reflected in some of its fields and
+// not others.
+func (r *latencyRecorder) snapshot() LatencyHistogram {
+	h := LatencyHistogram{
+		Count: r.count.Load(),
+		Sum:   time.Duration(r.sum.Load()),
+	}
+	if h.Count == 0 {
+		return h
+	}
+	h.buckets = make([]uint64, latencyBuckets)
+	for i := range r.buckets {
+		h.buckets[i] = r.buckets[i].Load()
+	}
+	return h
+}
+
+// LatencyHistogram is a histogram of the latencies of an operation, with a
+// relative error of at most 1/16th.
+type LatencyHistogram struct {
+	// Count is the number of recorded latencies.
+	Count uint64
+	// Sum is the sum of the recorded latencies.
+	Sum     time.Duration
+	buckets []uint64
+}
+
+// Mean returns the mean of the recorded latencies.
+func (h *LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// ValueAtQuantile returns the latency at the given percentile, in the range
+// [0, 100]. For example, ValueAtQuantile(99.9) returns the p99.9 latency.
+func (h *LatencyHistogram) ValueAtQuantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	if q > 100 {
+		q = 100
+	}
+	target := uint64(q / 100 * float64(h.Count))
+	if target == 0 {
+		target = 1
+	}
+	var n uint64
+	for i, c := range h.buckets {
+		n += c
+		if n >= target {
+			return time.Duration(latencyBucketUpperBound(i))
+		}
+	}
+	// The snapshot's count may exceed the sum of its buckets if latencies were
+	// recorded while it was taken.
+	for i := len(h.buckets) - 1; i >= 0; i-- {
+		if h.buckets[i] > 0 {
+			return time.Duration(latencyBucketUpperBound(i))
+		}
+	}
+	return 0
+}
+
+// CumulativeCount returns the number of recorded latencies no greater than d,
+// counting all the latencies within d's bucket.
+func (h *LatencyHistogram) CumulativeCount(d time.Duration) uint64 {
+	if len(h.buckets) == 0 || d < 0 {
+		return 0
+	}
+	last := latencyBucket(uint64(d))
+	var n uint64
+	for i := 0; i <= last; i++ {
+		n += h.buckets[i]
+	}
+	return n
+}
+
+// Sub returns the latencies recorded in h but not in prev, an earlier snapshot
+// of the same histogram.
+func (h *LatencyHistogram) Sub(prev *LatencyHistogram) LatencyHistogram {
+	r := LatencyHistogram{Count: h.Count - prev.Count, Sum: h.Sum - prev.Sum}
+	if len(h.buckets) == 0 {
+		return r
+	}
+	r.buckets = make([]uint64, len(h.buckets))
+	copy(r.buckets, h.buckets)
+	for i := range prev.buckets {
+		r.buckets[i] -= prev.buckets[i]
+	}
+	return r
+}
+
+// String implements fmt.Stringer.
+func (h *LatencyHistogram) String() string {
+	return redact.StringWithoutMarkers(h)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (h *LatencyHistogram) SafeFormat(w redact.SafePrinter, _ rune) {
+	w.Printf("count %d mean %s p50 %s p99 %s p99.9 %s max %s",
+		redact.Safe(h.Count), redact.Safe(h.Mean()), redact.Safe(h.ValueAtQuantile(50)),
+		redact.Safe(h.ValueAtQuantile(99)), redact.Safe(h.ValueAtQuantile(99.9)),
+		redact.Safe(h.ValueAtQuantile(100)))
+}
+
+// LatencyMetrics holds histograms of the latencies of foreground operations
+// since the DB was opened. They're only recorded if Options.RecordLatencies is
+// set.
+type LatencyMetrics struct {
+	// Get is the latency of DB.Get, up to positioning on the key's value.
+	Get LatencyHistogram
+	// IterSeekGE is the latency of Iterator.SeekGE and SeekGEWithLimit, on
+	// iterators over the DB.
+	IterSeekGE LatencyHistogram
+	// Commit is the latency of committing batches, broken down by the phases
+	// of the commit pipeline. The phases don't add up to the total, which
+	// includes the wait for the publication of the batch's sequence number.
+	Commit struct {
+		// Total is the latency of DB.Apply and Batch.Commit, including the wait
+		// for the WAL sync, or the latency of DB.ApplyNoSyncWait up to the
+		// return of Batch.SyncWait.
+		Total LatencyHistogram
+		// QueueWait is the wait for admission into the commit pipeline.
+		QueueWait LatencyHistogram
+		// WALWrite is the time spent writing the batch to the WAL, including
+		// the waits for write stalls and WAL rotations.
+		WALWrite LatencyHistogram
+		// WALSync is the wait for the WAL sync of batches committed with
+		// Sync, from the application of the batch to the memtable.
+		WALSync LatencyHistogram
+		// MemTableApply is the time spent applying the batch to the memtable.
+		MemTableApply LatencyHistogram
+	}
+}
+
+// String implements fmt.Stringer.
+func (m *LatencyMetrics) String() string {
+	return redact.StringWithoutMarkers(m)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (m *LatencyMetrics) SafeFormat(w redact.SafePrinter, _ rune) {
+	for _, l := range []struct {
+		name string
+		h    *LatencyHistogram
+	}{
+		{"get", &m.Get},
+		{"iter-seek-ge", &m.IterSeekGE},
+		{"commit", &m.Commit.Total},
+		{"commit-queue-wait", &m.Commit.QueueWait},
+		{"commit-wal-write", &m.Commit.WALWrite},
+		{"commit-wal-sync", &m.Commit.WALSync},
+		{"commit-memtable-apply", &m.Commit.MemTableApply},
+	} {
+		w.Printf("%s: %s\n", redact.Safe(l.name), l.h)
+	}
+}
+
+// latencyRecorders holds the recorders of the latencies exported by
+// LatencyMetrics.
+type latencyRecorders struct {
+	get        latencyRecorder
+	iterSeekGE latencyRecorder
+	commit     struct {
+		total         latencyRecorder
+		queueWait     latencyRecorder
+		walWrite      latencyRecorder
+		walSync       latencyRecorder
+		memTableApply latencyRecorder
+	}
+}
+
+func (r *latencyRecorders) metrics() LatencyMetrics {
+	var m LatencyMetrics
+	m.Get = r.get.snapshot()
+	m.IterSeekGE = r.iterSeekGE.snapshot()
+	m.Commit.Total = r.commit.total.snapshot()
+	m.Commit.QueueWait = r.commit.queueWait.snapshot()
+	m.Commit.WALWrite = r.commit.walWrite.snapshot()
+	m.Commit.WALSync = r.commit.walSync.snapshot()
+	m.Commit.MemTableApply = r.commit.memTableApply.snapshot()
+	return m
+}
+
+// SlowOperationInfo contains the info for a foreground operation that took at
+// least Options.SlowOperationThreshold.
+type SlowOperationInfo struct {
+	// Op is the operation: "get", "iter-seek-ge" or "commit".
+	Op       string
+	Duration time.Duration
+	// LevelsVisited is the number of levels of the LSM searched by a read,
+	// counting each memtable and L0 sublevel as a level.
+	LevelsVisited int
+	// Stats holds the stats of the internal iterators of a read during the
+	// operation, such as the number of blocks it loaded and the number of
+	// those that missed the block cache.
+	Stats InternalIteratorStats
+	// Commit holds the stats of a commit.
+	Commit BatchCommitStats
+}
+
+func (i SlowOperationInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i SlowOperationInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	w.Printf("slow %s: %s", redact.Safe(i.Op), redact.Safe(i.Duration))
+	if i.Op == "commit" {
+		w.Printf("; semaphore wait %s, WAL write %s (WAL queue wait %s, memtable stall %s, "+
+			"L0 stall %s, WAL rotation %s), memtable apply %s, commit wait %s",
+			redact.Safe(i.Commit.SemaphoreWaitDuration), redact.Safe(i.Commit.WALWriteDuration),
+			redact.Safe(i.Commit.WALQueueWaitDuration), redact.Safe(i.Commit.MemTableWriteStallDuration),
+			redact.Safe(i.Commit.L0ReadAmpWriteStallDuration), redact.Safe(i.Commit.WALRotationDuration),
+			redact.Safe(i.Commit.MemTableApplyDuration), redact.Safe(i.Commit.CommitWaitDuration))
+		return
+	}
+	w.Printf("; levels visited %d, blocks loaded %d (%d cache misses), "+
+		"block bytes %s (%s cached), block read duration %s, points %d",
+		redact.Safe(i.LevelsVisited), redact.Safe(i.Stats.BlockCount),
+		redact.Safe(i.Stats.BlockCacheMisses),
+		humanize.IEC.Uint64(i.Stats.BlockBytes),
+		humanize.IEC.Uint64(i.Stats.BlockBytesInCache),
+		redact.Safe(i.Stats.BlockReadDuration), redact.Safe(i.Stats.PointCount))
+}
+
+// timeOperations returns true if the latencies of foreground operations need
+// to be measured, to be recorded or to report slow operations.
+func (d *DB) timeOperations() bool {
+	return d.opts.RecordLatencies || d.opts.SlowOperationThreshold > 0
+}
+
+// isSlowOperation returns true if an operation which took the given duration
+// should be reported to EventListener.SlowOperation.
+func (d *DB) isSlowOperation(duration time.Duration) bool {
+	return d.opts.SlowOperationThreshold > 0 && duration >= d.opts.SlowOperationThreshold
+}
+
+// recordCommitLatency records the latencies of the commit of the batch, and
+// reports it if it was slow.
+func (d *DB) recordCommitLatency(b *Batch, sync bool) {
+	s := &b.commitStats
+	if d.opts.RecordLatencies {
+		d.latency.commit.total.record(s.TotalDuration)
+		d.latency.commit.queueWait.record(s.SemaphoreWaitDuration)
+		d.latency.commit.walWrite.record(s.WALWriteDuration)
+		d.latency.commit.memTableApply.record(s.MemTableApplyDuration)
+		if sync {
+			d.latency.commit.walSync.record(s.CommitWaitDuration)
+		}
+	}
+	if d.isSlowOperation(s.TotalDuration) {
+		d.opts.EventListener.SlowOperation(SlowOperationInfo{
+			Op:       "commit",
+			Duration: s.TotalDuration,
+			Commit:   *s,
+		})
+	}
+}
+
+// subInternalIteratorStats returns the stats accumulated in after since
+// before, restricted to the stats reported in SlowOperationInfo.
+func subInternalIteratorStats(after, before *InternalIteratorStats) InternalIteratorStats {
+	return InternalIteratorStats{
+		BlockBytes:        after.BlockBytes - before.BlockBytes,
+		BlockBytesInCache: after.BlockBytesInCache - before.BlockBytesInCache,
+		BlockCount:        after.BlockCount - before.BlockCount,
+		BlockCacheMisses:  after.BlockCacheMisses - before.BlockCacheMisses,
+		BlockReadDuration: after.BlockReadDuration - before.BlockReadDuration,
+		PointCount:        after.PointCount - before.PointCount,
+	}
+}
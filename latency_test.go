@@ -0,0 +1,143 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyBuckets(t *testing.T) {
+	// Every value is recorded in a bucket whose upper bound is no smaller than
+	// the value, and within 1/16th of it.
+	check := func(v uint64) {
+		i := latencyBucket(v)
+		require.Less(t, i, latencyBuckets)
+		upper := latencyBucketUpperBound(i)
+		require.LessOrEqual(t, v, upper)
+		require.LessOrEqual(t, float64(upper-v), float64(v)/16, "value %d", v)
+		if i > 0 {
+			require.Less(t, latencyBucketUpperBound(i-1), v)
+		}
+	}
+	for v := uint64(0); v < 1<<12; v++ {
+		check(v)
+	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < 10000; i++ {
+		check(rng.Uint64() >> rng.Intn(64))
+	}
+	check(math.MaxUint64)
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	var r latencyRecorder
+	h := r.snapshot()
+	require.Equal(t, time.Duration(0), h.ValueAtQuantile(50))
+
+	for i := 1; i <= 1000; i++ {
+		r.record(time.Duration(i) * time.Microsecond)
+	}
+	h = r.snapshot()
+	require.Equal(t, uint64(1000), h.Count)
+	require.Equal(t, 500500*time.Microsecond, h.Sum)
+	require.Equal(t, 500500*time.Nanosecond, h.Mean())
+
+	within := func(expected, actual time.Duration) {
+		require.GreaterOrEqual(t, actual, expected)
+		require.LessOrEqual(t, actual, expected+expected/16)
+	}
+	within(time.Microsecond, h.ValueAtQuantile(0))
+	within(500*time.Microsecond, h.ValueAtQuantile(50))
+	within(990*time.Microsecond, h.ValueAtQuantile(99))
+	within(time.Millisecond, h.ValueAtQuantile(100))
+	require.Equal(t, uint64(1000), h.CumulativeCount(time.Second))
+	require.Equal(t, uint64(0), h.CumulativeCount(time.Nanosecond))
+
+	r.record(time.Second)
+	h2 := r.snapshot()
+	d := h2.Sub(&h)
+	require.Equal(t, uint64(1), d.Count)
+	within(time.Second, d.ValueAtQuantile(1))
+}
+
+func TestSlowOperations(t *testing.T) {
+	var slow []SlowOperationInfo
+	opts := &Options{
+		FS: vfs.NewMem(),
+		EventListener: &EventListener{
+			SlowOperation: func(info SlowOperationInfo) {
+				slow = append(slow, info)
+			},
+		},
+		// Report every operation.
+		SlowOperationThreshold: time.Nanosecond,
+		RecordLatencies:        true,
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("a"), Sync))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("b"), []byte("b"), NoSync))
+	_, closer, err := d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.NoError(t, closer.Close())
+	iter := d.NewIter(nil)
+	require.True(t, iter.SeekGE([]byte("a")))
+	require.NoError(t, iter.Close())
+
+	var ops []string
+	for _, info := range slow {
+		ops = append(ops, info.Op)
+		require.NotEmpty(t, info.String())
+	}
+	require.Equal(t, []string{"commit", "commit", "get", "iter-seek-ge"}, ops)
+	// The Get searched the memtable and L0, loading the table's blocks.
+	get := slow[2]
+	require.Equal(t, 2, get.LevelsVisited)
+	require.Less(t, uint64(0), get.Stats.BlockCount)
+	require.Equal(t, get.Stats.BlockCount, get.Stats.BlockCacheMisses)
+	seek := slow[3]
+	require.Less(t, 0, seek.LevelsVisited)
+	require.Less(t, uint64(0), seek.Stats.BlockCount)
+	require.Equal(t, uint64(0), seek.Stats.BlockCacheMisses)
+
+	m := d.Metrics()
+	require.Equal(t, uint64(1), m.Latency.Get.Count)
+	require.Equal(t, uint64(1), m.Latency.IterSeekGE.Count)
+	require.Equal(t, uint64(2), m.Latency.Commit.Total.Count)
+	require.Equal(t, uint64(2), m.Latency.Commit.QueueWait.Count)
+	require.Equal(t, uint64(2), m.Latency.Commit.WALWrite.Count)
+	require.Equal(t, uint64(2), m.Latency.Commit.MemTableApply.Count)
+	require.Equal(t, uint64(1), m.Latency.Commit.WALSync.Count)
+	require.NotEmpty(t, m.Latency.String())
+}
+
+// Tests that latencies aren't recorded unless Options.RecordLatencies is set.
+func TestLatenciesNotRecordedByDefault(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("a"), Sync))
+	_, closer, err := d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.NoError(t, closer.Close())
+	iter := d.NewIter(nil)
+	require.True(t, iter.SeekGE([]byte("a")))
+	require.NoError(t, iter.Close())
+
+	m := d.Metrics()
+	require.Equal(t, uint64(0), m.Latency.Get.Count)
+	require.Equal(t, uint64(0), m.Latency.IterSeekGE.Count)
+	require.Equal(t, uint64(0), m.Latency.Commit.Total.Count)
+}
@@ -77,6 +77,10 @@ type internalIterOpts struct {
 // correctness. Instead, SeekPrefixGE creates a synthetic boundary key with the
 // kind InternalKeyKindRangeDeletion which will be used to pause the levelIter
 // at the sstable until the mergingIter is ready to advance past it.
+//
+// SeekPrefixLT is handled symmetrically: a "not found" pauses the levelIter at
+// the sstable's smallest boundary until the mergingIter is ready to move
+// before it.
 type levelIter struct {
 	// The context is stored here since (a) iterators are expected to be
 	// short-lived (since they pin sstables), (b) plumbing a context into every
@@ -229,8 +233,10 @@ type filteredIter interface {
 	MaybeFilteredKeys() bool
 }
 
-// levelIter implements the base.InternalIterator interface.
+// levelIter implements the base.InternalIterator and base.KVChecksumIterator
+// interfaces.
 var _ base.InternalIterator = (*levelIter)(nil)
+var _ base.KVChecksumIterator = (*levelIter)(nil)
 
 // newLevelIter returns a levelIter. It is permissible to pass a nil split
 // parameter if the caller is never going to call SeekPrefixGE.
@@ -268,6 +274,7 @@ func (l *levelIter) init(
 	l.tableOpts.TableFilter = opts.TableFilter
 	l.tableOpts.PointKeyFilters = opts.PointKeyFilters
 	l.tableOpts.UseL6Filters = opts.UseL6Filters
+	l.tableOpts.DisableCacheFill = opts.DisableCacheFill
 	l.tableOpts.level = l.level
 	l.cmp = cmp
 	l.split = split
@@ -820,6 +827,55 @@ func (l *levelIter) SeekLT(key []byte, flags base.SeekLTFlags) (*InternalKey, ba
 	return l.verify(l.skipEmptyFileBackward())
 }
 
+func (l *levelIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	l.err = nil // clear cached iteration error
+	if l.boundaryContext != nil {
+		l.boundaryContext.isSyntheticIterBoundsKey = false
+		l.boundaryContext.isIgnorableBoundaryKey = false
+	}
+
+	// NB: the top-level Iterator has already adjusted key based on
+	// IterOptions.UpperBound.
+	if l.loadFile(l.findFileLT(key, flags), -1) == noFileLoaded {
+		return nil, base.LazyValue{}
+	}
+	if key, val := l.iter.SeekPrefixLT(prefix, key, flags); key != nil {
+		return l.verify(key, val)
+	}
+	// When SeekPrefixLT returns nil, we have not necessarily reached the
+	// beginning of the sstable. All we know is that a key with prefix does not
+	// exist in the current sstable. As in SeekPrefixGE, if the table has range
+	// deletions we return the table's lower bound so that the table stays open
+	// until the mergingIter moves before it.
+	if l.rangeDelIterPtr != nil && *l.rangeDelIterPtr != nil {
+		if l.tableOpts.LowerBound != nil {
+			l.syntheticBoundary.UserKey = l.tableOpts.LowerBound
+			l.syntheticBoundary.Trailer = InternalKeyRangeDeleteSentinel
+			l.smallestBoundary = &l.syntheticBoundary
+			if l.boundaryContext != nil {
+				l.boundaryContext.isSyntheticIterBoundsKey = true
+				l.boundaryContext.isIgnorableBoundaryKey = false
+			}
+			return l.verify(l.smallestBoundary, base.LazyValue{})
+		}
+		l.smallestBoundary = &l.iterFile.SmallestPointKey
+		if l.boundaryContext != nil {
+			l.boundaryContext.isSyntheticIterBoundsKey = false
+			l.boundaryContext.isIgnorableBoundaryKey = true
+		}
+		return l.verify(l.smallestBoundary, base.LazyValue{})
+	}
+	// If the file's smallest point key has a smaller prefix, all keys matching
+	// the prefix would be within the current file, and the filter has told us
+	// there are none. Avoid loading the previous file.
+	if n := l.split(l.iterFile.SmallestPointKey.UserKey); l.cmp(prefix, l.iterFile.SmallestPointKey.UserKey[:n]) > 0 {
+		return nil, base.LazyValue{}
+	}
+	return l.verify(l.skipEmptyFileBackward())
+}
+
 func (l *levelIter) First() (*InternalKey, base.LazyValue) {
 	l.err = nil // clear cached iteration error
 	if l.boundaryContext != nil {
@@ -1175,6 +1231,16 @@ func (l *levelIter) Error() error {
 	return l.iter.Error()
 }
 
+// KVChecksum implements base.KVChecksumIterator, returning the checksum of
+// the current entry from the table it was read from. Boundary keys don't have
+// checksums.
+func (l *levelIter) KVChecksum() (base.KVChecksum, bool) {
+	if l.iter == nil || l.smallestBoundary != nil || l.largestBoundary != nil {
+		return 0, false
+	}
+	return base.IterKVChecksum(l.iter)
+}
+
 func (l *levelIter) Close() error {
 	if l.iter != nil {
 		l.err = l.iter.Close()
@@ -1197,6 +1263,13 @@ func (l *levelIter) SetBounds(lower, upper []byte) {
 	if l.iter == nil {
 		return
 	}
+	if l.iter == rangeFilteredAll {
+		// The table was skipped by its range filter, which may not apply to the
+		// new bounds. Close() will set levelIter.err if an error occurs, and the
+		// next positioning operation will reload the table.
+		_ = l.Close()
+		return
+	}
 
 	// Update tableOpts.{Lower,Upper}Bound in case the new boundaries fall within
 	// the boundaries of the current table.
@@ -42,7 +42,8 @@ var memTableEmptySize = func() uint32 {
 // via tombstones, but it is up to higher level code (see Iterator) to support
 // processing those tombstones.
 //
-// A memTable is implemented on top of a lock-free arena-backed skiplist. An
+// A memTable is implemented on top of a lock-free arena-backed skiplist, or
+// another representation of the point keys (see Options.MemTableKind). An
 // arena is a fixed size contiguous chunk of memory (see
 // Options.MemTableSize). A memTable's memory consumption is thus fixed at the
 // time of creation (with the exception of the cached fragmented range
@@ -67,7 +68,8 @@ type memTable struct {
 	formatKey   base.FormatKey
 	equal       Equal
 	arenaBuf    []byte
-	skl         arenaskl.Skiplist
+	arena       *arenaskl.Arena
+	points      memTableRep
 	rangeDelSkl arenaskl.Skiplist
 	rangeKeySkl arenaskl.Skiplist
 	// reserved tracks the amount of space used by the memtable, both by actual
@@ -75,6 +77,9 @@ type memTable struct {
 	// operations. This value is incremented pessimistically by prepare() in
 	// order to account for the space needed by a batch.
 	reserved uint32
+	// emptySize is the amount of allocated space in the arena when the memtable
+	// is empty, which depends on the representation of the point keys.
+	emptySize uint32
 	// writerRefs tracks the write references on the memtable. The two sources of
 	// writer references are the memtable being on DB.mu.mem.queue and from
 	// inflight mutations that have reserved space in the memtable but not yet
@@ -86,6 +91,14 @@ type memTable struct {
 	// The current logSeqNum at the time the memtable was created. This is
 	// guaranteed to be less than or equal to any seqnum stored in the memtable.
 	logSeqNum uint64
+	// insertConcurrency is the maximum number of goroutines which apply a
+	// batch to the memtable. See Options.Experimental.MemTableInsertConcurrency.
+	insertConcurrency int
+	// kvChecksums is set if the keys are stored with their key-value
+	// checksums. The checksums of point keys are verified when they're read,
+	// and those of range deletions and range keys when they're fragmented.
+	// See Options.KVChecksums.
+	kvChecksums bool
 }
 
 // memTableOptions holds configuration used when creating a memTable. All of
@@ -93,9 +106,10 @@ type memTable struct {
 // which is used by tests.
 type memTableOptions struct {
 	*Options
-	arenaBuf  []byte
-	size      int
-	logSeqNum uint64
+	arenaBuf    []byte
+	size        int
+	logSeqNum   uint64
+	kvChecksums bool
 }
 
 func checkMemTable(obj interface{}) {
@@ -120,6 +134,9 @@ func newMemTable(opts memTableOptions) *memTable {
 		equal:     opts.Comparer.Equal,
 		arenaBuf:  opts.arenaBuf,
 		logSeqNum: opts.logSeqNum,
+
+		insertConcurrency: opts.Experimental.MemTableInsertConcurrency,
+		kvChecksums:       opts.kvChecksums,
 	}
 	m.writerRefs.Store(1)
 	m.tombstones = keySpanCache{
@@ -139,11 +156,16 @@ func newMemTable(opts memTableOptions) *memTable {
 		m.arenaBuf = make([]byte, opts.size)
 	}
 
-	arena := arenaskl.NewArena(m.arenaBuf)
-	m.skl.Reset(arena, m.cmp)
-	m.rangeDelSkl.Reset(arena, m.cmp)
-	m.rangeKeySkl.Reset(arena, m.cmp)
-	m.reserved = arena.Size()
+	m.arena = arenaskl.NewArena(m.arenaBuf)
+	m.points = opts.MemTableKind.newRep(m.arena, opts.Comparer, m.kvChecksums)
+	m.rangeDelSkl.Reset(m.arena, m.cmp)
+	m.rangeKeySkl.Reset(m.arena, m.cmp)
+	if m.kvChecksums {
+		m.rangeDelSkl.EnableKVChecksums()
+		m.rangeKeySkl.EnableKVChecksums()
+	}
+	m.reserved = m.arena.Size()
+	m.emptySize = m.reserved
 	return m
 }
 
@@ -174,11 +196,16 @@ func (m *memTable) readyForFlush() bool {
 // that prepare is not thread-safe, while apply is. The caller must call
 // writerUnref() after the batch has been applied.
 func (m *memTable) prepare(batch *Batch) error {
+	size := batch.memTableSize
+	if m.kvChecksums {
+		size += uint64(batch.Count()) * arenaskl.KVChecksumSize
+	}
+	size += uint64(batch.Count()) * m.points.indexEntrySize()
 	avail := m.availBytes()
-	if batch.memTableSize > uint64(avail) {
+	if size > uint64(avail) {
 		return arenaskl.ErrArenaFull
 	}
-	m.reserved += uint32(batch.memTableSize)
+	m.reserved += uint32(size)
 
 	m.writerRef()
 	return nil
@@ -190,22 +217,57 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 			errors.Safe(seqNum), errors.Safe(m.logSeqNum))
 	}
 
-	var ins arenaskl.Inserter
+	var endSeqNum uint64
 	var tombstoneCount, rangeKeyCount uint32
-	startSeqNum := seqNum
-	for r := batch.Reader(); ; seqNum++ {
+	var err error
+	if n := m.applyConcurrency(batch); n > 1 {
+		endSeqNum, tombstoneCount, rangeKeyCount, err = m.applyConcurrently(batch, seqNum, n)
+	} else {
+		endSeqNum, tombstoneCount, rangeKeyCount, err = m.applyEntries(
+			batch.Reader(), seqNum, -1, batch.allKVChecksums())
+	}
+	if err != nil {
+		return err
+	}
+	if endSeqNum != seqNum+uint64(batch.Count()) {
+		return base.CorruptionErrorf("pebble: inconsistent batch count: %d vs %d",
+			errors.Safe(endSeqNum), errors.Safe(seqNum+uint64(batch.Count())))
+	}
+	if tombstoneCount != 0 {
+		m.tombstones.invalidate(tombstoneCount)
+	}
+	if rangeKeyCount != 0 {
+		m.rangeKeys.invalidate(rangeKeyCount)
+	}
+	return nil
+}
+
+// applyEntries applies the first n entries read from r to the memtable, or
+// all of them if n is negative, assigning sequence numbers starting at
+// seqNum. It returns the sequence number following the last entry applied,
+// and the number of range deletions and range keys applied. If checksums is
+// non-nil, it holds the key-value checksums of the entries read from r,
+// which are stored with the entries, if the memtable stores checksums, so
+// that corruption of the entries since the checksums were computed is
+// detected.
+func (m *memTable) applyEntries(
+	r BatchReader, seqNum uint64, n int, checksums []base.KVChecksum,
+) (endSeqNum uint64, tombstoneCount, rangeKeyCount uint32, err error) {
+	var ins, rangeDelIns, rangeKeyIns arenaskl.Inserter
+	for i := 0; n != 0; i, n = i+1, n-1 {
 		kind, ukey, value, ok := r.Next()
 		if !ok {
 			break
 		}
-		var err error
 		ikey := base.MakeInternalKey(ukey, seqNum, kind)
 		switch kind {
 		case InternalKeyKindRangeDelete:
-			err = m.rangeDelSkl.Add(ikey, value)
+			err = rangeDelIns.AddWithKVChecksum(&m.rangeDelSkl, ikey, value,
+				m.entryKVChecksum(checksums, i, kind, ukey, value))
 			tombstoneCount++
 		case InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
-			err = m.rangeKeySkl.Add(ikey, value)
+			err = rangeKeyIns.AddWithKVChecksum(&m.rangeKeySkl, ikey, value,
+				m.entryKVChecksum(checksums, i, kind, ukey, value))
 			rangeKeyCount++
 		case InternalKeyKindLogData:
 			// Don't increment seqNum for LogData, since these are not applied
@@ -214,38 +276,129 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 		case InternalKeyKindIngestSST:
 			panic("pebble: cannot apply ingested sstable key kind to memtable")
 		default:
-			err = ins.Add(&m.skl, ikey, value)
+			err = m.points.add(&ins, ikey, value, m.entryKVChecksum(checksums, i, kind, ukey, value))
 		}
 		if err != nil {
-			return err
+			return 0, 0, 0, err
 		}
+		seqNum++
 	}
-	if seqNum != startSeqNum+uint64(batch.Count()) {
-		return base.CorruptionErrorf("pebble: inconsistent batch count: %d vs %d",
-			errors.Safe(seqNum), errors.Safe(startSeqNum+uint64(batch.Count())))
+	return seqNum, tombstoneCount, rangeKeyCount, nil
+}
+
+// entryKVChecksum returns the key-value checksum to store with the i-th entry
+// applied by applyEntries, or zero if the memtable doesn't store checksums.
+func (m *memTable) entryKVChecksum(
+	checksums []base.KVChecksum, i int, kind InternalKeyKind, ukey, value []byte,
+) base.KVChecksum {
+	if !m.kvChecksums {
+		return 0
 	}
-	if tombstoneCount != 0 {
-		m.tombstones.invalidate(tombstoneCount)
+	if checksums != nil {
+		return checksums[i]
 	}
-	if rangeKeyCount != 0 {
-		m.rangeKeys.invalidate(rangeKeyCount)
+	return base.MakeKVChecksum(kind, ukey, value)
+}
+
+// memTableApplyChunkMinCount is the minimum number of entries of a batch
+// applied by each goroutine when a batch is applied concurrently.
+const memTableApplyChunkMinCount = 256
+
+// applyConcurrency returns the number of goroutines which apply the batch
+// concurrently (see Options.Experimental.MemTableInsertConcurrency).
+func (m *memTable) applyConcurrency(batch *Batch) int {
+	n := int(batch.Count()) / memTableApplyChunkMinCount
+	if n > m.insertConcurrency {
+		n = m.insertConcurrency
 	}
-	return nil
+	return n
+}
+
+// applyConcurrently applies the batch to the memtable using n goroutines,
+// each applying a contiguous chunk of the batch's entries. The skiplists
+// support concurrent inserts, and the batch's entries only become visible
+// once the commit pipeline publishes its sequence number, after apply
+// returns, so readers never observe a partially applied batch.
+func (m *memTable) applyConcurrently(
+	batch *Batch, seqNum uint64, n int,
+) (endSeqNum uint64, tombstoneCount, rangeKeyCount uint32, err error) {
+	type chunk struct {
+		r         BatchReader
+		seqNum    uint64
+		count     int
+		checksums []base.KVChecksum
+	}
+	// Find the start of each chunk, and its sequence number. Decoding the
+	// entries is cheap compared to inserting them.
+	chunkCount := (int(batch.Count()) + n - 1) / n
+	chunks := make([]chunk, 0, n+1)
+	checksums := batch.allKVChecksums()
+	r := batch.Reader()
+	for i := 0; ; i++ {
+		if len(chunks) == 0 || chunks[len(chunks)-1].count == chunkCount {
+			c := chunk{r: r, seqNum: seqNum}
+			if checksums != nil {
+				c.checksums = checksums[i:]
+			}
+			chunks = append(chunks, c)
+		}
+		kind, _, _, ok := r.Next()
+		if !ok {
+			break
+		}
+		chunks[len(chunks)-1].count++
+		if kind != InternalKeyKindLogData {
+			seqNum++
+		}
+	}
+	endSeqNum = seqNum
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	apply := func(c chunk) {
+		_, tombstones, rangeKeys, applyErr := m.applyEntries(c.r, c.seqNum, c.count, c.checksums)
+		mu.Lock()
+		defer mu.Unlock()
+		tombstoneCount += tombstones
+		rangeKeyCount += rangeKeys
+		err = firstError(err, applyErr)
+	}
+	for _, c := range chunks[1:] {
+		if c.count == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(c chunk) {
+			defer wg.Done()
+			apply(c)
+		}(c)
+	}
+	apply(chunks[0])
+	wg.Wait()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return endSeqNum, tombstoneCount, rangeKeyCount, nil
 }
 
 // newIter returns an iterator that is unpositioned (Iterator.Valid() will
 // return false). The iterator can be positioned via a call to SeekGE,
 // SeekLT, First or Last.
 func (m *memTable) newIter(o *IterOptions) internalIterator {
-	return m.skl.NewIter(o.GetLowerBound(), o.GetUpperBound())
+	return m.points.newIter(o.GetLowerBound(), o.GetUpperBound())
 }
 
 func (m *memTable) newFlushIter(o *IterOptions, bytesFlushed *uint64) internalIterator {
-	return m.skl.NewFlushIter(bytesFlushed)
+	iter := m.points.newFlushIter(bytesFlushed)
+	iter.SetBounds(o.GetLowerBound(), o.GetUpperBound())
+	return iter
 }
 
 func (m *memTable) newRangeDelIter(*IterOptions) keyspan.FragmentIterator {
-	tombstones := m.tombstones.get()
+	tombstones, err := m.tombstones.get()
+	if err != nil {
+		return newErrorKeyspanIter(err)
+	}
 	if tombstones == nil {
 		return nil
 	}
@@ -253,7 +406,10 @@ func (m *memTable) newRangeDelIter(*IterOptions) keyspan.FragmentIterator {
 }
 
 func (m *memTable) newRangeKeyIter(*IterOptions) keyspan.FragmentIterator {
-	rangeKeys := m.rangeKeys.get()
+	rangeKeys, err := m.rangeKeys.get()
+	if err != nil {
+		return newErrorKeyspanIter(err)
+	}
 	if rangeKeys == nil {
 		return nil
 	}
@@ -265,27 +421,33 @@ func (m *memTable) containsRangeKeys() bool {
 }
 
 func (m *memTable) availBytes() uint32 {
-	a := m.skl.Arena()
+	a := m.arena
 	if m.writerRefs.Load() == 1 {
 		// If there are no other concurrent apply operations, we can update the
 		// reserved bytes setting to accurately reflect how many bytes of been
 		// allocated vs the over-estimation present in memTableEntrySize.
 		m.reserved = a.Size()
 	}
-	return a.Capacity() - m.reserved
+	// The index of the point keys, if any, is allocated outside the arena but
+	// counts toward the memtable's size.
+	used := uint64(m.reserved) + m.points.indexSize()
+	if used >= uint64(a.Capacity()) {
+		return 0
+	}
+	return a.Capacity() - uint32(used)
 }
 
 func (m *memTable) inuseBytes() uint64 {
-	return uint64(m.skl.Size() - memTableEmptySize)
+	return uint64(m.arena.Size() - m.emptySize)
 }
 
 func (m *memTable) totalBytes() uint64 {
-	return uint64(m.skl.Arena().Capacity())
+	return uint64(m.arena.Capacity())
 }
 
 // empty returns whether the MemTable has no key/value pairs.
 func (m *memTable) empty() bool {
-	return m.skl.Size() == memTableEmptySize
+	return m.arena.Size() == m.emptySize
 }
 
 // A keySpanFrags holds a set of fragmented keyspan.Spans with a particular key
@@ -307,6 +469,8 @@ type keySpanFrags struct {
 	count uint32
 	once  sync.Once
 	spans []keyspan.Span
+	// err is set if the key-value checksum of one of the keys didn't match.
+	err error
 }
 
 type constructSpan func(ik base.InternalKey, v []byte, keysDst []keyspan.Key) (keyspan.Span, error)
@@ -324,10 +488,11 @@ func rangeDelConstructSpan(
 // situation can occur if there are multiple concurrent additions of the key
 // kind and a concurrent reader. The reader can load a keySpanFrags and populate
 // it even though is has been invalidated (i.e. replaced with a newer
-// keySpanFrags).
+// keySpanFrags). If the skiplist stores key-value checksums, they're verified
+// as the spans are populated, and a mismatch is returned as an error.
 func (f *keySpanFrags) get(
 	skl *arenaskl.Skiplist, cmp Compare, formatKey base.FormatKey, constructSpan constructSpan,
-) []keyspan.Span {
+) ([]keyspan.Span, error) {
 	f.once.Do(func() {
 		frag := &keyspan.Fragmenter{
 			Cmp:    cmp,
@@ -346,9 +511,16 @@ func (f *keySpanFrags) get(
 			frag.Add(s)
 			keysDst = s.Keys[len(s.Keys):]
 		}
+		err := it.Error()
+		_ = it.Close()
+		if err != nil {
+			f.err = err
+			f.spans = nil
+			return
+		}
 		frag.Finish()
 	})
-	return f.spans
+	return f.spans, f.err
 }
 
 // A keySpanCache is used to cache a set of fragmented spans. The cache is
@@ -390,10 +562,10 @@ func (c *keySpanCache) invalidate(count uint32) {
 	}
 }
 
-func (c *keySpanCache) get() []keyspan.Span {
+func (c *keySpanCache) get() ([]keyspan.Span, error) {
 	frags := (*keySpanFrags)(atomic.LoadPointer(&c.frags))
 	if frags == nil {
-		return nil
+		return nil, nil
 	}
 	return frags.get(c.skl, c.cmp, c.formatKey, c.constructSpan)
 }
@@ -0,0 +1,396 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/arenaskl"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// MemTableKind determines the representation of the point keys of memtables.
+// The range deletions and range keys of memtables are always stored in
+// skiplists.
+//
+// MemTableKind is a closed set of options, like an enum: its implementations
+// are SkiplistMemTable, HashSkiplistMemTable and VectorMemTable, and it can't
+// be implemented outside of this package, since the representations are tied
+// to the memtable's arena and internal iterators.
+//
+// Every representation stores its keys and values in the memtable's arena
+// (see Options.MemTableSize). The index of the vector representation is
+// allocated outside the arena, but it counts toward the memtable's size, so
+// the memory used by a memtable is bounded regardless of the representation.
+type MemTableKind interface {
+	// String returns the name of the representation along with its
+	// parameters, as persisted in the OPTIONS file.
+	String() string
+
+	// newRep returns a representation of the point keys of a memtable which
+	// allocates from the arena. If kvChecksums is set, the representation
+	// stores the key-value checksum of each key, and its iterators verify
+	// them (see Options.KVChecksums).
+	newRep(arena *arenaskl.Arena, comparer *Comparer, kvChecksums bool) memTableRep
+}
+
+// SkiplistMemTable stores the point keys of memtables in a lock-free skiplist,
+// which supports concurrent inserts and efficient reads of any kind. It is the
+// default representation.
+type SkiplistMemTable struct{}
+
+// String implements MemTableKind.
+func (SkiplistMemTable) String() string { return "skiplist" }
+
+func (SkiplistMemTable) newRep(
+	arena *arenaskl.Arena, comparer *Comparer, kvChecksums bool,
+) memTableRep {
+	skl := arenaskl.NewSkiplist(arena, comparer.Compare)
+	if kvChecksums {
+		skl.EnableKVChecksums()
+	}
+	return (*skiplistRep)(skl)
+}
+
+// HashSkiplistMemTable partitions the point keys of memtables into skiplists
+// by the hash of their prefix (see Comparer.Split). Point lookups and prefix
+// iteration only search the skiplist of the prefix, which is smaller than a
+// single skiplist holding all keys, while other iteration merges the
+// skiplists. It suits workloads dominated by point reads and writes.
+type HashSkiplistMemTable struct {
+	// Buckets is the number of skiplists. The default is 16.
+	Buckets int
+}
+
+// String implements MemTableKind.
+func (f HashSkiplistMemTable) String() string {
+	return fmt.Sprintf("hash_skiplist(%d)", f.buckets())
+}
+
+func (f HashSkiplistMemTable) buckets() int {
+	if f.Buckets <= 0 {
+		return 16
+	}
+	return f.Buckets
+}
+
+// skiplistEmptySize is the amount of space allocated in an arena by an empty
+// skiplist.
+var skiplistEmptySize = func() uint32 {
+	arena := arenaskl.NewArena(make([]byte, 4<<10 /* 4 KB */))
+	initial := arena.Size()
+	_ = arenaskl.NewSkiplist(arena, bytes.Compare)
+	return arena.Size() - initial
+}()
+
+func (f HashSkiplistMemTable) newRep(
+	arena *arenaskl.Arena, comparer *Comparer, kvChecksums bool,
+) memTableRep {
+	// Use fewer skiplists in small memtables, so that the empty skiplists use
+	// no more than 1/8th of the arena.
+	n := f.buckets()
+	for n > 1 && uint32(n)*skiplistEmptySize > arena.Capacity()/8 {
+		n /= 2
+	}
+	r := &hashSkiplistRep{
+		cmp:     comparer.Compare,
+		split:   comparer.Split,
+		buckets: make([]arenaskl.Skiplist, n),
+	}
+	for i := range r.buckets {
+		r.buckets[i].Reset(arena, comparer.Compare)
+		if kvChecksums {
+			r.buckets[i].EnableKVChecksums()
+		}
+	}
+	return r
+}
+
+// VectorMemTable appends the point keys of memtables to a vector, which is
+// sorted into an array when it's read or flushed. Writes are cheaper than
+// with a skiplist, but reads after writes must sort the new keys, so it suits
+// bulk loads that aren't read until they're flushed.
+type VectorMemTable struct{}
+
+// String implements MemTableKind.
+func (VectorMemTable) String() string { return "vector" }
+
+func (VectorMemTable) newRep(
+	arena *arenaskl.Arena, comparer *Comparer, kvChecksums bool,
+) memTableRep {
+	vec := arenaskl.NewVector(arena, comparer.Compare)
+	if kvChecksums {
+		vec.EnableKVChecksums()
+	}
+	return (*vectorRep)(vec)
+}
+
+// parseMemTableKind parses the string form of a MemTableKind.
+func parseMemTableKind(value string) (MemTableKind, error) {
+	switch value {
+	case "skiplist":
+		return SkiplistMemTable{}, nil
+	case "vector":
+		return VectorMemTable{}, nil
+	}
+	if strings.HasPrefix(value, "hash_skiplist(") && strings.HasSuffix(value, ")") {
+		args := strings.TrimSuffix(strings.TrimPrefix(value, "hash_skiplist("), ")")
+		buckets, err := strconv.Atoi(args)
+		if err != nil {
+			return nil, err
+		}
+		return HashSkiplistMemTable{Buckets: buckets}, nil
+	}
+	return nil, errors.Errorf("pebble: unknown memtable kind: %q", errors.Safe(value))
+}
+
+// memTableRep is the representation of the point keys of a memtable. All the
+// methods may be called concurrently.
+type memTableRep interface {
+	// add adds the key and value. The inserter caches the position of the
+	// previous key added by the same batch, and may be ignored. If the
+	// representation stores key-value checksums, it stores checksum, which
+	// is otherwise ignored.
+	add(ins *arenaskl.Inserter, key InternalKey, value []byte, checksum base.KVChecksum) error
+	// newIter returns an iterator over the keys, which checks the bounds in
+	// the same way as an arenaskl.Iterator.
+	newIter(lower, upper []byte) internalIterator
+	// newFlushIter returns an iterator over the keys which adds the space used
+	// by each key it visits to *bytesFlushed.
+	newFlushIter(bytesFlushed *uint64) internalIterator
+	// indexSize returns the number of bytes used by the representation outside
+	// the arena.
+	indexSize() uint64
+	// indexEntrySize returns the most bytes per key the representation may use
+	// outside the arena.
+	indexEntrySize() uint64
+}
+
+type skiplistRep arenaskl.Skiplist
+
+func (r *skiplistRep) add(
+	ins *arenaskl.Inserter, key InternalKey, value []byte, checksum base.KVChecksum,
+) error {
+	return ins.AddWithKVChecksum((*arenaskl.Skiplist)(r), key, value, checksum)
+}
+
+func (r *skiplistRep) newIter(lower, upper []byte) internalIterator {
+	return (*arenaskl.Skiplist)(r).NewIter(lower, upper)
+}
+
+func (r *skiplistRep) newFlushIter(bytesFlushed *uint64) internalIterator {
+	return (*arenaskl.Skiplist)(r).NewFlushIter(bytesFlushed)
+}
+
+func (r *skiplistRep) indexSize() uint64 { return 0 }
+
+func (r *skiplistRep) indexEntrySize() uint64 { return 0 }
+
+type vectorRep arenaskl.Vector
+
+func (r *vectorRep) add(
+	_ *arenaskl.Inserter, key InternalKey, value []byte, checksum base.KVChecksum,
+) error {
+	return (*arenaskl.Vector)(r).AddWithKVChecksum(key, value, checksum)
+}
+
+func (r *vectorRep) newIter(lower, upper []byte) internalIterator {
+	return (*arenaskl.Vector)(r).NewIter(lower, upper)
+}
+
+func (r *vectorRep) newFlushIter(bytesFlushed *uint64) internalIterator {
+	return (*arenaskl.Vector)(r).NewFlushIter(bytesFlushed)
+}
+
+func (r *vectorRep) indexSize() uint64 {
+	return (*arenaskl.Vector)(r).IndexSize()
+}
+
+func (r *vectorRep) indexEntrySize() uint64 { return arenaskl.VectorIndexEntrySize }
+
+type hashSkiplistRep struct {
+	cmp     Compare
+	split   Split
+	buckets []arenaskl.Skiplist
+}
+
+func (r *hashSkiplistRep) bucket(userKey []byte) *arenaskl.Skiplist {
+	if r.split != nil {
+		userKey = userKey[:r.split(userKey)]
+	}
+	// FNV-1a.
+	h := uint32(2166136261)
+	for _, c := range userKey {
+		h = (h ^ uint32(c)) * 16777619
+	}
+	return &r.buckets[h%uint32(len(r.buckets))]
+}
+
+func (r *hashSkiplistRep) add(
+	_ *arenaskl.Inserter, key InternalKey, value []byte, checksum base.KVChecksum,
+) error {
+	// The inserter can't be used, since consecutive keys may be added to
+	// different buckets.
+	var ins arenaskl.Inserter
+	return ins.AddWithKVChecksum(r.bucket(key.UserKey), key, value, checksum)
+}
+
+func (r *hashSkiplistRep) newIter(lower, upper []byte) internalIterator {
+	return &hashSkiplistIter{rep: r, lower: lower, upper: upper}
+}
+
+func (r *hashSkiplistRep) newFlushIter(bytesFlushed *uint64) internalIterator {
+	iters := make([]internalIterator, len(r.buckets))
+	for i := range r.buckets {
+		iters[i] = r.buckets[i].NewFlushIter(bytesFlushed)
+	}
+	var stats base.InternalIteratorStats
+	return newMergingIter(nil /* logger */, &stats, r.cmp, nil /* split */, iters...)
+}
+
+func (r *hashSkiplistRep) indexSize() uint64 { return 0 }
+
+func (r *hashSkiplistRep) indexEntrySize() uint64 { return 0 }
+
+// hashSkiplistIter is an iterator over a hashSkiplistRep. Prefix seeks only
+// search the skiplist of the prefix, after which the iterator iterates over
+// that skiplist: it returns all the keys with the prefix, in order, along
+// with keys of other prefixes that hash to the same skiplist, as permitted by
+// the prefix iteration contract of InternalIterator. All other positioning
+// methods merge the skiplists.
+type hashSkiplistIter struct {
+	rep          *hashSkiplistRep
+	lower, upper []byte
+	// iter is the iterator positioned by the last positioning method: either
+	// merging, or bucketIter.
+	iter       internalIterator
+	merging    *mergingIter
+	bucketIter *arenaskl.Iterator
+	stats      base.InternalIteratorStats
+}
+
+// hashSkiplistIter implements the base.InternalIterator and
+// base.KVChecksumIterator interfaces.
+var _ base.InternalIterator = (*hashSkiplistIter)(nil)
+var _ base.KVChecksumIterator = (*hashSkiplistIter)(nil)
+
+func (i *hashSkiplistIter) String() string {
+	return "memtable"
+}
+
+func (i *hashSkiplistIter) useMerging() {
+	if i.merging == nil {
+		iters := make([]internalIterator, len(i.rep.buckets))
+		for j := range i.rep.buckets {
+			iters[j] = i.rep.buckets[j].NewIter(i.lower, i.upper)
+		}
+		i.merging = newMergingIter(nil /* logger */, &i.stats, i.rep.cmp, nil /* split */, iters...)
+	}
+	i.iter = i.merging
+}
+
+func (i *hashSkiplistIter) useBucket(userKey []byte) {
+	if i.bucketIter != nil {
+		_ = i.bucketIter.Close()
+	}
+	i.bucketIter = i.rep.bucket(userKey).NewIter(i.lower, i.upper)
+	i.iter = i.bucketIter
+}
+
+func (i *hashSkiplistIter) SeekGE(
+	key []byte, flags base.SeekGEFlags,
+) (*InternalKey, base.LazyValue) {
+	if i.iter != i.merging || i.merging == nil {
+		flags = flags.DisableTrySeekUsingNext()
+	}
+	i.useMerging()
+	return i.iter.SeekGE(key, flags)
+}
+
+func (i *hashSkiplistIter) SeekPrefixGE(
+	prefix, key []byte, flags base.SeekGEFlags,
+) (*InternalKey, base.LazyValue) {
+	i.useBucket(prefix)
+	return i.iter.SeekGE(key, flags.DisableTrySeekUsingNext())
+}
+
+func (i *hashSkiplistIter) SeekLT(
+	key []byte, flags base.SeekLTFlags,
+) (*InternalKey, base.LazyValue) {
+	i.useMerging()
+	return i.iter.SeekLT(key, flags)
+}
+
+func (i *hashSkiplistIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*InternalKey, base.LazyValue) {
+	i.useBucket(prefix)
+	return i.iter.SeekLT(key, flags)
+}
+
+func (i *hashSkiplistIter) First() (*InternalKey, base.LazyValue) {
+	i.useMerging()
+	return i.iter.First()
+}
+
+func (i *hashSkiplistIter) Last() (*InternalKey, base.LazyValue) {
+	i.useMerging()
+	return i.iter.Last()
+}
+
+func (i *hashSkiplistIter) Next() (*InternalKey, base.LazyValue) {
+	return i.iter.Next()
+}
+
+func (i *hashSkiplistIter) NextPrefix(succKey []byte) (*InternalKey, base.LazyValue) {
+	return i.iter.NextPrefix(succKey)
+}
+
+func (i *hashSkiplistIter) Prev() (*InternalKey, base.LazyValue) {
+	return i.iter.Prev()
+}
+
+// KVChecksum implements base.KVChecksumIterator.
+func (i *hashSkiplistIter) KVChecksum() (base.KVChecksum, bool) {
+	if i.iter == nil {
+		return 0, false
+	}
+	return base.IterKVChecksum(i.iter)
+}
+
+func (i *hashSkiplistIter) Error() error {
+	if i.iter == nil {
+		return nil
+	}
+	return i.iter.Error()
+}
+
+func (i *hashSkiplistIter) Close() error {
+	var err error
+	if i.merging != nil {
+		err = i.merging.Close()
+		i.merging = nil
+	}
+	if i.bucketIter != nil {
+		err = firstError(err, i.bucketIter.Close())
+		i.bucketIter = nil
+	}
+	i.iter = nil
+	return err
+}
+
+func (i *hashSkiplistIter) SetBounds(lower, upper []byte) {
+	i.lower, i.upper = lower, upper
+	if i.merging != nil {
+		i.merging.SetBounds(lower, upper)
+	}
+	if i.bucketIter != nil {
+		i.bucketIter.SetBounds(lower, upper)
+	}
+}
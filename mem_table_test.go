@@ -18,7 +18,9 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/rangekey"
+	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/rand"
 	"golang.org/x/sync/errgroup"
@@ -27,7 +29,7 @@ import (
 // get gets the value for the given key. It returns ErrNotFound if the DB does
 // not contain the key.
 func (m *memTable) get(key []byte) (value []byte, err error) {
-	it := m.skl.NewIter(nil, nil)
+	it := m.newIter(nil)
 	ikey, val := it.SeekGE(key, base.SeekGEFlagsNone)
 	if ikey == nil {
 		return nil, ErrNotFound
@@ -61,7 +63,7 @@ func (m *memTable) set(key InternalKey, value []byte) error {
 		m.rangeKeys.invalidate(1)
 		return nil
 	}
-	return m.skl.Add(key, value)
+	return m.points.add(&arenaskl.Inserter{}, key, value, base.MakeKVChecksum(key.Kind(), key.UserKey, value))
 }
 
 // count returns the number of entries in a DB.
@@ -340,6 +342,50 @@ func TestMemTableDeleteRange(t *testing.T) {
 	})
 }
 
+func TestMemTableRangeKVChecksums(t *testing.T) {
+	testCases := []struct {
+		name    string
+		end     string
+		newIter func(m *memTable) keyspan.FragmentIterator
+	}{
+		{"range-del", "range-del-end", func(m *memTable) keyspan.FragmentIterator {
+			return m.newRangeDelIter(nil)
+		}},
+		{"range-key", "range-key-end", func(m *memTable) keyspan.FragmentIterator {
+			return m.newRangeKeyIter(nil)
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			newMem := func() *memTable {
+				b := newBatch(nil)
+				require.NoError(t, b.DeleteRange([]byte("a"), []byte("range-del-end"), nil))
+				require.NoError(t, b.RangeKeySet([]byte("a"), []byte("range-key-end"), nil, []byte("v"), nil))
+				m := newMemTable(memTableOptions{kvChecksums: true})
+				require.NoError(t, m.apply(b, 1))
+				return m
+			}
+
+			// An intact span is read back.
+			iter := tc.newIter(newMem())
+			require.NotNil(t, iter.First())
+			require.NoError(t, iter.Close())
+
+			// Corrupting the span's end key before it's first fragmented is
+			// detected.
+			m := newMem()
+			i := bytes.Index(m.arenaBuf, []byte(tc.end))
+			require.GreaterOrEqual(t, i, 0)
+			m.arenaBuf[i] ^= 0xff
+			iter = tc.newIter(m)
+			require.Nil(t, iter.First())
+			err := iter.Close()
+			require.Error(t, err)
+			require.True(t, errors.Is(err, base.ErrCorruption), "%v", err)
+		})
+	}
+}
+
 func TestMemTableConcurrentDeleteRange(t *testing.T) {
 	// Concurrently write and read range tombstones. Workers add range
 	// tombstones, and then immediately retrieve them verifying that the
@@ -389,7 +435,7 @@ func TestMemTableReserved(t *testing.T) {
 	m.writerRef()
 	// The initial reservation accounts for the already allocated bytes from the
 	// arena.
-	require.Equal(t, m.reserved, m.skl.Arena().Size())
+	require.Equal(t, m.reserved, m.arena.Size())
 	b := newBatch(nil)
 	b.Set([]byte("blueberry"), []byte("pie"), nil)
 	require.NotEqual(t, 0, int(b.memTableSize))
@@ -398,6 +444,199 @@ func TestMemTableReserved(t *testing.T) {
 	require.Equal(t, int(m.reserved), int(b.memTableSize)+int(prevReserved))
 }
 
+func TestMemTableVectorIndexSize(t *testing.T) {
+	m := newMemTable(memTableOptions{
+		Options: &Options{MemTableKind: VectorMemTable{}},
+		size:    64 << 10,
+	})
+	for i := 0; ; i++ {
+		b := newBatch(nil)
+		require.NoError(t, b.Set([]byte(fmt.Sprintf("%05d", i)), nil, nil))
+		if err := m.prepare(b); err == arenaskl.ErrArenaFull {
+			break
+		} else {
+			require.NoError(t, err)
+		}
+		require.NoError(t, m.apply(b, uint64(i+1)))
+		m.writerUnref()
+	}
+	// The index of the vector is allocated outside the arena, but counts
+	// toward the size of the memtable.
+	index := m.points.indexSize()
+	require.Less(t, uint64(0), index)
+	require.LessOrEqual(t, uint64(m.arena.Size())+index, m.totalBytes())
+	require.Equal(t, m.totalBytes()-uint64(m.arena.Size())-index, uint64(m.availBytes()))
+}
+
+func TestMemTableKinds(t *testing.T) {
+	kinds := []MemTableKind{
+		SkiplistMemTable{},
+		HashSkiplistMemTable{Buckets: 4},
+		VectorMemTable{},
+	}
+	for _, f := range kinds {
+		t.Run(f.String(), func(t *testing.T) {
+			seed := uint64(time.Now().UnixNano())
+			t.Logf("seed: %d", seed)
+			rng := rand.New(rand.NewSource(seed))
+
+			// The memtable of the kind is compared against a memtable
+			// using the default skiplist.
+			newMem := func(f MemTableKind) *memTable {
+				return newMemTable(memTableOptions{
+					Options: &Options{Comparer: testkeys.Comparer, MemTableKind: f},
+					size:    1 << 20,
+				})
+			}
+			m, model := newMem(f), newMem(SkiplistMemTable{})
+			require.True(t, m.empty())
+
+			ks := testkeys.Alpha(2)
+			randKey := func() []byte {
+				return testkeys.KeyAt(ks, rng.Intn(ks.Count()), rng.Intn(5))
+			}
+			var buf bytes.Buffer
+			format := func(key *InternalKey, value base.LazyValue) {
+				if key == nil {
+					buf.WriteString(".\n")
+					return
+				}
+				fmt.Fprintf(&buf, "%s:%s\n", key, value.InPlaceValue())
+			}
+			run := func(m *memTable, ops []string) string {
+				buf.Reset()
+				iter := m.newIter(nil)
+				defer iter.Close()
+				for _, op := range ops {
+					switch fields := strings.Fields(op); fields[0] {
+					case "first":
+						for key, value := iter.First(); key != nil; key, value = iter.Next() {
+							format(key, value)
+						}
+					case "last":
+						for key, value := iter.Last(); key != nil; key, value = iter.Prev() {
+							format(key, value)
+						}
+					case "seek-ge":
+						if key, value := iter.SeekGE([]byte(fields[1]), base.SeekGEFlagsNone); key != nil {
+							format(key, value)
+							format(iter.Next())
+						}
+					case "seek-lt":
+						if key, value := iter.SeekLT([]byte(fields[1]), base.SeekLTFlagsNone); key != nil {
+							format(key, value)
+							format(iter.Prev())
+						}
+					case "seek-prefix-ge":
+						// Only the keys with the prefix are compared, since a
+						// prefix iterator may return keys with other prefixes.
+						key := []byte(fields[1])
+						prefix := key[:testkeys.Comparer.Split(key)]
+						k, v := iter.SeekPrefixGE(prefix, key, base.SeekGEFlagsNone)
+						split := testkeys.Comparer.Split
+						for ; k != nil && bytes.Equal(k.UserKey[:split(k.UserKey)], prefix); k, v = iter.Next() {
+							format(k, v)
+						}
+						buf.WriteString("|\n")
+					}
+				}
+				return buf.String()
+			}
+
+			for i := 0; i < 2000; i++ {
+				key := base.MakeInternalKey(randKey(), uint64(i), InternalKeyKindSet)
+				value := []byte(strconv.Itoa(i))
+				require.NoError(t, m.set(key, value))
+				require.NoError(t, model.set(key, value))
+				if i%100 != 0 {
+					continue
+				}
+				ops := []string{"first", "last"}
+				for j := 0; j < 20; j++ {
+					op := []string{"seek-ge", "seek-lt", "seek-prefix-ge"}[rng.Intn(3)]
+					ops = append(ops, fmt.Sprintf("%s %s", op, randKey()))
+				}
+				require.Equal(t, run(model, ops), run(m, ops))
+				require.Equal(t, m.inuseBytes(), m.bytesIterated(t))
+			}
+		})
+	}
+}
+
+func TestParseMemTableKind(t *testing.T) {
+	for _, f := range []MemTableKind{
+		SkiplistMemTable{},
+		HashSkiplistMemTable{Buckets: 7},
+		VectorMemTable{},
+	} {
+		parsed, err := parseMemTableKind(f.String())
+		require.NoError(t, err)
+		require.Equal(t, f, parsed)
+	}
+	_, err := parseMemTableKind("hash_skiplist(x)")
+	require.Error(t, err)
+	_, err = parseMemTableKind("btree")
+	require.Error(t, err)
+}
+
+func TestMemTableApplyConcurrently(t *testing.T) {
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	b := newBatch(nil)
+	for i := 0; i < 5000; i++ {
+		key := []byte(fmt.Sprintf("%05d", rng.Intn(2000)))
+		switch rng.Intn(20) {
+		case 0:
+			require.NoError(t, b.DeleteRange(key, append(key, 'x'), nil))
+		case 1:
+			require.NoError(t, b.RangeKeySet(key, append(key, 'x'), nil, []byte("v"), nil))
+		case 2:
+			require.NoError(t, b.LogData(key, nil))
+		case 3:
+			require.NoError(t, b.Delete(key, nil))
+		default:
+			require.NoError(t, b.Set(key, []byte(strconv.Itoa(i)), nil))
+		}
+	}
+
+	contents := func(m *memTable) string {
+		var buf strings.Builder
+		iter := m.newIter(nil)
+		for key, value := iter.First(); key != nil; key, value = iter.Next() {
+			fmt.Fprintf(&buf, "%s:%s\n", key, value.InPlaceValue())
+		}
+		require.NoError(t, iter.Close())
+		for _, spanIter := range []keyspan.FragmentIterator{m.newRangeDelIter(nil), m.newRangeKeyIter(nil)} {
+			for s := spanIter.First(); s != nil; s = spanIter.Next() {
+				fmt.Fprintf(&buf, "%s\n", s)
+			}
+			require.NoError(t, spanIter.Close())
+		}
+		return buf.String()
+	}
+
+	const seqNum = 100
+	var expected string
+	for _, concurrency := range []int{1, 2, 3, 8} {
+		opts := &Options{}
+		opts.Experimental.MemTableInsertConcurrency = concurrency
+		m := newMemTable(memTableOptions{Options: opts, size: 4 << 20})
+		if concurrency > 1 {
+			require.Less(t, 1, m.applyConcurrency(b))
+		}
+		require.NoError(t, m.prepare(b))
+		require.NoError(t, m.apply(b, seqNum))
+		m.writerUnref()
+		if got := contents(m); expected == "" {
+			expected = got
+		} else {
+			require.Equal(t, expected, got, "concurrency=%d", concurrency)
+		}
+	}
+}
+
 func buildMemTable(b *testing.B) (*memTable, [][]byte) {
 	m := newMemTable(memTableOptions{})
 	var keys [][]byte
@@ -451,3 +690,25 @@ func BenchmarkMemTableIterPrev(b *testing.B) {
 		_ = key
 	}
 }
+
+func BenchmarkMemTableApply(b *testing.B) {
+	batch := newBatch(nil)
+	value := make([]byte, 100)
+	for i := 0; i < 10000; i++ {
+		require.NoError(b, batch.Set([]byte(fmt.Sprintf("%08d", i)), value, nil))
+	}
+	for _, concurrency := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			opts := &Options{}
+			opts.Experimental.MemTableInsertConcurrency = concurrency
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				m := newMemTable(memTableOptions{Options: opts, size: 4 << 20})
+				b.StartTimer()
+				if err := m.apply(batch, 1); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
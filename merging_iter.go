@@ -261,8 +261,10 @@ type mergingIter struct {
 	forceEnableSeekOpt bool
 }
 
-// mergingIter implements the base.InternalIterator interface.
+// mergingIter implements the base.InternalIterator and
+// base.KVChecksumIterator interfaces.
 var _ base.InternalIterator = (*mergingIter)(nil)
+var _ base.KVChecksumIterator = (*mergingIter)(nil)
 
 // newMergingIter returns an iterator that merges its input. Walking the
 // resultant iterator will return all key/value pairs of all input iterators
@@ -571,6 +573,21 @@ func (m *mergingIter) maybeNextEntryWithinPrefix(l *mergingIterLevel) {
 	m.nextEntry(l, nil /* succKey */)
 }
 
+// maybePrevEntryWithinPrefix steps to the previous entry, as long as the
+// iteration prefix has not already been exceeded. If it has, it exhausts the
+// iterator by resetting the heap to empty. It is the reverse counterpart of
+// maybeNextEntryWithinPrefix, used during SeekPrefixLT prefix iteration.
+func (m *mergingIter) maybePrevEntryWithinPrefix(l *mergingIterLevel) {
+	if s := m.split(l.iterKey.UserKey); !bytes.Equal(m.prefix, l.iterKey.UserKey[:s]) {
+		// The item at the root of the heap is already before the iteration
+		// prefix. Clear the heap to reflect that the iterator is now exhausted
+		// (within this prefix, at least).
+		m.heap.items = m.heap.items[:0]
+		return
+	}
+	m.prevEntry(l)
+}
+
 // nextEntry unconditionally steps to the next entry. item is the current top
 // item in the heap.
 //
@@ -942,6 +959,21 @@ func (m *mergingIter) isPrevEntryDeleted(item *mergingIterLevel) bool {
 				if l.smallestUserKey != nil && m.heap.cmp(l.smallestUserKey, seekKey) > 0 {
 					seekKey = l.smallestUserKey
 				}
+				// If we're in prefix-seek mode (SeekPrefixLT) and the re-seek
+				// would move us before the iteration prefix, none of the levels
+				// below the tombstone's level can provide a key with the prefix.
+				// Remove them from the heap rather than re-seeking, mirroring
+				// the analogous case in isNextEntryDeleted.
+				if m.prefix != nil {
+					if n := m.split(seekKey); !bytes.Equal(m.prefix, seekKey[:n]) {
+						for i := item.index; i < len(m.levels); i++ {
+							m.levels[i].iterKey = nil
+							m.levels[i].iterValue = base.LazyValue{}
+						}
+						m.initMaxHeap()
+						return true
+					}
+				}
 				// We set the relative-seek flag. This is important when
 				// iterating with lazy combined iteration. If there's a range
 				// key between this level's current file and the file the seek
@@ -951,7 +983,11 @@ func (m *mergingIter) isPrevEntryDeleted(item *mergingIterLevel) bool {
 				return true
 			}
 			if l.tombstone.CoversAt(m.snapshot, item.iterKey.SeqNum()) {
-				m.prevEntry(item)
+				if m.prefix == nil {
+					m.prevEntry(item)
+				} else {
+					m.maybePrevEntryWithinPrefix(item)
+				}
 				return true
 			}
 		}
@@ -975,7 +1011,11 @@ func (m *mergingIter) findPrevEntry() (*InternalKey, base.LazyValue) {
 			(!m.levels[item.index].isIgnorableBoundaryKey) {
 			return item.iterKey, item.iterValue
 		}
-		m.prevEntry(item)
+		if m.prefix == nil {
+			m.prevEntry(item)
+		} else {
+			m.maybePrevEntryWithinPrefix(item)
+		}
 	}
 	return nil, base.LazyValue{}
 }
@@ -1125,14 +1165,17 @@ func (m *mergingIter) SeekPrefixGE(
 func (m *mergingIter) seekLT(key []byte, level int, flags base.SeekLTFlags) {
 	// See the comment in seekGE regarding using tombstones to adjust the seek
 	// target per level.
-	m.prefix = nil
 	for ; level < len(m.levels); level++ {
 		if invariants.Enabled && m.upper != nil && m.heap.cmp(key, m.upper) > 0 {
 			m.logger.Fatalf("mergingIter: upper bound violation: %s > %s\n%s", key, m.upper, debug.Stack())
 		}
 
 		l := &m.levels[level]
-		l.iterKey, l.iterValue = l.iter.SeekLT(key, flags)
+		if m.prefix != nil {
+			l.iterKey, l.iterValue = l.iter.SeekPrefixLT(m.prefix, key, flags)
+		} else {
+			l.iterKey, l.iterValue = l.iter.SeekLT(key, flags)
+		}
 
 		// If this level contains overlapping range tombstones, alter the seek
 		// key accordingly. Caveat: If we're performing lazy-combined iteration,
@@ -1199,6 +1242,18 @@ func (m *mergingIter) SeekLT(key []byte, flags base.SeekLTFlags) (*InternalKey,
 	return m.findPrevEntry()
 }
 
+// SeekPrefixLT implements base.InternalIterator.SeekPrefixLT. Note that
+// SeekPrefixLT only checks the lower bound. It is up to the caller to ensure
+// that key is less than or equal to the upper bound.
+func (m *mergingIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	m.err = nil // clear cached iteration error
+	m.prefix = prefix
+	m.seekLT(key, 0 /* start level */, flags)
+	return m.findPrevEntry()
+}
+
 // First implements base.InternalIterator.First. Note that First only checks
 // the upper bound. It is up to the caller to ensure that key is greater than
 // or equal to the lower bound (e.g. via a call to SeekGE(lower)).
@@ -1234,6 +1289,10 @@ func (m *mergingIter) Next() (*InternalKey, base.LazyValue) {
 	}
 
 	if m.dir != 1 {
+		if m.prefix != nil {
+			m.err = errors.New("pebble: unsupported forward prefix iteration")
+			return nil, base.LazyValue{}
+		}
 		m.switchToMinHeap()
 		return m.findNextEntry()
 	}
@@ -1327,6 +1386,15 @@ func (m *mergingIter) Error() error {
 	return m.levels[m.heap.items[0].index].iter.Error()
 }
 
+// KVChecksum implements base.KVChecksumIterator, returning the checksum of
+// the current entry from the level it was read from.
+func (m *mergingIter) KVChecksum() (base.KVChecksum, bool) {
+	if m.heap.len() == 0 {
+		return 0, false
+	}
+	return base.IterKVChecksum(m.heap.items[0].iter)
+}
+
 func (m *mergingIter) Close() error {
 	for i := range m.levels {
 		iter := m.levels[i].iter
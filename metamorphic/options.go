@@ -7,6 +7,7 @@ package metamorphic
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -19,6 +20,7 @@ import (
 	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/cockroachdb/pebble/ribbon"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"golang.org/x/exp/rand"
@@ -339,6 +341,14 @@ func standardOptions() []*TestOptions {
 		25: `
 [TestOptions]
   enable_value_blocks=true
+`,
+		26: `
+[Options]
+  mem_table_kind=vector
+`,
+		27: `
+[Options]
+  mem_table_kind=hash_skiplist(4)
 `,
 	}
 
@@ -408,6 +418,16 @@ func randomOptions(
 	opts.MaxManifestFileSize = 1 << uint(rng.Intn(30)) // 1B  - 1GB
 	opts.MemTableSize = 2 << (10 + uint(rng.Intn(16))) // 2KB - 256MB
 	opts.MemTableStopWritesThreshold = 2 + rng.Intn(5) // 2 - 5
+	switch rng.Intn(3) {
+	case 0:
+		opts.MemTableKind = pebble.SkiplistMemTable{}
+	case 1:
+		opts.MemTableKind = pebble.HashSkiplistMemTable{Buckets: 1 + rng.Intn(32)} // 1 - 32
+	case 2:
+		opts.MemTableKind = pebble.VectorMemTable{}
+	}
+	opts.PinL0L1IndexAndFilterBlocks = rng.Intn(2) == 0
+	opts.RecordLatencies = rng.Intn(2) == 0
 	if rng.Intn(2) == 0 {
 		opts.WALDir = "data/wal"
 	}
@@ -418,6 +438,8 @@ func randomOptions(
 		opts.Experimental.MaxWriterConcurrency = 2
 		opts.Experimental.ForceWriterParallelism = true
 	}
+	opts.Experimental.MaxFlushConcurrency = 1 + rng.Intn(4)       // 1-4
+	opts.Experimental.MemTableInsertConcurrency = 1 + rng.Intn(4) // 1-4
 	if rng.Intn(2) == 0 {
 		opts.Experimental.DisableIngestAsFlushable = func() bool { return true }
 	}
@@ -427,14 +449,43 @@ func randomOptions(
 	lopts.BlockSizeThreshold = 50 + rng.Intn(50)   // 50 - 100
 	lopts.IndexBlockSize = 1 << uint(rng.Intn(24)) // 1 - 16MB
 	lopts.TargetFileSize = 1 << uint(rng.Intn(28)) // 1 - 256MB
-	// We either use no bloom filter, the default filter, or a filter with
-	// randomized bits-per-key setting.
-	switch rng.Intn(3) {
+	// We either use the default compression, adaptive compression with a
+	// randomized zstd budget, or zstd or LZ4 with a randomized compression
+	// level.
+	switch rng.Intn(4) {
 	case 0:
 	case 1:
-		lopts.FilterPolicy = bloom.FilterPolicy(10)
+		lopts.Compression = pebble.AdaptiveCompression
+		lopts.AdaptiveZstdBudget = time.Microsecond * time.Duration(rng.Intn(100)) // 0-100us
+	case 2:
+		lopts.Compression = pebble.ZstdCompression
+		lopts.CompressionLevel = rng.Intn(10) // 0 - 9
 	default:
+		lopts.Compression = pebble.LZ4Compression
+		lopts.CompressionLevel = rng.Intn(10) // 0 - 9
+	}
+	// We either use no filter, the default bloom filter, a bloom filter with
+	// randomized bits-per-key setting, a blocked bloom filter or a ribbon
+	// filter. Filters may be tuned to a randomized false positive rate.
+	switch rng.Intn(5) {
+	case 0:
+	case 1:
+		lopts.FilterPolicy = bloom.FilterPolicy(10)
+	case 2:
 		lopts.FilterPolicy = newTestingFilterPolicy(1 << rng.Intn(5))
+	case 3:
+		lopts.FilterPolicy = bloom.BlockedFilterPolicy(10)
+	default:
+		lopts.FilterPolicy = ribbon.FilterPolicy(7)
+	}
+	if lopts.FilterPolicy != nil && rng.Intn(2) == 0 {
+		lopts.FilterFalsePositiveRate = math.Pow(10, -1-3*rng.Float64()) // 0.0001 - 0.1
+	}
+	if lopts.FilterPolicy != nil && rng.Intn(2) == 0 {
+		lopts.PartitionFilters = true
+	}
+	if lopts.FilterPolicy != nil && rng.Intn(2) == 0 {
+		lopts.RangeFilterPrefixLen = 1 + rng.Intn(4) // 1 - 4
 	}
 	opts.Levels = []pebble.LevelOptions{lopts}
 
@@ -531,7 +582,7 @@ type testingFilterPolicy struct {
 	bloom.FilterPolicy
 }
 
-var _ pebble.FilterPolicy = (*testingFilterPolicy)(nil)
+var _ pebble.TunableFilterPolicy = (*testingFilterPolicy)(nil)
 
 func newTestingFilterPolicy(bitsPerKey int) *testingFilterPolicy {
 	return &testingFilterPolicy{
@@ -549,12 +600,21 @@ func (t *testingFilterPolicy) Name() string {
 	return fmt.Sprintf(testingFilterPolicyFmt, t.FilterPolicy)
 }
 
+// WithFalsePositiveRate implements the pebble.TunableFilterPolicy interface.
+func (t *testingFilterPolicy) WithFalsePositiveRate(rate float64) pebble.FilterPolicy {
+	return newTestingFilterPolicy(int(t.FilterPolicy.WithFalsePositiveRate(rate).(bloom.FilterPolicy)))
+}
+
 func filterPolicyFromName(name string) (pebble.FilterPolicy, error) {
 	switch name {
 	case "none":
 		return nil, nil
 	case "rocksdb.BuiltinBloomFilter":
 		return bloom.FilterPolicy(10), nil
+	case "pebble.BlockedBloomFilter":
+		return bloom.BlockedFilterPolicy(10), nil
+	case "pebble.RibbonFilter":
+		return ribbon.FilterPolicy(7), nil
 	}
 	var bitsPerKey int
 	if _, err := fmt.Sscanf(name, testingFilterPolicyFmt, &bitsPerKey); err != nil {
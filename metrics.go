@@ -21,7 +21,7 @@ import (
 // CacheMetrics holds metrics for the block and table cache.
 type CacheMetrics = cache.Metrics
 
-// FilterMetrics holds metrics for the filter policy
+// FilterMetrics holds metrics for the filter policy.
 type FilterMetrics = sstable.FilterMetrics
 
 // ThroughputMetric is a cumulative throughput metric. See the detailed
@@ -156,6 +156,26 @@ func (m *LevelMetrics) format(
 type Metrics struct {
 	BlockCache CacheMetrics
 
+	// SecondaryCache holds the metrics of Options.SecondaryCache, if set.
+	SecondaryCache SecondaryCacheMetrics
+
+	// CacheWarming holds the progress of prefetching the blocks dumped when
+	// the DB was last closed. See Options.CacheWarming.
+	CacheWarming struct {
+		// The number of blocks to prefetch.
+		BlocksTotal int64
+		// The number and size of the blocks prefetched into the cache.
+		BlocksWarmed int64
+		BytesWarmed  int64
+		// The number of blocks not prefetched because their table no longer
+		// exists, their read failed or the prefetching was canceled.
+		BlocksSkipped int64
+		// InProgress is true while the blocks are being prefetched.
+		InProgress bool
+		// The number of times the keys of the resident blocks were dumped.
+		Dumps int64
+	}
+
 	Compact struct {
 		// The total number of compactions, and per-compaction type counts.
 		Count            int64
@@ -182,6 +202,10 @@ type Metrics struct {
 		// Duration records the cumulative duration of all compactions since the
 		// database was opened.
 		Duration time.Duration
+		// GCDroppedBytes is the cumulative size of the keys and values dropped
+		// by compactions because they were MVCC versions below a GC threshold
+		// (see DB.SetGCThreshold).
+		GCDroppedBytes uint64
 	}
 
 	Ingest struct {
@@ -196,6 +220,12 @@ type Metrics struct {
 		// Number of flushes that are in-progress. In the current implementation
 		// this will always be zero or one.
 		NumInProgress int64
+		// ParallelCount is the number of flushes that were split into
+		// sub-flushes written concurrently, and SubFlushCount is the number of
+		// sub-flushes they were split into. See
+		// Options.Experimental.MaxFlushConcurrency.
+		ParallelCount int64
+		SubFlushCount int64
 		// AsIngestCount is a monotonically increasing counter of flush operations
 		// handling ingested tables.
 		AsIngestCount uint64
@@ -208,6 +238,11 @@ type Metrics struct {
 	}
 
 	Filter FilterMetrics
+	// LevelFilter holds the filter metrics of iterators over each level's
+	// tables, which may be used to tune per-level filter policies and false
+	// positive rates (see LevelOptions.FilterFalsePositiveRate). Filter checks
+	// by iterators not associated with a level are only included in Filter.
+	LevelFilter [numLevels]FilterMetrics
 
 	Levels [numLevels]LevelMetrics
 
@@ -291,6 +326,10 @@ type Metrics struct {
 		record.LogWriterMetrics
 	}
 
+	// Latency holds histograms of the latencies of foreground operations, if
+	// Options.RecordLatencies is set.
+	Latency LatencyMetrics
+
 	private struct {
 		optionsFileSize  uint64
 		manifestFileSize uint64
@@ -0,0 +1,643 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package metrics exports the metrics of a pebble.DB as Prometheus metrics.
+//
+// An Exporter collects every field of pebble.Metrics as a gauge or a
+// counter, labelled by level, compaction kind, cache and cache priority class
+// where applicable, along with histograms of the latencies of flushes,
+// compactions, WAL syncs, slow disk operations and foreground operations (see
+// pebble.LatencyMetrics, which are only recorded if
+// pebble.Options.RecordLatencies is set). The histograms of flushes, compactions and slow disk
+// operations are fed by an EventListener, which must be installed before the
+// DB is opened:
+//
+//	e := metrics.NewExporter(metrics.ExporterOptions{})
+//	l := pebble.TeeEventListener(*opts.EventListener, e.EventListener())
+//	opts.EventListener = &l
+//	d, err := pebble.Open(dirname, opts)
+//	...
+//	e.Attach(d)
+//	http.Handle("/metrics", e.Handler())
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ExporterOptions holds the optional parameters of an Exporter.
+type ExporterOptions struct {
+	// Namespace is the prefix of the names of the metrics. The default is
+	// "pebble".
+	Namespace string
+	// ConstLabels are added to every metric, such as a label identifying the
+	// store when a process exports the metrics of several DBs.
+	ConstLabels prometheus.Labels
+	// DurationBuckets are the buckets, in seconds, of the histograms of the
+	// durations of flushes, compactions and slow disk operations. The default
+	// is prometheus.ExponentialBuckets(0.001, 2, 20), ranging from 1ms to
+	// about 9 minutes.
+	DurationBuckets []float64
+	// OperationLatencyBuckets are the buckets, in seconds, of the histograms of
+	// the latencies of foreground operations, such as gets and commits, which
+	// usually take well under a millisecond. The default is
+	// prometheus.ExponentialBuckets(250e-9, 2, 23), ranging from 250ns to
+	// about 1s.
+	OperationLatencyBuckets []float64
+}
+
+// Exporter is a prometheus.Collector of the metrics of a DB.
+type Exporter struct {
+	constLabels prometheus.Labels
+	ns          string
+
+	flushDuration      prometheus.Histogram
+	compactionDuration *prometheus.HistogramVec
+	diskSlowDuration   *prometheus.HistogramVec
+
+	walFsyncLatency *prometheus.Desc
+	opLatency       *prometheus.Desc
+	opBuckets       []float64
+	values          []valueDef
+	levelValues     []levelDef
+	cacheValues     []cacheDef
+	compactionKinds *prometheus.Desc
+	cacheClassHits  *prometheus.Desc
+	cacheClassMiss  *prometheus.Desc
+
+	mu struct {
+		sync.Mutex
+		db *pebble.DB
+		// walFsync accumulates the WAL fsync latency histograms of the
+		// previous WAL files, which are replaced whenever the WAL is rotated,
+		// so that the exported histogram is cumulative.
+		walFsync struct {
+			current prometheus.Histogram
+			retired histogramData
+		}
+	}
+}
+
+// Exporter implements the prometheus.Collector interface.
+var _ prometheus.Collector = (*Exporter)(nil)
+
+// NewExporter returns a new Exporter, which exports no metrics other than the
+// latency histograms until a DB is attached to it.
+func NewExporter(opts ExporterOptions) *Exporter {
+	if opts.Namespace == "" {
+		opts.Namespace = "pebble"
+	}
+	if opts.DurationBuckets == nil {
+		opts.DurationBuckets = prometheus.ExponentialBuckets(0.001, 2, 20)
+	}
+	if opts.OperationLatencyBuckets == nil {
+		opts.OperationLatencyBuckets = prometheus.ExponentialBuckets(250e-9, 2, 23)
+	}
+	e := &Exporter{
+		constLabels: opts.ConstLabels,
+		ns:          opts.Namespace,
+		opBuckets:   opts.OperationLatencyBuckets,
+	}
+	e.flushDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace:   e.ns,
+		Name:        "flush_duration_seconds",
+		Help:        "Duration of flushes.",
+		ConstLabels: e.constLabels,
+		Buckets:     opts.DurationBuckets,
+	})
+	e.compactionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   e.ns,
+		Name:        "compaction_duration_seconds",
+		Help:        "Duration of compactions, by the reason for the compaction.",
+		ConstLabels: e.constLabels,
+		Buckets:     opts.DurationBuckets,
+	}, []string{"reason"})
+	e.diskSlowDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   e.ns,
+		Name:        "disk_slow_duration_seconds",
+		Help:        "Duration of disk operations that exceeded the disk slow threshold, by operation.",
+		ConstLabels: e.constLabels,
+		Buckets:     opts.DurationBuckets,
+	}, []string{"op"})
+	e.walFsyncLatency = e.desc("wal_fsync_latency_seconds", "Latency of WAL fsyncs.")
+	e.opLatency = e.desc("operation_latency_seconds",
+		"Latency of foreground operations, by operation.", "op")
+	e.compactionKinds = e.desc("compactions_total", "Number of compactions, by kind.", "kind")
+	e.cacheClassHits = e.desc("block_cache_class_hits_total",
+		"Number of block cache hits, by priority class.", "class")
+	e.cacheClassMiss = e.desc("block_cache_class_misses_total",
+		"Number of block cache misses, by priority class.", "class")
+	e.values = e.newValueDefs()
+	e.levelValues = e.newLevelDefs()
+	e.cacheValues = e.newCacheDefs()
+	return e
+}
+
+// EventListener returns an EventListener which records the durations of
+// flushes, compactions and slow disk operations. It should be teed with the
+// DB's EventListener (see pebble.TeeEventListener).
+func (e *Exporter) EventListener() pebble.EventListener {
+	return pebble.EventListener{
+		FlushEnd: func(info pebble.FlushInfo) {
+			if info.Err == nil {
+				e.flushDuration.Observe(info.Duration.Seconds())
+			}
+		},
+		CompactionEnd: func(info pebble.CompactionInfo) {
+			if info.Err == nil {
+				e.compactionDuration.WithLabelValues(info.Reason).Observe(info.Duration.Seconds())
+			}
+		},
+		DiskSlow: func(info pebble.DiskSlowInfo) {
+			e.diskSlowDuration.WithLabelValues(info.OpType.String()).Observe(info.Duration.Seconds())
+		},
+	}
+}
+
+// Attach sets the DB whose metrics are exported. It may be called again with
+// a new DB if the DB is reopened, or with nil when the DB is closed.
+func (e *Exporter) Attach(d *pebble.DB) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mu.db = d
+}
+
+// Handler returns an http.Handler serving the metrics in the Prometheus text
+// format, or in the OpenMetrics text format if the request accepts it.
+func (e *Exporter) Handler() http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(e)
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
+
+// Describe implements prometheus.Collector.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	e.flushDuration.Describe(ch)
+	e.compactionDuration.Describe(ch)
+	e.diskSlowDuration.Describe(ch)
+	ch <- e.walFsyncLatency
+	ch <- e.opLatency
+	ch <- e.compactionKinds
+	ch <- e.cacheClassHits
+	ch <- e.cacheClassMiss
+	for _, d := range e.values {
+		ch <- d.desc
+	}
+	for _, d := range e.levelValues {
+		ch <- d.desc
+	}
+	for _, d := range e.cacheValues {
+		ch <- d.desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.flushDuration.Collect(ch)
+	e.compactionDuration.Collect(ch)
+	e.diskSlowDuration.Collect(ch)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.mu.db == nil {
+		return
+	}
+	m := e.mu.db.Metrics()
+
+	for _, d := range e.values {
+		ch <- prometheus.MustNewConstMetric(d.desc, d.typ, d.value(m))
+	}
+	for level := range m.Levels {
+		label := levelLabel(level)
+		for _, d := range e.levelValues {
+			ch <- prometheus.MustNewConstMetric(d.desc, d.typ, d.value(m, level), label)
+		}
+	}
+	for _, c := range []struct {
+		name    string
+		metrics *pebble.CacheMetrics
+	}{
+		{"block", &m.BlockCache},
+		{"table", &m.TableCache},
+	} {
+		for _, d := range e.cacheValues {
+			ch <- prometheus.MustNewConstMetric(d.desc, d.typ, d.value(c.metrics), c.name)
+		}
+	}
+	for p := cache.Priority(0); p < cache.NumPriorities; p++ {
+		class := m.BlockCache.Classes[p]
+		ch <- prometheus.MustNewConstMetric(
+			e.cacheClassHits, prometheus.CounterValue, float64(class.Hits), p.String())
+		ch <- prometheus.MustNewConstMetric(
+			e.cacheClassMiss, prometheus.CounterValue, float64(class.Misses), p.String())
+	}
+	for _, k := range []struct {
+		kind  string
+		count int64
+	}{
+		{"default", m.Compact.DefaultCount},
+		{"delete-only", m.Compact.DeleteOnlyCount},
+		{"elision-only", m.Compact.ElisionOnlyCount},
+		{"move", m.Compact.MoveCount},
+		{"read", m.Compact.ReadCount},
+		{"rewrite", m.Compact.RewriteCount},
+		{"multi-level", m.Compact.MultiLevelCount},
+	} {
+		ch <- prometheus.MustNewConstMetric(
+			e.compactionKinds, prometheus.CounterValue, float64(k.count), k.kind)
+	}
+	ch <- e.collectWALFsyncLatency(m.LogWriter.FsyncLatency)
+	for _, l := range []struct {
+		op string
+		h  *pebble.LatencyHistogram
+	}{
+		{"get", &m.Latency.Get},
+		{"iter-seek-ge", &m.Latency.IterSeekGE},
+		{"commit", &m.Latency.Commit.Total},
+		{"commit-queue-wait", &m.Latency.Commit.QueueWait},
+		{"commit-wal-write", &m.Latency.Commit.WALWrite},
+		{"commit-wal-sync", &m.Latency.Commit.WALSync},
+		{"commit-memtable-apply", &m.Latency.Commit.MemTableApply},
+	} {
+		buckets := make(map[float64]uint64, len(e.opBuckets))
+		for _, upper := range e.opBuckets {
+			buckets[upper] = l.h.CumulativeCount(time.Duration(upper * float64(time.Second)))
+		}
+		ch <- prometheus.MustNewConstHistogram(
+			e.opLatency, l.h.Count, l.h.Sum.Seconds(), buckets, l.op)
+	}
+}
+
+// collectWALFsyncLatency returns the cumulative histogram of the latencies of
+// the WAL fsyncs. The histogram of the DB is replaced whenever the WAL is
+// rotated, so the counts of the replaced histograms are accumulated.
+func (e *Exporter) collectWALFsyncLatency(h prometheus.Histogram) prometheus.Metric {
+	w := &e.mu.walFsync
+	if h != w.current {
+		if w.current != nil {
+			w.retired.add(readHistogram(w.current))
+		}
+		w.current = h
+	}
+	data := w.retired.clone()
+	if h != nil {
+		data.add(readHistogram(h))
+	}
+	// The DB's histogram records nanoseconds.
+	buckets := make(map[float64]uint64, len(data.buckets))
+	for upper, count := range data.buckets {
+		buckets[upper/float64(time.Second)] = count
+	}
+	return prometheus.MustNewConstHistogram(
+		e.walFsyncLatency, data.count, data.sum/float64(time.Second), buckets)
+}
+
+// histogramData holds the cumulative counts of a histogram.
+type histogramData struct {
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+}
+
+func readHistogram(h prometheus.Histogram) histogramData {
+	var m dto.Metric
+	if err := h.Write(&m); err != nil || m.Histogram == nil {
+		return histogramData{}
+	}
+	data := histogramData{
+		count:   m.Histogram.GetSampleCount(),
+		sum:     m.Histogram.GetSampleSum(),
+		buckets: make(map[float64]uint64, len(m.Histogram.Bucket)),
+	}
+	for _, b := range m.Histogram.Bucket {
+		data.buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+	}
+	return data
+}
+
+func (d *histogramData) add(o histogramData) {
+	d.count += o.count
+	d.sum += o.sum
+	if d.buckets == nil {
+		d.buckets = make(map[float64]uint64, len(o.buckets))
+	}
+	for upper, count := range o.buckets {
+		d.buckets[upper] += count
+	}
+}
+
+func (d histogramData) clone() histogramData {
+	c := histogramData{count: d.count, sum: d.sum}
+	c.add(histogramData{buckets: d.buckets})
+	return c
+}
+
+func (e *Exporter) desc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(e.ns, "", name), help, labels, e.constLabels)
+}
+
+func levelLabel(level int) string {
+	return string(rune('0' + level))
+}
+
+type valueDef struct {
+	desc  *prometheus.Desc
+	typ   prometheus.ValueType
+	value func(m *pebble.Metrics) float64
+}
+
+type levelDef struct {
+	desc  *prometheus.Desc
+	typ   prometheus.ValueType
+	value func(m *pebble.Metrics, level int) float64
+}
+
+type cacheDef struct {
+	desc  *prometheus.Desc
+	typ   prometheus.ValueType
+	value func(m *pebble.CacheMetrics) float64
+}
+
+const (
+	gauge   = prometheus.GaugeValue
+	counter = prometheus.CounterValue
+)
+
+func (e *Exporter) newValueDefs() []valueDef {
+	def := func(
+		name string, typ prometheus.ValueType, help string, value func(m *pebble.Metrics) float64,
+	) valueDef {
+		return valueDef{desc: e.desc(name, help), typ: typ, value: value}
+	}
+	seconds := func(d time.Duration) float64 { return d.Seconds() }
+	return []valueDef{
+		// Compactions.
+		def("compactions_all_total", counter, "Number of compactions of all kinds.",
+			func(m *pebble.Metrics) float64 { return float64(m.Compact.Count) }),
+		def("compaction_estimated_debt_bytes", gauge, "Estimated number of bytes to compact for the LSM to reach a stable state.",
+			func(m *pebble.Metrics) float64 { return float64(m.Compact.EstimatedDebt) }),
+		def("compaction_in_progress_bytes", gauge, "Size of the tables being written by in-progress compactions.",
+			func(m *pebble.Metrics) float64 { return float64(m.Compact.InProgressBytes) }),
+		def("compactions_in_progress", gauge, "Number of in-progress compactions.",
+			func(m *pebble.Metrics) float64 { return float64(m.Compact.NumInProgress) }),
+		def("compaction_marked_files", gauge, "Number of files marked for compaction.",
+			func(m *pebble.Metrics) float64 { return float64(m.Compact.MarkedFiles) }),
+		def("compaction_seconds_total", counter, "Cumulative duration of compactions.",
+			func(m *pebble.Metrics) float64 { return seconds(m.Compact.Duration) }),
+		def("compaction_gc_dropped_bytes_total", counter, "Size of the MVCC versions dropped by compactions below the GC threshold.",
+			func(m *pebble.Metrics) float64 { return float64(m.Compact.GCDroppedBytes) }),
+
+		// Ingestions.
+		def("ingestions_total", counter, "Number of ingestions.",
+			func(m *pebble.Metrics) float64 { return float64(m.Ingest.Count) }),
+
+		// Flushes.
+		def("flushes_total", counter, "Number of flushes.",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.Count) }),
+		def("flush_write_bytes_total", counter, "Number of bytes written by flushes.",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.WriteThroughput.Bytes) }),
+		def("flush_work_seconds_total", counter, "Time spent by flushes writing.",
+			func(m *pebble.Metrics) float64 { return seconds(m.Flush.WriteThroughput.WorkDuration) }),
+		def("flush_idle_seconds_total", counter, "Time spent by flushes waiting.",
+			func(m *pebble.Metrics) float64 { return seconds(m.Flush.WriteThroughput.IdleDuration) }),
+		def("flushes_in_progress", gauge, "Number of in-progress flushes.",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.NumInProgress) }),
+		def("flushes_parallel_total", counter, "Number of flushes split into concurrent sub-flushes.",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.ParallelCount) }),
+		def("flush_sub_flushes_total", counter, "Number of sub-flushes of parallel flushes.",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.SubFlushCount) }),
+		def("flushes_as_ingest_total", counter, "Number of flushes of ingested tables.",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.AsIngestCount) }),
+		def("flush_as_ingest_tables_total", counter, "Number of tables ingested as flushables.",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.AsIngestTableCount) }),
+		def("flush_as_ingest_bytes_total", counter, "Number of bytes of tables ingested as flushables.",
+			func(m *pebble.Metrics) float64 { return float64(m.Flush.AsIngestBytes) }),
+
+		// Filters.
+		def("filter_hits_total", counter, "Number of data block reads avoided by filters.",
+			func(m *pebble.Metrics) float64 { return float64(m.Filter.Hits) }),
+		def("filter_misses_total", counter, "Number of filter checks that did not avoid a data block read.",
+			func(m *pebble.Metrics) float64 { return float64(m.Filter.Misses) }),
+		def("filter_false_positives_total", counter, "Number of filter misses for keys absent from the table.",
+			func(m *pebble.Metrics) float64 { return float64(m.Filter.FalsePositives) }),
+		def("range_filter_hits_total", counter, "Number of tables skipped by range filters.",
+			func(m *pebble.Metrics) float64 { return float64(m.Filter.RangeHits) }),
+		def("range_filter_misses_total", counter, "Number of range filter checks that did not skip the table.",
+			func(m *pebble.Metrics) float64 { return float64(m.Filter.RangeMisses) }),
+
+		// Memtables.
+		def("memtable_size_bytes", gauge, "Number of bytes allocated by memtables and large batches.",
+			func(m *pebble.Metrics) float64 { return float64(m.MemTable.Size) }),
+		def("memtables", gauge, "Number of memtables.",
+			func(m *pebble.Metrics) float64 { return float64(m.MemTable.Count) }),
+		def("memtable_zombie_size_bytes", gauge, "Number of bytes of zombie memtables.",
+			func(m *pebble.Metrics) float64 { return float64(m.MemTable.ZombieSize) }),
+		def("memtable_zombies", gauge, "Number of zombie memtables.",
+			func(m *pebble.Metrics) float64 { return float64(m.MemTable.ZombieCount) }),
+
+		// Keys.
+		def("range_key_sets", gauge, "Approximate number of range key sets.",
+			func(m *pebble.Metrics) float64 { return float64(m.Keys.RangeKeySetsCount) }),
+		def("tombstones", gauge, "Approximate number of tombstones.",
+			func(m *pebble.Metrics) float64 { return float64(m.Keys.TombstoneCount) }),
+
+		// Snapshots.
+		def("snapshots", gauge, "Number of open snapshots.",
+			func(m *pebble.Metrics) float64 { return float64(m.Snapshots.Count) }),
+		def("snapshot_earliest_seqnum", gauge, "Sequence number of the earliest open snapshot.",
+			func(m *pebble.Metrics) float64 { return float64(m.Snapshots.EarliestSeqNum) }),
+		def("snapshot_pinned_keys_total", counter, "Number of keys written that would have been elided without open snapshots.",
+			func(m *pebble.Metrics) float64 { return float64(m.Snapshots.PinnedKeys) }),
+		def("snapshot_pinned_bytes_total", counter, "Size of the keys written that would have been elided without open snapshots.",
+			func(m *pebble.Metrics) float64 { return float64(m.Snapshots.PinnedSize) }),
+
+		// Tables.
+		def("table_obsolete_size_bytes", gauge, "Size of obsolete tables.",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.ObsoleteSize) }),
+		def("table_obsolete", gauge, "Number of obsolete tables.",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.ObsoleteCount) }),
+		def("table_zombie_size_bytes", gauge, "Size of zombie tables.",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.ZombieSize) }),
+		def("table_zombies", gauge, "Number of zombie tables.",
+			func(m *pebble.Metrics) float64 { return float64(m.Table.ZombieCount) }),
+		def("table_iterators", gauge, "Number of open table iterators.",
+			func(m *pebble.Metrics) float64 { return float64(m.TableIters) }),
+
+		// Secondary cache.
+		def("secondary_cache_size_bytes", gauge, "Size of the secondary cache's files.",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCache.Size) }),
+		def("secondary_cache_entries", gauge, "Number of blocks in the secondary cache.",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCache.Count) }),
+		def("secondary_cache_hits_total", counter, "Number of secondary cache hits.",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCache.Hits) }),
+		def("secondary_cache_misses_total", counter, "Number of secondary cache misses.",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCache.Misses) }),
+		def("secondary_cache_writes_total", counter, "Number of blocks written to the secondary cache.",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCache.Writes) }),
+		def("secondary_cache_write_bytes_total", counter, "Size of the blocks written to the secondary cache.",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCache.WriteBytes) }),
+		def("secondary_cache_rejected_total", counter, "Number of blocks not admitted to the secondary cache.",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCache.Rejected) }),
+		def("secondary_cache_dropped_total", counter, "Number of admitted blocks dropped by the secondary cache.",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCache.Dropped) }),
+		def("secondary_cache_evictions_total", counter, "Number of blocks evicted from the secondary cache.",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCache.Evictions) }),
+		def("secondary_cache_corrupt_reads_total", counter, "Number of corrupt blocks read from the secondary cache.",
+			func(m *pebble.Metrics) float64 { return float64(m.SecondaryCache.CorruptReads) }),
+
+		// Cache warming.
+		def("cache_warming_blocks", gauge, "Number of blocks to prefetch when warming the cache.",
+			func(m *pebble.Metrics) float64 { return float64(m.CacheWarming.BlocksTotal) }),
+		def("cache_warming_warmed_blocks", gauge, "Number of blocks prefetched when warming the cache.",
+			func(m *pebble.Metrics) float64 { return float64(m.CacheWarming.BlocksWarmed) }),
+		def("cache_warming_warmed_bytes", gauge, "Size of the blocks prefetched when warming the cache.",
+			func(m *pebble.Metrics) float64 { return float64(m.CacheWarming.BytesWarmed) }),
+		def("cache_warming_skipped_blocks", gauge, "Number of blocks skipped when warming the cache.",
+			func(m *pebble.Metrics) float64 { return float64(m.CacheWarming.BlocksSkipped) }),
+		def("cache_warming_in_progress", gauge, "Whether the cache is being warmed.",
+			func(m *pebble.Metrics) float64 { return boolValue(m.CacheWarming.InProgress) }),
+		def("cache_warming_dumps_total", counter, "Number of dumps of the keys of the resident blocks.",
+			func(m *pebble.Metrics) float64 { return float64(m.CacheWarming.Dumps) }),
+
+		// WAL.
+		def("wal_files", gauge, "Number of live WAL files.",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.Files) }),
+		def("wal_obsolete_files", gauge, "Number of obsolete WAL files.",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.ObsoleteFiles) }),
+		def("wal_obsolete_physical_size_bytes", gauge, "Physical size of the obsolete WAL files.",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.ObsoletePhysicalSize) }),
+		def("wal_size_bytes", gauge, "Size of the live data in the WAL files.",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.Size) }),
+		def("wal_physical_size_bytes", gauge, "Physical size of the WAL files.",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.PhysicalSize) }),
+		def("wal_bytes_in_total", counter, "Number of logical bytes written to the WAL.",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.BytesIn) }),
+		def("wal_bytes_written_total", counter, "Number of bytes written to the WAL.",
+			func(m *pebble.Metrics) float64 { return float64(m.WAL.BytesWritten) }),
+		def("wal_writer_bytes_total", counter, "Number of bytes written by the WAL writer.",
+			func(m *pebble.Metrics) float64 { return float64(m.LogWriter.WriteThroughput.Bytes) }),
+		def("wal_writer_work_seconds_total", counter, "Time spent by the WAL writer writing.",
+			func(m *pebble.Metrics) float64 { return seconds(m.LogWriter.WriteThroughput.WorkDuration) }),
+		def("wal_writer_idle_seconds_total", counter, "Time spent by the WAL writer waiting.",
+			func(m *pebble.Metrics) float64 { return seconds(m.LogWriter.WriteThroughput.IdleDuration) }),
+		def("wal_writer_pending_buffers", gauge, "Mean number of buffers pending in the WAL writer.",
+			func(m *pebble.Metrics) float64 { return m.LogWriter.PendingBufferLen.Mean() }),
+		def("wal_writer_sync_queue_length", gauge, "Mean length of the WAL writer's sync queue.",
+			func(m *pebble.Metrics) float64 { return m.LogWriter.SyncQueueLen.Mean() }),
+
+		// Totals.
+		def("uptime_seconds", gauge, "Time since the DB was opened.",
+			func(m *pebble.Metrics) float64 { return seconds(m.Uptime) }),
+		def("disk_usage_bytes", gauge, "Disk space used by the DB, including obsolete files.",
+			func(m *pebble.Metrics) float64 { return float64(m.DiskSpaceUsage()) }),
+		def("read_amplification", gauge, "Number of L0 sublevels and non-empty levels below L0.",
+			func(m *pebble.Metrics) float64 { return float64(m.ReadAmp()) }),
+	}
+}
+
+func (e *Exporter) newLevelDefs() []levelDef {
+	def := func(
+		name string, typ prometheus.ValueType, help string, value func(l *pebble.LevelMetrics) float64,
+	) levelDef {
+		return levelDef{
+			desc: e.desc(name, help, "level"),
+			typ:  typ,
+			value: func(m *pebble.Metrics, level int) float64 {
+				return value(&m.Levels[level])
+			},
+		}
+	}
+	filterDef := func(
+		name, help string, value func(f *pebble.FilterMetrics) int64,
+	) levelDef {
+		return levelDef{
+			desc: e.desc(name, help, "level"),
+			typ:  counter,
+			value: func(m *pebble.Metrics, level int) float64 {
+				return float64(value(&m.LevelFilter[level]))
+			},
+		}
+	}
+	return []levelDef{
+		def("level_sublevels", gauge, "Number of sublevels of the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.Sublevels) }),
+		def("level_files", gauge, "Number of files in the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.NumFiles) }),
+		def("level_size_bytes", gauge, "Size of the files in the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.Size) }),
+		def("level_score", gauge, "Compaction score of the level.",
+			func(l *pebble.LevelMetrics) float64 { return l.Score }),
+		def("level_write_amplification", gauge, "Write amplification of the level.",
+			func(l *pebble.LevelMetrics) float64 { return l.WriteAmp() }),
+		def("level_bytes_in_total", counter, "Number of bytes read from other levels by compactions into the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.BytesIn) }),
+		def("level_bytes_ingested_total", counter, "Number of bytes ingested into the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.BytesIngested) }),
+		def("level_bytes_moved_total", counter, "Number of bytes moved into the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.BytesMoved) }),
+		def("level_bytes_read_total", counter, "Number of bytes read by compactions at the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.BytesRead) }),
+		def("level_bytes_compacted_total", counter, "Number of bytes written by compactions into the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.BytesCompacted) }),
+		def("level_bytes_flushed_total", counter, "Number of bytes written by flushes into the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.BytesFlushed) }),
+		def("level_tables_compacted_total", counter, "Number of tables written by compactions into the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.TablesCompacted) }),
+		def("level_tables_flushed_total", counter, "Number of tables written by flushes into the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.TablesFlushed) }),
+		def("level_tables_ingested_total", counter, "Number of tables ingested into the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.TablesIngested) }),
+		def("level_tables_moved_total", counter, "Number of tables moved into the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.TablesMoved) }),
+		def("level_value_blocks_size_bytes", gauge, "Size of the value blocks of the tables in the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.Additional.ValueBlocksSize) }),
+		def("level_data_block_bytes_written_total", counter, "Number of bytes written to data blocks of the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.Additional.BytesWrittenDataBlocks) }),
+		def("level_value_block_bytes_written_total", counter, "Number of bytes written to value blocks of the level.",
+			func(l *pebble.LevelMetrics) float64 { return float64(l.Additional.BytesWrittenValueBlocks) }),
+		filterDef("level_filter_hits_total", "Number of data block reads avoided by the level's filters.",
+			func(f *pebble.FilterMetrics) int64 { return f.Hits }),
+		filterDef("level_filter_misses_total", "Number of checks of the level's filters that did not avoid a data block read.",
+			func(f *pebble.FilterMetrics) int64 { return f.Misses }),
+		filterDef("level_filter_false_positives_total", "Number of the level's filter misses for keys absent from the table.",
+			func(f *pebble.FilterMetrics) int64 { return f.FalsePositives }),
+		filterDef("level_range_filter_hits_total", "Number of the level's tables skipped by range filters.",
+			func(f *pebble.FilterMetrics) int64 { return f.RangeHits }),
+		filterDef("level_range_filter_misses_total", "Number of checks of the level's range filters that did not skip the table.",
+			func(f *pebble.FilterMetrics) int64 { return f.RangeMisses }),
+	}
+}
+
+func (e *Exporter) newCacheDefs() []cacheDef {
+	def := func(
+		name string, typ prometheus.ValueType, help string, value func(c *pebble.CacheMetrics) float64,
+	) cacheDef {
+		return cacheDef{desc: e.desc(name, help, "cache"), typ: typ, value: value}
+	}
+	return []cacheDef{
+		def("cache_size_bytes", gauge, "Number of bytes in use by the cache.",
+			func(c *pebble.CacheMetrics) float64 { return float64(c.Size) }),
+		def("cache_entries", gauge, "Number of blocks or tables in the cache.",
+			func(c *pebble.CacheMetrics) float64 { return float64(c.Count) }),
+		def("cache_hits_total", counter, "Number of cache hits.",
+			func(c *pebble.CacheMetrics) float64 { return float64(c.Hits) }),
+		def("cache_misses_total", counter, "Number of cache misses.",
+			func(c *pebble.CacheMetrics) float64 { return float64(c.Misses) }),
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
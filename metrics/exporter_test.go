@@ -0,0 +1,97 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter(t *testing.T) {
+	e := NewExporter(ExporterOptions{})
+	l := e.EventListener()
+	opts := &pebble.Options{FS: vfs.NewMem(), EventListener: &l, RecordLatencies: true}
+	d, err := pebble.Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	e.Attach(d)
+
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 100; j++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("key%03d", j)), []byte("value"), pebble.Sync))
+		}
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, d.Compact([]byte("key000"), []byte("key100"), false /* parallelize */))
+	_, closer, err := d.Get([]byte("key001"))
+	require.NoError(t, err)
+	require.NoError(t, closer.Close())
+
+	scrape := func(accept string) string {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		e.Handler().ServeHTTP(w, req)
+		require.Equal(t, 200, w.Code)
+		body, err := io.ReadAll(w.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	out := scrape("application/openmetrics-text; version=0.0.1")
+	for _, want := range []string{
+		"# TYPE pebble_flushes counter",
+		"pebble_flushes_total 2.0",
+		"pebble_compactions_total{kind=\"default\"} 1.0",
+		"pebble_flush_duration_seconds_count 2",
+		"pebble_compaction_duration_seconds_count{reason=\"default\"} 1",
+		"# TYPE pebble_wal_fsync_latency_seconds histogram",
+		"pebble_level_files{level=\"0\"} 0.0",
+		"pebble_level_files{level=\"6\"} 1.0",
+		"pebble_level_tables_flushed_total{level=\"0\"} 2.0",
+		"pebble_cache_hits_total{cache=\"block\"}",
+		"pebble_block_cache_class_hits_total{class=",
+		"pebble_snapshots 0.0",
+		"pebble_wal_files 1.0",
+		"pebble_operation_latency_seconds_count{op=\"get\"} 1",
+		"pebble_operation_latency_seconds_count{op=\"commit\"} 200",
+	} {
+		require.Contains(t, out, want)
+	}
+	require.True(t, strings.HasSuffix(out, "# EOF\n"))
+	// The operation latency histograms have sub-millisecond buckets.
+	require.Contains(t, out, "pebble_operation_latency_seconds_bucket{op=\"get\",le=\"2.5e-07\"}")
+
+	// The WAL fsync latency histogram is cumulative across WAL rotations.
+	count := func(out string) int {
+		for _, line := range strings.Split(out, "\n") {
+			if strings.HasPrefix(line, "pebble_wal_fsync_latency_seconds_count ") {
+				n, err := strconv.Atoi(strings.TrimPrefix(line, "pebble_wal_fsync_latency_seconds_count "))
+				require.NoError(t, err)
+				return n
+			}
+		}
+		t.Fatal("missing WAL fsync latency histogram")
+		return 0
+	}
+	require.Less(t, 0, count(out))
+	require.NoError(t, d.Set([]byte("a"), nil, pebble.Sync))
+	require.NoError(t, d.Flush())
+	require.Less(t, count(out), count(scrape("text/plain")))
+
+	// Without a DB, only the latency histograms are exported.
+	e.Attach(nil)
+	out = scrape("text/plain")
+	require.Contains(t, out, "pebble_flush_duration_seconds_count 3")
+	require.NotContains(t, out, "pebble_level_files")
+}
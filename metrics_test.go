@@ -5,14 +5,19 @@
 package pebble
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/pebble/bloom"
+	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/internal/humanize"
 	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/redact"
 	"github.com/stretchr/testify/require"
@@ -325,3 +330,212 @@ func TestMetricsWAmpDisableWAL(t *testing.T) {
 	require.Greater(t, tot.WriteAmp(), 1.0)
 	require.NoError(t, d.Close())
 }
+
+func TestMetricsFilterLevels(t *testing.T) {
+	opts := &Options{
+		Comparer: testkeys.Comparer,
+		FS:       vfs.NewMem(),
+		Levels: []LevelOptions{{
+			FilterPolicy:            bloom.BlockedFilterPolicy(10),
+			FilterFalsePositiveRate: 0.001,
+		}},
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for i := 0; i < 100; i += 2 {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%03d", i)), nil, nil))
+	}
+	require.NoError(t, d.Flush())
+	iter := d.NewIter(nil)
+	// Seek to each key within the table's bounds, half of which are absent.
+	for i := 0; i < 99; i++ {
+		require.Equal(t, i%2 == 0, iter.SeekPrefixGE([]byte(fmt.Sprintf("key%03d", i))))
+	}
+	require.NoError(t, iter.Close())
+
+	m := d.Metrics()
+	require.Equal(t, int64(99), m.Filter.Hits+m.Filter.Misses)
+	require.Equal(t, m.Filter, m.LevelFilter[0])
+	require.Equal(t, int64(49), m.Filter.Hits+m.Filter.FalsePositives)
+	for l := 1; l < numLevels; l++ {
+		require.Equal(t, sstable.FilterMetrics{}, m.LevelFilter[l])
+	}
+}
+
+func TestMetricsBlockCacheClasses(t *testing.T) {
+	for _, pin := range []bool{false, true} {
+		t.Run(fmt.Sprintf("pin=%t", pin), func(t *testing.T) {
+			c := cache.New(1 << 20)
+			defer c.Unref()
+			opts := &Options{
+				Cache:                       c,
+				FS:                          vfs.NewMem(),
+				Levels:                      []LevelOptions{{FilterPolicy: bloom.FilterPolicy(10)}},
+				PinL0L1IndexAndFilterBlocks: pin,
+			}
+			opts.private.disableTableStats = true
+			d, err := Open("", opts)
+			require.NoError(t, err)
+			defer func() { require.NoError(t, d.Close()) }()
+
+			for i := 0; i < 100; i++ {
+				require.NoError(t, d.Set([]byte(fmt.Sprintf("key%03d", i)), make([]byte, 100), nil))
+			}
+			require.NoError(t, d.Flush())
+
+			scan := func(o *IterOptions) cache.Metrics {
+				before := d.Metrics().BlockCache
+				iter := d.NewIter(o)
+				n := 0
+				for valid := iter.First(); valid; valid = iter.Next() {
+					n++
+				}
+				require.Equal(t, 100, n)
+				require.NoError(t, iter.Close())
+				after := d.Metrics().BlockCache
+				for p := range after.Classes {
+					after.Classes[p].Hits -= before.Classes[p].Hits
+					after.Classes[p].Misses -= before.Classes[p].Misses
+				}
+				return after
+			}
+
+			// Scans that don't fill the cache miss on every data block, however
+			// many times they're repeated. The first scan also pins the table's
+			// index and filter blocks if configured, which are read without
+			// looking them up in the cache.
+			m := scan(&IterOptions{DisableCacheFill: true})
+			first := m.Classes[cache.NoFillPriority].Misses
+			m = scan(&IterOptions{DisableCacheFill: true})
+			dataBlocks := m.Classes[cache.NoFillPriority].Misses
+			require.Greater(t, dataBlocks, int64(1))
+			require.Equal(t, dataBlocks, first)
+			m = scan(&IterOptions{DisableCacheFill: true})
+			require.Equal(t, cache.ClassMetrics{Misses: dataBlocks}, m.Classes[cache.NoFillPriority])
+			require.Equal(t, cache.ClassMetrics{}, m.Classes[cache.NormalPriority])
+
+			// Other scans fill the cache.
+			m = scan(nil)
+			require.Equal(t, cache.ClassMetrics{Misses: dataBlocks}, m.Classes[cache.NormalPriority])
+			m = scan(nil)
+			require.Equal(t, cache.ClassMetrics{Hits: dataBlocks}, m.Classes[cache.NormalPriority])
+
+			// The index block is read through the cache with high priority,
+			// unless it's pinned.
+			if pin {
+				require.Equal(t, cache.ClassMetrics{}, m.Classes[cache.HighPriority])
+			} else {
+				require.Equal(t, cache.ClassMetrics{Hits: 1}, m.Classes[cache.HighPriority])
+			}
+		})
+	}
+}
+
+func TestMetricsSecondaryCache(t *testing.T) {
+	fs := vfs.NewMem()
+	openSecondary := func() *SecondaryCache {
+		sc, err := OpenSecondaryCache(SecondaryCacheOptions{
+			FS:        fs,
+			Dir:       "secondary",
+			Capacity:  4 << 20,
+			Admission: cache.AdmitAll,
+		})
+		require.NoError(t, err)
+		return sc
+	}
+	tryOpenDB := func(dirname string, sc *SecondaryCache, key *sstable.EncryptionKey) (*DB, error) {
+		// Apart from the memtable's reservation, the block cache is too small
+		// to hold the data blocks, which are evicted to the secondary cache.
+		const memTableSize = 256 << 10
+		c := cache.New(memTableSize + 32<<10)
+		defer c.Unref()
+		opts := &Options{
+			Cache:          c,
+			FS:             fs,
+			MemTableSize:   memTableSize,
+			SecondaryCache: sc,
+		}
+		if key != nil {
+			opts.FormatMajorVersion = ExperimentalFormatTableEncryption
+			opts.TableEncryptionKey = key
+			opts.TableEncryptionKeys = func(string) ([]byte, error) { return key.Secret, nil }
+		}
+		opts.private.disableTableStats = true
+		return Open(dirname, opts)
+	}
+	openDB := func(dirname string, sc *SecondaryCache, key *sstable.EncryptionKey) *DB {
+		d, err := tryOpenDB(dirname, sc, key)
+		require.NoError(t, err)
+		return d
+	}
+	load := func(d *DB) {
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("key%04d", i)), make([]byte, 100), nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+	scan := func(d *DB) {
+		iter := d.NewIter(nil)
+		n := 0
+		for valid := iter.First(); valid; valid = iter.Next() {
+			require.Equal(t, fmt.Sprintf("key%04d", n), string(iter.Key()))
+			n++
+		}
+		require.NoError(t, iter.Close())
+		require.Equal(t, 1000, n)
+	}
+
+	sc := openSecondary()
+	d := openDB("db", sc, nil)
+	load(d)
+	scan(d)
+	require.NoError(t, sc.Flush())
+	require.Greater(t, d.Metrics().SecondaryCache.Count, int64(0))
+
+	// The secondary cache can't be used by two DBs at once.
+	_, err := tryOpenDB("db2", sc, nil)
+	require.Error(t, err)
+	require.NoError(t, d.Close())
+
+	// The blocks remain in the secondary cache after the DB is closed, and
+	// after the secondary cache is reopened.
+	count := sc.Metrics().Count
+	require.NoError(t, sc.Close())
+	sc = openSecondary()
+	require.Equal(t, count, sc.Metrics().Count)
+
+	// Reads after reopening the DB are served from the secondary cache.
+	d = openDB("db", sc, nil)
+	scan(d)
+	m := d.Metrics().SecondaryCache
+	require.Greater(t, m.Hits, int64(0))
+	require.Equal(t, int64(0), m.CorruptReads)
+	require.NoError(t, d.Close())
+
+	// Opening another DB with the secondary cache removes the first DB's
+	// blocks. The blocks of encrypted tables are written to it as stored in
+	// the tables, so its files don't contain their keys in plaintext.
+	key := &sstable.EncryptionKey{ID: "k1", Secret: bytes.Repeat([]byte{1}, 32)}
+	d = openDB("db2", sc, key)
+	require.Equal(t, int64(0), sc.Metrics().Count)
+	load(d)
+	scan(d)
+	require.NoError(t, sc.Flush())
+	require.Greater(t, d.Metrics().SecondaryCache.Count, int64(0))
+	names, err := fs.List("secondary")
+	require.NoError(t, err)
+	for _, name := range names {
+		f, err := fs.Open(fs.PathJoin("secondary", name))
+		require.NoError(t, err)
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		require.False(t, bytes.Contains(data, []byte("key0")), name)
+	}
+	scan(d)
+	require.Equal(t, int64(0), d.Metrics().SecondaryCache.CorruptReads)
+	require.NoError(t, d.Close())
+	require.NoError(t, sc.Close())
+}
@@ -0,0 +1,331 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// NewMVCCBlockPropertyCollector returns a constructor for a block-property
+// collector that records the interval of timestamps encoded by the suffixes
+// of point keys within each block. The timestamps are decoded using split and
+// decode, which should be consistent with the Comparer and the
+// MVCCReadOptions.DecodeTimestamp used when reading. Keys with suffixes that
+// do not encode a timestamp are recorded as timestamp zero, ensuring blocks
+// containing them are never skipped.
+//
+// Configure the returned constructor through Options.BlockPropertyCollectors
+// and set MVCCReadOptions.BlockPropertyName to the same name to allow MVCC
+// reads to skip tables and blocks containing only keys newer than the read
+// timestamp.
+func NewMVCCBlockPropertyCollector(
+	name string, split Split, decode func(suffix []byte) (ts uint64, ok bool),
+) func() BlockPropertyCollector {
+	return func() BlockPropertyCollector {
+		return sstable.NewBlockIntervalCollector(name, &mvccTimestampCollector{
+			split:  split,
+			decode: decode,
+		}, nil /* rangeCollector */)
+	}
+}
+
+// mvccTimestampCollector implements sstable.DataBlockIntervalCollector,
+// maintaining the interval of timestamps within a data block.
+type mvccTimestampCollector struct {
+	split        Split
+	decode       func(suffix []byte) (uint64, bool)
+	initialized  bool
+	lower, upper uint64
+}
+
+var _ sstable.DataBlockIntervalCollector = (*mvccTimestampCollector)(nil)
+
+// Add implements the sstable.DataBlockIntervalCollector interface.
+func (c *mvccTimestampCollector) Add(key InternalKey, value []byte) error {
+	ts, ok := c.decode(key.UserKey[c.split(key.UserKey):])
+	if !ok {
+		ts = 0
+	}
+	// The interval's upper bound is exclusive. A block containing only the
+	// maximal timestamp is recorded as an empty interval, which is fine since
+	// such keys are invisible at any read timestamp that constructs a filter.
+	upper := uint64(math.MaxUint64)
+	if ts < math.MaxUint64 {
+		upper = ts + 1
+	}
+	if !c.initialized || ts < c.lower {
+		c.lower = ts
+	}
+	if !c.initialized || upper > c.upper {
+		c.upper = upper
+	}
+	c.initialized = true
+	return nil
+}
+
+// FinishDataBlock implements the sstable.DataBlockIntervalCollector interface.
+func (c *mvccTimestampCollector) FinishDataBlock() (lower, upper uint64, err error) {
+	lower, upper = c.lower, c.upper
+	c.initialized, c.lower, c.upper = false, 0, 0
+	return lower, upper, nil
+}
+
+// mvccIterState holds an Iterator's state for MVCC reads.
+type mvccIterState struct {
+	enabled       bool
+	readTimestamp uint64
+	decode        func(suffix []byte) (uint64, bool)
+	// filter, if non-nil, is a block-property filter over the timestamp
+	// interval property named by MVCCReadOptions.BlockPropertyName. It
+	// excludes tables and blocks that only contain invisible point keys.
+	filter *sstable.BlockIntervalFilter
+	// prefix holds the prefix of the most recently surfaced point key. When
+	// prefixSet is true, iterating forward skips any further point keys with
+	// this prefix.
+	prefix    []byte
+	prefixSet bool
+	// rangeKeyUpdated accumulates whether any of the steps taken by the
+	// current positioning operation stepped onto a new range key. Because an
+	// MVCC positioning operation may step the iterator several times,
+	// RangeKeyChanged may conservatively report true even if the final
+	// position's range key is the same as the previous position's.
+	rangeKeyUpdated bool
+	// prevPosHadRangeKey records whether the position preceding the current
+	// positioning operation had a range key.
+	prevPosHadRangeKey bool
+}
+
+func (s *mvccIterState) init(o *MVCCReadOptions) {
+	*s = mvccIterState{prefix: s.prefix[:0]}
+	if o == nil {
+		return
+	}
+	if o.DecodeTimestamp == nil {
+		panic("pebble: MVCCReadOptions.DecodeTimestamp must be provided")
+	}
+	s.enabled = true
+	s.readTimestamp = o.ReadTimestamp
+	s.decode = o.DecodeTimestamp
+	if o.BlockPropertyName != "" && o.ReadTimestamp < math.MaxUint64 {
+		s.filter = sstable.NewBlockIntervalFilter(o.BlockPropertyName, 0, o.ReadTimestamp+1)
+	}
+}
+
+// pointKeyFilters returns the block-property filters that should be applied
+// to point keys, appending the MVCC filter (if any) to the provided
+// user-configured filters. The provided slice is not modified.
+func (s *mvccIterState) pointKeyFilters(filters []BlockPropertyFilter) []BlockPropertyFilter {
+	if s.filter == nil {
+		return filters
+	}
+	return append(filters[:len(filters):len(filters)], s.filter)
+}
+
+// visible returns true if a key with the provided suffix is visible at the
+// read timestamp.
+func (s *mvccIterState) visible(suffix []byte) bool {
+	ts, ok := s.decode(suffix)
+	return !ok || ts <= s.readTimestamp
+}
+
+// mvccVisible returns true if the point key at the iterator's current position
+// is visible at the read timestamp. The prefix length of the current key is
+// provided by the caller.
+func (i *Iterator) mvccVisible(prefixLen int) bool {
+	return i.mvcc.visible(i.key[prefixLen:])
+}
+
+// mvccHasPoint returns true if the iterator's current position holds a point
+// key. Positions holding only a range key start boundary are always surfaced.
+func (i *Iterator) mvccHasPoint() bool {
+	hasPoint, _ := i.HasPointAndRange()
+	return hasPoint
+}
+
+// mvccStart is called after the first step of an MVCC positioning operation.
+func (i *Iterator) mvccStart() {
+	i.mvcc.rangeKeyUpdated = false
+	i.mvcc.prevPosHadRangeKey = i.rangeKey != nil && i.rangeKey.prevPosHadRangeKey
+	i.mvccNoteRangeKey()
+}
+
+// mvccNoteRangeKey is called after each step of an MVCC positioning operation.
+func (i *Iterator) mvccNoteRangeKey() {
+	if i.rangeKey != nil && i.rangeKey.updated {
+		i.mvcc.rangeKeyUpdated = true
+	}
+}
+
+// mvccFinish is called at the end of an MVCC positioning operation, setting
+// the range key state observed through RangeKeyChanged to reflect the
+// operation as a whole rather than its last step.
+func (i *Iterator) mvccFinish() IterValidityState {
+	if i.rangeKey != nil {
+		if i.rangeKey.hasRangeKey {
+			i.rangeKey.updated = i.mvcc.rangeKeyUpdated
+		} else {
+			i.rangeKey.updated = i.mvcc.prevPosHadRangeKey
+		}
+	}
+	return i.iterValidityState
+}
+
+func (i *Iterator) mvccSeekGE(key, limit []byte) IterValidityState {
+	i.mvcc.prefixSet = false
+	i.seekGEWithLimit(key, limit)
+	return i.mvccFindNextEntry()
+}
+
+func (i *Iterator) mvccSeekPrefixGE(key []byte) bool {
+	i.mvcc.prefixSet = false
+	i.seekPrefixGE(key)
+	return i.mvccFindNextEntry() == IterValid
+}
+
+func (i *Iterator) mvccFirst() bool {
+	i.mvcc.prefixSet = false
+	i.first()
+	return i.mvccFindNextEntry() == IterValid
+}
+
+func (i *Iterator) mvccNext(limit []byte) IterValidityState {
+	if i.mvccHasPoint() {
+		// The current key is the newest visible version of its prefix. Skip the
+		// remaining, older versions.
+		i.mvcc.prefix = append(i.mvcc.prefix[:0], i.key[:i.split(i.key)]...)
+		i.mvcc.prefixSet = true
+		i.mvccNextPrefix()
+	} else {
+		i.nextWithLimit(limit)
+	}
+	return i.mvccFindNextEntry()
+}
+
+// mvccNextPrefix advances the iterator beyond the current prefix.
+func (i *Iterator) mvccNextPrefix() {
+	switch {
+	case i.hasPrefix:
+		// In prefix iteration mode all remaining keys share the current
+		// prefix.
+		i.iterValidityState = IterExhausted
+	case i.nextPrefixNotPermittedByUpperBound:
+		// Step through the remaining versions one at a time. The caller
+		// continues to skip keys with the current prefix.
+		i.nextWithLimit(nil)
+	default:
+		i.nextPrefix()
+	}
+}
+
+// mvccFindNextEntry is called after the iterator has been positioned by a
+// forward positioning operation. It advances the iterator, if necessary, to
+// the next position that should be surfaced: a range key start boundary, or a
+// visible point key whose prefix differs from the prefix of the previously
+// surfaced point key.
+func (i *Iterator) mvccFindNextEntry() IterValidityState {
+	i.mvccStart()
+	for i.iterValidityState == IterValid && i.mvccHasPoint() {
+		n := i.split(i.key)
+		if i.mvcc.prefixSet && bytes.Equal(i.key[:n], i.mvcc.prefix) {
+			i.mvccNextPrefix()
+		} else if !i.mvccVisible(n) {
+			i.nextWithLimit(nil)
+		} else {
+			i.mvcc.prefix = append(i.mvcc.prefix[:0], i.key[:n]...)
+			i.mvcc.prefixSet = true
+			break
+		}
+		i.mvccNoteRangeKey()
+	}
+	return i.mvccFinish()
+}
+
+func (i *Iterator) mvccSeekLT(key, limit []byte) IterValidityState {
+	i.seekLTWithLimit(key, limit)
+	return i.mvccFindPrevEntry()
+}
+
+func (i *Iterator) mvccLast() bool {
+	i.last()
+	return i.mvccFindPrevEntry() == IterValid
+}
+
+func (i *Iterator) mvccPrev(limit []byte) IterValidityState {
+	i.prevWithLimit(limit)
+	return i.mvccFindPrevEntry()
+}
+
+// mvccFindPrevEntry is called after the iterator has been positioned by a
+// reverse positioning operation. It moves the iterator, if necessary, to the
+// previous position that should be surfaced: a range key start boundary, or
+// the newest visible version of a prefix.
+//
+// Newer versions sort before older versions, so reverse iteration encounters
+// the versions of a prefix from oldest to newest. When positioned at a visible
+// version, mvccFindPrevEntry steps backward over the remainder of the prefix
+// looking for a newer visible version. If it finds none, it steps forward
+// again to the visible version. If it finds one, the newer version becomes
+// the candidate, unless the iterator stepped over a range key start boundary
+// on the way, in which case that boundary is the previous position to surface.
+func (i *Iterator) mvccFindPrevEntry() IterValidityState {
+	i.mvccStart()
+	i.mvcc.prefixSet = false
+	for i.iterValidityState == IterValid && i.mvccHasPoint() {
+		n := i.split(i.key)
+		if !i.mvccVisible(n) {
+			i.prevWithLimit(nil)
+			i.mvccNoteRangeKey()
+			continue
+		}
+		i.mvcc.prefix = append(i.mvcc.prefix[:0], i.key[:n]...)
+		steps, rangeKeySteps, found := 0, 0, false
+		for !found {
+			i.prevWithLimit(nil)
+			i.mvccNoteRangeKey()
+			steps++
+			if i.iterValidityState != IterValid {
+				break
+			}
+			n = i.split(i.key)
+			if !bytes.Equal(i.key[:n], i.mvcc.prefix) {
+				break
+			}
+			if !i.mvccHasPoint() {
+				if rangeKeySteps == 0 {
+					rangeKeySteps = steps
+				}
+				continue
+			}
+			found = i.mvccVisible(n)
+		}
+		if found && rangeKeySteps == 0 {
+			// The iterator is positioned at a newer visible version of the
+			// same prefix, with nothing to surface in between.
+			continue
+		}
+		if found {
+			// Return to the nearest range key start boundary.
+			steps -= rangeKeySteps
+		} else {
+			// Return to the newest visible version.
+			i.mvcc.prefixSet = true
+		}
+		for ; steps > 0; steps-- {
+			i.nextWithLimit(nil)
+			i.mvccNoteRangeKey()
+		}
+		break
+	}
+	return i.mvccFinish()
+}
+
+// mvccRangeKeyVisible is used as the range key iterator's suffix filter,
+// omitting range keys that are invisible at the read timestamp.
+func (i *Iterator) mvccRangeKeyVisible(suffix []byte) bool {
+	return i.mvcc.visible(suffix)
+}
@@ -0,0 +1,320 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/keyspan"
+	"github.com/cockroachdb/pebble/internal/manifest"
+)
+
+// SetGCThreshold sets the MVCC garbage collection threshold for the keys
+// within [start, end) to the provided suffix, replacing any thresholds
+// previously set for the overlapping portion of the keyspace. An empty
+// threshold clears the GC threshold for the span.
+//
+// Keys are interpreted as MVCC versions: the prefix returned by
+// Comparer.Split identifies the logical key, and the suffix identifies its
+// version. Suffixes are compared directly using Comparer.Compare, as is done
+// for range key suffixes, with newer versions sorting before older versions.
+// A key's GC threshold is determined by its prefix, and keys without a suffix
+// are never garbage collected.
+//
+// Once a GC threshold is set, compactions drop all but the newest version at
+// or below the threshold of each prefix. A version is also dropped if it is
+// masked by a RangeKeySet whose suffix is at or below the threshold and newer
+// than the version (see RangeKeyMasking). A version is only dropped if the
+// newer version or range key shadowing it is visible to every open snapshot,
+// and if no older entries for the same key exist beneath the compaction's
+// output level. The caller must not subsequently read at versions below the
+// threshold, or write or delete versions at or below the threshold.
+//
+// Entries written before the threshold was set may still delete the newer
+// version or range key shadowing a version. A compaction therefore only
+// applies a threshold once no such entries remain in the memtables or in
+// tables above its output level that overlap it, so that they would be
+// compacted along with the shadowing key.
+//
+// GC thresholds are not persisted. They must be set again after the DB is
+// reopened. The number of bytes dropped is reported in
+// Metrics.Compact.GCDroppedBytes.
+func (d *DB) SetGCThreshold(start, end, threshold []byte) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if d.split == nil {
+		return errors.New("pebble: GC thresholds require a Comparer with Split")
+	}
+	if d.cmp(start, end) >= 0 {
+		return errors.Errorf("SetGCThreshold start %s is not less than end %s",
+			d.opts.Comparer.FormatKey(start), d.opts.Comparer.FormatKey(end))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mu.compact.gcThresholds = d.mu.compact.gcThresholds.set(d.cmp,
+		append([]byte(nil), start...), append([]byte(nil), end...),
+		append([]byte(nil), threshold...), d.mu.versions.logSeqNum.Load())
+	return nil
+}
+
+// gcThresholdsForCompaction returns the GC thresholds that compaction c may
+// apply. A threshold is only applied if every entry written before it was set
+// that could delete a key shadowing older versions is part of the compaction,
+// or beneath it. Newer entries may not write or delete versions at or below
+// the threshold. d.mu must be held.
+func (d *DB) gcThresholdsForCompaction(c *compaction) gcThresholds {
+	thresholds := d.mu.compact.gcThresholds
+	if len(thresholds) == 0 {
+		return nil
+	}
+	// Find the smallest sequence number of the entries that may be newer than
+	// the compaction's inputs but are not part of it.
+	minSeqNum := uint64(InternalKeySeqNumMax)
+	// The flushables being flushed are the oldest in the queue.
+	for _, f := range d.mu.mem.queue[len(c.flushing):] {
+		// Skip empty memtables without in-flight writes, such as a newly
+		// created mutable memtable. Writers hold a reference to the memtable
+		// from before their batch is assigned a sequence number until it's
+		// applied, in addition to the reference held by the mutable memtable.
+		if m, ok := f.flushable.(*memTable); ok {
+			idleRefs := int32(0)
+			if m == d.mu.mem.mutable {
+				idleRefs = 1
+			}
+			if m.writerRefs.Load() == idleRefs && m.empty() {
+				continue
+			}
+		}
+		minSeqNum = f.logSeqNum
+		break
+	}
+	if c.kind != compactionKindFlush {
+		inputs := make(map[*manifest.FileMetadata]struct{})
+		for i := range c.inputs {
+			iter := c.inputs[i].files.Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				inputs[f] = struct{}{}
+			}
+		}
+		v := d.mu.versions.currentVersion()
+		for level := 0; level <= c.outputLevel.level; level++ {
+			overlaps := v.Overlaps(level, d.cmp, c.smallest.UserKey, c.largest.UserKey,
+				c.largest.IsExclusiveSentinel())
+			iter := overlaps.Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				if _, ok := inputs[f]; !ok && f.SmallestSeqNum < minSeqNum {
+					minSeqNum = f.SmallestSeqNum
+				}
+			}
+		}
+	}
+	var active gcThresholds
+	for _, g := range thresholds {
+		if g.seqNum <= minSeqNum {
+			active = append(active, g)
+		}
+	}
+	return active
+}
+
+// gcThreshold is the GC threshold suffix for the keys within [start, end).
+type gcThreshold struct {
+	start, end, suffix []byte
+	// seqNum is the sequence number assigned to the first write after the
+	// threshold was set.
+	seqNum uint64
+}
+
+// gcThresholds is a sorted set of non-overlapping GC thresholds. A
+// gcThresholds is immutable once constructed, allowing compactions to use it
+// without holding DB.mu.
+type gcThresholds []gcThreshold
+
+// set returns a new gcThresholds with the threshold for [start, end) set to
+// suffix at the provided sequence number, or cleared if suffix is empty.
+func (t gcThresholds) set(cmp Compare, start, end, suffix []byte, seqNum uint64) gcThresholds {
+	out := make(gcThresholds, 0, len(t)+2)
+	// Retain the portions of existing thresholds before start.
+	for _, g := range t {
+		if cmp(g.start, start) >= 0 {
+			break
+		}
+		if cmp(g.end, start) > 0 {
+			g.end = start
+		}
+		out = append(out, g)
+	}
+	if len(suffix) > 0 {
+		out = append(out, gcThreshold{start: start, end: end, suffix: suffix, seqNum: seqNum})
+	}
+	// Retain the portions of existing thresholds after end.
+	for _, g := range t {
+		if cmp(g.end, end) <= 0 {
+			continue
+		}
+		if cmp(g.start, end) < 0 {
+			g.start = end
+		}
+		out = append(out, g)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// compactionGC decides which point keys a compaction may drop as MVCC garbage
+// below a GC threshold. It must be presented with each point key surfaced by
+// the compaction's input iterator that is not deleted by a range deletion, in
+// order.
+type compactionGC struct {
+	cmp        Compare
+	equal      Equal
+	split      Split
+	thresholds gcThresholds
+	// index is the index of the first threshold in thresholds that ends
+	// after the current prefix.
+	index int
+	// earliestSnapshot is the sequence number of the earliest open snapshot.
+	// Keys with smaller sequence numbers are visible to every snapshot.
+	earliestSnapshot uint64
+	// rangeKeySpan returns the span of range keys covering the current input
+	// key, or nil if there are none.
+	rangeKeySpan func() *keyspan.Span
+	// lastUserKey is the user key of the previous point key.
+	lastUserKey []byte
+	// prefix and threshold hold the current prefix and its GC threshold, if
+	// any.
+	prefix    []byte
+	threshold []byte
+	// shadowed is true if a version of the current prefix at or below the
+	// threshold and visible to all snapshots has been seen. All subsequent,
+	// older versions of the prefix are garbage.
+	shadowed bool
+	// droppedBytes is the total size of the keys and values dropped, including
+	// the older entries for a dropped version's user key that are skipped
+	// along with it (see addDropped).
+	droppedBytes uint64
+}
+
+func newCompactionGC(
+	comparer *Comparer,
+	thresholds gcThresholds,
+	snapshots []uint64,
+	rangeKeySpan func() *keyspan.Span,
+) *compactionGC {
+	g := &compactionGC{
+		cmp:              comparer.Compare,
+		equal:            comparer.Equal,
+		split:            comparer.Split,
+		thresholds:       thresholds,
+		earliestSnapshot: InternalKeySeqNumMax,
+		rangeKeySpan:     rangeKeySpan,
+	}
+	if len(snapshots) > 0 {
+		g.earliestSnapshot = snapshots[0]
+	}
+	return g
+}
+
+// drop is called with each point key surfaced by the compaction's input
+// iterator, returning true if the key may be dropped. snapshotIdx is the
+// index of the key's snapshot stripe, and pinned indicates whether the key is
+// pinned by an open snapshot. elideTombstone reports whether entries for the
+// key may exist beneath the compaction's output level (see
+// compaction.elideTombstone).
+func (g *compactionGC) drop(
+	key *InternalKey,
+	value []byte,
+	snapshotIdx int,
+	pinned bool,
+	elideTombstone func(key []byte) bool,
+) bool {
+	// A key is only eligible to shadow older versions if it's the newest
+	// entry for its user key and visible to all snapshots.
+	newest := g.lastUserKey == nil || !g.equal(g.lastUserKey, key.UserKey)
+	if newest {
+		g.lastUserKey = append(g.lastUserKey[:0], key.UserKey...)
+	}
+	n := g.split(key.UserKey)
+	if g.prefix == nil || !g.equal(g.prefix, key.UserKey[:n]) {
+		g.prefix = append(g.prefix[:0], key.UserKey[:n]...)
+		g.threshold = g.lookup(g.prefix)
+		g.shadowed = false
+	}
+	if g.threshold == nil || n == len(key.UserKey) {
+		return false
+	}
+	suffix := key.UserKey[n:]
+	if g.cmp(suffix, g.threshold) < 0 {
+		// The version is newer than the threshold.
+		return false
+	}
+	switch key.Kind() {
+	case InternalKeyKindSet, InternalKeyKindSetWithDelete:
+	default:
+		// Tombstones and merges are left to the compaction.
+		return false
+	}
+	eligible := snapshotIdx == 0 && !pinned
+	if g.shadowed || g.masked(suffix) {
+		if eligible && elideTombstone(key.UserKey) {
+			g.addDropped(key, value)
+			return true
+		}
+		return false
+	}
+	if newest && eligible {
+		g.shadowed = true
+	}
+	return false
+}
+
+// addDropped accounts for a dropped key and its value in droppedBytes.
+func (g *compactionGC) addDropped(key *InternalKey, value []byte) {
+	g.droppedBytes += uint64(len(key.UserKey)) + base.InternalTrailerLen + uint64(len(value))
+}
+
+// lookup returns the GC threshold for the provided prefix. Prefixes must be
+// provided in increasing order.
+func (g *compactionGC) lookup(prefix []byte) []byte {
+	for g.index < len(g.thresholds) && g.cmp(g.thresholds[g.index].end, prefix) <= 0 {
+		g.index++
+	}
+	if g.index < len(g.thresholds) && g.cmp(g.thresholds[g.index].start, prefix) <= 0 {
+		return g.thresholds[g.index].suffix
+	}
+	return nil
+}
+
+// masked returns true if the current key, which has the provided suffix, is
+// masked by a RangeKeySet with a suffix at or below the current threshold,
+// within a span of range keys that are all visible to every snapshot.
+func (g *compactionGC) masked(suffix []byte) bool {
+	if g.rangeKeySpan == nil {
+		return false
+	}
+	s := g.rangeKeySpan()
+	if s == nil {
+		return false
+	}
+	masked := false
+	for i := range s.Keys {
+		k := &s.Keys[i]
+		if k.SeqNum() >= g.earliestSnapshot {
+			return false
+		}
+		if k.Kind() == InternalKeyKindRangeKeySet && len(k.Suffix) > 0 &&
+			g.cmp(k.Suffix, g.threshold) >= 0 && g.cmp(k.Suffix, suffix) < 0 {
+			masked = true
+		}
+	}
+	return masked
+}
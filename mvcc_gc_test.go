@@ -0,0 +1,53 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGCThresholdsSet(t *testing.T) {
+	format := func(t gcThresholds) string {
+		var parts []string
+		for _, g := range t {
+			parts = append(parts, fmt.Sprintf("[%s,%s)%s", g.start, g.end, g.suffix))
+		}
+		return strings.Join(parts, " ")
+	}
+	type op struct {
+		start, end, suffix string
+	}
+	testCases := []struct {
+		ops      []op
+		expected string
+	}{
+		{[]op{{"b", "d", "@5"}}, "[b,d)@5"},
+		{[]op{{"b", "d", ""}}, ""},
+		{[]op{{"b", "d", "@5"}, {"a", "b", "@3"}}, "[a,b)@3 [b,d)@5"},
+		{[]op{{"b", "d", "@5"}, {"d", "e", "@3"}}, "[b,d)@5 [d,e)@3"},
+		{[]op{{"b", "d", "@5"}, {"c", "e", "@3"}}, "[b,c)@5 [c,e)@3"},
+		{[]op{{"b", "d", "@5"}, {"a", "c", "@3"}}, "[a,c)@3 [c,d)@5"},
+		{[]op{{"a", "e", "@5"}, {"b", "c", "@3"}}, "[a,b)@5 [b,c)@3 [c,e)@5"},
+		{[]op{{"a", "e", "@5"}, {"b", "c", ""}}, "[a,b)@5 [c,e)@5"},
+		{[]op{{"b", "c", "@5"}, {"d", "e", "@5"}, {"a", "z", "@7"}}, "[a,z)@7"},
+		{[]op{{"b", "c", "@5"}, {"d", "e", "@5"}, {"a", "z", ""}}, ""},
+	}
+	for _, tc := range testCases {
+		var thresholds gcThresholds
+		for _, o := range tc.ops {
+			before := format(thresholds)
+			next := thresholds.set(DefaultComparer.Compare,
+				[]byte(o.start), []byte(o.end), []byte(o.suffix), 1 /* seqNum */)
+			// The receiver must not be modified.
+			require.Equal(t, before, format(thresholds))
+			thresholds = next
+		}
+		require.Equal(t, tc.expected, format(thresholds))
+	}
+}
@@ -6,7 +6,9 @@ package pebble
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"math"
@@ -120,6 +122,21 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 			formatVersionMarker.Close()
 		}
 	}()
+	if opts.WALTransform != nil && !opts.ReadOnly &&
+		formatVersion < ExperimentalFormatWALTransforms &&
+		opts.FormatMajorVersion < ExperimentalFormatWALTransforms {
+		// Without the WAL transform, the WALs would be written in
+		// plaintext.
+		return nil, errors.Newf("pebble: WALTransform requires format major version %s or later",
+			ExperimentalFormatWALTransforms)
+	}
+	if opts.TableEncryptionKey != nil && !opts.ReadOnly &&
+		formatVersion < ExperimentalFormatTableEncryption &&
+		opts.FormatMajorVersion < ExperimentalFormatTableEncryption {
+		// Without the key, sstables would be written in plaintext.
+		return nil, errors.Newf("pebble: TableEncryptionKey requires format major version %s or later",
+			ExperimentalFormatTableEncryption)
+	}
 
 	// Find the currently active manifest, if there is one.
 	manifestMarker, manifestFileNum, manifestExists, err := findCurrentManifest(formatVersion, opts.FS, dirname)
@@ -167,6 +184,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 		closed:              new(atomic.Value),
 		closedCh:            make(chan struct{}),
 	}
+	d.diskBandwidthGranter, _ = opts.Experimental.CPUWorkPermissionGranter.(DiskBandwidthGranter)
 	d.mu.versions = &versionSet{}
 	d.diskAvailBytes.Store(math.MaxUint64)
 	d.mu.versions.diskAvailBytes = d.getDiskAvailableBytesCached
@@ -181,6 +199,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 			// the tableCache, and if there are no other references to
 			// the tableCache, then the tableCache will also release its
 			// reference to the cache.
+			_ = opts.Cache.SetSecondary(d.cacheID, nil)
 			opts.Cache.Unref()
 
 			if d.tableCache != nil {
@@ -228,6 +247,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	d.mu.versions.logSeqNum.Store(base.SeqNumStart)
 	d.mu.formatVers.vers = formatVersion
 	d.mu.formatVers.marker = formatVersionMarker
+	d.kvChecksums.Store(opts.KVChecksums && formatVersion >= ExperimentalFormatKVChecksums)
 
 	d.timeNow = time.Now
 	d.openedAt = d.timeNow()
@@ -311,6 +331,30 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 		}
 	}
 
+	if opts.SecondaryCache != nil {
+		// Remove the blocks of another DB, if the secondary cache was last used
+		// by one, and then the blocks of tables that were deleted while the
+		// secondary cache wasn't attached. If the DB was just created, all of
+		// the blocks are removed, as they may belong to a DB previously in its
+		// place.
+		identity, err := loadOrCreateIdentity(opts, dirname, d.dataDir)
+		if err != nil {
+			return nil, err
+		}
+		if err := opts.SecondaryCache.Bind(identity); err != nil {
+			return nil, err
+		}
+		liveFileNums := make(map[base.DiskFileNum]struct{})
+		d.mu.versions.addLiveFileNums(liveFileNums)
+		opts.SecondaryCache.RetainFiles(func(fileNum base.DiskFileNum) bool {
+			_, ok := liveFileNums[fileNum]
+			return ok
+		})
+		if err := opts.Cache.SetSecondary(d.cacheID, opts.SecondaryCache); err != nil {
+			return nil, err
+		}
+	}
+
 	tableCacheSize := TableCacheSize(opts.MaxOpenFiles)
 	d.tableCache = newTableCacheContainer(opts.TableCache, d.cacheID, d.objProvider, d.opts, tableCacheSize)
 	d.newIters = d.tableCache.newIters
@@ -445,12 +489,13 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 			Buckets: FsyncLatencyBuckets,
 		})
 
-		logWriterConfig := record.LogWriterConfig{
-			WALMinSyncInterval: d.opts.WALMinSyncInterval,
-			WALFsyncLatency:    d.mu.log.metrics.fsyncLatency,
-			QueueSemChan:       d.commit.logSyncQSem,
+		// The format major version is ratcheted to opts.FormatMajorVersion
+		// below, before anything is written to the WAL.
+		vers := d.mu.formatVers.vers
+		if opts.FormatMajorVersion > vers {
+			vers = opts.FormatMajorVersion
 		}
-		d.mu.log.LogWriter = record.NewLogWriter(logFile, newLogNum, logWriterConfig)
+		d.mu.log.LogWriter = record.NewLogWriter(logFile, newLogNum, d.logWriterConfig(vers))
 		d.mu.versions.metrics.WAL.Files++
 	}
 	d.updateReadStateLocked(d.opts.DebugCheck)
@@ -520,6 +565,10 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	d.maybeScheduleFlush()
 	d.maybeScheduleCompaction()
 
+	if d.opts.CacheWarming.Enabled {
+		d.startCacheWarming()
+	}
+
 	// Note: this is a no-op if invariants are disabled or race is enabled.
 	//
 	// Setting a finalizer on *DB causes *DB to never be reclaimed and the
@@ -548,6 +597,63 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	return d, nil
 }
 
+// identityFilename is the name of the file in a DB's directory holding the
+// DB's identity, which tells a secondary cache which DB it was last used by.
+// Checkpoints don't copy the file, so a checkpoint gets an identity of its own.
+const identityFilename = "IDENTITY"
+
+// loadOrCreateIdentity returns the DB's identity, generating a random one if
+// the DB doesn't have one yet. A read-only DB's generated identity isn't
+// persisted.
+func loadOrCreateIdentity(opts *Options, dirname string, dataDir vfs.File) (string, error) {
+	path := opts.FS.PathJoin(dirname, identityFilename)
+	f, err := opts.FS.Open(path)
+	if err == nil {
+		b, err := io.ReadAll(f)
+		err = firstError(err, f.Close())
+		if err != nil {
+			return "", err
+		}
+		if len(b) > 0 {
+			return string(b), nil
+		}
+	} else if !oserror.IsNotExist(err) {
+		return "", err
+	}
+
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	identity := hex.EncodeToString(id[:])
+	if opts.ReadOnly {
+		return identity, nil
+	}
+	tmpPath := path + ".dbtmp"
+	f, err = opts.FS.Create(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write([]byte(identity)); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := opts.FS.Rename(tmpPath, path); err != nil {
+		return "", err
+	}
+	if err := dataDir.Sync(); err != nil {
+		return "", err
+	}
+	return identity, nil
+}
+
 // prepareAndOpenDirs opens the directories for the store (and creates them if
 // necessary).
 //
@@ -679,6 +785,7 @@ func (d *DB) replayWAL(
 		offset          int64 // byte offset in rr
 		lastFlushOffset int64
 	)
+	rr.SetTransform(d.opts.WALTransform)
 
 	if d.opts.ReadOnly {
 		// In read-only mode, we replay directly into the mutable memtable which will
@@ -26,6 +26,8 @@ import (
 	"github.com/cockroachdb/pebble/internal/errorfs"
 	"github.com/cockroachdb/pebble/internal/manifest"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/vfs/atomicfs"
 	"github.com/cockroachdb/redact"
@@ -197,7 +199,7 @@ func TestNewDBFilenames(t *testing.T) {
 			"LOCK",
 			"MANIFEST-000001",
 			"OPTIONS-000003",
-			"marker.format-version.000014.015",
+			"marker.format-version.000019.020",
 			"marker.manifest.000001.MANIFEST-000001",
 		},
 	}
@@ -1055,6 +1057,154 @@ func TestOpenWALReplayMemtableGrowth(t *testing.T) {
 	db.Close()
 }
 
+// xorWALTransform is a WALTransform for testing, which XORs WAL records with
+// a key.
+type xorWALTransform byte
+
+func (x xorWALTransform) Encode(dst, src []byte) ([]byte, error) {
+	for _, b := range src {
+		dst = append(dst, b^byte(x))
+	}
+	return dst, nil
+}
+
+func (x xorWALTransform) Decode(dst, src []byte) ([]byte, error) {
+	return x.Encode(dst, src)
+}
+
+func TestOpenWALTransform(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{
+		FS:                 mem,
+		FormatMajorVersion: ExperimentalFormatWALTransforms,
+		WALCompression:     ZstdWALCompression,
+		WALTransform:       xorWALTransform(0x5a),
+	}
+	value := bytes.Repeat([]byte("plaintext-value"), 100)
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("plaintext-key"), value, nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("plaintext-b"), nil))
+	require.NoError(t, d.Close())
+
+	// The WALs don't contain the keys or values in plaintext.
+	ls, err := mem.List("")
+	require.NoError(t, err)
+	var logs int
+	for _, name := range ls {
+		if !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		logs++
+		f, err := mem.Open(name)
+		require.NoError(t, err)
+		b, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		require.False(t, bytes.Contains(b, []byte("plaintext")), "%s", name)
+	}
+	require.NotZero(t, logs)
+
+	// The WALs can't be replayed without the transform.
+	_, err = Open("", &Options{FS: mem})
+	require.ErrorIs(t, err, record.ErrNoTransform)
+
+	// They're replayed with it.
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	v, closer, err := d.Get([]byte("plaintext-key"))
+	require.NoError(t, err)
+	require.Equal(t, value, v)
+	require.NoError(t, closer.Close())
+	require.NoError(t, d.Close())
+
+	// The transform requires a format major version that supports it.
+	_, err = Open("", &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: ExperimentalFormatZstdDictionaries,
+		WALTransform:       xorWALTransform(0x5a),
+	})
+	require.Error(t, err)
+}
+
+func TestOpenTableEncryption(t *testing.T) {
+	mem := vfs.NewMem()
+	key1 := &sstable.EncryptionKey{ID: "k1", Secret: bytes.Repeat([]byte{1}, 32)}
+	key2 := &sstable.EncryptionKey{ID: "k2", Secret: bytes.Repeat([]byte{2}, 32)}
+	keys := func(id string) ([]byte, error) {
+		for _, k := range []*sstable.EncryptionKey{key1, key2} {
+			if k.ID == id {
+				return k.Secret, nil
+			}
+		}
+		return nil, errors.Newf("unknown key %q", id)
+	}
+	opts := &Options{
+		FS:                  mem,
+		FormatMajorVersion:  ExperimentalFormatTableEncryption,
+		TableEncryptionKey:  key1,
+		TableEncryptionKeys: keys,
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("plaintext-key1"), []byte("plaintext-value"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+
+	// Rotate to a new key. Tables encrypted with the previous key remain
+	// readable.
+	opts.TableEncryptionKey = key2
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("plaintext-key2"), []byte("plaintext-value"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+
+	// The sstables don't contain the keys or values in plaintext.
+	ls, err := mem.List("")
+	require.NoError(t, err)
+	var ssts int
+	for _, name := range ls {
+		if !strings.HasSuffix(name, ".sst") {
+			continue
+		}
+		ssts++
+		f, err := mem.Open(name)
+		require.NoError(t, err)
+		b, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		require.False(t, bytes.Contains(b, []byte("plaintext")), "%s", name)
+	}
+	require.Equal(t, 2, ssts)
+
+	// The sstables can't be read without the keys.
+	d, err = Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	_, _, err = d.Get([]byte("plaintext-key1"))
+	require.Error(t, err)
+	require.NoError(t, d.Close())
+
+	// They're read with them.
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	for _, k := range []string{"plaintext-key1", "plaintext-key2"} {
+		v, closer, err := d.Get([]byte(k))
+		require.NoError(t, err)
+		require.Equal(t, "plaintext-value", string(v))
+		require.NoError(t, closer.Close())
+	}
+	require.NoError(t, d.Close())
+
+	// The key requires a format major version that supports it.
+	_, err = Open("", &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: ExperimentalFormatWALTransforms,
+		TableEncryptionKey: key1,
+	})
+	require.Error(t, err)
+}
+
 func TestGetVersion(t *testing.T) {
 	mem := vfs.NewMem()
 	opts := &Options{
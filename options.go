@@ -20,6 +20,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/manifest"
 	"github.com/cockroachdb/pebble/objstorage/shared"
+	"github.com/cockroachdb/pebble/record"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 )
@@ -34,12 +35,28 @@ type Compression = sstable.Compression
 
 // Exported Compression constants.
 const (
-	DefaultCompression = sstable.DefaultCompression
-	NoCompression      = sstable.NoCompression
-	SnappyCompression  = sstable.SnappyCompression
-	ZstdCompression    = sstable.ZstdCompression
+	DefaultCompression        = sstable.DefaultCompression
+	NoCompression             = sstable.NoCompression
+	SnappyCompression         = sstable.SnappyCompression
+	ZstdCompression           = sstable.ZstdCompression
+	ZstdDictionaryCompression = sstable.ZstdDictionaryCompression
+	LZ4Compression            = sstable.LZ4Compression
+	AdaptiveCompression       = sstable.AdaptiveCompression
 )
 
+// WALCompression exports the record.Compression type.
+type WALCompression = record.Compression
+
+// Exported WALCompression constants.
+const (
+	NoWALCompression     = record.NoCompression
+	SnappyWALCompression = record.SnappyCompression
+	ZstdWALCompression   = record.ZstdCompression
+)
+
+// WALTransform exports the record.Transform type.
+type WALTransform = record.Transform
+
 // FilterType exports the base.FilterType type.
 type FilterType = base.FilterType
 
@@ -54,6 +71,9 @@ type FilterWriter = base.FilterWriter
 // FilterPolicy exports the base.FilterPolicy type.
 type FilterPolicy = base.FilterPolicy
 
+// TunableFilterPolicy exports the base.TunableFilterPolicy type.
+type TunableFilterPolicy = base.TunableFilterPolicy
+
 // TablePropertyCollector exports the sstable.TablePropertyCollector type.
 type TablePropertyCollector = sstable.TablePropertyCollector
 
@@ -172,6 +192,16 @@ type IterOptions struct {
 	// existing is not low or if we just expect a one-time Seek (where loading the
 	// data block directly is better).
 	UseL6Filters bool
+	// DisableCacheFill configures the iterator to read data blocks without
+	// adding them to the block cache, so that bulk scans don't evict blocks
+	// that other reads depend on. Blocks already in the cache are still read
+	// from it, and index and filter blocks are cached as usual.
+	DisableCacheFill bool
+	// MVCC configures the iterator to read a multi-version keyspace as of a
+	// timestamp, surfacing only the newest visible version of each prefix. See
+	// MVCCReadOptions for details. MVCC reads are not supported by iterators
+	// created through NewExternalIter.
+	MVCC *MVCCReadOptions
 
 	// Internal options.
 
@@ -315,6 +345,48 @@ type BlockPropertyFilterMask interface {
 	SetSuffix(suffix []byte) error
 }
 
+// MVCCReadOptions configures an Iterator to read a keyspace of multi-version
+// keys as of a read timestamp. Keys are expected to take the form
+// <prefix><suffix>, where Comparer.Split separates the prefix and the suffix
+// encodes a version timestamp, and where the Comparer sorts versions of a
+// prefix in descending timestamp order (newest first).
+//
+// A key is visible if its suffix encodes a timestamp less than or equal to
+// ReadTimestamp, or if DecodeTimestamp reports that its suffix does not encode
+// a timestamp (eg, an unversioned key). Versions are resolved after point
+// deletions and merges: if the newest version is deleted, the next newest
+// visible version is surfaced. In the forward direction, the iterator surfaces
+// the first visible key of each prefix at or after the position it was seeked
+// to, and Next (and NextPrefix) skip the remaining versions of the prefix using
+// NextPrefix. In the reverse direction, the iterator surfaces the newest
+// visible key of each prefix less than the position it was seeked to. Seeking
+// to a versioned key or switching directions may therefore surface more than
+// one version of that key's prefix. SeekPrefixLT is not supported.
+//
+// Range keys are filtered by the same rule: RangeKeySets with suffixes
+// encoding timestamps greater than ReadTimestamp are omitted from RangeKeys(),
+// and spans left without any visible range keys are not surfaced at all.
+// Positions holding only a range key start boundary are surfaced as usual and
+// are not subject to version skipping. When combined with RangeKeyMasking,
+// only visible range keys mask point keys; callers reading at a timestamp
+// typically set RangeKeyMasking.Suffix to the suffix encoding ReadTimestamp.
+type MVCCReadOptions struct {
+	// ReadTimestamp is the timestamp at which the keyspace is read. Keys with
+	// timestamps greater than ReadTimestamp are invisible.
+	ReadTimestamp uint64
+	// DecodeTimestamp decodes the timestamp encoded by a key's suffix. It
+	// returns ok=false if the suffix does not encode a timestamp, in which case
+	// the key is visible at all read timestamps. DecodeTimestamp must be
+	// provided.
+	DecodeTimestamp func(suffix []byte) (ts uint64, ok bool)
+	// BlockPropertyName optionally names a block-property collector
+	// constructed by NewMVCCBlockPropertyCollector and configured through
+	// Options.BlockPropertyCollectors. If set, the iterator skips tables and
+	// point-key blocks that only contain keys with timestamps greater than
+	// ReadTimestamp.
+	BlockPropertyName string
+}
+
 // WriteOptions hold the optional per-query parameters for Set and Delete
 // operations.
 //
@@ -373,15 +445,43 @@ type LevelOptions struct {
 	// The default value (DefaultCompression) uses snappy compression.
 	Compression Compression
 
+	// CompressionLevel is the compression level used by the Compression
+	// algorithm. Zstd supports levels 1 through 22, and LZ4 levels 1 through 9,
+	// which select its high compression mode. Higher levels compress more
+	// slowly, but produce smaller tables. The compression level doesn't affect
+	// the ability to read tables, and may be changed between runs.
+	//
+	// The default value (0) uses the algorithm's default level.
+	CompressionLevel int
+
+	// AdaptiveZstdBudget is the additional CPU time AdaptiveCompression may
+	// spend compressing blocks with zstd rather than snappy, per KB of
+	// compressed size saved. See sstable.WriterOptions.AdaptiveZstdBudget.
+	//
+	// The default value (0) compresses blocks with snappy.
+	AdaptiveZstdBudget time.Duration
+
 	// FilterPolicy defines a filter algorithm (such as a Bloom filter) that can
 	// reduce disk reads for Get calls.
 	//
 	// One such implementation is bloom.FilterPolicy(10) from the pebble/bloom
-	// package.
+	// package. The bloom package also provides cache-local blocked Bloom
+	// filters, and the ribbon package provides Ribbon filters, which require
+	// ~25% less space than Bloom filters for the same false positive rate, at
+	// the cost of more CPU during flushes and compactions. Ribbon filters are
+	// well suited to the bottommost levels, which hold most of the data.
 	//
 	// The default value means to use no filter.
 	FilterPolicy FilterPolicy
 
+	// FilterFalsePositiveRate is the target false positive rate of the level's
+	// filters. It's only used if the FilterPolicy implements
+	// TunableFilterPolicy, and must be in the range (0, 1). Per-level false
+	// positive rates are reported by Metrics.LevelFilter.
+	//
+	// The default value (0) uses the FilterPolicy as configured.
+	FilterFalsePositiveRate float64
+
 	// FilterType defines whether an existing filter policy is applied at a
 	// block-level or table-level. Block-level filters use less memory to create,
 	// but are slower to access as a check for the key in the index must first be
@@ -400,6 +500,25 @@ type LevelOptions struct {
 	// The default value is the value of BlockSize.
 	IndexBlockSize int
 
+	// PartitionFilters configures tables with two-level indexes to partition
+	// their filters into blocks aligned with the index partitions, which are
+	// loaded into the block cache on demand, rather than loading large tables'
+	// filters whole. See sstable.WriterOptions.PartitionFilters.
+	//
+	// The default value (false) writes unpartitioned filters.
+	PartitionFilters bool
+
+	// RangeFilterPrefixLen, if positive, configures tables to include a range
+	// filter written using the FilterPolicy, over the first
+	// RangeFilterPrefixLen bytes of each key prefix. Iterators with bounds
+	// confined to a few truncated prefixes, such as short scans, skip tables
+	// whose range filters exclude the bounds. Range filters require a Comparer
+	// that declares Comparer.BytewisePrefixOrdering. See
+	// sstable.WriterOptions.RangeFilterPrefixLen.
+	//
+	// The default value (0) disables range filters.
+	RangeFilterPrefixLen int
+
 	// The target file size for the level.
 	TargetFileSize int64
 }
@@ -452,6 +571,39 @@ type Options struct {
 	// The default cache size is 8 MB.
 	Cache *cache.Cache
 
+	// SecondaryCache, if set, is a persistent second tier of Cache, stored in
+	// local files. Blocks read from sstables are written to it as they're
+	// stored in the sstables, compressed and, for encrypted tables, encrypted,
+	// and reads that miss in Cache are served from it before reading the
+	// sstable. The SecondaryCache is owned by the caller, who must close it
+	// after the DB is closed. It can only be used by one open DB at a time, and
+	// when it's used by a DB other than the one that last used it, its blocks
+	// are removed. DBs are told apart by a random identity stored in the
+	// IDENTITY file of the DB's directory.
+	SecondaryCache *cache.SecondaryCache
+
+	// CacheWarming configures persisting the keys of the blocks resident in
+	// Cache, and prefetching the blocks when the DB is reopened, so that the
+	// cache doesn't have to be refilled by reads after a restart.
+	CacheWarming struct {
+		// Enabled enables dumping the keys of the DB's resident blocks to the
+		// CACHE-WARMING file in the DB directory when the DB is closed, and
+		// prefetching the blocks in the background when the DB is opened.
+		// Blocks of tables that no longer exist are skipped.
+		Enabled bool
+		// DumpInterval, if non-zero, is the interval at which the keys are also
+		// dumped while the DB is open, so that they're available if the process
+		// exits without closing the DB.
+		DumpInterval time.Duration
+		// MaxBlocks bounds the number of blocks dumped, hot blocks first. Zero
+		// means there is no bound.
+		MaxBlocks int
+		// BytesPerSecond paces the prefetching of the blocks.
+		//
+		// The default value is 32 MB/s.
+		BytesPerSecond int
+	}
+
 	// Cleaner cleans obsolete files.
 	//
 	// The default cleaner uses the DeleteCleaner.
@@ -613,6 +765,22 @@ type Options struct {
 		// is enough CPU available, and this option bypasses that.
 		ForceWriterParallelism bool
 
+		// MaxFlushConcurrency is the maximum number of sub-flushes a flush of
+		// the memtables is split into. The sub-flushes write disjoint key ranges
+		// of the memtables concurrently, each range holding at least
+		// FlushSplitBytes of data, and their output tables are installed in a
+		// single version edit. If MaxFlushConcurrency <= 1, flushes write
+		// their output tables one after another.
+		MaxFlushConcurrency int
+
+		// MemTableInsertConcurrency is the maximum number of goroutines which
+		// insert a single batch into the memtable. A large batch is split into
+		// contiguous chunks of at least 256 entries which are inserted
+		// concurrently, and its entries become visible at the batch's sequence
+		// number once all the chunks are inserted. If MemTableInsertConcurrency
+		// <= 1, batches are inserted by the committing goroutine alone.
+		MemTableInsertConcurrency int
+
 		// CPUWorkPermissionGranter should be set if Pebble should be given the
 		// ability to optionally schedule additional CPU. See the documentation
 		// for CPUWorkPermissionGranter for more details.
@@ -755,6 +923,16 @@ type Options struct {
 	// LoggerAndTracer is used for writing log messages and traces.
 	LoggerAndTracer LoggerAndTracer
 
+	// Tracer, if set, receives spans for iterators created by NewIter and
+	// NewIterWithContext, their seeks which miss the block cache, their block
+	// reads from storage, flushes and compactions. The span of an iterator is
+	// the parent of the spans of its seeks and block reads, and is itself a
+	// child of the span in the context passed to NewIterWithContext, if any.
+	// Block reads outside of iterators, such as those of compactions, don't
+	// emit spans. See the tracing package for a Tracer which writes the spans
+	// to a file.
+	Tracer Tracer
+
 	// MaxManifestFileSize is the maximum size the MANIFEST file is allowed to
 	// become. When the MANIFEST exceeds this size it is rolled over and a new
 	// MANIFEST is created.
@@ -766,6 +944,13 @@ type Options struct {
 	// The default value is 1000.
 	MaxOpenFiles int
 
+	// MemTableKind determines the representation of the point keys of
+	// MemTables: a skiplist, skiplists partitioned by the hash of the key's
+	// prefix, or a vector which is sorted when it's read.
+	//
+	// The default value is SkiplistMemTable{}.
+	MemTableKind MemTableKind
+
 	// The size of a MemTable in steady state. The actual MemTable size starts at
 	// min(256KB, MemTableSize) and doubles for each subsequent MemTable up to
 	// MemTableSize. This reduces the memory pressure caused by MemTables for
@@ -812,12 +997,39 @@ type Options struct {
 	// to keep one older manifest.
 	NumPrevManifest int
 
+	// PinL0L1IndexAndFilterBlocks pins the index and filter blocks of tables in
+	// L0 and L1 for as long as the tables are open in the table cache. These
+	// blocks are read by nearly every lookup, and pinning them prevents scans
+	// from evicting them from the block cache. A table's blocks are pinned when
+	// it's first read while in L0 or L1, and remain pinned until the table is
+	// closed even if it's moved to a lower level. For tables with a
+	// partitioned index or filter, only the top-level blocks are pinned.
+	//
+	// Pinned blocks are held outside the block cache, but their size is
+	// reserved in it, so that they count towards its capacity and reduce the
+	// space available to other blocks.
+	PinL0L1IndexAndFilterBlocks bool
+
 	// ReadOnly indicates that the DB should be opened in read-only mode. Writes
 	// to the DB will return an error, background compactions are disabled, and
 	// the flush that normally occurs after replaying the WAL at startup is
 	// disabled.
 	ReadOnly bool
 
+	// RecordLatencies enables recording the latencies of foreground operations
+	// (DB.Get, Iterator.SeekGE and batch commits) in Metrics.Latency. Recording
+	// reads the clock twice per operation and updates histograms shared by all
+	// of the DB's operations, so it's disabled by default.
+	RecordLatencies bool
+
+	// SlowOperationThreshold is the latency at or above which foreground
+	// operations (DB.Get, Iterator.SeekGE and batch commits) are reported to
+	// EventListener.SlowOperation, along with a breakdown of the work done by
+	// the operation.
+	//
+	// The default value is 0, which disables reporting.
+	SlowOperationThreshold time.Duration
+
 	// TableCache is an initialized TableCache which should be set as an
 	// option if the DB needs to be initialized with a pre-existing table cache.
 	// If TableCache is nil, then a table cache which is unique to the DB instance
@@ -864,6 +1076,51 @@ type Options struct {
 	// changing options dynamically?
 	WALMinSyncInterval func() time.Duration
 
+	// WALCompression is the algorithm with which WAL records are compressed.
+	// Records which don't compress well are written uncompressed. Records are
+	// only compressed once the DB's format major version is at least
+	// ExperimentalFormatWALTransforms. The default is NoWALCompression.
+	WALCompression WALCompression
+
+	// WALTransform, if set, encodes every WAL record after compression, for
+	// example to encrypt it, so that the contents of WALs aren't stored in
+	// plaintext. The same transform is required to replay the WALs it encoded.
+	// It requires a format major version of at least
+	// ExperimentalFormatWALTransforms.
+	WALTransform WALTransform
+
+	// TableEncryptionKey, if set, is the key with which the blocks of new
+	// sstables are encrypted, so that the contents of sstables, including
+	// those on shared storage, aren't stored in plaintext. The key's ID is
+	// recorded in each table, and tables are decrypted with the key that
+	// TableEncryptionKeys returns for the ID, so that the key can be rotated
+	// while tables encrypted with previous keys remain. It requires a format
+	// major version of at least ExperimentalFormatTableEncryption. See
+	// sstable.EncryptionKey.
+	TableEncryptionKey *sstable.EncryptionKey
+
+	// TableEncryptionKeys returns the secret of the sstable encryption key
+	// with the given ID. It's required to open encrypted sstables, including
+	// ingested ones.
+	TableEncryptionKeys func(keyID string) ([]byte, error)
+
+	// KVChecksums enables key-value checksums, which detect corruption of keys
+	// and values in memory, after they've been decoded from blocks whose
+	// checksums they matched. A checksum of each key and value (see
+	// base.KVChecksum) is computed when it's added to a batch and verified
+	// when the batch is committed. Memtables store the checksums with their
+	// keys and verify them whenever the keys are read, including by flushes;
+	// range deletions and range keys are verified when they're fragmented,
+	// on the first read after they're added. Flushes and compactions pass the
+	// checksums of their input point keys to the sstable writer, which
+	// verifies them before storing them with the keys. All reads of sstables,
+	// including point lookups, verify the checksums of the keys they return,
+	// and of values stored in value blocks when they're fetched. Mismatches
+	// are surfaced as errors marked with ErrCorruption. Checksums are only
+	// computed once the DB's format major version is at least
+	// ExperimentalFormatKVChecksums.
+	KVChecksums bool
+
 	// private options are only used by internal tests or are used internally
 	// for facilitating upgrade paths of unconfigurable functionality.
 	private struct {
@@ -925,6 +1182,9 @@ func (o *Options) EnsureDefaults() *Options {
 	if o.BytesPerSync <= 0 {
 		o.BytesPerSync = 512 << 10 // 512 KB
 	}
+	if o.CacheWarming.BytesPerSecond <= 0 {
+		o.CacheWarming.BytesPerSecond = 32 << 20 // 32 MB/s
+	}
 	if o.Cleaner == nil {
 		o.Cleaner = DeleteCleaner{}
 	}
@@ -1007,6 +1267,9 @@ func (o *Options) EnsureDefaults() *Options {
 	if o.MaxOpenFiles == 0 {
 		o.MaxOpenFiles = 1000
 	}
+	if o.MemTableKind == nil {
+		o.MemTableKind = SkiplistMemTable{}
+	}
 	if o.MemTableSize <= 0 {
 		o.MemTableSize = 4 << 20
 	}
@@ -1156,6 +1419,9 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "  flush_delay_range_key=%s\n", o.FlushDelayRangeKey)
 	fmt.Fprintf(&buf, "  flush_split_bytes=%d\n", o.FlushSplitBytes)
 	fmt.Fprintf(&buf, "  format_major_version=%d\n", o.FormatMajorVersion)
+	if o.KVChecksums {
+		fmt.Fprintf(&buf, "  kv_checksums=%t\n", true)
+	}
 	fmt.Fprintf(&buf, "  l0_compaction_concurrency=%d\n", o.Experimental.L0CompactionConcurrency)
 	fmt.Fprintf(&buf, "  l0_compaction_file_threshold=%d\n", o.L0CompactionFileThreshold)
 	fmt.Fprintf(&buf, "  l0_compaction_threshold=%d\n", o.L0CompactionThreshold)
@@ -1167,12 +1433,22 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "  max_concurrent_compactions=%d\n", o.MaxConcurrentCompactions())
 	fmt.Fprintf(&buf, "  max_manifest_file_size=%d\n", o.MaxManifestFileSize)
 	fmt.Fprintf(&buf, "  max_open_files=%d\n", o.MaxOpenFiles)
+	fmt.Fprintf(&buf, "  mem_table_kind=%s\n", o.MemTableKind)
 	fmt.Fprintf(&buf, "  mem_table_size=%d\n", o.MemTableSize)
 	fmt.Fprintf(&buf, "  mem_table_stop_writes_threshold=%d\n", o.MemTableStopWritesThreshold)
 	fmt.Fprintf(&buf, "  min_deletion_rate=%d\n", o.Experimental.MinDeletionRate)
 	fmt.Fprintf(&buf, "  merger=%s\n", o.Merger.Name)
+	if o.PinL0L1IndexAndFilterBlocks {
+		fmt.Fprintf(&buf, "  pin_l0_l1_index_and_filter_blocks=%t\n", true)
+	}
 	fmt.Fprintf(&buf, "  read_compaction_rate=%d\n", o.Experimental.ReadCompactionRate)
 	fmt.Fprintf(&buf, "  read_sampling_multiplier=%d\n", o.Experimental.ReadSamplingMultiplier)
+	if o.RecordLatencies {
+		fmt.Fprintf(&buf, "  record_latencies=%t\n", true)
+	}
+	if o.SlowOperationThreshold > 0 {
+		fmt.Fprintf(&buf, "  slow_operation_threshold=%s\n", o.SlowOperationThreshold)
+	}
 	fmt.Fprintf(&buf, "  strict_wal_tail=%t\n", o.private.strictWALTail)
 	fmt.Fprintf(&buf, "  table_cache_shards=%d\n", o.Experimental.TableCacheShards)
 	fmt.Fprintf(&buf, "  table_property_collectors=[")
@@ -1188,8 +1464,13 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "  validate_on_ingest=%t\n", o.Experimental.ValidateOnIngest)
 	fmt.Fprintf(&buf, "  wal_dir=%s\n", o.WALDir)
 	fmt.Fprintf(&buf, "  wal_bytes_per_sync=%d\n", o.WALBytesPerSync)
+	if o.WALCompression != NoWALCompression {
+		fmt.Fprintf(&buf, "  wal_compression=%s\n", o.WALCompression)
+	}
 	fmt.Fprintf(&buf, "  max_writer_concurrency=%d\n", o.Experimental.MaxWriterConcurrency)
 	fmt.Fprintf(&buf, "  force_writer_parallelism=%t\n", o.Experimental.ForceWriterParallelism)
+	fmt.Fprintf(&buf, "  max_flush_concurrency=%d\n", o.Experimental.MaxFlushConcurrency)
+	fmt.Fprintf(&buf, "  mem_table_insert_concurrency=%d\n", o.Experimental.MemTableInsertConcurrency)
 
 	// Private options.
 	//
@@ -1211,13 +1492,29 @@ func (o *Options) String() string {
 		l := &o.Levels[i]
 		fmt.Fprintf(&buf, "\n")
 		fmt.Fprintf(&buf, "[Level \"%d\"]\n", i)
+		if l.AdaptiveZstdBudget != 0 {
+			fmt.Fprintf(&buf, "  adaptive_zstd_budget=%s\n", l.AdaptiveZstdBudget)
+		}
 		fmt.Fprintf(&buf, "  block_restart_interval=%d\n", l.BlockRestartInterval)
 		fmt.Fprintf(&buf, "  block_size=%d\n", l.BlockSize)
 		fmt.Fprintf(&buf, "  block_size_threshold=%d\n", l.BlockSizeThreshold)
 		fmt.Fprintf(&buf, "  compression=%s\n", l.Compression)
+		if l.CompressionLevel != 0 {
+			fmt.Fprintf(&buf, "  compression_level=%d\n", l.CompressionLevel)
+		}
+		if l.FilterFalsePositiveRate != 0 {
+			fmt.Fprintf(&buf, "  filter_false_positive_rate=%s\n",
+				strconv.FormatFloat(l.FilterFalsePositiveRate, 'g', -1, 64))
+		}
 		fmt.Fprintf(&buf, "  filter_policy=%s\n", filterPolicyName(l.FilterPolicy))
 		fmt.Fprintf(&buf, "  filter_type=%s\n", l.FilterType)
 		fmt.Fprintf(&buf, "  index_block_size=%d\n", l.IndexBlockSize)
+		if l.PartitionFilters {
+			fmt.Fprintf(&buf, "  partition_filters=%t\n", l.PartitionFilters)
+		}
+		if l.RangeFilterPrefixLen != 0 {
+			fmt.Fprintf(&buf, "  range_filter_prefix_len=%d\n", l.RangeFilterPrefixLen)
+		}
 		fmt.Fprintf(&buf, "  target_file_size=%d\n", l.TargetFileSize)
 	}
 
@@ -1381,6 +1678,8 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				if err == nil {
 					o.FormatMajorVersion = FormatMajorVersion(v)
 				}
+			case "kv_checksums":
+				o.KVChecksums, err = strconv.ParseBool(value)
 			case "l0_compaction_concurrency":
 				o.Experimental.L0CompactionConcurrency, err = strconv.Atoi(value)
 			case "l0_compaction_file_threshold":
@@ -1407,6 +1706,8 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				o.MaxManifestFileSize, err = strconv.ParseInt(value, 10, 64)
 			case "max_open_files":
 				o.MaxOpenFiles, err = strconv.Atoi(value)
+			case "mem_table_kind":
+				o.MemTableKind, err = parseMemTableKind(value)
 			case "mem_table_size":
 				o.MemTableSize, err = strconv.Atoi(value)
 			case "mem_table_stop_writes_threshold":
@@ -1434,10 +1735,16 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 						o.Merger, err = hooks.NewMerger(value)
 					}
 				}
+			case "pin_l0_l1_index_and_filter_blocks":
+				o.PinL0L1IndexAndFilterBlocks, err = strconv.ParseBool(value)
 			case "read_compaction_rate":
 				o.Experimental.ReadCompactionRate, err = strconv.ParseInt(value, 10, 64)
 			case "read_sampling_multiplier":
 				o.Experimental.ReadSamplingMultiplier, err = strconv.ParseInt(value, 10, 64)
+			case "record_latencies":
+				o.RecordLatencies, err = strconv.ParseBool(value)
+			case "slow_operation_threshold":
+				o.SlowOperationThreshold, err = time.ParseDuration(value)
 			case "table_cache_shards":
 				o.Experimental.TableCacheShards, err = strconv.Atoi(value)
 			case "table_format":
@@ -1455,10 +1762,25 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				o.WALDir = value
 			case "wal_bytes_per_sync":
 				o.WALBytesPerSync, err = strconv.Atoi(value)
+			case "wal_compression":
+				switch value {
+				case "none":
+					o.WALCompression = NoWALCompression
+				case "snappy":
+					o.WALCompression = SnappyWALCompression
+				case "zstd":
+					o.WALCompression = ZstdWALCompression
+				default:
+					return errors.Errorf("pebble: unknown WAL compression: %q", errors.Safe(value))
+				}
 			case "max_writer_concurrency":
 				o.Experimental.MaxWriterConcurrency, err = strconv.Atoi(value)
 			case "force_writer_parallelism":
 				o.Experimental.ForceWriterParallelism, err = strconv.ParseBool(value)
+			case "max_flush_concurrency":
+				o.Experimental.MaxFlushConcurrency, err = strconv.Atoi(value)
+			case "mem_table_insert_concurrency":
+				o.Experimental.MemTableInsertConcurrency, err = strconv.Atoi(value)
 			default:
 				if hooks != nil && hooks.SkipUnknown != nil && hooks.SkipUnknown(section+"."+key, value) {
 					return nil
@@ -1488,6 +1810,8 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 
 			var err error
 			switch key {
+			case "adaptive_zstd_budget":
+				l.AdaptiveZstdBudget, err = time.ParseDuration(value)
 			case "block_restart_interval":
 				l.BlockRestartInterval, err = strconv.Atoi(value)
 			case "block_size":
@@ -1504,9 +1828,19 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 					l.Compression = SnappyCompression
 				case "ZSTD":
 					l.Compression = ZstdCompression
+				case "ZSTDDictionary":
+					l.Compression = ZstdDictionaryCompression
+				case "LZ4":
+					l.Compression = LZ4Compression
+				case "Adaptive":
+					l.Compression = AdaptiveCompression
 				default:
 					return errors.Errorf("pebble: unknown compression: %q", errors.Safe(value))
 				}
+			case "compression_level":
+				l.CompressionLevel, err = strconv.Atoi(value)
+			case "filter_false_positive_rate":
+				l.FilterFalsePositiveRate, err = strconv.ParseFloat(value, 64)
 			case "filter_policy":
 				if hooks != nil && hooks.NewFilterPolicy != nil {
 					l.FilterPolicy, err = hooks.NewFilterPolicy(value)
@@ -1520,6 +1854,10 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				}
 			case "index_block_size":
 				l.IndexBlockSize, err = strconv.Atoi(value)
+			case "partition_filters":
+				l.PartitionFilters, err = strconv.ParseBool(value)
+			case "range_filter_prefix_len":
+				l.RangeFilterPrefixLen, err = strconv.Atoi(value)
 			case "target_file_size":
 				l.TargetFileSize, err = strconv.ParseInt(value, 10, 64)
 			default:
@@ -1599,6 +1937,15 @@ func (o *Options) Validate() error {
 		fmt.Fprintf(&buf, "FormatMajorVersion (%d) must be <= %d\n",
 			o.FormatMajorVersion, internalFormatNewest)
 	}
+	for i := range o.Levels {
+		if r := o.Levels[i].FilterFalsePositiveRate; r < 0 || r >= 1 {
+			fmt.Fprintf(&buf, "Levels[%d].FilterFalsePositiveRate (%g) must be in the range (0, 1)\n", i, r)
+		}
+		if o.Levels[i].RangeFilterPrefixLen > 0 && !o.Comparer.BytewisePrefixOrdering {
+			fmt.Fprintf(&buf, "Levels[%d].RangeFilterPrefixLen requires a Comparer with BytewisePrefixOrdering (%s)\n",
+				i, o.Comparer.Name)
+		}
+	}
 	if o.TableCache != nil && o.Cache != o.TableCache.cache {
 		fmt.Fprintf(&buf, "underlying cache in the TableCache and the Cache dont match\n")
 	}
@@ -1621,6 +1968,8 @@ func (o *Options) MakeReaderOptions() sstable.ReaderOptions {
 			readerOpts.MergerName = o.Merger.Name
 		}
 		readerOpts.LoggerAndTracer = o.LoggerAndTracer
+		readerOpts.Tracer = o.Tracer
+		readerOpts.EncryptionKeys = o.TableEncryptionKeys
 	}
 	return readerOpts
 }
@@ -1638,6 +1987,8 @@ func (o *Options) MakeWriterOptions(level int, format sstable.TableFormat) sstab
 		}
 		writerOpts.TablePropertyCollectors = o.TablePropertyCollectors
 		writerOpts.BlockPropertyCollectors = o.BlockPropertyCollectors
+		writerOpts.Encryption = o.TableEncryptionKey
+		writerOpts.KVChecksums = o.KVChecksums
 	}
 	if format >= sstable.TableFormatPebblev3 {
 		writerOpts.ShortAttributeExtractor = o.Experimental.ShortAttributeExtractor
@@ -1648,8 +1999,15 @@ func (o *Options) MakeWriterOptions(level int, format sstable.TableFormat) sstab
 	writerOpts.BlockSize = levelOpts.BlockSize
 	writerOpts.BlockSizeThreshold = levelOpts.BlockSizeThreshold
 	writerOpts.Compression = levelOpts.Compression
+	writerOpts.CompressionLevel = levelOpts.CompressionLevel
+	writerOpts.AdaptiveZstdBudget = levelOpts.AdaptiveZstdBudget
 	writerOpts.FilterPolicy = levelOpts.FilterPolicy
+	if p, ok := levelOpts.FilterPolicy.(TunableFilterPolicy); ok && levelOpts.FilterFalsePositiveRate > 0 {
+		writerOpts.FilterPolicy = p.WithFalsePositiveRate(levelOpts.FilterFalsePositiveRate)
+	}
 	writerOpts.FilterType = levelOpts.FilterType
 	writerOpts.IndexBlockSize = levelOpts.IndexBlockSize
+	writerOpts.PartitionFilters = levelOpts.PartitionFilters
+	writerOpts.RangeFilterPrefixLen = levelOpts.RangeFilterPrefixLen
 	return writerOpts
 }
@@ -12,7 +12,10 @@ import (
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/ribbon"
+	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/stretchr/testify/require"
 )
@@ -91,6 +94,7 @@ func TestOptionsString(t *testing.T) {
   max_concurrent_compactions=1
   max_manifest_file_size=134217728
   max_open_files=1000
+  mem_table_kind=skiplist
   mem_table_size=4194304
   mem_table_stop_writes_threshold=2
   min_deletion_rate=0
@@ -105,6 +109,8 @@ func TestOptionsString(t *testing.T) {
   wal_bytes_per_sync=0
   max_writer_concurrency=0
   force_writer_parallelism=false
+  max_flush_concurrency=0
+  mem_table_insert_concurrency=0
 
 [Level "0"]
   block_restart_interval=16
@@ -207,6 +213,17 @@ func TestOptionsParse(t *testing.T) {
 			}
 			return nil, errors.Errorf("unknown merger: %q", name)
 		},
+		NewFilterPolicy: func(name string) (FilterPolicy, error) {
+			switch name {
+			case "none":
+				return nil, nil
+			case bloom.BlockedFilterPolicy(10).Name():
+				return bloom.BlockedFilterPolicy(10), nil
+			case ribbon.FilterPolicy(7).Name():
+				return ribbon.FilterPolicy(7), nil
+			}
+			return nil, errors.Errorf("unknown filter policy: %q", name)
+		},
 	}
 
 	testCases := []struct {
@@ -228,9 +245,20 @@ func TestOptionsParse(t *testing.T) {
 			opts.Levels[0].BlockSize = 1024
 			opts.Levels[1].BlockSize = 2048
 			opts.Levels[2].BlockSize = 4096
+			opts.Levels[2].Compression = LZ4Compression
+			opts.Levels[2].CompressionLevel = 9
+			opts.Levels[1].Compression = AdaptiveCompression
+			opts.Levels[1].AdaptiveZstdBudget = 50 * time.Microsecond
+			opts.Levels[0].FilterPolicy = bloom.BlockedFilterPolicy(10)
+			opts.Levels[2].FilterPolicy = ribbon.FilterPolicy(7)
+			opts.Levels[2].FilterFalsePositiveRate = 0.005
+			opts.Levels[2].RangeFilterPrefixLen = 8
+			opts.Levels[0].PartitionFilters = true
 			opts.Experimental.CompactionDebtConcurrency = 100
 			opts.FlushDelayDeleteRange = 10 * time.Second
 			opts.FlushDelayRangeKey = 11 * time.Second
+			opts.PinL0L1IndexAndFilterBlocks = true
+			opts.RecordLatencies = true
 			opts.Experimental.LevelMultiplier = 5
 			opts.Experimental.MinDeletionRate = 200
 			opts.Experimental.ReadCompactionRate = 300
@@ -285,6 +313,12 @@ func TestOptionsValidate(t *testing.T) {
 `,
 			`MemTableStopWritesThreshold .* must be >= 2`,
 		},
+		{`
+[Level "0"]
+  filter_false_positive_rate=1.5
+`,
+			`Levels\[0\]\.FilterFalsePositiveRate \(1\.5\) must be in the range \(0, 1\)`,
+		},
 	}
 
 	for _, c := range testCases {
@@ -320,3 +354,40 @@ func TestOptionsValidateCache(t *testing.T) {
 		t.Errorf("Unexpected error message")
 	}
 }
+
+// This test isn't being done in TestOptionsValidate
+// cause it doesn't support setting pointers.
+func TestOptionsValidateRangeFilter(t *testing.T) {
+	opts := &Options{
+		Levels: []LevelOptions{{RangeFilterPrefixLen: 4}},
+	}
+	opts.EnsureDefaults()
+	require.NoError(t, opts.Validate())
+
+	// Range filters require a comparer that orders prefixes bytewise.
+	comparer := *DefaultComparer
+	comparer.BytewisePrefixOrdering = false
+	comparer.Name = "reverse"
+	opts.Comparer = &comparer
+	err := opts.Validate()
+	require.Error(t, err)
+	require.Regexp(t, `Levels\[0\]\.RangeFilterPrefixLen requires a Comparer with BytewisePrefixOrdering \(reverse\)`, err.Error())
+}
+
+func TestOptionsFilterFalsePositiveRate(t *testing.T) {
+	opts := &Options{
+		Levels: []LevelOptions{
+			{FilterPolicy: bloom.FilterPolicy(10), FilterFalsePositiveRate: 0.001},
+			{FilterPolicy: ribbon.FilterPolicy(7), FilterFalsePositiveRate: 0.001},
+			{FilterPolicy: ribbon.FilterPolicy(7)},
+		},
+	}
+	opts.EnsureDefaults()
+	require.NoError(t, opts.Validate())
+	require.Equal(t, bloom.FilterPolicy(16), opts.MakeWriterOptions(0, sstable.TableFormatPebblev3).FilterPolicy)
+	require.Equal(t, ribbon.FilterPolicy(10), opts.MakeWriterOptions(1, sstable.TableFormatPebblev3).FilterPolicy)
+	require.Equal(t, ribbon.FilterPolicy(7), opts.MakeWriterOptions(2, sstable.TableFormatPebblev3).FilterPolicy)
+	// Tables written with any of the tuned policies are readable using the
+	// registered policies.
+	require.Equal(t, ribbon.FilterPolicy(7), opts.Filters[ribbon.FilterPolicy(7).Name()])
+}
@@ -18,6 +18,9 @@ func (i *Iterator) constructRangeKeyIter() {
 	i.rangeKey.rangeKeyIter = i.rangeKey.iterConfig.Init(
 		&i.comparer, i.seqNum, i.opts.LowerBound, i.opts.UpperBound,
 		&i.hasPrefix, &i.prefixOrFullSeekKey, true /* onlySets */, &i.rangeKey.rangeKeyBuffers.internal)
+	if i.mvcc.enabled {
+		i.rangeKey.iterConfig.SetSuffixFilter(i.mvccRangeKeyVisible)
+	}
 
 	// If there's an indexed batch with range keys, include it.
 	if i.batch != nil {
@@ -436,11 +439,11 @@ var _ internalIterator = (*lazyCombinedIter)(nil)
 // iteration) or largest (backward iteration) of the two.
 //
 // The `seekKey` parameter is non-nil only if the iterator operation that
-// triggered the switch to combined iteration was a SeekGE, SeekPrefixGE or
-// SeekLT. It provides the seek key supplied and is used to seek the range-key
-// iterator using the same key. This is necessary for SeekGE/SeekPrefixGE
-// operations that land in the middle of a range key and must truncate to the
-// user-provided seek key.
+// triggered the switch to combined iteration was a SeekGE, SeekPrefixGE,
+// SeekLT or SeekPrefixLT. It provides the seek key supplied and is used to
+// seek the range-key iterator using the same key. This is necessary for
+// SeekGE/SeekPrefixGE operations that land in the middle of a range key and
+// must truncate to the user-provided seek key.
 func (i *lazyCombinedIter) initCombinedIteration(
 	dir int8, pointKey *InternalKey, pointValue base.LazyValue, seekKey []byte,
 ) (*InternalKey, base.LazyValue) {
@@ -532,14 +535,14 @@ func (i *lazyCombinedIter) initCombinedIteration(
 	// key the iterator returned. The range key may be less than pointKey, in
 	// which case the range key will be interleaved next instead of the point
 	// key.
+	var prefix []byte
+	if i.parent.hasPrefix {
+		prefix = i.parent.prefixOrFullSeekKey
+	}
 	if dir == +1 {
-		var prefix []byte
-		if i.parent.hasPrefix {
-			prefix = i.parent.prefixOrFullSeekKey
-		}
 		return i.parent.rangeKey.iiter.InitSeekGE(prefix, seekKey, pointKey, pointValue)
 	}
-	return i.parent.rangeKey.iiter.InitSeekLT(seekKey, pointKey, pointValue)
+	return i.parent.rangeKey.iiter.InitSeekLT(prefix, seekKey, pointKey, pointValue)
 }
 
 func (i *lazyCombinedIter) SeekGE(
@@ -581,6 +584,19 @@ func (i *lazyCombinedIter) SeekLT(
 	return k, v
 }
 
+func (i *lazyCombinedIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*InternalKey, base.LazyValue) {
+	if i.combinedIterState.initialized {
+		return i.parent.rangeKey.iiter.SeekPrefixLT(prefix, key, flags)
+	}
+	k, v := i.pointIter.SeekPrefixLT(prefix, key, flags)
+	if i.combinedIterState.triggered {
+		return i.initCombinedIteration(-1, k, v, key)
+	}
+	return k, v
+}
+
 func (i *lazyCombinedIter) First() (*InternalKey, base.LazyValue) {
 	if i.combinedIterState.initialized {
 		return i.parent.rangeKey.iiter.First()
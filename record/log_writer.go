@@ -299,6 +299,10 @@ type LogWriter struct {
 
 	// See the comment for LogWriterConfig.QueueSemChan.
 	queueSemChan chan struct{}
+
+	// encoder compresses and transforms records, if the LogWriter is
+	// configured with a Compression or a Transform.
+	encoder recordEncoder
 }
 
 // LogWriterConfig is a struct used for configuring new LogWriters
@@ -310,6 +314,14 @@ type LogWriterConfig struct {
 	// the syncQueue from overflowing (which will cause a panic). All production
 	// code ensures this is non-nil.
 	QueueSemChan chan struct{}
+	// Compression, if not NoCompression, is the algorithm with which records
+	// are compressed. Records which don't compress well are written
+	// uncompressed.
+	Compression Compression
+	// Transform, if set, encodes every record after compression, for example
+	// to encrypt it. Readers must be configured with the same Transform (see
+	// Reader.SetTransform).
+	Transform Transform
 }
 
 // CapAllocatedBlocks is the maximum number of blocks allocated by the
@@ -333,6 +345,10 @@ func NewLogWriter(w io.Writer, logNum base.FileNum, logWriterConfig LogWriterCon
 			return time.AfterFunc(d, f)
 		},
 		queueSemChan: logWriterConfig.QueueSemChan,
+		encoder: recordEncoder{
+			compression: logWriterConfig.Compression,
+			transform:   logWriterConfig.Transform,
+		},
 	}
 	r.free.cond.L = &r.free.Mutex
 	r.free.blocks = make([]*block, 0, CapAllocatedBlocks)
@@ -680,13 +696,21 @@ func (w *LogWriter) SyncRecord(
 		return -1, 0, w.err
 	}
 
+	var transformed bool
+	if w.encoder.enabled() {
+		var err error
+		if p, transformed, err = w.encoder.encode(p); err != nil {
+			return -1, 0, err
+		}
+	}
+
 	// The `i == 0` condition ensures we handle empty records. Such records can
 	// possibly be generated for VersionEdits stored in the MANIFEST. While the
 	// MANIFEST is currently written using Writer, it is good to support the same
 	// semantics with LogWriter.
 	for i := 0; i == 0 || len(p) > 0; i++ {
 		var wd time.Duration
-		p, wd = w.emitFragment(i, p)
+		p, wd = w.emitFragment(i, p, transformed)
 		waitDuration += wd
 	}
 
@@ -727,7 +751,9 @@ func (w *LogWriter) emitEOFTrailer() {
 	atomic.StoreInt32(&b.written, i+int32(recyclableHeaderSize))
 }
 
-func (w *LogWriter) emitFragment(n int, p []byte) (remainingP []byte, waitDuration time.Duration) {
+func (w *LogWriter) emitFragment(
+	n int, p []byte, transformed bool,
+) (remainingP []byte, waitDuration time.Duration) {
 	b := w.block
 	i := b.written
 	first := n == 0
@@ -746,6 +772,9 @@ func (w *LogWriter) emitFragment(n int, p []byte) (remainingP []byte, waitDurati
 			b.buf[i+6] = recyclableMiddleChunkType
 		}
 	}
+	if transformed {
+		b.buf[i+6] += transformedFullChunkType - recyclableFullChunkType
+	}
 
 	binary.LittleEndian.PutUint32(b.buf[i+7:i+11], w.logNum)
 
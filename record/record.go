@@ -94,6 +94,17 @@
 // (i.e. full, first, middle, last). The CRC is computed over the type, log
 // number, and payload.
 //
+// A LogWriter configured with a Compression or a Transform writes records in
+// "transformed" chunks, using 4 further chunk types that map directly to the
+// recyclable chunk types. The payload of a transformed record, that is the
+// concatenation of the payloads of its chunks, begins with a byte describing
+// how the record was compressed and whether it was encoded by the Transform
+// (see transform.go). A record is transformed as a whole before it's divided
+// into chunks, since a chunk is too small to compress well. Records that are
+// neither compressed nor encoded are written in recyclable chunks, so a
+// LogWriter with only a Compression writes logs readable by older readers
+// until it writes a compressible record.
+//
 // The wire format allows for limited recovery in the face of data corruption:
 // on a format error (such as a checksum mismatch), the reader moves to the
 // next block and looks for the next full or first chunk.
@@ -124,6 +135,11 @@ const (
 	recyclableFirstChunkType  = 6
 	recyclableMiddleChunkType = 7
 	recyclableLastChunkType   = 8
+
+	transformedFullChunkType   = 9
+	transformedFirstChunkType  = 10
+	transformedMiddleChunkType = 11
+	transformedLastChunkType   = 12
 )
 
 const (
@@ -178,6 +194,17 @@ type Reader struct {
 	recovering bool
 	// last is whether the current chunk is the last chunk of the record.
 	last bool
+	// transformed is whether the current chunk is a transformed chunk.
+	transformed bool
+	// transform decodes records encoded by a LogWriter's Transform.
+	transform Transform
+	// decoded[decodedOffset:] is the unread portion of the current record, if
+	// it's a transformed record.
+	decoded       []byte
+	decodedOffset int
+	// encoded and scratch are buffers used to decode transformed records.
+	encoded []byte
+	scratch []byte
 	// err is any accumulated error.
 	err error
 	// buf is the buffer.
@@ -195,6 +222,13 @@ func NewReader(r io.Reader, logNum base.FileNum) *Reader {
 	}
 }
 
+// SetTransform sets the Transform with which the reader decodes records
+// encoded by a LogWriter configured with a Transform. Records that are only
+// compressed are decoded without one.
+func (r *Reader) SetTransform(t Transform) {
+	r.transform = t
+}
+
 // nextChunk sets r.buf[r.i:r.j] to hold the next chunk's payload, reading the
 // next block into the buffer if necessary.
 func (r *Reader) nextChunk(wantFirst bool) error {
@@ -224,7 +258,8 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 			}
 
 			headerSize := legacyHeaderSize
-			if chunkType >= recyclableFullChunkType && chunkType <= recyclableLastChunkType {
+			transformed := false
+			if chunkType >= recyclableFullChunkType && chunkType <= transformedLastChunkType {
 				headerSize = recyclableHeaderSize
 				if r.end+headerSize > r.n {
 					return ErrInvalidChunk
@@ -242,7 +277,12 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 					return ErrInvalidChunk
 				}
 
-				chunkType -= (recyclableFullChunkType - 1)
+				if chunkType >= transformedFullChunkType {
+					transformed = true
+					chunkType -= (transformedFullChunkType - 1)
+				} else {
+					chunkType -= (recyclableFullChunkType - 1)
+				}
 			}
 
 			r.begin = r.end + headerSize
@@ -267,6 +307,11 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 					continue
 				}
 			}
+			if !wantFirst && transformed != r.transformed {
+				// The chunks of a record are either all transformed or all not.
+				return ErrInvalidChunk
+			}
+			r.transformed = transformed
 			r.last = chunkType == fullChunkType || chunkType == lastChunkType
 			r.recovering = false
 			return nil
@@ -305,9 +350,32 @@ func (r *Reader) Next() (io.Reader, error) {
 	if r.err != nil {
 		return nil, r.err
 	}
+	if r.transformed {
+		if r.err = r.decodeRecord(); r.err != nil {
+			return nil, r.err
+		}
+	}
 	return singleReader{r, r.seq}, nil
 }
 
+// decodeRecord reads the rest of the chunks of the current transformed
+// record, and decodes the record into r.decoded.
+func (r *Reader) decodeRecord() error {
+	r.encoded = append(r.encoded[:0], r.buf[r.begin:r.end]...)
+	r.begin = r.end
+	for !r.last {
+		if err := r.nextChunk(false); err != nil {
+			return err
+		}
+		r.encoded = append(r.encoded, r.buf[r.begin:r.end]...)
+		r.begin = r.end
+	}
+	var err error
+	r.decoded, r.scratch, err = decodeRecord(r.decoded[:0], r.scratch, r.encoded, r.transform)
+	r.decodedOffset = 0
+	return err
+}
+
 // Offset returns the current offset within the file. If called immediately
 // before a call to Next(), Offset() will return the record offset.
 func (r *Reader) Offset() int64 {
@@ -396,6 +464,14 @@ func (x singleReader) Read(p []byte) (int, error) {
 	if r.err != nil {
 		return 0, r.err
 	}
+	if r.transformed {
+		if r.decodedOffset == len(r.decoded) {
+			return 0, io.EOF
+		}
+		n := copy(p, r.decoded[r.decodedOffset:])
+		r.decodedOffset += n
+		return n, nil
+	}
 	for r.begin == r.end {
 		if r.last {
 			return 0, io.EOF
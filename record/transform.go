@@ -0,0 +1,195 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package record
+
+import (
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the algorithm with which a LogWriter compresses records.
+type Compression uint8
+
+// The compression algorithms. These values are part of the wire format and
+// should not be changed.
+const (
+	NoCompression Compression = iota
+	SnappyCompression
+	ZstdCompression
+)
+
+// String implements fmt.Stringer.
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case SnappyCompression:
+		return "snappy"
+	case ZstdCompression:
+		return "zstd"
+	default:
+		return "unknown"
+	}
+}
+
+// Transform is a reversible transformation of the payloads of the records
+// written by a LogWriter, such as encryption, so that the records are not
+// stored in plaintext. It's applied after compression. Its methods may be
+// called concurrently.
+type Transform interface {
+	// Encode appends the transformed src to dst, and returns the result.
+	Encode(dst, src []byte) ([]byte, error)
+	// Decode appends the original of the transformed src to dst, and returns
+	// the result. It should return an error if src wasn't produced by Encode,
+	// for example if src was corrupted.
+	Decode(dst, src []byte) ([]byte, error)
+}
+
+// The payload of a record written in transformed chunks begins with a byte
+// describing how the rest of the payload was encoded:
+//
+//	+-----------+--- ... ---+
+//	| Flags (1B)| Payload   |
+//	+-----------+--- ... ---+
+//
+// The low 4 bits of the flags hold the Compression of the payload, and the
+// transformFlagEncoded bit is set if the payload was encoded by a Transform
+// after compression.
+const (
+	transformCompressionMask = 0x0f
+	transformFlagEncoded     = 0x10
+	transformFlagsMask       = transformCompressionMask | transformFlagEncoded
+)
+
+// minCompressedRecordSize is the size of the smallest record a LogWriter
+// attempts to compress. Smaller records are rarely compressible enough to pay
+// for the compression.
+const minCompressedRecordSize = 128
+
+// ErrNoTransform is returned when reading a record encoded by a Transform
+// with a Reader without one.
+var ErrNoTransform = errors.New("pebble/record: record is encoded, but the reader has no transform")
+
+var zstdCodec struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func initZstdCodec() {
+	zstdCodec.once.Do(func() {
+		// The encoder and decoder are safe for concurrent use by EncodeAll and
+		// DecodeAll. The options are valid, so they can't fail.
+		zstdCodec.encoder, _ = zstd.NewWriter(nil,
+			zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		zstdCodec.decoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+}
+
+// recordEncoder compresses and transforms records, reusing its buffers
+// between records.
+type recordEncoder struct {
+	compression Compression
+	transform   Transform
+	compressed  []byte
+	encoded     []byte
+}
+
+// enabled returns true if the encoder may transform records.
+func (e *recordEncoder) enabled() bool {
+	return e.compression != NoCompression || e.transform != nil
+}
+
+// encode returns the payload to write for the record p, and whether it was
+// transformed. A record that is neither compressed nor encoded by a
+// Transform is written as is. The returned slice is valid until the next
+// call to encode.
+func (e *recordEncoder) encode(p []byte) (payload []byte, transformed bool, err error) {
+	body := p
+	compression := NoCompression
+	if e.compression != NoCompression && len(p) >= minCompressedRecordSize {
+		var c []byte
+		switch e.compression {
+		case SnappyCompression:
+			c = snappy.Encode(e.compressed[:cap(e.compressed)], p)
+		case ZstdCompression:
+			initZstdCodec()
+			c = zstdCodec.encoder.EncodeAll(p, e.compressed[:0])
+		default:
+			return nil, false, errors.Errorf("pebble/record: unknown compression %d", errors.Safe(e.compression))
+		}
+		e.compressed = c
+		// Only use the compressed record if it saves at least 12.5%.
+		if len(c) < len(p)-len(p)/8 {
+			body = c
+			compression = e.compression
+		}
+	}
+	if e.transform == nil {
+		if compression == NoCompression {
+			return p, false, nil
+		}
+		e.encoded = append(append(e.encoded[:0], byte(compression)), body...)
+		return e.encoded, true, nil
+	}
+	e.encoded, err = e.transform.Encode(append(e.encoded[:0], byte(compression)|transformFlagEncoded), body)
+	if err != nil {
+		return nil, false, err
+	}
+	return e.encoded, true, nil
+}
+
+// decodeRecord appends the original of the transformed record payload p to
+// dst, using scratch as a temporary buffer. It returns the result and the
+// scratch buffer, which may have grown.
+func decodeRecord(
+	dst, scratch, p []byte, t Transform,
+) (decoded []byte, newScratch []byte, err error) {
+	if len(p) == 0 || p[0]&^transformFlagsMask != 0 {
+		return nil, scratch, base.CorruptionErrorf("pebble/record: invalid transformed record")
+	}
+	flags, body := p[0], p[1:]
+	if flags&transformFlagEncoded != 0 {
+		if t == nil {
+			return nil, scratch, ErrNoTransform
+		}
+		scratch, err = t.Decode(scratch[:0], body)
+		if err != nil {
+			return nil, scratch, base.CorruptionErrorf("pebble/record: decoding record: %v", err)
+		}
+		body = scratch
+	}
+	switch Compression(flags & transformCompressionMask) {
+	case NoCompression:
+		return append(dst, body...), scratch, nil
+	case SnappyCompression:
+		n, err := snappy.DecodedLen(body)
+		if err != nil {
+			return nil, scratch, base.CorruptionErrorf("pebble/record: decompressing record: %v", err)
+		}
+		if cap(dst)-len(dst) < n {
+			dst = append(make([]byte, 0, len(dst)+n), dst...)
+		}
+		d, err := snappy.Decode(dst[len(dst):len(dst)+n], body)
+		if err != nil {
+			return nil, scratch, base.CorruptionErrorf("pebble/record: decompressing record: %v", err)
+		}
+		return dst[:len(dst)+len(d)], scratch, nil
+	case ZstdCompression:
+		initZstdCodec()
+		dst, err = zstdCodec.decoder.DecodeAll(body, dst)
+		if err != nil {
+			return nil, scratch, base.CorruptionErrorf("pebble/record: decompressing record: %v", err)
+		}
+		return dst, scratch, nil
+	default:
+		return nil, scratch, base.CorruptionErrorf("pebble/record: unknown record compression %d",
+			errors.Safe(flags&transformCompressionMask))
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package record
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/crc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/rand"
+)
+
+// xorTransform is a Transform for testing, which XORs records with a key and
+// prefixes them with a marker, so that Decode can detect a foreign record.
+type xorTransform byte
+
+const xorMarker = "xor:"
+
+func (x xorTransform) Encode(dst, src []byte) ([]byte, error) {
+	dst = append(dst, xorMarker...)
+	for _, b := range src {
+		dst = append(dst, b^byte(x))
+	}
+	return dst, nil
+}
+
+func (x xorTransform) Decode(dst, src []byte) ([]byte, error) {
+	if !bytes.HasPrefix(src, []byte(xorMarker)) {
+		return nil, errors.New("missing marker")
+	}
+	for _, b := range src[len(xorMarker):] {
+		dst = append(dst, b^byte(x))
+	}
+	return dst, nil
+}
+
+// chunkTypes returns the types of the chunks of a log written by a
+// LogWriter.
+func chunkTypes(log []byte) map[byte]int {
+	types := make(map[byte]int)
+	for block := 0; block < len(log); block += blockSize {
+		b := log[block:]
+		if len(b) > blockSize {
+			b = b[:blockSize]
+		}
+		for i := 0; i+recyclableHeaderSize <= len(b); {
+			length := int(b[i+4]) | int(b[i+5])<<8
+			if length == 0 && b[i+6] == 0 {
+				break
+			}
+			types[b[i+6]]++
+			i += recyclableHeaderSize + length
+		}
+	}
+	return types
+}
+
+func TestTransformedRecords(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	compressible := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abcd"[rng.Intn(4)]
+		}
+		return b
+	}
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		_, _ = rng.Read(b)
+		return b
+	}
+	records := [][]byte{
+		[]byte("small"),
+		{},
+		compressible(1000),
+		random(1000),
+		compressible(100 << 10), // spans several blocks
+		random(70 << 10),
+		[]byte("final"),
+	}
+
+	for _, compression := range []Compression{NoCompression, SnappyCompression, ZstdCompression} {
+		for _, transform := range []Transform{nil, xorTransform(0x5a)} {
+			t.Run(fmt.Sprintf("%s/transform=%t", compression, transform != nil), func(t *testing.T) {
+				var buf bytes.Buffer
+				w := NewLogWriter(&buf, base.FileNum(7), LogWriterConfig{
+					WALFsyncLatency: prometheus.NewHistogram(prometheus.HistogramOpts{}),
+					Compression:     compression,
+					Transform:       transform,
+				})
+				for _, rec := range records {
+					_, err := w.WriteRecord(rec)
+					require.NoError(t, err)
+				}
+				require.NoError(t, w.Close())
+				log := buf.Bytes()
+
+				types := chunkTypes(log)
+				var transformedChunks int
+				for typ := byte(transformedFullChunkType); typ <= transformedLastChunkType; typ++ {
+					transformedChunks += types[typ]
+				}
+				switch {
+				case transform != nil:
+					// Every record is transformed, and no plaintext remains.
+					// The only untransformed chunk is the EOF trailer.
+					require.Equal(t, 1, types[recyclableFullChunkType])
+					require.Zero(t, types[recyclableFirstChunkType])
+					require.False(t, bytes.Contains(log, []byte("final")))
+				case compression == NoCompression:
+					require.Zero(t, transformedChunks)
+				default:
+					// Only the compressible records are transformed, and they
+					// take less space.
+					require.NotZero(t, transformedChunks)
+					require.True(t, bytes.Contains(log, []byte("final")))
+					var rawSize int
+					for _, rec := range records {
+						rawSize += len(rec)
+					}
+					require.Less(t, len(log), rawSize)
+				}
+
+				r := NewReader(bytes.NewReader(log), base.FileNum(7))
+				r.SetTransform(transform)
+				for i, rec := range records {
+					rr, err := r.Next()
+					require.NoError(t, err, "record %d", i)
+					got, err := io.ReadAll(rr)
+					require.NoError(t, err, "record %d", i)
+					require.True(t, bytes.Equal(rec, got), "record %d", i)
+				}
+				_, err := r.Next()
+				require.Equal(t, io.EOF, err)
+
+				if transform != nil {
+					// A reader without the transform can't read the records.
+					r := NewReader(bytes.NewReader(log), base.FileNum(7))
+					_, err := r.Next()
+					require.ErrorIs(t, err, ErrNoTransform)
+
+					// Nor can a reader with a different transform.
+					r = NewReader(bytes.NewReader(log), base.FileNum(7))
+					r.SetTransform(badTransform{})
+					_, err = r.Next()
+					require.True(t, errors.Is(err, base.ErrCorruption), "%v", err)
+				}
+			})
+		}
+	}
+}
+
+type badTransform struct{}
+
+func (badTransform) Encode(dst, src []byte) ([]byte, error) { return append(dst, src...), nil }
+func (badTransform) Decode(dst, src []byte) ([]byte, error) {
+	return nil, errors.New("authentication failed")
+}
+
+func TestTransformedChunksOfRecordAgree(t *testing.T) {
+	// A record whose first chunk is transformed, but whose last chunk isn't,
+	// is invalid.
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf, base.FileNum(1), LogWriterConfig{
+		WALFsyncLatency: prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		Transform:       xorTransform(1),
+	})
+	_, err := w.WriteRecord(make([]byte, blockSize))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	log := buf.Bytes()
+
+	// Rewrite the type of the last chunk, at the start of the second block,
+	// and its checksum.
+	require.Equal(t, byte(transformedLastChunkType), log[blockSize+6])
+	log[blockSize+6] = recyclableLastChunkType
+	length := int(log[blockSize+4]) | int(log[blockSize+5])<<8
+	end := blockSize + recyclableHeaderSize + length
+	crc := crc.New(log[blockSize+6 : end]).Value()
+	log[blockSize+0], log[blockSize+1], log[blockSize+2], log[blockSize+3] =
+		byte(crc), byte(crc>>8), byte(crc>>16), byte(crc>>24)
+
+	r := NewReader(bytes.NewReader(log), base.FileNum(1))
+	r.SetTransform(xorTransform(1))
+	_, err = r.Next()
+	require.Equal(t, ErrInvalidChunk, err)
+}
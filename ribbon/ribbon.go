@@ -0,0 +1,294 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package ribbon implements Ribbon filters, a space efficient alternative to
+// Bloom filters.
+//
+// A Ribbon filter stores, for a set of n keys, a solution to a system of
+// linear equations over GF(2): each key's hash determines a 64-bit wide band
+// of coefficients starting at some column, and an r-bit result. A lookup
+// recomputes the key's equation and checks that the stored solution
+// satisfies it. Keys that were not added satisfy the equation with
+// probability 2^-r. A Ribbon filter uses ~1.07*r bits per key for a 2^-r false
+// positive rate, whereas a Bloom filter requires ~1.44*r bits per key.
+// Building a Ribbon filter is more expensive than building a Bloom filter,
+// which makes them most suitable for the large, long-lived tables in the
+// bottommost levels.
+//
+// See "Ribbon filter: practically smaller than Bloom and Xor", Dillinger and
+// Walzer, https://arxiv.org/abs/2103.02515.
+package ribbon
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// The filter format is the solution, stored as r bit-sliced planes of
+// numWords(numSlots) little-endian words each, followed by a trailer:
+//
+//	plane 0 ... plane r-1 | numSlots (4 bytes, little-endian) | r | seed
+const (
+	trailerLen = 6
+	// maxResultBits is the maximum number of fingerprint bits per key.
+	maxResultBits = 32
+	// maxSeeds is the number of hash seeds tried before the number of slots is
+	// increased.
+	maxSeeds = 4
+)
+
+// numWords returns the number of words in each of the solution's planes. The
+// trailing word allows reading 64 bits at any slot without bounds checks.
+func numWords(numSlots int) int {
+	return (numSlots+63)/64 + 1
+}
+
+// numSlotsForKeys returns the initial number of slots used for a filter of n
+// keys.
+func numSlotsForKeys(n int) int {
+	return n + n/16 + 64
+}
+
+// mix is the splitmix64 finalizer.
+func mix(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// equation returns the starting slot, the coefficients and the result of the
+// equation for the key hash h.
+func equation(h uint64, seed uint8, numSlots int, r uint8) (start int, coeff, result uint64) {
+	a := mix(h + uint64(seed)*0x9e3779b97f4a7c15)
+	numStarts := uint64(numSlots - 63)
+	start = int(((a >> 32) * numStarts) >> 32)
+	b := mix(a)
+	coeff = b | 1
+	result = mix(b) & (1<<r - 1)
+	return start, coeff, result
+}
+
+// get64 returns the 64 bits of the plane starting at slot i.
+func get64(plane []byte, i int) uint64 {
+	w, off := i/64, uint(i%64)
+	v := binary.LittleEndian.Uint64(plane[8*w:]) >> off
+	if off > 0 {
+		v |= binary.LittleEndian.Uint64(plane[8*w+8:]) << (64 - off)
+	}
+	return v
+}
+
+type filter []byte
+
+func (f filter) MayContain(key []byte) bool {
+	if len(f) < trailerLen {
+		return false
+	}
+	n := len(f) - trailerLen
+	numSlots := int(binary.LittleEndian.Uint32(f[n:]))
+	r, seed := f[n+4], f[n+5]
+	if numSlots < 64 || r == 0 || r > maxResultBits || n != int(r)*8*numWords(numSlots) {
+		return false
+	}
+	start, coeff, result := equation(xxhash.Sum64(key), seed, numSlots, r)
+	planeLen := 8 * numWords(numSlots)
+	for k := 0; k < int(r); k++ {
+		plane := f[k*planeLen : (k+1)*planeLen]
+		if uint64(bits.OnesCount64(coeff&get64(plane, start))&1) != (result>>k)&1 {
+			return false
+		}
+	}
+	return true
+}
+
+// banding holds the system of equations being solved, in echelon form: row i,
+// if non-empty, has its leading coefficient at column i.
+type banding struct {
+	coeffs  []uint64
+	results []uint64
+}
+
+func (b *banding) reset(numSlots int) {
+	if cap(b.coeffs) < numSlots {
+		b.coeffs = make([]uint64, numSlots)
+		b.results = make([]uint64, numSlots)
+		return
+	}
+	b.coeffs = b.coeffs[:numSlots]
+	b.results = b.results[:numSlots]
+	for i := range b.coeffs {
+		b.coeffs[i] = 0
+		b.results[i] = 0
+	}
+}
+
+// add adds an equation, returning false if it is inconsistent with the
+// equations added so far.
+func (b *banding) add(start int, coeff, result uint64) bool {
+	for {
+		if b.coeffs[start] == 0 {
+			b.coeffs[start] = coeff
+			b.results[start] = result
+			return true
+		}
+		coeff ^= b.coeffs[start]
+		result ^= b.results[start]
+		if coeff == 0 {
+			// The equation is a linear combination of existing equations (such
+			// as a duplicate key). It's consistent if the results agree.
+			return result == 0
+		}
+		tz := bits.TrailingZeros64(coeff)
+		start += tz
+		coeff >>= uint(tz)
+	}
+}
+
+type filterWriter struct {
+	r       uint8
+	hashes  []uint64
+	banding banding
+}
+
+// AddKey implements the base.FilterWriter interface.
+func (w *filterWriter) AddKey(key []byte) {
+	h := xxhash.Sum64(key)
+	if n := len(w.hashes); n > 0 && w.hashes[n-1] == h {
+		return
+	}
+	w.hashes = append(w.hashes, h)
+}
+
+// build bands the hashes, returning the number of slots and the seed of a
+// solvable system of equations.
+func (w *filterWriter) build() (numSlots int, seed uint8) {
+	numSlots = numSlotsForKeys(len(w.hashes))
+	for {
+		for seed = 0; seed < maxSeeds; seed++ {
+			w.banding.reset(numSlots)
+			ok := true
+			for _, h := range w.hashes {
+				if !w.banding.add(equation(h, seed, numSlots, w.r)) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				return numSlots, seed
+			}
+		}
+		numSlots += numSlots/32 + 64
+	}
+}
+
+// Finish implements the base.FilterWriter interface.
+func (w *filterWriter) Finish(buf []byte) []byte {
+	numSlots, seed := w.build()
+	planeLen := 8 * numWords(numSlots)
+	n := int(w.r) * planeLen
+	buf, f := extend(buf, n+trailerLen)
+
+	// Back substitution, from the last slot to the first. Empty rows are
+	// unconstrained, and are left as zeroes.
+	for i := numSlots - 1; i >= 0; i-- {
+		coeff := w.banding.coeffs[i]
+		if coeff == 0 {
+			continue
+		}
+		result := w.banding.results[i]
+		for k := 0; k < int(w.r); k++ {
+			plane := f[k*planeLen : (k+1)*planeLen]
+			z := (result >> k) & 1
+			z ^= uint64(bits.OnesCount64(coeff&get64(plane, i)) & 1)
+			if z != 0 {
+				plane[i/8] |= 1 << uint(i%8)
+			}
+		}
+	}
+	binary.LittleEndian.PutUint32(f[n:], uint32(numSlots))
+	f[n+4] = w.r
+	f[n+5] = seed
+	w.hashes = w.hashes[:0]
+	return buf
+}
+
+// extend appends n zero bytes to b. It returns the overall slice (of length
+// n+len(originalB)) and the slice of n trailing zeroes.
+func extend(b []byte, n int) (overall, trailer []byte) {
+	want := n + len(b)
+	if want <= cap(b) {
+		overall = b[:want]
+		trailer = overall[len(b):]
+		for i := range trailer {
+			trailer[i] = 0
+		}
+	} else {
+		// Grow the capacity exponentially, with a 1KiB minimum.
+		c := 1024
+		for c < want {
+			c += c / 4
+		}
+		overall = make([]byte, want, c)
+		trailer = overall[len(b):]
+		copy(overall, b)
+	}
+	return overall, trailer
+}
+
+// FilterPolicy implements the FilterPolicy interface from the pebble package.
+//
+// The integer value is the number of fingerprint bits per key, r. A filter's
+// false positive rate is ~2^-r, and it uses ~1.07*r bits per key. A value of 7
+// yields a filter with a ~0.8% false positive rate at ~7.5 bits per key.
+type FilterPolicy int
+
+var _ base.TunableFilterPolicy = FilterPolicy(0)
+
+// Name implements the pebble.FilterPolicy interface.
+func (p FilterPolicy) Name() string {
+	return "pebble.RibbonFilter"
+}
+
+// MayContain implements the pebble.FilterPolicy interface.
+func (p FilterPolicy) MayContain(ftype base.FilterType, f, key []byte) bool {
+	switch ftype {
+	case base.TableFilter:
+		return filter(f).MayContain(key)
+	default:
+		panic(fmt.Sprintf("unknown filter type: %v", ftype))
+	}
+}
+
+// NewWriter implements the pebble.FilterPolicy interface.
+func (p FilterPolicy) NewWriter(ftype base.FilterType) base.FilterWriter {
+	switch ftype {
+	case base.TableFilter:
+		r := int(p)
+		if r < 1 {
+			r = 1
+		} else if r > maxResultBits {
+			r = maxResultBits
+		}
+		return &filterWriter{r: uint8(r)}
+	default:
+		panic(fmt.Sprintf("unknown filter type: %v", ftype))
+	}
+}
+
+// WithFalsePositiveRate implements the pebble.TunableFilterPolicy interface.
+func (p FilterPolicy) WithFalsePositiveRate(rate float64) base.FilterPolicy {
+	if rate <= 0 || rate >= 1 {
+		return p
+	}
+	r := math.Ceil(-math.Log2(rate))
+	return FilterPolicy(math.Min(math.Max(r, 1), maxResultBits))
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package ribbon
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/stretchr/testify/require"
+)
+
+func key(i int) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(i))
+	return b[:]
+}
+
+func TestFilter(t *testing.T) {
+	for _, r := range []int{1, 7, 10} {
+		for _, n := range []int{0, 1, 10, 100, 1000, 100000} {
+			t.Run(fmt.Sprintf("r=%d/n=%d", r, n), func(t *testing.T) {
+				p := FilterPolicy(r)
+				w := p.NewWriter(base.TableFilter)
+				for i := 0; i < n; i++ {
+					w.AddKey(key(i))
+				}
+				f := w.Finish(nil)
+
+				// All added keys must match.
+				for i := 0; i < n; i++ {
+					require.True(t, p.MayContain(base.TableFilter, f, key(i)), "key %d", i)
+				}
+				if n < 1000 {
+					return
+				}
+				if n >= 100000 {
+					bitsPerKey := float64(8*len(f)) / float64(n)
+					require.Less(t, bitsPerKey, 1.1*float64(r))
+				}
+
+				// Check the false positive rate.
+				const probes = 100000
+				nFalsePositive := 0
+				for i := 0; i < probes; i++ {
+					if p.MayContain(base.TableFilter, f, key(1e12+i)) {
+						nFalsePositive++
+					}
+				}
+				rate := float64(nFalsePositive) / probes
+				require.Less(t, rate, 1.5*math.Pow(2, -float64(r))+0.0005)
+			})
+		}
+	}
+}
+
+func TestFilterDuplicateKeys(t *testing.T) {
+	p := FilterPolicy(8)
+	w := p.NewWriter(base.TableFilter)
+	for i := 0; i < 1000; i++ {
+		w.AddKey(key(i % 100))
+	}
+	f := w.Finish(nil)
+	for i := 0; i < 100; i++ {
+		require.True(t, p.MayContain(base.TableFilter, f, key(i)))
+	}
+}
+
+func TestFilterMalformed(t *testing.T) {
+	p := FilterPolicy(8)
+	require.False(t, p.MayContain(base.TableFilter, nil, key(0)))
+	require.False(t, p.MayContain(base.TableFilter, make([]byte, 100), key(0)))
+}
+
+func TestWithFalsePositiveRate(t *testing.T) {
+	require.Equal(t, FilterPolicy(7), FilterPolicy(10).WithFalsePositiveRate(0.01))
+	require.Equal(t, FilterPolicy(10), FilterPolicy(1).WithFalsePositiveRate(0.001))
+	require.Equal(t, FilterPolicy(5), FilterPolicy(5).WithFalsePositiveRate(0))
+}
+
+func BenchmarkFilterWriter(b *testing.B) {
+	keys := make([][]byte, 1024)
+	for i := range keys {
+		keys[i] = key(i)
+	}
+	w := FilterPolicy(7).NewWriter(base.TableFilter)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, k := range keys {
+			w.AddKey(k)
+		}
+		w.Finish(nil)
+	}
+}
+
+func BenchmarkFilterMayContain(b *testing.B) {
+	p := FilterPolicy(7)
+	w := p.NewWriter(base.TableFilter)
+	for i := 0; i < 10000; i++ {
+		w.AddKey(key(i))
+	}
+	f := w.Finish(nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.MayContain(base.TableFilter, f, key(i))
+	}
+}
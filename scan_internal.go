@@ -224,6 +224,19 @@ func (p *pointCollapsingIterator) SeekLT(
 	return p.findPrevEntry()
 }
 
+// SeekPrefixLT implements the InternalIterator interface.
+func (p *pointCollapsingIterator) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	p.resetKey()
+	p.iterKey, p.iterValue = p.iter.SeekPrefixLT(prefix, key, flags)
+	p.pos = pcIterPosCur
+	if p.iterKey == nil {
+		return nil, base.LazyValue{}
+	}
+	return p.findPrevEntry()
+}
+
 func (p *pointCollapsingIterator) resetKey() {
 	p.savedKey.UserKey = p.savedKeyBuf[:0]
 	p.savedKey.Trailer = 0
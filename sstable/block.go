@@ -914,6 +914,15 @@ func (i *blockIter) SeekLT(key []byte, flags base.SeekLTFlags) (*InternalKey, ba
 	return &i.ikey, i.lazyValue
 }
 
+// SeekPrefixLT implements internalIterator.SeekPrefixLT, as documented in the
+// pebble package.
+func (i *blockIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	// This should never be called as prefix iteration is handled by sstable.Iterator.
+	panic("pebble: SeekPrefixLT unimplemented")
+}
+
 // First implements internalIterator.First, as documented in the pebble
 // package.
 func (i *blockIter) First() (*InternalKey, base.LazyValue) {
@@ -142,6 +142,22 @@ type SuffixReplaceableBlockCollector interface {
 	UpdateKeySuffixes(oldProp []byte, oldSuffix, newSuffix []byte) error
 }
 
+// ValueBlockPropertyCollector is an extension to the BlockPropertyCollector
+// interface that allows a block property collector to indicate that its
+// properties are a function of point keys' values. Such collectors are always
+// passed the values of point keys, including in table formats that store a
+// value prefix with each key (see the discussion of value separation above) and
+// that otherwise pass nil values to block property collectors.
+//
+// A collector implementing this interface is incompatible with a Pebble DB in
+// which compactions do not read values.
+type ValueBlockPropertyCollector interface {
+	BlockPropertyCollector
+	// RequiresValues returns true if the collector must be passed the values
+	// of point keys.
+	RequiresValues() bool
+}
+
 // BlockPropertyFilter is used in an Iterator to filter sstables and blocks
 // within the sstable. It should not maintain any per-sstable state, and must
 // be thread-safe.
@@ -5,14 +5,76 @@
 package sstable
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
+	"sync"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/golang/snappy"
+	"github.com/pierrec/lz4/v4"
 )
 
+const (
+	// zstdDefaultLevel is the zstd compression level used when a level is not
+	// configured.
+	zstdDefaultLevel = 3
+	// zstdMaxLevel is the maximum zstd compression level.
+	zstdMaxLevel = 22
+	// lz4MaxLevel is the maximum LZ4 compression level.
+	lz4MaxLevel = 9
+)
+
+// lz4Compressors pools the LZ4 compressors used at the default compression
+// level, which each hold a large hash table.
+var lz4Compressors = sync.Pool{
+	New: func() interface{} { return new(lz4.Compressor) },
+}
+
+// encodeLZ4 compresses b with the LZ4 block format. The default level uses
+// LZ4's fast compressor, and levels 1 through 9 use its high compression
+// compressor with an increasing search depth. It reuses the preallocated
+// capacity of compressedBuf if it is sufficient. The subslice
+// `compressedBuf[:varIntLen]` should already encode the length of `b`. It
+// returns the encoded byte slice, including the `compressedBuf[:varIntLen]`
+// prefix, or nil if b is incompressible.
+func encodeLZ4(compressedBuf []byte, varIntLen int, b []byte, level int) []byte {
+	n := varIntLen + lz4.CompressBlockBound(len(b))
+	if cap(compressedBuf) < n {
+		compressedBuf = append(compressedBuf[:varIntLen], make([]byte, n-varIntLen)...)
+	}
+	compressedBuf = compressedBuf[:n]
+	var size int
+	var err error
+	if level <= 0 {
+		c := lz4Compressors.Get().(*lz4.Compressor)
+		size, err = c.CompressBlock(b, compressedBuf[varIntLen:])
+		lz4Compressors.Put(c)
+	} else {
+		if level > lz4MaxLevel {
+			level = lz4MaxLevel
+		}
+		c := lz4.CompressorHC{Level: lz4.Level1 << (level - 1)}
+		size, err = c.CompressBlock(b, compressedBuf[varIntLen:])
+	}
+	if err != nil || size == 0 {
+		return nil
+	}
+	return compressedBuf[:varIntLen+size]
+}
+
+// decodeLZ4 decompresses b with the LZ4 block format. The decodedBuf must be
+// exactly the length of the decompressed block.
+func decodeLZ4(decodedBuf, b []byte) ([]byte, error) {
+	n, err := lz4.UncompressBlock(b, decodedBuf)
+	if err != nil {
+		return nil, err
+	}
+	return decodedBuf[:n], nil
+}
+
 func decompressedLen(blockType blockType, b []byte) (int, int, error) {
 	switch blockType {
 	case noCompressionBlockType:
@@ -20,9 +82,10 @@ func decompressedLen(blockType blockType, b []byte) (int, int, error) {
 	case snappyCompressionBlockType:
 		l, err := snappy.DecodedLen(b)
 		return l, 0, err
-	case zstdCompressionBlockType:
-		// This will also be used by zlib, bzip2 and lz4 to retrieve the decodedLen
-		// if we implement these algorithms in the future.
+	case lz4CompressionBlockType, lz4hcCompressionBlockType,
+		zstdCompressionBlockType, zstdDictCompressionBlockType:
+		// This will also be used by zlib and bzip2 to retrieve the decodedLen if
+		// we implement these algorithms in the future.
 		decodedLenU64, varIntLen := binary.Uvarint(b)
 		if varIntLen <= 0 {
 			return 0, 0, base.CorruptionErrorf("pebble/table: compression block has invalid length")
@@ -33,14 +96,26 @@ func decompressedLen(blockType blockType, b []byte) (int, int, error) {
 	}
 }
 
-func decompressInto(blockType blockType, compressed []byte, buf []byte) ([]byte, error) {
+// decompressInto decompresses compressed into buf. The dict is the table's
+// zstd dictionary, and is only required for blocks of type
+// zstdDictCompressionBlockType.
+func decompressInto(
+	blockType blockType, compressed []byte, buf []byte, dict *zstdDict,
+) ([]byte, error) {
 	var result []byte
 	var err error
 	switch blockType {
 	case snappyCompressionBlockType:
 		result, err = snappy.Decode(buf, compressed)
+	case lz4CompressionBlockType, lz4hcCompressionBlockType:
+		result, err = decodeLZ4(buf, compressed)
 	case zstdCompressionBlockType:
 		result, err = decodeZstd(buf, compressed)
+	case zstdDictCompressionBlockType:
+		if dict == nil {
+			return nil, base.CorruptionErrorf("pebble/table: zstd dictionary block without a dictionary")
+		}
+		result, err = dict.decode(buf, compressed)
 	}
 	if err != nil {
 		return nil, base.MarkCorruptionError(err)
@@ -53,7 +128,10 @@ func decompressInto(blockType blockType, compressed []byte, buf []byte) ([]byte,
 }
 
 // decompressBlock decompresses an SST block, with space allocated from a cache.
-func decompressBlock(cache *cache.Cache, blockType blockType, b []byte) (*cache.Value, error) {
+// The dict is the table's zstd dictionary, if any.
+func decompressBlock(
+	cache *cache.Cache, blockType blockType, b []byte, dict *zstdDict,
+) (*cache.Value, error) {
 	if blockType == noCompressionBlockType {
 		return nil, nil
 	}
@@ -68,18 +146,25 @@ func decompressBlock(cache *cache.Cache, blockType blockType, b []byte) (*cache.
 	// Allocate sufficient space from the cache.
 	decoded := cache.Alloc(decodedLen)
 	decodedBuf := decoded.Buf()
-	if _, err := decompressInto(blockType, b, decodedBuf); err != nil {
+	if _, err := decompressInto(blockType, b, decodedBuf, dict); err != nil {
 		cache.Free(decoded)
+		return nil, err
 	}
 	return decoded, nil
 }
 
 // compressBlock compresses an SST block, using compressBuf as the desired destination.
+// The level is the compression level, where zero is the algorithm's default.
+// The dict is the table's zstd dictionary. ZstdDictionaryCompression compresses
+// the block against the dictionary if one is provided, and otherwise falls back
+// to ZstdCompression.
 func compressBlock(
-	compression Compression, b []byte, compressedBuf []byte,
+	compression Compression, level int, b []byte, compressedBuf []byte, dict *zstdDict,
 ) (blockType blockType, compressed []byte) {
 	switch compression {
-	case SnappyCompression:
+	case SnappyCompression, AdaptiveCompression:
+		// Blocks other than data and value blocks, which aren't compressed
+		// adaptively, are compressed with snappy under AdaptiveCompression.
 		return snappyCompressionBlockType, snappy.Encode(compressedBuf, b)
 	case NoCompression:
 		return noCompressionBlockType, b
@@ -89,10 +174,147 @@ func compressBlock(
 		compressedBuf = append(compressedBuf, make([]byte, binary.MaxVarintLen64-len(compressedBuf))...)
 	}
 	varIntLen := binary.PutUvarint(compressedBuf, uint64(len(b)))
+	if level > zstdMaxLevel {
+		level = zstdMaxLevel
+	}
 	switch compression {
 	case ZstdCompression:
-		return zstdCompressionBlockType, encodeZstd(compressedBuf, varIntLen, b)
+		return zstdCompressionBlockType, encodeZstd(compressedBuf, varIntLen, b, level)
+	case ZstdDictionaryCompression:
+		if dict != nil {
+			return zstdDictCompressionBlockType, dict.encode(compressedBuf, varIntLen, b, level)
+		}
+		return zstdCompressionBlockType, encodeZstd(compressedBuf, varIntLen, b, level)
+	case LZ4Compression:
+		// Blocks compressed with LZ4's high compression compressor use the same
+		// format, but are distinguished by their block type as in RocksDB.
+		blockType := lz4CompressionBlockType
+		if level > 0 {
+			blockType = lz4hcCompressionBlockType
+		}
+		if compressed := encodeLZ4(compressedBuf, varIntLen, b, level); compressed != nil {
+			return blockType, compressed
+		}
+		return noCompressionBlockType, b
+	default:
+		return noCompressionBlockType, b
+	}
+}
+
+// compressionPaysOff returns true if compressing a block of uncompressedLen
+// bytes to compressedLen bytes improves its size by at least 12.5%. Blocks
+// whose compression doesn't pay off are stored uncompressed.
+func compressionPaysOff(uncompressedLen, compressedLen int) bool {
+	return compressedLen < uncompressedLen-uncompressedLen/8
+}
+
+// UncompressedReason describes why a block was stored uncompressed.
+type UncompressedReason int
+
+const (
+	// UncompressedDisabled indicates compression was disabled by
+	// NoCompression.
+	UncompressedDisabled UncompressedReason = iota
+	// UncompressedInsufficientSavings indicates the block was compressed, but
+	// the compressed block was discarded because it wasn't sufficiently
+	// smaller than the uncompressed block.
+	UncompressedInsufficientSavings
+	// UncompressedSkipped indicates AdaptiveCompression skipped compressing the
+	// block, because compressing the preceding blocks didn't pay off.
+	UncompressedSkipped
+	// NumUncompressedReasons is the number of UncompressedReasons.
+	NumUncompressedReasons
+)
+
+func (r UncompressedReason) String() string {
+	switch r {
+	case UncompressedDisabled:
+		return "disabled"
+	case UncompressedInsufficientSavings:
+		return "insufficient-savings"
+	case UncompressedSkipped:
+		return "skipped"
 	default:
+		return "unknown"
+	}
+}
+
+// CompressionStats holds statistics about the compression of a table's data
+// and value blocks.
+type CompressionStats struct {
+	// CompressedBlocks is the number of blocks stored compressed, indexed by
+	// the Compression algorithm they were compressed with.
+	CompressedBlocks [NCompression]int
+	// UncompressedBlocks is the number of blocks stored uncompressed, indexed
+	// by the reason.
+	UncompressedBlocks [NumUncompressedReasons]int
+}
+
+func (s *CompressionStats) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("compressed:")
+	for c := range s.CompressedBlocks {
+		if n := s.CompressedBlocks[c]; n > 0 {
+			fmt.Fprintf(&buf, " %s=%d", Compression(c), n)
+		}
+	}
+	buf.WriteString(" uncompressed:")
+	for r := range s.UncompressedBlocks {
+		if n := s.UncompressedBlocks[r]; n > 0 {
+			fmt.Fprintf(&buf, " %s=%d", UncompressedReason(r), n)
+		}
+	}
+	return buf.String()
+}
+
+// blockCompressor compresses the data or value blocks of a table, recording
+// the outcome in the table's CompressionStats.
+type blockCompressor struct {
+	compression Compression
+	level       int
+	// zstdDict samples blocks and provides the table's zstd dictionary, if
+	// any.
+	zstdDict *zstdDictTrainer
+	// adaptive is non-nil if compression is AdaptiveCompression.
+	adaptive *adaptiveCompressor
+	stats    *CompressionStats
+}
+
+// compress compresses the block b, using *compressedBuf as the desired
+// destination, and retaining any growth of the buffer. It returns
+// noCompressionBlockType and b if the block is stored uncompressed.
+func (c *blockCompressor) compress(b []byte, compressedBuf *[]byte) (blockType, []byte) {
+	if c.compression == NoCompression {
+		c.stats.UncompressedBlocks[UncompressedDisabled]++
+		return noCompressionBlockType, b
+	}
+	c.zstdDict.add(b)
+	compression := c.compression
+	var typ blockType
+	var compressed []byte
+	if c.adaptive != nil {
+		compression, typ, compressed = c.adaptive.compress(b, c.level, (*compressedBuf)[:cap(*compressedBuf)])
+		if compression == NoCompression {
+			c.stats.UncompressedBlocks[UncompressedSkipped]++
+			return noCompressionBlockType, b
+		}
+	} else {
+		typ, compressed = compressBlock(compression, c.level, b,
+			(*compressedBuf)[:cap(*compressedBuf)], c.zstdDict.dictionary())
+	}
+	if typ == noCompressionBlockType {
+		// Incompressible blocks may be returned uncompressed, and must not
+		// alias the compressed buffer.
+		c.stats.UncompressedBlocks[UncompressedInsufficientSavings]++
+		return noCompressionBlockType, b
+	}
+	if cap(compressed) > cap(*compressedBuf) {
+		*compressedBuf = compressed[:cap(compressed)]
+	}
+	if !compressionPaysOff(len(b), len(compressed)) {
+		c.stats.UncompressedBlocks[UncompressedInsufficientSavings]++
 		return noCompressionBlockType, b
 	}
+	c.stats.CompressedBlocks[compression]++
+	return typ, compressed
 }
@@ -0,0 +1,133 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import "time"
+
+// Adaptive compression
+//
+// With AdaptiveCompression, the Writer decides per block whether and how to
+// compress a table's data and value blocks, tracking the data blocks and value
+// blocks separately since their contents often compress differently.
+//
+// Compressing incompressible data, such as already compressed or encrypted
+// values, wastes CPU only for the compressed block to be discarded. When a
+// block's compression doesn't pay off, the Writer skips compressing the
+// following blocks, doubling the number of skipped blocks each time
+// compression continues not to pay off, up to adaptiveMaxSkippedBlocks. The
+// blocks of a table that's incompressible throughout are therefore mostly
+// written uncompressed without having been compressed, while sampling just
+// enough blocks to notice if the table's data becomes compressible.
+//
+// Blocks are compressed with snappy by default. If configured with a zstd CPU
+// budget, every adaptiveSampleInterval'th compressed block is compressed with
+// both snappy and zstd, measuring the size of each and the time each takes.
+// The Writer compresses subsequent blocks with zstd if the additional time
+// zstd took per KB of compressed size saved is within the budget, smoothing
+// over the recent samples.
+
+const (
+	// adaptiveMaxSkippedBlocks is the maximum number of consecutive blocks
+	// left uncompressed without sampling their compressibility.
+	adaptiveMaxSkippedBlocks = 64
+	// adaptiveSampleInterval is the number of compressed blocks between
+	// samples comparing snappy and zstd.
+	adaptiveSampleInterval = 16
+)
+
+// adaptiveCompressor implements AdaptiveCompression for a sequence of blocks.
+type adaptiveCompressor struct {
+	// zstdBudget is the additional CPU time that may be spent compressing with
+	// zstd instead of snappy, per KB of compressed size saved. Zero disables
+	// zstd.
+	zstdBudget time.Duration
+	// compression is the algorithm blocks are compressed with until the next
+	// sample, either SnappyCompression or ZstdCompression.
+	compression Compression
+	// skip is the number of blocks to leave uncompressed before compressing
+	// the next block, and skipBackoff is the number of blocks skipped after
+	// compression last failed to pay off.
+	skip, skipBackoff int
+	// sinceSample is the number of blocks compressed since the last sample.
+	sinceSample int
+	// savedBytes and extraCPU are the exponentially decaying sums of the
+	// compressed size saved, and additional time spent, by compressing sampled
+	// blocks with zstd instead of snappy.
+	savedBytes int64
+	extraCPU   time.Duration
+	// sampleBuf holds the result of the compression that's not chosen while
+	// sampling.
+	sampleBuf []byte
+}
+
+func newAdaptiveCompressor(zstdBudget time.Duration) *adaptiveCompressor {
+	return &adaptiveCompressor{
+		zstdBudget:  zstdBudget,
+		compression: SnappyCompression,
+	}
+}
+
+// compress compresses the block b at the provided zstd level, using
+// compressedBuf as the desired destination. It returns the compression used,
+// which is NoCompression if the block was skipped.
+func (a *adaptiveCompressor) compress(
+	b []byte, level int, compressedBuf []byte,
+) (Compression, blockType, []byte) {
+	if a.skip > 0 {
+		a.skip--
+		return NoCompression, noCompressionBlockType, b
+	}
+
+	compression := a.compression
+	var typ blockType
+	var compressed []byte
+	if a.zstdBudget > 0 && a.sinceSample == 0 {
+		compression, typ, compressed = a.sample(b, level, compressedBuf)
+	} else {
+		typ, compressed = compressBlock(compression, level, b, compressedBuf, nil /* dict */)
+	}
+	a.sinceSample = (a.sinceSample + 1) % adaptiveSampleInterval
+
+	if compressionPaysOff(len(b), len(compressed)) {
+		a.skipBackoff = 0
+	} else {
+		a.skipBackoff *= 2
+		if a.skipBackoff == 0 {
+			a.skipBackoff = 1
+		} else if a.skipBackoff > adaptiveMaxSkippedBlocks {
+			a.skipBackoff = adaptiveMaxSkippedBlocks
+		}
+		a.skip = a.skipBackoff
+	}
+	return compression, typ, compressed
+}
+
+// sample compresses b with both snappy and zstd, choosing the compression for
+// the block and subsequent blocks.
+func (a *adaptiveCompressor) sample(
+	b []byte, level int, compressedBuf []byte,
+) (Compression, blockType, []byte) {
+	start := time.Now()
+	snappyType, snappyCompressed := compressBlock(SnappyCompression, 0, b, a.sampleBuf, nil /* dict */)
+	snappyCPU := time.Since(start)
+	a.sampleBuf = snappyCompressed[:cap(snappyCompressed)]
+
+	start = time.Now()
+	zstdType, zstdCompressed := compressBlock(ZstdCompression, level, b, compressedBuf, nil /* dict */)
+	zstdCPU := time.Since(start)
+
+	a.savedBytes = a.savedBytes/2 + int64(len(snappyCompressed)-len(zstdCompressed))
+	a.extraCPU = a.extraCPU/2 + zstdCPU - snappyCPU
+	a.compression = SnappyCompression
+	if a.savedBytes > 0 && a.extraCPU <= time.Duration(a.savedBytes)*a.zstdBudget/1024 {
+		a.compression = ZstdCompression
+	}
+
+	if a.compression == ZstdCompression {
+		return ZstdCompression, zstdType, zstdCompressed
+	}
+	// The snappy compressed block must be returned within compressedBuf.
+	return SnappyCompression, snappyType, append(zstdCompressed[:0], snappyCompressed...)
+}
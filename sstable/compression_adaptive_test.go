@@ -0,0 +1,169 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveCompressor(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() []byte {
+		b := make([]byte, 4096)
+		rng.Read(b)
+		return b
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		a := newAdaptiveCompressor(0 /* zstdBudget */)
+		var stats CompressionStats
+		c := blockCompressor{compression: AdaptiveCompression, adaptive: a, stats: &stats}
+		var buf []byte
+		// Incompressible blocks are mostly skipped, with exponential backoff.
+		for i := 0; i < 1000; i++ {
+			typ, _ := c.compress(random(), &buf)
+			require.Equal(t, noCompressionBlockType, typ)
+		}
+		require.Zero(t, stats.UncompressedBlocks[UncompressedDisabled])
+		require.Equal(t, 1000, stats.UncompressedBlocks[UncompressedInsufficientSavings]+
+			stats.UncompressedBlocks[UncompressedSkipped])
+		require.Less(t, stats.UncompressedBlocks[UncompressedInsufficientSavings], 25)
+		require.Equal(t, adaptiveMaxSkippedBlocks, a.skipBackoff)
+
+		// Once the data becomes compressible, it's compressed within
+		// adaptiveMaxSkippedBlocks blocks.
+		for i := 0; i <= adaptiveMaxSkippedBlocks; i++ {
+			c.compress(compressibleBlock(rng, 4096), &buf)
+		}
+		require.Zero(t, a.skip)
+		require.Zero(t, a.skipBackoff)
+		for i := 0; i < 10; i++ {
+			typ, _ := c.compress(compressibleBlock(rng, 4096), &buf)
+			require.Equal(t, snappyCompressionBlockType, typ)
+		}
+		require.NotZero(t, stats.CompressedBlocks[SnappyCompression])
+		require.Zero(t, stats.CompressedBlocks[ZstdCompression])
+	})
+
+	t.Run("zstd-budget", func(t *testing.T) {
+		for _, tc := range []struct {
+			budget time.Duration
+			want   Compression
+		}{
+			// Without a budget, blocks are compressed with snappy.
+			{0, SnappyCompression},
+			// With a generous budget, zstd's better compression is worth it.
+			{time.Hour, ZstdCompression},
+		} {
+			var stats CompressionStats
+			c := blockCompressor{
+				compression: AdaptiveCompression,
+				adaptive:    newAdaptiveCompressor(tc.budget),
+				stats:       &stats,
+			}
+			var buf []byte
+			for i := 0; i < 4*adaptiveSampleInterval; i++ {
+				b := compressibleBlock(rng, 4096)
+				typ, compressed := c.compress(b, &buf)
+				require.NotEqual(t, noCompressionBlockType, typ)
+				decompressed := make([]byte, len(b))
+				if typ == zstdCompressionBlockType {
+					n, prefixLen, err := decompressedLen(typ, compressed)
+					require.NoError(t, err)
+					require.Equal(t, len(b), n)
+					compressed = compressed[prefixLen:]
+				}
+				decompressed, err := decompressInto(typ, compressed, decompressed, nil /* dict */)
+				require.NoError(t, err)
+				require.Equal(t, string(b), string(decompressed))
+			}
+			require.Equal(t, 4*adaptiveSampleInterval, stats.CompressedBlocks[tc.want])
+		}
+	})
+}
+
+func TestWriterCompressionStats(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	writeTable := func(
+		compression Compression, value func(i int) []byte,
+	) (*WriterMetadata, *Reader) {
+		f := &memFile{}
+		w := NewWriter(f, WriterOptions{
+			BlockSize:   1024,
+			Comparer:    testkeys.Comparer,
+			Compression: compression,
+			TableFormat: TableFormatPebblev3,
+		})
+		for i := 0; i < 1000; i++ {
+			// Store the values of older versions in value blocks.
+			for _, ts := range []int{2, 1} {
+				k := []byte(fmt.Sprintf("key%06d@%d", i, ts))
+				require.NoError(t, w.Add(base.MakeInternalKey(k, 1, InternalKeyKindSet), value(i)))
+			}
+		}
+		require.NoError(t, w.Close())
+		meta, err := w.Metadata()
+		require.NoError(t, err)
+		r, err := NewMemReader(f.Data(), ReaderOptions{Comparer: testkeys.Comparer})
+		require.NoError(t, err)
+		require.NoError(t, r.ValidateBlockChecksums())
+		return meta, r
+	}
+	numBlocks := func(r *Reader) int {
+		l, err := r.Layout()
+		require.NoError(t, err)
+		return len(l.Data) + len(l.ValueBlock)
+	}
+	randomValue := func(int) []byte {
+		b := make([]byte, 100)
+		rng.Read(b)
+		return b
+	}
+
+	// Without compression, every block is uncompressed.
+	meta, r := writeTable(NoCompression, randomValue)
+	require.Equal(t, numBlocks(r), meta.CompressionStats.UncompressedBlocks[UncompressedDisabled])
+	require.NoError(t, r.Close())
+
+	// Snappy compresses every block, discarding every incompressible one.
+	meta, r = writeTable(SnappyCompression, randomValue)
+	require.Equal(t, numBlocks(r), meta.CompressionStats.UncompressedBlocks[UncompressedInsufficientSavings])
+	require.NoError(t, r.Close())
+
+	// Adaptive compression skips compressing most incompressible blocks.
+	meta, r = writeTable(AdaptiveCompression, randomValue)
+	stats := meta.CompressionStats
+	require.Equal(t, numBlocks(r), stats.UncompressedBlocks[UncompressedInsufficientSavings]+
+		stats.UncompressedBlocks[UncompressedSkipped])
+	require.Greater(t, stats.UncompressedBlocks[UncompressedSkipped],
+		4*stats.UncompressedBlocks[UncompressedInsufficientSavings])
+	require.NoError(t, r.Close())
+
+	// Adaptive compression compresses compressible blocks.
+	meta, r = writeTable(AdaptiveCompression, func(i int) []byte {
+		return compressibleBlock(rng, 100)
+	})
+	require.Equal(t, numBlocks(r), meta.CompressionStats.CompressedBlocks[SnappyCompression])
+	require.Equal(t, fmt.Sprintf("compressed: Snappy=%d uncompressed:", numBlocks(r)),
+		meta.CompressionStats.String())
+	iter, err := r.NewIter(nil /* lower */, nil /* upper */)
+	require.NoError(t, err)
+	n := 0
+	for k, v := iter.First(); k != nil; k, v = iter.Next() {
+		_, _, err := v.Value(nil)
+		require.NoError(t, err)
+		n++
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, 2000, n)
+	require.NoError(t, r.Close())
+}
@@ -20,14 +20,18 @@ func decodeZstd(decodedBuf, b []byte) ([]byte, error) {
 	return zstd.Decompress(decodedBuf, b)
 }
 
-// encodeZstd compresses b with the Zstandard algorithm at default compression
-// level (level 3). It reuses the preallocated capacity of compressedBuf if it
-// is sufficient. The subslice `compressedBuf[:varIntLen]` should already encode
-// the length of `b` before calling encodeZstd. It returns the encoded byte
-// slice, including the `compressedBuf[:varIntLen]` prefix.
-func encodeZstd(compressedBuf []byte, varIntLen int, b []byte) []byte {
+// encodeZstd compresses b with the Zstandard algorithm at the provided
+// compression level, or the default level (level 3) if level <= 0. It reuses
+// the preallocated capacity of compressedBuf if it is sufficient. The subslice
+// `compressedBuf[:varIntLen]` should already encode the length of `b` before
+// calling encodeZstd. It returns the encoded byte slice, including the
+// `compressedBuf[:varIntLen]` prefix.
+func encodeZstd(compressedBuf []byte, varIntLen int, b []byte, level int) []byte {
+	if level <= 0 {
+		level = zstdDefaultLevel
+	}
 	buf := bytes.NewBuffer(compressedBuf[:varIntLen])
-	writer := zstd.NewWriterLevel(buf, 3)
+	writer := zstd.NewWriterLevel(buf, level)
 	writer.Write(b)
 	writer.Close()
 	return buf.Bytes()
@@ -7,6 +7,16 @@
 
 package sstable
 
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/DataDog/zstd"
+	"github.com/stretchr/testify/require"
+)
+
 // useStandardZstdLib indicates whether the zstd implementation is a port of the
 // official one in the facebook/zstd repository.
 //
@@ -17,3 +27,31 @@ package sstable
 // We cannot always use the official facebook/zstd implementation since it
 // relies on CGo.
 const useStandardZstdLib = true
+
+// TestZstdDictCgoInterop tests that blocks compressed against a dictionary by
+// the cgo zstd implementation are readable through a zstdDict, and vice
+// versa.
+func TestZstdDictCgoInterop(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	b := compressibleBlock(rng, 32<<10)
+	raw := trainZstdDict(compressibleBlock(rng, 256<<10), 4<<10)
+	require.NotNil(t, raw)
+	dict := newZstdDict(raw)
+
+	for _, level := range []int{1, 3, 9} {
+		var buf bytes.Buffer
+		w := zstd.NewWriterLevelDict(&buf, level, raw)
+		_, err := w.Write(b)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		decoded, err := dict.decode(make([]byte, len(b)), buf.Bytes())
+		require.NoError(t, err)
+		require.Equal(t, string(b), string(decoded))
+
+		r := zstd.NewReaderDict(bytes.NewReader(dict.encode(nil, 0, b, level)), raw)
+		decoded, err = io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		require.Equal(t, string(b), string(decoded))
+	}
+}
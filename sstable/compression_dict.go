@@ -0,0 +1,262 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Zstd dictionaries
+//
+// With ZstdDictionaryCompression, the Writer samples the uncompressed data and
+// value blocks of the table it's writing. Once zstdDictSampleSize bytes have
+// been sampled, it trains a dictionary of at most zstdDictSize bytes, and all
+// subsequent data and value blocks are compressed against the dictionary. The
+// dictionary is stored in the table's "pebble.zstd_dictionary" meta block. Small
+// tables never collect sufficient samples, and are written without a
+// dictionary.
+//
+// The dictionary is a raw content dictionary: a sequence of bytes that zstd
+// may reference as if it preceded each compressed block. It's trained using a
+// simplified variant of the FastCOVER algorithm used by zstd's dictionary
+// builder. The samples are split into epochs, one per dictionary segment. From
+// each epoch, the segment whose distinct d-mers are most frequent across all
+// the samples is selected, provided its d-mers are sufficiently frequent. The
+// frequencies of the selected segment's d-mers are then reset so that
+// subsequent segments favor other content. zstd encodes references to content
+// at the end of the dictionary most cheaply, so the segments are ordered by
+// increasing score.
+//
+// A table's dictionary is prepared once, when the Writer trains it or the
+// Reader opens the table, and is shared by all of the table's blocks (see
+// zstdDict). Blocks are compressed against a dictionary with the pure Go
+// Zstandard implementation in all builds, since the cgo implementation
+// reloads the dictionary for every block. Both produce standard zstd frames,
+// so blocks compressed by either are readable by the other.
+
+const (
+	// zstdDictSize is the maximum size of a trained dictionary.
+	zstdDictSize = 16 << 10
+	// zstdDictSampleSize is the number of uncompressed bytes sampled before
+	// training a dictionary. zstd recommends training on samples totaling
+	// ~100x the dictionary size.
+	zstdDictSampleSize = 100 * zstdDictSize
+
+	// zstdDictDmerLen is the length of the d-mers whose frequencies are
+	// counted, and is the minimum zstd match length.
+	zstdDictDmerLen = 8
+	// zstdDictSegmentLen is the length of the segments selected from the
+	// samples.
+	zstdDictSegmentLen = 256
+	// zstdDictHashBits is the log2 of the number of buckets d-mers are hashed
+	// into when counting frequencies.
+	zstdDictHashBits = 20
+	// zstdDictMinSegmentScore is the minimum average number of repetitions of
+	// the d-mers of a selected segment. It excludes segments whose d-mers are
+	// rare, or that are only repeated due to hash collisions.
+	zstdDictMinSegmentScore = 8
+)
+
+// zstdDictTrainer samples the uncompressed blocks written to a table, and
+// trains the table's zstd dictionary once sufficient samples are collected.
+// The zero value of *zstdDictTrainer (nil) never trains a dictionary.
+type zstdDictTrainer struct {
+	sampleSize int
+	dictSize   int
+	// samples holds the concatenated sampled blocks until the dictionary is
+	// trained.
+	samples []byte
+	// trained is true once training has been attempted. dict may be nil if no
+	// dictionary could be trained from the samples.
+	trained bool
+	dict    *zstdDict
+}
+
+func newZstdDictTrainer() *zstdDictTrainer {
+	return &zstdDictTrainer{
+		sampleSize: zstdDictSampleSize,
+		dictSize:   zstdDictSize,
+	}
+}
+
+// add samples the uncompressed block b, training the dictionary if sufficient
+// samples have been collected. The block is copied.
+func (t *zstdDictTrainer) add(b []byte) {
+	if t == nil || t.trained {
+		return
+	}
+	t.samples = append(t.samples, b...)
+	if len(t.samples) >= t.sampleSize {
+		if raw := trainZstdDict(t.samples, t.dictSize); raw != nil {
+			t.dict = newZstdDict(raw)
+		}
+		t.samples = nil
+		t.trained = true
+	}
+}
+
+// dictionary returns the trained dictionary, or nil if a dictionary has not
+// been trained.
+func (t *zstdDictTrainer) dictionary() *zstdDict {
+	if t == nil {
+		return nil
+	}
+	return t.dict
+}
+
+// zstdDict is a table's zstd dictionary, prepared for compressing and
+// decompressing the table's blocks. It pools encoders and decoders that have
+// loaded the dictionary, and is safe for concurrent use. The zero value of
+// *zstdDict (nil) is the absence of a dictionary.
+type zstdDict struct {
+	// raw is the raw content dictionary, as stored in the table's dictionary
+	// block.
+	raw      []byte
+	decoders sync.Pool
+	// encoders holds a pool of encoders for each of the pure Go
+	// implementation's encoder levels.
+	encoders [zstd.SpeedBestCompression + 1]sync.Pool
+}
+
+// newZstdDict prepares the raw content dictionary raw. The dictionary is
+// copied.
+func newZstdDict(raw []byte) *zstdDict {
+	return &zstdDict{raw: append([]byte(nil), raw...)}
+}
+
+// decode decompresses b against the dictionary. The decodedBuf must be
+// exactly the length of the decompressed block.
+func (d *zstdDict) decode(decodedBuf, b []byte) ([]byte, error) {
+	decoder, _ := d.decoders.Get().(*zstd.Decoder)
+	if decoder == nil {
+		var err error
+		decoder, err = zstd.NewReader(nil,
+			zstd.WithDecoderConcurrency(1), zstd.WithDecoderDictRaw(0, d.raw))
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer d.decoders.Put(decoder)
+	return decoder.DecodeAll(b, decodedBuf[:0])
+}
+
+// encode is like encodeZstd, but compresses b against the dictionary.
+func (d *zstdDict) encode(compressedBuf []byte, varIntLen int, b []byte, level int) []byte {
+	l := zstdEncoderLevel(level)
+	encoder, _ := d.encoders[l].Get().(*zstd.Encoder)
+	if encoder == nil {
+		var err error
+		encoder, err = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1),
+			zstd.WithEncoderLevel(l), zstd.WithEncoderDictRaw(0, d.raw))
+		if err != nil {
+			// The dictionary is never empty, and the options are valid.
+			panic(err)
+		}
+	}
+	defer d.encoders[l].Put(encoder)
+	return encoder.EncodeAll(b, compressedBuf[:varIntLen])
+}
+
+// zstdEncoderLevel maps a zstd compression level onto the pure Go
+// implementation's encoder levels.
+func zstdEncoderLevel(level int) zstd.EncoderLevel {
+	if level <= 0 {
+		level = zstdDefaultLevel
+	}
+	return zstd.EncoderLevelFromZstd(level)
+}
+
+// trainZstdDict trains a raw content dictionary of at most dictSize bytes
+// from the concatenated samples. It returns nil if the samples are smaller
+// than the dictionary, or do not contain sufficiently repeated content.
+func trainZstdDict(samples []byte, dictSize int) []byte {
+	numSegments := dictSize / zstdDictSegmentLen
+	if numSegments == 0 || len(samples) < dictSize {
+		return nil
+	}
+	const dmersPerSegment = zstdDictSegmentLen - zstdDictDmerLen + 1
+	hash := func(i int) uint32 {
+		const prime8bytes = 0xcf1bbcdcb7a56463
+		return uint32((binary.LittleEndian.Uint64(samples[i:]) * prime8bytes) >> (64 - zstdDictHashBits))
+	}
+
+	// Count the repetitions of every d-mer in the samples. Only repeated
+	// occurrences of a d-mer are useful.
+	freqs := make([]uint32, 1<<zstdDictHashBits)
+	for i := 0; i+zstdDictDmerLen <= len(samples); i++ {
+		freqs[hash(i)]++
+	}
+	for i := range freqs {
+		if freqs[i] > 0 {
+			freqs[i]--
+		}
+	}
+
+	type segment struct {
+		start int
+		score uint64
+	}
+	segments := make([]segment, 0, numSegments)
+	// windowFreqs counts the occurrences of each d-mer within the sliding
+	// window, so that each distinct d-mer contributes to the window's score
+	// once.
+	windowFreqs := make([]uint16, 1<<zstdDictHashBits)
+	epochLen := len(samples) / numSegments
+	for epoch := 0; epoch < numSegments; epoch++ {
+		start, end := epoch*epochLen, (epoch+1)*epochLen
+		var best segment
+		var score uint64
+		windowStart := start
+		i := start
+		for ; i+zstdDictDmerLen <= end; i++ {
+			h := hash(i)
+			if windowFreqs[h] == 0 {
+				score += uint64(freqs[h])
+			}
+			windowFreqs[h]++
+			if i-windowStart == dmersPerSegment {
+				// Remove the oldest d-mer from the window.
+				h := hash(windowStart)
+				windowFreqs[h]--
+				if windowFreqs[h] == 0 {
+					score -= uint64(freqs[h])
+				}
+				windowStart++
+			}
+			if i-windowStart+1 == dmersPerSegment && score > best.score {
+				best = segment{start: windowStart, score: score}
+			}
+		}
+		// Reset the window.
+		for j := windowStart; j < i; j++ {
+			windowFreqs[hash(j)] = 0
+		}
+		if best.score < zstdDictMinSegmentScore*dmersPerSegment {
+			continue
+		}
+		// Reset the frequencies of the selected segment's d-mers, so that
+		// subsequent segments favor other content.
+		for j := best.start; j < best.start+dmersPerSegment; j++ {
+			freqs[hash(j)] = 0
+		}
+		segments = append(segments, best)
+	}
+	if len(segments) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].score < segments[j].score
+	})
+	dict := make([]byte, 0, len(segments)*zstdDictSegmentLen)
+	for _, s := range segments {
+		dict = append(dict, samples[s.start:s.start+zstdDictSegmentLen]...)
+	}
+	return dict
+}
@@ -0,0 +1,189 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
+	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrainZstdDict(t *testing.T) {
+	const dictSize = 4 << 10
+	rng := rand.New(rand.NewSource(1))
+
+	// Samples smaller than the dictionary don't produce a dictionary.
+	require.Nil(t, trainZstdDict(make([]byte, dictSize-1), dictSize))
+
+	// Random samples have no repeated content.
+	random := make([]byte, 64<<10)
+	rng.Read(random)
+	require.Nil(t, trainZstdDict(random, dictSize))
+
+	// Samples built from a small set of records produce a dictionary
+	// containing the records' common content.
+	var samples []byte
+	for len(samples) < 64<<10 {
+		samples = append(samples, fmt.Sprintf(`{"id":%d,"status":"active","region":"us-east-%d"}`,
+			rng.Intn(1000000), rng.Intn(4))...)
+		samples = append(samples, random[:rng.Intn(32)]...)
+	}
+	dict := trainZstdDict(samples, dictSize)
+	require.NotNil(t, dict)
+	require.LessOrEqual(t, len(dict), dictSize)
+	require.Zero(t, len(dict)%zstdDictSegmentLen)
+	require.Contains(t, string(dict), `"status":"active","region":"us-east-`)
+}
+
+func TestWriterZstdDictionary(t *testing.T) {
+	// The value of the i'th key. The values share content, and are compressed
+	// more effectively with a dictionary.
+	value := func(i int) []byte {
+		return []byte(fmt.Sprintf(
+			`{"id":%d,"name":"user-%d","email":"user%d@example.com","status":"active","version":%d}`,
+			i/2, i/2, i/2, i%2))
+	}
+	const numPrefixes = 4000
+	var keys [][]byte
+	for i := 0; i < numPrefixes; i++ {
+		keys = append(keys,
+			[]byte(fmt.Sprintf("user%06d@2", i)),
+			[]byte(fmt.Sprintf("user%06d@1", i)))
+	}
+
+	writeTable := func(t *testing.T, compression Compression, format TableFormat) *Reader {
+		f := &memFile{}
+		w := NewWriter(f, WriterOptions{
+			BlockSize:   1024,
+			Comparer:    testkeys.Comparer,
+			Compression: compression,
+			TableFormat: format,
+		})
+		if w.zstdDict != nil {
+			// Train a smaller dictionary from fewer samples, so that most of the
+			// table's blocks are compressed against the dictionary.
+			w.zstdDict.sampleSize = 64 << 10
+			w.zstdDict.dictSize = 4 << 10
+		}
+		for i, k := range keys {
+			require.NoError(t, w.Add(base.MakeInternalKey(k, 1, InternalKeyKindSet), value(i)))
+		}
+		require.NoError(t, w.Close())
+		r, err := NewMemReader(f.Data(), ReaderOptions{Comparer: testkeys.Comparer})
+		require.NoError(t, err)
+		return r
+	}
+	checkTable := func(t *testing.T, r *Reader) {
+		require.NoError(t, r.ValidateBlockChecksums())
+		iter, err := r.NewIter(nil /* lower */, nil /* upper */)
+		require.NoError(t, err)
+		i := 0
+		for k, v := iter.First(); k != nil; k, v = iter.Next() {
+			require.Equal(t, string(keys[i]), string(k.UserKey))
+			val, _, err := v.Value(nil)
+			require.NoError(t, err)
+			require.Equal(t, string(value(i)), string(val))
+			i++
+		}
+		require.NoError(t, iter.Close())
+		require.Equal(t, len(keys), i)
+	}
+	// countBlockTypes returns the number of data and value blocks of each block
+	// type.
+	countBlockTypes := func(t *testing.T, r *Reader) map[blockType]int {
+		l, err := r.Layout()
+		require.NoError(t, err)
+		blocks := append([]BlockHandle(nil), l.ValueBlock...)
+		for i := range l.Data {
+			blocks = append(blocks, l.Data[i].BlockHandle)
+		}
+		counts := make(map[blockType]int)
+		data := r.readable.(*memReader).b
+		for _, bh := range blocks {
+			counts[blockType(data[bh.Offset+bh.Length])]++
+		}
+		return counts
+	}
+
+	t.Run("dictionary", func(t *testing.T) {
+		r := writeTable(t, ZstdDictionaryCompression, TableFormatPebblev5)
+		defer r.Close()
+		checkTable(t, r)
+
+		l, err := r.Layout()
+		require.NoError(t, err)
+		require.NotZero(t, l.ZstdDict.Length)
+		require.LessOrEqual(t, l.ZstdDict.Length, uint64(4<<10))
+		require.NotZero(t, r.Properties.NumValueBlocks)
+		counts := countBlockTypes(t, r)
+		require.NotZero(t, counts[zstdCompressionBlockType])
+		require.Greater(t, counts[zstdDictCompressionBlockType], counts[zstdCompressionBlockType])
+
+		// The dictionary is held outside the block cache, and its size is
+		// reserved in the cache while the table is open.
+		c := cache.New(1 << 20)
+		defer c.Unref()
+		r3, err := NewMemReader(r.readable.(*memReader).b, ReaderOptions{Comparer: testkeys.Comparer, Cache: c})
+		require.NoError(t, err)
+		require.Nil(t, c.Get(r3.cacheID, r3.fileNum, r3.zstdDictBH.Offset).Get())
+		require.LessOrEqual(t, int64(l.ZstdDict.Length), c.Metrics().Reserved)
+		checkTable(t, r3)
+		require.NoError(t, r3.Close())
+		require.Zero(t, c.Metrics().Reserved)
+
+		// Including the dictionary, the table is smaller than one compressed
+		// without a dictionary.
+		r2 := writeTable(t, ZstdCompression, TableFormatPebblev5)
+		defer r2.Close()
+		checkTable(t, r2)
+		require.Less(t, len(r.readable.(*memReader).b), len(r2.readable.(*memReader).b))
+	})
+
+	t.Run("old-format", func(t *testing.T) {
+		// Older table formats fall back to compressing without a dictionary.
+		r := writeTable(t, ZstdDictionaryCompression, TableFormatPebblev4)
+		defer r.Close()
+		checkTable(t, r)
+
+		l, err := r.Layout()
+		require.NoError(t, err)
+		require.Zero(t, l.ZstdDict.Length)
+		require.Zero(t, countBlockTypes(t, r)[zstdDictCompressionBlockType])
+	})
+}
+
+func TestZstdDictConcurrent(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	raw := trainZstdDict(compressibleBlock(rng, 256<<10), 4<<10)
+	require.NotNil(t, raw)
+	dict := newZstdDict(raw)
+	// The dictionary is copied.
+	raw[0] ^= 0xff
+
+	blocks := make([][]byte, 8)
+	for i := range blocks {
+		blocks[i] = compressibleBlock(rng, 4<<10)
+	}
+	var wg sync.WaitGroup
+	for i := range blocks {
+		wg.Add(1)
+		go func(b []byte) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				compressed := dict.encode(nil, 0, b, j%4)
+				decoded, err := dict.decode(make([]byte, len(b)), compressed)
+				require.NoError(t, err)
+				require.Equal(t, string(b), string(decoded))
+			}
+		}(blocks[i])
+	}
+	wg.Wait()
+}
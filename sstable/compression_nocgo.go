@@ -7,24 +7,49 @@
 
 package sstable
 
-import "github.com/klauspost/compress/zstd"
+import (
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Without cgo, blocks are compressed with the pure Go Zstandard
+// implementation. It produces standard zstd frames, so tables written by
+// either build are readable by the other.
+
+var zstdDecoder struct {
+	once sync.Once
+	*zstd.Decoder
+}
+
+// zstdEncoders holds a shared encoder for each of the pure Go implementation's
+// encoder levels. Encoders are safe for concurrent use by EncodeAll.
+var zstdEncoders [zstd.SpeedBestCompression + 1]struct {
+	once sync.Once
+	*zstd.Encoder
+}
 
 // decodeZstd decompresses b with the Zstandard algorithm.
 // It reuses the preallocated capacity of decodedBuf if it is sufficient.
 // On success, it returns the decoded byte slice.
 func decodeZstd(decodedBuf, b []byte) ([]byte, error) {
-	decoder, _ := zstd.NewReader(nil)
-	defer decoder.Close()
-	return decoder.DecodeAll(b, decodedBuf[:0])
+	zstdDecoder.once.Do(func() {
+		zstdDecoder.Decoder, _ = zstd.NewReader(nil)
+	})
+	return zstdDecoder.DecodeAll(b, decodedBuf[:0])
 }
 
-// encodeZstd compresses b with the Zstandard algorithm at default compression
-// level (level 3). It reuses the preallocated capacity of compressedBuf if it
-// is sufficient. The subslice `compressedBuf[:varIntLen]` should already encode
-// the length of `b` before calling encodeZstd. It returns the encoded byte
-// slice, including the `compressedBuf[:varIntLen]` prefix.
-func encodeZstd(compressedBuf []byte, varIntLen int, b []byte) []byte {
-	encoder, _ := zstd.NewWriter(nil)
-	defer encoder.Close()
-	return encoder.EncodeAll(b, compressedBuf[:varIntLen])
+// encodeZstd compresses b with the Zstandard algorithm at the provided
+// compression level, or the default level (level 3) if level <= 0. It reuses
+// the preallocated capacity of compressedBuf if it is sufficient. The subslice
+// `compressedBuf[:varIntLen]` should already encode the length of `b` before
+// calling encodeZstd. It returns the encoded byte slice, including the
+// `compressedBuf[:varIntLen]` prefix.
+func encodeZstd(compressedBuf []byte, varIntLen int, b []byte, level int) []byte {
+	l := zstdEncoderLevel(level)
+	e := &zstdEncoders[l]
+	e.once.Do(func() {
+		e.Encoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(l))
+	})
+	return e.EncodeAll(b, compressedBuf[:varIntLen])
 }
@@ -0,0 +1,236 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
+	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+// compressibleBlock returns a block of n bytes built from a small set of
+// records interspersed with random bytes.
+func compressibleBlock(rng *rand.Rand, n int) []byte {
+	var b []byte
+	for len(b) < n {
+		b = append(b, fmt.Sprintf(`{"id":%d,"status":"active","region":"us-east-%d"}`,
+			rng.Intn(1000000), rng.Intn(4))...)
+		random := make([]byte, rng.Intn(16))
+		rng.Read(random)
+		b = append(b, random...)
+	}
+	return b[:n]
+}
+
+func TestCompressionRoundtrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	c := cache.New(1 << 20)
+	defer c.Unref()
+
+	random := make([]byte, 4096)
+	rng.Read(random)
+	compressible := compressibleBlock(rng, 32<<10)
+	raw := trainZstdDict(compressibleBlock(rng, 256<<10), 4<<10)
+	require.NotNil(t, raw)
+	dict := newZstdDict(raw)
+
+	for _, tc := range []struct {
+		compression Compression
+		level       int
+		dict        *zstdDict
+		want        blockType
+	}{
+		{NoCompression, 0, nil, noCompressionBlockType},
+		{SnappyCompression, 0, nil, snappyCompressionBlockType},
+		{ZstdCompression, 0, nil, zstdCompressionBlockType},
+		{ZstdCompression, 1, nil, zstdCompressionBlockType},
+		{ZstdCompression, 19, nil, zstdCompressionBlockType},
+		{ZstdCompression, 100, nil, zstdCompressionBlockType},
+		{ZstdDictionaryCompression, 0, nil, zstdCompressionBlockType},
+		{ZstdDictionaryCompression, 0, dict, zstdDictCompressionBlockType},
+		{ZstdDictionaryCompression, 9, dict, zstdDictCompressionBlockType},
+		{LZ4Compression, 0, nil, lz4CompressionBlockType},
+		{LZ4Compression, 1, nil, lz4hcCompressionBlockType},
+		{LZ4Compression, 9, nil, lz4hcCompressionBlockType},
+		{LZ4Compression, 100, nil, lz4hcCompressionBlockType},
+	} {
+		t.Run(fmt.Sprintf("%s/level=%d/dict=%t", tc.compression, tc.level, tc.dict != nil), func(t *testing.T) {
+			for _, b := range [][]byte{compressible, random} {
+				typ, compressed := compressBlock(tc.compression, tc.level, b, nil /* compressedBuf */, tc.dict)
+				if bytes.Equal(b, compressible) {
+					require.Equal(t, tc.want, typ)
+					if typ != noCompressionBlockType {
+						require.Less(t, len(compressed), len(b))
+					}
+				} else if typ != tc.want {
+					// Incompressible blocks may be returned uncompressed.
+					require.Equal(t, noCompressionBlockType, typ)
+				}
+				if typ == noCompressionBlockType {
+					require.Equal(t, b, compressed)
+					continue
+				}
+				v, err := decompressBlock(c, typ, compressed, tc.dict)
+				require.NoError(t, err)
+				require.Equal(t, string(b), string(v.Buf()))
+				c.Free(v)
+			}
+		})
+	}
+
+	// Corrupt LZ4 blocks are detected.
+	_, compressed := compressBlock(LZ4Compression, 0, compressible, nil /* compressedBuf */, nil /* dict */)
+	compressed[len(compressed)/2] ^= 0xff
+	compressed = compressed[:len(compressed)-16]
+	_, err := decompressBlock(c, lz4CompressionBlockType, compressed, nil /* dict */)
+	require.True(t, errors.Is(err, base.ErrCorruption))
+}
+
+// TestZstdInterop tests that zstd blocks written by this build are readable by
+// the pure Go zstd implementation used by builds without cgo, and vice versa.
+// Builds without cgo trivially pass.
+func TestZstdInterop(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	b := compressibleBlock(rng, 32<<10)
+	raw := trainZstdDict(compressibleBlock(rng, 256<<10), 4<<10)
+	require.NotNil(t, raw)
+	dict := newZstdDict(raw)
+
+	for _, useDict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dict=%t", useDict), func(t *testing.T) {
+			var dopts []zstd.DOption
+			var eopts []zstd.EOption
+			if useDict {
+				dopts = append(dopts, zstd.WithDecoderDictRaw(0, raw))
+				eopts = append(eopts, zstd.WithEncoderDictRaw(0, raw))
+			}
+			decoder, err := zstd.NewReader(nil, dopts...)
+			require.NoError(t, err)
+			defer decoder.Close()
+			encoder, err := zstd.NewWriter(nil, eopts...)
+			require.NoError(t, err)
+			defer encoder.Close()
+
+			// This build's blocks are readable by the pure Go implementation.
+			for _, level := range []int{0, 1, 9} {
+				var compressed []byte
+				if useDict {
+					compressed = dict.encode(nil, 0, b, level)
+				} else {
+					compressed = encodeZstd(nil, 0, b, level)
+				}
+				decoded, err := decoder.DecodeAll(compressed, nil)
+				require.NoError(t, err)
+				require.Equal(t, string(b), string(decoded))
+			}
+
+			// The pure Go implementation's blocks are readable by this build.
+			compressed := encoder.EncodeAll(b, nil)
+			var decoded []byte
+			if useDict {
+				decoded, err = dict.decode(make([]byte, len(b)), compressed)
+			} else {
+				decoded, err = decodeZstd(make([]byte, len(b)), compressed)
+			}
+			require.NoError(t, err)
+			require.Equal(t, string(b), string(decoded))
+		})
+	}
+}
+
+func TestWriterCompressionLevel(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	writeTable := func(t *testing.T, opts WriterOptions) ([]byte, map[blockType]int) {
+		opts.BlockSize = 1024
+		opts.Comparer = testkeys.Comparer
+		f := &memFile{}
+		w := NewWriter(f, opts)
+		for i := 0; i < 2000; i++ {
+			k := []byte(fmt.Sprintf("key%06d@1", i))
+			require.NoError(t, w.Add(base.MakeInternalKey(k, 1, InternalKeyKindSet), compressibleBlock(rng, 100)))
+		}
+		require.NoError(t, w.Close())
+
+		r, err := NewMemReader(f.Data(), ReaderOptions{Comparer: testkeys.Comparer})
+		require.NoError(t, err)
+		defer r.Close()
+		require.NoError(t, r.ValidateBlockChecksums())
+		iter, err := r.NewIter(nil /* lower */, nil /* upper */)
+		require.NoError(t, err)
+		n := 0
+		for k, _ := iter.First(); k != nil; k, _ = iter.Next() {
+			n++
+		}
+		require.NoError(t, iter.Close())
+		require.Equal(t, 2000, n)
+
+		l, err := r.Layout()
+		require.NoError(t, err)
+		counts := make(map[blockType]int)
+		for _, bh := range l.Data {
+			counts[blockType(f.Data()[bh.Offset+bh.Length])]++
+		}
+		return f.Data(), counts
+	}
+
+	_, counts := writeTable(t, WriterOptions{
+		Compression: LZ4Compression,
+		TableFormat: TableFormatPebblev6,
+	})
+	require.NotZero(t, counts[lz4CompressionBlockType])
+	require.Zero(t, counts[lz4hcCompressionBlockType])
+
+	_, counts = writeTable(t, WriterOptions{
+		Compression:      LZ4Compression,
+		CompressionLevel: 9,
+		TableFormat:      TableFormatPebblev6,
+	})
+	require.NotZero(t, counts[lz4hcCompressionBlockType])
+	require.Zero(t, counts[lz4CompressionBlockType])
+
+	// Older table formats fall back to snappy compression.
+	_, counts = writeTable(t, WriterOptions{
+		Compression: LZ4Compression,
+		TableFormat: TableFormatPebblev5,
+	})
+	require.NotZero(t, counts[snappyCompressionBlockType])
+	require.Zero(t, counts[lz4CompressionBlockType])
+
+	// Higher zstd levels produce smaller tables.
+	low, _ := writeTable(t, WriterOptions{
+		Compression:      ZstdCompression,
+		CompressionLevel: 1,
+		TableFormat:      TableFormatPebblev5,
+	})
+	high, _ := writeTable(t, WriterOptions{
+		Compression:      ZstdCompression,
+		CompressionLevel: 9,
+		TableFormat:      TableFormatPebblev5,
+	})
+	require.Less(t, len(high), len(low))
+}
+
+func TestDecompressedLenLZ4(t *testing.T) {
+	// LZ4 blocks are prefixed with the varint encoded length of the
+	// decompressed block, as in RocksDB.
+	b := bytes.Repeat([]byte("pebble"), 1000)
+	typ, compressed := compressBlock(LZ4Compression, 0, b, nil /* compressedBuf */, nil /* dict */)
+	require.Equal(t, lz4CompressionBlockType, typ)
+	n, prefixLen, err := decompressedLen(typ, compressed)
+	require.NoError(t, err)
+	require.Equal(t, len(b), n)
+	v, prefixLen2 := binary.Uvarint(compressed)
+	require.Equal(t, uint64(len(b)), v)
+	require.Equal(t, prefixLen2, prefixLen)
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// EncryptionKey is a key with which a Writer encrypts the blocks of a table.
+//
+// An encrypted table's blocks are encrypted with AES-GCM after compression,
+// and their checksums are computed over the encrypted blocks, so that blocks
+// remain encrypted in storage, including shared storage, and are decrypted
+// when read into the block cache. The key's ID is recorded in the table's
+// properties, which, along with the metaindex block, are not encrypted so
+// that a Reader can find the ID and look up the key with
+// ReaderOptions.EncryptionKeys. The properties also record a random ID of the
+// table, which is authenticated with each block, along with the block's
+// offset, so that blocks can't be moved within a table or between tables
+// encrypted with the same key.
+type EncryptionKey struct {
+	// ID identifies the key.
+	ID string
+	// Secret is the AES key, of 16, 24 or 32 bytes.
+	Secret []byte
+}
+
+// An encrypted block is the nonce with which it was encrypted, followed by
+// the sealed block, which ends with the GCM tag. The table's ID, the block's
+// offset and the block's type, which follows it in the trailer, are
+// authenticated as additional data.
+const (
+	blockNonceLen           = 12
+	blockEncryptionOverhead = blockNonceLen + 16
+	encryptionTableIDLen    = 16
+)
+
+// blockCipher encrypts and decrypts the blocks of a table. It's safe for
+// concurrent use.
+type blockCipher struct {
+	aead cipher.AEAD
+	// tableID is the table's ID, as recorded in Properties.EncryptionTableID.
+	tableID string
+}
+
+// makeEncryptionTableID returns a random ID for a new encrypted table.
+func makeEncryptionTableID() string {
+	var id [encryptionTableIDLen]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		// crypto/rand doesn't fail on supported platforms.
+		panic(err)
+	}
+	return hex.EncodeToString(id[:])
+}
+
+func newBlockCipher(secret []byte, tableID string) (*blockCipher, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "pebble/table: invalid encryption key")
+	}
+	aead, err := cipher.NewGCMWithNonceSize(block, blockNonceLen)
+	if err != nil {
+		return nil, err
+	}
+	return &blockCipher{aead: aead, tableID: tableID}, nil
+}
+
+// additionalData returns the data authenticated along with the block of type
+// typ at the given offset.
+func (c *blockCipher) additionalData(typ blockType, offset uint64) []byte {
+	ad := make([]byte, len(c.tableID)+9)
+	n := copy(ad, c.tableID)
+	binary.LittleEndian.PutUint64(ad[n:], offset)
+	ad[n+8] = byte(typ)
+	return ad
+}
+
+// encrypt appends the encryption of the block b, of type typ, which is
+// written at the given offset, to dst and returns the result.
+func (c *blockCipher) encrypt(dst, b []byte, typ blockType, offset uint64) []byte {
+	n := len(dst)
+	dst = append(dst, make([]byte, blockNonceLen)...)
+	nonce := dst[n:]
+	if _, err := rand.Read(nonce); err != nil {
+		// crypto/rand doesn't fail on supported platforms.
+		panic(err)
+	}
+	return c.aead.Seal(dst, nonce, b, c.additionalData(typ, offset))
+}
+
+// decrypt decrypts the encrypted block b, of type typ, which was read from the
+// handle bh, in place, returning the decrypted block, which is a subslice of
+// b.
+func (c *blockCipher) decrypt(b []byte, typ blockType, bh BlockHandle) ([]byte, error) {
+	if len(b) < blockEncryptionOverhead {
+		return nil, base.CorruptionErrorf("pebble/table: encrypted block at %d/%d is too short",
+			errors.Safe(bh.Offset), errors.Safe(bh.Length))
+	}
+	nonce, sealed := b[:blockNonceLen], b[blockNonceLen:]
+	decrypted, err := c.aead.Open(sealed[:0], nonce, sealed, c.additionalData(typ, bh.Offset))
+	if err != nil {
+		return nil, base.CorruptionErrorf("pebble/table: can't decrypt block at %d/%d: %v",
+			errors.Safe(bh.Offset), errors.Safe(bh.Length), err)
+	}
+	return decrypted, nil
+}
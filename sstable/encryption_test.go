@@ -0,0 +1,198 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/bloom"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterEncryption(t *testing.T) {
+	key := &EncryptionKey{ID: "k1", Secret: bytes.Repeat([]byte{1}, 32)}
+	keys := func(id string) ([]byte, error) {
+		if id != key.ID {
+			return nil, errors.Errorf("unknown key %q", id)
+		}
+		return key.Secret, nil
+	}
+	value := func(i int) []byte {
+		return []byte(fmt.Sprintf("plaintext-value-%d-%s", i, bytes.Repeat([]byte("v"), i%50)))
+	}
+	const numPrefixes = 2000
+
+	writeTable := func(t *testing.T, o WriterOptions) []byte {
+		f := &memFile{}
+		o.BlockSize = 512
+		o.IndexBlockSize = 512
+		o.Comparer = testkeys.Comparer
+		o.FilterPolicy = bloom.FilterPolicy(10)
+		o.TableFormat = TableFormatPebblev7
+		w := NewWriter(f, o)
+		for i := 0; i < numPrefixes; i++ {
+			for _, suffix := range []string{"@2", "@1"} {
+				k := base.MakeInternalKey([]byte(fmt.Sprintf("plaintext-key-%06d%s", i, suffix)), 2, InternalKeyKindSet)
+				require.NoError(t, w.Add(k, value(i)))
+			}
+		}
+		require.NoError(t, w.DeleteRange([]byte("plaintext-del-a"), []byte("plaintext-del-b")))
+		require.NoError(t, w.RangeKeySet([]byte("plaintext-rk-a"), []byte("plaintext-rk-b"), nil, []byte("plaintext-rk-value")))
+		require.NoError(t, w.Close())
+		return f.Data()
+	}
+	checkTable := func(t *testing.T, r *Reader) {
+		require.NoError(t, r.ValidateBlockChecksums())
+		iter, err := r.NewIter(nil /* lower */, nil /* upper */)
+		require.NoError(t, err)
+		n := 0
+		for k, v := iter.First(); k != nil; k, v = iter.Next() {
+			val, _, err := v.Value(nil)
+			require.NoError(t, err)
+			require.Equal(t, string(value(n/2)), string(val))
+			n++
+		}
+		require.NoError(t, iter.Close())
+		require.Equal(t, 2*numPrefixes, n)
+
+		// The bloom filter is readable.
+		iter, err = r.NewIter(nil /* lower */, nil /* upper */)
+		require.NoError(t, err)
+		k, _ := iter.SeekPrefixGE([]byte("plaintext-key-000007"), []byte("plaintext-key-000007@2"), base.SeekGEFlagsNone)
+		require.NotNil(t, k)
+		require.NoError(t, iter.Close())
+
+		rangeDels, err := r.NewRawRangeDelIter()
+		require.NoError(t, err)
+		s := rangeDels.First()
+		require.NotNil(t, s)
+		require.Equal(t, "plaintext-del-a", string(s.Start))
+		require.NoError(t, rangeDels.Close())
+		rangeKeys, err := r.NewRawRangeKeyIter()
+		require.NoError(t, err)
+		s = rangeKeys.First()
+		require.NotNil(t, s)
+		require.Equal(t, "plaintext-rk-value", string(s.Keys[0].Value))
+		require.NoError(t, rangeKeys.Close())
+	}
+
+	for _, compression := range []Compression{NoCompression, SnappyCompression, ZstdDictionaryCompression} {
+		for _, parallelism := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/parallelism=%t", compression, parallelism), func(t *testing.T) {
+				sst := writeTable(t, WriterOptions{
+					Compression: compression,
+					Parallelism: parallelism,
+					Encryption:  key,
+				})
+				// No block holds a key or value in plaintext.
+				require.False(t, bytes.Contains(sst, []byte("plaintext")))
+
+				r, err := NewMemReader(sst, ReaderOptions{Comparer: testkeys.Comparer, EncryptionKeys: keys})
+				require.NoError(t, err)
+				defer r.Close()
+				require.Equal(t, key.ID, r.Properties.EncryptionKeyID)
+				require.Len(t, r.Properties.EncryptionTableID, 2*encryptionTableIDLen)
+				require.NotZero(t, r.Properties.NumValueBlocks)
+				require.NotZero(t, r.Properties.IndexPartitions)
+				checkTable(t, r)
+			})
+		}
+	}
+
+	sst := writeTable(t, WriterOptions{Encryption: key})
+
+	t.Run("no-keys", func(t *testing.T) {
+		_, err := NewMemReader(sst, ReaderOptions{Comparer: testkeys.Comparer})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `encrypted with key "k1", but no keys were provided`)
+	})
+
+	t.Run("unknown-key", func(t *testing.T) {
+		_, err := NewMemReader(sst, ReaderOptions{
+			Comparer:       testkeys.Comparer,
+			EncryptionKeys: func(string) ([]byte, error) { return nil, errors.New("not found") },
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not found")
+	})
+
+	t.Run("wrong-key", func(t *testing.T) {
+		r, err := NewMemReader(sst, ReaderOptions{
+			Comparer: testkeys.Comparer,
+			EncryptionKeys: func(string) ([]byte, error) {
+				return bytes.Repeat([]byte{2}, 32), nil
+			},
+		})
+		require.NoError(t, err)
+		defer r.Close()
+		err = r.ValidateBlockChecksums()
+		require.Error(t, err)
+		require.True(t, errors.Is(err, base.ErrCorruption))
+	})
+
+	t.Run("invalid-key", func(t *testing.T) {
+		w := NewWriter(&memFile{}, WriterOptions{
+			TableFormat: TableFormatPebblev7,
+			Encryption:  &EncryptionKey{ID: "k", Secret: []byte("short")},
+		})
+		require.Error(t, w.Close())
+		w = NewWriter(&memFile{}, WriterOptions{
+			TableFormat: TableFormatPebblev7,
+			Encryption:  &EncryptionKey{Secret: key.Secret},
+		})
+		require.Error(t, w.Close())
+	})
+
+	// Readers of formats before TableFormatPebblev7 would read the encrypted
+	// blocks as corrupt.
+	t.Run("old-format", func(t *testing.T) {
+		w := NewWriter(&memFile{}, WriterOptions{TableFormat: TableFormatPebblev6, Encryption: key})
+		err := w.Close()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "encryption requires (Pebble,v7)")
+	})
+
+	t.Run("rewrite-suffixes", func(t *testing.T) {
+		_, err := RewriteKeySuffixes(sst, ReaderOptions{Comparer: testkeys.Comparer, EncryptionKeys: keys},
+			&memFile{}, WriterOptions{Comparer: testkeys.Comparer}, []byte("@1"), []byte("@3"), 1)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "encrypted")
+	})
+}
+
+func TestBlockCipherAdditionalData(t *testing.T) {
+	secret := bytes.Repeat([]byte{1}, 32)
+	c, err := newBlockCipher(secret, makeEncryptionTableID())
+	require.NoError(t, err)
+	other, err := newBlockCipher(secret, makeEncryptionTableID())
+	require.NoError(t, err)
+	require.NotEqual(t, c.tableID, other.tableID)
+
+	block := []byte("plaintext block")
+	bh := BlockHandle{Offset: 100}
+	encrypt := func() []byte {
+		b := c.encrypt(nil, block, noCompressionBlockType, bh.Offset)
+		bh.Length = uint64(len(b))
+		return b
+	}
+
+	decrypted, err := c.decrypt(encrypt(), noCompressionBlockType, bh)
+	require.NoError(t, err)
+	require.Equal(t, block, decrypted)
+
+	// A block can't be decrypted at another offset, with another type, or in
+	// another table encrypted with the same key.
+	_, err = c.decrypt(encrypt(), noCompressionBlockType, BlockHandle{Offset: 200, Length: bh.Length})
+	require.True(t, errors.Is(err, base.ErrCorruption))
+	_, err = c.decrypt(encrypt(), snappyCompressionBlockType, bh)
+	require.True(t, errors.Is(err, base.ErrCorruption))
+	_, err = other.decrypt(encrypt(), noCompressionBlockType, bh)
+	require.True(t, errors.Is(err, base.ErrCorruption))
+}
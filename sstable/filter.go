@@ -4,7 +4,14 @@
 
 package sstable
 
-import "sync/atomic"
+import (
+	"bytes"
+	"sort"
+	"sync/atomic"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/bytealloc"
+)
 
 // FilterMetrics holds metrics for the filter policy.
 type FilterMetrics struct {
@@ -16,6 +23,26 @@ type FilterMetrics struct {
 	// the filter policy was checked but was unable to filter an access of a data
 	// block.
 	Misses int64
+	// The number of false positives for the filter policy. This is the number
+	// of misses for which the table contained no key with the sought prefix
+	// within the iterator's bounds.
+	FalsePositives int64
+	// The number of hits for the range filter. This is the number of times
+	// the range filter was successfully used to avoid iterating over a table
+	// within an iterator's bounds.
+	RangeHits int64
+	// The number of misses for the range filter. This is the number of times
+	// the range filter was checked but was unable to exclude the table.
+	RangeMisses int64
+}
+
+// FalsePositiveRate returns the fraction of checks of keys absent from the
+// table that the filter was unable to filter, or 0 if there were none.
+func (m FilterMetrics) FalsePositiveRate() float64 {
+	if n := m.Hits + m.FalsePositives; n > 0 {
+		return float64(m.FalsePositives) / float64(n)
+	}
+	return 0
 }
 
 // FilterMetricsTracker is used to keep track of filter metrics. It contains the
@@ -26,6 +53,12 @@ type FilterMetricsTracker struct {
 	hits atomic.Int64
 	// See FilterMetrics.Misses.
 	misses atomic.Int64
+	// See FilterMetrics.FalsePositives.
+	falsePositives atomic.Int64
+	// See FilterMetrics.RangeHits.
+	rangeHits atomic.Int64
+	// See FilterMetrics.RangeMisses.
+	rangeMisses atomic.Int64
 }
 
 var _ ReaderOption = (*FilterMetricsTracker)(nil)
@@ -34,13 +67,47 @@ func (m *FilterMetricsTracker) readerApply(r *Reader) {
 	if r.tableFilter != nil {
 		r.tableFilter.metrics = m
 	}
+	if r.rangeFilter != nil {
+		r.rangeFilter.metrics = m
+	}
 }
 
 // Load returns the current values as FilterMetrics.
 func (m *FilterMetricsTracker) Load() FilterMetrics {
 	return FilterMetrics{
-		Hits:   m.hits.Load(),
-		Misses: m.misses.Load(),
+		Hits:           m.hits.Load(),
+		Misses:         m.misses.Load(),
+		FalsePositives: m.falsePositives.Load(),
+		RangeHits:      m.rangeHits.Load(),
+		RangeMisses:    m.rangeMisses.Load(),
+	}
+}
+
+func (m *FilterMetricsTracker) recordCheck(mayContain bool) {
+	if m == nil {
+		return
+	}
+	if mayContain {
+		m.misses.Add(1)
+	} else {
+		m.hits.Add(1)
+	}
+}
+
+func (m *FilterMetricsTracker) recordRangeCheck(mayContain bool) {
+	if m == nil {
+		return
+	}
+	if mayContain {
+		m.rangeMisses.Add(1)
+	} else {
+		m.rangeHits.Add(1)
+	}
+}
+
+func (m *FilterMetricsTracker) recordFalsePositive() {
+	if m != nil {
+		m.falsePositives.Add(1)
 	}
 }
 
@@ -66,6 +133,18 @@ type filterWriter interface {
 type tableFilterReader struct {
 	policy  FilterPolicy
 	metrics *FilterMetricsTracker
+	// partitioned is true if the filter is partitioned, in which case
+	// partitions holds the decoded top-level filter index, sorted by the last
+	// user key covered by each partition.
+	partitioned bool
+	partitions  []filterPartitionHandle
+}
+
+// filterPartitionHandle is an entry of the top-level index of a partitioned
+// filter.
+type filterPartitionHandle struct {
+	lastKey []byte
+	bh      BlockHandle
 }
 
 func newTableFilterReader(policy FilterPolicy) *tableFilterReader {
@@ -75,16 +154,57 @@ func newTableFilterReader(policy FilterPolicy) *tableFilterReader {
 	}
 }
 
-func (f *tableFilterReader) mayContain(data, key []byte) bool {
+// mayContain checks the filter for the key, recording the check in the
+// reader's metrics and in the iterator's metrics, if non-nil.
+func (f *tableFilterReader) mayContain(data, key []byte, iterMetrics *FilterMetricsTracker) bool {
 	mayContain := f.policy.MayContain(TableFilter, data, key)
-	if f.metrics != nil {
-		if mayContain {
-			f.metrics.misses.Add(1)
-		} else {
-			f.metrics.hits.Add(1)
+	f.recordCheck(mayContain, iterMetrics)
+	return mayContain
+}
+
+func (f *tableFilterReader) recordCheck(mayContain bool, iterMetrics *FilterMetricsTracker) {
+	f.metrics.recordCheck(mayContain)
+	iterMetrics.recordCheck(mayContain)
+}
+
+// loadPartitions decodes the top-level index of a partitioned filter. The
+// decoded index is retained for the lifetime of the Reader.
+func (f *tableFilterReader) loadPartitions(data []byte) error {
+	i, err := newRawBlockIter(bytes.Compare, data)
+	if err != nil {
+		return err
+	}
+	var alloc bytealloc.A
+	for valid := i.First(); valid; valid = i.Next() {
+		bh, n := decodeBlockHandle(i.Value())
+		if n == 0 || n != len(i.Value()) {
+			return base.CorruptionErrorf("pebble/table: invalid table (bad filter partition handle)")
 		}
+		p := filterPartitionHandle{bh: bh}
+		alloc, p.lastKey = alloc.Copy(i.Key().UserKey)
+		f.partitions = append(f.partitions, p)
 	}
-	return mayContain
+	f.partitioned = true
+	return i.Close()
+}
+
+// partition returns the handle of the filter partition covering the first
+// key in the table ≥ key, or false if every key in the table is < key.
+func (f *tableFilterReader) partition(cmp Compare, key []byte) (BlockHandle, bool) {
+	i := sort.Search(len(f.partitions), func(i int) bool {
+		return cmp(f.partitions[i].lastKey, key) >= 0
+	})
+	if i == len(f.partitions) {
+		return BlockHandle{}, false
+	}
+	return f.partitions[i].bh, true
+}
+
+// falsePositive records a check for which the filter matched a key absent
+// from the table.
+func (f *tableFilterReader) falsePositive(iterMetrics *FilterMetricsTracker) {
+	f.metrics.recordFalsePositive()
+	iterMetrics.recordFalsePositive()
 }
 
 type tableFilterWriter struct {
@@ -120,3 +240,115 @@ func (f *tableFilterWriter) metaName() string {
 func (f *tableFilterWriter) policyName() string {
 	return f.policy.Name()
 }
+
+// partitionedFilterWriter writes a table filter partitioned into blocks
+// aligned with the partitions of a two-level index. The keys of each data
+// block are buffered until the Writer has decided whether the block starts a
+// new index partition, at which point they're added to the filter partition
+// of the block's index partition. Partitions are retained until the Writer
+// writes them along with a top-level filter index on them.
+type partitionedFilterWriter struct {
+	policy FilterPolicy
+	// writer accumulates the current partition, and count is the number of
+	// keys added to it.
+	writer FilterWriter
+	count  int
+	// lastKey is the last user key of the data blocks in the current
+	// partition.
+	lastKey []byte
+	// blockKeys holds the keys added for the current data block, each ending
+	// at the corresponding offset in blockKeyEnds.
+	blockKeys    []byte
+	blockKeyEnds []int
+	partitions   []filterPartition
+}
+
+// filterPartition is a finished partition of a partitioned filter, along
+// with the last user key covered by the partition.
+type filterPartition struct {
+	lastKey []byte
+	data    []byte
+}
+
+var _ filterWriter = (*partitionedFilterWriter)(nil)
+
+func newPartitionedFilterWriter(policy FilterPolicy) *partitionedFilterWriter {
+	return &partitionedFilterWriter{
+		policy: policy,
+		writer: policy.NewWriter(TableFilter),
+	}
+}
+
+func (f *partitionedFilterWriter) addKey(key []byte) {
+	if n := len(f.blockKeyEnds); n > 0 {
+		start := 0
+		if n > 1 {
+			start = f.blockKeyEnds[n-2]
+		}
+		if bytes.Equal(f.blockKeys[start:], key) {
+			// Consecutive keys in a data block frequently share a prefix.
+			return
+		}
+	}
+	f.blockKeys = append(f.blockKeys, key...)
+	f.blockKeyEnds = append(f.blockKeyEnds, len(f.blockKeys))
+}
+
+// finishDataBlock adds the keys of the finished data block, whose last user
+// key is lastKey, to the current partition. If newIndexPartition is true, the
+// data block is the first of a new index partition, and the current partition
+// is finished beforehand.
+func (f *partitionedFilterWriter) finishDataBlock(lastKey []byte, newIndexPartition bool) {
+	if newIndexPartition {
+		f.finishPartition()
+	}
+	start := 0
+	for _, end := range f.blockKeyEnds {
+		f.writer.AddKey(f.blockKeys[start:end])
+		f.count++
+		start = end
+	}
+	f.blockKeys = f.blockKeys[:0]
+	f.blockKeyEnds = f.blockKeyEnds[:0]
+	f.lastKey = append(f.lastKey[:0], lastKey...)
+}
+
+func (f *partitionedFilterWriter) finishPartition() {
+	if f.count == 0 {
+		return
+	}
+	f.partitions = append(f.partitions, filterPartition{
+		lastKey: append([]byte(nil), f.lastKey...),
+		data:    f.writer.Finish(nil),
+	})
+	f.writer = f.policy.NewWriter(TableFilter)
+	f.count = 0
+}
+
+// partitioned returns true if the filter has more than one partition. It must
+// only be called after finish.
+func (f *partitionedFilterWriter) partitioned() bool {
+	return len(f.partitions) > 1
+}
+
+// finish finishes the final partition. If the filter has a single partition,
+// it's returned to be written as an unpartitioned filter. Otherwise, finish
+// returns nil, and the partitions are written by the Writer.
+func (f *partitionedFilterWriter) finish() ([]byte, error) {
+	f.finishPartition()
+	if len(f.partitions) == 1 {
+		return f.partitions[0].data, nil
+	}
+	return nil, nil
+}
+
+func (f *partitionedFilterWriter) metaName() string {
+	if f.partitioned() {
+		return metaPartitionedFilterPrefix + f.policy.Name()
+	}
+	return "fullfilter." + f.policy.Name()
+}
+
+func (f *partitionedFilterWriter) policyName() string {
+	return f.policy.Name()
+}
@@ -25,8 +25,12 @@ const (
 	TableFormatPebblev2 // Range keys.
 	TableFormatPebblev3 // Value blocks.
 	TableFormatPebblev4 // DELSIZED tombstones.
+	TableFormatPebblev5 // Zstd dictionaries.
+	TableFormatPebblev6 // LZ4 compression.
+	TableFormatPebblev7 // Block encryption.
+	TableFormatPebblev8 // Key-value checksums.
 
-	TableFormatMax = TableFormatPebblev4
+	TableFormatMax = TableFormatPebblev8
 )
 
 // ParseTableFormat parses the given magic bytes and version into its
@@ -52,6 +56,14 @@ func ParseTableFormat(magic []byte, version uint32) (TableFormat, error) {
 			return TableFormatPebblev3, nil
 		case 4:
 			return TableFormatPebblev4, nil
+		case 5:
+			return TableFormatPebblev5, nil
+		case 6:
+			return TableFormatPebblev6, nil
+		case 7:
+			return TableFormatPebblev7, nil
+		case 8:
+			return TableFormatPebblev8, nil
 		default:
 			return TableFormatUnspecified, base.CorruptionErrorf(
 				"pebble/table: unsupported pebble format version %d", errors.Safe(version),
@@ -79,6 +91,14 @@ func (f TableFormat) AsTuple() (string, uint32) {
 		return pebbleDBMagic, 3
 	case TableFormatPebblev4:
 		return pebbleDBMagic, 4
+	case TableFormatPebblev5:
+		return pebbleDBMagic, 5
+	case TableFormatPebblev6:
+		return pebbleDBMagic, 6
+	case TableFormatPebblev7:
+		return pebbleDBMagic, 7
+	case TableFormatPebblev8:
+		return pebbleDBMagic, 8
 	default:
 		panic("sstable: unknown table format version tuple")
 	}
@@ -99,6 +119,14 @@ func (f TableFormat) String() string {
 		return "(Pebble,v3)"
 	case TableFormatPebblev4:
 		return "(Pebble,v4)"
+	case TableFormatPebblev5:
+		return "(Pebble,v5)"
+	case TableFormatPebblev6:
+		return "(Pebble,v6)"
+	case TableFormatPebblev7:
+		return "(Pebble,v7)"
+	case TableFormatPebblev8:
+		return "(Pebble,v8)"
 	default:
 		panic("sstable: unknown table format version tuple")
 	}
@@ -55,6 +55,30 @@ func TestTableFormat_RoundTrip(t *testing.T) {
 			version: 4,
 			want:    TableFormatPebblev4,
 		},
+		{
+			name:    "PebbleDBv5",
+			magic:   pebbleDBMagic,
+			version: 5,
+			want:    TableFormatPebblev5,
+		},
+		{
+			name:    "PebbleDBv6",
+			magic:   pebbleDBMagic,
+			version: 6,
+			want:    TableFormatPebblev6,
+		},
+		{
+			name:    "PebbleDBv7",
+			magic:   pebbleDBMagic,
+			version: 7,
+			want:    TableFormatPebblev7,
+		},
+		{
+			name:    "PebbleDBv8",
+			magic:   pebbleDBMagic,
+			version: 8,
+			want:    TableFormatPebblev8,
+		},
 		// Invalid cases.
 		{
 			name:    "Invalid RocksDB version",
@@ -65,8 +89,8 @@ func TestTableFormat_RoundTrip(t *testing.T) {
 		{
 			name:    "Invalid PebbleDB version",
 			magic:   pebbleDBMagic,
-			version: 5,
-			wantErr: "pebble/table: unsupported pebble format version 5",
+			version: 9,
+			wantErr: "pebble/table: unsupported pebble format version 9",
 		},
 		{
 			name:    "Unknown magic string",
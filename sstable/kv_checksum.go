@@ -0,0 +1,249 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// In a table with key-value checksums (see WriterOptions.KVChecksums), the
+// value stored with each point key in a data block, which is either the value
+// itself or the handle of a value stored in a value block, is followed by the
+// key-value checksum of the key and the value, in kvChecksumLen bytes. The
+// checksum is computed over the value itself even if it's stored in a value
+// block.
+const kvChecksumLen = 8
+
+// maybeVerifyKVChecksums wraps an iterator over the table in a kvChecksumIter
+// if the table stores key-value checksums.
+func (r *Reader) maybeVerifyKVChecksums(iter Iterator) Iterator {
+	if !r.Properties.KVChecksums {
+		return iter
+	}
+	return &kvChecksumIter{
+		iter:    iter,
+		fetcher: kvChecksumFetcher{fileNum: r.fileNum},
+	}
+}
+
+// kvChecksumIter wraps an iterator over a table with key-value checksums. It
+// strips the checksums from the values returned by the iterator and verifies
+// them: the checksums of values stored with their keys as they're returned,
+// and the checksums of values stored in value blocks when they're fetched.
+// It isn't pooled, since the LazyValues it returns reference its fetcher,
+// which must outlive the iterator.
+type kvChecksumIter struct {
+	iter Iterator
+	// err is set if the checksum of a value stored with its key didn't
+	// match. It's sticky: the iterator returns no more keys.
+	err error
+	// checksum is the key-value checksum of the current entry.
+	checksum base.KVChecksum
+	// handle holds the handle of the current value if it's stored in a value
+	// block, encoded for fetcher (see kvChecksumFetcher).
+	handle      []byte
+	lazyFetcher base.LazyFetcher
+	fetcher     kvChecksumFetcher
+	closeHook   func(i Iterator) error
+}
+
+// kvChecksumIter implements the sstable.Iterator and base.KVChecksumIterator
+// interfaces.
+var _ Iterator = (*kvChecksumIter)(nil)
+var _ base.KVChecksumIterator = (*kvChecksumIter)(nil)
+
+// verify strips the checksum from the value at the current position. If the
+// value is stored with the key, it verifies the checksum and returns nil if
+// it doesn't match. Otherwise, it returns a LazyValue that verifies the value
+// when it's fetched.
+func (i *kvChecksumIter) verify(
+	key *InternalKey, value base.LazyValue,
+) (*InternalKey, base.LazyValue) {
+	if key == nil || i.err != nil {
+		return nil, base.LazyValue{}
+	}
+	v := value.ValueOrHandle
+	n := len(v) - kvChecksumLen
+	if n < 0 {
+		i.err = base.CorruptionErrorf("pebble/table: missing key-value checksum for key %s in table %s",
+			key, errors.Safe(i.fetcher.fileNum))
+		return nil, base.LazyValue{}
+	}
+	i.checksum = base.KVChecksum(binary.LittleEndian.Uint64(v[n:]))
+	v = v[:n:n]
+	if value.Fetcher == nil {
+		if base.MakeKVChecksum(key.Kind(), key.UserKey, v) != i.checksum {
+			i.err = base.KVChecksumMismatchError(*key, i.fetcher.location())
+			return nil, base.LazyValue{}
+		}
+		return key, base.MakeInPlaceValue(v)
+	}
+	i.handle = encodeKVChecksumHandle(i.handle[:0], v, i.checksum, *key)
+	i.fetcher.fetcher = value.Fetcher.Fetcher
+	i.lazyFetcher = base.LazyFetcher{
+		Fetcher:   &i.fetcher,
+		Attribute: value.Fetcher.Attribute,
+	}
+	return key, base.LazyValue{ValueOrHandle: i.handle, Fetcher: &i.lazyFetcher}
+}
+
+// KVChecksum implements base.KVChecksumIterator.
+func (i *kvChecksumIter) KVChecksum() (base.KVChecksum, bool) {
+	return i.checksum, true
+}
+
+// SeekGE implements internalIterator.SeekGE.
+func (i *kvChecksumIter) SeekGE(key []byte, flags base.SeekGEFlags) (*InternalKey, base.LazyValue) {
+	return i.verify(i.iter.SeekGE(key, flags))
+}
+
+// SeekPrefixGE implements internalIterator.SeekPrefixGE.
+func (i *kvChecksumIter) SeekPrefixGE(
+	prefix, key []byte, flags base.SeekGEFlags,
+) (*InternalKey, base.LazyValue) {
+	return i.verify(i.iter.SeekPrefixGE(prefix, key, flags))
+}
+
+// SeekLT implements internalIterator.SeekLT.
+func (i *kvChecksumIter) SeekLT(key []byte, flags base.SeekLTFlags) (*InternalKey, base.LazyValue) {
+	return i.verify(i.iter.SeekLT(key, flags))
+}
+
+// SeekPrefixLT implements internalIterator.SeekPrefixLT.
+func (i *kvChecksumIter) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*InternalKey, base.LazyValue) {
+	return i.verify(i.iter.SeekPrefixLT(prefix, key, flags))
+}
+
+// First implements internalIterator.First.
+func (i *kvChecksumIter) First() (*InternalKey, base.LazyValue) {
+	return i.verify(i.iter.First())
+}
+
+// Last implements internalIterator.Last.
+func (i *kvChecksumIter) Last() (*InternalKey, base.LazyValue) {
+	return i.verify(i.iter.Last())
+}
+
+// Next implements internalIterator.Next.
+func (i *kvChecksumIter) Next() (*InternalKey, base.LazyValue) {
+	return i.verify(i.iter.Next())
+}
+
+// NextPrefix implements (base.InternalIterator).NextPrefix.
+func (i *kvChecksumIter) NextPrefix(succKey []byte) (*InternalKey, base.LazyValue) {
+	return i.verify(i.iter.NextPrefix(succKey))
+}
+
+// Prev implements internalIterator.Prev.
+func (i *kvChecksumIter) Prev() (*InternalKey, base.LazyValue) {
+	return i.verify(i.iter.Prev())
+}
+
+// Error implements internalIterator.Error.
+func (i *kvChecksumIter) Error() error {
+	if i.err != nil {
+		return i.err
+	}
+	return i.iter.Error()
+}
+
+// MaybeFilteredKeys implements Iterator.MaybeFilteredKeys.
+func (i *kvChecksumIter) MaybeFilteredKeys() bool {
+	return i.iter.MaybeFilteredKeys()
+}
+
+// SetCloseHook implements Iterator.SetCloseHook. The hook is passed the
+// kvChecksumIter, rather than the iterator it wraps.
+func (i *kvChecksumIter) SetCloseHook(fn func(i Iterator) error) {
+	i.closeHook = fn
+}
+
+// Close implements internalIterator.Close.
+func (i *kvChecksumIter) Close() error {
+	var err error
+	if i.closeHook != nil {
+		err = i.closeHook(i)
+	}
+	err = firstError(err, i.iter.Close())
+	return firstError(i.err, err)
+}
+
+// SetBounds implements internalIterator.SetBounds.
+func (i *kvChecksumIter) SetBounds(lower, upper []byte) {
+	i.iter.SetBounds(lower, upper)
+}
+
+func (i *kvChecksumIter) String() string {
+	return i.iter.String()
+}
+
+// A value stored in a value block is returned by a kvChecksumIter as a
+// LazyValue whose handle is the length of the value handle, the value handle,
+// the value's key-value checksum, and the value's key, so that the value can
+// be verified when it's fetched, even after the iterator has moved on.
+func encodeKVChecksumHandle(
+	dst []byte, handle []byte, checksum base.KVChecksum, key InternalKey,
+) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(handle)))
+	dst = append(dst, handle...)
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(checksum))
+	dst = binary.LittleEndian.AppendUint64(dst, key.Trailer)
+	return append(dst, key.UserKey...)
+}
+
+func decodeKVChecksumHandle(
+	b []byte,
+) (handle []byte, checksum base.KVChecksum, key InternalKey, ok bool) {
+	n, m := binary.Uvarint(b)
+	if m <= 0 || uint64(len(b)-m) < n+2*8 {
+		return nil, 0, InternalKey{}, false
+	}
+	b = b[m:]
+	handle, b = b[:n], b[n:]
+	checksum = base.KVChecksum(binary.LittleEndian.Uint64(b))
+	key.Trailer = binary.LittleEndian.Uint64(b[8:])
+	key.UserKey = b[16:]
+	return handle, checksum, key, true
+}
+
+// kvChecksumFetcher fetches the values stored in value blocks that are
+// returned by a kvChecksumIter, and verifies their checksums.
+type kvChecksumFetcher struct {
+	// fetcher fetches the values from value blocks.
+	fetcher base.ValueFetcher
+	fileNum base.DiskFileNum
+}
+
+// kvChecksumFetcher implements the base.ValueFetcher interface.
+var _ base.ValueFetcher = (*kvChecksumFetcher)(nil)
+
+// Fetch implements base.ValueFetcher.
+func (f *kvChecksumFetcher) Fetch(
+	handle []byte, valLen int32, buf []byte,
+) (val []byte, callerOwned bool, err error) {
+	handle, checksum, key, ok := decodeKVChecksumHandle(handle)
+	if !ok {
+		return nil, false, base.CorruptionErrorf("pebble/table: invalid value handle in table %s",
+			errors.Safe(f.fileNum))
+	}
+	val, callerOwned, err = f.fetcher.Fetch(handle, valLen, buf)
+	if err != nil {
+		return nil, false, err
+	}
+	if base.MakeKVChecksum(key.Kind(), key.UserKey, val) != checksum {
+		return nil, false, base.KVChecksumMismatchError(key, f.location())
+	}
+	return val, callerOwned, nil
+}
+
+func (f *kvChecksumFetcher) location() string {
+	return fmt.Sprintf("table %s", f.fileNum)
+}
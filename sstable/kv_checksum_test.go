@@ -0,0 +1,202 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVChecksums(t *testing.T) {
+	// writeTable writes a table in which older versions of keys have their
+	// values stored in value blocks. The keys in corrupt are stored with
+	// checksums that don't match them.
+	writeTable := func(t *testing.T, o WriterOptions, corrupt ...string) (*Reader, *WriterMetadata) {
+		f := &memFile{}
+		o.Comparer = testkeys.Comparer
+		o.TableFormat = TableFormatPebblev8
+		w := NewWriter(f, o)
+		for i := 0; i < 500; i++ {
+			for _, suffix := range []string{"@2", "@1"} {
+				k := base.MakeInternalKey([]byte(fmt.Sprintf("key-%04d%s", i, suffix)), 1, InternalKeyKindSet)
+				v := []byte(fmt.Sprintf("value-%s", k.UserKey))
+				checksum := base.MakeKVChecksum(k.Kind(), k.UserKey, v)
+				for _, c := range corrupt {
+					if c == string(k.UserKey) {
+						checksum++
+					}
+				}
+				require.NoError(t, w.addPoint(k, v, &checksum))
+			}
+			if i%10 == 0 {
+				k := base.MakeInternalKey([]byte(fmt.Sprintf("key-%04d-del", i)), 1, InternalKeyKindDelete)
+				require.NoError(t, w.Add(k, nil))
+			}
+		}
+		require.NoError(t, w.DeleteRange([]byte("a"), []byte("b")))
+		require.NoError(t, w.Close())
+		meta, err := w.Metadata()
+		require.NoError(t, err)
+		r, err := NewMemReader(f.Data(), ReaderOptions{Comparer: testkeys.Comparer})
+		require.NoError(t, err)
+		return r, meta
+	}
+	// scan iterates over all the keys and values, returning the number of
+	// keys and the first error.
+	scan := func(t *testing.T, iter Iterator) (int, error) {
+		var n int
+		for k, v := iter.First(); k != nil; k, v = iter.Next() {
+			value, _, err := v.Value(nil)
+			if err != nil {
+				return n, firstError(err, iter.Close())
+			}
+			if k.Kind() == InternalKeyKindSet {
+				require.Equal(t, fmt.Sprintf("value-%s", k.UserKey), string(value))
+			}
+			checksum, ok := iter.(base.KVChecksumIterator).KVChecksum()
+			require.True(t, ok)
+			require.Equal(t, base.MakeKVChecksum(k.Kind(), k.UserKey, value), checksum)
+			n++
+		}
+		return n, iter.Close()
+	}
+	requireMismatch := func(t *testing.T, err error, key string) {
+		require.True(t, errors.Is(err, base.ErrCorruption))
+		require.Contains(t, err.Error(), "key-value checksum mismatch for key "+key)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		r, _ := writeTable(t, WriterOptions{})
+		defer r.Close()
+		require.False(t, r.Properties.KVChecksums)
+		iter, err := r.NewIter(nil, nil)
+		require.NoError(t, err)
+		_, isKVChecksumIter := iter.(*kvChecksumIter)
+		require.False(t, isKVChecksumIter)
+		require.NoError(t, iter.Close())
+	})
+
+	t.Run("add", func(t *testing.T) {
+		// A key added with a checksum that doesn't match it isn't written.
+		w := NewWriter(&memFile{}, WriterOptions{TableFormat: TableFormatPebblev8, KVChecksums: true})
+		k := base.MakeInternalKey([]byte("a"), 1, InternalKeyKindSet)
+		checksum := base.MakeKVChecksum(k.Kind(), k.UserKey, []byte("b"))
+		require.NoError(t, w.AddWithKVChecksum(k, []byte("b"), checksum))
+		k = base.MakeInternalKey([]byte("b"), 1, InternalKeyKindSet)
+		requireMismatch(t, w.AddWithKVChecksum(k, []byte("c"), checksum), "b#1,1")
+		require.Error(t, w.Close())
+	})
+
+	t.Run("old-format", func(t *testing.T) {
+		// Readers of formats before TableFormatPebblev8 would return the
+		// checksums as part of the values.
+		w := NewWriter(&memFile{}, WriterOptions{TableFormat: TableFormatPebblev7, KVChecksums: true})
+		err := w.Close()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "key-value checksums require (Pebble,v8)")
+	})
+
+	for _, indexBlockSize := range []int{1 << 20, 256} {
+		o := WriterOptions{
+			BlockSize:      256,
+			IndexBlockSize: indexBlockSize,
+			KVChecksums:    true,
+		}
+		t.Run(fmt.Sprintf("index-block-size=%d", indexBlockSize), func(t *testing.T) {
+			r, meta := writeTable(t, o)
+			defer r.Close()
+			require.True(t, r.Properties.KVChecksums)
+			require.NotZero(t, r.Properties.NumValueBlocks)
+			require.Equal(t, indexBlockSize == 256, r.Properties.IndexPartitions > 0)
+
+			iter, err := r.NewIter(nil, nil)
+			require.NoError(t, err)
+			n, err := scan(t, iter)
+			require.NoError(t, err)
+			require.Equal(t, 1050, n)
+			var bytesIterated uint64
+			iter, err = r.NewCompactionIter(&bytesIterated, TrivialReaderProvider{Reader: r})
+			require.NoError(t, err)
+			n, err = scan(t, iter)
+			require.NoError(t, err)
+			require.Equal(t, 1050, n)
+
+			// Iterators over virtual sstables verify the checksums too.
+			physical := &manifest.FileMetadata{
+				FileNum:        1,
+				Size:           meta.Size,
+				SmallestSeqNum: meta.SmallestSeqNum,
+				LargestSeqNum:  meta.LargestSeqNum,
+			}
+			physical.ExtendPointKeyBounds(r.Compare, meta.SmallestPoint, meta.LargestPoint)
+			physical.InitPhysicalBacking()
+			r.fileNum = physical.FileBacking.DiskFileNum
+			virtual := &manifest.FileMetadata{
+				FileNum:        2,
+				FileBacking:    physical.FileBacking,
+				SmallestSeqNum: meta.SmallestSeqNum,
+				LargestSeqNum:  meta.LargestSeqNum,
+				Virtual:        true,
+			}
+			virtual.ExtendPointKeyBounds(r.Compare,
+				base.MakeInternalKey([]byte("key-0100"), base.InternalKeySeqNumMax, InternalKeyKindSet),
+				base.MakeInternalKey([]byte("key-0199@1"), 1, InternalKeyKindSet))
+			v := MakeVirtualReader(r, virtual.VirtualMeta())
+			iter, err = v.NewCompactionIter(&bytesIterated, TrivialReaderProvider{Reader: r})
+			require.NoError(t, err)
+			n, err = scan(t, iter)
+			require.NoError(t, err)
+			require.Equal(t, 210, n)
+
+			// Keys that don't match their checksums are detected by every
+			// iterator, whether their values are stored with them or in value
+			// blocks.
+			for _, key := range []string{"key-0123@2", "key-0123@1"} {
+				t.Run(key, func(t *testing.T) {
+					r, _ := writeTable(t, o, key)
+					defer r.Close()
+					r.fileNum = physical.FileBacking.DiskFileNum
+					v := MakeVirtualReader(r, virtual.VirtualMeta())
+					for _, newIter := range []func() (Iterator, error){
+						func() (Iterator, error) { return r.NewIter(nil, nil) },
+						func() (Iterator, error) {
+							return r.NewCompactionIter(&bytesIterated, TrivialReaderProvider{Reader: r})
+						},
+						func() (Iterator, error) {
+							return v.NewCompactionIter(&bytesIterated, TrivialReaderProvider{Reader: r})
+						},
+					} {
+						iter, err := newIter()
+						require.NoError(t, err)
+						_, err = scan(t, iter)
+						requireMismatch(t, err, key+"#1,1")
+					}
+
+					// Point reads verify the key they find.
+					iter, err := r.NewIter(nil, nil)
+					require.NoError(t, err)
+					k, val := iter.SeekPrefixGE([]byte("key-0123"), []byte(key), base.SeekGEFlagsNone)
+					if k != nil {
+						// The value is stored in a value block, and verified
+						// when it's fetched.
+						require.Equal(t, key, string(k.UserKey))
+						_, _, err = val.Value(nil)
+						requireMismatch(t, err, key+"#1,1")
+						require.NoError(t, iter.Close())
+					} else {
+						requireMismatch(t, iter.Error(), key+"#1,1")
+						require.Error(t, iter.Close())
+					}
+				})
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@
 package sstable
 
 import (
+	"time"
+
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
 )
@@ -18,6 +20,22 @@ const (
 	NoCompression
 	SnappyCompression
 	ZstdCompression
+	// ZstdDictionaryCompression compresses data and value blocks with zstd
+	// against a dictionary trained from samples of the table's blocks, and
+	// stored within the table. Other blocks, and blocks written before
+	// sufficient samples have been collected, are compressed with
+	// ZstdCompression. It requires TableFormatPebblev5, and falls back to
+	// ZstdCompression for older table formats.
+	ZstdDictionaryCompression
+	// LZ4Compression compresses blocks with the LZ4 block format, which is
+	// faster but compresses less than zstd. It requires TableFormatPebblev6,
+	// and falls back to SnappyCompression for older table formats.
+	LZ4Compression
+	// AdaptiveCompression compresses data and value blocks with snappy, or
+	// with zstd if configured with a zstd CPU budget that it fits within, and
+	// skips compressing blocks when compressing the preceding blocks didn't
+	// pay off. Other blocks are compressed with snappy.
+	AdaptiveCompression
 	NCompression
 )
 
@@ -31,6 +49,12 @@ func (c Compression) String() string {
 		return "Snappy"
 	case ZstdCompression:
 		return "ZSTD"
+	case ZstdDictionaryCompression:
+		return "ZSTDDictionary"
+	case LZ4Compression:
+		return "LZ4"
+	case AdaptiveCompression:
+		return "Adaptive"
 	default:
 		return "Unknown"
 	}
@@ -50,6 +74,9 @@ type FilterWriter = base.FilterWriter
 // FilterPolicy exports the base.FilterPolicy type.
 type FilterPolicy = base.FilterPolicy
 
+// TunableFilterPolicy exports the base.TunableFilterPolicy type.
+type TunableFilterPolicy = base.TunableFilterPolicy
+
 // TablePropertyCollector provides a hook for collecting user-defined
 // properties based on the keys and values stored in an sstable. A new
 // TablePropertyCollector is created for an sstable when the sstable is being
@@ -123,6 +150,18 @@ type ReaderOptions struct {
 
 	// Logger is an optional logger and tracer.
 	LoggerAndTracer base.LoggerAndTracer
+
+	// Tracer, if set, receives a span for every block read from storage
+	// because it wasn't in the block cache, by an operation whose context
+	// holds a span marked by base.ContextWithTracedSpan. The span of the read
+	// is a child of the operation's span. Reads under other contexts, such as
+	// those of compactions and table opens, aren't traced.
+	Tracer base.Tracer
+
+	// EncryptionKeys returns the secret of the encryption key with the given
+	// ID, for reading tables written with WriterOptions.Encryption. Opening an
+	// encrypted table fails if it's nil.
+	EncryptionKeys func(keyID string) ([]byte, error)
 }
 
 func (o ReaderOptions) ensureDefaults() ReaderOptions {
@@ -178,6 +217,25 @@ type WriterOptions struct {
 	// The default value (DefaultCompression) uses snappy compression.
 	Compression Compression
 
+	// CompressionLevel is the compression level used by the Compression
+	// algorithm. Zstd supports levels 1 through 22, and LZ4 levels 1 through 9,
+	// which select its high compression mode. Snappy has no levels. Higher
+	// levels compress more slowly, but produce smaller blocks. Without cgo,
+	// zstd levels are mapped onto the pure Go implementation's four encoder
+	// levels. The compression level doesn't affect how blocks are decompressed.
+	//
+	// The default value (0) uses the algorithm's default level.
+	CompressionLevel int
+
+	// AdaptiveZstdBudget is the additional CPU time AdaptiveCompression may
+	// spend compressing blocks with zstd rather than snappy, per KB of
+	// compressed size saved. AdaptiveCompression periodically compresses a
+	// block with both algorithms, and compresses subsequent blocks with zstd if
+	// it's within the budget. Zstd uses the CompressionLevel.
+	//
+	// The default value (0) compresses blocks with snappy.
+	AdaptiveZstdBudget time.Duration
+
 	// FilterPolicy defines a filter algorithm (such as a Bloom filter) that can
 	// reduce disk reads for Get calls.
 	//
@@ -196,6 +254,19 @@ type WriterOptions struct {
 	// filters should be preferred except under constrained memory situations.
 	FilterType FilterType
 
+	// RangeFilterPrefixLen, if positive, configures the Writer to write a
+	// range filter using the FilterPolicy, over the first RangeFilterPrefixLen
+	// bytes of each key prefix. Range filters allow iterators with bounds
+	// confined to a few truncated prefixes to skip tables that contain no keys
+	// within the bounds. The prefix length should be chosen such that short
+	// scans are confined to a handful of truncated prefixes, while the number
+	// of distinct truncated prefixes per table remains large. Range filters
+	// require a Comparer that declares Comparer.BytewisePrefixOrdering, and
+	// are ignored if the Comparer doesn't, or if FilterPolicy is nil.
+	//
+	// The default value (0) disables range filters.
+	RangeFilterPrefixLen int
+
 	// IndexBlockSize is the target uncompressed size in bytes of each index
 	// block. When the index block size is larger than this target, two-level
 	// indexes are automatically enabled. Setting this option to a large value
@@ -205,6 +276,16 @@ type WriterOptions struct {
 	// The default value is the value of BlockSize.
 	IndexBlockSize int
 
+	// PartitionFilters configures the Writer to partition the table filter
+	// into blocks aligned with the partitions of a two-level index, along with
+	// a top-level filter index on them. A Reader pins the top-level index and
+	// filter index, and loads filter partitions into the block cache on demand,
+	// rather than loading a large table's filter whole. Tables that end up
+	// with a single-level index are written with an unpartitioned filter.
+	//
+	// The default value (false) writes unpartitioned filters.
+	PartitionFilters bool
+
 	// Merger defines the associative merge operation to use for merging values
 	// written with {Batch,DB}.Merge. The MergerName is checked for consistency
 	// with the value stored in the sstable when it was written.
@@ -241,6 +322,17 @@ type WriterOptions struct {
 	// RequiredInPlaceValueBound mirrors
 	// Options.Experimental.RequiredInPlaceValueBound.
 	RequiredInPlaceValueBound UserKeyPrefixBound
+
+	// Encryption, if set, is the key with which the table's blocks are
+	// encrypted. See EncryptionKey. It requires TableFormatPebblev7 or later.
+	Encryption *EncryptionKey
+
+	// KVChecksums, if set, stores the key-value checksum of each point key
+	// with its value (see base.KVChecksum). Iterators over the table verify
+	// the checksums of the values they return, including values stored in
+	// value blocks, which are verified when they're fetched. It requires
+	// TableFormatPebblev8 or later.
+	KVChecksums bool
 }
 
 func (o WriterOptions) ensureDefaults() WriterOptions {
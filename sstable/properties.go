@@ -73,12 +73,21 @@ type Properties struct {
 	CreationTime uint64 `prop:"rocksdb.creation.time"`
 	// The total size of all data blocks.
 	DataSize uint64 `prop:"rocksdb.data.size"`
+	// The ID of the key with which the table's blocks are encrypted. Empty if
+	// the table isn't encrypted.
+	EncryptionKeyID string `prop:"pebble.encryption.key-id"`
+	// The random ID of an encrypted table, which is authenticated with each of
+	// its blocks. Empty if the table isn't encrypted.
+	EncryptionTableID string `prop:"pebble.encryption.table-id"`
 	// The external sstable version format. Version 2 is the one RocksDB has been
 	// using since 5.13. RocksDB only uses the global sequence number for an
 	// sstable if this property has been set.
 	ExternalFormatVersion uint32 `prop:"rocksdb.external_sst_file.version"`
 	// Actual SST file creation time. 0 means unknown.
 	FileCreationTime uint64 `prop:"rocksdb.file.creation.time"`
+	// The number of partitions of the table filter. 0 if the filter is not
+	// partitioned.
+	FilterPartitions uint64 `prop:"pebble.filter.partitions"`
 	// The name of the filter policy used in this table. Empty if no filter
 	// policy is used.
 	FilterPolicyName string `prop:"rocksdb.filter.policy"`
@@ -101,6 +110,9 @@ type Properties struct {
 	IndexType uint32 `prop:"rocksdb.block.based.table.index.type"`
 	// Whether delta encoding is used to encode the index values.
 	IndexValueIsDeltaEncoded uint64 `prop:"rocksdb.index.value.is.delta.encoded"`
+	// Whether the key-value checksum of each point key is stored with its
+	// value. See WriterOptions.KVChecksums.
+	KVChecksums bool `prop:"pebble.kv-checksums"`
 	// The name of the merger used in this table. Empty if no merger is used.
 	MergerName string `prop:"rocksdb.merge.operator"`
 	// The number of blocks in this table.
@@ -137,6 +149,9 @@ type Properties struct {
 	// A comma separated list of names of the property collectors used in this
 	// table.
 	PropertyCollectorNames string `prop:"rocksdb.property.collectors"`
+	// The number of bytes of each key prefix stored in the table's range
+	// filter. 0 if the table has no range filter.
+	RangeFilterPrefixLen uint64 `prop:"pebble.range-filter.prefix-len"`
 	// Total raw key size.
 	RawKeySize uint64 `prop:"rocksdb.raw.key.size"`
 	// Total raw key size of point deletion tombstones. This value is comparable
@@ -328,6 +343,12 @@ func (p *Properties) save(tblFormat TableFormat, w *rawBlockWriter) {
 	}
 	p.saveUvarint(m, unsafe.Offsetof(p.CreationTime), p.CreationTime)
 	p.saveUvarint(m, unsafe.Offsetof(p.DataSize), p.DataSize)
+	if p.EncryptionKeyID != "" {
+		p.saveString(m, unsafe.Offsetof(p.EncryptionKeyID), p.EncryptionKeyID)
+	}
+	if p.EncryptionTableID != "" {
+		p.saveString(m, unsafe.Offsetof(p.EncryptionTableID), p.EncryptionTableID)
+	}
 	if p.ExternalFormatVersion != 0 {
 		p.saveUint32(m, unsafe.Offsetof(p.ExternalFormatVersion), p.ExternalFormatVersion)
 		p.saveUint64(m, unsafe.Offsetof(p.GlobalSeqNum), p.GlobalSeqNum)
@@ -335,6 +356,9 @@ func (p *Properties) save(tblFormat TableFormat, w *rawBlockWriter) {
 	if p.FileCreationTime > 0 {
 		p.saveUvarint(m, unsafe.Offsetof(p.FileCreationTime), p.FileCreationTime)
 	}
+	if p.FilterPartitions > 0 {
+		p.saveUvarint(m, unsafe.Offsetof(p.FilterPartitions), p.FilterPartitions)
+	}
 	if p.FilterPolicyName != "" {
 		p.saveString(m, unsafe.Offsetof(p.FilterPolicyName), p.FilterPolicyName)
 	}
@@ -349,6 +373,9 @@ func (p *Properties) save(tblFormat TableFormat, w *rawBlockWriter) {
 	p.saveUvarint(m, unsafe.Offsetof(p.IndexSize), p.IndexSize)
 	p.saveUint32(m, unsafe.Offsetof(p.IndexType), p.IndexType)
 	p.saveUvarint(m, unsafe.Offsetof(p.IndexValueIsDeltaEncoded), p.IndexValueIsDeltaEncoded)
+	if p.KVChecksums {
+		p.saveBool(m, unsafe.Offsetof(p.KVChecksums), p.KVChecksums)
+	}
 	if p.MergerName != "" {
 		p.saveString(m, unsafe.Offsetof(p.MergerName), p.MergerName)
 	}
@@ -391,7 +418,12 @@ func (p *Properties) save(tblFormat TableFormat, w *rawBlockWriter) {
 	if p.PropertyCollectorNames != "" {
 		p.saveString(m, unsafe.Offsetof(p.PropertyCollectorNames), p.PropertyCollectorNames)
 	}
-	if p.SnapshotPinnedKeys > 0 {
+	if p.RangeFilterPrefixLen > 0 {
+		p.saveUvarint(m, unsafe.Offsetof(p.RangeFilterPrefixLen), p.RangeFilterPrefixLen)
+	}
+	// Tables of TableFormatPebblev8 or later always record the number of
+	// snapshot pinned keys, so that a zero count can be trusted.
+	if p.SnapshotPinnedKeys > 0 || tblFormat >= TableFormatPebblev8 {
 		p.saveUvarint(m, unsafe.Offsetof(p.SnapshotPinnedKeys), p.SnapshotPinnedKeys)
 		p.saveUvarint(m, unsafe.Offsetof(p.SnapshotPinnedKeySize), p.SnapshotPinnedKeySize)
 		p.saveUvarint(m, unsafe.Offsetof(p.SnapshotPinnedValueSize), p.SnapshotPinnedValueSize)
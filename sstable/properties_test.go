@@ -69,6 +69,7 @@ func TestPropertiesSave(t *testing.T) {
 		CreationTime:             2,
 		DataSize:                 3,
 		ExternalFormatVersion:    4,
+		FilterPartitions:         30,
 		FilterPolicyName:         "filter policy name",
 		FilterSize:               5,
 		FixedKeyLen:              6,
@@ -94,6 +95,7 @@ func TestPropertiesSave(t *testing.T) {
 		PrefixExtractorName:      "prefix extractor name",
 		PrefixFiltering:          true,
 		PropertyCollectorNames:   "prefix collector names",
+		RangeFilterPrefixLen:     29,
 		RawKeySize:               25,
 		RawValueSize:             26,
 		TopLevelIndexSize:        27,
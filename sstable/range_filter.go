@@ -0,0 +1,142 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"bytes"
+	"context"
+)
+
+// Range filters
+//
+// A table's range filter allows iterators to skip tables that contain no point
+// keys within a short key range, such as the bounds [a, a+1000) of a short
+// scan. Bloom filters only help prefix seeks. The range filter is a second
+// table filter, written using the table's FilterPolicy, over the first
+// WriterOptions.RangeFilterPrefixLen bytes of each point key's prefix (see
+// Comparer.Split).
+//
+// The truncated prefixes of the keys within a range [lower, upper] are
+// confined to a handful of values when the truncated prefixes of lower and
+// upper differ in at most their last byte. Such a range is checked by probing
+// the filter with each of those values. Wider ranges aren't checked. For
+// example, with a prefix length of 4, the range ["user0010", "user0020")
+// probes "user", and the range ["ab00", "ab05") probes "ab00" through "ab05".
+//
+// The range filter relies on the Comparer ordering key prefixes bytewise, as
+// DefaultComparer does. Range filters are neither written nor used with
+// comparers that don't declare Comparer.BytewisePrefixOrdering.
+
+// rangeFilterMaxProbes is the maximum number of truncated prefixes probed by a
+// range filter check. Ranges spanning more truncated prefixes aren't checked.
+const rangeFilterMaxProbes = 16
+
+type rangeFilterWriter struct {
+	policy    FilterPolicy
+	writer    FilterWriter
+	prefixLen int
+	// last is the last truncated prefix added to the filter. Keys are added in
+	// sorted order, so repeated truncated prefixes are adjacent.
+	last []byte
+	// count is the count of the number of truncated prefixes added to the
+	// filter.
+	count int
+}
+
+func newRangeFilterWriter(policy FilterPolicy, prefixLen int) *rangeFilterWriter {
+	return &rangeFilterWriter{
+		policy:    policy,
+		writer:    policy.NewWriter(TableFilter),
+		prefixLen: prefixLen,
+	}
+}
+
+func (f *rangeFilterWriter) addPrefix(prefix []byte) {
+	if len(prefix) > f.prefixLen {
+		prefix = prefix[:f.prefixLen]
+	}
+	if f.count > 0 && bytes.Equal(prefix, f.last) {
+		return
+	}
+	f.last = append(f.last[:0], prefix...)
+	f.count++
+	f.writer.AddKey(prefix)
+}
+
+func (f *rangeFilterWriter) finish() ([]byte, error) {
+	if f.count == 0 {
+		return nil, nil
+	}
+	return f.writer.Finish(nil), nil
+}
+
+func (f *rangeFilterWriter) metaName() string {
+	return metaRangeFilterPrefix + f.policy.Name()
+}
+
+type rangeFilterReader struct {
+	policy    FilterPolicy
+	prefixLen int
+	metrics   *FilterMetricsTracker
+}
+
+// rangeFilterProbes returns the truncated prefix of lower, and the range of
+// values [from, to] of its last byte, that are the truncated prefixes of all
+// the keys with prefixes within [lower, upper]. It returns ok=false if the
+// range spans more than rangeFilterMaxProbes truncated prefixes.
+func rangeFilterProbes(lower, upper []byte, prefixLen int) (probe []byte, from, to byte, ok bool) {
+	if prefixLen == 0 || len(lower) < prefixLen || len(upper) < prefixLen {
+		return nil, 0, 0, false
+	}
+	n := prefixLen - 1
+	if !bytes.Equal(lower[:n], upper[:n]) || lower[n] > upper[n] ||
+		int(upper[n])-int(lower[n]) >= rangeFilterMaxProbes {
+		return nil, 0, 0, false
+	}
+	return lower[:prefixLen], lower[n], upper[n], true
+}
+
+// RangeMayContainPointKeys returns false if the table's range filter
+// determines that the table contains no point keys k with lower <= k <= upper.
+// It returns true if the table may contain such keys, if the table has no
+// range filter, or if the range is too wide to be checked. Since the check is
+// conservative, an exclusive upper bound may also be passed.
+//
+// Checks are recorded in the Reader's FilterMetricsTracker, and in metrics if
+// it's non-nil (see IterOptions.FilterMetrics).
+func (r *Reader) RangeMayContainPointKeys(
+	ctx context.Context, lower, upper []byte, metrics *FilterMetricsTracker,
+) (bool, error) {
+	if r.err != nil {
+		return false, r.err
+	}
+	if r.rangeFilter == nil {
+		return true, nil
+	}
+	if r.Split != nil {
+		lower = lower[:r.Split(lower)]
+		upper = upper[:r.Split(upper)]
+	}
+	probe, from, to, ok := rangeFilterProbes(lower, upper, r.rangeFilter.prefixLen)
+	if !ok {
+		return true, nil
+	}
+	h, err := r.readRangeFilter(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer h.Release()
+
+	var buf [64]byte
+	probe = append(buf[:0], probe...)
+	mayContain := false
+	for c := int(from); c <= int(to) && !mayContain; c++ {
+		probe[len(probe)-1] = byte(c)
+		mayContain = r.rangeFilter.policy.MayContain(TableFilter, h.Get(), probe)
+	}
+	r.rangeFilter.metrics.recordRangeCheck(mayContain)
+	metrics.recordRangeCheck(mayContain)
+	return mayContain, nil
+}
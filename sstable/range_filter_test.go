@@ -0,0 +1,133 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble/bloom"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangeFilterProbes(t *testing.T) {
+	testCases := []struct {
+		lower, upper string
+		prefixLen    int
+		expected     string
+	}{
+		{"user0010", "user0020", 4, "user-user"},
+		{"ab00", "ab05", 4, "ab00-ab05"},
+		{"ab00", "ab0\xff", 4, "none"},
+		{"ab0a", "ab0p", 4, "ab0a-ab0p"},
+		{"ab0a", "ab0q", 4, "none"},
+		{"ab00", "ac00", 4, "none"},
+		{"ab05", "ab00", 4, "none"},
+		{"ab", "ab05", 4, "none"},
+		{"ab05", "ab", 4, "none"},
+		{"ab05", "ab05", 0, "none"},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%q-%q", tc.lower, tc.upper), func(t *testing.T) {
+			probe, from, to, ok := rangeFilterProbes([]byte(tc.lower), []byte(tc.upper), tc.prefixLen)
+			got := "none"
+			if ok {
+				first := append([]byte(nil), probe...)
+				last := append([]byte(nil), probe...)
+				first[len(first)-1], last[len(last)-1] = from, to
+				got = fmt.Sprintf("%s-%s", first, last)
+			}
+			require.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestReaderRangeFilter(t *testing.T) {
+	policy := bloom.FilterPolicy(10)
+	for _, prefixLen := range []int{0, 3} {
+		t.Run(fmt.Sprintf("prefixLen=%d", prefixLen), func(t *testing.T) {
+			mem := vfs.NewMem()
+			f0, err := mem.Create("test")
+			require.NoError(t, err)
+			w := NewWriter(objstorageprovider.NewFileWritable(f0), WriterOptions{
+				FilterPolicy:         policy,
+				FilterType:           base.TableFilter,
+				RangeFilterPrefixLen: prefixLen,
+			})
+			// Write the keys 0000, 0100, ..., 9900, with truncated prefixes 000,
+			// 010, ..., 990.
+			for i := 0; i < 10000; i += 100 {
+				require.NoError(t, w.Set([]byte(fmt.Sprintf("%04d", i)), nil))
+			}
+			require.NoError(t, w.Close())
+
+			f1, err := mem.Open("test")
+			require.NoError(t, err)
+			var tracker FilterMetricsTracker
+			r, err := newReader(f1, ReaderOptions{
+				Filters: map[string]FilterPolicy{policy.Name(): policy},
+			}, &tracker)
+			require.NoError(t, err)
+			defer r.Close()
+			require.Equal(t, uint64(prefixLen), r.Properties.RangeFilterPrefixLen)
+
+			l, err := r.Layout()
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			l.Describe(&buf, false, r, nil)
+			require.Equal(t, prefixLen > 0, strings.Contains(buf.String(), "range-filter"))
+
+			var iterTracker FilterMetricsTracker
+			ctx := context.Background()
+			check := func(lower, upper string) bool {
+				mayContain, err := r.RangeMayContainPointKeys(ctx, []byte(lower), []byte(upper), &iterTracker)
+				require.NoError(t, err)
+				return mayContain
+			}
+			// Ranges that are checked.
+			require.True(t, check("0100", "0100"))
+			require.True(t, check("0101", "0109"))
+			require.True(t, check("0000", "0050"))
+			require.Equal(t, prefixLen == 0, check("0010", "0030"))
+			require.Equal(t, prefixLen == 0, check("0110", "0199"))
+			require.Equal(t, prefixLen == 0, check("99991", "99995"))
+			// Ranges that are too wide to be checked.
+			require.True(t, check("0095", "0105"))
+			require.True(t, check("0010", "0200"))
+			require.True(t, check("0010", "1000"))
+
+			m := tracker.Load()
+			require.Equal(t, m, iterTracker.Load())
+			if prefixLen > 0 {
+				require.Equal(t, int64(3), m.RangeHits)
+				require.Equal(t, int64(3), m.RangeMisses)
+			} else {
+				require.Zero(t, m.RangeHits+m.RangeMisses)
+			}
+
+			// Readers ignore range filters if the comparer doesn't declare that
+			// it orders prefixes bytewise.
+			comparer := *base.DefaultComparer
+			comparer.BytewisePrefixOrdering = false
+			f2, err := mem.Open("test")
+			require.NoError(t, err)
+			r2, err := newReader(f2, ReaderOptions{
+				Comparer: &comparer,
+				Filters:  map[string]FilterPolicy{policy.Name(): policy},
+			}, &tracker)
+			require.NoError(t, err)
+			defer r2.Close()
+			mayContain, err := r2.RangeMayContainPointKeys(ctx, []byte("0010"), []byte("0030"), &iterTracker)
+			require.NoError(t, err)
+			require.True(t, mayContain)
+		})
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"os"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
@@ -323,6 +324,12 @@ type singleLevelIterator struct {
 	// is high).
 	useFilter              bool
 	lastBloomFilterMatched bool
+	// filterMetrics, if non-nil, records the iterator's filter checks in
+	// addition to the reader's metrics. See IterOptions.FilterMetrics.
+	filterMetrics *FilterMetricsTracker
+	// dataCachePriority is the block cache priority of the iterator's data and
+	// value block reads. See WithDataBlockCachePriority.
+	dataCachePriority cache.Priority
 }
 
 // singleLevelIterator implements the base.InternalIterator interface.
@@ -425,6 +432,7 @@ func (i *singleLevelIterator) init(
 	i.upper = upper
 	i.bpfs = filterer
 	i.useFilter = useFilter
+	i.dataCachePriority = dataCachePriorityFromContext(ctx)
 	i.reader = r
 	i.cmp = r.Compare
 	i.stats = stats
@@ -462,8 +470,10 @@ func (i *singleLevelIterator) init(
 }
 
 // setupForCompaction sets up the singleLevelIterator for use with compactionIter.
-// Currently, it skips readahead ramp-up. It should be called after init is called.
+// Currently, it skips readahead ramp-up and reads data blocks with low cache
+// priority. It should be called after init is called.
 func (i *singleLevelIterator) setupForCompaction() {
+	i.dataCachePriority = cache.LowPriority
 	i.dataRH.SetupForCompaction()
 	if i.vbRH != nil {
 		i.vbRH.SetupForCompaction()
@@ -561,7 +571,7 @@ func (i *singleLevelIterator) loadBlock(dir int8) loadBlockResult {
 		// blockIntersects
 	}
 	ctx := objiotracing.WithBlockType(i.ctx, objiotracing.DataBlock)
-	block, err := i.reader.readBlock(ctx, i.dataBH, nil /* transform */, i.dataRH, i.stats)
+	block, err := i.reader.readBlock(ctx, i.dataBH, nil /* transform */, i.dataRH, i.stats, i.dataCachePriority)
 	if err != nil {
 		i.err = err
 		return loadBlockFailed
@@ -582,7 +592,7 @@ func (i *singleLevelIterator) readBlockForVBR(
 	ctx context.Context, h BlockHandle, stats *base.InternalIteratorStats,
 ) (cache.Handle, error) {
 	ctx = objiotracing.WithBlockType(ctx, objiotracing.ValueBlock)
-	return i.reader.readBlock(ctx, h, nil, i.vbRH, stats)
+	return i.reader.readBlock(ctx, h, nil, i.vbRH, stats, i.dataCachePriority)
 }
 
 // resolveMaybeExcluded is invoked when the block-property filterer has found
@@ -928,9 +938,23 @@ func (i *singleLevelIterator) SeekPrefixGE(
 		}
 	}
 	k, v := i.seekPrefixGE(prefix, key, flags, i.useFilter)
+	i.maybeRecordFilterFalsePositive(prefix, k)
 	return k, v
 }
 
+// maybeRecordFilterFalsePositive records a filter false positive if the
+// filter was checked and matched by the preceding prefix seek, but the seek
+// found no key with the prefix.
+func (i *singleLevelIterator) maybeRecordFilterFalsePositive(prefix []byte, k *InternalKey) {
+	if !i.useFilter || i.reader.tableFilter == nil || !i.lastBloomFilterMatched ||
+		i.err != nil || i.reader.Split == nil {
+		return
+	}
+	if k == nil || i.cmp(prefix, k.UserKey[:i.reader.Split(k.UserKey)]) != 0 {
+		i.reader.tableFilter.falsePositive(i.filterMetrics)
+	}
+}
+
 func (i *singleLevelIterator) seekPrefixGE(
 	prefix, key []byte, flags base.SeekGEFlags, checkFilter bool,
 ) (k *InternalKey, value base.LazyValue) {
@@ -947,14 +971,12 @@ func (i *singleLevelIterator) seekPrefixGE(
 		}
 		i.lastBloomFilterMatched = false
 		// Check prefix bloom filter.
-		var dataH cache.Handle
-		dataH, i.err = i.reader.readFilter(i.ctx, i.stats)
+		var mayContain bool
+		mayContain, i.err = i.reader.tableFilterMayContain(i.ctx, i.stats, prefix, key, i.filterMetrics)
 		if i.err != nil {
 			i.data.invalidate()
 			return nil, base.LazyValue{}
 		}
-		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), prefix)
-		dataH.Release()
 		if !mayContain {
 			// This invalidation may not be necessary for correctness, and may
 			// be a place to optimize later by reusing the already loaded
@@ -1142,6 +1164,47 @@ func (i *singleLevelIterator) SeekLT(
 	return i.skipBackward()
 }
 
+// SeekPrefixLT implements internalIterator.SeekPrefixLT, as documented in the
+// pebble package. Note that SeekPrefixLT only checks the lower bound. It is up
+// to the caller to ensure that key is less than or equal to the upper bound.
+func (i *singleLevelIterator) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	if !i.prefixMayMatch(prefix) {
+		return nil, base.LazyValue{}
+	}
+	return i.SeekLT(key, flags)
+}
+
+// prefixMayMatch consults the table filter, if there is one and the iterator
+// is configured to use it, and returns false if the sstable definitely does
+// not contain any key with the given prefix. If the filter cannot be read,
+// prefixMayMatch sets i.err and returns false.
+//
+// prefixMayMatch always clears lastBloomFilterMatched, since the iterator is
+// not positioned by a SeekPrefixGE after the subsequent positioning
+// operation.
+func (i *singleLevelIterator) prefixMayMatch(prefix []byte) bool {
+	i.err = nil // clear cached iteration error
+	i.lastBloomFilterMatched = false
+	if !i.useFilter || i.reader.tableFilter == nil {
+		return true
+	}
+	// Keys with the prefix sort at or after the prefix itself, so the prefix
+	// locates the filter partition to check, if the filter is partitioned.
+	mayContain, err := i.reader.tableFilterMayContain(i.ctx, i.stats, prefix, prefix, i.filterMetrics)
+	if err != nil {
+		i.err = err
+		i.data.invalidate()
+		return false
+	}
+	if !mayContain {
+		i.data.invalidate()
+		return false
+	}
+	return true
+}
+
 // First implements internalIterator.First, as documented in the pebble
 // package. Note that First only checks the upper bound. It is up to the caller
 // to ensure that key is greater than or equal to the lower bound (e.g. via a
@@ -1639,6 +1702,12 @@ func (i *compactionIterator) SeekLT(
 	panic("pebble: SeekLT unimplemented")
 }
 
+func (i *compactionIterator) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	panic("pebble: SeekPrefixLT unimplemented")
+}
+
 func (i *compactionIterator) First() (*InternalKey, base.LazyValue) {
 	i.err = nil // clear cached iteration error
 	return i.skipForward(i.singleLevelIterator.First())
@@ -1758,7 +1827,8 @@ func (i *twoLevelIterator) loadIndex(dir int8) loadBlockResult {
 		// blockIntersects
 	}
 	ctx := objiotracing.WithBlockType(i.ctx, objiotracing.MetadataBlock)
-	indexBlock, err := i.reader.readBlock(ctx, bhp.BlockHandle, nil /* transform */, nil /* readHandle */, i.stats)
+	indexBlock, err := i.reader.readBlock(
+		ctx, bhp.BlockHandle, nil /* transform */, nil /* readHandle */, i.stats, cache.HighPriority)
 	if err != nil {
 		i.err = err
 		return loadBlockFailed
@@ -1864,6 +1934,7 @@ func (i *twoLevelIterator) init(
 	i.upper = upper
 	i.bpfs = filterer
 	i.useFilter = useFilter
+	i.dataCachePriority = dataCachePriorityFromContext(ctx)
 	i.reader = r
 	i.cmp = r.Compare
 	i.stats = stats
@@ -2070,6 +2141,14 @@ func (i *twoLevelIterator) SeekGE(
 // to the caller to ensure that key is greater than or equal to the lower bound.
 func (i *twoLevelIterator) SeekPrefixGE(
 	prefix, key []byte, flags base.SeekGEFlags,
+) (*base.InternalKey, base.LazyValue) {
+	k, v := i.seekPrefixGE(prefix, key, flags)
+	i.maybeRecordFilterFalsePositive(prefix, k)
+	return k, v
+}
+
+func (i *twoLevelIterator) seekPrefixGE(
+	prefix, key []byte, flags base.SeekGEFlags,
 ) (*base.InternalKey, base.LazyValue) {
 	if i.vState != nil {
 		// Callers of SeekGE don't know about virtual sstable bounds, so we may
@@ -2108,14 +2187,12 @@ func (i *twoLevelIterator) SeekPrefixGE(
 			flags = flags.DisableTrySeekUsingNext()
 		}
 		i.lastBloomFilterMatched = false
-		var dataH cache.Handle
-		dataH, i.err = i.reader.readFilter(i.ctx, i.stats)
+		var mayContain bool
+		mayContain, i.err = i.reader.tableFilterMayContain(i.ctx, i.stats, prefix, key, i.filterMetrics)
 		if i.err != nil {
 			i.data.invalidate()
 			return nil, base.LazyValue{}
 		}
-		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), prefix)
-		dataH.Release()
 		if !mayContain {
 			// This invalidation may not be necessary for correctness, and may
 			// be a place to optimize later by reusing the already loaded
@@ -2356,6 +2433,18 @@ func (i *twoLevelIterator) SeekLT(
 	return i.skipBackward()
 }
 
+// SeekPrefixLT implements internalIterator.SeekPrefixLT, as documented in the
+// pebble package. Note that SeekPrefixLT only checks the lower bound. It is up
+// to the caller to ensure that key is less than or equal to the upper bound.
+func (i *twoLevelIterator) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	if !i.prefixMayMatch(prefix) {
+		return nil, base.LazyValue{}
+	}
+	return i.SeekLT(key, flags)
+}
+
 // First implements internalIterator.First, as documented in the pebble
 // package. Note that First only checks the upper bound. It is up to the caller
 // to ensure that key is greater than or equal to the lower bound (e.g. via a
@@ -2679,6 +2768,12 @@ func (i *twoLevelCompactionIterator) SeekLT(
 	panic("pebble: SeekLT unimplemented")
 }
 
+func (i *twoLevelCompactionIterator) SeekPrefixLT(
+	prefix, key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	panic("pebble: SeekPrefixLT unimplemented")
+}
+
 func (i *twoLevelCompactionIterator) First() (*InternalKey, base.LazyValue) {
 	i.err = nil // clear cached iteration error
 	return i.skipForward(i.twoLevelIterator.First())
@@ -2921,7 +3016,23 @@ func (v *VirtualReader) NewIterWithBlockPropertyFiltersAndContext(
 ) (Iterator, error) {
 	return v.reader.newIterWithBlockPropertyFiltersAndContext(
 		ctx,
-		lower, upper, filterer, useFilterBlock, stats, rp, &v.vState,
+		lower, upper, filterer, useFilterBlock, stats, rp, IterOptions{}, &v.vState,
+	)
+}
+
+// NewIterWithOptions wraps Reader.NewIterWithOptions.
+func (v *VirtualReader) NewIterWithOptions(
+	ctx context.Context,
+	lower, upper []byte,
+	filterer *BlockPropertiesFilterer,
+	useFilterBlock bool,
+	stats *base.InternalIteratorStats,
+	rp ReaderProvider,
+	opts IterOptions,
+) (Iterator, error) {
+	return v.reader.newIterWithBlockPropertyFiltersAndContext(
+		ctx,
+		lower, upper, filterer, useFilterBlock, stats, rp, opts, &v.vState,
 	)
 }
 
@@ -3030,8 +3141,10 @@ type Reader struct {
 	err               error
 	indexBH           BlockHandle
 	filterBH          BlockHandle
+	rangeFilterBH     BlockHandle
 	rangeDelBH        BlockHandle
 	rangeKeyBH        BlockHandle
+	zstdDictBH        BlockHandle
 	rangeDelTransform blockTransform
 	valueBIH          valueBlocksIndexHandle
 	propertiesBH      BlockHandle
@@ -3042,6 +3155,19 @@ type Reader struct {
 	FormatKey         base.FormatKey
 	Split             Split
 	tableFilter       *tableFilterReader
+	rangeFilter       *rangeFilterReader
+	// blockCipher decrypts the blocks of an encrypted table, other than the
+	// metaindex and properties blocks. It's nil if the table isn't encrypted.
+	blockCipher *blockCipher
+	// zstdDict is the table's zstd dictionary, if any. It's read and prepared
+	// once, when the table is opened, and held outside the block cache.
+	zstdDict *zstdDict
+	// unreserveZstdDict releases the reservation of the size of zstdDict in
+	// the block cache, if the table has a dictionary.
+	unreserveZstdDict func()
+	// pinned holds the index and filter blocks retained for the lifetime of
+	// the Reader, if any. See PinIndexAndFilterBlocks.
+	pinned atomic.Pointer[pinnedBlocks]
 	// Keep types that are not multiples of 8 bytes at the end and with
 	// decreasing size.
 	Properties    Properties
@@ -3053,6 +3179,13 @@ type Reader struct {
 
 // Close implements DB.Close, as documented in the pebble package.
 func (r *Reader) Close() error {
+	if p := r.pinned.Swap(nil); p != nil {
+		p.release()
+	}
+	if r.unreserveZstdDict != nil {
+		r.unreserveZstdDict()
+		r.unreserveZstdDict = nil
+	}
 	r.opts.Cache.Unref()
 
 	if r.readable != nil {
@@ -3080,7 +3213,7 @@ func (r *Reader) NewIterWithBlockPropertyFilters(
 ) (Iterator, error) {
 	return r.newIterWithBlockPropertyFiltersAndContext(
 		context.Background(),
-		lower, upper, filterer, useFilterBlock, stats, rp, nil,
+		lower, upper, filterer, useFilterBlock, stats, rp, IterOptions{}, nil,
 	)
 }
 
@@ -3097,7 +3230,33 @@ func (r *Reader) NewIterWithBlockPropertyFiltersAndContext(
 ) (Iterator, error) {
 	return r.newIterWithBlockPropertyFiltersAndContext(
 		ctx,
-		lower, upper, filterer, useFilterBlock, stats, rp, nil,
+		lower, upper, filterer, useFilterBlock, stats, rp, IterOptions{}, nil,
+	)
+}
+
+// IterOptions holds optional parameters of the iterators created by
+// NewIterWithOptions.
+type IterOptions struct {
+	// FilterMetrics, if non-nil, records the iterator's filter checks in
+	// addition to the FilterMetricsTracker passed to the Reader. It's used to
+	// track filter metrics per level.
+	FilterMetrics *FilterMetricsTracker
+}
+
+// NewIterWithOptions is similar to NewIterWithBlockPropertyFiltersAndContext
+// and additionally accepts IterOptions.
+func (r *Reader) NewIterWithOptions(
+	ctx context.Context,
+	lower, upper []byte,
+	filterer *BlockPropertiesFilterer,
+	useFilterBlock bool,
+	stats *base.InternalIteratorStats,
+	rp ReaderProvider,
+	opts IterOptions,
+) (Iterator, error) {
+	return r.newIterWithBlockPropertyFiltersAndContext(
+		ctx,
+		lower, upper, filterer, useFilterBlock, stats, rp, opts, nil,
 	)
 }
 
@@ -3108,8 +3267,13 @@ func (r *Reader) newIterWithBlockPropertyFiltersAndContext(
 	useFilterBlock bool,
 	stats *base.InternalIteratorStats,
 	rp ReaderProvider,
+	opts IterOptions,
 	v *virtualState,
 ) (Iterator, error) {
+	var filterMetrics *FilterMetricsTracker
+	if useFilterBlock && r.tableFilter != nil {
+		filterMetrics = opts.FilterMetrics
+	}
 	// NB: pebble.tableCache wraps the returned iterator with one which performs
 	// reference counting on the Reader, preventing the Reader from being closed
 	// until the final iterator closes.
@@ -3119,7 +3283,8 @@ func (r *Reader) newIterWithBlockPropertyFiltersAndContext(
 		if err != nil {
 			return nil, err
 		}
-		return i, nil
+		i.filterMetrics = filterMetrics
+		return r.maybeVerifyKVChecksums(i), nil
 	}
 
 	i := singleLevelIterPool.Get().(*singleLevelIterator)
@@ -3127,7 +3292,8 @@ func (r *Reader) newIterWithBlockPropertyFiltersAndContext(
 	if err != nil {
 		return nil, err
 	}
-	return i, nil
+	i.filterMetrics = filterMetrics
+	return r.maybeVerifyKVChecksums(i), nil
 }
 
 // NewIter returns an iterator for the contents of the table. If an error
@@ -3161,10 +3327,10 @@ func (r *Reader) newCompactionIter(
 			return nil, err
 		}
 		i.setupForCompaction()
-		return &twoLevelCompactionIterator{
+		return r.maybeVerifyKVChecksums(&twoLevelCompactionIterator{
 			twoLevelIterator: i,
 			bytesIterated:    bytesIterated,
-		}, nil
+		}), nil
 	}
 	i := singleLevelIterPool.Get().(*singleLevelIterator)
 	err := i.init(
@@ -3175,10 +3341,10 @@ func (r *Reader) newCompactionIter(
 		return nil, err
 	}
 	i.setupForCompaction()
-	return &compactionIterator{
+	return r.maybeVerifyKVChecksums(&compactionIterator{
 		singleLevelIterator: i,
 		bytesIterated:       bytesIterated,
-	}, nil
+	}), nil
 }
 
 // NewRawRangeDelIter returns an internal iterator for the contents of the
@@ -3248,25 +3414,184 @@ func (i *rangeKeyFragmentBlockIter) Close() error {
 func (r *Reader) readIndex(
 	ctx context.Context, stats *base.InternalIteratorStats,
 ) (cache.Handle, error) {
+	if p := r.pinned.Load(); p != nil {
+		recordPinnedRead(stats, r.indexBH)
+		return p.index.Acquire(), nil
+	}
 	ctx = objiotracing.WithBlockType(ctx, objiotracing.MetadataBlock)
-	return r.readBlock(ctx, r.indexBH, nil, nil, stats)
+	return r.readBlock(ctx, r.indexBH, nil, nil, stats, cache.HighPriority)
 }
 
 func (r *Reader) readFilter(
 	ctx context.Context, stats *base.InternalIteratorStats,
 ) (cache.Handle, error) {
+	return r.readFilterBlock(ctx, r.filterBH, stats)
+}
+
+func (r *Reader) readFilterBlock(
+	ctx context.Context, bh BlockHandle, stats *base.InternalIteratorStats,
+) (cache.Handle, error) {
+	ctx = objiotracing.WithBlockType(ctx, objiotracing.FilterBlock)
+	return r.readBlock(ctx, bh, nil /* transform */, nil /* readHandle */, stats, cache.HighPriority)
+}
+
+// tableFilterMayContain checks the table filter for the prefix, returning
+// false if the table definitely contains no key with the prefix that is ≥
+// key. If the filter is partitioned, the partition covering the first key in
+// the table ≥ key is checked, which contains the prefix if any such key has
+// it. The check is recorded in the reader's metrics and in iterMetrics, if
+// non-nil.
+func (r *Reader) tableFilterMayContain(
+	ctx context.Context,
+	stats *base.InternalIteratorStats,
+	prefix, key []byte,
+	iterMetrics *FilterMetricsTracker,
+) (bool, error) {
+	f := r.tableFilter
+	bh := r.filterBH
+	if f.partitioned {
+		var ok bool
+		if bh, ok = f.partition(r.Compare, key); !ok {
+			f.recordCheck(false, iterMetrics)
+			return false, nil
+		}
+	} else if p := r.pinned.Load(); p != nil && p.filter.Get() != nil {
+		recordPinnedRead(stats, bh)
+		return f.mayContain(p.filter.Get(), prefix, iterMetrics), nil
+	}
+	dataH, err := r.readFilterBlock(ctx, bh, stats)
+	if err != nil {
+		return false, err
+	}
+	mayContain := f.mayContain(dataH.Get(), prefix, iterMetrics)
+	dataH.Release()
+	return mayContain, nil
+}
+
+// pinnedBlocks holds the blocks pinned by Reader.PinIndexAndFilterBlocks.
+type pinnedBlocks struct {
+	index cache.Handle
+	// filter is the table's filter block, if the table has an unpartitioned
+	// filter.
+	filter cache.Handle
+	// unreserve releases the reservation of the blocks' size in the block
+	// cache.
+	unreserve func()
+}
+
+func (p *pinnedBlocks) release() {
+	p.index.Release()
+	p.filter.Release()
+	if p.unreserve != nil {
+		p.unreserve()
+	}
+}
+
+// recordPinnedRead records a read of a pinned block in stats, as a read that
+// hit the block cache.
+func recordPinnedRead(stats *base.InternalIteratorStats, bh BlockHandle) {
+	if stats != nil {
+		stats.BlockBytes += bh.Length
+		stats.BlockBytesInCache += bh.Length
+		stats.BlockCount++
+	}
+}
+
+// PinIndexAndFilterBlocks reads the table's index block and, if the table has
+// an unpartitioned filter, its filter block, retaining them until the Reader
+// is closed so that they're neither evicted from the block cache nor looked
+// up in it by iterators. The pinned blocks are held outside the block cache,
+// and their size is reserved in it (see cache.Cache.Reserve), so that they
+// count towards its capacity. For a table with a two-level index only the
+// top-level index block is pinned, and the partitions of a partitioned filter
+// continue to be read through the block cache. It's a no-op if the blocks are
+// already pinned.
+func (r *Reader) PinIndexAndFilterBlocks() error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.pinned.Load() != nil {
+		return nil
+	}
+	ctx := objiotracing.WithBlockType(context.Background(), objiotracing.MetadataBlock)
+	index, err := r.readPinnedBlock(ctx, r.indexBH)
+	if err != nil {
+		return err
+	}
+	p := &pinnedBlocks{index: index}
+	if r.tableFilter != nil && !r.tableFilter.partitioned {
+		ctx = objiotracing.WithBlockType(context.Background(), objiotracing.FilterBlock)
+		p.filter, err = r.readPinnedBlock(ctx, r.filterBH)
+		if err != nil {
+			p.release()
+			return err
+		}
+	}
+	p.unreserve = r.opts.Cache.Reserve(len(p.index.Get()) + len(p.filter.Get()))
+	if !r.pinned.CompareAndSwap(nil, p) {
+		// A concurrent call pinned the blocks first.
+		p.release()
+	}
+	return nil
+}
+
+// readPinnedBlock reads a block to be held outside the block cache for the
+// lifetime of the Reader, such as a pinned block or the zstd dictionary. The
+// block is read into a value that isn't added to the block cache, since it's
+// charged to the cache by a reservation, and a cached copy of the block is
+// evicted so that the block isn't charged twice. The cache isn't consulted,
+// since a handle to a cached block would leave the block charged for as long
+// as it remained in the cache.
+func (r *Reader) readPinnedBlock(ctx context.Context, bh BlockHandle) (cache.Handle, error) {
+	r.opts.Cache.Delete(r.cacheID, r.fileNum, bh.Offset)
+	return r.readBlockFromStorage(
+		ctx, bh, nil /* transform */, nil /* readHandle */, nil /* stats */, cache.NoFillPriority)
+}
+
+// WarmBlock reads the specified block into the block cache, unless it's
+// already cached. Data, value and range key blocks are cached with normal
+// priority, and other blocks with high priority, as when they're read by
+// iterators.
+func (r *Reader) WarmBlock(ctx context.Context, bh KindedBlockHandle) error {
+	priority := cache.HighPriority
+	var transform blockTransform
+	switch bh.Kind {
+	case BlockKindData, BlockKindValue, BlockKindRangeKey:
+		priority = cache.NormalPriority
+	case BlockKindRangeDel:
+		priority = cache.NormalPriority
+		transform = r.rangeDelTransform
+	}
+	h, err := r.readBlock(ctx, bh.BlockHandle, transform, nil /* readHandle */, nil /* stats */, priority)
+	if err != nil {
+		return err
+	}
+	h.Release()
+	return nil
+}
+
+// IndexAndFilterBlocksPinned returns true if the table's index and filter
+// blocks are pinned. See PinIndexAndFilterBlocks.
+func (r *Reader) IndexAndFilterBlocksPinned() bool {
+	return r.pinned.Load() != nil
+}
+
+func (r *Reader) readRangeFilter(ctx context.Context) (cache.Handle, error) {
 	ctx = objiotracing.WithBlockType(ctx, objiotracing.FilterBlock)
-	return r.readBlock(ctx, r.filterBH, nil /* transform */, nil /* readHandle */, stats)
+	return r.readBlock(
+		ctx, r.rangeFilterBH, nil /* transform */, nil /* readHandle */, nil /* stats */, cache.HighPriority)
 }
 
 func (r *Reader) readRangeDel(stats *base.InternalIteratorStats) (cache.Handle, error) {
 	ctx := objiotracing.WithBlockType(context.Background(), objiotracing.MetadataBlock)
-	return r.readBlock(ctx, r.rangeDelBH, r.rangeDelTransform, nil /* readHandle */, stats)
+	return r.readBlock(
+		ctx, r.rangeDelBH, r.rangeDelTransform, nil /* readHandle */, stats, cache.NormalPriority)
 }
 
 func (r *Reader) readRangeKey(stats *base.InternalIteratorStats) (cache.Handle, error) {
 	ctx := objiotracing.WithBlockType(context.Background(), objiotracing.MetadataBlock)
-	return r.readBlock(ctx, r.rangeKeyBH, nil /* transform */, nil /* readHandle */, stats)
+	return r.readBlock(
+		ctx, r.rangeKeyBH, nil /* transform */, nil /* readHandle */, stats, cache.NormalPriority)
 }
 
 func checkChecksum(
@@ -3291,65 +3616,114 @@ func checkChecksum(
 	return nil
 }
 
-// readBlock reads and decompresses a block from disk into memory.
+type dataCachePriorityKey struct{}
+
+// WithDataBlockCachePriority returns a context with which iterators look up
+// and add data and value blocks to the block cache with the provided priority,
+// rather than cache.NormalPriority. Index and filter blocks are unaffected.
+// Bulk scans may use cache.NoFillPriority to read tables without populating
+// the block cache.
+func WithDataBlockCachePriority(ctx context.Context, p cache.Priority) context.Context {
+	return context.WithValue(ctx, dataCachePriorityKey{}, p)
+}
+
+func dataCachePriorityFromContext(ctx context.Context) cache.Priority {
+	if ctx != nil {
+		if p, ok := ctx.Value(dataCachePriorityKey{}).(cache.Priority); ok {
+			return p
+		}
+	}
+	return cache.NormalPriority
+}
+
+// readBlock reads and decompresses a block from disk into memory. The block is
+// looked up in and added to the block cache with the provided priority.
 func (r *Reader) readBlock(
 	ctx context.Context,
 	bh BlockHandle,
 	transform blockTransform,
 	readHandle objstorage.ReadHandle,
 	stats *base.InternalIteratorStats,
+	priority cache.Priority,
 ) (handle cache.Handle, _ error) {
-	if h := r.opts.Cache.Get(r.cacheID, r.fileNum, bh.Offset); h.Get() != nil {
+	if h := r.opts.Cache.GetWithPriority(r.cacheID, r.fileNum, bh.Offset, priority); h.Get() != nil {
 		if readHandle != nil {
 			readHandle.RecordCacheHit(ctx, int64(bh.Offset), int64(bh.Length+blockTrailerLen))
 		}
 		if stats != nil {
 			stats.BlockBytes += bh.Length
 			stats.BlockBytesInCache += bh.Length
+			stats.BlockCount++
 		}
 		return h, nil
 	}
-
-	v := r.opts.Cache.Alloc(int(bh.Length + blockTrailerLen))
-	b := v.Buf()
-	readStartTime := time.Now()
-	var err error
-	if readHandle != nil {
-		err = readHandle.ReadAt(ctx, b, int64(bh.Offset))
-	} else {
-		err = r.readable.ReadAt(ctx, b, int64(bh.Offset))
-	}
-	readDuration := time.Since(readStartTime)
-	// TODO(sumeer): should the threshold be configurable.
-	const slowReadTracingThreshold = 5 * time.Millisecond
-	// The invariants.Enabled path is for deterministic testing.
-	if invariants.Enabled {
-		readDuration = slowReadTracingThreshold
-	}
-	// Call IsTracingEnabled to avoid the allocations of boxing integers into an
-	// interface{}, unless necessary.
-	if readDuration >= slowReadTracingThreshold && r.opts.LoggerAndTracer.IsTracingEnabled(ctx) {
-		r.opts.LoggerAndTracer.Eventf(ctx, "reading %d bytes took %s",
-			bh.Length+blockTrailerLen, readDuration.String())
-	}
-	if stats != nil {
-		stats.BlockReadDuration += readDuration
+	if r.opts.Tracer == nil || !base.IsTraced(ctx) {
+		return r.readBlockFromStorage(ctx, bh, transform, readHandle, stats, priority)
 	}
+
+	_, span := r.opts.Tracer.Start(ctx, "pebble.sstable.read_block", time.Now())
+	span.SetAttributes(
+		base.Int64Attribute("pebble.file_num", int64(r.fileNum.FileNum())),
+		base.Int64Attribute("pebble.block.offset", int64(bh.Offset)),
+		base.Int64Attribute("pebble.block.length", int64(bh.Length)),
+	)
+	h, err := r.readBlockFromStorage(ctx, bh, transform, readHandle, stats, priority)
 	if err != nil {
-		r.opts.Cache.Free(v)
-		return cache.Handle{}, err
+		span.RecordError(err)
+	} else {
+		span.SetAttributes(base.Int64Attribute("pebble.block.decompressed_length", int64(len(h.Get()))))
 	}
+	span.End(time.Now())
+	return h, err
+}
 
-	if err := checkChecksum(r.checksumType, b, bh, r.fileNum.FileNum()); err != nil {
-		r.opts.Cache.Free(v)
-		return cache.Handle{}, err
+// readBlockFromStorage reads and decompresses a block which isn't in the
+// block cache, and adds it to the block cache with the provided priority. If a
+// secondary cache is attached to the block cache, the block is read from it if
+// present, and otherwise offered to it once read from the table.
+func (r *Reader) readBlockFromStorage(
+	ctx context.Context,
+	bh BlockHandle,
+	transform blockTransform,
+	readHandle objstorage.ReadHandle,
+	stats *base.InternalIteratorStats,
+	priority cache.Priority,
+) (cache.Handle, error) {
+	v := r.opts.Cache.Alloc(int(bh.Length + blockTrailerLen))
+	b := v.Buf()
+	sc := r.opts.Cache.Secondary(r.cacheID)
+	if sc == nil || !sc.ReadBlock(r.fileNum, bh.Offset, b, func(b []byte) error {
+		return checkChecksum(r.checksumType, b, bh, r.fileNum.FileNum())
+	}) {
+		if err := r.readBlockFromTable(ctx, bh, b, readHandle, stats); err != nil {
+			r.opts.Cache.Free(v)
+			return cache.Handle{}, err
+		}
+		if sc != nil {
+			// The block is offered as stored in the table, before it's
+			// decrypted and decompressed in place.
+			sc.Offer(cache.OfferedBlock{
+				FileNum:  r.fileNum,
+				Offset:   bh.Offset,
+				Size:     len(b),
+				Priority: priority,
+			}, b)
+		}
 	}
 
 	typ := blockType(b[bh.Length])
 	b = b[:bh.Length]
+	if r.blockCipher != nil && bh != r.metaIndexBH && bh != r.propertiesBH {
+		decrypted, err := r.blockCipher.decrypt(b, typ, bh)
+		if err != nil {
+			r.opts.Cache.Free(v)
+			return cache.Handle{}, err
+		}
+		b = b[:copy(b, decrypted)]
+	}
 	v.Truncate(len(b))
 
-	decoded, err := decompressBlock(r.opts.Cache, typ, b)
+	decoded, err := decompressBlock(r.opts.Cache, typ, b, r.zstdDict)
 	if decoded != nil {
 		r.opts.Cache.Free(v)
 		v = decoded
@@ -3376,12 +3750,52 @@ func (r *Reader) readBlock(
 
 	if stats != nil {
 		stats.BlockBytes += bh.Length
+		stats.BlockCount++
+		stats.BlockCacheMisses++
 	}
 
-	h := r.opts.Cache.Set(r.cacheID, r.fileNum, bh.Offset, v)
+	h := r.opts.Cache.SetWithPriority(r.cacheID, r.fileNum, bh.Offset, v, priority)
 	return h, nil
 }
 
+// readBlockFromTable reads a block, including its trailer, from the table
+// into b, and verifies its checksum.
+func (r *Reader) readBlockFromTable(
+	ctx context.Context,
+	bh BlockHandle,
+	b []byte,
+	readHandle objstorage.ReadHandle,
+	stats *base.InternalIteratorStats,
+) error {
+	readStartTime := time.Now()
+	var err error
+	if readHandle != nil {
+		err = readHandle.ReadAt(ctx, b, int64(bh.Offset))
+	} else {
+		err = r.readable.ReadAt(ctx, b, int64(bh.Offset))
+	}
+	readDuration := time.Since(readStartTime)
+	// TODO(sumeer): should the threshold be configurable.
+	const slowReadTracingThreshold = 5 * time.Millisecond
+	// The invariants.Enabled path is for deterministic testing.
+	if invariants.Enabled {
+		readDuration = slowReadTracingThreshold
+	}
+	// Call IsTracingEnabled to avoid the allocations of boxing integers into an
+	// interface{}, unless necessary.
+	if readDuration >= slowReadTracingThreshold && r.opts.LoggerAndTracer.IsTracingEnabled(ctx) {
+		r.opts.LoggerAndTracer.Eventf(ctx, "reading %d bytes took %s",
+			bh.Length+blockTrailerLen, readDuration.String())
+	}
+	if stats != nil {
+		stats.BlockReadDuration += readDuration
+	}
+	if err != nil {
+		return err
+	}
+	return checkChecksum(r.checksumType, b, bh, r.fileNum.FileNum())
+}
+
 func (r *Reader) transformRangeDelV1(b []byte) ([]byte, error) {
 	// Convert v1 (RocksDB format) range-del blocks to v2 blocks on the fly. The
 	// v1 format range-del blocks have unfragmented and unsorted range
@@ -3427,7 +3841,7 @@ func (r *Reader) transformRangeDelV1(b []byte) ([]byte, error) {
 
 func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 	b, err := r.readBlock(
-		context.Background(), metaindexBH, nil /* transform */, nil /* readHandle */, nil /* stats */)
+		context.Background(), metaindexBH, nil /* transform */, nil /* readHandle */, nil /* stats */, cache.HighPriority)
 	if err != nil {
 		return err
 	}
@@ -3470,7 +3884,7 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 
 	if bh, ok := meta[metaPropertiesName]; ok {
 		b, err = r.readBlock(
-			context.Background(), bh, nil /* transform */, nil /* readHandle */, nil /* stats */)
+			context.Background(), bh, nil /* transform */, nil /* readHandle */, nil /* stats */, cache.HighPriority)
 		if err != nil {
 			return err
 		}
@@ -3482,6 +3896,22 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 		}
 	}
 
+	if id := r.Properties.EncryptionKeyID; id != "" {
+		if r.opts.EncryptionKeys == nil {
+			return errors.Errorf("pebble/table: table is encrypted with key %q, but no keys were provided", id)
+		}
+		if r.Properties.EncryptionTableID == "" {
+			return base.CorruptionErrorf("pebble/table: encrypted table has no table ID")
+		}
+		secret, err := r.opts.EncryptionKeys(id)
+		if err != nil {
+			return errors.Wrapf(err, "pebble/table: looking up encryption key %q", id)
+		}
+		if r.blockCipher, err = newBlockCipher(secret, r.Properties.EncryptionTableID); err != nil {
+			return err
+		}
+	}
+
 	if bh, ok := meta[metaRangeDelV2Name]; ok {
 		r.rangeDelBH = bh
 	} else if bh, ok := meta[metaRangeDelName]; ok {
@@ -3495,12 +3925,29 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 		r.rangeKeyBH = bh
 	}
 
+	if bh, ok := meta[metaZstdDictName]; ok {
+		// Load and prepare the dictionary once, for use by all of the blocks
+		// compressed against it. It's held by the Reader rather than the block
+		// cache, and its size is reserved in the cache so that it counts
+		// towards the cache's capacity.
+		h, err := r.readPinnedBlock(context.Background(), bh)
+		if err != nil {
+			return err
+		}
+		r.zstdDictBH = bh
+		r.zstdDict = newZstdDict(h.Get())
+		h.Release()
+		r.unreserveZstdDict = r.opts.Cache.Reserve(len(r.zstdDict.raw))
+	}
+
 	for name, fp := range r.opts.Filters {
 		types := []struct {
-			ftype  FilterType
-			prefix string
+			ftype       FilterType
+			prefix      string
+			partitioned bool
 		}{
-			{TableFilter, "fullfilter."},
+			{TableFilter, "fullfilter.", false},
+			{TableFilter, metaPartitionedFilterPrefix, true},
 		}
 		var done bool
 		for _, t := range types {
@@ -3513,6 +3960,20 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 				default:
 					return base.CorruptionErrorf("unknown filter type: %v", errors.Safe(t.ftype))
 				}
+				if t.partitioned {
+					// The top-level filter index is decoded once and retained
+					// for the lifetime of the Reader. The partitions are read
+					// through the block cache on demand.
+					h, err := r.readFilter(context.Background(), nil /* stats */)
+					if err != nil {
+						return err
+					}
+					err = r.tableFilter.loadPartitions(h.Get())
+					h.Release()
+					if err != nil {
+						return err
+					}
+				}
 
 				done = true
 				break
@@ -3522,6 +3983,16 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 			break
 		}
 	}
+
+	if n := r.Properties.RangeFilterPrefixLen; n > 0 {
+		for name, fp := range r.opts.Filters {
+			if bh, ok := meta[metaRangeFilterPrefix+name]; ok {
+				r.rangeFilterBH = bh
+				r.rangeFilter = &rangeFilterReader{policy: fp, prefixLen: int(n)}
+				break
+			}
+		}
+	}
 	return nil
 }
 
@@ -3532,15 +4003,22 @@ func (r *Reader) Layout() (*Layout, error) {
 	}
 
 	l := &Layout{
-		Data:       make([]BlockHandleWithProperties, 0, r.Properties.NumDataBlocks),
-		Filter:     r.filterBH,
-		RangeDel:   r.rangeDelBH,
-		RangeKey:   r.rangeKeyBH,
-		ValueIndex: r.valueBIH.h,
-		Properties: r.propertiesBH,
-		MetaIndex:  r.metaIndexBH,
-		Footer:     r.footerBH,
-		Format:     r.tableFormat,
+		Data:        make([]BlockHandleWithProperties, 0, r.Properties.NumDataBlocks),
+		Filter:      r.filterBH,
+		RangeFilter: r.rangeFilterBH,
+		RangeDel:    r.rangeDelBH,
+		RangeKey:    r.rangeKeyBH,
+		ZstdDict:    r.zstdDictBH,
+		ValueIndex:  r.valueBIH.h,
+		Properties:  r.propertiesBH,
+		MetaIndex:   r.metaIndexBH,
+		Footer:      r.footerBH,
+		Format:      r.tableFormat,
+	}
+	if r.tableFilter != nil {
+		for _, p := range r.tableFilter.partitions {
+			l.FilterPartitions = append(l.FilterPartitions, p.bh)
+		}
 	}
 
 	indexH, err := r.readIndex(context.Background(), nil)
@@ -3576,7 +4054,7 @@ func (r *Reader) Layout() (*Layout, error) {
 			l.Index = append(l.Index, indexBH.BlockHandle)
 
 			subIndex, err := r.readBlock(context.Background(),
-				indexBH.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */)
+				indexBH.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */, cache.HighPriority)
 			if err != nil {
 				return nil, err
 			}
@@ -3598,7 +4076,7 @@ func (r *Reader) Layout() (*Layout, error) {
 		}
 	}
 	if r.valueBIH.h.Length != 0 {
-		vbiH, err := r.readBlock(context.Background(), r.valueBIH.h, nil, nil, nil)
+		vbiH, err := r.readBlock(context.Background(), r.valueBIH.h, nil, nil, nil, cache.HighPriority)
 		if err != nil {
 			return nil, err
 		}
@@ -3649,7 +4127,8 @@ func (r *Reader) ValidateBlockChecksums() error {
 		blocks[i] = l.Data[i].BlockHandle
 	}
 	blocks = append(blocks, l.Index...)
-	blocks = append(blocks, l.TopIndex, l.Filter, l.RangeDel, l.RangeKey, l.Properties, l.MetaIndex)
+	blocks = append(blocks, l.FilterPartitions...)
+	blocks = append(blocks, l.TopIndex, l.Filter, l.RangeFilter, l.RangeDel, l.RangeKey, l.ZstdDict, l.Properties, l.MetaIndex)
 
 	// Sorting by offset ensures we are performing a sequential scan of the
 	// file.
@@ -3669,7 +4148,7 @@ func (r *Reader) ValidateBlockChecksums() error {
 		}
 
 		// Read the block, which validates the checksum.
-		h, err := r.readBlock(context.Background(), bh, nil, rh, nil)
+		h, err := r.readBlock(context.Background(), bh, nil, rh, nil, cache.LowPriority)
 		if err != nil {
 			return err
 		}
@@ -3732,7 +4211,7 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 			return 0, errCorruptIndexEntry
 		}
 		startIdxBlock, err := r.readBlock(context.Background(),
-			startIdxBH.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */)
+			startIdxBH.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */, cache.HighPriority)
 		if err != nil {
 			return 0, err
 		}
@@ -3753,7 +4232,7 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 				return 0, errCorruptIndexEntry
 			}
 			endIdxBlock, err := r.readBlock(context.Background(),
-				endIdxBH.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */)
+				endIdxBH.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */, cache.HighPriority)
 			if err != nil {
 				return 0, err
 			}
@@ -3811,6 +4290,197 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 		endBH.Offset + endBH.Length + blockTrailerLen - startBH.Offset), nil
 }
 
+// UnsummarizedSpan describes a span of user keys returned by SummarizeBlocks,
+// containing the keys of data blocks that were not summarized. Start is
+// inclusive unless StartExclusive is set, and End is exclusive unless
+// EndInclusive is set. A nil Start or End is unbounded.
+type UnsummarizedSpan struct {
+	Start          []byte
+	StartExclusive bool
+	End            []byte
+	EndInclusive   bool
+}
+
+// SummarizeBlocks walks the index of the table over the user key range
+// [lower, upper), where a nil bound is unbounded. Every data block whose keys
+// are known from the index to lie wholly within the bounds is passed to
+// summarize, in order, along with its encoded value of the named block
+// property (or nil if the block has none). If summarize returns true the
+// caller has accounted for the block's keys using its property. SummarizeBlocks
+// returns, in order, the spans of user keys containing the keys within the
+// bounds that belong to blocks that were not summarized. The caller must read
+// these spans through an iterator.
+//
+// The index separator preceding a block provides an inclusive lower bound on
+// the block's user keys, so the first block of the table is only summarized if
+// lower is nil. The returned spans are delimited by index separators, and a
+// user key whose versions straddle a summarized block and an unsummarized
+// block is split between them: the summarized block's property and the spans
+// must agree on which block accounts for the user key. Block property
+// collectors that summarize the newest version of each user key in a table
+// satisfy this, because a span never includes versions of a user key whose
+// newer versions are in a preceding summarized block.
+func (r *Reader) SummarizeBlocks(
+	lower, upper []byte, property string, summarize func(prop []byte) bool,
+) ([]UnsummarizedSpan, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	whole := []UnsummarizedSpan{{Start: lower, End: upper}}
+	userProp, ok := r.Properties.UserProperties[property]
+	if !ok || len(userProp) == 0 {
+		// The property was not collected when writing this table.
+		return whole, nil
+	}
+	id := shortID(userProp[0])
+
+	indexH, err := r.readIndex(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer indexH.Release()
+
+	var spans []UnsummarizedSpan
+	var open bool
+	var span UnsummarizedSpan
+	// prevSep holds the user key of the index separator preceding the current
+	// block, if any.
+	var prevSep []byte
+	var havePrev bool
+	first := true
+
+	// visit processes a single data block. It returns false once the block
+	// and all subsequent blocks lie at or beyond the upper bound.
+	visit := func(sep *InternalKey, val []byte) (bool, error) {
+		if havePrev && upper != nil && r.Compare(prevSep, upper) >= 0 {
+			return false, nil
+		}
+		bhp, err := decodeBlockHandleWithProperties(val)
+		if err != nil {
+			return false, errCorruptIndexEntry
+		}
+		within := (lower == nil || (havePrev && r.Compare(prevSep, lower) >= 0)) &&
+			(upper == nil || r.Compare(sep.UserKey, upper) < 0)
+		if within {
+			var prop []byte
+			decoder := blockPropertiesDecoder{props: bhp.Props}
+			for !decoder.done() {
+				propID, p, err := decoder.next()
+				if err != nil {
+					return false, err
+				}
+				if propID == id {
+					prop = p
+					break
+				}
+			}
+			within = summarize(prop)
+		}
+		if within {
+			if open {
+				// The span ends with the previous block, whose keys are all ≤
+				// prevSep.
+				span.End = append([]byte(nil), prevSep...)
+				span.EndInclusive = true
+				spans = append(spans, span)
+				open = false
+			}
+		} else if !open {
+			open = true
+			if first {
+				span = UnsummarizedSpan{Start: lower}
+			} else {
+				// The previous block was summarized, and accounts for all keys
+				// with user keys ≤ prevSep.
+				span = UnsummarizedSpan{Start: append([]byte(nil), prevSep...), StartExclusive: true}
+			}
+		}
+		first = false
+		prevSep = append(prevSep[:0], sep.UserKey...)
+		havePrev = true
+		return true, nil
+	}
+
+	// walk visits the data blocks referenced by an index block. Positioning
+	// the first index block at lower skips blocks wholly before lower.
+	walk := func(iter *blockIter, seek bool) (bool, error) {
+		var key *InternalKey
+		var val base.LazyValue
+		if seek && lower != nil {
+			if key, val = iter.SeekGE(lower, base.SeekGEFlagsNone); key != nil {
+				// Establish the separator preceding the first visited block.
+				if pk, _ := iter.Prev(); pk != nil {
+					prevSep = append(prevSep[:0], pk.UserKey...)
+					havePrev = true
+					key, val = iter.Next()
+				} else {
+					key, val = iter.First()
+				}
+			}
+		} else {
+			key, val = iter.First()
+		}
+		for ; key != nil; key, val = iter.Next() {
+			if ok, err := visit(key, val.InPlaceValue()); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, iter.Error()
+	}
+
+	if r.Properties.IndexPartitions == 0 {
+		iter, err := newBlockIter(r.Compare, indexH.Get())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := walk(iter, true /* seek */); err != nil {
+			return nil, err
+		}
+	} else {
+		topIter, err := newBlockIter(r.Compare, indexH.Get())
+		if err != nil {
+			return nil, err
+		}
+		key, val := topIter.First()
+		if lower != nil {
+			key, val = topIter.SeekGE(lower, base.SeekGEFlagsNone)
+		}
+		for seek := true; key != nil; key, val = topIter.Next() {
+			bh, err := decodeBlockHandleWithProperties(val.InPlaceValue())
+			if err != nil {
+				return nil, errCorruptIndexEntry
+			}
+			indexBlock, err := r.readBlock(context.Background(),
+				bh.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */, cache.HighPriority)
+			if err != nil {
+				return nil, err
+			}
+			iter, err := newBlockIter(r.Compare, indexBlock.Get())
+			if err != nil {
+				indexBlock.Release()
+				return nil, err
+			}
+			more, err := walk(iter, seek)
+			indexBlock.Release()
+			if err != nil {
+				return nil, err
+			}
+			if !more {
+				break
+			}
+			seek = false
+		}
+		if err := topIter.Error(); err != nil {
+			return nil, err
+		}
+	}
+	if open {
+		span.End = upper
+		spans = append(spans, span)
+	}
+	return spans, nil
+}
+
 // TableFormat returns the format version for the table.
 func (r *Reader) TableFormat() (TableFormat, error) {
 	if r.err != nil {
@@ -3858,20 +4528,34 @@ func NewReader(f objstorage.Readable, o ReaderOptions, extraOpts ...ReaderOption
 	}
 	r.checksumType = footer.checksum
 	r.tableFormat = footer.format
+	r.metaIndexBH = footer.metaindexBH
 	// Read the metaindex.
 	if err := r.readMetaindex(footer.metaindexBH); err != nil {
 		r.err = err
 		return nil, r.Close()
 	}
 	r.indexBH = footer.indexBH
-	r.metaIndexBH = footer.metaindexBH
 	r.footerBH = footer.footerBH
 
+	if r.tableFilter != nil && r.tableFilter.partitioned && r.Properties.IndexPartitions > 0 {
+		// Pin the top-level index alongside the top-level filter index, so
+		// that neither competes with data blocks for cache space. The index
+		// and filter partitions are read through the block cache.
+		if err := r.PinIndexAndFilterBlocks(); err != nil {
+			r.err = err
+			return nil, r.Close()
+		}
+	}
+
 	if r.Properties.ComparerName == "" || o.Comparer.Name == r.Properties.ComparerName {
 		r.Compare = o.Comparer.Compare
 		r.FormatKey = o.Comparer.FormatKey
 		r.Split = o.Comparer.Split
 	}
+	// Range filters rely on the comparer ordering key prefixes bytewise.
+	if !o.Comparer.BytewisePrefixOrdering {
+		r.rangeFilter = nil
+	}
 
 	if o.MergerName == r.Properties.MergerName {
 		r.mergerOK = true
@@ -3906,19 +4590,123 @@ type Layout struct {
 	// NOTE: changes to fields in this struct should also be reflected in
 	// ValidateBlockChecksums, which validates a static list of BlockHandles
 	// referenced in this struct.
+	//
+	// If the table filter is partitioned, Filter is the top-level filter index
+	// on the FilterPartitions.
+
+	Data             []BlockHandleWithProperties
+	Index            []BlockHandle
+	TopIndex         BlockHandle
+	Filter           BlockHandle
+	FilterPartitions []BlockHandle
+	RangeFilter      BlockHandle
+	RangeDel         BlockHandle
+	RangeKey         BlockHandle
+	ZstdDict         BlockHandle
+	ValueBlock       []BlockHandle
+	ValueIndex       BlockHandle
+	Properties       BlockHandle
+	MetaIndex        BlockHandle
+	Footer           BlockHandle
+	Format           TableFormat
+}
+
+// BlockKind identifies the role of a block within an sstable.
+type BlockKind uint8
+
+// The kinds of blocks. The values are persisted, and must not be changed.
+const (
+	BlockKindData BlockKind = iota + 1
+	BlockKindIndex
+	BlockKindTopIndex
+	BlockKindFilter
+	BlockKindFilterPartition
+	BlockKindRangeFilter
+	BlockKindRangeDel
+	BlockKindRangeKey
+	BlockKindZstdDict
+	BlockKindValue
+	BlockKindValueIndex
+	BlockKindProperties
+	BlockKindMetaIndex
+
+	numBlockKinds
+)
 
-	Data       []BlockHandleWithProperties
-	Index      []BlockHandle
-	TopIndex   BlockHandle
-	Filter     BlockHandle
-	RangeDel   BlockHandle
-	RangeKey   BlockHandle
-	ValueBlock []BlockHandle
-	ValueIndex BlockHandle
-	Properties BlockHandle
-	MetaIndex  BlockHandle
-	Footer     BlockHandle
-	Format     TableFormat
+func (k BlockKind) String() string {
+	switch k {
+	case BlockKindData:
+		return "data"
+	case BlockKindIndex:
+		return "index"
+	case BlockKindTopIndex:
+		return "top-index"
+	case BlockKindFilter:
+		return "filter"
+	case BlockKindFilterPartition:
+		return "filter-partition"
+	case BlockKindRangeFilter:
+		return "range-filter"
+	case BlockKindRangeDel:
+		return "range-del"
+	case BlockKindRangeKey:
+		return "range-key"
+	case BlockKindZstdDict:
+		return "zstd-dictionary"
+	case BlockKindValue:
+		return "value-block"
+	case BlockKindValueIndex:
+		return "value-index"
+	case BlockKindProperties:
+		return "properties"
+	case BlockKindMetaIndex:
+		return "meta-index"
+	}
+	return fmt.Sprintf("unknown(%d)", k)
+}
+
+// Valid returns true if the kind is one of the known kinds of blocks.
+func (k BlockKind) Valid() bool {
+	return k > 0 && k < numBlockKinds
+}
+
+// KindedBlockHandle is the handle of a block along with the block's kind.
+type KindedBlockHandle struct {
+	BlockHandle
+	Kind BlockKind
+}
+
+// Blocks returns the handles of the table's blocks, except the footer, along
+// with their kinds.
+func (l *Layout) Blocks() []KindedBlockHandle {
+	var blocks []KindedBlockHandle
+	add := func(bh BlockHandle, kind BlockKind) {
+		if bh.Length != 0 {
+			blocks = append(blocks, KindedBlockHandle{BlockHandle: bh, Kind: kind})
+		}
+	}
+	for i := range l.Data {
+		add(l.Data[i].BlockHandle, BlockKindData)
+	}
+	for i := range l.Index {
+		add(l.Index[i], BlockKindIndex)
+	}
+	add(l.TopIndex, BlockKindTopIndex)
+	add(l.Filter, BlockKindFilter)
+	for i := range l.FilterPartitions {
+		add(l.FilterPartitions[i], BlockKindFilterPartition)
+	}
+	add(l.RangeFilter, BlockKindRangeFilter)
+	add(l.RangeDel, BlockKindRangeDel)
+	add(l.RangeKey, BlockKindRangeKey)
+	add(l.ZstdDict, BlockKindZstdDict)
+	for i := range l.ValueBlock {
+		add(l.ValueBlock[i], BlockKindValue)
+	}
+	add(l.ValueIndex, BlockKindValueIndex)
+	add(l.Properties, BlockKindProperties)
+	add(l.MetaIndex, BlockKindMetaIndex)
+	return blocks
 }
 
 // Describe returns a description of the layout. If the verbose parameter is
@@ -3943,7 +4731,17 @@ func (l *Layout) Describe(
 		blocks = append(blocks, block{l.TopIndex, "top-index"})
 	}
 	if l.Filter.Length != 0 {
-		blocks = append(blocks, block{l.Filter, "filter"})
+		if len(l.FilterPartitions) > 0 {
+			blocks = append(blocks, block{l.Filter, "filter-index"})
+		} else {
+			blocks = append(blocks, block{l.Filter, "filter"})
+		}
+	}
+	for i := range l.FilterPartitions {
+		blocks = append(blocks, block{l.FilterPartitions[i], "filter"})
+	}
+	if l.RangeFilter.Length != 0 {
+		blocks = append(blocks, block{l.RangeFilter, "range-filter"})
 	}
 	if l.RangeDel.Length != 0 {
 		blocks = append(blocks, block{l.RangeDel, "range-del"})
@@ -3951,6 +4749,9 @@ func (l *Layout) Describe(
 	if l.RangeKey.Length != 0 {
 		blocks = append(blocks, block{l.RangeKey, "range-key"})
 	}
+	if l.ZstdDict.Length != 0 {
+		blocks = append(blocks, block{l.ZstdDict, "zstd-dictionary"})
+	}
 	for i := range l.ValueBlock {
 		blocks = append(blocks, block{l.ValueBlock[i], "value-block"})
 	}
@@ -3982,7 +4783,7 @@ func (l *Layout) Describe(
 		if !verbose {
 			continue
 		}
-		if b.name == "filter" {
+		if b.name == "filter" || b.name == "zstd-dictionary" {
 			continue
 		}
 
@@ -4029,7 +4830,7 @@ func (l *Layout) Describe(
 		}
 
 		h, err := r.readBlock(
-			context.Background(), b.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */)
+			context.Background(), b.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */, cache.NormalPriority)
 		if err != nil {
 			fmt.Fprintf(w, "  [err: %s]\n", err)
 			continue
@@ -4144,6 +4945,20 @@ func (l *Layout) Describe(
 			}
 			formatRestarts(iter.data, iter.restarts, iter.numRestarts)
 			formatTrailer()
+		case "filter-index":
+			iter, _ := newRawBlockIter(r.Compare, h.Get())
+			for valid := iter.First(); valid; valid = iter.Next() {
+				bh, n := decodeBlockHandle(iter.Value())
+				if n == 0 || n != len(iter.Value()) {
+					fmt.Fprintf(w, "%10d    [err: bad filter partition handle]\n", b.Offset+uint64(iter.offset))
+					continue
+				}
+				fmt.Fprintf(w, "%10d    %s block:%d/%d",
+					b.Offset+uint64(iter.offset), r.FormatKey(iter.Key().UserKey), bh.Offset, bh.Length)
+				formatIsRestart(iter.data, iter.restarts, iter.numRestarts, iter.offset)
+			}
+			formatRestarts(iter.data, iter.restarts, iter.numRestarts)
+			formatTrailer()
 		case "meta-index":
 			iter, _ := newRawBlockIter(r.Compare, h.Get())
 			for valid := iter.First(); valid; valid = iter.Next() {
@@ -29,6 +29,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/ribbon"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/rand"
@@ -52,7 +53,7 @@ func (r *Reader) get(key []byte) (value []byte, err error) {
 		} else {
 			lookupKey = key
 		}
-		mayContain := r.tableFilter.mayContain(dataH.Get(), lookupKey)
+		mayContain := r.tableFilter.mayContain(dataH.Get(), lookupKey, nil)
 		dataH.Release()
 		if !mayContain {
 			return nil, base.ErrNotFound
@@ -453,6 +454,15 @@ func TestReader(t *testing.T) {
 			FilterPolicy: bloom.FilterPolicy(100),
 			FilterType:   base.TableFilter,
 		},
+		"blocked10bit": {
+			FilterPolicy: bloom.BlockedFilterPolicy(10),
+			FilterType:   base.TableFilter,
+		},
+		"ribbon1bit": {
+			// A policy with many false positives.
+			FilterPolicy: ribbon.FilterPolicy(1),
+			FilterType:   base.TableFilter,
+		},
 	}
 
 	blockSizes := map[string]int{
@@ -497,6 +507,248 @@ func TestReader(t *testing.T) {
 	}
 }
 
+func TestReaderFilterMetrics(t *testing.T) {
+	policies := []FilterPolicy{
+		bloom.FilterPolicy(1),
+		bloom.BlockedFilterPolicy(10),
+		ribbon.FilterPolicy(7),
+	}
+	type config struct {
+		indexBlockSize   int
+		partitionFilters bool
+	}
+	configs := []config{{math.MaxInt32, false}, {1, false}, {1, true}, {256, true}}
+	for _, policy := range policies {
+		for _, c := range configs {
+			t.Run(fmt.Sprintf("%s/indexBlockSize=%d/partitionFilters=%t",
+				policy.Name(), c.indexBlockSize, c.partitionFilters), func(t *testing.T) {
+				mem := vfs.NewMem()
+				f0, err := mem.Create("test")
+				require.NoError(t, err)
+				w := NewWriter(objstorageprovider.NewFileWritable(f0), WriterOptions{
+					BlockSize:        64,
+					IndexBlockSize:   c.indexBlockSize,
+					Comparer:         testkeys.Comparer,
+					FilterPolicy:     policy,
+					FilterType:       base.TableFilter,
+					PartitionFilters: c.partitionFilters,
+				})
+				const n = 1000
+				for i := 0; i < n; i += 2 {
+					require.NoError(t, w.Set([]byte(fmt.Sprintf("key%05d", i)), []byte("value")))
+				}
+				require.NoError(t, w.Close())
+
+				f1, err := mem.Open("test")
+				require.NoError(t, err)
+				var tracker FilterMetricsTracker
+				r, err := newReader(f1, ReaderOptions{
+					Comparer: testkeys.Comparer,
+					Filters:  map[string]FilterPolicy{policy.Name(): policy},
+				}, &tracker)
+				require.NoError(t, err)
+				defer r.Close()
+				if c.partitionFilters {
+					require.Equal(t, r.Properties.IndexPartitions, r.Properties.FilterPartitions)
+				} else {
+					require.Zero(t, r.Properties.FilterPartitions)
+				}
+
+				var iterTracker FilterMetricsTracker
+				iter, err := r.NewIterWithOptions(
+					context.Background(), nil, nil, nil, true /* useFilterBlock */, nil,
+					TrivialReaderProvider{Reader: r}, IterOptions{FilterMetrics: &iterTracker})
+				require.NoError(t, err)
+				var found int
+				for i := 0; i < n; i++ {
+					k := []byte(fmt.Sprintf("key%05d", i))
+					if key, _ := iter.SeekPrefixGE(k, k, base.SeekGEFlagsNone); key != nil && bytes.Equal(key.UserKey, k) {
+						found++
+					}
+				}
+				require.NoError(t, iter.Close())
+				require.Equal(t, n/2, found)
+
+				m := tracker.Load()
+				require.Equal(t, m, iterTracker.Load())
+				// Every check of a key in the table is a miss, and every check of a
+				// key absent from the table is a hit or a false positive.
+				require.Equal(t, int64(n), m.Hits+m.Misses)
+				require.Equal(t, int64(n/2), m.Hits+m.FalsePositives)
+				require.Less(t, int64(0), m.Hits)
+				require.Equal(t, float64(m.FalsePositives)/float64(n/2), m.FalsePositiveRate())
+
+				// Iterators created without IterOptions.FilterMetrics only record
+				// into the reader's tracker.
+				iter, err = r.NewIter(nil, nil)
+				require.NoError(t, err)
+				k := []byte("key00001")
+				iter.SeekPrefixGE(k, k, base.SeekGEFlagsNone)
+				require.NoError(t, iter.Close())
+				require.Equal(t, m.Hits+m.Misses+1, tracker.Load().Hits+tracker.Load().Misses)
+				require.Equal(t, m, iterTracker.Load())
+			})
+		}
+	}
+}
+
+func TestReaderPartitionedFilter(t *testing.T) {
+	policy := bloom.FilterPolicy(10)
+	mem := vfs.NewMem()
+	f0, err := mem.Create("test")
+	require.NoError(t, err)
+	w := NewWriter(objstorageprovider.NewFileWritable(f0), WriterOptions{
+		BlockSize:        64,
+		IndexBlockSize:   128,
+		Comparer:         testkeys.Comparer,
+		FilterPolicy:     policy,
+		FilterType:       base.TableFilter,
+		PartitionFilters: true,
+	})
+	// Write the even prefixes, each with several versions such that the keys
+	// with a prefix span data blocks and index partitions.
+	const n = 200
+	for i := 0; i < n; i += 2 {
+		for ts := 20; ts > 0; ts -= 4 {
+			k := testkeys.KeyAt(testkeys.Alpha(4), i, ts)
+			require.NoError(t, w.Set(k, []byte("value")))
+		}
+	}
+	require.NoError(t, w.Close())
+
+	f1, err := mem.Open("test")
+	require.NoError(t, err)
+	c := cache.New(128 << 10)
+	defer c.Unref()
+	r, err := newReader(f1, ReaderOptions{
+		Cache:    c,
+		Comparer: testkeys.Comparer,
+		Filters:  map[string]FilterPolicy{policy.Name(): policy},
+	})
+	require.NoError(t, err)
+	defer r.Close()
+	require.Less(t, uint64(2), r.Properties.FilterPartitions)
+	require.Equal(t, r.Properties.IndexPartitions, r.Properties.FilterPartitions)
+	require.NoError(t, r.ValidateBlockChecksums())
+
+	l, err := r.Layout()
+	require.NoError(t, err)
+	require.Equal(t, int(r.Properties.FilterPartitions), len(l.FilterPartitions))
+	var buf bytes.Buffer
+	l.Describe(&buf, true /* verbose */, r, nil)
+	require.Contains(t, buf.String(), "filter-index")
+
+	// Prefix seeks must find the same keys with and without the filter,
+	// including seeks whose key lies between the versions of a prefix and
+	// those at the boundaries of partitions.
+	filtered, err := r.NewIter(nil, nil)
+	require.NoError(t, err)
+	defer filtered.Close()
+	unfiltered, err := r.NewIterWithBlockPropertyFilters(
+		nil, nil, nil, false /* useFilterBlock */, nil, TrivialReaderProvider{Reader: r})
+	require.NoError(t, err)
+	defer unfiltered.Close()
+	// SeekPrefixGE may return keys without the prefix, which callers ignore.
+	format := func(prefix []byte, k *InternalKey) string {
+		if k == nil || !bytes.Equal(prefix, k.UserKey[:testkeys.Comparer.Split(k.UserKey)]) {
+			return "<nil>"
+		}
+		return k.String()
+	}
+	for i := 0; i <= n; i++ {
+		prefix := testkeys.Key(testkeys.Alpha(4), i)
+		for _, ts := range []int{25, 20, 18, 9, 4, 1} {
+			k := testkeys.KeyAt(testkeys.Alpha(4), i, ts)
+			expected, _ := unfiltered.SeekPrefixGE(prefix, k, base.SeekGEFlagsNone)
+			got, _ := filtered.SeekPrefixGE(prefix, k, base.SeekGEFlagsNone)
+			require.Equal(t, format(prefix, expected), format(prefix, got), "SeekPrefixGE(%s)", k)
+		}
+		expected, _ := unfiltered.SeekPrefixGE(prefix, prefix, base.SeekGEFlagsNone)
+		got, _ := filtered.SeekPrefixGE(prefix, prefix, base.SeekGEFlagsNone)
+		require.Equal(t, format(prefix, expected), format(prefix, got), "SeekPrefixGE(%s)", prefix)
+	}
+}
+
+func TestReaderPinIndexAndFilterBlocks(t *testing.T) {
+	policy := bloom.FilterPolicy(10)
+	mem := vfs.NewMem()
+	f0, err := mem.Create("test")
+	require.NoError(t, err)
+	w := NewWriter(objstorageprovider.NewFileWritable(f0), WriterOptions{
+		BlockSize:      64,
+		IndexBlockSize: 64 << 10,
+		Comparer:       testkeys.Comparer,
+		FilterPolicy:   policy,
+		FilterType:     base.TableFilter,
+	})
+	const n = 100
+	for i := 0; i < n; i += 2 {
+		require.NoError(t, w.Set(testkeys.Key(testkeys.Alpha(4), i), []byte("value")))
+	}
+	require.NoError(t, w.Close())
+
+	f1, err := mem.Open("test")
+	require.NoError(t, err)
+	c := cache.New(128 << 10)
+	defer c.Unref()
+	filterMetrics := &FilterMetricsTracker{}
+	r, err := newReader(f1, ReaderOptions{
+		Cache:    c,
+		Comparer: testkeys.Comparer,
+		Filters:  map[string]FilterPolicy{policy.Name(): policy},
+	}, filterMetrics)
+	require.NoError(t, err)
+
+	require.Zero(t, r.Properties.IndexPartitions)
+	require.False(t, r.IndexAndFilterBlocksPinned())
+	// Read the index and filter blocks into the cache before pinning them.
+	iter, err := r.NewIter(nil, nil)
+	require.NoError(t, err)
+	prefix := testkeys.Key(testkeys.Alpha(4), 0)
+	iter.SeekPrefixGE(prefix, prefix, base.SeekGEFlagsNone)
+	require.NoError(t, iter.Close())
+	for _, bh := range []BlockHandle{r.indexBH, r.filterBH} {
+		h := c.Get(r.cacheID, r.fileNum, bh.Offset)
+		require.NotNil(t, h.Get())
+		h.Release()
+	}
+	sizeBefore := c.Metrics().Size
+	require.NoError(t, r.PinIndexAndFilterBlocks())
+	require.True(t, r.IndexAndFilterBlocksPinned())
+	// Pinning again is a no-op.
+	require.NoError(t, r.PinIndexAndFilterBlocks())
+
+	// The pinned blocks are held outside the cache, but their size is
+	// reserved in it. Their cached copies were evicted, so that they aren't
+	// charged to the cache twice.
+	p := r.pinned.Load()
+	pinnedSize := int64(len(p.index.Get()) + len(p.filter.Get()))
+	require.NotZero(t, len(p.filter.Get()))
+	require.Equal(t, sizeBefore-pinnedSize, c.Metrics().Size)
+	require.LessOrEqual(t, pinnedSize, c.Metrics().Reserved)
+	for _, bh := range []BlockHandle{r.indexBH, r.filterBH} {
+		require.Nil(t, c.Get(r.cacheID, r.fileNum, bh.Offset).Get())
+	}
+
+	// Iterators don't look the pinned blocks up in the cache.
+	before := c.Metrics().Classes[cache.HighPriority]
+	iter, err = r.NewIter(nil, nil)
+	require.NoError(t, err)
+	for i := 0; i < n; i++ {
+		prefix := testkeys.Key(testkeys.Alpha(4), i)
+		k, _ := iter.SeekPrefixGE(prefix, prefix, base.SeekGEFlagsNone)
+		require.Equal(t, i%2 == 0, k != nil && bytes.Equal(prefix, k.UserKey), "SeekPrefixGE(%s)", prefix)
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, before, c.Metrics().Classes[cache.HighPriority])
+	// The absent prefixes were excluded by the pinned filter.
+	require.Less(t, int64(0), filterMetrics.Load().Hits)
+
+	// Closing the reader releases the reservation.
+	require.NoError(t, r.Close())
+	require.Zero(t, c.Metrics().Reserved)
+}
+
 func TestHamletReader(t *testing.T) {
 	prebuiltSSTs := []string{
 		"testdata/h.ldb",
@@ -663,7 +915,7 @@ func indexLayoutString(t *testing.T, r *Reader) string {
 		fmt.Fprintf(&buf, " %s: size %d\n", string(key.UserKey), bh.Length)
 		if twoLevelIndex {
 			b, err := r.readBlock(
-				context.Background(), bh.BlockHandle, nil, nil, nil)
+				context.Background(), bh.BlockHandle, nil, nil, nil, cache.NormalPriority)
 			require.NoError(t, err)
 			defer b.Release()
 			iter2, err := newBlockIter(r.Compare, b.Get())
@@ -1904,3 +2156,65 @@ func newReader(r ReadableFile, o ReaderOptions, extraOpts ...ReaderOption) (*Rea
 	}
 	return NewReader(readable, o, extraOpts...)
 }
+
+func TestReaderWarmBlock(t *testing.T) {
+	policy := bloom.FilterPolicy(10)
+	mem := vfs.NewMem()
+	f0, err := mem.Create("test")
+	require.NoError(t, err)
+	w := NewWriter(objstorageprovider.NewFileWritable(f0), WriterOptions{
+		BlockSize:      64,
+		IndexBlockSize: 128,
+		Comparer:       testkeys.Comparer,
+		FilterPolicy:   policy,
+		FilterType:     base.TableFilter,
+	})
+	for i := 0; i < 100; i++ {
+		require.NoError(t, w.Set(testkeys.Key(testkeys.Alpha(4), i), []byte("value")))
+	}
+	require.NoError(t, w.DeleteRange([]byte("a"), []byte("b")))
+	require.NoError(t, w.Close())
+
+	f1, err := mem.Open("test")
+	require.NoError(t, err)
+	c := cache.New(1 << 20)
+	defer c.Unref()
+	r, err := newReader(f1, ReaderOptions{
+		Cache:    c,
+		Comparer: testkeys.Comparer,
+		Filters:  map[string]FilterPolicy{policy.Name(): policy},
+	})
+	require.NoError(t, err)
+	defer r.Close()
+
+	l, err := r.Layout()
+	require.NoError(t, err)
+	blocks := l.Blocks()
+	kinds := make(map[BlockKind]int)
+	for _, bh := range blocks {
+		require.True(t, bh.Kind.Valid())
+		kinds[bh.Kind]++
+	}
+	require.Equal(t, len(l.Data), kinds[BlockKindData])
+	require.Equal(t, len(l.Index), kinds[BlockKindIndex])
+	require.Equal(t, 1, kinds[BlockKindTopIndex])
+	require.Equal(t, 1, kinds[BlockKindRangeDel])
+
+	// Warming the blocks makes all of them resident, after which reads of
+	// them hit in the cache.
+	c.EvictFile(r.cacheID, r.fileNum)
+	for _, bh := range blocks {
+		require.NoError(t, r.WarmBlock(context.Background(), bh))
+	}
+	require.Len(t, c.ResidentBlocks(r.cacheID, 0), len(blocks))
+	require.Len(t, c.ResidentBlocks(r.cacheID, 3), 3)
+	before := c.Metrics()
+	iter, err := r.NewIter(nil, nil)
+	require.NoError(t, err)
+	for key, _ := iter.First(); key != nil; key, _ = iter.Next() {
+	}
+	require.NoError(t, iter.Close())
+	after := c.Metrics()
+	require.Equal(t, before.Misses, after.Misses)
+	require.Greater(t, after.Hits, before.Hits)
+}
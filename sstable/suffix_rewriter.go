@@ -76,6 +76,16 @@ func rewriteKeySuffixesInBlocks(
 	if concurrency < 1 {
 		return nil, TableFormatUnspecified, errors.New("concurrency must be >= 1")
 	}
+	// Blocks are copied or rewritten without being decrypted or encrypted.
+	if r.Properties.EncryptionKeyID != "" || o.Encryption != nil {
+		return nil, TableFormatUnspecified,
+			errors.New("cannot rewrite the suffixes of encrypted sstables in blocks")
+	}
+	// The key-value checksums stored with the keys cover their suffixes.
+	if r.Properties.KVChecksums || o.KVChecksums {
+		return nil, TableFormatUnspecified,
+			errors.New("cannot rewrite the suffixes of sstables with key-value checksums in blocks")
+	}
 	// Even though NumValueBlocks = 0 => NumValuesInValueBlocks = 0, check both
 	// as a defensive measure.
 	if r.Properties.NumValueBlocks > 0 || r.Properties.NumValuesInValueBlocks > 0 {
@@ -152,6 +162,7 @@ func rewriteBlocks(
 	restartInterval int,
 	checksumType ChecksumType,
 	compression Compression,
+	compressionLevel int,
 	input []BlockHandleWithProperties,
 	output []blockWithSpan,
 	totalWorkers, worker int,
@@ -245,7 +256,7 @@ func rewriteBlocks(
 
 		keyAlloc, output[i].end = cloneKeyWithBuf(scratch, keyAlloc)
 
-		finished := compressAndChecksum(bw.finish(), compression, &buf)
+		finished := compressAndChecksum(bw.finish(), compression, compressionLevel, nil /* dict */, &buf)
 
 		// copy our finished block into the output buffer.
 		blockAlloc, output[i].data = blockAlloc.Alloc(len(finished) + blockTrailerLen)
@@ -273,6 +284,11 @@ func rewriteDataBlocksToWriter(
 		if r.Properties.FilterPolicyName != w.filter.policyName() {
 			return errors.New("mismatched filters")
 		}
+		if r.Properties.FilterPartitions > 0 {
+			// The partitions are located by user keys, which the replacement
+			// of suffixes would invalidate.
+			return errors.New("cannot copy partitioned filters")
+		}
 		if was, is := r.Properties.ComparerName, w.props.ComparerName; was != is {
 			return errors.Errorf("mismatched Comparer %s vs %s, replacement requires same splitter to copy filters", was, is)
 		}
@@ -290,6 +306,7 @@ func rewriteDataBlocksToWriter(
 				w.dataBlockBuf.dataBlock.restartInterval,
 				w.blockBuf.checksummer.checksumType,
 				w.compression,
+				w.compressionLevel,
 				data,
 				blocks,
 				concurrency,
@@ -472,7 +489,7 @@ func RewriteKeySuffixesViaWriter(
 		if err != nil {
 			return nil, err
 		}
-		if w.addPoint(scratch, val); err != nil {
+		if w.addPoint(scratch, val, nil /* checksum */); err != nil {
 			return nil, err
 		}
 		k, v = i.Next()
@@ -511,7 +528,7 @@ func readBlockBuf(r *Reader, bh BlockHandle, buf []byte) ([]byte, []byte, error)
 	if cap(buf) < decompressedLen {
 		buf = make([]byte, decompressedLen)
 	}
-	res, err := decompressInto(typ, raw[prefix:], buf[:decompressedLen])
+	res, err := decompressInto(typ, raw[prefix:], buf[:decompressedLen], r.zstdDict)
 	return res, buf, err
 }
 
@@ -162,6 +162,28 @@ the names of the meta blocks.
 For a description of value blocks and the meta value index block, see
 value_block.go
 
+Tables written with TableFormatPebblev5 or later may contain a zstd dictionary
+meta block, named "pebble.zstd_dictionary". The dictionary block is never
+compressed, and contains a raw content dictionary trained from samples of the
+table's data and value blocks. Blocks compressed against the dictionary have
+the block type zstdDictCompressionBlockType. See compression_dict.go.
+
+Tables written with TableFormatPebblev6 or later may contain blocks compressed
+with LZ4, which have the block type lz4CompressionBlockType, or lz4hcCompressionBlockType if compressed with LZ4's
+high compression mode. Like RocksDB's, LZ4 blocks are prefixed with the varint
+encoded length of the decompressed block.
+
+Tables written with TableFormatPebblev7 or later may have encrypted blocks, in
+which case the properties record the ID of the encryption key and of the table.
+All blocks but the metaindex and properties blocks are encrypted. See
+encryption.go.
+
+Tables written with TableFormatPebblev8 or later may store a key-value checksum
+after the value of each point key, in which case the "pebble.kv-checksums"
+property is set. See kv_checksum.go. Their properties always record the number
+of keys pinned by snapshots ("pebble.num.snapshot-pinned-keys"), even if zero,
+so that the absence of older versions of keys can be relied upon.
+
 */
 
 const (
@@ -192,10 +214,20 @@ const (
 
 	metaRangeKeyName   = "pebble.range_key"
 	metaValueIndexName = "pebble.value_index"
+	metaZstdDictName   = "pebble.zstd_dictionary"
 	metaPropertiesName = "rocksdb.properties"
 	metaRangeDelName   = "rocksdb.range_del"
 	metaRangeDelV2Name = "rocksdb.range_del2"
 
+	// metaRangeFilterPrefix is the prefix of the metaindex key of the range
+	// filter block, which is followed by the name of the filter policy.
+	metaRangeFilterPrefix = "pebble.range_filter."
+
+	// metaPartitionedFilterPrefix is the prefix of the metaindex key of the
+	// top-level index of a partitioned table filter, which is followed by the
+	// name of the filter policy.
+	metaPartitionedFilterPrefix = "partitionedfilter."
+
 	// Index Types.
 	// A space efficient index block that is optimized for binary-search-based
 	// index.
@@ -256,6 +288,11 @@ const (
 	lz4hcCompressionBlockType  blockType = 5
 	xpressCompressionBlockType blockType = 6
 	zstdCompressionBlockType   blockType = 7
+	// zstdDictCompressionBlockType is a Pebble-specific block type for blocks
+	// compressed with zstd against the table's zstd dictionary. Like
+	// zstdCompressionBlockType, the compressed data is prefixed with the
+	// varint-encoded decompressed length.
+	zstdDictCompressionBlockType blockType = 8
 )
 
 // String implements fmt.Stringer.
@@ -277,6 +314,8 @@ func (t blockType) String() string {
 		return "xpress"
 	case 7:
 		return "zstd"
+	case 8:
+		return "zstd-dict"
 	default:
 		panic(errors.Newf("sstable: unknown block type: %d", t))
 	}
@@ -428,7 +467,8 @@ func supportsTwoLevelIndex(format TableFormat) bool {
 	switch format {
 	case TableFormatLevelDB:
 		return false
-	case TableFormatRocksDBv2, TableFormatPebblev1, TableFormatPebblev2, TableFormatPebblev3, TableFormatPebblev4:
+	case TableFormatRocksDBv2, TableFormatPebblev1, TableFormatPebblev2, TableFormatPebblev3, TableFormatPebblev4,
+		TableFormatPebblev5, TableFormatPebblev6, TableFormatPebblev7, TableFormatPebblev8:
 		return true
 	default:
 		panic("sstable: unspecified table format version")
@@ -389,10 +389,15 @@ type valueBlocksAndIndexStats struct {
 type valueBlockWriter struct {
 	// The configured uncompressed block size and size threshold
 	blockSize, blockSizeThreshold int
-	// Configured compression.
-	compression Compression
+	// compressor compresses value blocks with the configured compression.
+	compressor blockCompressor
 	// checksummer with configured checksum type.
 	checksummer checksummer
+	// cipher, if non-nil, encrypts blocks after compression. Blocks are
+	// encrypted when they're written, since their offset in the file is
+	// authenticated along with them, into encryptedBuf.
+	cipher       *blockCipher
+	encryptedBuf []byte
 	// Block finished callback.
 	blockFinishedFunc func(compressedSize int)
 
@@ -460,8 +465,9 @@ var valueBlockWriterPool = sync.Pool{
 func newValueBlockWriter(
 	blockSize int,
 	blockSizeThreshold int,
-	compression Compression,
+	compressor blockCompressor,
 	checksumType ChecksumType,
+	cipher *blockCipher,
 	// compressedSize should exclude the block trailer.
 	blockFinishedFunc func(compressedSize int),
 ) *valueBlockWriter {
@@ -469,10 +475,11 @@ func newValueBlockWriter(
 	*w = valueBlockWriter{
 		blockSize:          blockSize,
 		blockSizeThreshold: blockSizeThreshold,
-		compression:        compression,
+		compressor:         compressor,
 		checksummer: checksummer{
 			checksumType: checksumType,
 		},
+		cipher:            cipher,
 		blockFinishedFunc: blockFinishedFunc,
 		buf:               uncompressedValueBlockBufPool.Get().(*blockBuffer),
 		compressedBuf:     compressedValueBlockBufPool.Get().(*blockBuffer),
@@ -552,16 +559,11 @@ func (w *valueBlockWriter) addValue(v []byte) (valueHandle, error) {
 func (w *valueBlockWriter) compressAndFlush() {
 	// Compress the buffer, discarding the result if the improvement isn't at
 	// least 12.5%.
-	blockType := noCompressionBlockType
 	b := w.buf
-	if w.compression != NoCompression {
-		blockType, w.compressedBuf.b =
-			compressBlock(w.compression, w.buf.b, w.compressedBuf.b[:cap(w.compressedBuf.b)])
-		if len(w.compressedBuf.b) < len(w.buf.b)-len(w.buf.b)/8 {
-			b = w.compressedBuf
-		} else {
-			blockType = noCompressionBlockType
-		}
+	blockType, compressedBlock := w.compressor.compress(w.buf.b, &w.compressedBuf.b)
+	if blockType != noCompressionBlockType {
+		w.compressedBuf.b = compressedBlock
+		b = w.compressedBuf
 	}
 	n := len(b.b)
 	if n+blockTrailerLen > cap(b.b) {
@@ -572,9 +574,15 @@ func (w *valueBlockWriter) compressAndFlush() {
 		b.b = b.b[:n+blockTrailerLen]
 	}
 	b.b[n] = byte(blockType)
-	w.computeChecksum(b.b)
+	if w.cipher == nil {
+		w.computeChecksum(b.b)
+	} else {
+		// The block is encrypted, and checksummed, by finish. Encryption adds a
+		// fixed overhead, so the block's handle is already known.
+		n += blockEncryptionOverhead
+	}
 	bh := BlockHandle{Offset: w.totalBlockBytes, Length: uint64(n)}
-	w.totalBlockBytes += uint64(len(b.b))
+	w.totalBlockBytes += uint64(n + blockTrailerLen)
 	// blockFinishedFunc length excludes the block trailer.
 	w.blockFinishedFunc(n)
 	compressed := blockType != noCompressionBlockType
@@ -598,6 +606,19 @@ func (w *valueBlockWriter) computeChecksum(block []byte) {
 	binary.LittleEndian.PutUint32(block[n+1:], checksum)
 }
 
+// encryptAndChecksum encrypts the block, which is followed by a trailer
+// holding its type and is written at the given offset, into w.encryptedBuf,
+// and returns the encrypted block followed by its trailer.
+func (w *valueBlockWriter) encryptAndChecksum(block []byte, offset uint64) []byte {
+	n := len(block) - blockTrailerLen
+	typ := blockType(block[n])
+	b := w.cipher.encrypt(w.encryptedBuf[:0], block[:n], typ, offset)
+	b = append(b, block[n:]...)
+	w.computeChecksum(b)
+	w.encryptedBuf = b
+	return b
+}
+
 func (w *valueBlockWriter) finish(
 	writer io.Writer, fileOffset uint64,
 ) (valueBlocksIndexHandle, valueBlocksAndIndexStats, error) {
@@ -611,11 +632,15 @@ func (w *valueBlockWriter) finish(
 	largestOffset := uint64(0)
 	largestLength := uint64(0)
 	for i := range w.blocks {
-		_, err := writer.Write(w.blocks[i].block.b)
+		w.blocks[i].handle.Offset += fileOffset
+		b := w.blocks[i].block.b
+		if w.cipher != nil {
+			b = w.encryptAndChecksum(b, w.blocks[i].handle.Offset)
+		}
+		_, err := writer.Write(b)
 		if err != nil {
 			return valueBlocksIndexHandle{}, valueBlocksAndIndexStats{}, err
 		}
-		w.blocks[i].handle.Offset += fileOffset
 		largestOffset = w.blocks[i].handle.Offset
 		if largestLength < w.blocks[i].handle.Length {
 			largestLength = w.blocks[i].handle.Length
@@ -670,7 +695,12 @@ func (w *valueBlockWriter) writeValueBlocksIndex(
 		panic("incorrect length calculation")
 	}
 	b[0] = byte(noCompressionBlockType)
-	w.computeChecksum(buf)
+	if w.cipher != nil {
+		buf = w.encryptAndChecksum(buf, h.h.Offset)
+		h.h.Length = uint64(len(buf) - blockTrailerLen)
+	} else {
+		w.computeChecksum(buf)
+	}
 	if _, err := writer.Write(buf); err != nil {
 		return valueBlocksIndexHandle{}, err
 	}
@@ -751,7 +781,7 @@ func (bpwc blockProviderWhenClosed) readBlockForVBR(
 	ctx context.Context, h BlockHandle, stats *base.InternalIteratorStats,
 ) (cache.Handle, error) {
 	ctx = objiotracing.WithBlockType(ctx, objiotracing.ValueBlock)
-	return bpwc.r.readBlock(ctx, h, nil, nil, stats)
+	return bpwc.r.readBlock(ctx, h, nil, nil, stats, dataCachePriorityFromContext(ctx))
 }
 
 // ReaderProvider supports the implementation of blockProviderWhenClosed.
@@ -51,6 +51,9 @@ type WriterMetadata struct {
 	SmallestSeqNum   uint64
 	LargestSeqNum    uint64
 	Properties       Properties
+	// CompressionStats describes the compression of the table's data and value
+	// blocks.
+	CompressionStats CompressionStats
 }
 
 // SetSmallestPointKey sets the smallest point key to the given key.
@@ -129,12 +132,16 @@ type Writer struct {
 	split                   Split
 	formatKey               base.FormatKey
 	compression             Compression
+	compressionLevel        int
 	separator               Separator
 	successor               Successor
 	tableFormat             TableFormat
 	cache                   *cache.Cache
 	restartInterval         int
 	checksumType            ChecksumType
+	// dataBlockCompressor compresses data blocks with the configured
+	// compression, and records the table's CompressionStats.
+	dataBlockCompressor blockCompressor
 	// disableKeyOrderChecks disables the checks that keys are added to an
 	// sstable in order. It is intended for internal use only in the construction
 	// of invalid sstables for testing. See tool/make_test_sstables.go.
@@ -166,11 +173,16 @@ type Writer struct {
 	props               Properties
 	propCollectors      []TablePropertyCollector
 	blockPropCollectors []BlockPropertyCollector
-	blockPropsEncoder   blockPropertiesEncoder
+	// blockPropCollectorValues records, for each of blockPropCollectors, whether
+	// the collector is a ValueBlockPropertyCollector requiring values.
+	blockPropCollectorValues []bool
+	blockPropsEncoder        blockPropertiesEncoder
 	// filter accumulates the filter block. If populated, the filter ingests
 	// either the output of w.split (i.e. a prefix extractor) if w.split is not
-	// nil, or the full keys otherwise.
+	// nil, or the full keys otherwise. The rangeFilter, if non-nil,
+	// accumulates the range filter block (see WriterOptions.RangeFilterPrefixLen).
 	filter          filterWriter
+	rangeFilter     *rangeFilterWriter
 	indexPartitions []indexBlockAndBlockProperties
 
 	// indexBlockAlloc is used to bulk-allocate byte slices used to store index
@@ -206,6 +218,21 @@ type Writer struct {
 	shortAttributeExtractor   base.ShortAttributeExtractor
 	requiredInPlaceValueBound UserKeyPrefixBound
 	valueBlockWriter          *valueBlockWriter
+
+	// zstdDict samples data and value blocks and trains the table's zstd
+	// dictionary. Only non-nil when using ZstdDictionaryCompression.
+	zstdDict *zstdDictTrainer
+
+	// blockCipher encrypts the table's blocks. Only non-nil when
+	// WriterOptions.Encryption is set.
+	blockCipher *blockCipher
+
+	// kvChecksums is set if the key-value checksum of each point key is
+	// stored after its value. See WriterOptions.KVChecksums.
+	kvChecksums bool
+	// kvChecksumBuf holds the value stored with the current point key,
+	// followed by its key-value checksum.
+	kvChecksumBuf []byte
 }
 
 type pointKeyInfo struct {
@@ -573,6 +600,11 @@ type blockBuf struct {
 	// lifetime of the blockBuf, avoiding the allocation of a temporary buffer for each block.
 	compressedBuf []byte
 	checksummer   checksummer
+	// cipher, if non-nil, encrypts blocks after compression, into
+	// encryptedBuf. Since a block's offset is authenticated along with it, the
+	// block is encrypted, and then checksummed, when it's written.
+	cipher       *blockCipher
+	encryptedBuf []byte
 }
 
 func (b *blockBuf) clear() {
@@ -581,6 +613,7 @@ func (b *blockBuf) clear() {
 	// to make an allocation.
 	*b = blockBuf{
 		compressedBuf: b.compressedBuf, checksummer: b.checksummer,
+		cipher: b.cipher, encryptedBuf: b.encryptedBuf,
 	}
 }
 
@@ -631,10 +664,13 @@ var dataBlockBufPool = sync.Pool{
 	},
 }
 
-func newDataBlockBuf(restartInterval int, checksumType ChecksumType) *dataBlockBuf {
+func newDataBlockBuf(
+	restartInterval int, checksumType ChecksumType, cipher *blockCipher,
+) *dataBlockBuf {
 	d := dataBlockBufPool.Get().(*dataBlockBuf)
 	d.dataBlock.restartInterval = restartInterval
 	d.checksummer.checksumType = checksumType
+	d.cipher = cipher
 	return d
 }
 
@@ -642,8 +678,9 @@ func (d *dataBlockBuf) finish() {
 	d.uncompressed = d.dataBlock.finish()
 }
 
-func (d *dataBlockBuf) compressAndChecksum(c Compression) {
-	d.compressed = compressAndChecksum(d.uncompressed, c, &d.blockBuf)
+func (d *dataBlockBuf) compressAndChecksum(c *blockCompressor) {
+	blockType, b := c.compress(d.uncompressed, &d.compressedBuf)
+	d.compressed = checksumBlock(b, blockType, &d.blockBuf)
 }
 
 func (d *dataBlockBuf) shouldFlush(
@@ -673,7 +710,7 @@ func (w *Writer) Set(key, value []byte) error {
 	if w.err != nil {
 		return w.err
 	}
-	return w.addPoint(base.MakeInternalKey(key, 0, InternalKeyKindSet), value)
+	return w.addPoint(base.MakeInternalKey(key, 0, InternalKeyKindSet), value, nil /* checksum */)
 }
 
 // Delete deletes the value for the given key. The sequence number is set to
@@ -685,7 +722,7 @@ func (w *Writer) Delete(key []byte) error {
 	if w.err != nil {
 		return w.err
 	}
-	return w.addPoint(base.MakeInternalKey(key, 0, InternalKeyKindDelete), nil)
+	return w.addPoint(base.MakeInternalKey(key, 0, InternalKeyKindDelete), nil, nil /* checksum */)
 }
 
 // DeleteRange deletes all of the keys (and values) in the range [start,end)
@@ -711,7 +748,7 @@ func (w *Writer) Merge(key, value []byte) error {
 	if w.err != nil {
 		return w.err
 	}
-	return w.addPoint(base.MakeInternalKey(key, 0, InternalKeyKindMerge), value)
+	return w.addPoint(base.MakeInternalKey(key, 0, InternalKeyKindMerge), value, nil /* checksum */)
 }
 
 // Add adds a key/value pair to the table being written. For a given Writer,
@@ -735,7 +772,33 @@ func (w *Writer) Add(key InternalKey, value []byte) error {
 			"pebble: range keys must be added via one of the RangeKey* functions")
 		return w.err
 	}
-	return w.addPoint(key, value)
+	return w.addPoint(key, value, nil /* checksum */)
+}
+
+// AddWithKVChecksum is like Add, but takes the key-value checksum of the point
+// key and its value, computed when the key was first written (see
+// base.KVChecksum). The checksum is verified before the key is added, so that
+// corruption of the key or value since it was computed is detected rather than
+// persisted, and it's stored with the key if WriterOptions.KVChecksums is set.
+func (w *Writer) AddWithKVChecksum(key InternalKey, value []byte, checksum base.KVChecksum) error {
+	if w.err != nil {
+		return w.err
+	}
+	if base.MakeKVChecksum(key.Kind(), key.UserKey, value) != checksum {
+		w.err = base.KVChecksumMismatchError(key, "sstable writer")
+		return w.err
+	}
+	switch key.Kind() {
+	case InternalKeyKindRangeDelete:
+		return w.addTombstone(key, value)
+	case base.InternalKeyKindRangeKeyDelete,
+		base.InternalKeyKindRangeKeySet,
+		base.InternalKeyKindRangeKeyUnset:
+		w.err = errors.Errorf(
+			"pebble: range keys must be added via one of the RangeKey* functions")
+		return w.err
+	}
+	return w.addPoint(key, value, &checksum)
 }
 
 func (w *Writer) makeAddPointDecisionV2(key InternalKey) error {
@@ -835,7 +898,9 @@ func (w *Writer) makeAddPointDecisionV3(
 	return setHasSamePrefix, considerWriteToValueBlock, nil
 }
 
-func (w *Writer) addPoint(key InternalKey, value []byte) error {
+// addPoint adds the point key and its value. If the writer stores key-value
+// checksums, it stores checksum, or computes the checksum if it's nil.
+func (w *Writer) addPoint(key InternalKey, value []byte, checksum *base.KVChecksum) error {
 	var err error
 	var setHasSameKeyPrefix, writeToValueBlock, addPrefixToValueStoredWithKey bool
 	maxSharedKeyLen := len(key.UserKey)
@@ -883,6 +948,18 @@ func (w *Writer) addPoint(key InternalKey, value []byte) error {
 		}
 		prefix = makePrefixForInPlaceValue(setHasSameKeyPrefix)
 	}
+	if w.kvChecksums {
+		// The checksum covers the value even if it's stored in a value block,
+		// where it's verified when it's fetched.
+		if checksum == nil {
+			c := base.MakeKVChecksum(key.Kind(), key.UserKey, value)
+			checksum = &c
+		}
+		w.kvChecksumBuf = binary.LittleEndian.AppendUint64(
+			append(w.kvChecksumBuf[:0], valueStoredWithKey...), uint64(*checksum))
+		valueStoredWithKey = w.kvChecksumBuf
+		valueStoredWithKeyLen += kvChecksumLen
+	}
 
 	if err := w.maybeFlush(key, valueStoredWithKeyLen); err != nil {
 		return err
@@ -896,10 +973,12 @@ func (w *Writer) addPoint(key InternalKey, value []byte) error {
 	}
 	for i := range w.blockPropCollectors {
 		v := value
-		if addPrefixToValueStoredWithKey {
+		if addPrefixToValueStoredWithKey &&
+			(w.blockPropCollectorValues == nil || !w.blockPropCollectorValues[i]) {
 			// Values for SET are not required to be in-place, and in the future may
 			// not even be read by the compaction, so pass nil values. Block
-			// property collectors in such Pebble DB's must not look at the value.
+			// property collectors in such Pebble DB's must not look at the value,
+			// unless they're a ValueBlockPropertyCollector.
 			v = nil
 		}
 		if err := w.blockPropCollectors[i].Add(key, v); err != nil {
@@ -1282,13 +1361,26 @@ func (w *Writer) tempRangeKeyCopy(k []byte) []byte {
 }
 
 func (w *Writer) maybeAddToFilter(key []byte) {
+	if w.filter == nil && w.rangeFilter == nil {
+		return
+	}
+	prefix := key
+	if w.split != nil {
+		prefix = key[:w.split(key)]
+	}
 	if w.filter != nil {
-		if w.split != nil {
-			prefix := key[:w.split(key)]
-			w.filter.addKey(prefix)
-		} else {
-			w.filter.addKey(key)
-		}
+		w.filter.addKey(prefix)
+	}
+	if w.rangeFilter != nil {
+		w.rangeFilter.addPrefix(prefix)
+	}
+}
+
+// finishFilterDataBlock informs a partitioned filter that the current data
+// block is finished, and whether it starts a new index partition.
+func (w *Writer) finishFilterDataBlock(lastKey []byte, newIndexPartition bool) {
+	if f, ok := w.filter.(*partitionedFilterWriter); ok {
+		f.finishDataBlock(lastKey, newIndexPartition)
 	}
 }
 
@@ -1299,7 +1391,7 @@ func (w *Writer) flush(key InternalKey) error {
 		return err
 	}
 	w.dataBlockBuf.finish()
-	w.dataBlockBuf.compressAndChecksum(w.compression)
+	w.dataBlockBuf.compressAndChecksum(&w.dataBlockCompressor)
 	// Since dataBlockEstimates.addInflightDataBlock was never called, the
 	// inflightSize is set to 0.
 	w.coordination.sizeEstimate.dataBlockCompressed(len(w.dataBlockBuf.compressed), 0)
@@ -1336,6 +1428,8 @@ func (w *Writer) flush(key InternalKey) error {
 		}
 	}
 
+	w.finishFilterDataBlock(prevKey.UserKey, shouldFlushIndexBlock)
+
 	// We've called BlockPropertyCollector.FinishDataBlock, and, if necessary,
 	// BlockPropertyCollector.FinishIndexBlock. Since we've decided to finish
 	// the data block, we can call
@@ -1363,7 +1457,7 @@ func (w *Writer) flush(key InternalKey) error {
 	} else {
 		err = w.coordination.writeQueue.addSync(writeTask)
 	}
-	w.dataBlockBuf = newDataBlockBuf(w.restartInterval, w.checksumType)
+	w.dataBlockBuf = newDataBlockBuf(w.restartInterval, w.checksumType, w.blockCipher)
 
 	return err
 }
@@ -1515,6 +1609,7 @@ func (w *Writer) addIndexEntrySync(
 		}
 	}
 
+	w.finishFilterDataBlock(prevKey.UserKey, shouldFlush)
 	err = w.addIndexEntry(sep, bhp, tmp, flushableIndexBlock, w.indexBlock, 0, props)
 	if flushableIndexBlock != nil {
 		flushableIndexBlock.clear()
@@ -1652,20 +1747,58 @@ func (w *Writer) writeTwoLevelIndex() (BlockHandle, error) {
 	return w.writeBlock(w.topLevelIndexBlock.finish(), w.compression, &w.blockBuf)
 }
 
-func compressAndChecksum(b []byte, compression Compression, blockBuf *blockBuf) []byte {
+// writeFilterPartitions writes the partitions of a partitioned filter,
+// followed by the top-level filter index on them, and returns the handle of
+// the filter index. The filter index maps the last user key covered by each
+// partition to the partition's block handle.
+func (w *Writer) writeFilterPartitions(f *partitionedFilterWriter) (BlockHandle, error) {
+	var index rawBlockWriter
+	index.restartInterval = 1
+	for i := range f.partitions {
+		p := &f.partitions[i]
+		bh, err := w.writeBlock(p.data, NoCompression, &w.blockBuf)
+		if err != nil {
+			return BlockHandle{}, err
+		}
+		w.props.FilterSize += bh.Length
+		n := encodeBlockHandle(w.blockBuf.tmp[:], bh)
+		index.add(InternalKey{UserKey: p.lastKey}, w.blockBuf.tmp[:n])
+	}
+	bh, err := w.writeBlock(index.finish(), NoCompression, &w.blockBuf)
+	if err != nil {
+		return BlockHandle{}, err
+	}
+	w.props.FilterPartitions = uint64(len(f.partitions))
+	w.props.FilterSize += bh.Length
+	return bh, nil
+}
+
+func compressAndChecksum(
+	b []byte, compression Compression, level int, dict *zstdDict, blockBuf *blockBuf,
+) []byte {
 	// Compress the buffer, discarding the result if the improvement isn't at
 	// least 12.5%.
-	blockType, compressed := compressBlock(compression, b, blockBuf.compressedBuf)
+	blockType, compressed := compressBlock(compression, level, b, blockBuf.compressedBuf, dict)
 	if blockType != noCompressionBlockType && cap(compressed) > cap(blockBuf.compressedBuf) {
 		blockBuf.compressedBuf = compressed[:cap(compressed)]
 	}
-	if len(compressed) < len(b)-len(b)/8 {
+	if compressionPaysOff(len(b), len(compressed)) {
 		b = compressed
 	} else {
 		blockType = noCompressionBlockType
 	}
+	return checksumBlock(b, blockType, blockBuf)
+}
 
+// checksumBlock computes the trailer of the block b, which is of the given
+// block type, into blockBuf.tmp. It returns b. If the blockBuf has a cipher,
+// the checksum is instead computed by encryptAndChecksum when the block is
+// written.
+func checksumBlock(b []byte, blockType blockType, blockBuf *blockBuf) []byte {
 	blockBuf.tmp[0] = byte(blockType)
+	if blockBuf.cipher != nil {
+		return b
+	}
 
 	// Calculate the checksum.
 	checksum := blockBuf.checksummer.checksum(b, blockBuf.tmp[:1])
@@ -1673,7 +1806,27 @@ func compressAndChecksum(b []byte, compression Compression, blockBuf *blockBuf)
 	return b
 }
 
-func (w *Writer) writeCompressedBlock(block []byte, blockTrailerBuf []byte) (BlockHandle, error) {
+// encryptAndChecksum encrypts the block b, which is to be written at the
+// given offset, into blockBuf.encryptedBuf, and computes the checksum of the
+// encrypted block into the trailer in blockBuf.tmp, which holds the block's
+// type. It returns the encrypted block.
+func encryptAndChecksum(b []byte, offset uint64, blockBuf *blockBuf) []byte {
+	typ := blockType(blockBuf.tmp[0])
+	blockBuf.encryptedBuf = blockBuf.cipher.encrypt(blockBuf.encryptedBuf[:0], b, typ, offset)
+	b = blockBuf.encryptedBuf
+	checksum := blockBuf.checksummer.checksum(b, blockBuf.tmp[:1])
+	binary.LittleEndian.PutUint32(blockBuf.tmp[1:5], checksum)
+	return b
+}
+
+// writeCompressedBlock writes the block, followed by the trailer computed
+// into blockBuf.tmp by checksumBlock, encrypting the block first if the
+// blockBuf has a cipher.
+func (w *Writer) writeCompressedBlock(block []byte, blockBuf *blockBuf) (BlockHandle, error) {
+	if blockBuf.cipher != nil {
+		block = encryptAndChecksum(block, w.meta.Size, blockBuf)
+	}
+	blockTrailerBuf := blockBuf.tmp[:]
 	bh := BlockHandle{Offset: w.meta.Size, Length: uint64(len(block))}
 
 	if w.cacheID != 0 && w.fileNum.FileNum() != 0 {
@@ -1721,8 +1874,8 @@ func (w *Writer) Write(blockWithTrailer []byte) (n int, err error) {
 func (w *Writer) writeBlock(
 	b []byte, compression Compression, blockBuf *blockBuf,
 ) (BlockHandle, error) {
-	b = compressAndChecksum(b, compression, blockBuf)
-	return w.writeCompressedBlock(b, blockBuf.tmp[:])
+	b = compressAndChecksum(b, compression, w.compressionLevel, nil /* dict */, blockBuf)
+	return w.writeCompressedBlock(b, blockBuf)
 }
 
 // assertFormatCompatibility ensures that the features present on the table are
@@ -1810,7 +1963,9 @@ func (w *Writer) Close() (err error) {
 	// Finish the last data block, or force an empty data block if there
 	// aren't any data blocks at all.
 	if w.dataBlockBuf.dataBlock.nEntries > 0 || w.indexBlock.block.nEntries == 0 {
-		bh, err := w.writeBlock(w.dataBlockBuf.dataBlock.finish(), w.compression, &w.dataBlockBuf.blockBuf)
+		w.dataBlockBuf.finish()
+		w.dataBlockBuf.compressAndChecksum(&w.dataBlockCompressor)
+		bh, err := w.writeCompressedBlock(w.dataBlockBuf.compressed, &w.dataBlockBuf.blockBuf)
 		if err != nil {
 			return err
 		}
@@ -1833,14 +1988,32 @@ func (w *Writer) Close() (err error) {
 		if err != nil {
 			return err
 		}
-		bh, err := w.writeBlock(b, NoCompression, &w.blockBuf)
+		var bh BlockHandle
+		if f, ok := w.filter.(*partitionedFilterWriter); ok && f.partitioned() {
+			bh, err = w.writeFilterPartitions(f)
+		} else {
+			bh, err = w.writeBlock(b, NoCompression, &w.blockBuf)
+			w.props.FilterSize = bh.Length
+		}
 		if err != nil {
 			return err
 		}
 		n := encodeBlockHandle(w.blockBuf.tmp[:], bh)
 		metaindex.add(InternalKey{UserKey: []byte(w.filter.metaName())}, w.blockBuf.tmp[:n])
 		w.props.FilterPolicyName = w.filter.policyName()
-		w.props.FilterSize = bh.Length
+	}
+	if w.rangeFilter != nil {
+		b, err := w.rangeFilter.finish()
+		if err != nil {
+			return err
+		}
+		bh, err := w.writeBlock(b, NoCompression, &w.blockBuf)
+		if err != nil {
+			return err
+		}
+		n := encodeBlockHandle(w.blockBuf.tmp[:], bh)
+		metaindex.add(InternalKey{UserKey: []byte(w.rangeFilter.metaName())}, w.blockBuf.tmp[:n])
+		w.props.RangeFilterPrefixLen = uint64(w.rangeFilter.prefixLen)
 	}
 
 	var indexBH BlockHandle
@@ -1937,6 +2110,17 @@ func (w *Writer) Close() (err error) {
 		metaindex.add(InternalKey{UserKey: []byte(metaRangeKeyName)}, w.blockBuf.tmp[:n])
 	}
 
+	// Write the zstd dictionary block, if a dictionary was trained. The
+	// dictionary block is never compressed.
+	if dict := w.zstdDict.dictionary(); dict != nil {
+		bh, err := w.writeBlock(dict.raw, NoCompression, &w.blockBuf)
+		if err != nil {
+			return err
+		}
+		n := encodeBlockHandle(w.blockBuf.tmp[:], bh)
+		metaindex.add(InternalKey{UserKey: []byte(metaZstdDictName)}, w.blockBuf.tmp[:n])
+	}
+
 	{
 		userProps := make(map[string]string)
 		for i := range w.propCollectors {
@@ -1965,13 +2149,17 @@ func (w *Writer) Close() (err error) {
 			w.props.UserProperties = userProps
 		}
 
-		// Write the properties block.
+		// Write the properties block. The properties, which record the ID of
+		// the encryption key, and the metaindex block aren't encrypted, so
+		// that a Reader can find the key.
+		w.blockBuf.cipher = nil
 		var raw rawBlockWriter
 		// The restart interval is set to infinity because the properties block
 		// is always read sequentially and cached in a heap located object. This
 		// reduces table size without a significant impact on performance.
 		raw.restartInterval = propertiesBlockRestartInterval
 		w.props.CompressionOptions = rocksDBCompressionOptions
+		w.props.KVChecksums = w.kvChecksums
 		w.props.save(w.tableFormat, &raw)
 		bh, err := w.writeBlock(raw.finish(), NoCompression, &w.blockBuf)
 		if err != nil {
@@ -2112,6 +2300,7 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		split:                   o.Comparer.Split,
 		formatKey:               o.Comparer.FormatKey,
 		compression:             o.Compression,
+		compressionLevel:        o.CompressionLevel,
 		separator:               o.Comparer.Separator,
 		successor:               o.Comparer.Successor,
 		tableFormat:             o.TableFormat,
@@ -2133,19 +2322,73 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 			Format: o.Comparer.FormatKey,
 		},
 	}
+	w.kvChecksums = o.KVChecksums
+	var formatErr error
+	if o.KVChecksums && o.TableFormat < TableFormatPebblev8 {
+		// Readers of earlier formats would return the checksums as part of
+		// the values.
+		formatErr = errors.Errorf("pebble/table: key-value checksums require %s, but the table format is %s",
+			TableFormatPebblev8, o.TableFormat)
+	}
+	var encryptionErr error
+	if o.Encryption != nil {
+		if o.TableFormat < TableFormatPebblev7 {
+			// Readers of earlier formats would read the encrypted blocks as
+			// corrupt.
+			encryptionErr = errors.Errorf("pebble/table: encryption requires %s, but the table format is %s",
+				TableFormatPebblev7, o.TableFormat)
+		} else if o.Encryption.ID == "" {
+			encryptionErr = errors.New("pebble/table: encryption key has no ID")
+		} else {
+			w.props.EncryptionKeyID = o.Encryption.ID
+			w.props.EncryptionTableID = makeEncryptionTableID()
+			w.blockCipher, encryptionErr = newBlockCipher(o.Encryption.Secret, w.props.EncryptionTableID)
+		}
+	}
+	switch w.compression {
+	case ZstdDictionaryCompression:
+		// Dictionaries require TableFormatPebblev5. For older formats, fall back
+		// to compressing without a dictionary.
+		if w.tableFormat < TableFormatPebblev5 {
+			w.compression = ZstdCompression
+		} else {
+			w.zstdDict = newZstdDictTrainer()
+		}
+	case LZ4Compression:
+		// LZ4 compression requires TableFormatPebblev6. For older formats, fall
+		// back to the default compression.
+		if w.tableFormat < TableFormatPebblev6 {
+			w.compression = SnappyCompression
+		}
+	}
+	w.dataBlockCompressor = blockCompressor{
+		compression: w.compression,
+		level:       w.compressionLevel,
+		zstdDict:    w.zstdDict,
+		stats:       &w.meta.CompressionStats,
+	}
+	valueBlockCompressor := w.dataBlockCompressor
+	if w.compression == AdaptiveCompression {
+		// Data and value blocks are compressed adaptively, independently of
+		// each other.
+		w.dataBlockCompressor.adaptive = newAdaptiveCompressor(o.AdaptiveZstdBudget)
+		valueBlockCompressor.adaptive = newAdaptiveCompressor(o.AdaptiveZstdBudget)
+	}
 	if w.tableFormat >= TableFormatPebblev3 {
 		w.shortAttributeExtractor = o.ShortAttributeExtractor
 		w.requiredInPlaceValueBound = o.RequiredInPlaceValueBound
 		w.valueBlockWriter = newValueBlockWriter(
-			w.blockSize, w.blockSizeThreshold, w.compression, w.checksumType, func(compressedSize int) {
+			w.blockSize, w.blockSizeThreshold, valueBlockCompressor, w.checksumType, w.blockCipher,
+			func(compressedSize int) {
 				w.coordination.sizeEstimate.dataBlockCompressed(compressedSize, 0)
 			})
 	}
 
-	w.dataBlockBuf = newDataBlockBuf(w.restartInterval, w.checksumType)
+	w.dataBlockBuf = newDataBlockBuf(w.restartInterval, w.checksumType, w.blockCipher)
 
 	w.blockBuf = blockBuf{
 		checksummer: checksummer{checksumType: o.Checksum},
+		cipher:      w.blockCipher,
 	}
 
 	w.coordination.init(o.Parallelism, w)
@@ -2154,6 +2397,14 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		w.err = errors.New("pebble: nil writable")
 		return w
 	}
+	if formatErr != nil {
+		w.err = formatErr
+		return w
+	}
+	if encryptionErr != nil {
+		w.err = encryptionErr
+		return w
+	}
 
 	// Note that WriterOptions are applied in two places; the ones with a
 	// preApply() method are applied here. The rest are applied down below after
@@ -2169,7 +2420,11 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 	if o.FilterPolicy != nil {
 		switch o.FilterType {
 		case TableFilter:
-			w.filter = newTableFilterWriter(o.FilterPolicy)
+			if o.PartitionFilters {
+				w.filter = newPartitionedFilterWriter(o.FilterPolicy)
+			} else {
+				w.filter = newTableFilterWriter(o.FilterPolicy)
+			}
 			if w.split != nil {
 				w.props.PrefixExtractorName = o.Comparer.Name
 				w.props.PrefixFiltering = true
@@ -2179,6 +2434,9 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		default:
 			panic(fmt.Sprintf("unknown filter type: %v", o.FilterType))
 		}
+		if o.RangeFilterPrefixLen > 0 && o.Comparer.BytewisePrefixOrdering {
+			w.rangeFilter = newRangeFilterWriter(o.FilterPolicy, o.RangeFilterPrefixLen)
+		}
 	}
 
 	w.props.ColumnFamilyID = math.MaxInt32
@@ -2213,6 +2471,12 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 			w.blockPropCollectors = make([]BlockPropertyCollector, len(o.BlockPropertyCollectors))
 			for i := range o.BlockPropertyCollectors {
 				w.blockPropCollectors[i] = o.BlockPropertyCollectors[i]()
+				if c, ok := w.blockPropCollectors[i].(ValueBlockPropertyCollector); ok && c.RequiresValues() {
+					if w.blockPropCollectorValues == nil {
+						w.blockPropCollectorValues = make([]bool, len(o.BlockPropertyCollectors))
+					}
+					w.blockPropCollectorValues[i] = true
+				}
 				if i > 0 || len(o.TablePropertyCollectors) > 0 {
 					buf.WriteString(",")
 				}
@@ -18,6 +18,7 @@ import (
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/internal/invariants"
 	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/manifest"
@@ -42,6 +43,13 @@ var filteredAll = &filteredAllKeysIter{errorIter: errorIter{err: nil}}
 
 var _ filteredIter = filteredAll
 
+// rangeFilteredAll is a singleton internalIterator implementation used when an
+// sstable's range filter determines that the sstable contains no point keys
+// within the iterator's bounds. Unlike filteredAll, whether the keys are
+// filtered depends on the bounds, and so the level iterator discards it when
+// its bounds change.
+var rangeFilteredAll = &filteredAllKeysIter{errorIter: errorIter{err: nil}}
+
 type filteredAllKeysIter struct {
 	errorIter
 }
@@ -70,6 +78,11 @@ type tableCacheOpts struct {
 	objProvider     objstorage.Provider
 	opts            sstable.ReaderOptions
 	filterMetrics   *sstable.FilterMetricsTracker
+	// levelFilterMetrics track the filter metrics of iterators over each
+	// level's tables, in addition to filterMetrics.
+	levelFilterMetrics *[numLevels]sstable.FilterMetricsTracker
+	// pinL0L1IndexAndFilterBlocks is Options.PinL0L1IndexAndFilterBlocks.
+	pinL0L1IndexAndFilterBlocks bool
 }
 
 // tableCacheContainer contains the table cache and
@@ -106,6 +119,8 @@ func newTableCacheContainer(
 	t.dbOpts.objProvider = objProvider
 	t.dbOpts.opts = opts.MakeReaderOptions()
 	t.dbOpts.filterMetrics = &sstable.FilterMetricsTracker{}
+	t.dbOpts.levelFilterMetrics = &[numLevels]sstable.FilterMetricsTracker{}
+	t.dbOpts.pinL0L1IndexAndFilterBlocks = opts.PinL0L1IndexAndFilterBlocks
 	t.dbOpts.iterCount = new(atomic.Int32)
 	return t
 }
@@ -155,7 +170,7 @@ func (c *tableCacheContainer) evict(fileNum base.DiskFileNum) {
 	c.tableCache.getShard(fileNum).evict(fileNum, &c.dbOpts, false)
 }
 
-func (c *tableCacheContainer) metrics() (CacheMetrics, FilterMetrics) {
+func (c *tableCacheContainer) metrics() (CacheMetrics, FilterMetrics, [numLevels]FilterMetrics) {
 	var m CacheMetrics
 	for i := range c.tableCache.shards {
 		s := c.tableCache.shards[i]
@@ -167,7 +182,11 @@ func (c *tableCacheContainer) metrics() (CacheMetrics, FilterMetrics) {
 	}
 	m.Size = m.Count * int64(unsafe.Sizeof(sstable.Reader{}))
 	f := c.dbOpts.filterMetrics.Load()
-	return m, f
+	var levels [numLevels]FilterMetrics
+	for i := range levels {
+		levels[i] = c.dbOpts.levelFilterMetrics[i].Load()
+	}
+	return m, f, levels
 }
 
 func (c *tableCacheContainer) withReader(meta physicalMeta, fn func(*sstable.Reader) error) error {
@@ -180,6 +199,20 @@ func (c *tableCacheContainer) withReader(meta physicalMeta, fn func(*sstable.Rea
 	return fn(v.reader)
 }
 
+// withBackingReader fetches the Reader of the file backing the specified
+// table, which may be virtual.
+func (c *tableCacheContainer) withBackingReader(
+	meta *fileMetadata, fn func(*sstable.Reader) error,
+) error {
+	s := c.tableCache.getShard(meta.FileBacking.DiskFileNum)
+	v := s.findNode(meta, &c.dbOpts)
+	defer s.unrefValue(v)
+	if v.err != nil {
+		return v.err
+	}
+	return fn(v.reader)
+}
+
 // withVirtualReader fetches a VirtualReader associated with a virtual sstable.
 func (c *tableCacheContainer) withVirtualReader(
 	meta virtualMeta, fn func(sstable.VirtualReader) error,
@@ -390,13 +423,14 @@ func (c *tableCacheShard) newIters(
 	type iterCreator interface {
 		NewFixedSeqnumRangeDelIter(seqNum uint64) (keyspan.FragmentIterator, error)
 		NewRawRangeDelIter() (keyspan.FragmentIterator, error)
-		NewIterWithBlockPropertyFiltersAndContext(
+		NewIterWithOptions(
 			ctx context.Context,
 			lower, upper []byte,
 			filterer *sstable.BlockPropertiesFilterer,
 			useFilterBlock bool,
 			stats *base.InternalIteratorStats,
 			rp sstable.ReaderProvider,
+			opts sstable.IterOptions,
 		) (sstable.Iterator, error)
 		NewCompactionIter(
 			bytesIterated *uint64,
@@ -468,9 +502,49 @@ func (c *tableCacheShard) newIters(
 
 	var iter sstable.Iterator
 	useFilter := true
+	var iterOpts sstable.IterOptions
 	if opts != nil {
 		useFilter = manifest.LevelToInt(opts.level) != 6 || opts.UseL6Filters
 		ctx = objiotracing.WithLevel(ctx, manifest.LevelToInt(opts.level))
+		iterOpts.FilterMetrics = &dbOpts.levelFilterMetrics[manifest.LevelToInt(opts.level)]
+		if opts.DisableCacheFill {
+			ctx = sstable.WithDataBlockCachePriority(ctx, cache.NoFillPriority)
+		}
+		if dbOpts.pinL0L1IndexAndFilterBlocks && manifest.LevelToInt(opts.level) <= 1 &&
+			!v.reader.IndexAndFilterBlocksPinned() {
+			if err := v.reader.PinIndexAndFilterBlocks(); err != nil {
+				if rangeDelIter != nil {
+					_ = rangeDelIter.Close()
+				}
+				c.unrefValue(v)
+				return nil, nil, err
+			}
+		}
+	}
+	if opts != nil && internalOpts.bytesIterated == nil && v.reader.Properties.RangeFilterPrefixLen > 0 &&
+		(opts.LowerBound != nil || opts.UpperBound != nil) {
+		// The level iterator elides bounds that don't constrain iteration within
+		// the file, in which case the file's bounds constrain the keys instead.
+		lower, upper := opts.LowerBound, opts.UpperBound
+		if lower == nil {
+			lower = file.SmallestPointKey.UserKey
+		}
+		if upper == nil {
+			upper = file.LargestPointKey.UserKey
+		}
+		mayContain, err := v.reader.RangeMayContainPointKeys(ctx, lower, upper, iterOpts.FilterMetrics)
+		if err != nil || !mayContain {
+			c.unrefValue(v)
+			if err != nil {
+				if rangeDelIter != nil {
+					_ = rangeDelIter.Close()
+				}
+				return nil, nil, err
+			}
+			// As with filteredAll, the range deletions may still delete keys
+			// lower in the LSM.
+			return rangeFilteredAll, rangeDelIter, nil
+		}
 	}
 	tableFormat, err := v.reader.TableFormat()
 	if err != nil {
@@ -484,10 +558,10 @@ func (c *tableCacheShard) newIters(
 	if internalOpts.bytesIterated != nil {
 		iter, err = ic.NewCompactionIter(internalOpts.bytesIterated, rp)
 	} else {
-		iter, err = ic.NewIterWithBlockPropertyFiltersAndContext(
+		iter, err = ic.NewIterWithOptions(
 			ctx,
 			opts.GetLowerBound(), opts.GetUpperBound(),
-			filterer, useFilter, internalOpts.stats, rp,
+			filterer, useFilter, internalOpts.stats, rp, iterOpts,
 		)
 	}
 	if err != nil {
@@ -716,7 +716,9 @@ func (d *dbT) addProps(
 	if err != nil {
 		return err
 	}
-	r, err := sstable.NewReader(f, sstable.ReaderOptions{}, d.mergers, d.comparers)
+	r, err := sstable.NewReader(f, sstable.ReaderOptions{
+		EncryptionKeys: d.opts.TableEncryptionKeys,
+	}, d.mergers, d.comparers)
 	if err != nil {
 		_ = f.Close()
 		return err
@@ -0,0 +1,303 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/humanize"
+	"github.com/spf13/cobra"
+)
+
+// eventsT implements the events tool, which summarizes JSON event logs
+// written by pebble.MakeJSONEventListener.
+type eventsT struct {
+	Root *cobra.Command
+
+	opts   *pebble.Options
+	window time.Duration
+	top    int
+}
+
+func newEvents(opts *pebble.Options) *eventsT {
+	e := &eventsT{
+		opts: opts,
+	}
+	e.Root = &cobra.Command{
+		Use:   "events <event-log-files or dirs>",
+		Short: "summarize JSON event logs",
+		Long: `
+Summarize JSON event logs written by pebble.MakeJSONEventListener. A directory
+argument is expanded to the .jsonl files it contains. The summary includes the
+bytes flushed, ingested and compacted, and the resulting write amplification,
+in windows of time; the write stalls; and the largest flushes.
+`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  e.runEvents,
+	}
+	e.Root.Flags().DurationVar(
+		&e.window, "window", 10*time.Minute, "time window in which to aggregate flushes and compactions")
+	e.Root.Flags().IntVar(
+		&e.top, "top", 5, "number of largest flushes to show")
+	return e
+}
+
+func (e *eventsT) runEvents(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.OutOrStderr()
+
+	var records []pebble.EventRecord
+	for _, path := range e.expandPaths(stderr, args) {
+		// The records preceding an error, such as a line truncated by a
+		// crash, are still summarized.
+		recs, err := e.readEventLog(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+		}
+		records = append(records, recs...)
+	}
+	if len(records) == 0 {
+		fmt.Fprintf(stdout, "no events\n")
+		return
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+
+	fmt.Fprintf(stdout, "%d events from %s to %s\n", len(records),
+		formatEventTime(records[0].Time), formatEventTime(records[len(records)-1].Time))
+	e.printAmplification(stdout, records)
+	printStalls(stdout, records)
+	e.printLargestFlushes(stdout, records)
+}
+
+// expandPaths replaces the directories among paths with the .jsonl files they
+// contain.
+func (e *eventsT) expandPaths(stderr io.Writer, paths []string) []string {
+	fs := e.opts.FS
+	var expanded []string
+	for _, path := range paths {
+		info, err := fs.Stat(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			continue
+		}
+		if !info.IsDir() {
+			expanded = append(expanded, path)
+			continue
+		}
+		ls, err := fs.List(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			continue
+		}
+		sort.Strings(ls)
+		for _, name := range ls {
+			if strings.HasSuffix(name, ".jsonl") {
+				expanded = append(expanded, fs.PathJoin(path, name))
+			}
+		}
+	}
+	return expanded
+}
+
+func (e *eventsT) readEventLog(path string) ([]pebble.EventRecord, error) {
+	f, err := e.opts.FS.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []pebble.EventRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r pebble.EventRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return records, errors.Errorf("line %d: %s", line, err)
+		}
+		if r.Version > pebble.EventLogVersion {
+			return records, errors.Errorf("line %d: unsupported version %d", line, r.Version)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+func formatEventTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// ampWindow accumulates the bytes written to the LSM in a window of time.
+type ampWindow struct {
+	start       time.Time
+	flushed     uint64
+	ingested    uint64
+	compactedIn uint64
+	compacted   uint64
+	compactions int
+}
+
+// writeAmp returns the write amplification of the window: the bytes written
+// to sstables by flushes, ingestions and compactions, relative to those
+// written by flushes and ingestions.
+func (w *ampWindow) writeAmp() float64 {
+	in := w.flushed + w.ingested
+	if in == 0 {
+		return 0
+	}
+	return float64(in+w.compacted) / float64(in)
+}
+
+func (w *ampWindow) add(o *ampWindow) {
+	w.flushed += o.flushed
+	w.ingested += o.ingested
+	w.compactedIn += o.compactedIn
+	w.compacted += o.compacted
+	w.compactions += o.compactions
+}
+
+func (e *eventsT) printAmplification(stdout io.Writer, records []pebble.EventRecord) {
+	var windows []*ampWindow
+	for i := range records {
+		r := &records[i]
+		if r.Error != "" {
+			continue
+		}
+		start := r.Time.Truncate(e.window)
+		if len(windows) == 0 || !windows[len(windows)-1].start.Equal(start) {
+			windows = append(windows, &ampWindow{start: start})
+		}
+		w := windows[len(windows)-1]
+		switch r.Event {
+		case pebble.EventFlushEnd:
+			// Flushes of ingested tables are counted by their ingestion.
+			if !r.Ingest {
+				w.flushed += r.BytesOut()
+			}
+		case pebble.EventTableIngested:
+			w.ingested += r.BytesIn()
+		case pebble.EventCompactionEnd:
+			w.compactedIn += r.BytesIn()
+			w.compacted += r.BytesOut()
+			w.compactions++
+		}
+	}
+
+	fmt.Fprintf(stdout, "\nwrite amplification (window %s)\n", e.window)
+	fmt.Fprintf(stdout, "_______________from  flushed ingested compact-in compacted  count  w-amp\n")
+	var total ampWindow
+	for _, w := range windows {
+		printAmpWindow(stdout, formatEventTime(w.start), w)
+		total.add(w)
+	}
+	printAmpWindow(stdout, "total", &total)
+}
+
+func printAmpWindow(stdout io.Writer, label string, w *ampWindow) {
+	fmt.Fprintf(stdout, "%19s %8s %8s %10s %9s %6d %6.2f\n", label,
+		humanize.IEC.Uint64(w.flushed), humanize.IEC.Uint64(w.ingested),
+		humanize.IEC.Uint64(w.compactedIn), humanize.IEC.Uint64(w.compacted),
+		w.compactions, w.writeAmp())
+}
+
+// stallStats accumulates the durations of write stalls.
+type stallStats struct {
+	count int
+	total time.Duration
+	max   time.Duration
+}
+
+func (s *stallStats) add(d time.Duration) {
+	s.count++
+	s.total += d
+	if d > s.max {
+		s.max = d
+	}
+}
+
+func printStalls(stdout io.Writer, records []pebble.EventRecord) {
+	var total stallStats
+	byReason := make(map[string]*stallStats)
+	// begin is the beginning of the current stall, if any. A stall ends at
+	// the first end event after it begins.
+	var begin *pebble.EventRecord
+	for i := range records {
+		r := &records[i]
+		switch r.Event {
+		case pebble.EventWriteStallBegin:
+			if begin == nil {
+				begin = r
+			}
+		case pebble.EventWriteStallEnd:
+			if begin == nil {
+				continue
+			}
+			s := byReason[begin.Reason]
+			if s == nil {
+				s = &stallStats{}
+				byReason[begin.Reason] = s
+			}
+			d := r.Time.Sub(begin.Time)
+			s.add(d)
+			total.add(d)
+			begin = nil
+		}
+	}
+
+	fmt.Fprintf(stdout, "\nwrite stalls\n")
+	fmt.Fprintf(stdout, "reason                                    count      total        max\n")
+	reasons := make([]string, 0, len(byReason))
+	for reason := range byReason {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		s := byReason[reason]
+		fmt.Fprintf(stdout, "%-40s %6d %10s %10s\n", reason, s.count, s.total, s.max)
+	}
+	fmt.Fprintf(stdout, "%-40s %6d %10s %10s\n", "total", total.count, total.total, total.max)
+	if begin != nil {
+		fmt.Fprintf(stdout, "stall in progress since %s: %s\n", formatEventTime(begin.Time), begin.Reason)
+	}
+}
+
+func (e *eventsT) printLargestFlushes(stdout io.Writer, records []pebble.EventRecord) {
+	var flushes []*pebble.EventRecord
+	for i := range records {
+		r := &records[i]
+		if r.Event == pebble.EventFlushEnd && r.Error == "" && !r.Ingest {
+			flushes = append(flushes, r)
+		}
+	}
+	sort.SliceStable(flushes, func(i, j int) bool {
+		return flushes[i].BytesOut() > flushes[j].BytesOut()
+	})
+	if len(flushes) > e.top {
+		flushes = flushes[:e.top]
+	}
+
+	fmt.Fprintf(stdout, "\nlargest flushes\n")
+	fmt.Fprintf(stdout, "_______________time    job memtables    bytes   duration  tables\n")
+	for _, r := range flushes {
+		fileNums := make([]string, len(r.Output))
+		for i := range r.Output {
+			fileNums[i] = pebble.FileNum(r.Output[i].FileNum).String()
+		}
+		fmt.Fprintf(stdout, "%19s %6d %9d %8s %10s  %s\n", formatEventTime(r.Time), r.JobID,
+			r.InputMemtables, humanize.IEC.Uint64(r.BytesOut()),
+			time.Duration(r.DurationNanos), strings.Join(fileNums, ","))
+	}
+}
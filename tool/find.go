@@ -329,6 +329,7 @@ func (f *findT) searchLogs(stdout io.Writer, searchKey []byte, refs []findRef) [
 			var b pebble.Batch
 			var buf bytes.Buffer
 			rr := record.NewReader(lf, fileNum)
+			rr.SetTransform(f.opts.WALTransform)
 			for {
 				r, err := rr.Next()
 				if err == nil {
@@ -418,9 +419,10 @@ func (f *findT) searchTables(stdout io.Writer, searchKey []byte, refs []findRef)
 			}()
 
 			opts := sstable.ReaderOptions{
-				Cache:    cache,
-				Comparer: f.opts.Comparer,
-				Filters:  f.opts.Filters,
+				Cache:          cache,
+				Comparer:       f.opts.Comparer,
+				Filters:        f.opts.Filters,
+				EncryptionKeys: f.opts.TableEncryptionKeys,
 			}
 			readable, err := sstable.NewSimpleReadable(tf)
 			if err != nil {
@@ -0,0 +1,74 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build make_test_encrypted_db
+// +build make_test_encrypted_db
+
+// Run using: go run -tags make_test_encrypted_db make_test_encrypted_db.go
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/pebble/vfs/encryptedfs"
+)
+
+const (
+	dir      = "testdata/encrypted-db"
+	keysFile = "testdata/encryption-keys"
+)
+
+func main() {
+	if err := os.RemoveAll(dir); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := os.Open(keysFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keys, err := encryptedfs.ParseKeys(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f.Close()
+
+	// Write a table with the first key, then rotate to the second, so that
+	// the store has files encrypted with both.
+	set := func(activeKeyID string, kvs ...string) {
+		fs, err := encryptedfs.New(vfs.Default, encryptedfs.Options{
+			Keys:         keys,
+			ActiveKeyID:  activeKeyID,
+			RegistryPath: dir + "/KEY-REGISTRY",
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		d, err := pebble.Open(dir, &pebble.Options{FS: fs})
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, kv := range kvs {
+			k, v, _ := strings.Cut(kv, "=")
+			if err := d.Set([]byte(k), []byte(v), nil); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := d.Flush(); err != nil {
+			log.Fatal(err)
+		}
+		if err := d.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	set("old", "a=1", "b=2")
+	set("new", "c=3")
+}
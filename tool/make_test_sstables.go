@@ -10,11 +10,13 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/cockroachdb/pebble/internal/private"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/pebble/vfs/encryptedfs"
 )
 
 func makeOutOfOrder() {
@@ -41,6 +43,47 @@ func makeOutOfOrder() {
 	}
 }
 
+// makeEncrypted writes a table encrypted with the key "new" of
+// testdata/encryption-keys.
+func makeEncrypted() {
+	kf, err := os.Open("testdata/encryption-keys")
+	if err != nil {
+		log.Fatal(err)
+	}
+	keys, err := encryptedfs.ParseKeys(kf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	kf.Close()
+	var key *sstable.EncryptionKey
+	for _, k := range keys {
+		if k.ID == "new" {
+			key = &sstable.EncryptionKey{ID: k.ID, Secret: k.Secret}
+		}
+	}
+
+	f, err := vfs.Default.Create("testdata/encrypted.sst")
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{
+		TableFormat: sstable.TableFormatPebblev3,
+		Encryption:  key,
+	})
+	for _, k := range []string{"a", "b", "c"} {
+		if err := w.Set([]byte(k), []byte("secret-"+k)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := w.DeleteRange([]byte("d"), []byte("e")); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
 func main() {
 	makeOutOfOrder()
+	makeEncrypted()
 }
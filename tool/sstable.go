@@ -146,9 +146,10 @@ func (s *sstableT) newReader(f vfs.File) (*sstable.Reader, error) {
 		return nil, err
 	}
 	o := sstable.ReaderOptions{
-		Cache:    pebble.NewCache(128 << 20 /* 128 MB */),
-		Comparer: s.opts.Comparer,
-		Filters:  s.opts.Filters,
+		Cache:          pebble.NewCache(128 << 20 /* 128 MB */),
+		Comparer:       s.opts.Comparer,
+		Filters:        s.opts.Filters,
+		EncryptionKeys: s.opts.TableEncryptionKeys,
 	}
 	defer o.Cache.Unref()
 	return sstable.NewReader(readable, o, s.comparers, s.mergers,
@@ -316,6 +317,9 @@ func (s *sstableT) runProperties(cmd *cobra.Command, args []string) {
 		fmt.Fprintf(tw, "    blocks\t%d\n", 1+r.Properties.IndexPartitions)
 		fmt.Fprintf(tw, "    top-level\t%s\n", humanize.Uint64(r.Properties.TopLevelIndexSize))
 		fmt.Fprintf(tw, "  filter\t%s\n", humanize.Uint64(r.Properties.FilterSize))
+		if r.Properties.FilterPartitions > 0 {
+			fmt.Fprintf(tw, "    partitions\t%d\n", r.Properties.FilterPartitions)
+		}
 		fmt.Fprintf(tw, "  raw-key\t%s\n", humanize.Uint64(r.Properties.RawKeySize))
 		fmt.Fprintf(tw, "  raw-value\t%s\n", humanize.Uint64(r.Properties.RawValueSize))
 		fmt.Fprintf(tw, "  pinned-key\t%d\n", r.Properties.SnapshotPinnedKeySize)
@@ -352,8 +356,14 @@ func (s *sstableT) runProperties(cmd *cobra.Command, args []string) {
 		fmt.Fprintf(tw, "filter\t%s\n", formatNull(r.Properties.FilterPolicyName))
 		fmt.Fprintf(tw, "  prefix\t%t\n", r.Properties.PrefixFiltering)
 		fmt.Fprintf(tw, "  whole-key\t%t\n", r.Properties.WholeKeyFiltering)
+		if r.Properties.RangeFilterPrefixLen > 0 {
+			fmt.Fprintf(tw, "  range-prefix-len\t%d\n", r.Properties.RangeFilterPrefixLen)
+		}
 		fmt.Fprintf(tw, "compression\t%s\n", r.Properties.CompressionName)
 		fmt.Fprintf(tw, "  options\t%s\n", r.Properties.CompressionOptions)
+		if r.Properties.EncryptionKeyID != "" {
+			fmt.Fprintf(tw, "encryption-key\t%s\n", r.Properties.EncryptionKeyID)
+		}
 		fmt.Fprintf(tw, "user properties\t\n")
 		fmt.Fprintf(tw, "  collectors\t%s\n", r.Properties.PropertyCollectorNames)
 		keys := make([]string, 0, len(r.Properties.UserProperties))
@@ -5,18 +5,21 @@
 package tool
 
 import (
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble"
 	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/objstorage/shared"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/pebble/vfs/encryptedfs"
 	"github.com/spf13/cobra"
 )
 
 //go:generate go run -tags make_incorrect_manifests make_incorrect_manifests.go
 //go:generate go run -tags make_test_find_db make_test_find_db.go
 //go:generate go run -tags make_test_sstables make_test_sstables.go
+//go:generate go run -tags make_test_encrypted_db make_test_encrypted_db.go
 
 // Comparer exports the base.Comparer type.
 type Comparer = base.Comparer
@@ -31,6 +34,7 @@ type Merger = base.Merger
 type T struct {
 	Commands        []*cobra.Command
 	db              *dbT
+	events          *eventsT
 	find            *findT
 	lsm             *lsmT
 	manifest        *manifestT
@@ -40,6 +44,8 @@ type T struct {
 	comparers       sstable.Comparers
 	mergers         sstable.Mergers
 	defaultComparer string
+	encryptionKeys  string
+	tableKeys       string
 }
 
 // A Option configures the Pebble introspection tool.
@@ -91,6 +97,14 @@ func FS(fs vfs.FS) Option {
 	}
 }
 
+// WALTransform sets the transform with which the introspection tools decode
+// WAL records, for WALs written with pebble.Options.WALTransform.
+func WALTransform(transform pebble.WALTransform) Option {
+	return func(t *T) {
+		t.opts.WALTransform = transform
+	}
+}
+
 // New creates a new introspection tool.
 func New(opts ...Option) *T {
 	t := &T{
@@ -114,6 +128,7 @@ func New(opts ...Option) *T {
 	}
 
 	t.db = newDB(&t.opts, t.comparers, t.mergers)
+	t.events = newEvents(&t.opts)
 	t.find = newFind(&t.opts, t.comparers, t.defaultComparer, t.mergers)
 	t.lsm = newLSM(&t.opts, t.comparers)
 	t.manifest = newManifest(&t.opts, t.comparers)
@@ -121,15 +136,81 @@ func New(opts ...Option) *T {
 	t.wal = newWAL(&t.opts, t.comparers, t.defaultComparer)
 	t.Commands = []*cobra.Command{
 		t.db.Root,
+		t.events.Root,
 		t.find.Root,
 		t.lsm.Root,
 		t.manifest.Root,
 		t.sstable.Root,
 		t.wal.Root,
 	}
+	for _, cmd := range t.Commands {
+		cmd.PersistentFlags().StringVar(
+			&t.encryptionKeys, "encryption-keys", "",
+			"file of the keys with which to decrypt a store encrypted by encryptedfs, one per line\n"+
+				"as an ID and hex encoded secret")
+		cmd.PersistentFlags().StringVar(
+			&t.tableKeys, "table-encryption-keys", "",
+			"file of the keys with which to decrypt encrypted sstables, in the format of\n"+
+				"--encryption-keys")
+		cmd.PersistentPreRunE = t.setupEncryption
+	}
 	return t
 }
 
+// setupEncryption configures the keys of encrypted sstables if the
+// --table-encryption-keys flag was provided, and wraps the filesystem in an
+// encryptedfs.FS if the --encryption-keys flag was provided. The keys are read
+// from the unwrapped filesystem.
+func (t *T) setupEncryption(cmd *cobra.Command, args []string) error {
+	if t.tableKeys != "" && t.opts.TableEncryptionKeys == nil {
+		keys, err := t.readKeys(t.tableKeys)
+		if err != nil {
+			return err
+		}
+		t.opts.TableEncryptionKeys = func(keyID string) ([]byte, error) {
+			for _, k := range keys {
+				if k.ID == keyID {
+					return k.Secret, nil
+				}
+			}
+			return nil, errors.Errorf("key %q isn't in %s", keyID, t.tableKeys)
+		}
+	}
+	if t.encryptionKeys == "" {
+		return nil
+	}
+	if _, ok := t.opts.FS.(*encryptedfs.FS); ok {
+		return nil
+	}
+	keys, err := t.readKeys(t.encryptionKeys)
+	if err != nil {
+		return err
+	}
+	fs, err := encryptedfs.New(t.opts.FS, encryptedfs.Options{Keys: keys})
+	if err != nil {
+		return err
+	}
+	t.opts.FS = fs
+	return nil
+}
+
+// readKeys reads the file of keys at path.
+func (t *T) readKeys(path string) ([]encryptedfs.Key, error) {
+	f, err := t.opts.FS.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	keys, err := encryptedfs.ParseKeys(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.Errorf("no keys in %s", path)
+	}
+	return keys, nil
+}
+
 // EnableSharedStorage updates the options with the shared storage
 // instance.
 func (t *T) EnableSharedStorage(s shared.Storage) {
@@ -94,6 +94,7 @@ func (w *walT) runDump(cmd *cobra.Command, args []string) {
 			var b pebble.Batch
 			var buf bytes.Buffer
 			rr := record.NewReader(f, fileNum.FileNum())
+			rr.SetTransform(w.opts.WALTransform)
 			for {
 				offset := rr.Offset()
 				r, err := rr.Next()
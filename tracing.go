@@ -0,0 +1,159 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// Tracer creates spans recording the duration and attributes of operations.
+// See Options.Tracer.
+type Tracer = base.Tracer
+
+// Span is an operation traced by a Tracer.
+type Span = base.Span
+
+// Attribute is a key-value pair describing a span.
+type Attribute = base.Attribute
+
+// AttributeType is the type of the value of an Attribute.
+type AttributeType = base.AttributeType
+
+// The types of the values of attributes.
+const (
+	AttributeInt64  = base.AttributeInt64
+	AttributeString = base.AttributeString
+	AttributeBool   = base.AttributeBool
+)
+
+// The names of the spans emitted by the DB.
+const (
+	// SpanIterator spans the lifetime of an iterator, from its creation to
+	// Iterator.Close.
+	SpanIterator = "pebble.iterator"
+	// SpanIteratorSeek spans a seek of an iterator which read at least one
+	// block that wasn't in the block cache.
+	SpanIteratorSeek = "pebble.iterator.seek"
+	// SpanReadBlock spans the read of an sstable block from storage by an
+	// iterator, because it wasn't in the block cache.
+	SpanReadBlock = "pebble.sstable.read_block"
+	// SpanFlush spans a flush, from its start to its installation.
+	SpanFlush = "pebble.flush"
+	// SpanCompaction spans a compaction, from its start to its installation.
+	SpanCompaction = "pebble.compaction"
+)
+
+// startIteratorSpan starts the span of an iterator created by
+// DB.NewIterWithContext. The iterator's context holds the span, so that the
+// spans of the blocks it reads are its children.
+func (i *Iterator) startIteratorSpan(tracer Tracer) {
+	i.ctx, i.span = tracer.Start(i.ctx, SpanIterator, time.Now())
+	i.ctx = base.ContextWithTracedSpan(i.ctx)
+}
+
+// endIteratorSpan ends the iterator's span, recording the iterator's stats.
+func (i *Iterator) endIteratorSpan() {
+	s := &i.stats
+	i.span.SetAttributes(
+		base.Int64Attribute("pebble.iterator.forward_seeks", int64(s.ForwardSeekCount[InterfaceCall])),
+		base.Int64Attribute("pebble.iterator.reverse_seeks", int64(s.ReverseSeekCount[InterfaceCall])),
+		base.Int64Attribute("pebble.iterator.forward_steps", int64(s.ForwardStepCount[InterfaceCall])),
+		base.Int64Attribute("pebble.iterator.reverse_steps", int64(s.ReverseStepCount[InterfaceCall])),
+		base.Int64Attribute("pebble.block.bytes", int64(s.InternalStats.BlockBytes)),
+		base.Int64Attribute("pebble.block.bytes_in_cache", int64(s.InternalStats.BlockBytesInCache)),
+		base.Int64Attribute("pebble.block.count", int64(s.InternalStats.BlockCount)),
+		base.Int64Attribute("pebble.block.cache_misses", int64(s.InternalStats.BlockCacheMisses)),
+	)
+	if i.err != nil {
+		i.span.RecordError(i.err)
+	}
+	i.span.End(time.Now())
+	i.span = nil
+}
+
+// maybeTraceSeek emits a span for a seek of the iterator which began at
+// startTime, if the seek read blocks that weren't in the block cache.
+func (i *Iterator) maybeTraceSeek(op string, startTime time.Time, statsBefore *InternalIteratorStats) {
+	if i.stats.InternalStats.BlockCacheMisses == statsBefore.BlockCacheMisses {
+		return
+	}
+	stats := subInternalIteratorStats(&i.stats.InternalStats, statsBefore)
+	_, span := i.readState.db.opts.Tracer.Start(i.ctx, SpanIteratorSeek, startTime)
+	attrs := []Attribute{
+		base.StringAttribute("pebble.iterator.op", op),
+		base.Int64Attribute("pebble.block.bytes", int64(stats.BlockBytes)),
+		base.Int64Attribute("pebble.block.bytes_in_cache", int64(stats.BlockBytesInCache)),
+		base.Int64Attribute("pebble.block.count", int64(stats.BlockCount)),
+		base.Int64Attribute("pebble.block.cache_misses", int64(stats.BlockCacheMisses)),
+	}
+	if i.merging != nil {
+		attrs = append(attrs, base.Int64Attribute("pebble.levels", int64(len(i.merging.levels))))
+	}
+	span.SetAttributes(attrs...)
+	span.End(time.Now())
+}
+
+// traceFlush emits the span of a flush which started at startTime.
+func (d *DB) traceFlush(startTime time.Time, info *FlushInfo, bytesFlushed uint64) {
+	_, span := d.opts.Tracer.Start(context.Background(), SpanFlush, startTime)
+	attrs := []Attribute{
+		base.Int64Attribute("pebble.job_id", int64(info.JobID)),
+		base.Int64Attribute("pebble.flush.input_memtables", int64(info.Input)),
+		base.Int64Attribute("pebble.bytes_in", int64(bytesFlushed)),
+		base.Int64Attribute("pebble.bytes_out", int64(tablesTotalSize(info.Output))),
+		base.StringAttribute("pebble.output.file_nums", tableFileNums(info.Output)),
+		base.BoolAttribute("pebble.flush.ingest", info.Ingest),
+	}
+	if !info.Ingest {
+		attrs = append(attrs, base.Int64Attribute("pebble.output.level", 0))
+	}
+	span.SetAttributes(attrs...)
+	if info.Err != nil {
+		span.RecordError(info.Err)
+	}
+	span.End(startTime.Add(info.TotalDuration))
+}
+
+// traceCompaction emits the span of a compaction which started at startTime.
+func (d *DB) traceCompaction(startTime time.Time, info *CompactionInfo) {
+	_, span := d.opts.Tracer.Start(context.Background(), SpanCompaction, startTime)
+	var inputLevels, inputFiles []string
+	var bytesIn uint64
+	for _, l := range info.Input {
+		inputLevels = append(inputLevels, fmt.Sprintf("L%d", l.Level))
+		inputFiles = append(inputFiles, tableFileNums(l.Tables))
+		bytesIn += tablesTotalSize(l.Tables)
+	}
+	span.SetAttributes(
+		base.Int64Attribute("pebble.job_id", int64(info.JobID)),
+		base.StringAttribute("pebble.compaction.reason", info.Reason),
+		base.StringAttribute("pebble.input.levels", strings.Join(inputLevels, " ")),
+		base.StringAttribute("pebble.input.file_nums", strings.Join(inputFiles, ",")),
+		base.Int64Attribute("pebble.output.level", int64(info.Output.Level)),
+		base.StringAttribute("pebble.output.file_nums", tableFileNums(info.Output.Tables)),
+		base.Int64Attribute("pebble.bytes_in", int64(bytesIn)),
+		base.Int64Attribute("pebble.bytes_out", int64(tablesTotalSize(info.Output.Tables))),
+	)
+	if info.Err != nil {
+		span.RecordError(info.Err)
+	}
+	span.End(startTime.Add(info.TotalDuration))
+}
+
+func tableFileNums(tables []TableInfo) string {
+	var buf strings.Builder
+	for i := range tables {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(tables[i].FileNum.String())
+	}
+	return buf.String()
+}
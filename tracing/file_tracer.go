@@ -0,0 +1,297 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package tracing provides a pebble.Tracer which writes spans to a file in
+// the JSON encoding of the OpenTelemetry protocol (OTLP), so that the spans of
+// a DB can be inspected, or loaded into a tracing backend, without running a
+// collector.
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// The OTLP JSON types below mirror the messages of the OTLP trace protocol
+// (opentelemetry/proto/trace/v1/trace.proto), restricted to the fields
+// produced by a FileTracer. Each line written by a FileTracer is a
+// TracesData message holding a single span.
+
+// TracesData is the OTLP TracesData message.
+type TracesData struct {
+	ResourceSpans []ResourceSpans `json:"resourceSpans"`
+}
+
+// ResourceSpans is the OTLP ResourceSpans message.
+type ResourceSpans struct {
+	Resource   Resource     `json:"resource"`
+	ScopeSpans []ScopeSpans `json:"scopeSpans"`
+}
+
+// Resource is the OTLP Resource message.
+type Resource struct {
+	Attributes []KeyValue `json:"attributes,omitempty"`
+}
+
+// ScopeSpans is the OTLP ScopeSpans message.
+type ScopeSpans struct {
+	Scope Scope      `json:"scope"`
+	Spans []SpanData `json:"spans"`
+}
+
+// Scope is the OTLP InstrumentationScope message.
+type Scope struct {
+	Name string `json:"name"`
+}
+
+// SpanKindInternal is the OTLP SPAN_KIND_INTERNAL span kind.
+const SpanKindInternal = 1
+
+// StatusCodeError is the OTLP STATUS_CODE_ERROR status code.
+const StatusCodeError = 2
+
+// SpanData is the OTLP Span message.
+type SpanData struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	Events            []Event    `json:"events,omitempty"`
+	Status            Status     `json:"status"`
+}
+
+// Attribute returns the value of the span's attribute with the given key, or
+// nil if the span has no such attribute.
+func (s *SpanData) Attribute(key string) *AnyValue {
+	for i := range s.Attributes {
+		if s.Attributes[i].Key == key {
+			return &s.Attributes[i].Value
+		}
+	}
+	return nil
+}
+
+// Event is the OTLP Span.Event message.
+type Event struct {
+	TimeUnixNano string     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []KeyValue `json:"attributes,omitempty"`
+}
+
+// Status is the OTLP Status message.
+type Status struct {
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code,omitempty"`
+}
+
+// KeyValue is the OTLP KeyValue message.
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue is the OTLP AnyValue message. Exactly one of its fields is set.
+// As in the JSON encoding of protobuf messages, the 64-bit IntValue is
+// encoded as a decimal string.
+type AnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+func makeKeyValue(a pebble.Attribute) KeyValue {
+	kv := KeyValue{Key: a.Key}
+	switch a.Type {
+	case pebble.AttributeInt64:
+		v := strconv.FormatInt(a.Int, 10)
+		kv.Value.IntValue = &v
+	case pebble.AttributeString:
+		v := a.String
+		kv.Value.StringValue = &v
+	case pebble.AttributeBool:
+		v := a.Int != 0
+		kv.Value.BoolValue = &v
+	}
+	return kv
+}
+
+func stringKeyValue(key, value string) KeyValue {
+	return KeyValue{Key: key, Value: AnyValue{StringValue: &value}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// FileTracerOptions holds the optional parameters of a FileTracer.
+type FileTracerOptions struct {
+	// ServiceName is the service.name attribute of the resource of the spans.
+	// The default is "pebble".
+	ServiceName string
+	// ResourceAttributes are additional attributes of the resource of the
+	// spans, such as the identity of the store.
+	ResourceAttributes []pebble.Attribute
+}
+
+// FileTracer is a pebble.Tracer which writes every span, when it ends, as a
+// line of OTLP JSON.
+type FileTracer struct {
+	resource Resource
+
+	mu struct {
+		sync.Mutex
+		w   io.Writer
+		rng *rand.Rand
+		err error
+	}
+}
+
+// FileTracer implements the pebble.Tracer interface.
+var _ pebble.Tracer = (*FileTracer)(nil)
+
+// NewFileTracer returns a FileTracer writing to w. Writes to w are
+// serialized.
+func NewFileTracer(w io.Writer, opts FileTracerOptions) *FileTracer {
+	if opts.ServiceName == "" {
+		opts.ServiceName = "pebble"
+	}
+	t := &FileTracer{}
+	t.resource.Attributes = append(t.resource.Attributes, stringKeyValue("service.name", opts.ServiceName))
+	for _, a := range opts.ResourceAttributes {
+		t.resource.Attributes = append(t.resource.Attributes, makeKeyValue(a))
+	}
+	t.mu.w = w
+	t.mu.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	return t
+}
+
+// Err returns the first error encountered writing a span, after which no
+// further spans are written.
+func (t *FileTracer) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.mu.err
+}
+
+type spanContextKey struct{}
+
+// Start implements pebble.Tracer.
+func (t *FileTracer) Start(
+	ctx context.Context, name string, start time.Time,
+) (context.Context, pebble.Span) {
+	s := &fileSpan{
+		tracer: t,
+		data: SpanData{
+			Name:              name,
+			Kind:              SpanKindInternal,
+			StartTimeUnixNano: unixNano(start),
+		},
+	}
+	t.mu.Lock()
+	var id [16]byte
+	binary.LittleEndian.PutUint64(id[:8], t.mu.rng.Uint64())
+	if parent, ok := ctx.Value(spanContextKey{}).(*fileSpan); ok && parent.tracer == t {
+		s.data.TraceID = parent.data.TraceID
+		s.data.ParentSpanID = parent.data.SpanID
+	} else {
+		binary.LittleEndian.PutUint64(id[8:], t.mu.rng.Uint64())
+		s.data.TraceID = hex.EncodeToString(id[:])
+	}
+	t.mu.Unlock()
+	s.data.SpanID = hex.EncodeToString(id[:8])
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+func (t *FileTracer) write(s *SpanData) {
+	b, err := json.Marshal(TracesData{
+		ResourceSpans: []ResourceSpans{{
+			Resource: t.resource,
+			ScopeSpans: []ScopeSpans{{
+				Scope: Scope{Name: "github.com/cockroachdb/pebble"},
+				Spans: []SpanData{*s},
+			}},
+		}},
+	})
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.mu.err != nil {
+		return
+	}
+	if err == nil {
+		_, err = t.mu.w.Write(append(b, '\n'))
+	}
+	t.mu.err = err
+}
+
+// fileSpan is a span of a FileTracer. A span is only used by the goroutine
+// performing the operation, so it isn't synchronized.
+type fileSpan struct {
+	tracer *FileTracer
+	data   SpanData
+}
+
+// SetAttributes implements pebble.Span.
+func (s *fileSpan) SetAttributes(attrs ...pebble.Attribute) {
+outer:
+	for _, a := range attrs {
+		kv := makeKeyValue(a)
+		for i := range s.data.Attributes {
+			if s.data.Attributes[i].Key == a.Key {
+				s.data.Attributes[i] = kv
+				continue outer
+			}
+		}
+		s.data.Attributes = append(s.data.Attributes, kv)
+	}
+}
+
+// RecordError implements pebble.Span. As with OpenTelemetry tracers, the
+// error is recorded as an "exception" event, and sets the span's status.
+func (s *fileSpan) RecordError(err error) {
+	s.data.Events = append(s.data.Events, Event{
+		TimeUnixNano: unixNano(time.Now()),
+		Name:         "exception",
+		Attributes:   []KeyValue{stringKeyValue("exception.message", err.Error())},
+	})
+	s.data.Status = Status{Code: StatusCodeError, Message: err.Error()}
+}
+
+// End implements pebble.Span.
+func (s *fileSpan) End(end time.Time) {
+	s.data.EndTimeUnixNano = unixNano(end)
+	s.tracer.write(&s.data)
+}
+
+// ReadSpans reads the spans written by a FileTracer.
+func ReadSpans(r io.Reader) ([]SpanData, error) {
+	var spans []SpanData
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var data TracesData
+		if err := json.Unmarshal(scanner.Bytes(), &data); err != nil {
+			return nil, err
+		}
+		for _, rs := range data.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	return spans, scanner.Err()
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTracer(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewFileTracer(&buf, FileTracerOptions{
+		ResourceAttributes: []pebble.Attribute{base.StringAttribute("store", "s1")},
+	})
+
+	mem := vfs.NewMem()
+	opts := &pebble.Options{FS: mem, Tracer: tracer}
+	d, err := pebble.Open("", opts)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 100; j++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("key%03d", j)), []byte("value"), nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, d.Compact([]byte("key000"), []byte("key100"), false /* parallelize */))
+	require.NoError(t, d.Close())
+
+	// Reopen the DB with a new block cache, so that the iterator's seek reads
+	// blocks from storage.
+	opts.Cache = pebble.NewCache(1 << 20)
+	defer opts.Cache.Unref()
+	d, err = pebble.Open("", opts)
+	require.NoError(t, err)
+	ctx, parent := tracer.Start(context.Background(), "request", time.Now())
+	iter := d.NewIterWithContext(ctx, nil)
+	require.True(t, iter.SeekGE([]byte("key050")))
+	require.True(t, iter.SeekGE([]byte("key060")))
+	require.NoError(t, iter.Close())
+	parent.RecordError(errors.New("boom"))
+	parent.End(time.Now())
+	require.NoError(t, d.Close())
+	require.NoError(t, tracer.Err())
+
+	// Every line is a single span with the tracer's resource.
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		spans, err := ReadSpans(bytes.NewReader(line))
+		require.NoError(t, err)
+		require.Len(t, spans, 1)
+	}
+	require.Contains(t, buf.String(),
+		`"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"pebble"}},{"key":"store","value":{"stringValue":"s1"}}]}`)
+
+	spans, err := ReadSpans(&buf)
+	require.NoError(t, err)
+	byName := make(map[string][]SpanData)
+	for _, s := range spans {
+		require.Len(t, s.TraceID, 32)
+		require.Len(t, s.SpanID, 16)
+		require.Equal(t, SpanKindInternal, s.Kind)
+		require.LessOrEqual(t, len(s.StartTimeUnixNano), len(s.EndTimeUnixNano))
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+
+	str := func(s *SpanData, key string) string {
+		v := s.Attribute(key)
+		require.NotNil(t, v, "%s: missing %s", s.Name, key)
+		require.NotNil(t, v.StringValue, "%s: %s", s.Name, key)
+		return *v.StringValue
+	}
+	intValue := func(s *SpanData, key string) string {
+		v := s.Attribute(key)
+		require.NotNil(t, v, "%s: missing %s", s.Name, key)
+		require.NotNil(t, v.IntValue, "%s: %s", s.Name, key)
+		return *v.IntValue
+	}
+
+	flushes := byName[pebble.SpanFlush]
+	require.Len(t, flushes, 2)
+	for i := range flushes {
+		s := &flushes[i]
+		require.Empty(t, s.ParentSpanID)
+		require.Equal(t, "0", intValue(s, "pebble.output.level"))
+		require.NotEmpty(t, str(s, "pebble.output.file_nums"))
+		require.NotEqual(t, "0", intValue(s, "pebble.bytes_out"))
+	}
+
+	compactions := byName[pebble.SpanCompaction]
+	require.Len(t, compactions, 1)
+	c := &compactions[0]
+	require.Equal(t, "L0 L6", str(c, "pebble.input.levels"))
+	require.Equal(t, "6", intValue(c, "pebble.output.level"))
+	require.NotEqual(t, "0", intValue(c, "pebble.bytes_in"))
+	require.NotEqual(t, "0", intValue(c, "pebble.bytes_out"))
+
+	requests := byName["request"]
+	require.Len(t, requests, 1)
+	req := &requests[0]
+	require.Equal(t, StatusCodeError, req.Status.Code)
+	require.Equal(t, "boom", req.Status.Message)
+	require.Len(t, req.Events, 1)
+	require.Equal(t, "exception", req.Events[0].Name)
+
+	iters := byName[pebble.SpanIterator]
+	require.Len(t, iters, 1)
+	it := &iters[0]
+	require.Equal(t, req.TraceID, it.TraceID)
+	require.Equal(t, req.SpanID, it.ParentSpanID)
+	require.Equal(t, "2", intValue(it, "pebble.iterator.forward_seeks"))
+
+	// Only the first seek misses the block cache.
+	seeks := byName[pebble.SpanIteratorSeek]
+	require.Len(t, seeks, 1)
+	seek := &seeks[0]
+	require.Equal(t, it.SpanID, seek.ParentSpanID)
+	require.Equal(t, "seek-ge", str(seek, "pebble.iterator.op"))
+	require.NotEqual(t, "0", intValue(seek, "pebble.block.cache_misses"))
+
+	// Block reads by the iterator are children of its span, and read the
+	// compaction's output. Others, such as those of the compaction, aren't
+	// traced.
+	outputFileNum, err := strconv.Atoi(str(c, "pebble.output.file_nums"))
+	require.NoError(t, err)
+	var iterReads int
+	for _, s := range byName[pebble.SpanReadBlock] {
+		require.NotEqual(t, "0", intValue(&s, "pebble.block.length"))
+		require.Equal(t, strconv.Itoa(outputFileNum), intValue(&s, "pebble.file_num"))
+		require.Equal(t, it.TraceID, s.TraceID)
+		require.Equal(t, it.SpanID, s.ParentSpanID)
+		iterReads++
+	}
+	require.NotZero(t, iterReads)
+}
@@ -0,0 +1,241 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package encryptedfs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// The contents of a chunked file are divided into chunks of chunkSize bytes,
+// the last of which may be shorter. Each is stored as the IV with which it's
+// encrypted, followed by its ciphertext.
+const (
+	chunkSize       = 4096
+	chunkIVSize     = aes.BlockSize
+	storedChunkSize = chunkIVSize + chunkSize
+)
+
+// chunkedFile wraps a file of the underlying FS opened with OpenReadWrite,
+// whose contents may be overwritten by WriteAt. Every chunk it writes is
+// encrypted with AES-CTR with a counter starting at a new random IV, which is
+// stored with the chunk, so that overwriting data never reuses a key stream.
+// A write that covers part of a chunk rewrites the entire chunk, so a crash
+// during a write may lose the data of the chunks it covers; chunked files suit
+// caches rather than logs.
+//
+// A chunk whose IV is all zeros was never written, such as within a
+// preallocated range or a hole left by a write beyond the end of the file, and
+// is read as zeros. The offsets of the file's methods are relative to the end
+// of the header.
+type chunkedFile struct {
+	vfs.File
+	block cipher.Block
+	// mu serializes writes, which read and rewrite entire chunks, with each
+	// other and with reads, which could otherwise read a chunk's IV and
+	// ciphertext from different writes.
+	mu sync.RWMutex
+	// pos is the offset of the next Read or Write.
+	pos int64
+	// plain and stored hold the plaintext and stored chunks of writes. They're
+	// reused between writes, which hold mu.
+	plain, stored []byte
+}
+
+var _ vfs.File = (*chunkedFile)(nil)
+
+// storedOffset returns the offset, relative to the end of the header, at which
+// the chunk containing the content offset off is stored.
+func storedOffset(off int64) int64 {
+	return off / chunkSize * storedChunkSize
+}
+
+// storedSize returns the size of the stored chunks of size bytes of content.
+func storedSize(size int64) int64 {
+	n := storedOffset(size)
+	if rem := size % chunkSize; rem > 0 {
+		n += chunkIVSize + rem
+	}
+	return n
+}
+
+// chunkedSize returns the size of the content of a chunked file whose stored
+// chunks are size bytes, the inverse of storedSize.
+func chunkedSize(size int64) int64 {
+	n := size / storedChunkSize * chunkSize
+	if rem := size%storedChunkSize - chunkIVSize; rem > 0 {
+		n += rem
+	}
+	return n
+}
+
+// Read implements io.Reader.
+func (f *chunkedFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *chunkedFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.readAtLocked(p, off)
+}
+
+func (f *chunkedFile) readAtLocked(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	start := storedOffset(off)
+	buf := make([]byte, storedOffset(off+int64(len(p))-1)+storedChunkSize-start)
+	n, err := f.File.ReadAt(buf, start+headerSize)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	// Decrypt the chunks in place, moving the plaintext of each to where it
+	// would be without the IVs.
+	var size int
+	buf = buf[:n]
+	for i := 0; i*storedChunkSize+chunkIVSize < n; i++ {
+		c := buf[i*storedChunkSize:]
+		if len(c) > storedChunkSize {
+			c = c[:storedChunkSize]
+		}
+		iv, data := c[:chunkIVSize], c[chunkIVSize:]
+		if isZero(iv) {
+			for j := range data {
+				data[j] = 0
+			}
+		} else {
+			cipher.NewCTR(f.block, iv).XORKeyStream(data, data)
+		}
+		size = copy(buf[i*chunkSize:], data) + i*chunkSize
+	}
+	skip := int(off % chunkSize)
+	if skip >= size {
+		return 0, io.EOF
+	}
+	m := copy(p, buf[skip:size])
+	if m < len(p) {
+		return m, io.EOF
+	}
+	return m, nil
+}
+
+// Write implements io.Writer.
+func (f *chunkedFile) Write(p []byte) (int, error) {
+	n, err := f.WriteAt(p, f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+// WriteAt implements io.WriterAt.
+func (f *chunkedFile) WriteAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// The plaintext of the chunks covered by the write, starting at lo. The
+	// existing contents of the first and last chunks are preserved around p.
+	lo := off / chunkSize * chunkSize
+	end := off + int64(len(p))
+	hi := (end + chunkSize - 1) / chunkSize * chunkSize
+	if int64(cap(f.plain)) < hi-lo {
+		f.plain = make([]byte, hi-lo)
+	}
+	plain := f.plain[:hi-lo]
+	for i := range plain {
+		plain[i] = 0
+	}
+	size := end - lo
+	readChunk := func(c int64) error {
+		n, err := f.readAtLocked(plain[c-lo:][:chunkSize], c)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if s := c - lo + int64(n); s > size {
+			size = s
+		}
+		return nil
+	}
+	if off > lo {
+		if err := readChunk(lo); err != nil {
+			return 0, err
+		}
+	}
+	if last := hi - chunkSize; end < hi && (last > lo || off == lo) {
+		if err := readChunk(last); err != nil {
+			return 0, err
+		}
+	}
+	copy(plain[off-lo:], p)
+	plain = plain[:size]
+
+	stored := storedSize(size)
+	if int64(cap(f.stored)) < stored {
+		f.stored = make([]byte, stored)
+	}
+	buf := f.stored[:stored]
+	for i := 0; i*chunkSize < len(plain); i++ {
+		c := plain[i*chunkSize:]
+		if len(c) > chunkSize {
+			c = c[:chunkSize]
+		}
+		sc := buf[i*storedChunkSize:][:chunkIVSize+len(c)]
+		iv := sc[:chunkIVSize]
+		if _, err := rand.Read(iv); err != nil {
+			return 0, err
+		}
+		cipher.NewCTR(f.block, iv).XORKeyStream(sc[chunkIVSize:], c)
+	}
+	if _, err := f.File.WriteAt(buf, storedOffset(lo)+headerSize); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Preallocate implements vfs.File.
+func (f *chunkedFile) Preallocate(offset, length int64) error {
+	start := storedOffset(offset)
+	return f.File.Preallocate(start+headerSize, storedSize(offset+length)-start)
+}
+
+// Stat implements vfs.File.
+func (f *chunkedFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{FileInfo: info, chunked: true}, nil
+}
+
+// SyncTo implements vfs.File.
+func (f *chunkedFile) SyncTo(length int64) (fullSync bool, err error) {
+	return f.File.SyncTo(storedSize(length) + headerSize)
+}
+
+// Prefetch implements vfs.File.
+func (f *chunkedFile) Prefetch(offset, length int64) error {
+	start := storedOffset(offset)
+	return f.File.Prefetch(start+headerSize, storedSize(offset+length)-start)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,657 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package encryptedfs implements a vfs.FS that encrypts the files it writes,
+// providing encryption at rest for all of a store's files, including its
+// sstables, WALs and MANIFESTs.
+//
+// Every file is encrypted with its own randomly generated data key using
+// AES-CTR, which permits the random access reads of ReadAt. Files written
+// sequentially are encrypted with a single key stream. Files opened with
+// OpenReadWrite, whose contents WriteAt may overwrite, are divided into chunks
+// that are encrypted with a new IV every time they're written, so that a key
+// stream is never reused. The data key is stored in a header at the beginning
+// of the file,
+// encrypted and authenticated with AES-GCM using a store key. Store keys are
+// supplied by the user and never written by the FS. Each is identified by an
+// ID, which is recorded in the header of the files it encrypts, so that files
+// written with a previous store key remain readable after key rotation as long
+// as that key is still supplied.
+//
+// The store key with which new files are encrypted is recorded in a key
+// registry file, which also records every store key that has been used and
+// holds the information needed to verify that a store key with a given ID is
+// the one that was used before. See Options.RegistryPath.
+package encryptedfs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// Key is a store key, with which the data keys of files are encrypted.
+type Key struct {
+	// ID identifies the key. It's recorded in the files encrypted with the
+	// key, and must be at most MaxKeyIDLen bytes.
+	ID string
+	// Secret is the AES key, of 16, 24 or 32 bytes.
+	Secret []byte
+}
+
+// MaxKeyIDLen is the maximum length of a Key's ID.
+const MaxKeyIDLen = 32
+
+func (k Key) validate() error {
+	if k.ID == "" || len(k.ID) > MaxKeyIDLen {
+		return errors.Errorf("encryptedfs: key ID %q must be 1 to %d bytes", k.ID, MaxKeyIDLen)
+	}
+	switch len(k.Secret) {
+	case 16, 24, 32:
+		return nil
+	default:
+		return errors.Errorf("encryptedfs: key %q is %d bytes; must be 16, 24 or 32", k.ID, len(k.Secret))
+	}
+}
+
+// ParseKeys parses store keys, one per line, each an ID followed by
+// whitespace and the hex encoded secret. Blank lines and lines beginning with
+// # are ignored.
+func ParseKeys(r io.Reader) ([]Key, error) {
+	var keys []Key
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("encryptedfs: line %d: expected <id> <hex-secret>", line)
+		}
+		secret, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "encryptedfs: line %d", line)
+		}
+		k := Key{ID: fields[0], Secret: secret}
+		if err := k.validate(); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		keys = append(keys, k)
+	}
+	return keys, scanner.Err()
+}
+
+// Options configures an encrypted FS.
+type Options struct {
+	// Keys are the store keys available to the FS. They must include the keys
+	// of all of the files to be read, including those written before a key
+	// rotation.
+	Keys []Key
+
+	// ActiveKeyID is the ID of the key among Keys with which new files are
+	// encrypted. If empty, the active key recorded in the key registry is
+	// used. Specifying a key other than the registry's rotates the store key:
+	// the registry is updated, and new files are encrypted with the new key,
+	// while existing files remain readable with the keys they were written
+	// with.
+	ActiveKeyID string
+
+	// RegistryPath is the path, in the underlying FS, of the key registry
+	// file. The registry is created if it doesn't exist. If empty, no registry
+	// is used, the keys aren't verified, and the FS can only create files if
+	// ActiveKeyID is set. A store's tooling may omit the registry to read the
+	// store.
+	RegistryPath string
+}
+
+// FS is a vfs.FS which encrypts the files it creates in an underlying FS, and
+// decrypts the files it opens.
+//
+// Directories, the lock files of Lock and the key registry aren't encrypted.
+// File names and sizes aren't hidden. Link, Rename and ReuseForWrite preserve
+// a file's header, and thus its data key, with the file; ReuseForWrite writes a
+// new header, so that a reused file is never written with its previous data
+// key.
+//
+// Only files opened with OpenReadWrite support WriteAt, as specified by
+// vfs.File. They're chunked files (see chunkedFile), and OpenReadWrite
+// rewrites a file written sequentially as a chunked file with a new data key,
+// so that none of its contents are overwritten with the key stream they were
+// written with.
+type FS struct {
+	vfs.FS
+	keys map[string]cipher.AEAD
+	// active is the ID of the key of new files, or empty if the FS can't
+	// create files.
+	active string
+}
+
+var _ vfs.FS = (*FS)(nil)
+
+// New returns an FS which encrypts the files it writes in fs.
+func New(fs vfs.FS, opts Options) (*FS, error) {
+	efs := &FS{
+		FS:     fs,
+		keys:   make(map[string]cipher.AEAD, len(opts.Keys)),
+		active: opts.ActiveKeyID,
+	}
+	for _, k := range opts.Keys {
+		if err := k.validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := efs.keys[k.ID]; ok {
+			return nil, errors.Errorf("encryptedfs: duplicate key %q", k.ID)
+		}
+		aead, err := newAEAD(k.Secret)
+		if err != nil {
+			return nil, err
+		}
+		efs.keys[k.ID] = aead
+	}
+	if opts.RegistryPath != "" {
+		active, err := efs.updateRegistry(opts.RegistryPath, opts.ActiveKeyID)
+		if err != nil {
+			return nil, err
+		}
+		efs.active = active
+	}
+	if efs.active != "" && efs.keys[efs.active] == nil {
+		return nil, errors.Errorf("encryptedfs: active key %q was not provided", efs.active)
+	}
+	return efs, nil
+}
+
+func newAEAD(secret []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ActiveKeyID returns the ID of the key with which new files are encrypted.
+func (fs *FS) ActiveKeyID() string {
+	return fs.active
+}
+
+// KeyID returns the ID of the key with which the named file is encrypted. It
+// may be used to determine when the files encrypted with a previous store key
+// have all been rewritten, after which that key is no longer needed.
+func (fs *FS) KeyID(name string) (string, error) {
+	f, err := fs.FS.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var h [headerSize]byte
+	if _, err := io.ReadFull(f, h[:]); err != nil {
+		return "", errors.Wrapf(errNotEncrypted, "%s", name)
+	}
+	id, err := parseHeaderKeyID(h[:])
+	if err != nil {
+		return "", errors.Wrapf(err, "%s", name)
+	}
+	return id, nil
+}
+
+// Create implements vfs.FS.
+func (fs *FS) Create(name string) (vfs.File, error) {
+	f, err := fs.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.initFile(name, f, false /* chunked */)
+}
+
+// Open implements vfs.FS.
+func (fs *FS) Open(name string, opts ...vfs.OpenOption) (vfs.File, error) {
+	f, err := fs.FS.Open(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, errors.CombineErrors(err, f.Close())
+	}
+	if info.IsDir() {
+		return f, nil
+	}
+	if version, err := peekHeaderVersion(f); err != nil {
+		return nil, errors.CombineErrors(errors.Wrapf(err, "%s", name), f.Close())
+	} else if version == 0 {
+		// A file that was created but whose header wasn't persisted, such as
+		// when crashing soon after its creation, is empty.
+		return &encryptedFile{File: f}, nil
+	}
+	return fs.loadFile(name, f)
+}
+
+// OpenReadWrite implements vfs.FS.
+func (fs *FS) OpenReadWrite(name string, opts ...vfs.OpenOption) (vfs.File, error) {
+	f, err := fs.FS.OpenReadWrite(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if version, err := peekHeaderVersion(f); err != nil {
+		return nil, errors.CombineErrors(errors.Wrapf(err, "%s", name), f.Close())
+	} else if version == 0 {
+		return fs.initFile(name, f, true /* chunked */)
+	}
+	ef, err := fs.loadFile(name, f)
+	if err != nil {
+		return nil, err
+	}
+	if sf, ok := ef.(*encryptedFile); ok {
+		return fs.convertToChunked(name, sf, opts)
+	}
+	return ef, nil
+}
+
+// convertToChunked rewrites the named file, which was written sequentially
+// and whose contents f decrypts, as a chunked file with a new data key, and
+// opens it for reading and writing. The file is rewritten to a temporary file
+// that's renamed over it, so that a crash leaves either the original file or
+// the rewritten one.
+func (fs *FS) convertToChunked(
+	name string, f *encryptedFile, opts []vfs.OpenOption,
+) (vfs.File, error) {
+	tmp := name + ".chunked-tmp"
+	err := func() error {
+		out, err := fs.FS.Create(tmp)
+		if err != nil {
+			return err
+		}
+		cf, err := fs.initFile(tmp, out, true /* chunked */)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(cf, f); err != nil {
+			return errors.CombineErrors(err, cf.Close())
+		}
+		if err := cf.Sync(); err != nil {
+			return errors.CombineErrors(err, cf.Close())
+		}
+		return cf.Close()
+	}()
+	err = errors.CombineErrors(err, f.Close())
+	if err == nil {
+		err = fs.FS.Rename(tmp, name)
+	}
+	if err != nil {
+		_ = fs.FS.Remove(tmp)
+		return nil, errors.Wrapf(err, "encryptedfs: rewriting %s as a chunked file", name)
+	}
+	return fs.OpenReadWrite(name, opts...)
+}
+
+// ReuseForWrite implements vfs.FS.
+func (fs *FS) ReuseForWrite(oldname, newname string) (vfs.File, error) {
+	f, err := fs.FS.ReuseForWrite(oldname, newname)
+	if err != nil {
+		return nil, err
+	}
+	// Overwrite the header with a new data key. Reusing the previous data key
+	// would encrypt the new contents with the same key stream as the old.
+	return fs.initFile(newname, f, false /* chunked */)
+}
+
+// Stat implements vfs.FS.
+func (fs *FS) Stat(name string) (os.FileInfo, error) {
+	info, err := fs.FS.Stat(name)
+	if err != nil || info.IsDir() {
+		return info, err
+	}
+	if info.Size() < headerSize {
+		return fileInfo{FileInfo: info}, nil
+	}
+	// A file whose header is all zeros is reported as empty, as it is by Open.
+	f, err := fs.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	version, err := peekHeaderVersion(f)
+	err = errors.CombineErrors(err, f.Close())
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{
+		FileInfo:   info,
+		headerless: version == 0,
+		chunked:    version == headerVersionChunked,
+	}, nil
+}
+
+// initFile writes a header with a new data key to f, which is positioned at
+// its beginning, and returns f wrapped to encrypt its contents, as a chunked
+// file if chunked is set.
+func (fs *FS) initFile(name string, f vfs.File, chunked bool) (vfs.File, error) {
+	if fs.active == "" {
+		return nil, errors.CombineErrors(
+			errors.Errorf("encryptedfs: can't create %s without an active key", name), f.Close())
+	}
+	var dataKey [dataKeySize]byte
+	var h header
+	h.keyID = fs.active
+	h.chunked = chunked
+	if _, err := rand.Read(dataKey[:]); err != nil {
+		return nil, errors.CombineErrors(err, f.Close())
+	}
+	if _, err := rand.Read(h.iv[:]); err != nil {
+		return nil, errors.CombineErrors(err, f.Close())
+	}
+	buf, err := h.encode(fs.keys[fs.active], dataKey[:])
+	if err != nil {
+		return nil, errors.CombineErrors(err, f.Close())
+	}
+	if _, err := f.Write(buf); err != nil {
+		return nil, errors.CombineErrors(err, f.Close())
+	}
+	ef, err := newFile(f, dataKey[:], h)
+	if err != nil {
+		return nil, errors.CombineErrors(err, f.Close())
+	}
+	return ef, nil
+}
+
+// peekHeaderVersion returns the version recorded in the header f begins with,
+// or 0 if f doesn't begin with a header. A file whose header wasn't persisted,
+// such as when crashing soon after its creation, is either shorter than a
+// header, or begins with a header of zeros if its size was persisted but not
+// its contents. The header is read without moving f's position.
+func peekHeaderVersion(f vfs.File) (byte, error) {
+	var buf [headerSize]byte
+	n, err := f.ReadAt(buf[:], 0)
+	if n < headerSize {
+		if err == nil || err == io.EOF {
+			return 0, nil
+		}
+		return 0, err
+	}
+	for _, b := range buf {
+		if b != 0 {
+			// A file that isn't encrypted may have any version, and is
+			// rejected when its header is parsed.
+			return buf[headerVersionOffset], nil
+		}
+	}
+	return 0, nil
+}
+
+// loadFile reads the header of f, which is positioned at its beginning, and
+// returns f wrapped to decrypt its contents.
+func (fs *FS) loadFile(name string, f vfs.File) (vfs.File, error) {
+	var buf [headerSize]byte
+	if _, err := io.ReadFull(f, buf[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errNotEncrypted
+		}
+		return nil, errors.CombineErrors(errors.Wrapf(err, "%s", name), f.Close())
+	}
+	keyID, err := parseHeaderKeyID(buf[:])
+	if err != nil {
+		return nil, errors.CombineErrors(errors.Wrapf(err, "%s", name), f.Close())
+	}
+	aead := fs.keys[keyID]
+	if aead == nil {
+		return nil, errors.CombineErrors(
+			errors.Errorf("encryptedfs: %s is encrypted with key %q, which was not provided", name, keyID),
+			f.Close())
+	}
+	h, dataKey, err := decodeHeader(buf[:], aead)
+	if err != nil {
+		return nil, errors.CombineErrors(errors.Wrapf(err, "%s", name), f.Close())
+	}
+	ef, err := newFile(f, dataKey, h)
+	if err != nil {
+		return nil, errors.CombineErrors(err, f.Close())
+	}
+	return ef, nil
+}
+
+// newFile returns f, whose header is h, wrapped to encrypt and decrypt its
+// contents with dataKey.
+func newFile(f vfs.File, dataKey []byte, h header) (vfs.File, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if h.chunked {
+		return &chunkedFile{File: f, block: block}, nil
+	}
+	return &encryptedFile{File: f, block: block, iv: h.iv}, nil
+}
+
+// The header at the beginning of every encrypted file:
+//
+//	+-----------+-------------+------------------+-------------+
+//	| magic (8B)| version (1B)| key ID len (1B)  | key ID (32B)|
+//	+-----------+-------------+------------------+-------------+
+//	| nonce (12B)| encrypted data key (48B)| IV (16B)| zero (10B)|
+//	+------------+-------------------------+---------+-----------+
+//
+// The data key is encrypted with the store key using AES-GCM, authenticating
+// the preceding fields of the header as additional data. The contents of the
+// file follow the header, encrypted with the data key using AES-CTR. The
+// contents of a file with version headerVersion are encrypted with a counter
+// starting at the IV. Those of a file with version headerVersionChunked are
+// chunked (see chunkedFile), and the IV is unused.
+const (
+	headerMagic          = "pebbleEF"
+	headerVersion        = 1
+	headerVersionChunked = 2
+	headerSize           = 128
+
+	dataKeySize = 32
+
+	headerVersionOffset = len(headerMagic)
+	headerKeyIDOffset   = headerVersionOffset + 2
+	headerNonceOffset   = headerKeyIDOffset + MaxKeyIDLen
+	headerDataKeyOffset = headerNonceOffset + 12
+	headerIVOffset      = headerDataKeyOffset + dataKeySize + 16
+	headerPaddingOffset = headerIVOffset + aes.BlockSize
+)
+
+var errNotEncrypted = errors.New("encryptedfs: file is not encrypted")
+
+type header struct {
+	keyID   string
+	iv      [aes.BlockSize]byte
+	chunked bool
+}
+
+func (h *header) encode(aead cipher.AEAD, dataKey []byte) ([]byte, error) {
+	buf := make([]byte, headerSize)
+	copy(buf, headerMagic)
+	buf[headerVersionOffset] = headerVersion
+	if h.chunked {
+		buf[headerVersionOffset] = headerVersionChunked
+	}
+	buf[headerVersionOffset+1] = byte(len(h.keyID))
+	copy(buf[headerKeyIDOffset:], h.keyID)
+	nonce := buf[headerNonceOffset:headerDataKeyOffset]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	aead.Seal(buf[headerDataKeyOffset:headerDataKeyOffset], nonce, dataKey, buf[:headerNonceOffset])
+	copy(buf[headerIVOffset:], h.iv[:])
+	return buf, nil
+}
+
+// parseHeaderKeyID returns the ID of the key with which the data key in the
+// header buf is encrypted.
+func parseHeaderKeyID(buf []byte) (string, error) {
+	if !bytes.Equal(buf[:len(headerMagic)], []byte(headerMagic)) {
+		return "", errNotEncrypted
+	}
+	if v := buf[headerVersionOffset]; v != headerVersion && v != headerVersionChunked {
+		return "", errors.Errorf("encryptedfs: unsupported header version %d", v)
+	}
+	n := int(buf[headerVersionOffset+1])
+	if n == 0 || n > MaxKeyIDLen {
+		return "", errors.Errorf("encryptedfs: invalid key ID length %d", n)
+	}
+	return string(buf[headerKeyIDOffset : headerKeyIDOffset+n]), nil
+}
+
+func decodeHeader(buf []byte, aead cipher.AEAD) (h header, dataKey []byte, err error) {
+	if h.keyID, err = parseHeaderKeyID(buf); err != nil {
+		return header{}, nil, err
+	}
+	dataKey, err = aead.Open(nil, buf[headerNonceOffset:headerDataKeyOffset],
+		buf[headerDataKeyOffset:headerIVOffset], buf[:headerNonceOffset])
+	if err != nil {
+		return header{}, nil, errors.Errorf(
+			"encryptedfs: can't decrypt data key with key %q: the key is wrong or the header is corrupt", h.keyID)
+	}
+	copy(h.iv[:], buf[headerIVOffset:headerPaddingOffset])
+	h.chunked = buf[headerVersionOffset] == headerVersionChunked
+	return h, dataKey, nil
+}
+
+// encryptedFile wraps a file of the underlying FS that's written sequentially,
+// encrypting the data written to it and decrypting the data read from it. The
+// offsets of its methods are relative to the end of the header.
+type encryptedFile struct {
+	vfs.File
+	// block is the cipher of the data key. It's nil for a file without a
+	// header, which is read as empty.
+	block cipher.Block
+	iv    [aes.BlockSize]byte
+	// pos is the offset of the next Read or Write.
+	pos int64
+	// buf holds the ciphertext of writes. Writes are sequential, so it's
+	// reused between them.
+	buf []byte
+}
+
+var _ vfs.File = (*encryptedFile)(nil)
+
+// xorKeyStream XORs src with the key stream at offset off, storing the result
+// in dst.
+func (f *encryptedFile) xorKeyStream(dst, src []byte, off int64) {
+	if len(src) == 0 {
+		return
+	}
+	// The counter of the block containing off is the IV plus the block's index,
+	// as a 128-bit big-endian integer.
+	var ctr [aes.BlockSize]byte
+	copy(ctr[:], f.iv[:])
+	carry := uint64(off / aes.BlockSize)
+	for i := len(ctr) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(ctr[i]) + carry&0xff
+		ctr[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+	stream := cipher.NewCTR(f.block, ctr[:])
+	if skip := int(off % aes.BlockSize); skip > 0 {
+		var discard [aes.BlockSize]byte
+		stream.XORKeyStream(discard[:skip], discard[:skip])
+	}
+	stream.XORKeyStream(dst, src)
+}
+
+func (f *encryptedFile) encrypt(p []byte, off int64) []byte {
+	if cap(f.buf) < len(p) {
+		f.buf = make([]byte, len(p))
+	}
+	buf := f.buf[:len(p)]
+	f.xorKeyStream(buf, p, off)
+	return buf
+}
+
+// Read implements io.Reader.
+func (f *encryptedFile) Read(p []byte) (int, error) {
+	if f.block == nil {
+		return 0, io.EOF
+	}
+	n, err := f.File.Read(p)
+	f.xorKeyStream(p[:n], p[:n], f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *encryptedFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.block == nil {
+		return 0, io.EOF
+	}
+	n, err := f.File.ReadAt(p, off+headerSize)
+	f.xorKeyStream(p[:n], p[:n], off)
+	return n, err
+}
+
+// Write implements io.Writer.
+func (f *encryptedFile) Write(p []byte) (int, error) {
+	if f.block == nil {
+		return 0, errors.New("encryptedfs: can't write to a file without a header")
+	}
+	n, err := f.File.Write(f.encrypt(p, f.pos))
+	f.pos += int64(n)
+	return n, err
+}
+
+// WriteAt implements io.WriterAt. It's unsupported, as overwriting data would
+// encrypt it with the key stream it was written with; files opened with
+// OpenReadWrite support it.
+func (f *encryptedFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, errors.New("encryptedfs: WriteAt requires a file opened with OpenReadWrite")
+}
+
+// Preallocate implements vfs.File.
+func (f *encryptedFile) Preallocate(offset, length int64) error {
+	return f.File.Preallocate(offset+headerSize, length)
+}
+
+// Stat implements vfs.File.
+func (f *encryptedFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{FileInfo: info, headerless: f.block == nil}, nil
+}
+
+// SyncTo implements vfs.File.
+func (f *encryptedFile) SyncTo(length int64) (fullSync bool, err error) {
+	return f.File.SyncTo(length + headerSize)
+}
+
+// Prefetch implements vfs.File.
+func (f *encryptedFile) Prefetch(offset, length int64) error {
+	return f.File.Prefetch(offset+headerSize, length)
+}
+
+// fileInfo reports the size of an encrypted file's contents, excluding its
+// header.
+type fileInfo struct {
+	os.FileInfo
+	// headerless is set if the file has no header, and is empty.
+	headerless bool
+	// chunked is set if the file is a chunked file.
+	chunked bool
+}
+
+func (fi fileInfo) Size() int64 {
+	if fi.headerless {
+		return 0
+	}
+	size := fi.FileInfo.Size() - headerSize
+	if size <= 0 {
+		return 0
+	}
+	if fi.chunked {
+		return chunkedSize(size)
+	}
+	return size
+}
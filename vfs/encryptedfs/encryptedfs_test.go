@@ -0,0 +1,450 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package encryptedfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(id string) Key {
+	return Key{ID: id, Secret: bytes.Repeat([]byte(id[:1]), 32)}
+}
+
+// readRaw returns the contents of the named file in the underlying FS.
+func readRaw(t *testing.T, fs vfs.FS, name string) []byte {
+	f, err := fs.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	return b
+}
+
+func readAll(t *testing.T, fs vfs.FS, name string) string {
+	return string(readRaw(t, fs, name))
+}
+
+func TestEncryptedFS(t *testing.T) {
+	mem := vfs.NewMem()
+	fs, err := New(mem, Options{Keys: []Key{testKey("a")}, ActiveKeyID: "a"})
+	require.NoError(t, err)
+
+	// Write a file spanning many AES blocks, in writes that aren't aligned to
+	// them.
+	var want bytes.Buffer
+	f, err := fs.Create("f")
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		s := fmt.Sprintf("plaintext %d;", i)
+		want.WriteString(s)
+		_, err := f.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+
+	raw := readRaw(t, mem, "f")
+	require.Len(t, raw, headerSize+want.Len())
+	require.False(t, bytes.Contains(raw, []byte("plaintext")))
+	require.Equal(t, want.String(), readAll(t, fs, "f"))
+	info, err := fs.Stat("f")
+	require.NoError(t, err)
+	require.Equal(t, int64(want.Len()), info.Size())
+
+	// ReadAt at every offset.
+	f, err = fs.Open("f")
+	require.NoError(t, err)
+	info, err = f.Stat()
+	require.NoError(t, err)
+	require.Equal(t, int64(want.Len()), info.Size())
+	for off := 0; off < want.Len(); off++ {
+		p := make([]byte, 20)
+		n, err := f.ReadAt(p, int64(off))
+		if off+len(p) > want.Len() {
+			require.Equal(t, io.EOF, err)
+		} else {
+			require.NoError(t, err)
+		}
+		require.Equal(t, want.Bytes()[off:off+n], p[:n])
+	}
+	require.NoError(t, f.Close())
+
+	// WriteAt overwrites a range of the file.
+	f, err = fs.OpenReadWrite("f")
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("OVERWRITTEN"), 37)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	copy(want.Bytes()[37:], "OVERWRITTEN")
+	require.Equal(t, want.String(), readAll(t, fs, "f"))
+
+	// OpenReadWrite creates a missing file.
+	f, err = fs.OpenReadWrite("g")
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("plaintext g"), 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.Equal(t, "plaintext g", readAll(t, fs, "g"))
+	require.False(t, bytes.Contains(readRaw(t, mem, "g"), []byte("plaintext")))
+
+	// A link shares the header, and so is readable.
+	require.NoError(t, fs.Link("f", "link"))
+	require.Equal(t, want.String(), readAll(t, fs, "link"))
+
+	// ReuseForWrite writes a new header, so the reused file isn't written with
+	// the previous data key.
+	oldHeader := readRaw(t, mem, "link")[:headerSize]
+	f, err = fs.ReuseForWrite("link", "reused")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("reused"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	newHeader := readRaw(t, mem, "reused")[:headerSize]
+	require.NotEqual(t, oldHeader, newHeader)
+	require.Equal(t, "reused", readAll(t, fs, "reused")[:len("reused")])
+
+	// An empty file, such as one whose header was lost in a crash, is read as
+	// empty.
+	empty, err := mem.Create("empty")
+	require.NoError(t, err)
+	require.NoError(t, empty.Close())
+	require.Equal(t, "", readAll(t, fs, "empty"))
+
+	// Files can't be read with a different key, or without one.
+	other, err := New(mem, Options{Keys: []Key{{ID: "a", Secret: bytes.Repeat([]byte("x"), 32)}}})
+	require.NoError(t, err)
+	_, err = other.Open("f")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "key is wrong")
+	other, err = New(mem, Options{Keys: []Key{testKey("b")}})
+	require.NoError(t, err)
+	_, err = other.Open("f")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `key "a", which was not provided`)
+	// Nor can it create files, without an active key.
+	_, err = other.Create("h")
+	require.Error(t, err)
+
+	// Unencrypted files are detected.
+	plain, err := mem.Create("plain")
+	require.NoError(t, err)
+	_, err = plain.Write(bytes.Repeat([]byte("plaintext"), 100))
+	require.NoError(t, err)
+	require.NoError(t, plain.Close())
+	_, err = fs.Open("plain")
+	require.ErrorIs(t, err, errNotEncrypted)
+}
+
+// Tests that overwriting a file opened with OpenReadWrite never reuses a key
+// stream, whether within one open or across opens, including of a file that
+// was written sequentially.
+func TestOverwrite(t *testing.T) {
+	mem := vfs.NewMem()
+	fs, err := New(mem, Options{Keys: []Key{testKey("a")}, ActiveKeyID: "a"})
+	require.NoError(t, err)
+
+	f, err := fs.Create("f")
+	require.NoError(t, err)
+	_, err = f.Write(bytes.Repeat([]byte("x"), 3*chunkSize))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	oldHeader := readRaw(t, mem, "f")[:headerSize]
+
+	// The data written at an offset spanning two chunks, as stored.
+	const off = chunkSize - 10
+	data := []byte("overwritten plaintext")
+	var stored [][]byte
+	write := func(f vfs.File) {
+		_, err := f.WriteAt(data, off)
+		require.NoError(t, err)
+		raw := readRaw(t, mem, "f")
+		start := headerSize + storedOffset(off)
+		stored = append(stored, raw[start:start+2*storedChunkSize])
+	}
+	f, err = fs.OpenReadWrite("f")
+	require.NoError(t, err)
+	write(f)
+	write(f)
+	require.NoError(t, f.Close())
+	f, err = fs.OpenReadWrite("f")
+	require.NoError(t, err)
+	write(f)
+	require.NoError(t, f.Close())
+	for i := range stored {
+		for j := 0; j < i; j++ {
+			require.NotEqual(t, stored[j], stored[i], "writes %d and %d", j, i)
+		}
+	}
+
+	// The sequentially written file was rewritten with a new data key.
+	raw := readRaw(t, mem, "f")
+	require.NotEqual(t, oldHeader, raw[:headerSize])
+	id, err := fs.KeyID("f")
+	require.NoError(t, err)
+	require.Equal(t, "a", id)
+	want := bytes.Repeat([]byte("x"), 3*chunkSize)
+	copy(want[off:], data)
+	require.Equal(t, string(want), readAll(t, fs, "f"))
+	info, err := fs.Stat("f")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(want)), info.Size())
+	ls, err := mem.List("")
+	require.NoError(t, err)
+	require.Equal(t, []string{"f"}, ls)
+
+	// Files written sequentially don't support WriteAt.
+	f, err = fs.Create("g")
+	require.NoError(t, err)
+	_, err = f.WriteAt(data, 0)
+	require.Error(t, err)
+	require.NoError(t, f.Close())
+}
+
+// Tests random reads and writes of a file opened with OpenReadWrite against
+// an in-memory copy of its contents.
+func TestChunkedFileRandomized(t *testing.T) {
+	mem := vfs.NewMem()
+	fs, err := New(mem, Options{Keys: []Key{testKey("a")}, ActiveKeyID: "a"})
+	require.NoError(t, err)
+	f, err := fs.OpenReadWrite("f")
+	require.NoError(t, err)
+
+	rng := rand.New(rand.NewSource(1))
+	var want []byte
+	for i := 0; i < 500; i++ {
+		off := rng.Intn(5 * chunkSize)
+		p := make([]byte, 1+rng.Intn(3*chunkSize))
+		rng.Read(p)
+		if rng.Intn(2) == 0 {
+			_, err := f.WriteAt(p, int64(off))
+			require.NoError(t, err)
+			if off+len(p) > len(want) {
+				want = append(want, make([]byte, off+len(p)-len(want))...)
+			}
+			copy(want[off:], p)
+			continue
+		}
+		n, err := f.ReadAt(p, int64(off))
+		if off+len(p) > len(want) {
+			require.Equal(t, io.EOF, err)
+		} else {
+			require.NoError(t, err)
+		}
+		if off < len(want) {
+			require.Equal(t, want[off:off+n], p[:n])
+		} else {
+			require.Equal(t, 0, n)
+		}
+	}
+	info, err := f.Stat()
+	require.NoError(t, err)
+	require.Equal(t, int64(len(want)), info.Size())
+	require.NoError(t, f.Close())
+	require.Equal(t, string(want), readAll(t, fs, "f"))
+}
+
+// Tests that files whose headers weren't persisted in full before a crash are
+// read as empty, and are given a new header when opened for writing.
+func TestCrashBeforeHeaderPersisted(t *testing.T) {
+	mem := vfs.NewStrictMem()
+	fs, err := New(mem, Options{Keys: []Key{testKey("a")}, ActiveKeyID: "a"})
+	require.NoError(t, err)
+	dir, err := mem.OpenDir("")
+	require.NoError(t, err)
+
+	// Create files whose contents aren't synced, and a synced file whose header
+	// is copied into them to simulate torn writes.
+	for _, name := range []string{"empty", "short", "zeroed", "synced"} {
+		f, err := fs.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte("plaintext " + name))
+		require.NoError(t, err)
+		if name == "synced" {
+			require.NoError(t, f.Sync())
+		}
+		require.NoError(t, f.Close())
+	}
+	require.NoError(t, dir.Sync())
+	require.NoError(t, dir.Close())
+	mem.SetIgnoreSyncs(true)
+	mem.ResetToSyncedState()
+	mem.SetIgnoreSyncs(false)
+
+	header := readRaw(t, mem, "synced")[:headerSize]
+	writeRaw := func(name string, b []byte) {
+		f, err := mem.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write(b)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	// Only part of the header was written.
+	writeRaw("short", header[:headerSize/2])
+	// The file's size was persisted, but not its contents.
+	writeRaw("zeroed", make([]byte, headerSize+100))
+
+	for _, name := range []string{"empty", "short", "zeroed"} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, "", readAll(t, fs, name))
+			info, err := fs.Stat(name)
+			require.NoError(t, err)
+			require.Equal(t, int64(0), info.Size())
+			f, err := fs.Open(name)
+			require.NoError(t, err)
+			info, err = f.Stat()
+			require.NoError(t, err)
+			require.Equal(t, int64(0), info.Size())
+			n, err := f.ReadAt(make([]byte, 10), 0)
+			require.Equal(t, 0, n)
+			require.Equal(t, io.EOF, err)
+			require.NoError(t, f.Close())
+
+			// Opening the file for writing writes a new header.
+			f, err = fs.OpenReadWrite(name)
+			require.NoError(t, err)
+			_, err = f.WriteAt([]byte("rewritten"), 0)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+			require.Equal(t, "rewritten", readAll(t, fs, name)[:len("rewritten")])
+		})
+	}
+	require.Equal(t, "plaintext synced", readAll(t, fs, "synced"))
+}
+
+func TestKeyRotation(t *testing.T) {
+	mem := vfs.NewMem()
+	require.NoError(t, mem.MkdirAll("db", 0755))
+	const registry = "db/KEY-REGISTRY"
+	write := func(fs vfs.FS, name string) {
+		f, err := fs.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(name))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	fs, err := New(mem, Options{Keys: []Key{testKey("a")}, ActiveKeyID: "a", RegistryPath: registry})
+	require.NoError(t, err)
+	write(fs, "1")
+
+	// Rotate to the key b.
+	fs, err = New(mem, Options{
+		Keys:         []Key{testKey("a"), testKey("b")},
+		ActiveKeyID:  "b",
+		RegistryPath: registry,
+	})
+	require.NoError(t, err)
+	write(fs, "2")
+	for name, keyID := range map[string]string{"1": "a", "2": "b"} {
+		id, err := fs.KeyID(name)
+		require.NoError(t, err)
+		require.Equal(t, keyID, id)
+		require.Equal(t, name, readAll(t, fs, name))
+	}
+
+	r, err := ReadRegistry(mem, registry)
+	require.NoError(t, err)
+	require.Equal(t, "b", r.ActiveKeyID)
+	require.Len(t, r.Keys, 2)
+	require.Equal(t, "a", r.Keys[0].ID)
+	require.Equal(t, "b", r.Keys[1].ID)
+
+	// Without an explicit active key, the registry's is used.
+	fs, err = New(mem, Options{Keys: []Key{testKey("a"), testKey("b")}, RegistryPath: registry})
+	require.NoError(t, err)
+	require.Equal(t, "b", fs.ActiveKeyID())
+
+	// The registry's active key must be provided.
+	_, err = New(mem, Options{Keys: []Key{testKey("a")}, RegistryPath: registry})
+	require.Error(t, err)
+
+	// A key with a registered ID must be the registered key.
+	_, err = New(mem, Options{
+		Keys:         []Key{testKey("a"), {ID: "b", Secret: bytes.Repeat([]byte("x"), 16)}},
+		RegistryPath: registry,
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "doesn't match")
+
+	// Rotating back to a previous key doesn't register it again.
+	_, err = New(mem, Options{Keys: []Key{testKey("a")}, ActiveKeyID: "a", RegistryPath: registry})
+	require.NoError(t, err)
+	r, err = ReadRegistry(mem, registry)
+	require.NoError(t, err)
+	require.Equal(t, "a", r.ActiveKeyID)
+	require.Len(t, r.Keys, 2)
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys(strings.NewReader(`
+# The current key.
+new 000102030405060708090a0b0c0d0e0f
+old 000102030405060708090a0b0c0d0e0f1011121314151617
+`))
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	require.Equal(t, "new", keys[0].ID)
+	require.Len(t, keys[0].Secret, 16)
+	require.Equal(t, "old", keys[1].ID)
+	require.Len(t, keys[1].Secret, 24)
+
+	for _, s := range []string{"k", "k 0001", "k zz", "k 00 01"} {
+		_, err := ParseKeys(strings.NewReader(s))
+		require.Error(t, err, "%q", s)
+	}
+}
+
+func TestDB(t *testing.T) {
+	mem := vfs.NewMem()
+	require.NoError(t, mem.MkdirAll("db", 0755))
+	keys := []Key{testKey("a")}
+	fs, err := New(mem, Options{Keys: keys, ActiveKeyID: "a", RegistryPath: "db/KEY-REGISTRY"})
+	require.NoError(t, err)
+
+	d, err := pebble.Open("db", &pebble.Options{FS: fs})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("plaintext-flushed"), []byte("plaintext-value"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("plaintext-unflushed"), []byte("plaintext-value"), nil))
+	require.NoError(t, d.Close())
+
+	// No file of the store contains the keys or values in plaintext.
+	ls, err := mem.List("db")
+	require.NoError(t, err)
+	var ssts, logs int
+	for _, name := range ls {
+		switch {
+		case strings.HasSuffix(name, ".sst"):
+			ssts++
+		case strings.HasSuffix(name, ".log"):
+			logs++
+		}
+		raw := readRaw(t, mem, mem.PathJoin("db", name))
+		require.False(t, bytes.Contains(raw, []byte("plaintext")), "%s", name)
+	}
+	require.NotZero(t, ssts)
+	require.NotZero(t, logs)
+
+	// The store is readable when reopened, including the WAL.
+	fs, err = New(mem, Options{Keys: keys, RegistryPath: "db/KEY-REGISTRY"})
+	require.NoError(t, err)
+	d, err = pebble.Open("db", &pebble.Options{FS: fs})
+	require.NoError(t, err)
+	for _, k := range []string{"plaintext-flushed", "plaintext-unflushed"} {
+		v, closer, err := d.Get([]byte(k))
+		require.NoError(t, err)
+		require.Equal(t, "plaintext-value", string(v))
+		require.NoError(t, closer.Close())
+	}
+	require.NoError(t, d.Close())
+}
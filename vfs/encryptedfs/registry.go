@@ -0,0 +1,152 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package encryptedfs
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// RegistryVersion is the version of the key registry format.
+const RegistryVersion = 1
+
+// Registry is the content of a key registry file, which records the store
+// keys of an encrypted store. It contains no secrets.
+type Registry struct {
+	Version int `json:"version"`
+	// ActiveKeyID is the ID of the key with which new files are encrypted.
+	ActiveKeyID string `json:"active_key_id"`
+	// Keys are the keys that have been used by the store, in the order in
+	// which they were first used.
+	Keys []RegisteredKey `json:"keys"`
+}
+
+// RegisteredKey describes a store key in a Registry.
+type RegisteredKey struct {
+	ID string `json:"id"`
+	// Created is the time at which the key was registered.
+	Created time.Time `json:"created"`
+	// Check is a constant encrypted with the key, with which a key supplied
+	// with the ID is verified to be the same key.
+	Check []byte `json:"check"`
+}
+
+// registryCheck is the plaintext of RegisteredKey.Check.
+const registryCheck = "pebble encryptedfs key check"
+
+func (r *Registry) find(id string) *RegisteredKey {
+	for i := range r.Keys {
+		if r.Keys[i].ID == id {
+			return &r.Keys[i]
+		}
+	}
+	return nil
+}
+
+// ReadRegistry reads the key registry file at path. It returns an empty
+// Registry if the file doesn't exist.
+func ReadRegistry(fs vfs.FS, path string) (*Registry, error) {
+	f, err := fs.Open(path)
+	if oserror.IsNotExist(err) {
+		return &Registry{Version: RegistryVersion}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	r := &Registry{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, errors.Wrapf(err, "encryptedfs: parsing key registry %s", path)
+	}
+	if r.Version > RegistryVersion {
+		return nil, errors.Errorf("encryptedfs: key registry %s has unsupported version %d", path, r.Version)
+	}
+	return r, nil
+}
+
+// writeRegistry atomically replaces the key registry file at path.
+func writeRegistry(fs vfs.FS, path string, r *Registry) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	f, err := fs.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Sync(); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := fs.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	dir, err := fs.OpenDir(fs.PathDir(path))
+	if err != nil {
+		return err
+	}
+	return errors.CombineErrors(dir.Sync(), dir.Close())
+}
+
+// updateRegistry verifies the FS's keys against the registry at path, and
+// records the key activeID as the active key if it isn't empty. It returns the
+// active key.
+func (fs *FS) updateRegistry(path string, activeID string) (string, error) {
+	r, err := ReadRegistry(fs.FS, path)
+	if err != nil {
+		return "", err
+	}
+	for _, k := range r.Keys {
+		aead := fs.keys[k.ID]
+		if aead == nil {
+			continue
+		}
+		if len(k.Check) < aead.NonceSize() {
+			return "", errors.Errorf("encryptedfs: key registry %s: invalid check of key %q", path, k.ID)
+		}
+		nonce, ciphertext := k.Check[:aead.NonceSize()], k.Check[aead.NonceSize():]
+		if p, err := aead.Open(nil, nonce, ciphertext, nil); err != nil || string(p) != registryCheck {
+			return "", errors.Errorf("encryptedfs: key %q doesn't match the key registered with its ID", k.ID)
+		}
+	}
+	if activeID == "" || activeID == r.ActiveKeyID {
+		return r.ActiveKeyID, nil
+	}
+
+	// Rotate to the new active key.
+	aead := fs.keys[activeID]
+	if aead == nil {
+		return "", errors.Errorf("encryptedfs: active key %q was not provided", activeID)
+	}
+	if r.find(activeID) == nil {
+		check := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(check); err != nil {
+			return "", err
+		}
+		check = aead.Seal(check, check, []byte(registryCheck), nil)
+		r.Keys = append(r.Keys, RegisteredKey{ID: activeID, Created: time.Now().UTC(), Check: check})
+	}
+	r.Version = RegistryVersion
+	r.ActiveKeyID = activeID
+	if err := writeRegistry(fs.FS, path, r); err != nil {
+		return "", errors.Wrapf(err, "encryptedfs: writing key registry %s", path)
+	}
+	return activeID, nil
+}